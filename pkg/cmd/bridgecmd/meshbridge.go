@@ -40,6 +40,7 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/meshnode"
 	"github.com/webmeshproj/webmesh/pkg/services"
 	"github.com/webmeshproj/webmesh/pkg/services/meshdns"
+	"github.com/webmeshproj/webmesh/pkg/storage"
 	"github.com/webmeshproj/webmesh/pkg/version"
 )
 
@@ -59,6 +60,8 @@ func RunBridgeConnection(ctx context.Context, conf config.BridgeOptions) error {
 		meshConfig.Mesh.MeshDNSAdvertisePort = 0
 		meshConfig.Mesh.UseMeshDNS = false
 		meshConfig.Services.MeshDNS.Enabled = false
+		// Give each mesh its own interface.
+		meshConfig.WireGuard.InterfaceName = conf.InterfaceName(id)
 		// Create a new mesh connection
 		meshConfig, err := meshConfig.NewMeshConfig(ctx, nil)
 		if err != nil {
@@ -118,7 +121,7 @@ func RunBridgeConnection(ctx context.Context, conf config.BridgeOptions) error {
 	for meshID, meshConn := range meshes {
 		id := meshID
 		meshConfig := conf.Meshes[id]
-		srvOpts, err := meshConfig.Services.NewServiceOptions(ctx, meshConn)
+		srvOpts, err := meshConfig.NewServiceOptions(ctx, meshConn)
 		if err != nil {
 			return handleErr(fmt.Errorf("failed to create service options: %w", err))
 		}
@@ -157,6 +160,15 @@ func RunBridgeConnection(ctx context.Context, conf config.BridgeOptions) error {
 		}
 	}
 
+	// Names would be ambiguous across meshes that share a domain.
+	dbs := make(map[string]storage.MeshDB, len(meshes))
+	for meshID, meshConn := range meshes {
+		dbs[meshID] = meshConn.Storage().MeshDB()
+	}
+	if err := storage.ValidateDistinctDomains(ctx, dbs); err != nil {
+		return handleErr(err)
+	}
+
 	// Set up bridge DNS if enabled
 	var dnsPort int
 	if conf.MeshDNS.Enabled {
@@ -17,12 +17,21 @@ limitations under the License.
 package ctlcmd
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
 	"strings"
 
 	"github.com/spf13/cobra"
+	v1 "github.com/webmeshproj/api/go/v1"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/webmeshproj/webmesh/pkg/services/meshapi"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/rpcdb"
 )
 
 var (
@@ -67,8 +76,21 @@ func encodeListToStdout[T proto.Message](cmd *cobra.Command, resp []T) error {
 	return nil
 }
 
+// openQueryDB returns a mesh database backed by the storage query API of the
+// current cluster. The returned closer must be closed when finished.
+func openQueryDB() (storage.MeshDB, io.Closer, error) {
+	client, closer, err := cliConfig.NewStorageQueryClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	db := rpcdb.Open(rpcdb.QuerierFunc(func(ctx context.Context, query *v1.QueryRequest) (*v1.QueryResponse, error) {
+		return client.Query(ctx, query)
+	}))
+	return db, closer, nil
+}
+
 func completeNodes(maxNodes int) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
-	return func(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		if maxNodes > 0 && len(args) >= maxNodes {
 			return nil, cobra.ShellCompDirectiveNoFileComp
 		}
@@ -82,7 +104,8 @@ func completeNodes(maxNodes int) func(*cobra.Command, []string, string) ([]strin
 			return nil, cobra.ShellCompDirectiveError
 		}
 		defer closer.Close()
-		resp, err := client.ListNodes(cmd.Context(), &emptypb.Empty{})
+		opts := meshapi.ListNodesOptions{IDPrefix: toComplete}
+		resp, err := client.ListNodes(opts.AppendToOutgoingContext(cmd.Context()), &emptypb.Empty{})
 		if err != nil {
 			return nil, cobra.ShellCompDirectiveError
 		}
@@ -228,3 +251,35 @@ func completeRoutes(maxRoutes int) func(*cobra.Command, []string, string) ([]str
 		return names, cobra.ShellCompDirectiveNoFileComp
 	}
 }
+
+// fetchMetricsPath returns the body of a GET request to the given URL on a
+// node's metrics server, such as the diagnostics or effective config paths.
+// HTTPS URLs are fetched with the TLS configuration of the current context,
+// including its client certificate when the metrics server requires one.
+func fetchMetricsPath(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	client := http.DefaultClient
+	if req.URL.Scheme == "https" {
+		tlsConfig, err := cliConfig.TLSConfig()
+		if err != nil {
+			return nil, fmt.Errorf("build client TLS config: %w", err)
+		}
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s: %s", resp.Status, string(body))
+	}
+	return body, nil
+}
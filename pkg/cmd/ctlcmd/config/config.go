@@ -144,6 +144,9 @@ type Cluster struct {
 type ClusterConfig struct {
 	// Server is the URL of a discovery node in the cluster.
 	Server string `yaml:"server,omitempty" json:"server,omitempty"`
+	// UnixSocket is the path to a node's local unix socket. When set it is
+	// dialed instead of the server.
+	UnixSocket string `yaml:"unix-socket,omitempty" json:"unix-socket,omitempty"`
 	// Insecure controls whether TLS should be disabled for the cluster connection.
 	Insecure bool `yaml:"insecure,omitempty" json:"insecure,omitempty"`
 	// TLSVerifyChainOnly controls whether only the cluster's TLS chain should be verified.
@@ -229,6 +232,24 @@ func (c *Config) NewWebRTCClient() (v1.WebRTCClient, io.Closer, error) {
 	return v1.NewWebRTCClient(conn), conn, nil
 }
 
+// NewMembershipClient creates a new Membership gRPC client for the current context.
+func (c *Config) NewMembershipClient() (v1.MembershipClient, io.Closer, error) {
+	conn, err := c.DialCurrent()
+	if err != nil {
+		return nil, nil, err
+	}
+	return v1.NewMembershipClient(conn), conn, nil
+}
+
+// NewStorageQueryClient creates a new StorageQueryService gRPC client for the current context.
+func (c *Config) NewStorageQueryClient() (v1.StorageQueryServiceClient, io.Closer, error) {
+	conn, err := c.DialCurrent()
+	if err != nil {
+		return nil, nil, err
+	}
+	return v1.NewStorageQueryServiceClient(conn), conn, nil
+}
+
 // NewAdminClient creates a new Admin gRPC client for the current context.
 func (c *Config) NewAdminClient() (v1.AdminClient, io.Closer, error) {
 	conn, err := c.DialCurrent()
@@ -241,8 +262,11 @@ func (c *Config) NewAdminClient() (v1.AdminClient, io.Closer, error) {
 // DialCurrent connects to the current context.
 func (c *Config) DialCurrent() (*grpc.ClientConn, error) {
 	cluster := c.GetCurrentCluster()
-	if cluster.Server == "" {
-		cluster.Server = DefaultServer
+	target := cluster.Server
+	if cluster.UnixSocket != "" {
+		target = "unix://" + cluster.UnixSocket
+	} else if target == "" {
+		target = DefaultServer
 	}
 	opts, err := c.GetDialOptions()
 	if err != nil {
@@ -254,7 +278,7 @@ func (c *Config) DialCurrent() (*grpc.ClientConn, error) {
 		ctx, cancel = context.WithTimeout(ctx, cluster.ConnectTimeout.Duration)
 		defer cancel()
 	}
-	return grpc.DialContext(ctx, cluster.Server, opts...)
+	return grpc.DialContext(ctx, target, opts...)
 }
 
 // GetDialOptions gets the credentials for the current context.
@@ -456,6 +480,7 @@ func bindFlags(c *Config, flset *pflag.FlagSet, usrIdx, clusterIdx int) {
 
 	fs.StringVar(&c.CurrentContext, "context", c.CurrentContext, "The name of the context to use")
 	fs.StringVar(&c.Clusters[clusterIdx].Cluster.Server, "server", c.Clusters[clusterIdx].Cluster.Server, "The URL of the node to connect to")
+	fs.StringVar(&c.Clusters[clusterIdx].Cluster.UnixSocket, "unix-socket", c.Clusters[clusterIdx].Cluster.UnixSocket, "The path to a node's unix socket to connect to instead of the server")
 	fs.BoolVar(&c.Clusters[clusterIdx].Cluster.TLSSkipVerify, "tls-skip-verify", c.Clusters[clusterIdx].Cluster.TLSSkipVerify, "Whether TLS verification should be skipped for the cluster connection")
 	fs.BoolVar(&c.Clusters[clusterIdx].Cluster.Insecure, "insecure", c.Clusters[clusterIdx].Cluster.Insecure, "Whether TLS should be disabled for the cluster connection")
 	fs.BoolVar(&c.Clusters[clusterIdx].Cluster.PreferLeader, "prefer-leader", c.Clusters[clusterIdx].Cluster.PreferLeader, "Whether to prefer the leader node for the cluster connection")
@@ -0,0 +1,77 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ctlcmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/webmeshproj/webmesh/pkg/services/node"
+)
+
+var connectivityFrom string
+
+func init() {
+	connectivityCmd.Flags().StringVar(&connectivityFrom, "from", "", "node to test from, defaults to the node wmctl is connected to")
+	cobra.CheckErr(connectivityCmd.RegisterFlagCompletionFunc("from", completeNodes(1)))
+	rootCmd.AddCommand(connectivityCmd)
+}
+
+var connectivityCmd = &cobra.Command{
+	Use:   "connectivity NODE_ID",
+	Short: "Tests connectivity from a node to another node in the mesh",
+	Long: `Tests connectivity from a node to another node in the mesh. The source node
+pings the private address of the destination over its WireGuard interface and
+reports whether it replied and how long it took. Destinations blocked by
+network ACLs are reported as unreachable without sending any traffic. When
+RBAC is enabled the caller needs GET on edges for the source node.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeNodes(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, closer, err := cliConfig.NewNodeClient()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		var header metadata.MD
+		ctx := metadata.AppendToOutgoingContext(cmd.Context(), node.ConnectivityTestMeta, args[0])
+		_, err = client.GetStatus(ctx, &v1.GetStatusRequest{Id: connectivityFrom}, grpc.Header(&header))
+		if err != nil {
+			return err
+		}
+		encoded := header.Get(node.ConnectivityResultMeta)
+		if len(encoded) == 0 {
+			return errors.New("the node does not support connectivity tests")
+		}
+		var result node.ConnectivityResult
+		if err := json.Unmarshal([]byte(encoded[0]), &result); err != nil {
+			return fmt.Errorf("decode connectivity result: %w", err)
+		}
+		if !result.Reachable {
+			return fmt.Errorf("%s cannot reach %s: %s", result.Source, result.Destination, result.Reason)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s reached %s at %s via %s in %s\n",
+			result.Source, result.Destination, result.Address, result.Via, result.Latency)
+		return nil
+	},
+}
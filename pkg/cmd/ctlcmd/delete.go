@@ -19,6 +19,8 @@ package ctlcmd
 import (
 	"github.com/spf13/cobra"
 	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
 var (
@@ -32,6 +34,7 @@ func init() {
 	deleteCmd.AddCommand(deleteGroupsCmd)
 	deleteCmd.AddCommand(deleteNetworkACLsCmd)
 	deleteCmd.AddCommand(deleteRoutesCmd)
+	deleteCmd.AddCommand(deleteDNSRecordsCmd)
 
 	deleteEdgesCmd.Flags().StringVar(&getEdgeFrom, "from", "", "The source node ID")
 	deleteEdgesCmd.Flags().StringVar(&getEdgeTo, "to", "", "The destination node ID")
@@ -181,3 +184,26 @@ var deleteEdgesCmd = &cobra.Command{
 		return err
 	},
 }
+
+var deleteDNSRecordsCmd = &cobra.Command{
+	Use:     "dns-records NAME TYPE",
+	Short:   "Delete a static DNS record from the mesh",
+	Aliases: []string{"dns-record", "dnsrecords", "dnsrecord"},
+	Args:    cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		typ, err := types.ParseDNSRecordType(args[1])
+		if err != nil {
+			return err
+		}
+		db, closer, err := openQueryDB()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		if err := db.MeshState().DeleteDNSRecord(cmd.Context(), args[0], typ); err != nil {
+			return err
+		}
+		cmd.Println("Deleted dns record", args[0], typ)
+		return nil
+	},
+}
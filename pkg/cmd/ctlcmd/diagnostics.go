@@ -0,0 +1,53 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ctlcmd
+
+import "github.com/spf13/cobra"
+
+var diagnosticsURL string
+
+func init() {
+	diagnosticsCmd.Flags().StringVar(&diagnosticsURL, "url", "http://localhost:8080/diagnostics", "URL of the node's diagnostics report, served by the metrics server at services.metrics.diagnostics-path (use the node's mesh address or https when it is remote)")
+	rootCmd.AddCommand(diagnosticsCmd)
+}
+
+var diagnosticsCmd = &cobra.Command{
+	Use:   "diagnostics",
+	Short: "Dump a network diagnostics report from a node",
+	Long: `Dump a network diagnostics report from a node.
+
+The report includes the WireGuard interface configuration, peers with their
+last handshake times, installed routes, DNS servers, a firewall summary, and
+the endpoints the node advertises. It is served as JSON by the node's metrics
+server when services.metrics.diagnostics-path is set.
+
+The report exposes the mesh topology. The node only serves it to clients on a
+loopback or mesh address, or to clients presenting a verified certificate when
+services.metrics.tls and services.api.mtls are set. Use --url to reach a node
+over its mesh address, and an https URL when the metrics server uses TLS. The
+client certificate of the current context is presented over TLS.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SetOutput(cmd.OutOrStdout())
+		body, err := fetchMetricsPath(cmd.Context(), diagnosticsURL)
+		if err != nil {
+			return err
+		}
+		cmd.Print(string(body))
+		return nil
+	},
+}
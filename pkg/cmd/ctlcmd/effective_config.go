@@ -0,0 +1,48 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ctlcmd
+
+import "github.com/spf13/cobra"
+
+var effectiveConfigURL string
+
+func init() {
+	effectiveConfigCmd.Flags().StringVar(&effectiveConfigURL, "url", "http://localhost:8080/config", "URL of the node's effective configuration, served by the metrics server at services.metrics.config-path (use the node's mesh address or https when it is remote)")
+	rootCmd.AddCommand(effectiveConfigCmd)
+}
+
+var effectiveConfigCmd = &cobra.Command{
+	Use:   "effective-config",
+	Short: "Dump the effective configuration of a node",
+	Long: `Dump the effective configuration of a node.
+
+The configuration is the one the node is actually running with, after files,
+environment variables, and flags are merged. Keys, passwords, and tokens are
+redacted, so the output can be attached to bug reports. It is served as JSON
+by the node's metrics server when services.metrics.config-path is set, to the
+same clients as the diagnostics report (see wmctl diagnostics --help).`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SetOutput(cmd.OutOrStdout())
+		body, err := fetchMetricsPath(cmd.Context(), effectiveConfigURL)
+		if err != nil {
+			return err
+		}
+		cmd.Print(string(body))
+		return nil
+	},
+}
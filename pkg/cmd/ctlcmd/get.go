@@ -17,26 +17,53 @@ limitations under the License.
 package ctlcmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
 	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
+	"github.com/webmeshproj/webmesh/pkg/services/meshapi"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
 var (
-	getEdgeFrom string
-	getEdgeTo   string
+	getEdgeFrom      string
+	getEdgeTo        string
+	getGraphOutput   string
+	getNodesPageSize int
+	getNodesToken    string
+	getNodesPrefix   string
+	getNodesFeatures []string
+	getNodesZone     string
 )
 
 func init() {
+	getNodesCmd.Flags().IntVar(&getNodesPageSize, "page-size", 0, "The maximum number of nodes to return, 0 returns all nodes")
+	getNodesCmd.Flags().StringVar(&getNodesToken, "page-token", "", "The page token printed with the previous page")
+	getNodesCmd.Flags().StringVar(&getNodesPrefix, "id-prefix", "", "Only list nodes whose ID starts with this prefix")
+	getNodesCmd.Flags().StringSliceVar(&getNodesFeatures, "feature", nil, "Only list nodes exposing these features")
+	getNodesCmd.Flags().StringVar(&getNodesZone, "zone", "", "Only list nodes in this zone")
 	getCmd.AddCommand(getNodesCmd)
+	getGraphCmd.Flags().StringVarP(&getGraphOutput, "output", "o", "dot", "The output format of the graph (dot or json)")
+	cobra.CheckErr(getGraphCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{"dot", "json"}, cobra.ShellCompDirectiveNoFileComp)))
 	getCmd.AddCommand(getGraphCmd)
 	getCmd.AddCommand(getRolesCmd)
 	getCmd.AddCommand(getRoleBindingsCmd)
 	getCmd.AddCommand(getGroupsCmd)
 	getCmd.AddCommand(getNetworkACLsCmd)
 	getCmd.AddCommand(getRoutesCmd)
+	getCmd.AddCommand(getMeshConfigCmd)
+	getCmd.AddCommand(getDNSRecordsCmd)
+	getCmd.AddCommand(getComputedPeersCmd)
 
 	getEdgesCmd.Flags().StringVar(&getEdgeFrom, "from", "", "The source node ID")
 	getEdgesCmd.Flags().StringVar(&getEdgeTo, "to", "", "The destination node ID")
@@ -73,19 +100,43 @@ var getNodesCmd = &cobra.Command{
 			}
 			return encodeToStdout(cmd, resp)
 		}
-		resp, err := client.ListNodes(cmd.Context(), &emptypb.Empty{})
+		opts := meshapi.ListNodesOptions{
+			PageSize:  getNodesPageSize,
+			PageToken: getNodesToken,
+			IDPrefix:  getNodesPrefix,
+			ZoneID:    getNodesZone,
+		}
+		for _, name := range getNodesFeatures {
+			feature, err := meshapi.ParseFeature(name)
+			if err != nil {
+				return err
+			}
+			opts.Features = append(opts.Features, feature)
+		}
+		var header metadata.MD
+		resp, err := client.ListNodes(opts.AppendToOutgoingContext(cmd.Context()), &emptypb.Empty{}, grpc.Header(&header))
 		if err != nil {
 			return err
 		}
-		return encodeListToStdout(cmd, resp.Nodes)
+		if err := encodeListToStdout(cmd, resp.Nodes); err != nil {
+			return err
+		}
+		if next := header.Get(meshapi.NextPageTokenMeta); len(next) > 0 {
+			fmt.Fprintf(os.Stderr, "Next page token: %s\n", next[0])
+		}
+		return nil
 	},
 }
 
 var getGraphCmd = &cobra.Command{
-	Use:   "graph",
-	Short: "Get the mesh graph in DOT format",
-	Args:  cobra.NoArgs,
+	Use:     "graph",
+	Short:   "Get the mesh graph in DOT or JSON format",
+	Aliases: []string{"topology"},
+	Args:    cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, _ []string) error {
+		if getGraphOutput != "dot" && getGraphOutput != "json" {
+			return fmt.Errorf("invalid output format %q, must be one of dot or json", getGraphOutput)
+		}
 		client, closer, err := cliConfig.NewMeshClient()
 		if err != nil {
 			return err
@@ -95,11 +146,96 @@ var getGraphCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		if getGraphOutput == "json" {
+			// The DOT output is redundant with the nodes and edges.
+			resp.Dot = ""
+			return encodeToStdout(cmd, resp)
+		}
 		fmt.Println(resp.Dot)
 		return nil
 	},
 }
 
+var getMeshConfigCmd = &cobra.Command{
+	Use:     "mesh-config",
+	Short:   "Get the mesh networks, domain, and default network policy",
+	Aliases: []string{"meshconfig"},
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		db, closer, err := openQueryDB()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		config, err := storage.GetMeshConfig(cmd.Context(), db)
+		if err != nil {
+			return err
+		}
+		out, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return err
+		}
+		cmd.Println(string(out))
+		return nil
+	},
+}
+
+var getDNSRecordsCmd = &cobra.Command{
+	Use:     "dns-records [NAME]",
+	Short:   "Get static DNS records served by the mesh DNS servers",
+	Aliases: []string{"dns-record", "dnsrecords", "dnsrecord"},
+	Args:    cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, closer, err := openQueryDB()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		var records types.DNSRecords
+		if len(args) == 1 {
+			records, err = db.MeshState().GetDNSRecords(cmd.Context(), args[0])
+		} else {
+			records, err = db.MeshState().ListDNSRecords(cmd.Context())
+		}
+		if err != nil {
+			return err
+		}
+		out, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		cmd.Println(string(out))
+		return nil
+	},
+}
+
+var getComputedPeersCmd = &cobra.Command{
+	Use:               "computed-peers NODE",
+	Short:             "Get the WireGuard peers and allowed IPs computed for a node",
+	Aliases:           []string{"computedpeers", "cp"},
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeNodes(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, closer, err := openQueryDB()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		id := types.NodeID(args[0])
+		if _, err := db.Peers().Get(cmd.Context(), id); err != nil {
+			return err
+		}
+		peers, err := meshnet.WireGuardPeersFor(cmd.Context(), db, id)
+		if err != nil {
+			return err
+		}
+		slices.SortFunc(peers, func(a, b *v1.WireGuardPeer) int {
+			return strings.Compare(a.GetNode().GetId(), b.GetNode().GetId())
+		})
+		return encodeListToStdout(cmd, peers)
+	},
+}
+
 var getRolesCmd = &cobra.Command{
 	Use:               "roles",
 	Short:             "Get roles from the mesh",
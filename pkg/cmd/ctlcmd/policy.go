@@ -0,0 +1,130 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ctlcmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/webmeshproj/webmesh/pkg/storage"
+)
+
+var (
+	exportPolicyOutput string
+	exportPolicyFormat string
+
+	importPolicyFile       string
+	importPolicyOnConflict string
+)
+
+func init() {
+	exportPolicyFlags := exportPolicyCmd.Flags()
+	exportPolicyFlags.StringVarP(&exportPolicyFormat, "format", "o", "yaml", "The output format of the bundle (yaml or json)")
+	exportPolicyFlags.StringVarP(&exportPolicyOutput, "file", "f", "", "The file to write the bundle to, defaults to stdout")
+	cobra.CheckErr(exportPolicyCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"yaml", "json"}, cobra.ShellCompDirectiveNoFileComp)))
+
+	importPolicyFlags := importPolicyCmd.Flags()
+	importPolicyFlags.StringVarP(&importPolicyFile, "file", "f", "", "The YAML or JSON bundle to import")
+	importPolicyFlags.StringVar(&importPolicyOnConflict, "on-conflict", string(storage.ConflictSkip), "How to handle objects that already exist (skip or overwrite)")
+	cobra.CheckErr(importPolicyCmd.MarkFlagRequired("file"))
+	cobra.CheckErr(importPolicyCmd.RegisterFlagCompletionFunc("on-conflict", cobra.FixedCompletions([]string{string(storage.ConflictSkip), string(storage.ConflictOverwrite)}, cobra.ShellCompDirectiveNoFileComp)))
+
+	exportCmd.AddCommand(exportPolicyCmd)
+	importCmd.AddCommand(importPolicyCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export resources from the mesh",
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import resources into the mesh",
+}
+
+var exportPolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Export the roles, groups, role bindings, network ACLs, and routes in the mesh as a bundle",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, closer, err := openQueryDB()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		bundle, err := storage.ExportPolicyBundle(cmd.Context(), db)
+		if err != nil {
+			return err
+		}
+		var out []byte
+		switch exportPolicyFormat {
+		case "yaml":
+			out, err = bundle.EncodeYAML()
+		case "json":
+			out, err = bundle.EncodeJSON()
+		default:
+			return fmt.Errorf("invalid output format %q", exportPolicyFormat)
+		}
+		if err != nil {
+			return err
+		}
+		if exportPolicyOutput != "" {
+			return os.WriteFile(exportPolicyOutput, out, 0644)
+		}
+		_, err = cmd.OutOrStdout().Write(out)
+		return err
+	},
+}
+
+var importPolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Import a bundle of roles, groups, role bindings, network ACLs, and routes into the mesh",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		onConflict := storage.ConflictPolicy(importPolicyOnConflict)
+		if !onConflict.IsValid() {
+			return fmt.Errorf("invalid conflict policy %q", importPolicyOnConflict)
+		}
+		data, err := os.ReadFile(importPolicyFile)
+		if err != nil {
+			return err
+		}
+		bundle, err := storage.ParsePolicyBundle(data)
+		if err != nil {
+			return err
+		}
+		db, closer, err := openQueryDB()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		skipped, err := bundle.Import(cmd.Context(), db, onConflict)
+		if err != nil {
+			return err
+		}
+		for _, name := range skipped {
+			fmt.Fprintf(cmd.OutOrStdout(), "Skipped existing %s\n", name)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Imported policy bundle from %s\n", importPolicyFile)
+		return nil
+	},
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ctlcmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+)
+
+func init() {
+	rootCmd.AddCommand(promoteCmd)
+	rootCmd.AddCommand(demoteCmd)
+}
+
+var promoteCmd = &cobra.Command{
+	Use:               "promote NODE_ID",
+	Short:             "Promotes an observer in the storage consensus to a voter",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeNodes(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, closer, err := cliConfig.NewMembershipClient()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		_, err = client.Update(cmd.Context(), &v1.UpdateRequest{
+			Id:      args[0],
+			AsVoter: true,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Promoted %s to voter\n", args[0])
+		return nil
+	},
+}
+
+var demoteCmd = &cobra.Command{
+	Use:   "demote NODE_ID",
+	Short: "Demotes a voter in the storage consensus to an observer",
+	Long: `Demotes a voter in the storage consensus to an observer without the node
+having to leave the mesh. The leader cannot be demoted, and the remaining
+voters must still make up a quorum of the current configuration.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeNodes(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, closer, err := cliConfig.NewMembershipClient()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		ctx := metadata.AppendToOutgoingContext(cmd.Context(), leaderproxy.DemoteMeta, "true")
+		_, err = client.Update(ctx, &v1.UpdateRequest{Id: args[0]})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Demoted %s to observer\n", args[0])
+		return nil
+	},
+}
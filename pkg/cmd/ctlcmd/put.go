@@ -21,6 +21,10 @@ import (
 
 	"github.com/spf13/cobra"
 	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
 var (
@@ -47,12 +51,15 @@ var (
 	putRouteNode    string
 	putRouteCIDRs   []string
 	putRouteNextHop string
+	putRouteForce   bool
 
 	putEdgeFrom   string
 	putEdgeTo     string
 	putEdgeWeight int32
 	putEdgeICE    bool
 	putEdgeLibp2p bool
+
+	putDNSRecordTTL uint32
 )
 
 func init() {
@@ -96,6 +103,7 @@ func init() {
 	putRouteFlags.StringVar(&putRouteNode, "node", "", "node to add the route to")
 	putRouteFlags.StringArrayVar(&putRouteCIDRs, "cidr", nil, "CIDRs to add to the route")
 	putRouteFlags.StringVar(&putRouteNextHop, "next-hop", "", "next hop to add to the route")
+	putRouteFlags.BoolVar(&putRouteForce, "force", false, "allow destinations inside the mesh networks, which can cause routing loops")
 	cobra.CheckErr(putRouteCmd.MarkFlagRequired("node"))
 	cobra.CheckErr(putRouteCmd.MarkFlagRequired("cidr"))
 	cobra.CheckErr(putRouteCmd.RegisterFlagCompletionFunc("node", completeNodes(1)))
@@ -112,12 +120,16 @@ func init() {
 	cobra.CheckErr(putEdgeCmd.MarkFlagRequired("from"))
 	cobra.CheckErr(putEdgeCmd.MarkFlagRequired("to"))
 
+	putDNSRecordCmd.Flags().Uint32Var(&putDNSRecordTTL, "ttl", 0, "TTL in seconds to serve the record with")
+	cobra.CheckErr(putDNSRecordCmd.RegisterFlagCompletionFunc("ttl", cobra.NoFileCompletions))
+
 	putCmd.AddCommand(putRoleCmd)
 	putCmd.AddCommand(putRoleBindingCmd)
 	putCmd.AddCommand(putGroupCmd)
 	putCmd.AddCommand(putNetworkACLCmd)
 	putCmd.AddCommand(putRouteCmd)
 	putCmd.AddCommand(putEdgeCmd)
+	putCmd.AddCommand(putDNSRecordCmd)
 
 	rootCmd.AddCommand(putCmd)
 }
@@ -370,7 +382,11 @@ var putRouteCmd = &cobra.Command{
 			return err
 		}
 		defer closer.Close()
-		_, err = client.PutRoute(cmd.Context(), route)
+		ctx := cmd.Context()
+		if putRouteForce {
+			ctx = metadata.AppendToOutgoingContext(ctx, leaderproxy.ForceRouteMeta, "true")
+		}
+		_, err = client.PutRoute(ctx, route)
 		if err != nil {
 			return err
 		}
@@ -409,3 +425,38 @@ var putEdgeCmd = &cobra.Command{
 		return nil
 	},
 }
+
+var putDNSRecordCmd = &cobra.Command{
+	Use:     "dns-records NAME TYPE VALUE...",
+	Short:   "Create or update a static DNS record served by the mesh DNS servers",
+	Aliases: []string{"dns-record", "dnsrecords", "dnsrecord"},
+	Args:    cobra.MinimumNArgs(3),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 1 {
+			return []string{string(types.DNSRecordTypeA), string(types.DNSRecordTypeAAAA), string(types.DNSRecordTypeCNAME)}, cobra.ShellCompDirectiveNoFileComp
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		typ, err := types.ParseDNSRecordType(args[1])
+		if err != nil {
+			return err
+		}
+		db, closer, err := openQueryDB()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		record := types.DNSRecord{
+			Name:   args[0],
+			Type:   typ,
+			Values: args[2:],
+			TTL:    putDNSRecordTTL,
+		}
+		if err := db.MeshState().PutDNSRecord(cmd.Context(), record); err != nil {
+			return err
+		}
+		cmd.Println("put dns record", record.Name, record.Type)
+		return nil
+	},
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ctlcmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/webmeshproj/webmesh/pkg/services/storage"
+)
+
+var raftLogFrom uint64
+
+func init() {
+	raftLogCmd.Flags().Uint64Var(&raftLogFrom, "from", 0, "raft log index to start from, zero starts at the oldest entry still in the log")
+	rootCmd.AddCommand(raftLogCmd)
+}
+
+var raftLogCmd = &cobra.Command{
+	Use:   "raft-log",
+	Short: "Streams the raft log of a storage node",
+	Long: `Streams the raft log of a storage node. Entries from the given index are
+replayed first, and then new entries are printed as they are applied, one
+JSON object per line. Streaming the log requires unrestricted permissions,
+since it carries every value written to the mesh.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		client, closer, err := cliConfig.NewStorageQueryClient()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		ctx := metadata.AppendToOutgoingContext(cmd.Context(), storage.RaftLogFromMeta, strconv.FormatUint(raftLogFrom, 10))
+		stream, err := client.Subscribe(ctx, &v1.SubscribeRequest{})
+		if err != nil {
+			return err
+		}
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+			var entry v1.RaftLogEntry
+			if err := proto.Unmarshal(event.GetValue(), &entry); err != nil {
+				return fmt.Errorf("decode raft log entry %s: %w", event.GetKey(), err)
+			}
+			out, err := protojson.Marshal(&entry)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "{\"index\":%s,\"entry\":%s}\n", event.GetKey(), out)
+		}
+	},
+}
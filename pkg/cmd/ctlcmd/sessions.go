@@ -0,0 +1,88 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ctlcmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
+	"github.com/webmeshproj/webmesh/pkg/services/node"
+)
+
+var sessionsKill string
+
+func init() {
+	sessionsCmd.Flags().StringVar(&sessionsKill, "kill", "", "close the relay session to the given peer before listing the rest")
+	cobra.CheckErr(sessionsCmd.RegisterFlagCompletionFunc("kill", completeNodes(1)))
+	rootCmd.AddCommand(sessionsCmd)
+}
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions [NODE_ID]",
+	Short: "Lists the ICE and libp2p relay sessions of a node",
+	Long: `Lists the ICE and libp2p relay sessions of a node, defaulting to the node
+wmctl is connected to. With --kill the session to the given peer is closed
+first. It is negotiated again on the next peer refresh if the peer is still
+in the mesh. When RBAC is enabled the caller needs GET on data channels to
+list sessions and DELETE to close one.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeNodes(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, closer, err := cliConfig.NewNodeClient()
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		var req v1.GetStatusRequest
+		if len(args) > 0 {
+			req.Id = args[0]
+		}
+		ctx := metadata.AppendToOutgoingContext(cmd.Context(), node.SessionsMeta, "true")
+		if sessionsKill != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, node.KillSessionMeta, sessionsKill)
+		}
+		var header metadata.MD
+		_, err = client.GetStatus(ctx, &req, grpc.Header(&header))
+		if err != nil {
+			return err
+		}
+		encoded := header.Get(node.SessionsResultMeta)
+		if len(encoded) == 0 {
+			return errors.New("the node does not support listing relay sessions")
+		}
+		var sessions []meshnet.Session
+		if err := json.Unmarshal([]byte(encoded[0]), &sessions); err != nil {
+			return fmt.Errorf("decode relay sessions: %w", err)
+		}
+		if sessionsKill != "" {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Closed relay session to %s\n", sessionsKill)
+		}
+		out, err := json.MarshalIndent(sessions, "", "  ")
+		if err != nil {
+			return err
+		}
+		cmd.Println(string(out))
+		return nil
+	},
+}
@@ -123,6 +123,22 @@ func Execute() error {
 		}
 		return err
 	}
+	// Validate the bootstrap options and exit
+	if conf.Bootstrap.DryRun {
+		results, err := conf.Bootstrap.RunDryRun(ctx)
+		if err != nil {
+			return fmt.Errorf("bootstrap dry run: %w", err)
+		}
+		fmt.Println("Bootstrap dry run succeeded")
+		fmt.Println("    Mesh Domain:  ", results.MeshDomain)
+		fmt.Println("    IPv4 Network: ", results.NetworkV4)
+		if conf.Bootstrap.IPv6Network == "" {
+			fmt.Println("    IPv6 Network: ", results.NetworkV6, "(example, a random ULA is generated when bootstrapping)")
+		} else {
+			fmt.Println("    IPv6 Network: ", results.NetworkV6)
+		}
+		return nil
+	}
 
 	// Time to get going
 	log.Info("Starting webmesh node",
@@ -152,6 +168,10 @@ func Execute() error {
 	if err != nil {
 		return err
 	}
+	// Start returns once the mesh connection is ready and the services are started.
+	sd := newSDNotifier()
+	sd.Ready(ctx)
+	defer sd.Stopping()
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 	select {
@@ -164,5 +184,6 @@ func Execute() error {
 		ctx, cancel = context.WithTimeout(context.WithLogger(context.Background(), log), *shutdownTimeout)
 		defer cancel()
 	}
+	sd.Stopping()
 	return node.Stop(ctx)
 }
@@ -0,0 +1,100 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodecmd
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// sdNotifier sends readiness and watchdog notifications to systemd when the
+// node is run as a Type=notify unit. Both are no-ops when the process was not
+// started with a NOTIFY_SOCKET or watchdog, so other platforms are unaffected.
+// There is one per process, since the daemon can run several embedded nodes.
+type sdNotifier struct {
+	notify   func(state string) (bool, error)
+	watchdog func() (time.Duration, error)
+	stop     chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+func newSDNotifier() *sdNotifier {
+	return &sdNotifier{
+		notify: func(state string) (bool, error) {
+			return daemon.SdNotify(false, state)
+		},
+		watchdog: func() (time.Duration, error) {
+			return daemon.SdWatchdogEnabled(false)
+		},
+		stop: make(chan struct{}),
+	}
+}
+
+// Ready tells systemd that the node is ready and starts sending watchdog
+// pings at half the configured watchdog interval, if one is set.
+func (s *sdNotifier) Ready(ctx context.Context) {
+	log := context.LoggerFrom(ctx)
+	sent, err := s.notify(daemon.SdNotifyReady)
+	if err != nil {
+		log.Warn("Failed to notify systemd of readiness", slog.String("error", err.Error()))
+		return
+	}
+	if !sent {
+		return
+	}
+	log.Debug("Notified systemd of readiness")
+	interval, err := s.watchdog()
+	if err != nil {
+		log.Warn("Failed to read systemd watchdog interval", slog.String("error", err.Error()))
+		return
+	}
+	if interval <= 0 {
+		return
+	}
+	log.Debug("Sending systemd watchdog pings", slog.Duration("interval", interval/2))
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if _, err := s.notify(daemon.SdNotifyWatchdog); err != nil {
+					log.Warn("Failed to send systemd watchdog ping", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+// Stopping stops the watchdog pings and tells systemd the node is shutting down.
+func (s *sdNotifier) Stopping() {
+	s.once.Do(func() {
+		close(s.stop)
+		s.wg.Wait()
+		_, _ = s.notify(daemon.SdNotifyStopping)
+	})
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodecmd
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+func TestSystemdNotify(t *testing.T) {
+	t.Parallel()
+
+	newRecorder := func(watchdog time.Duration) (*sdNotifier, func() []string) {
+		var mu sync.Mutex
+		var states []string
+		sd := newSDNotifier()
+		sd.notify = func(state string) (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, state)
+			return true, nil
+		}
+		sd.watchdog = func() (time.Duration, error) {
+			return watchdog, nil
+		}
+		return sd, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return slices.Clone(states)
+		}
+	}
+
+	t.Run("ReadyAndStopping", func(t *testing.T) {
+		t.Parallel()
+		sd, states := newRecorder(0)
+		sd.Ready(context.Background())
+		if got := states(); !slices.Equal(got, []string{daemon.SdNotifyReady}) {
+			t.Fatalf("expected a single ready notification, got %v", got)
+		}
+		sd.Stopping()
+		sd.Stopping()
+		if got := states(); !slices.Equal(got, []string{daemon.SdNotifyReady, daemon.SdNotifyStopping}) {
+			t.Fatalf("expected a single stopping notification on shutdown, got %v", got)
+		}
+	})
+
+	t.Run("WatchdogPings", func(t *testing.T) {
+		t.Parallel()
+		sd, states := newRecorder(40 * time.Millisecond)
+		sd.Ready(context.Background())
+		time.Sleep(200 * time.Millisecond)
+		sd.Stopping()
+		got := states()
+		var pings int
+		for _, state := range got {
+			if state == daemon.SdNotifyWatchdog {
+				pings++
+			}
+		}
+		if pings == 0 {
+			t.Fatalf("expected watchdog pings, got %v", got)
+		}
+		// No pings are sent once stopping.
+		time.Sleep(100 * time.Millisecond)
+		if after := states(); len(after) != len(got) {
+			t.Fatalf("expected no notifications after stopping, got %v", after[len(got):])
+		}
+	})
+}
@@ -21,6 +21,8 @@ import (
 	"fmt"
 
 	"github.com/spf13/pflag"
+
+	"github.com/webmeshproj/webmesh/pkg/crypto"
 )
 
 // AuthOptions are options for authentication into the mesh.
@@ -91,6 +93,10 @@ type MTLSOptions struct {
 	KeyFile string `koanf:"key-file,omitempty"`
 	// KeyData is the base64 encoded TLS key data for the certificate. Either this or KeyFile must be set.
 	KeyData string `koanf:"key-data,omitempty"`
+	// IdentityField is the certificate field the node ID is read from when one is
+	// not configured. One of "cn", "dns-san", or "uri-san". Defaults to "cn". This
+	// should match the identity-field of the mtls plugin on the servers.
+	IdentityField string `koanf:"identity-field,omitempty"`
 }
 
 // IsEmpty returns true if the options are empty.
@@ -139,6 +145,7 @@ func (o *AuthOptions) BindFlags(prefix string, fl *pflag.FlagSet) {
 	fl.StringVar(&o.MTLS.CertData, prefix+"mtls.cert-data", o.MTLS.CertData, "Base64 encoded TLS certificate data to present when joining.")
 	fl.StringVar(&o.MTLS.KeyFile, prefix+"mtls.key-file", o.MTLS.KeyFile, "Path to a TLS key file for the certificate.")
 	fl.StringVar(&o.MTLS.KeyData, prefix+"mtls.key-data", o.MTLS.KeyData, "Base64 encoded TLS key data for the certificate.")
+	fl.StringVar(&o.MTLS.IdentityField, prefix+"mtls.identity-field", o.MTLS.IdentityField, "The certificate field to read the node ID from (cn, dns-san, or uri-san). Defaults to cn.")
 	fl.StringVar(&o.LDAP.Username, prefix+"ldap.username", o.LDAP.Username, "LDAP auth username.")
 	fl.StringVar(&o.LDAP.Password, prefix+"ldap.password", o.LDAP.Password, "LDAP auth password.")
 }
@@ -157,6 +164,9 @@ func (o *AuthOptions) Validate() error {
 		if o.MTLS.KeyFile == "" && o.MTLS.KeyData == "" {
 			return errors.New("auth.mtls.key-file is required")
 		}
+		if _, err := crypto.ParseCertIdentityField(o.MTLS.IdentityField); err != nil {
+			return fmt.Errorf("auth.mtls.identity-field: %w", err)
+		}
 		return nil
 	}
 	if !o.Basic.IsEmpty() {
@@ -95,6 +95,28 @@ func TestAuthConfigValidate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "MTLSURISANIdentity",
+			authOpts: &AuthOptions{
+				MTLS: MTLSOptions{
+					KeyData:       "keydata",
+					CertData:      "certdata",
+					IdentityField: "uri-san",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "MTLSInvalidIdentityField",
+			authOpts: &AuthOptions{
+				MTLS: MTLSOptions{
+					KeyData:       "keydata",
+					CertData:      "certdata",
+					IdentityField: "serial",
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "BasicMissingUsername",
 			authOpts: &AuthOptions{
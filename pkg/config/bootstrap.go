@@ -17,10 +17,15 @@ limitations under the License.
 package config
 
 import (
+	"bytes"
+	"encoding/csv"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/netip"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -62,8 +67,19 @@ type BootstrapOptions struct {
 	DefaultNetworkPolicy string `koanf:"default-network-policy,omitempty"`
 	// DisableRBAC is the flag to disable RBAC when bootstrapping a new cluster.
 	DisableRBAC bool `koanf:"disable-rbac,omitempty"`
+	// RBACManifest is the path to a YAML or JSON file of additional roles, groups, and
+	// role bindings to create when bootstraping a new cluster.
+	RBACManifest string `koanf:"rbac-manifest,omitempty"`
+	// RestoreSnapshot is a local path or file, http, or https URL of a snapshot to restore
+	// the mesh database from when bootstraping a new cluster.
+	RestoreSnapshot string `koanf:"restore-snapshot,omitempty"`
+	// RestoreSnapshotHeaders are headers to send when fetching the restore snapshot over http(s).
+	RestoreSnapshotHeaders map[string]string `koanf:"restore-snapshot-headers,omitempty"`
 	// Force is the force new bootstrap flag.
 	Force bool `koanf:"force,omitempty"`
+	// DryRun validates the bootstrap options, resolves the bootstrap servers and
+	// reports the mesh that would be created, then exits without starting the node.
+	DryRun bool `koanf:"dry-run,omitempty"`
 }
 
 // BootstrapTransportOptions are options for the bootstrap transport.
@@ -85,6 +101,10 @@ type BootstrapTransportOptions struct {
 	// advertise address and locally configured gRPC port for every node in bootstrap-servers. Ports should
 	// be in the form of <node-id>=<port>.
 	ServerGRPCPorts map[string]int `koanf:"server-grpc-ports,omitempty"`
+	// AllowLoopbackAdvertise allows advertising a loopback address while bootstrapping with
+	// servers on other hosts. Those servers will not be able to reach this node, so this is
+	// treated as an error unless explicitly allowed.
+	AllowLoopbackAdvertise bool `koanf:"allow-loopback-advertise,omitempty"`
 }
 
 // NewBootstrapOptions returns a new BootstrapOptions with the default values.
@@ -127,7 +147,11 @@ func (o *BootstrapOptions) BindFlags(prefix string, fs *pflag.FlagSet) {
 	fs.StringSliceVar(&o.Voters, prefix+"voters", o.Voters, "Comma separated list of node IDs to assign voting privileges to when bootstraping a new cluster")
 	fs.StringVar(&o.DefaultNetworkPolicy, prefix+"default-network-policy", o.DefaultNetworkPolicy, "Default network policy to apply to the mesh when bootstraping a new cluster")
 	fs.BoolVar(&o.DisableRBAC, prefix+"disable-rbac", o.DisableRBAC, "Disable RBAC when bootstrapping a new cluster")
+	fs.StringVar(&o.RBACManifest, prefix+"rbac-manifest", o.RBACManifest, "Path to a YAML or JSON file of additional roles, groups, and role bindings to create when bootstrapping a new cluster")
+	fs.StringVar(&o.RestoreSnapshot, prefix+"restore-snapshot", o.RestoreSnapshot, "Local path or file, http, or https URL of a snapshot to restore the mesh database from when bootstrapping a new cluster")
+	fs.StringToStringVar(&o.RestoreSnapshotHeaders, prefix+"restore-snapshot-headers", o.RestoreSnapshotHeaders, "Headers to send when fetching the restore snapshot over http(s)")
 	fs.BoolVar(&o.Force, prefix+"force", o.Force, "Force new bootstrap")
+	fs.BoolVar(&o.DryRun, prefix+"dry-run", o.DryRun, "Validate the bootstrap options and report the mesh that would be created without starting the node")
 	o.Transport.BindFlags(prefix+"transport.", fs)
 }
 
@@ -137,8 +161,9 @@ func (o *BootstrapTransportOptions) BindFlags(prefix string, fs *pflag.FlagSet)
 	fs.StringVar(&o.TCPListenAddress, prefix+"tcp-listen-address", o.TCPListenAddress, "Address to use when using TCP raft consensus to bootstrap")
 	fs.IntVar(&o.TCPConnectionPool, prefix+"tcp-connection-pool", o.TCPConnectionPool, "Maximum number of TCP connections to maintain to other nodes")
 	fs.DurationVar(&o.TCPConnectTimeout, prefix+"tcp-connect-timeout", o.TCPConnectTimeout, "Maximum amount of time to wait for a TCP connection to be established")
-	fs.StringToStringVar(&o.TCPServers, prefix+"tcp-servers", o.TCPServers, "Map of node IDs to raft addresses to bootstrap with")
+	fs.Var(newBootstrapServersValue(&o.TCPServers), prefix+"tcp-servers", "Map of node IDs to raft addresses to bootstrap with")
 	fs.StringToIntVar(&o.ServerGRPCPorts, prefix+"server-grpc-ports", o.ServerGRPCPorts, "Map of node IDs to gRPC ports to bootstrap with")
+	fs.BoolVar(&o.AllowLoopbackAdvertise, prefix+"allow-loopback-advertise", o.AllowLoopbackAdvertise, "Allow advertising a loopback address when bootstrapping with servers on other hosts")
 }
 
 // Validate validates the bootstrap options.
@@ -178,9 +203,82 @@ func (o *BootstrapOptions) Validate() error {
 	if o.DefaultNetworkPolicy != string(firewall.PolicyAccept) && o.DefaultNetworkPolicy != string(firewall.PolicyDrop) {
 		return fmt.Errorf("default network policy must be accept or drop")
 	}
+	if o.RBACManifest != "" {
+		if _, err := storage.LoadRBACManifest(o.RBACManifest); err != nil {
+			return fmt.Errorf("invalid rbac manifest: %w", err)
+		}
+	}
+	if o.RestoreSnapshot != "" {
+		if err := storage.ValidateSnapshotSource(o.RestoreSnapshot); err != nil {
+			return fmt.Errorf("invalid restore snapshot: %w", err)
+		}
+	}
 	return o.Transport.Validate()
 }
 
+// RunDryRun runs all bootstrap validation without side effects. The options are
+// validated as if bootstrapping was enabled, the addresses of the bootstrap
+// servers are resolved, and the results that would be written to a new
+// database are returned.
+func (o *BootstrapOptions) RunDryRun(ctx context.Context) (storage.BootstrapResults, error) {
+	opts := *o
+	opts.Enabled = true
+	if err := opts.Validate(); err != nil {
+		return storage.BootstrapResults{}, err
+	}
+	if err := o.Transport.resolveServers(ctx); err != nil {
+		return storage.BootstrapResults{}, err
+	}
+	var manifest *storage.RBACManifest
+	if o.RBACManifest != "" {
+		var err error
+		manifest, err = storage.LoadRBACManifest(o.RBACManifest)
+		if err != nil {
+			return storage.BootstrapResults{}, fmt.Errorf("invalid rbac manifest: %w", err)
+		}
+	}
+	servers := make([]string, 0, len(o.Transport.TCPServers))
+	for id := range o.Transport.TCPServers {
+		servers = append(servers, id)
+	}
+	slices.Sort(servers)
+	return storage.ValidateBootstrap(&storage.BootstrapOptions{
+		MeshDomain:           o.MeshDomain,
+		IPv4Network:          o.IPv4Network,
+		IPv6Network:          o.IPv6Network,
+		Admin:                o.Admin,
+		DefaultNetworkPolicy: o.DefaultNetworkPolicy,
+		BootstrapNodes:       servers,
+		Voters:               o.Voters,
+		DisableRBAC:          o.DisableRBAC,
+		RBACManifest:         manifest,
+		DryRun:               true,
+	})
+}
+
+// resolveServers checks that the host of every bootstrap server resolves.
+func (o BootstrapTransportOptions) resolveServers(ctx context.Context) error {
+	ids := make([]string, 0, len(o.TCPServers))
+	for id := range o.TCPServers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		addr := o.TCPServers[id]
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("invalid bootstrap server %s=%s: address must be a valid host:port", id, addr)
+		}
+		if _, err := netip.ParseAddr(host); err == nil {
+			continue
+		}
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			return fmt.Errorf("resolve bootstrap server %s=%s: %w", id, addr, err)
+		}
+	}
+	return nil
+}
+
 // Validate validates the bootstrap transport options.
 func (o BootstrapTransportOptions) Validate() error {
 	// Validate TCP options
@@ -198,9 +296,148 @@ func (o BootstrapTransportOptions) Validate() error {
 	if err != nil {
 		return fmt.Errorf("listen address must be a valid host:port")
 	}
+	if err := o.validateServers(); err != nil {
+		return err
+	}
+	if o.LoopbackAdvertiseWithRemoteServers() && !o.AllowLoopbackAdvertise {
+		return fmt.Errorf("advertise address %s is a loopback address but bootstrap servers are on other hosts, set allow-loopback-advertise to override", o.TCPAdvertiseAddress)
+	}
 	return nil
 }
 
+// validateServers checks that every bootstrap server has a valid node ID and
+// host:port address, and that no two servers share an address.
+func (o BootstrapTransportOptions) validateServers() error {
+	ids := make([]string, 0, len(o.TCPServers))
+	for id := range o.TCPServers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	seen := make(map[string]string, len(ids))
+	for _, id := range ids {
+		addr := o.TCPServers[id]
+		if !types.IsValidNodeID(id) {
+			return fmt.Errorf("invalid bootstrap server %s=%s: %q is not a valid node ID", id, addr, id)
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid bootstrap server %s=%s: address must be a valid host:port", id, addr)
+		}
+		if other, ok := seen[addr]; ok {
+			return fmt.Errorf("invalid bootstrap server %s=%s: address is already used by %s", id, addr, other)
+		}
+		seen[addr] = id
+	}
+	return nil
+}
+
+// LoopbackAdvertiseWithRemoteServers returns true if the advertise address resolves to a
+// loopback address while at least one of the bootstrap servers does not. In this case the
+// other servers will not be able to reach this node.
+func (o BootstrapTransportOptions) LoopbackAdvertiseWithRemoteServers() bool {
+	host, _, err := net.SplitHostPort(o.TCPAdvertiseAddress)
+	if err != nil || !isLoopbackHost(host) {
+		return false
+	}
+	for _, addr := range o.TCPServers {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		if !isLoopbackHost(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopbackHost returns true if the given host is or resolves to a loopback address.
+// Hosts that fail to resolve are not considered loopback.
+func isLoopbackHost(host string) bool {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.IsLoopback()
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addrs, err := net.LookupIP(host)
+	if err != nil || len(addrs) == 0 {
+		return false
+	}
+	for _, addr := range addrs {
+		if !addr.IsLoopback() {
+			return false
+		}
+	}
+	return true
+}
+
+// bootstrapServersValue is a pflag.Value for a map of bootstrap servers given as
+// comma-separated <node-id>=<address> pairs. Unlike the generic string map it
+// rejects malformed pairs and node IDs that are given more than once.
+type bootstrapServersValue struct {
+	servers *map[string]string
+	changed bool
+}
+
+func newBootstrapServersValue(servers *map[string]string) *bootstrapServersValue {
+	return &bootstrapServersValue{servers: servers}
+}
+
+func (v *bootstrapServersValue) Set(s string) error {
+	r := csv.NewReader(strings.NewReader(s))
+	entries, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("invalid bootstrap servers %q: %w", s, err)
+	}
+	// The first time the flag is set it replaces the defaults, after that
+	// repeated flags are merged.
+	if !v.changed || *v.servers == nil {
+		*v.servers = make(map[string]string, len(entries))
+	}
+	for _, entry := range entries {
+		id, addr, ok := strings.Cut(entry, "=")
+		id, addr = strings.TrimSpace(id), strings.TrimSpace(addr)
+		if !ok || id == "" || addr == "" {
+			return fmt.Errorf("invalid bootstrap server %q: must be in the form <node-id>=<address>", entry)
+		}
+		if existing, ok := (*v.servers)[id]; ok {
+			return fmt.Errorf("duplicate bootstrap server %q: %s is already set to %s", entry, id, existing)
+		}
+		(*v.servers)[id] = addr
+	}
+	v.changed = true
+	return nil
+}
+
+// String formats the servers the same way as a pflag string map so that the
+// value can be read back with GetStringToString.
+func (v *bootstrapServersValue) String() string {
+	if v.servers == nil {
+		return "[]"
+	}
+	ids := make([]string, 0, len(*v.servers))
+	for id := range *v.servers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	records := make([]string, 0, len(ids))
+	for _, id := range ids {
+		records = append(records, id+"="+(*v.servers)[id])
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(records); err != nil {
+		return "[]"
+	}
+	w.Flush()
+	return "[" + strings.TrimSpace(buf.String()) + "]"
+}
+
+func (v *bootstrapServersValue) Type() string {
+	return "stringToString"
+}
+
 // NewBootstrapTransport returns the bootstrap transport for the configuration.
 func (o *Config) NewBootstrapTransport(ctx context.Context, nodeID string, conn meshnode.Node, host libp2p.Host) (transport.BootstrapTransport, error) {
 	if !o.Bootstrap.Enabled {
@@ -210,6 +447,10 @@ func (o *Config) NewBootstrapTransport(ctx context.Context, nodeID string, conn
 	if len(t.TCPServers) == 0 {
 		return transport.NewNullBootstrapTransport(), nil
 	}
+	if t.AllowLoopbackAdvertise && t.LoopbackAdvertiseWithRemoteServers() {
+		context.LoggerFrom(ctx).Warn("Advertising a loopback bootstrap address, servers on other hosts will not be able to reach this node",
+			slog.String("advertise-address", t.TCPAdvertiseAddress))
+	}
 	return tcp.NewBootstrapTransport(tcp.BootstrapTransportOptions{
 		NodeID:          nodeID,
 		Addr:            t.TCPListenAddress,
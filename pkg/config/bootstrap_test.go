@@ -17,10 +17,14 @@ limitations under the License.
 package config
 
 import (
+	"maps"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/spf13/pflag"
 
+	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/system/firewall"
 )
 
@@ -278,6 +282,170 @@ func TestValidateBootstrapOptions(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "UnsupportedRestoreSnapshotScheme",
+			opts: &BootstrapOptions{
+				Enabled:              true,
+				IPv4Network:          "172.16.0.0/12",
+				MeshDomain:           "webmesh.internal",
+				Admin:                "admin",
+				DefaultNetworkPolicy: string(firewall.PolicyAccept),
+				RestoreSnapshot:      "s3://bucket/snapshot",
+				Transport: BootstrapTransportOptions{
+					TCPAdvertiseAddress: "127.0.0.1:8080",
+					TCPListenAddress:    "[::]:8080",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ValidRestoreSnapshotURL",
+			opts: &BootstrapOptions{
+				Enabled:              true,
+				IPv4Network:          "172.16.0.0/12",
+				MeshDomain:           "webmesh.internal",
+				Admin:                "admin",
+				DefaultNetworkPolicy: string(firewall.PolicyAccept),
+				RestoreSnapshot:      "https://backups.example.com/snapshot",
+				Transport: BootstrapTransportOptions{
+					TCPAdvertiseAddress: "127.0.0.1:8080",
+					TCPListenAddress:    "[::]:8080",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "LoopbackAdvertiseWithRemoteServers",
+			opts: &BootstrapOptions{
+				Enabled:              true,
+				IPv4Network:          "172.16.0.0/12",
+				MeshDomain:           "webmesh.internal",
+				Admin:                "admin",
+				DefaultNetworkPolicy: string(firewall.PolicyAccept),
+				Transport: BootstrapTransportOptions{
+					TCPAdvertiseAddress: "localhost:9001",
+					TCPListenAddress:    "[::]:9001",
+					TCPServers: map[string]string{
+						"node-a": "localhost:9001",
+						"node-b": "10.0.0.2:9001",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "AllowedLoopbackAdvertiseWithRemoteServers",
+			opts: &BootstrapOptions{
+				Enabled:              true,
+				IPv4Network:          "172.16.0.0/12",
+				MeshDomain:           "webmesh.internal",
+				Admin:                "admin",
+				DefaultNetworkPolicy: string(firewall.PolicyAccept),
+				Transport: BootstrapTransportOptions{
+					TCPAdvertiseAddress: "127.0.0.1:9001",
+					TCPListenAddress:    "[::]:9001",
+					TCPServers: map[string]string{
+						"node-a": "127.0.0.1:9001",
+						"node-b": "10.0.0.2:9001",
+					},
+					AllowLoopbackAdvertise: true,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "LoopbackAdvertiseWithLocalServers",
+			opts: &BootstrapOptions{
+				Enabled:              true,
+				IPv4Network:          "172.16.0.0/12",
+				MeshDomain:           "webmesh.internal",
+				Admin:                "admin",
+				DefaultNetworkPolicy: string(firewall.PolicyAccept),
+				Transport: BootstrapTransportOptions{
+					TCPAdvertiseAddress: "127.0.0.1:9001",
+					TCPListenAddress:    "[::]:9001",
+					TCPServers: map[string]string{
+						"node-a": "127.0.0.1:9001",
+						"node-b": "[::1]:9002",
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "InvalidServerID",
+			opts: &BootstrapOptions{
+				Enabled:              true,
+				IPv4Network:          "172.16.0.0/12",
+				MeshDomain:           "webmesh.internal",
+				Admin:                "admin",
+				DefaultNetworkPolicy: string(firewall.PolicyAccept),
+				Transport: BootstrapTransportOptions{
+					TCPAdvertiseAddress: "10.0.0.1:9001",
+					TCPListenAddress:    "[::]:9001",
+					TCPServers: map[string]string{
+						"node a": "10.0.0.1:9001",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ServerAddressWithoutPort",
+			opts: &BootstrapOptions{
+				Enabled:              true,
+				IPv4Network:          "172.16.0.0/12",
+				MeshDomain:           "webmesh.internal",
+				Admin:                "admin",
+				DefaultNetworkPolicy: string(firewall.PolicyAccept),
+				Transport: BootstrapTransportOptions{
+					TCPAdvertiseAddress: "10.0.0.1:9001",
+					TCPListenAddress:    "[::]:9001",
+					TCPServers: map[string]string{
+						"node-a": "10.0.0.1",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "DuplicateServerAddress",
+			opts: &BootstrapOptions{
+				Enabled:              true,
+				IPv4Network:          "172.16.0.0/12",
+				MeshDomain:           "webmesh.internal",
+				Admin:                "admin",
+				DefaultNetworkPolicy: string(firewall.PolicyAccept),
+				Transport: BootstrapTransportOptions{
+					TCPAdvertiseAddress: "10.0.0.1:9001",
+					TCPListenAddress:    "[::]:9001",
+					TCPServers: map[string]string{
+						"node-a": "10.0.0.1:9001",
+						"node-b": "10.0.0.1:9001",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ValidServers",
+			opts: &BootstrapOptions{
+				Enabled:              true,
+				IPv4Network:          "172.16.0.0/12",
+				MeshDomain:           "webmesh.internal",
+				Admin:                "admin",
+				DefaultNetworkPolicy: string(firewall.PolicyAccept),
+				Transport: BootstrapTransportOptions{
+					TCPAdvertiseAddress: "10.0.0.1:9001",
+					TCPListenAddress:    "[::]:9001",
+					TCPServers: map[string]string{
+						"node-a": "10.0.0.1:9001",
+						"node-b": "10.0.0.2:9001",
+					},
+				},
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tc {
 		t.Run(tt.name, func(t *testing.T) {
@@ -296,3 +464,132 @@ func TestValidateBootstrapOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestBootstrapServersFlag(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name    string
+		args    []string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "Valid",
+			args: []string{"--transport.tcp-servers=node-a=10.0.0.1:9001,node-b=10.0.0.2:9001"},
+			want: map[string]string{"node-a": "10.0.0.1:9001", "node-b": "10.0.0.2:9001"},
+		},
+		{
+			name: "RepeatedFlags",
+			args: []string{"--transport.tcp-servers=node-a=10.0.0.1:9001", "--transport.tcp-servers=node-b=10.0.0.2:9001"},
+			want: map[string]string{"node-a": "10.0.0.1:9001", "node-b": "10.0.0.2:9001"},
+		},
+		{
+			name:    "DuplicateID",
+			args:    []string{"--transport.tcp-servers=node-a=10.0.0.1:9001,node-a=10.0.0.2:9001"},
+			wantErr: `duplicate bootstrap server "node-a=10.0.0.2:9001"`,
+		},
+		{
+			name:    "DuplicateIDAcrossFlags",
+			args:    []string{"--transport.tcp-servers=node-a=10.0.0.1:9001", "--transport.tcp-servers=node-a=10.0.0.2:9001"},
+			wantErr: `duplicate bootstrap server "node-a=10.0.0.2:9001"`,
+		},
+		{
+			name:    "MissingAddress",
+			args:    []string{"--transport.tcp-servers=node-a=10.0.0.1:9001,node-b"},
+			wantErr: `invalid bootstrap server "node-b"`,
+		},
+		{
+			name:    "EmptyID",
+			args:    []string{"--transport.tcp-servers==10.0.0.1:9001"},
+			wantErr: `invalid bootstrap server "=10.0.0.1:9001"`,
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			opts := NewBootstrapOptions()
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			opts.BindFlags("", fs)
+			err := fs.Parse(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse flags: %v", err)
+			}
+			if !maps.Equal(opts.Transport.TCPServers, tt.want) {
+				t.Fatalf("expected servers %v, got %v", tt.want, opts.Transport.TCPServers)
+			}
+			// The value must round trip through the flag set for the config loader.
+			got, err := fs.GetStringToString("transport.tcp-servers")
+			if err != nil {
+				t.Fatalf("get servers from flag set: %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("expected flag set servers %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBootstrapDryRun(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	newOpts := func() BootstrapOptions {
+		opts := NewBootstrapOptions()
+		opts.Transport.TCPServers = map[string]string{
+			"node-a": "127.0.0.1:9001",
+			"node-b": "127.0.0.1:9002",
+		}
+		return opts
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		t.Parallel()
+		opts := newOpts()
+		results, err := opts.RunDryRun(ctx)
+		if err != nil {
+			t.Fatalf("dry run: %v", err)
+		}
+		if results.NetworkV4.String() != opts.IPv4Network {
+			t.Errorf("expected ipv4 network %s, got %s", opts.IPv4Network, results.NetworkV4)
+		}
+		if !results.NetworkV6.IsValid() {
+			t.Error("expected dry run to generate an ipv6 network")
+		}
+		if results.MeshDomain != opts.MeshDomain {
+			t.Errorf("expected mesh domain %s, got %s", opts.MeshDomain, results.MeshDomain)
+		}
+	})
+
+	t.Run("InvalidNetwork", func(t *testing.T) {
+		t.Parallel()
+		opts := newOpts()
+		opts.IPv4Network = "not-a-network"
+		if _, err := opts.RunDryRun(ctx); err == nil {
+			t.Fatal("expected dry run to reject an invalid network")
+		}
+	})
+
+	t.Run("UnresolvableServer", func(t *testing.T) {
+		t.Parallel()
+		opts := newOpts()
+		opts.Transport.TCPServers["node-c"] = "node-c.invalid:9003"
+		if _, err := opts.RunDryRun(ctx); err == nil {
+			t.Fatal("expected dry run to reject an unresolvable server")
+		}
+	})
+
+	t.Run("MissingRBACManifest", func(t *testing.T) {
+		t.Parallel()
+		opts := newOpts()
+		opts.RBACManifest = filepath.Join(t.TempDir(), "missing.yaml")
+		if _, err := opts.RunDryRun(ctx); err == nil {
+			t.Fatal("expected dry run to reject a missing rbac manifest")
+		}
+	})
+}
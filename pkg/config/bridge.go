@@ -24,9 +24,14 @@ import (
 
 	"github.com/spf13/pflag"
 
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
 	"github.com/webmeshproj/webmesh/pkg/services/meshdns"
 )
 
+// DefaultBridgeInterfaceNameTemplate is the default template for naming the
+// wireguard interfaces of bridged meshes.
+const DefaultBridgeInterfaceNameTemplate = "webmesh-%s0"
+
 // BridgeOptions are options for the bridge.
 type BridgeOptions struct {
 	// Meshes are the meshes to bridge.
@@ -35,19 +40,26 @@ type BridgeOptions struct {
 	MeshDNS BridgeMeshDNSOptions `koanf:"meshdns,omitempty"`
 	// UseMeshDNS is true if the bridge should use the meshdns server for local name resolution.
 	UseMeshDNS bool `koanf:"use-meshdns,omitempty"`
+	// InterfaceNameTemplate is the template used to name the wireguard interface of
+	// each bridged mesh. Any occurrence of %s is replaced with the mesh ID. If the
+	// template does not contain %s, it is used as a prefix for the mesh ID. Meshes
+	// that explicitly configure an interface name keep it.
+	InterfaceNameTemplate string `koanf:"interface-name-template,omitempty"`
 }
 
 // NewBridgeOptions returns a new empty BridgeOptions.
 func NewBridgeOptions() BridgeOptions {
 	return BridgeOptions{
-		Meshes:  nil,
-		MeshDNS: NewBridgeMeshDNSOptions(),
+		Meshes:                nil,
+		MeshDNS:               NewBridgeMeshDNSOptions(),
+		InterfaceNameTemplate: DefaultBridgeInterfaceNameTemplate,
 	}
 }
 
 // BindFlags binds the flags.
 func (b *BridgeOptions) BindFlags(prefix string, fs *pflag.FlagSet) {
 	fs.BoolVar(&b.UseMeshDNS, prefix+"use-meshdns", b.UseMeshDNS, "Use the meshdns server for local name resolution.")
+	fs.StringVar(&b.InterfaceNameTemplate, prefix+"interface-name-template", b.InterfaceNameTemplate, "Template for bridged mesh interface names. %s is replaced with the mesh ID, otherwise it is used as a prefix.")
 	b.MeshDNS.BindFlags(fs)
 	b.Meshes = map[string]*Config{}
 	// Determine any bridge IDs on the command line.
@@ -63,7 +75,7 @@ func (b *BridgeOptions) BindFlags(prefix string, fs *pflag.FlagSet) {
 				}
 				meshName := split[0]
 				// Make sure it won't overlap with root bridge flags
-				if meshName == "meshdns" || meshName == "use-meshdns" {
+				if meshName == "meshdns" || meshName == "use-meshdns" || strings.HasPrefix(meshName, "interface-name-template") {
 					continue
 				}
 				seen[meshName] = struct{}{}
@@ -136,8 +148,35 @@ func (m *BridgeMeshDNSOptions) BindFlags(fl *pflag.FlagSet) {
 	fl.IntVar(&m.CacheSize, "bridge.meshdns.cache-size", m.CacheSize, "Size of the remote DNS cache (0 = disabled).")
 }
 
+// InterfaceName returns the wireguard interface name to use for the given bridged mesh.
+func (b *BridgeOptions) InterfaceName(meshID string) string {
+	if conf, ok := b.Meshes[meshID]; ok && conf != nil {
+		if conf.WireGuard.InterfaceName != "" && conf.WireGuard.InterfaceName != wireguard.DefaultInterfaceName {
+			return conf.WireGuard.InterfaceName
+		}
+	}
+	if b.InterfaceNameTemplate == "" {
+		return wireguard.DefaultInterfaceName
+	}
+	if strings.Contains(b.InterfaceNameTemplate, "%s") {
+		return strings.ReplaceAll(b.InterfaceNameTemplate, "%s", meshID)
+	}
+	return b.InterfaceNameTemplate + meshID
+}
+
 // Validate recursively validates the config.
 func (b *BridgeOptions) Validate() error {
+	names := make(map[string]string, len(b.Meshes))
+	for meshID := range b.Meshes {
+		name := b.InterfaceName(meshID)
+		if err := wireguard.ValidateInterfaceName(name); err != nil {
+			return fmt.Errorf("invalid interface name for bridged mesh %q, use a shorter bridge.interface-name-template or set wireguard.interface-name: %w", meshID, err)
+		}
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("bridged meshes %q and %q would both use interface %q", other, meshID, name)
+		}
+		names[name] = meshID
+	}
 	for _, conf := range b.Meshes {
 		if err := conf.Validate(); err != nil {
 			return err
@@ -15,3 +15,72 @@ limitations under the License.
 */
 
 package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+)
+
+func TestBridgeInterfaceNames(t *testing.T) {
+	t.Parallel()
+	newBridge := func(template string, meshIDs ...string) *BridgeOptions {
+		opts := NewBridgeOptions()
+		opts.InterfaceNameTemplate = template
+		opts.Meshes = make(map[string]*Config)
+		for _, id := range meshIDs {
+			opts.Meshes[id] = NewDefaultConfig(id)
+		}
+		return &opts
+	}
+
+	t.Run("Template", func(t *testing.T) {
+		t.Parallel()
+		opts := newBridge("wm-%s0", "east")
+		if name := opts.InterfaceName("east"); name != "wm-east0" {
+			t.Errorf("expected interface name wm-east0, got %s", name)
+		}
+	})
+
+	t.Run("Prefix", func(t *testing.T) {
+		t.Parallel()
+		opts := newBridge("wm", "east")
+		if name := opts.InterfaceName("east"); name != "wmeast" {
+			t.Errorf("expected interface name wmeast, got %s", name)
+		}
+	})
+
+	t.Run("ExplicitInterfaceName", func(t *testing.T) {
+		t.Parallel()
+		opts := newBridge(DefaultBridgeInterfaceNameTemplate, "east")
+		opts.Meshes["east"].WireGuard.InterfaceName = "east0"
+		if name := opts.InterfaceName("east"); name != "east0" {
+			t.Errorf("expected interface name east0, got %s", name)
+		}
+	})
+
+	t.Run("LongMeshID", func(t *testing.T) {
+		t.Parallel()
+		meshID := "production-us-east-1"
+		opts := newBridge(DefaultBridgeInterfaceNameTemplate, meshID)
+		name := opts.InterfaceName(meshID)
+		if len(name) <= wireguard.MaxInterfaceNameLength {
+			t.Fatalf("expected %q to exceed the interface name limit", name)
+		}
+		err := opts.Validate()
+		if !errors.Is(err, wireguard.ErrInterfaceNameTooLong) {
+			t.Fatalf("expected ErrInterfaceNameTooLong, got %v", err)
+		}
+	})
+
+	t.Run("DuplicateNames", func(t *testing.T) {
+		t.Parallel()
+		opts := newBridge("wm0", "east", "west")
+		opts.Meshes["east"].WireGuard.InterfaceName = "wmshared"
+		opts.Meshes["west"].WireGuard.InterfaceName = "wmshared"
+		if err := opts.Validate(); err == nil {
+			t.Fatal("expected error for duplicate interface names")
+		}
+	})
+}
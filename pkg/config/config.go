@@ -29,6 +29,8 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
 // DefaultNodeID is the default node ID used if no other is configured
@@ -40,6 +42,24 @@ var DefaultNodeID = func() string {
 	return hostname
 }()
 
+// Node ID strategies that can be used when a node ID is not explicitly configured.
+const (
+	// NodeIDStrategyHostname uses the system hostname as the node ID.
+	NodeIDStrategyHostname = "hostname"
+	// NodeIDStrategyUUID uses a randomly generated UUID as the node ID.
+	NodeIDStrategyUUID = "uuid"
+	// NodeIDStrategyPublicKey derives the node ID from the WireGuard public key.
+	// The ID is stable across restarts as long as the key is persisted.
+	NodeIDStrategyPublicKey = "public-key"
+)
+
+// NodeIDStrategies are the supported node ID strategies.
+var NodeIDStrategies = []string{
+	NodeIDStrategyHostname,
+	NodeIDStrategyUUID,
+	NodeIDStrategyPublicKey,
+}
+
 // Config are the configuration options for running a webmesh node.
 type Config struct {
 	// Global are global options that are overlaid on all other options.
@@ -245,9 +265,20 @@ func (o *Config) NodeID(ctx context.Context) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("parse certificate: %w", err)
 		}
-		// Return the subject common name
-		o.Mesh.NodeID = cert.Subject.CommonName
-		return cert.Subject.CommonName, nil
+		// Read the node ID from the configured identity field
+		field, err := crypto.ParseCertIdentityField(o.Auth.MTLS.IdentityField)
+		if err != nil {
+			return "", fmt.Errorf("auth.mtls.identity-field: %w", err)
+		}
+		id, err := crypto.IdentityFromCert(cert, field)
+		if err != nil {
+			return "", fmt.Errorf("read node ID from certificate: %w", err)
+		}
+		if !types.IsValidNodeID(id) {
+			return "", fmt.Errorf("certificate identity %q is not a valid node ID", id)
+		}
+		o.Mesh.NodeID = id
+		return id, nil
 	}
 	if !o.Auth.Basic.IsEmpty() {
 		// Parse the username for the node ID
@@ -259,10 +290,38 @@ func (o *Config) NodeID(ctx context.Context) (string, error) {
 		o.Mesh.NodeID = o.Auth.LDAP.Username
 		return o.Auth.LDAP.Username, nil
 	}
+	if o.Mesh.NodeIDStrategy != "" {
+		id, err := o.nodeIDFromStrategy(ctx)
+		if err != nil {
+			return "", fmt.Errorf("generate node ID with strategy %q: %w", o.Mesh.NodeIDStrategy, err)
+		}
+		if id == "" || !types.IsValidNodeID(id) {
+			return "", fmt.Errorf("node ID strategy %q produced an invalid node ID %q", o.Mesh.NodeIDStrategy, id)
+		}
+		o.Mesh.NodeID = id
+		return id, nil
+	}
 	// Fall back to the hostname or generated one.
 	return DefaultNodeID, nil
 }
 
+func (o *Config) nodeIDFromStrategy(ctx context.Context) (string, error) {
+	switch o.Mesh.NodeIDStrategy {
+	case NodeIDStrategyHostname:
+		return os.Hostname()
+	case NodeIDStrategyUUID:
+		return uuid.NewString(), nil
+	case NodeIDStrategyPublicKey:
+		key, err := o.WireGuard.LoadKey(ctx)
+		if err != nil {
+			return "", fmt.Errorf("load wireguard key: %w", err)
+		}
+		return key.ID(), nil
+	default:
+		return "", fmt.Errorf("unknown node ID strategy")
+	}
+}
+
 // MTLSEnabled reports whether mtls is enabled.
 func (o *Config) MTLSEnabled() bool {
 	return o.Plugins.MTLSEnabled() && o.Auth.MTLSEnabled()
@@ -17,11 +17,23 @@ limitations under the License.
 package config
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
+	"math/big"
+	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
 	"github.com/webmeshproj/webmesh/pkg/logging"
 )
 
@@ -131,6 +143,110 @@ func TestNodeID(t *testing.T) {
 				t.Fatalf("expected %s, got %s", testCertCN, id)
 			}
 		})
+
+		t.Run("WithURISANIdentity", func(t *testing.T) {
+			conf := NewDefaultConfig("")
+			conf.Auth.MTLS = MTLSOptions{
+				CertData:      newURISANCert(t, "spiffe://example.com/nodes/uri-node"),
+				IdentityField: "URI-SAN",
+			}
+			id, err := conf.NodeID(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != "uri-node" {
+				t.Fatalf("expected uri-node, got %s", id)
+			}
+		})
+
+		t.Run("WithInvalidIdentity", func(t *testing.T) {
+			conf := NewDefaultConfig("")
+			conf.Auth.MTLS = MTLSOptions{
+				CertData:      newURISANCert(t, "spiffe://example.com/nodes/leader"),
+				IdentityField: "uri-san",
+			}
+			if _, err := conf.NodeID(ctx); err == nil {
+				t.Fatal("expected error for reserved node ID")
+			}
+		})
+	})
+
+	t.Run("Strategies", func(t *testing.T) {
+		t.Run("Hostname", func(t *testing.T) {
+			hostname, err := os.Hostname()
+			if err != nil {
+				t.Skip("hostname not available:", err)
+			}
+			conf := NewDefaultConfig("")
+			conf.Mesh.NodeIDStrategy = NodeIDStrategyHostname
+			id, err := conf.NodeID(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != hostname {
+				t.Fatalf("expected %s, got %s", hostname, id)
+			}
+		})
+
+		t.Run("UUID", func(t *testing.T) {
+			conf := NewDefaultConfig("")
+			conf.Mesh.NodeIDStrategy = NodeIDStrategyUUID
+			id, err := conf.NodeID(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := uuid.Parse(id); err != nil {
+				t.Fatalf("expected a uuid, got %s: %v", id, err)
+			}
+			// Subsequent calls should return the same value
+			again, err := conf.NodeID(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != id {
+				t.Fatalf("expected %s, got %s", id, again)
+			}
+		})
+
+		t.Run("PublicKey", func(t *testing.T) {
+			keyFile := filepath.Join(t.TempDir(), "wireguard.key")
+			newConf := func() *Config {
+				conf := NewDefaultConfig("")
+				conf.Mesh.NodeIDStrategy = NodeIDStrategyPublicKey
+				conf.WireGuard.KeyFile = keyFile
+				return conf
+			}
+			id, err := newConf().NodeID(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, err := crypto.DecodePrivateKeyFromFile(keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != key.ID() {
+				t.Fatalf("expected %s, got %s", key.ID(), id)
+			}
+			// A restart with the same key file should produce the same ID
+			restarted, err := newConf().NodeID(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restarted != id {
+				t.Fatalf("expected stable ID %s across restarts, got %s", id, restarted)
+			}
+		})
+
+		t.Run("Invalid", func(t *testing.T) {
+			conf := NewDefaultConfig("")
+			conf.Mesh.NodeIDStrategy = "invalid"
+			if _, err := conf.NodeID(ctx); err == nil {
+				t.Fatal("expected error for invalid strategy")
+			}
+			if err := conf.Mesh.Validate(); err == nil {
+				t.Fatal("expected validation error for invalid strategy")
+			}
+		})
 	})
 }
 
@@ -149,3 +265,36 @@ pRDk03qyLXoqXgaBfNpXFT3JbXvVAiEArCafC3sy1pOrvPI7mcAyk6/xvP8nRm7t
 lASd5X/aQkw=
 -----END CERTIFICATE-----
 `
+
+// newURISANCert returns base64 encoded PEM data for a self-signed certificate
+// whose only identity is the given URI SAN.
+func newURISANCert(t *testing.T, uri string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		URIs:         []*url.URL{u},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := crypto.EncodeTLSCertificate(&buf, cert); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
@@ -25,9 +25,11 @@ import (
 	"log/slog"
 	"net"
 	"net/netip"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/spf13/pflag"
 	v1 "github.com/webmeshproj/api/go/v1"
@@ -38,14 +40,17 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/crypto"
 	"github.com/webmeshproj/webmesh/pkg/meshnet"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system/firewall"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/libp2p"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/tcp"
 	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
 	"github.com/webmeshproj/webmesh/pkg/plugins/builtins/basicauth"
 	"github.com/webmeshproj/webmesh/pkg/plugins/builtins/idauth"
 	"github.com/webmeshproj/webmesh/pkg/plugins/builtins/ldap"
 	"github.com/webmeshproj/webmesh/pkg/services"
+	"github.com/webmeshproj/webmesh/pkg/services/membership"
 	"github.com/webmeshproj/webmesh/pkg/services/meshdns"
 	"github.com/webmeshproj/webmesh/pkg/storage"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
@@ -55,6 +60,10 @@ import (
 type MeshOptions struct {
 	// NodeID is the node ID.
 	NodeID string `koanf:"node-id,omitempty"`
+	// NodeIDStrategy is the strategy used to generate a node ID when one is not
+	// set and cannot be determined from authentication. One of hostname, uuid,
+	// or public-key. When empty, the hostname is used with a UUID fallback.
+	NodeIDStrategy string `koanf:"node-id-strategy,omitempty"`
 	// PrimaryEndpoint is the primary endpoint to advertise when joining.
 	// This can be empty to signal the node is not publicly reachable.
 	PrimaryEndpoint string `koanf:"primary-endpoint,omitempty"`
@@ -67,6 +76,9 @@ type MeshOptions struct {
 	JoinMultiaddrs []string `koanf:"join-multiaddrs,omitempty"`
 	// MaxJoinRetries is the maximum number of join retries.
 	MaxJoinRetries int `koanf:"max-join-retries,omitempty"`
+	// JoinToken is a join token to present when joining. It grants the permissions
+	// in its claims in place of RBAC on the joining server.
+	JoinToken string `koanf:"join-token,omitempty"`
 	// Routes are additional routes to advertise to the mesh. These routes are advertised to all peers.
 	// If the node is not allowed to put routes in the mesh, the node will be unable to join.
 	Routes []string `koanf:"routes,omitempty"`
@@ -76,12 +88,35 @@ type MeshOptions struct {
 	// LibP2PPeers are peers to request direct edges to over libp2p. If the node is not allowed to create edges
 	// and data channels, the node will be unable to join.
 	LibP2PPeers []string `koanf:"libp2p-peers,omitempty"`
+	// DirectOnlyPeers are peers that must only be connected to directly. ICE and libp2p
+	// will never be used for these peers and they will stay disconnected if no direct
+	// endpoint is available.
+	DirectOnlyPeers []string `koanf:"direct-only-peers,omitempty"`
+	// ICEPreference is either "prefer-ice" to always negotiate ICE with peers offered
+	// over ICE, or "prefer-direct" to connect to them directly when their primary
+	// endpoint is reachable.
+	ICEPreference string `koanf:"ice-preference,omitempty"`
+	// DirectProbeTimeout is how long the direct reachability probe of an ICE peer may take.
+	DirectProbeTimeout time.Duration `koanf:"direct-probe-timeout,omitempty"`
+	// PeerRateLimits caps the rate of traffic sent to the given peer IDs. Rates are in bits per second
+	// with an optional kbit, mbit, gbit, or tbit suffix, e.g. node-a=10mbit. This is only supported on Linux.
+	PeerRateLimits map[string]string `koanf:"peer-rate-limits,omitempty"`
 	// GRPCAdvertisePort is the port to advertise for gRPC.
 	GRPCAdvertisePort int `koanf:"grpc-advertise-port,omitempty"`
 	// MeshDNSAdvertisePort is the port to advertise for DNS.
 	MeshDNSAdvertisePort int `koanf:"meshdns-advertise-port,omitempty"`
 	// UseMeshDNS indicates whether to set mesh DNS servers to the system configuration.
 	UseMeshDNS bool `koanf:"use-meshdns,omitempty"`
+	// MeshDNSHealthCheckInterval is how often configured mesh DNS servers are probed.
+	// Set this to 0 to disable health checks.
+	MeshDNSHealthCheckInterval time.Duration `koanf:"meshdns-health-check-interval,omitempty"`
+	// MeshDNSCacheSize is the maximum number of responses to cache for lookups made by the
+	// node through mesh DNS. Set this to 0 to disable the cache.
+	MeshDNSCacheSize int `koanf:"meshdns-cache-size,omitempty"`
+	// ConditionalForwarders maps DNS domains to the server that resolves them, given as
+	// the ID of a node serving mesh DNS or as an address. Queries for each domain and its
+	// subdomains are sent to that server instead of the general DNS servers.
+	ConditionalForwarders map[string]string `koanf:"conditional-forwarders,omitempty"`
 	// RequestVote is true if the node should can provide storage and consensus.
 	RequestVote bool `koanf:"request-vote,omitempty"`
 	// RequestObserver is true if the node should be a storage observer.
@@ -92,12 +127,30 @@ type MeshOptions struct {
 	DisableIPv4 bool `koanf:"disable-ipv4,omitempty"`
 	// DisableIPv6 disables IPv6 usage.
 	DisableIPv6 bool `koanf:"disable-ipv6,omitempty"`
+	// PreferIPv6Endpoints prefers the IPv6 address of peer endpoints that resolve to
+	// both an IPv4 and an IPv6 address.
+	PreferIPv6Endpoints bool `koanf:"prefer-ipv6-endpoints,omitempty"`
 	// DisableFeatureAdvertisement is true if feature advertisement should be disabled.
 	DisableFeatureAdvertisement bool `koanf:"disable-feature-advertisement,omitempty"`
 	// DisableDefaultIPAM is true if the default IPAM should be disabled.
 	DisableDefaultIPAM bool `koanf:"disable-default-ipam,omitempty"`
 	// DefaultIPAMStaticIPv4 are static IPv4 assignments to use for the default IPAM.
 	DefaultIPAMStaticIPv4 map[string]string `koanf:"default-ipam-static-ipv4,omitempty"`
+	// DefaultIPAMReleaseGrace is how long the default IPAM holds the address of a node
+	// that left so it can reclaim it when rejoining.
+	DefaultIPAMReleaseGrace time.Duration `koanf:"default-ipam-release-grace,omitempty"`
+	// DisableAutoRecovery stops a single-node cluster from restoring its previous
+	// wireguard configuration on restart, so it can be reconfigured first.
+	DisableAutoRecovery bool `koanf:"disable-auto-recovery,omitempty"`
+	// Recover restores the previous wireguard configuration on this start even
+	// when automatic recovery is disabled.
+	Recover bool `koanf:"recover,omitempty"`
+	// HeartbeatInterval is how often to send heartbeats to the leader. Zero
+	// disables heartbeats.
+	HeartbeatInterval time.Duration `koanf:"heartbeat-interval,omitempty"`
+	// SecondaryIPs is the number of additional IPv4 addresses to request from
+	// the mesh IPAM and assign to the wireguard interface.
+	SecondaryIPs int `koanf:"secondary-ips,omitempty"`
 }
 
 // NewMeshOptions returns a new MeshOptions with the default values. If node id
@@ -105,6 +158,7 @@ type MeshOptions struct {
 func NewMeshOptions(nodeID string) MeshOptions {
 	return MeshOptions{
 		NodeID:                      nodeID,
+		NodeIDStrategy:              "",
 		PrimaryEndpoint:             "",
 		ZoneAwarenessID:             "",
 		JoinAddresses:               nil,
@@ -112,9 +166,16 @@ func NewMeshOptions(nodeID string) MeshOptions {
 		Routes:                      nil,
 		ICEPeers:                    []string{},
 		LibP2PPeers:                 []string{},
+		DirectOnlyPeers:             []string{},
+		ICEPreference:               string(meshnet.PreferICE),
+		DirectProbeTimeout:          meshnet.DefaultDirectProbeTimeout,
+		PeerRateLimits:              map[string]string{},
 		GRPCAdvertisePort:           services.DefaultGRPCPort,
 		MeshDNSAdvertisePort:        meshdns.DefaultAdvertisePort,
 		UseMeshDNS:                  false,
+		MeshDNSHealthCheckInterval:  meshnet.DefaultDNSHealthCheckInterval,
+		MeshDNSCacheSize:            0,
+		ConditionalForwarders:       nil,
 		RequestVote:                 false,
 		RequestObserver:             false,
 		StoragePreferIPv6:           false,
@@ -123,31 +184,51 @@ func NewMeshOptions(nodeID string) MeshOptions {
 		DisableFeatureAdvertisement: false,
 		DisableDefaultIPAM:          false,
 		DefaultIPAMStaticIPv4:       map[string]string{},
+		DefaultIPAMReleaseGrace:     plugins.DefaultIPAMReleaseGrace,
+		DisableAutoRecovery:         false,
+		Recover:                     false,
+		HeartbeatInterval:           meshnode.DefaultHeartbeatInterval,
+		SecondaryIPs:                0,
 	}
 }
 
 // BindFlags binds the flags to the options.
 func (o *MeshOptions) BindFlags(prefix string, fs *pflag.FlagSet) {
 	fs.StringVar(&o.NodeID, prefix+"node-id", o.NodeID, "Node ID. One will be chosen automatically if left unset.")
+	fs.StringVar(&o.NodeIDStrategy, prefix+"node-id-strategy", o.NodeIDStrategy, "Strategy for generating a node ID when unset. One of hostname, uuid, or public-key.")
 	fs.StringVar(&o.PrimaryEndpoint, prefix+"primary-endpoint", o.PrimaryEndpoint, "Primary endpoint to advertise when joining.")
 	fs.StringVar(&o.ZoneAwarenessID, prefix+"zone-awareness-id", o.ZoneAwarenessID, "Zone awareness ID.")
 	fs.StringSliceVar(&o.JoinAddresses, prefix+"join-addresses", o.JoinAddresses, "Addresses of nodes to join.")
 	fs.StringSliceVar(&o.JoinMultiaddrs, prefix+"join-multiaddrs", o.JoinMultiaddrs, "Multiaddresses of nodes to join.")
 	fs.IntVar(&o.MaxJoinRetries, prefix+"max-join-retries", o.MaxJoinRetries, "Maximum number of join retries.")
+	fs.StringVar(&o.JoinToken, prefix+"join-token", o.JoinToken, "Join token to present when joining. Tokens are only sent over TLS.")
 	fs.StringSliceVar(&o.Routes, prefix+"routes", o.Routes, "Additional routes to advertise to the mesh.")
 	fs.StringSliceVar(&o.ICEPeers, prefix+"ice-peers", o.ICEPeers, "Peers to request direct edges to over ICE.")
 	fs.StringSliceVar(&o.LibP2PPeers, prefix+"libp2p-peers", o.LibP2PPeers, "Map of peer IDs to rendezvous strings for edges over libp2p.")
+	fs.StringSliceVar(&o.DirectOnlyPeers, prefix+"direct-only-peers", o.DirectOnlyPeers, "Peers that must only be connected to directly and never relayed.")
+	fs.StringVar(&o.ICEPreference, prefix+"ice-preference", o.ICEPreference, "Either 'prefer-ice' or 'prefer-direct' to connect to ICE peers directly when their primary endpoint is reachable. Reachability is probed over TCP, peers that then fail to handshake fall back to ICE.")
+	fs.DurationVar(&o.DirectProbeTimeout, prefix+"direct-probe-timeout", o.DirectProbeTimeout, "Timeout for the direct reachability probe of ICE peers under prefer-direct.")
+	fs.StringToStringVar(&o.PeerRateLimits, prefix+"peer-rate-limits", o.PeerRateLimits, "Map of peer IDs to rate limits for traffic sent to them, e.g. node-a=10mbit (Linux only).")
 	fs.IntVar(&o.GRPCAdvertisePort, prefix+"grpc-advertise-port", o.GRPCAdvertisePort, "Port to advertise for gRPC.")
 	fs.IntVar(&o.MeshDNSAdvertisePort, prefix+"meshdns-advertise-port", o.MeshDNSAdvertisePort, "Port to advertise for DNS.")
 	fs.BoolVar(&o.UseMeshDNS, prefix+"use-meshdns", o.UseMeshDNS, "Set mesh DNS servers to the system configuration.")
+	fs.DurationVar(&o.MeshDNSHealthCheckInterval, prefix+"meshdns-health-check-interval", o.MeshDNSHealthCheckInterval, "Interval at which to probe mesh DNS servers. Set this to 0 to disable.")
+	fs.IntVar(&o.MeshDNSCacheSize, prefix+"meshdns-cache-size", o.MeshDNSCacheSize, "Maximum number of mesh DNS responses to cache for lookups made by the node. Set this to 0 to disable.")
+	fs.StringToStringVar(&o.ConditionalForwarders, prefix+"conditional-forwarders", o.ConditionalForwarders, "Map of DNS domains to the node ID or address of the server that resolves them.")
 	fs.BoolVar(&o.RequestVote, prefix+"request-vote", o.RequestVote, "Request a vote in elections for the storage backend.")
 	fs.BoolVar(&o.RequestObserver, prefix+"request-observer", o.RequestObserver, "Request to be an observer in the storage backend.")
 	fs.BoolVar(&o.StoragePreferIPv6, prefix+"storage-prefer-ipv6", o.StoragePreferIPv6, "Prefer IPv6 connections for the storage backend transport.")
 	fs.BoolVar(&o.DisableIPv4, prefix+"disable-ipv4", o.DisableIPv4, "Disable IPv4 usage.")
 	fs.BoolVar(&o.DisableIPv6, prefix+"disable-ipv6", o.DisableIPv6, "Disable IPv6 usage.")
+	fs.BoolVar(&o.PreferIPv6Endpoints, prefix+"prefer-ipv6-endpoints", o.PreferIPv6Endpoints, "Prefer the IPv6 address of peer endpoints that resolve to both address families.")
 	fs.BoolVar(&o.DisableFeatureAdvertisement, prefix+"disable-feature-advertisement", o.DisableFeatureAdvertisement, "Disable feature advertisement.")
 	fs.BoolVar(&o.DisableDefaultIPAM, prefix+"disable-default-ipam", o.DisableDefaultIPAM, "Disable the default IPAM.")
 	fs.StringToStringVar(&o.DefaultIPAMStaticIPv4, prefix+"default-ipam-static-ipv4", o.DefaultIPAMStaticIPv4, "Static IPv4 assignments to use for the default IPAM.")
+	fs.DurationVar(&o.DefaultIPAMReleaseGrace, prefix+"default-ipam-release-grace", o.DefaultIPAMReleaseGrace, "How long the default IPAM holds the address of a node that left for it to reclaim. Set this to 0 to disable.")
+	fs.BoolVar(&o.DisableAutoRecovery, prefix+"disable-auto-recovery", o.DisableAutoRecovery, "Do not restore the previous wireguard configuration when restarting a single-node cluster. The node refuses to start until it is restarted with --"+prefix+"recover.")
+	fs.BoolVar(&o.Recover, prefix+"recover", o.Recover, "Restore the previous wireguard configuration on this start even when automatic recovery is disabled.")
+	fs.DurationVar(&o.HeartbeatInterval, prefix+"heartbeat-interval", o.HeartbeatInterval, "Interval at which to send heartbeats to the leader. Zero disables heartbeats.")
+	fs.IntVar(&o.SecondaryIPs, prefix+"secondary-ips", o.SecondaryIPs, "Number of additional IPv4 addresses to lease from the mesh and assign to the wireguard interface.")
 }
 
 // Validate validates the options.
@@ -160,9 +241,21 @@ func (o *MeshOptions) Validate() error {
 			return fmt.Errorf("invalid node ID")
 		}
 	}
+	if o.NodeIDStrategy != "" && !slices.Contains(NodeIDStrategies, o.NodeIDStrategy) {
+		return fmt.Errorf("invalid node ID strategy %q, must be one of %v", o.NodeIDStrategy, NodeIDStrategies)
+	}
 	if o.DisableIPv4 && o.DisableIPv6 {
 		return fmt.Errorf("cannot disable both IPv4 and IPv6")
 	}
+	if o.HeartbeatInterval < 0 {
+		return fmt.Errorf("heartbeat interval must be >= 0")
+	}
+	if o.SecondaryIPs < 0 {
+		return fmt.Errorf("secondary ips must be >= 0")
+	}
+	if o.SecondaryIPs > 0 && o.DisableIPv4 {
+		return fmt.Errorf("secondary ips require IPv4")
+	}
 	if (len(o.JoinAddresses) > 0 || len(o.JoinMultiaddrs) > 0) && o.MaxJoinRetries <= 0 {
 		return fmt.Errorf("max join retries must be >= 0")
 	}
@@ -212,6 +305,42 @@ func (o *MeshOptions) Validate() error {
 			return fmt.Errorf("invalid libp2p peer ID %s", peer)
 		}
 	}
+	for _, peer := range o.DirectOnlyPeers {
+		if !types.IsValidNodeID(peer) {
+			return fmt.Errorf("invalid direct-only peer ID %s", peer)
+		}
+		if slices.Contains(o.ICEPeers, peer) || slices.Contains(o.LibP2PPeers, peer) {
+			return fmt.Errorf("direct-only peer %s cannot also be an ICE or libp2p peer", peer)
+		}
+	}
+	if !meshnet.ICEPreference(o.ICEPreference).IsValid() {
+		return fmt.Errorf("mesh.ice-preference must be one of 'prefer-ice' or 'prefer-direct'")
+	}
+	if o.DirectProbeTimeout < 0 {
+		return fmt.Errorf("mesh.direct-probe-timeout must be greater than or equal to 0")
+	}
+	for peer, rate := range o.PeerRateLimits {
+		if !types.IsValidNodeID(peer) {
+			return fmt.Errorf("invalid rate limited peer ID %s", peer)
+		}
+		if _, err := meshnet.ParseRate(rate); err != nil {
+			return fmt.Errorf("invalid rate limit for peer %s: %w", peer, err)
+		}
+	}
+	if o.MeshDNSHealthCheckInterval < 0 {
+		return fmt.Errorf("mesh.meshdns-health-check-interval must be greater than or equal to 0")
+	}
+	if o.MeshDNSCacheSize < 0 {
+		return fmt.Errorf("mesh.meshdns-cache-size must be greater than or equal to 0")
+	}
+	for domain, target := range o.ConditionalForwarders {
+		if _, ok := dns.IsDomainName(domain); !ok || strings.Trim(domain, ".") == "" || strings.ContainsAny(domain, "'\" ") {
+			return fmt.Errorf("mesh.conditional-forwarders contains an invalid domain %q", domain)
+		}
+		if target == "" {
+			return fmt.Errorf("mesh.conditional-forwarders has no server for %s", domain)
+		}
+	}
 	if !o.DisableFeatureAdvertisement {
 		if o.GRPCAdvertisePort <= 0 || o.GRPCAdvertisePort > 65535 {
 			return fmt.Errorf("invalid gRPC advertise port")
@@ -221,6 +350,9 @@ func (o *MeshOptions) Validate() error {
 		}
 	}
 	if !o.DisableDefaultIPAM {
+		if o.DefaultIPAMReleaseGrace < 0 {
+			return fmt.Errorf("mesh.default-ipam-release-grace must be greater than or equal to 0")
+		}
 		for id, addr := range o.DefaultIPAMStaticIPv4 {
 			if !types.IsValidNodeID(id) {
 				return fmt.Errorf("invalid node ID %s", id)
@@ -258,6 +390,11 @@ func (o *Config) NewMeshConfig(ctx context.Context, key crypto.PrivateKey) (conf
 		DisableIPv6:             o.Mesh.DisableIPv6,
 		DisableDefaultIPAM:      o.Mesh.DisableDefaultIPAM,
 		DefaultIPAMStaticIPv4:   o.Mesh.DefaultIPAMStaticIPv4,
+		DefaultIPAMReleaseGrace: o.Mesh.DefaultIPAMReleaseGrace,
+		DisableAutoRecovery:     o.Mesh.DisableAutoRecovery,
+		HeartbeatInterval:       o.Mesh.HeartbeatInterval,
+		SecondaryIPs:            o.Mesh.SecondaryIPs,
+		PeerServerName:          o.TLS.PeerServerName,
 	}
 	// Check if we are serving a local DNS server
 	if o.Services.MeshDNS.Enabled {
@@ -378,6 +515,10 @@ func (o *Config) NewClientCredentials(ctx context.Context, key crypto.PrivateKey
 		// Make sure our ID is set if it hasn't been
 		o.Mesh.NodeID = key.ID()
 	}
+	if o.Mesh.JoinToken != "" {
+		log.Debug("Configuring join token")
+		creds = append(creds, membership.NewJoinTokenCreds(o.Mesh.JoinToken))
+	}
 	return creds, nil
 }
 
@@ -453,18 +594,29 @@ func (o *Config) NewConnectOptions(ctx context.Context, conn meshnode.Node, prov
 			disableRBAC = true
 		}
 		bootstrap = &meshnode.BootstrapOptions{
-			Transport:            rt,
-			IPv4Network:          o.Bootstrap.IPv4Network,
-			IPv6Network:          o.Bootstrap.IPv6Network,
-			MeshDomain:           o.Bootstrap.MeshDomain,
-			Admin:                o.Bootstrap.Admin,
-			Servers:              bootstrapServers,
-			Voters:               o.Bootstrap.Voters,
-			DisableRBAC:          disableRBAC,
-			DefaultNetworkPolicy: o.Bootstrap.DefaultNetworkPolicy,
-			Force:                o.Bootstrap.Force,
+			Transport:              rt,
+			IPv4Network:            o.Bootstrap.IPv4Network,
+			IPv6Network:            o.Bootstrap.IPv6Network,
+			MeshDomain:             o.Bootstrap.MeshDomain,
+			Admin:                  o.Bootstrap.Admin,
+			Servers:                bootstrapServers,
+			Voters:                 o.Bootstrap.Voters,
+			DisableRBAC:            disableRBAC,
+			DefaultNetworkPolicy:   o.Bootstrap.DefaultNetworkPolicy,
+			RBACManifest:           o.Bootstrap.RBACManifest,
+			RestoreSnapshot:        o.Bootstrap.RestoreSnapshot,
+			RestoreSnapshotHeaders: o.Bootstrap.RestoreSnapshotHeaders,
+			Force:                  o.Bootstrap.Force,
 		}
 	}
+	psk, err := o.WireGuard.LoadPresharedKey()
+	if err != nil {
+		return
+	}
+	masqExclusions, err := o.WireGuard.LoadMasqueradeExclusions()
+	if err != nil {
+		return
+	}
 	// Create our plugins
 	plugins, err := o.Plugins.NewPluginSet(ctx)
 	if err != nil {
@@ -479,6 +631,7 @@ func (o *Config) NewConnectOptions(ctx context.Context, conn meshnode.Node, prov
 		}
 		localDNSAddr = netip.AddrPortFrom(netip.AddrFrom4([4]byte{127, 0, 0, 1}), localDNSAddr.Port())
 	}
+	firewallTCPPorts, firewallUDPPorts := o.Services.FirewallPorts()
 	// Create the options
 	opts = meshnode.ConnectOptions{
 		StorageProvider:      provider,
@@ -494,6 +647,7 @@ func (o *Config) NewConnectOptions(ctx context.Context, conn meshnode.Node, prov
 		RequestVote:          o.Mesh.RequestVote,
 		RequestObserver:      o.Mesh.RequestObserver,
 		Routes:               routes,
+		Recover:              o.Mesh.Recover,
 		DirectPeers: func() map[types.NodeID]v1.ConnectProtocol {
 			peers := make(map[types.NodeID]v1.ConnectProtocol)
 			for _, peer := range o.Mesh.ICEPeers {
@@ -509,25 +663,73 @@ func (o *Config) NewConnectOptions(ctx context.Context, conn meshnode.Node, prov
 		PreferIPv6: o.Mesh.StoragePreferIPv6,
 		Plugins:    plugins,
 		NetworkOptions: meshnet.Options{
-			Modprobe:              o.WireGuard.Modprobe,
-			InterfaceName:         o.WireGuard.InterfaceName,
-			ForceReplace:          o.WireGuard.ForceInterfaceName,
-			ListenPort:            o.WireGuard.ListenPort,
-			PersistentKeepAlive:   o.WireGuard.PersistentKeepAlive,
-			ForceTUN:              o.WireGuard.ForceTUN,
-			MTU:                   o.WireGuard.MTU,
-			RecordMetrics:         o.WireGuard.RecordMetrics,
-			RecordMetricsInterval: o.WireGuard.RecordMetricsInterval,
-			StoragePort:           o.Storage.ListenPort(),
-			GRPCPort:              o.Mesh.GRPCAdvertisePort,
-			ZoneAwarenessID:       o.Mesh.ZoneAwarenessID,
-			Credentials:           conn.Credentials(),
-			LocalDNSAddr:          localDNSAddr,
-			DisableIPv4:           o.Mesh.DisableIPv4,
-			DisableIPv6:           o.Mesh.DisableIPv6,
-			DisableFullTunnel:     o.WireGuard.DisableFullTunnel,
+			Modprobe:                   o.WireGuard.Modprobe,
+			InterfaceName:              o.WireGuard.InterfaceName,
+			ForceReplace:               o.WireGuard.ForceInterfaceName,
+			ListenPort:                 o.WireGuard.ListenPort,
+			PersistentKeepAlive:        o.WireGuard.PersistentKeepAlive,
+			NDPProxyInterface:          o.WireGuard.NDPProxyInterface,
+			NDPProxyPeers:              o.WireGuard.NDPProxyPeers,
+			NATKeepAliveOnly:           o.WireGuard.NATKeepAliveOnly,
+			KeepAlivePeers:             o.WireGuard.KeepAlivePeers,
+			NoKeepAlivePeers:           o.WireGuard.NoKeepAlivePeers,
+			ForceTUN:                   o.WireGuard.ForceTUN,
+			UserspaceBackend:           o.WireGuard.UserspaceBackend,
+			MTU:                        o.WireGuard.MTU,
+			AutoMTU:                    o.WireGuard.AutoMTU,
+			AutoMTUInterval:            o.WireGuard.AutoMTUInterval,
+			EndpointCacheFile:          o.WireGuard.EndpointCacheFile,
+			EndpointCacheTTL:           o.WireGuard.EndpointCacheTTL,
+			PortMapping:                o.WireGuard.PortMapping,
+			PortMappingLifetime:        o.WireGuard.PortMappingLifetime,
+			LinkLocalEndpointInterface: o.WireGuard.LinkLocalEndpointInterface,
+			RecordMetrics:              o.WireGuard.RecordMetrics,
+			RecordMetricsInterval:      o.WireGuard.RecordMetricsInterval,
+			StoragePort:                o.Storage.ListenPort(),
+			GRPCPort:                   o.Mesh.GRPCAdvertisePort,
+			ZoneAwarenessID:            o.Mesh.ZoneAwarenessID,
+			Credentials:                conn.Credentials(),
+			LocalDNSAddr:               localDNSAddr,
+			ConditionalForwarders:      o.Mesh.ConditionalForwarders,
+			DisableIPv4:                o.Mesh.DisableIPv4,
+			DisableIPv6:                o.Mesh.DisableIPv6,
+			PreferIPv6:                 o.Mesh.PreferIPv6Endpoints,
+			DisableFullTunnel:          o.WireGuard.DisableFullTunnel,
+			DirectOnlyPeers:            o.Mesh.DirectOnlyPeers,
+			ICEPreference:              meshnet.ICEPreference(o.Mesh.ICEPreference),
+			DirectProbeTimeout:         o.Mesh.DirectProbeTimeout,
+			PeerRateLimits: func() map[string]uint64 {
+				limits := make(map[string]uint64, len(o.Mesh.PeerRateLimits))
+				for peer, rate := range o.Mesh.PeerRateLimits {
+					// Rates are checked when the options are validated.
+					if bps, err := meshnet.ParseRate(rate); err == nil {
+						limits[peer] = bps
+					}
+				}
+				return limits
+			}(),
+			PresharedKey:            psk,
+			HandshakeTimeout:        o.WireGuard.HandshakeTimeout,
+			PeerPingConcurrency:     o.WireGuard.PeerPingConcurrency,
+			PeerPingTimeout:         o.WireGuard.PeerPingTimeout,
+			DisablePeerPing:         o.WireGuard.DisablePeerPing,
+			EndpointResolveInterval: o.WireGuard.EndpointResolveInterval,
+			DNSHealthCheckInterval:  o.Mesh.MeshDNSHealthCheckInterval,
+			DNSCacheSize:            o.Mesh.MeshDNSCacheSize,
+			ReconcileInterval:       o.WireGuard.ReconcileInterval,
+			ReconcileDNSServers:     o.Mesh.UseMeshDNS,
+			RouteAccountingInterval: o.WireGuard.RouteAccountingInterval,
+			AsymmetricCheckInterval: o.WireGuard.AsymmetricCheckInterval,
+			DisableRouteManagement:  o.WireGuard.DisableRouteManagement,
+			DisableNetworkRoute:     o.WireGuard.DisableNetworkRoute,
+			AssignLinkLocal:         o.WireGuard.AssignLinkLocal,
+			MasqueradeExclusions:    masqExclusions,
+			FirewallDefaultPolicy:   firewall.Policy(o.WireGuard.FirewallDefaultPolicy),
+			FirewallTCPPorts:        firewallTCPPorts,
+			FirewallUDPPorts:        firewallUDPPorts,
 			Relays: meshnet.RelayOptions{
-				Host: o.Discovery.HostOptions(ctx, conn.Key()),
+				Host:            o.Discovery.HostOptions(ctx, conn.Key()),
+				CandidatePolicy: o.Services.WebRTC.CandidatePolicy(),
 			},
 		},
 	}
@@ -202,6 +202,37 @@ func TestMeshConfigValidation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "InvalidDirectOnlyPeers",
+			cfg: &MeshOptions{
+				NodeID:               "test-node",
+				GRPCAdvertisePort:    services.DefaultGRPCPort,
+				MeshDNSAdvertisePort: meshdns.DefaultAdvertisePort,
+				DirectOnlyPeers:      []string{"/invalid/node/id"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "DirectOnlyPeerAlsoICEPeer",
+			cfg: &MeshOptions{
+				NodeID:               "test-node",
+				GRPCAdvertisePort:    services.DefaultGRPCPort,
+				MeshDNSAdvertisePort: meshdns.DefaultAdvertisePort,
+				ICEPeers:             []string{"another-node"},
+				DirectOnlyPeers:      []string{"another-node"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ValidDirectOnlyPeers",
+			cfg: &MeshOptions{
+				NodeID:               "test-node",
+				GRPCAdvertisePort:    services.DefaultGRPCPort,
+				MeshDNSAdvertisePort: meshdns.DefaultAdvertisePort,
+				DirectOnlyPeers:      []string{"another-node"},
+			},
+			wantErr: false,
+		},
 		{
 			name: "InvalidGRPCPort",
 			cfg: &MeshOptions{
@@ -253,6 +284,50 @@ func TestMeshConfigValidation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "InvalidConditionalForwarders",
+			cfg: &MeshOptions{
+				NodeID:                      "test-node",
+				DisableFeatureAdvertisement: true,
+				ConditionalForwarders: map[string]string{
+					"corp example": "10.0.0.53",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ValidConditionalForwarders",
+			cfg: &MeshOptions{
+				NodeID:                      "test-node",
+				DisableFeatureAdvertisement: true,
+				ConditionalForwarders: map[string]string{
+					"corp.example": "dns-node",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "InvalidPeerRateLimit",
+			cfg: &MeshOptions{
+				NodeID:                      "test-node",
+				DisableFeatureAdvertisement: true,
+				PeerRateLimits: map[string]string{
+					"node-a": "fast",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ValidPeerRateLimit",
+			cfg: &MeshOptions{
+				NodeID:                      "test-node",
+				DisableFeatureAdvertisement: true,
+				PeerRateLimits: map[string]string{
+					"node-a": "10mbit",
+				},
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tc {
@@ -17,6 +17,7 @@ limitations under the License.
 package config
 
 import (
+	"compress/gzip"
 	"fmt"
 	"net"
 	"net/netip"
@@ -42,6 +43,14 @@ type RaftOptions struct {
 	HeartbeatTimeout time.Duration `koanf:"heartbeat-timeout,omitempty"`
 	// ElectionTimeout is the timeout for elections.
 	ElectionTimeout time.Duration `koanf:"election-timeout,omitempty"`
+	// ScaleTimeouts grows the heartbeat and election timeouts with the number of
+	// voters in the cluster, up to MaxElectionTimeout.
+	ScaleTimeouts bool `koanf:"scale-timeouts,omitempty"`
+	// MaxElectionTimeout is the upper bound for scaled timeouts.
+	MaxElectionTimeout time.Duration `koanf:"max-election-timeout,omitempty"`
+	// LeaderStickiness is extra time followers wait without contact from the leader
+	// before starting an election. The leader lease is extended by the same amount.
+	LeaderStickiness time.Duration `koanf:"leader-stickiness,omitempty"`
 	// ApplyTimeout is the timeout for applying.
 	ApplyTimeout time.Duration `koanf:"apply-timeout,omitempty"`
 	// CommitTimeout is the timeout for committing.
@@ -56,29 +65,55 @@ type RaftOptions struct {
 	SnapshotThreshold uint64 `koanf:"snapshot-threshold,omitempty"`
 	// SnapshotRetention is the number of snapshots to retain.
 	SnapshotRetention uint64 `koanf:"snapshot-retention,omitempty"`
+	// SnapshotCompressionLevel is the gzip compression level to use for snapshots.
+	// Use 1 (best speed) for CPU-constrained nodes or 9 (best compression) to
+	// minimize snapshot size. Defaults to -1 (the gzip default level).
+	SnapshotCompressionLevel int `koanf:"snapshot-compression-level,omitempty"`
+	// SnapshotOnShutdown takes a final snapshot during graceful shutdown to
+	// speed up the next restart. Enabled by default.
+	SnapshotOnShutdown bool `koanf:"snapshot-on-shutdown,omitempty"`
+	// ShutdownSnapshotTimeout is how long to wait for the final snapshot.
+	ShutdownSnapshotTimeout time.Duration `koanf:"shutdown-snapshot-timeout,omitempty"`
 	// ObserverChanBuffer is the buffer size for the observer channel.
 	ObserverChanBuffer int `koanf:"observer-chan-buffer,omitempty"`
 	// HeartbeatPurgeThreshold is the threshold of failed heartbeats before purging a peer.
 	HeartbeatPurgeThreshold int `koanf:"heartbeat-purge-threshold,omitempty"`
+	// QuorumLossReads is what to do with reads when quorum is lost. "stale" serves
+	// them from local data with a warning, "error" fails them as unavailable.
+	QuorumLossReads string `koanf:"quorum-loss-reads,omitempty"`
+	// LogStorePath is the directory for the raft log and stable store. Defaults to
+	// a subdirectory of storage.path. Useful for keeping the log on faster disks.
+	// The store is kept in a subdirectory named after the node.
+	LogStorePath string `koanf:"log-store-path,omitempty"`
+	// DataStorePath is the directory for the mesh data store. Defaults to a
+	// subdirectory of storage.path. The store is kept in a subdirectory named
+	// after the node.
+	DataStorePath string `koanf:"data-store-path,omitempty"`
 }
 
 // NewRaftOptions returns a new RaftOptions with the default values.
 func NewRaftOptions() RaftOptions {
 	return RaftOptions{
-		ListenAddress:           raftstorage.DefaultListenAddress,
-		ConnectionPoolCount:     0,
-		ConnectionTimeout:       3 * time.Second,
-		HeartbeatTimeout:        time.Second * 2,
-		ElectionTimeout:         time.Second * 2,
-		ApplyTimeout:            10 * time.Second,
-		CommitTimeout:           10 * time.Second,
-		MaxAppendEntries:        64,
-		LeaderLeaseTimeout:      time.Second * 2,
-		SnapshotInterval:        30 * time.Second,
-		SnapshotThreshold:       8192,
-		SnapshotRetention:       2,
-		ObserverChanBuffer:      100,
-		HeartbeatPurgeThreshold: 25,
+		ListenAddress:            raftstorage.DefaultListenAddress,
+		ConnectionPoolCount:      0,
+		ConnectionTimeout:        3 * time.Second,
+		HeartbeatTimeout:         time.Second * 2,
+		ElectionTimeout:          time.Second * 2,
+		MaxElectionTimeout:       raftstorage.DefaultMaxElectionTimeout,
+		LeaderStickiness:         0,
+		ApplyTimeout:             10 * time.Second,
+		CommitTimeout:            10 * time.Second,
+		MaxAppendEntries:         64,
+		LeaderLeaseTimeout:       time.Second * 2,
+		SnapshotInterval:         30 * time.Second,
+		SnapshotThreshold:        8192,
+		SnapshotRetention:        2,
+		SnapshotCompressionLevel: gzip.DefaultCompression,
+		SnapshotOnShutdown:       true,
+		ShutdownSnapshotTimeout:  raftstorage.DefaultShutdownSnapshotTimeout,
+		ObserverChanBuffer:       100,
+		HeartbeatPurgeThreshold:  25,
+		QuorumLossReads:          string(raftstorage.QuorumLossReadStale),
 	}
 }
 
@@ -89,6 +124,9 @@ func (o *RaftOptions) BindFlags(prefix string, fs *pflag.FlagSet) {
 	fs.DurationVar(&o.ConnectionTimeout, prefix+"connection-timeout", o.ConnectionTimeout, "Raft connection timeout.")
 	fs.DurationVar(&o.HeartbeatTimeout, prefix+"heartbeat-timeout", o.HeartbeatTimeout, "Raft heartbeat timeout.")
 	fs.DurationVar(&o.ElectionTimeout, prefix+"election-timeout", o.ElectionTimeout, "Raft election timeout.")
+	fs.BoolVar(&o.ScaleTimeouts, prefix+"scale-timeouts", o.ScaleTimeouts, "Scale the heartbeat and election timeouts with the number of voters.")
+	fs.DurationVar(&o.MaxElectionTimeout, prefix+"max-election-timeout", o.MaxElectionTimeout, "Upper bound for scaled heartbeat and election timeouts.")
+	fs.DurationVar(&o.LeaderStickiness, prefix+"leader-stickiness", o.LeaderStickiness, "Extra time followers wait without contact from the leader before starting an election, to reduce leadership flapping over lossy links.")
 	fs.DurationVar(&o.ApplyTimeout, prefix+"apply-timeout", o.ApplyTimeout, "Raft apply timeout.")
 	fs.DurationVar(&o.CommitTimeout, prefix+"commit-timeout", o.CommitTimeout, "Raft commit timeout.")
 	fs.IntVar(&o.MaxAppendEntries, prefix+"max-append-entries", o.MaxAppendEntries, "Raft max append entries.")
@@ -96,8 +134,14 @@ func (o *RaftOptions) BindFlags(prefix string, fs *pflag.FlagSet) {
 	fs.DurationVar(&o.SnapshotInterval, prefix+"snapshot-interval", o.SnapshotInterval, "Raft snapshot interval.")
 	fs.Uint64Var(&o.SnapshotThreshold, prefix+"snapshot-threshold", o.SnapshotThreshold, "Raft snapshot threshold.")
 	fs.Uint64Var(&o.SnapshotRetention, prefix+"snapshot-retention", o.SnapshotRetention, "Raft snapshot retention.")
+	fs.IntVar(&o.SnapshotCompressionLevel, prefix+"snapshot-compression-level", o.SnapshotCompressionLevel, "Raft snapshot gzip compression level (-2 to 9, -1 for the default level).")
+	fs.BoolVar(&o.SnapshotOnShutdown, prefix+"snapshot-on-shutdown", o.SnapshotOnShutdown, "Take a raft snapshot during graceful shutdown.")
+	fs.DurationVar(&o.ShutdownSnapshotTimeout, prefix+"shutdown-snapshot-timeout", o.ShutdownSnapshotTimeout, "Maximum time to wait for the shutdown snapshot.")
 	fs.IntVar(&o.ObserverChanBuffer, prefix+"observer-chan-buffer", o.ObserverChanBuffer, "Raft observer channel buffer.")
 	fs.IntVar(&o.HeartbeatPurgeThreshold, prefix+"heartbeat-purge-threshold", o.HeartbeatPurgeThreshold, "Raft heartbeat purge threshold.")
+	fs.StringVar(&o.QuorumLossReads, prefix+"quorum-loss-reads", o.QuorumLossReads, "How to serve reads when quorum is lost (stale or error).")
+	fs.StringVar(&o.LogStorePath, prefix+"log-store-path", o.LogStorePath, "Directory for the raft log and stable store, kept in a subdirectory named after the node. Defaults to a subdirectory of the storage path.")
+	fs.StringVar(&o.DataStorePath, prefix+"data-store-path", o.DataStorePath, "Directory for the mesh data store, kept in a subdirectory named after the node. Defaults to a subdirectory of the storage path.")
 }
 
 // Validate validates the options.
@@ -112,6 +156,21 @@ func (o RaftOptions) Validate(dataDir string, inMemory bool) error {
 	if !inMemory && dataDir == "" {
 		return fmt.Errorf("storage.data-dir is required when not running in-memory")
 	}
+	if o.SnapshotCompressionLevel < gzip.HuffmanOnly || o.SnapshotCompressionLevel > gzip.BestCompression {
+		return fmt.Errorf("raft.snapshot-compression-level must be between %d and %d", gzip.HuffmanOnly, gzip.BestCompression)
+	}
+	if o.ScaleTimeouts && o.MaxElectionTimeout > 0 && o.MaxElectionTimeout < o.ElectionTimeout {
+		return fmt.Errorf("raft.max-election-timeout must be greater than or equal to raft.election-timeout")
+	}
+	if o.LeaderStickiness < 0 {
+		return fmt.Errorf("raft.leader-stickiness must be greater than or equal to 0")
+	}
+	if o.ShutdownSnapshotTimeout < 0 {
+		return fmt.Errorf("raft.shutdown-snapshot-timeout must be greater than or equal to 0")
+	}
+	if !raftstorage.QuorumLossReadPolicy(o.QuorumLossReads).IsValid() {
+		return fmt.Errorf("raft.quorum-loss-reads must be one of %q or %q", raftstorage.QuorumLossReadStale, raftstorage.QuorumLossReadError)
+	}
 	return nil
 }
 
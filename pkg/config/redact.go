@@ -0,0 +1,127 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// RedactedValue replaces secrets in the redacted configuration.
+const RedactedValue = "<redacted>"
+
+// secretKeyParts are parts of configuration keys that hold secrets.
+var secretKeyParts = []string{"password", "secret", "token", "preshared-key", "key-data", "private-key", "rendezvous"}
+
+// secretSections are configuration keys whose values are all secrets, such
+// as HTTP headers that may carry credentials.
+var secretSections = []string{"restore-snapshot-headers"}
+
+// Redacted returns the configuration as a nested map with secrets, such as
+// keys, passwords, and tokens, replaced by RedactedValue. The result can be
+// shared when troubleshooting a node. Paths to files holding secrets are
+// kept, since they do not reveal the secret itself. URLs keep their scheme,
+// host and path, but their credentials and query, which may carry a
+// pre-signed signature, are redacted.
+func (o *Config) Redacted() map[string]any {
+	return redactMap(false, o.ToMapStructure())
+}
+
+// redactMap redacts the secrets in the given map. When secret is true, every
+// value in it is redacted.
+func redactMap(secret bool, in map[string]any) map[string]any {
+	out := make(map[string]any, len(in))
+	for key, value := range in {
+		out[key] = redactValue(secret || isSecretKey(key), value)
+	}
+	return out
+}
+
+func redactValue(secret bool, value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return redactMap(secret, v)
+	case PluginMapConfig:
+		return redactMap(secret, v)
+	case map[string]string:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			out[key] = redactValue(secret || isSecretKey(key), value)
+		}
+		return out
+	case string:
+		if secret && v != "" {
+			return RedactedValue
+		}
+		return redactURL(v)
+	case []string:
+		out := make([]string, len(v))
+		for i := range v {
+			if secret {
+				out[i] = RedactedValue
+			} else {
+				out[i] = redactURL(v[i])
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, elem := range v {
+			out[i] = redactValue(secret, elem)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// isSecretKey reports whether the configuration key holds a secret.
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	if key == "key" || slices.Contains(secretSections, key) {
+		return true
+	}
+	for _, part := range secretKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL redacts the user information and query of the value when it is
+// a URL. Other values are returned unchanged.
+func redactURL(value string) string {
+	if !strings.Contains(value, "://") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || (u.User == nil && u.RawQuery == "") {
+		return value
+	}
+	var sb strings.Builder
+	sb.WriteString(u.Scheme + "://")
+	if u.User != nil {
+		sb.WriteString(RedactedValue + "@")
+	}
+	sb.WriteString(u.Host + u.EscapedPath())
+	if u.RawQuery != "" {
+		sb.WriteString("?" + RedactedValue)
+	}
+	return sb.String()
+}
@@ -20,11 +20,13 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net"
 	"net/netip"
 	"os"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -41,7 +43,9 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/crypto"
 	"github.com/webmeshproj/webmesh/pkg/logging"
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/netutil"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/datachannels"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/libp2p"
 	"github.com/webmeshproj/webmesh/pkg/meshnode"
 	"github.com/webmeshproj/webmesh/pkg/plugins/builtins/idauth"
@@ -59,6 +63,8 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/services/turn"
 	"github.com/webmeshproj/webmesh/pkg/services/webrtc"
 	meshstorage "github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/providers/raftstorage"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
 	"github.com/webmeshproj/webmesh/pkg/version"
 )
 
@@ -76,6 +82,27 @@ type ServiceOptions struct {
 	Registrar RegistrarOptions `koanf:"registrar,omitempty"`
 	// Metrics options
 	Metrics MetricsOptions `koanf:"metrics,omitempty"`
+
+	// effectiveConfig returns the redacted configuration of the node.
+	effectiveConfig func() map[string]any `koanf:"-"`
+}
+
+// FirewallPorts returns the TCP and UDP listen ports of the enabled services
+// so the firewall can accept them when its default policy drops traffic.
+func (o *ServiceOptions) FirewallPorts() (tcp, udp []uint16) {
+	if port := o.MeshDNS.TCPListenPort(); port > 0 {
+		tcp = append(tcp, port)
+	}
+	if port := o.MeshDNS.ListenPort(); port > 0 {
+		udp = append(udp, port)
+	}
+	if port := o.TURN.ListenPort(); port > 0 {
+		udp = append(udp, port)
+	}
+	if port := o.Metrics.ListenPort(); port > 0 {
+		tcp = append(tcp, port)
+	}
+	return tcp, udp
 }
 
 // NewServiceOptions returns a new ServiceOptions with the default values.
@@ -139,6 +166,9 @@ func (s *ServiceOptions) Validate() error {
 	if err != nil {
 		return err
 	}
+	if s.Metrics.Enabled && s.Metrics.TLS && s.API.Insecure {
+		return fmt.Errorf("services.metrics.tls requires a TLS certificate for the gRPC API")
+	}
 	err = s.WebRTC.Validate()
 	if err != nil {
 		return err
@@ -156,6 +186,11 @@ type APIOptions struct {
 	LibP2P LibP2PAPIOptions `koanf:"libp2p,omitempty"`
 	// ListenAddress is the gRPC address to listen on.
 	ListenAddress string `koanf:"listen-address,omitempty"`
+	// ListenUnixSocket is an optional path to a unix socket to additionally serve
+	// the gRPC API on, e.g. for local admin tooling.
+	ListenUnixSocket string `koanf:"listen-unix-socket,omitempty"`
+	// UnixSocketPermissions are the octal file permissions to set on the unix socket.
+	UnixSocketPermissions string `koanf:"unix-socket-permissions,omitempty"`
 	// WebEnabled enables serving gRPC over HTTP/1.1.
 	WebEnabled bool `koanf:"web-enabled,omitempty"`
 	// CORSEnabled enables CORS for the gRPC web server.
@@ -183,6 +218,71 @@ type APIOptions struct {
 	MeshEnabled bool `koanf:"mesh-enabled,omitempty"`
 	// AdminEnabled is true if the admin API should be registered.
 	AdminEnabled bool `koanf:"admin-enabled,omitempty"`
+	// DataChannelDrainTimeout is the grace period given to active data channels
+	// to close on their own when the node is shutting down.
+	DataChannelDrainTimeout time.Duration `koanf:"data-channel-drain-timeout,omitempty"`
+	// IPv6OnlyOnExhaustion allows nodes to join with only an IPv6 address when
+	// the mesh IPv4 network is exhausted, instead of rejecting the join.
+	IPv6OnlyOnExhaustion bool `koanf:"ipv6-only-on-exhaustion,omitempty"`
+	// ValidateFeatures rejects nodes joining with inconsistent feature advertisements,
+	// such as a feature without a port or a gRPC service without the node API.
+	ValidateFeatures bool `koanf:"validate-features,omitempty"`
+	// EndpointProbe probes the primary endpoint of joined nodes. It can be
+	// "warn" to log nodes that do not become reachable shortly after joining,
+	// or "strict" to also remove them from the mesh.
+	EndpointProbe string `koanf:"endpoint-probe,omitempty"`
+	// EndpointProbeTimeout is the timeout for join-time endpoint probes.
+	EndpointProbeTimeout time.Duration `koanf:"endpoint-probe-timeout,omitempty"`
+	// HeartbeatSyncInterval is how often node heartbeats received by the leader
+	// are written to storage.
+	HeartbeatSyncInterval time.Duration `koanf:"heartbeat-sync-interval,omitempty"`
+	// JoinTokenSecret is the shared secret used to verify join tokens. It must be
+	// the same on every node that can serve joins.
+	JoinTokenSecret string `koanf:"join-token-secret,omitempty"`
+	// RequireJoinToken rejects joins that do not present a valid join token.
+	RequireJoinToken bool `koanf:"require-join-token,omitempty"`
+	// SkipVersionCheck allows nodes running an incompatible version to join.
+	SkipVersionCheck bool `koanf:"skip-version-check,omitempty"`
+	// MaxJoinApplyLag rejects joins while more than this many committed log entries
+	// are waiting to be applied on the leader. Zero disables the check.
+	MaxJoinApplyLag uint64 `koanf:"max-join-apply-lag,omitempty"`
+	// MaxJoinGoroutines rejects joins while more than this many goroutines are
+	// running on the leader. Zero disables the check.
+	MaxJoinGoroutines int `koanf:"max-join-goroutines,omitempty"`
+	// JoinRetryAfter is the retry hint given to nodes whose join was rejected for load.
+	JoinRetryAfter time.Duration `koanf:"join-retry-after,omitempty"`
+	// DeadNodeGC enables removing nodes that are not storage members from the
+	// peers graph once both their last heartbeat and their last WireGuard
+	// handshake with the leader are older than DeadNodeThreshold.
+	DeadNodeGC bool `koanf:"dead-node-gc,omitempty"`
+	// DeadNodeThreshold is how long since its last heartbeat a node must be silent
+	// before it is removed by the dead node collector.
+	DeadNodeThreshold time.Duration `koanf:"dead-node-threshold,omitempty"`
+	// DeadNodeGCInterval is how often the leader looks for dead nodes.
+	DeadNodeGCInterval time.Duration `koanf:"dead-node-gc-interval,omitempty"`
+	// LoadHintInterval is how often to publish an advisory load hint for this
+	// node that clients can use to weight their choice of RPC peer. Zero disables
+	// load hints.
+	LoadHintInterval time.Duration `koanf:"load-hint-interval,omitempty"`
+	// MaxConnectionIdle closes client connections without active streams after
+	// this long. Zero disables the limit.
+	MaxConnectionIdle time.Duration `koanf:"max-connection-idle,omitempty"`
+	// MaxConnectionAge closes client connections after this long. Zero disables the limit.
+	MaxConnectionAge time.Duration `koanf:"max-connection-age,omitempty"`
+	// MaxConnectionAgeGrace is how long streams on a connection that reached its
+	// maximum age are given to finish.
+	MaxConnectionAgeGrace time.Duration `koanf:"max-connection-age-grace,omitempty"`
+	// KeepaliveMinPingInterval is the minimum interval clients may send keepalive pings at.
+	KeepaliveMinPingInterval time.Duration `koanf:"keepalive-min-ping-interval,omitempty"`
+	// MaxConcurrentStreams is the number of concurrent streams a single client
+	// connection may open. Further streams are queued by the client.
+	MaxConcurrentStreams uint32 `koanf:"max-concurrent-streams,omitempty"`
+	// ShutdownGracePeriod is how long in-flight RPCs are given to complete on shutdown.
+	// Zero waits for them until the node shutdown timeout.
+	ShutdownGracePeriod time.Duration `koanf:"shutdown-grace-period,omitempty"`
+	// WriteQuorumMethods are full gRPC method names, e.g. /v1.Admin/PutRole, that are
+	// only acknowledged once their writes are confirmed to be replicated to a quorum.
+	WriteQuorumMethods []string `koanf:"write-quorum-methods,omitempty"`
 }
 
 // LibP2PAPIOptions are options for serving the API over libp2p.
@@ -206,9 +306,17 @@ type LibP2PAPIOptions struct {
 // NewAPIOptions returns a new APIOptions with the default values.
 func NewAPIOptions(disabled bool) APIOptions {
 	return APIOptions{
-		Disabled:       disabled,
-		ListenAddress:  services.DefaultGRPCListenAddress,
-		AllowedOrigins: []string{"*"},
+		Disabled:                disabled,
+		ListenAddress:           services.DefaultGRPCListenAddress,
+		UnixSocketPermissions:   fmt.Sprintf("%#o", services.DefaultUnixSocketPermissions),
+		AllowedOrigins:          []string{"*"},
+		DataChannelDrainTimeout: node.DefaultDrainTimeout,
+		EndpointProbeTimeout:    membership.DefaultEndpointProbeTimeout,
+		HeartbeatSyncInterval:   membership.DefaultHeartbeatSyncInterval,
+		JoinRetryAfter:          membership.DefaultJoinRetryAfter,
+		DeadNodeThreshold:       membership.DefaultDeadNodeThreshold,
+		DeadNodeGCInterval:      membership.DefaultDeadNodeGCInterval,
+		MaxConcurrentStreams:    services.DefaultMaxConcurrentStreams,
 	}
 }
 
@@ -216,9 +324,17 @@ func NewAPIOptions(disabled bool) APIOptions {
 // and insecure set to true.
 func NewInsecureAPIOptions(disabled bool) APIOptions {
 	return APIOptions{
-		Disabled:      disabled,
-		ListenAddress: services.DefaultGRPCListenAddress,
-		Insecure:      true,
+		Disabled:                disabled,
+		ListenAddress:           services.DefaultGRPCListenAddress,
+		UnixSocketPermissions:   fmt.Sprintf("%#o", services.DefaultUnixSocketPermissions),
+		Insecure:                true,
+		DataChannelDrainTimeout: node.DefaultDrainTimeout,
+		EndpointProbeTimeout:    membership.DefaultEndpointProbeTimeout,
+		HeartbeatSyncInterval:   membership.DefaultHeartbeatSyncInterval,
+		JoinRetryAfter:          membership.DefaultJoinRetryAfter,
+		DeadNodeThreshold:       membership.DefaultDeadNodeThreshold,
+		DeadNodeGCInterval:      membership.DefaultDeadNodeGCInterval,
+		MaxConcurrentStreams:    services.DefaultMaxConcurrentStreams,
 	}
 }
 
@@ -226,6 +342,8 @@ func NewInsecureAPIOptions(disabled bool) APIOptions {
 func (a *APIOptions) BindFlags(prefix string, fl *pflag.FlagSet) {
 	fl.BoolVar(&a.Disabled, prefix+"disabled", a.Disabled, "Disable the API. This is ignored when joining as a Raft member.")
 	fl.StringVar(&a.ListenAddress, prefix+"listen-address", a.ListenAddress, "gRPC listen address.")
+	fl.StringVar(&a.ListenUnixSocket, prefix+"listen-unix-socket", a.ListenUnixSocket, "Path to a unix socket to additionally serve the gRPC API on.")
+	fl.StringVar(&a.UnixSocketPermissions, prefix+"unix-socket-permissions", a.UnixSocketPermissions, "Octal file permissions for the gRPC unix socket.")
 	fl.BoolVar(&a.WebEnabled, prefix+"web-enabled", a.WebEnabled, "Enable gRPC over HTTP/1.1.")
 	fl.BoolVar(&a.CORSEnabled, prefix+"cors-enabled", a.CORSEnabled, "Enable CORS for the gRPC web server.")
 	fl.StringSliceVar(&a.AllowedOrigins, prefix+"allowed-origins", a.AllowedOrigins, "Allowed origins for CORS.")
@@ -239,6 +357,29 @@ func (a *APIOptions) BindFlags(prefix string, fl *pflag.FlagSet) {
 	fl.BoolVar(&a.Insecure, prefix+"insecure", a.Insecure, "Disable TLS.")
 	fl.BoolVar(&a.MeshEnabled, prefix+"mesh-enabled", a.MeshEnabled, "Enable and register the MeshAPI.")
 	fl.BoolVar(&a.AdminEnabled, prefix+"admin-enabled", a.AdminEnabled, "Enable and register the AdminAPI.")
+	fl.DurationVar(&a.DataChannelDrainTimeout, prefix+"data-channel-drain-timeout", a.DataChannelDrainTimeout, "Grace period for active data channels to close when shutting down.")
+	fl.BoolVar(&a.IPv6OnlyOnExhaustion, prefix+"ipv6-only-on-exhaustion", a.IPv6OnlyOnExhaustion, "Allow nodes to join with only an IPv6 address when the IPv4 network is exhausted.")
+	fl.BoolVar(&a.ValidateFeatures, prefix+"validate-features", a.ValidateFeatures, "Reject nodes that join with inconsistent feature advertisements.")
+	fl.StringVar(&a.EndpointProbe, prefix+"endpoint-probe", a.EndpointProbe, "Probe the primary endpoint of joined nodes. Set to 'warn' to log nodes that do not become reachable shortly after joining, or 'strict' to also remove them.")
+	fl.DurationVar(&a.EndpointProbeTimeout, prefix+"endpoint-probe-timeout", a.EndpointProbeTimeout, "Timeout for join-time endpoint probes.")
+	fl.DurationVar(&a.HeartbeatSyncInterval, prefix+"heartbeat-sync-interval", a.HeartbeatSyncInterval, "Interval at which node heartbeats received by the leader are written to storage.")
+	fl.StringVar(&a.JoinTokenSecret, prefix+"join-token-secret", a.JoinTokenSecret, "Shared secret used to verify join tokens.")
+	fl.BoolVar(&a.RequireJoinToken, prefix+"require-join-token", a.RequireJoinToken, "Reject joins that do not present a valid join token.")
+	fl.BoolVar(&a.SkipVersionCheck, prefix+"skip-version-check", a.SkipVersionCheck, "Allow nodes running an incompatible version to join, logging a warning instead of rejecting them.")
+	fl.Uint64Var(&a.MaxJoinApplyLag, prefix+"max-join-apply-lag", a.MaxJoinApplyLag, "Reject joins while more than this many committed log entries are unapplied. Zero disables the check.")
+	fl.IntVar(&a.MaxJoinGoroutines, prefix+"max-join-goroutines", a.MaxJoinGoroutines, "Reject joins while more than this many goroutines are running. Zero disables the check.")
+	fl.DurationVar(&a.JoinRetryAfter, prefix+"join-retry-after", a.JoinRetryAfter, "Retry hint given to nodes whose join was rejected for load.")
+	fl.BoolVar(&a.DeadNodeGC, prefix+"dead-node-gc", a.DeadNodeGC, "Remove nodes that are not storage members once their last heartbeat is older than the dead node threshold.")
+	fl.DurationVar(&a.DeadNodeThreshold, prefix+"dead-node-threshold", a.DeadNodeThreshold, "Time since the last heartbeat after which a node is considered dead.")
+	fl.DurationVar(&a.DeadNodeGCInterval, prefix+"dead-node-gc-interval", a.DeadNodeGCInterval, "Interval at which the leader looks for dead nodes.")
+	fl.DurationVar(&a.LoadHintInterval, prefix+"load-hint-interval", a.LoadHintInterval, "Interval to publish advisory load hints for this node. Zero disables load hints.")
+	fl.DurationVar(&a.MaxConnectionIdle, prefix+"max-connection-idle", a.MaxConnectionIdle, "Close client connections without active streams after this long. Zero disables the limit.")
+	fl.DurationVar(&a.MaxConnectionAge, prefix+"max-connection-age", a.MaxConnectionAge, "Close client connections after this long. Zero disables the limit.")
+	fl.DurationVar(&a.MaxConnectionAgeGrace, prefix+"max-connection-age-grace", a.MaxConnectionAgeGrace, "Grace period for streams on connections that reached their maximum age.")
+	fl.DurationVar(&a.KeepaliveMinPingInterval, prefix+"keepalive-min-ping-interval", a.KeepaliveMinPingInterval, "Minimum interval clients may send keepalive pings at. Zero uses the gRPC default.")
+	fl.Uint32Var(&a.MaxConcurrentStreams, prefix+"max-concurrent-streams", a.MaxConcurrentStreams, "Maximum number of concurrent streams per client connection.")
+	fl.DurationVar(&a.ShutdownGracePeriod, prefix+"shutdown-grace-period", a.ShutdownGracePeriod, "How long in-flight RPCs are given to complete on shutdown. Zero waits until the node shutdown timeout.")
+	fl.StringSliceVar(&a.WriteQuorumMethods, prefix+"write-quorum-methods", a.WriteQuorumMethods, "Full gRPC method names (e.g. /v1.Admin/PutRole) to only acknowledge once their writes are replicated to a quorum.")
 	a.LibP2P.BindFlags(prefix+"libp2p.", fl)
 }
 
@@ -247,6 +388,57 @@ func (a APIOptions) Validate() error {
 	if a.Disabled {
 		return nil
 	}
+	if a.DataChannelDrainTimeout < 0 {
+		return fmt.Errorf("services.api.data-channel-drain-timeout must be greater than or equal to 0")
+	}
+	if !membership.EndpointProbeMode(a.EndpointProbe).IsValid() {
+		return fmt.Errorf("services.api.endpoint-probe must be empty, 'warn' or 'strict'")
+	}
+	if a.EndpointProbeTimeout < 0 {
+		return fmt.Errorf("services.api.endpoint-probe-timeout must be greater than or equal to 0")
+	}
+	if a.HeartbeatSyncInterval < 0 {
+		return fmt.Errorf("services.api.heartbeat-sync-interval must be greater than or equal to 0")
+	}
+	if a.RequireJoinToken && a.JoinTokenSecret == "" {
+		return fmt.Errorf("services.api.join-token-secret is required when services.api.require-join-token is set")
+	}
+	if a.MaxJoinGoroutines < 0 {
+		return fmt.Errorf("services.api.max-join-goroutines must be greater than or equal to 0")
+	}
+	if a.JoinRetryAfter < 0 {
+		return fmt.Errorf("services.api.join-retry-after must be greater than or equal to 0")
+	}
+	if a.DeadNodeGC && a.DeadNodeThreshold <= 0 {
+		return fmt.Errorf("services.api.dead-node-threshold must be greater than 0 when services.api.dead-node-gc is set")
+	}
+	if a.DeadNodeGCInterval < 0 {
+		return fmt.Errorf("services.api.dead-node-gc-interval must be greater than or equal to 0")
+	}
+	if a.LoadHintInterval < 0 {
+		return fmt.Errorf("services.api.load-hint-interval must be greater than or equal to 0")
+	}
+	if a.MaxConnectionIdle != 0 && a.MaxConnectionIdle < services.MinMaxConnectionIdle {
+		return fmt.Errorf("services.api.max-connection-idle must be 0 or at least %s", services.MinMaxConnectionIdle)
+	}
+	if a.MaxConnectionAge != 0 && a.MaxConnectionAge < services.MinMaxConnectionAge {
+		return fmt.Errorf("services.api.max-connection-age must be 0 or at least %s", services.MinMaxConnectionAge)
+	}
+	if a.MaxConnectionAgeGrace < 0 {
+		return fmt.Errorf("services.api.max-connection-age-grace must be greater than or equal to 0")
+	}
+	if a.KeepaliveMinPingInterval != 0 && a.KeepaliveMinPingInterval < services.MinKeepaliveMinPingInterval {
+		return fmt.Errorf("services.api.keepalive-min-ping-interval must be 0 or at least %s", services.MinKeepaliveMinPingInterval)
+	}
+	if a.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("services.api.shutdown-grace-period must be greater than or equal to 0")
+	}
+	for _, method := range a.WriteQuorumMethods {
+		parts := strings.Split(method, "/")
+		if len(parts) != 3 || parts[0] != "" || parts[1] == "" || parts[2] == "" {
+			return fmt.Errorf("services.api.write-quorum-methods contains an invalid method %q, expected /package.Service/Method", method)
+		}
+	}
 	if a.ListenAddress == "" && !a.LibP2P.Enabled {
 		return fmt.Errorf("services.api.listen-address or services.api.libp2p.enabled must be be set")
 	}
@@ -256,6 +448,11 @@ func (a APIOptions) Validate() error {
 			return fmt.Errorf("listen-address is invalid: %w", err)
 		}
 	}
+	if a.ListenUnixSocket != "" {
+		if _, err := a.UnixSocketMode(); err != nil {
+			return err
+		}
+	}
 	if !a.Insecure {
 		// If key file is supplied, make sure we have a cert-file with it.
 		if a.TLSKeyFile != "" && a.TLSCertFile == "" {
@@ -276,6 +473,31 @@ func (a APIOptions) Validate() error {
 	return a.LibP2P.Validate()
 }
 
+// UnixSocketMode parses the configured unix socket permissions. The default
+// permissions are returned if none are configured.
+func (a APIOptions) UnixSocketMode() (os.FileMode, error) {
+	if a.UnixSocketPermissions == "" {
+		return services.DefaultUnixSocketPermissions, nil
+	}
+	mode, err := strconv.ParseUint(a.UnixSocketPermissions, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("services.api.unix-socket-permissions is invalid: %w", err)
+	}
+	if os.FileMode(mode)&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("services.api.unix-socket-permissions must only contain permission bits")
+	}
+	return os.FileMode(mode), nil
+}
+
+// deadNodeThreshold returns the dead node threshold to pass to the membership
+// server, which is zero unless the collector is enabled.
+func (a APIOptions) deadNodeThreshold() time.Duration {
+	if !a.DeadNodeGC {
+		return 0
+	}
+	return a.DeadNodeThreshold
+}
+
 // ListenPort returns the listen port configured by these API options.
 func (a APIOptions) ListenPort() int {
 	_, port, err := net.SplitHostPort(a.ListenAddress)
@@ -352,6 +574,10 @@ type WebRTCOptions struct {
 	Enabled bool `koanf:"enabled,omitempty"`
 	// STUNServers is a list of STUN servers to use for the WebRTC API.
 	STUNServers []string `koanf:"stun-servers,omitempty"`
+	// CandidateTypes is an allow-list of ICE candidate types (host, srflx, prflx, relay)
+	// to signal to peers. This applies to every WebRTC connection made by the node,
+	// not only those of the WebRTC API. An empty list allows all types.
+	CandidateTypes []string `koanf:"candidate-types,omitempty"`
 }
 
 // NewWebRTCOptions returns a new WebRTCOptions with the default values.
@@ -366,10 +592,21 @@ func NewWebRTCOptions() WebRTCOptions {
 func (w *WebRTCOptions) BindFlags(prefix string, fl *pflag.FlagSet) {
 	fl.BoolVar(&w.Enabled, prefix+"enabled", w.Enabled, "Enable and register the WebRTC API.")
 	fl.StringSliceVar(&w.STUNServers, prefix+"stun-servers", w.STUNServers, "TURN/STUN servers to use for the WebRTC API.")
+	fl.StringSliceVar(&w.CandidateTypes, prefix+"candidate-types", w.CandidateTypes, "ICE candidate types to signal to peers (host, srflx, prflx, relay). Empty allows all.")
+}
+
+// CandidatePolicy returns the parsed ICE candidate policy. It allows all
+// candidate types if the configured types are invalid, use Validate to check them.
+func (w WebRTCOptions) CandidatePolicy() datachannels.CandidatePolicy {
+	policy, _ := datachannels.ParseCandidatePolicy(w.CandidateTypes)
+	return policy
 }
 
 // Validate validates the options.
 func (w WebRTCOptions) Validate() error {
+	if _, err := datachannels.ParseCandidatePolicy(w.CandidateTypes); err != nil {
+		return fmt.Errorf("services.webrtc.candidate-types is invalid: %w", err)
+	}
 	if !w.Enabled {
 		return nil
 	}
@@ -548,6 +785,22 @@ func (m MeshDNSOptions) ListenPort() uint16 {
 	return uint16(out)
 }
 
+// TCPListenPort returns the TCP listen port for the MeshDNS server if enabled.
+func (m MeshDNSOptions) TCPListenPort() uint16 {
+	if !m.Enabled {
+		return 0
+	}
+	_, port, err := net.SplitHostPort(m.ListenTCP)
+	if err != nil {
+		return 0
+	}
+	out, err := strconv.Atoi(port)
+	if err != nil {
+		return 0
+	}
+	return uint16(out)
+}
+
 // Validate validates the options.
 func (m MeshDNSOptions) Validate() error {
 	if !m.Enabled {
@@ -586,14 +839,44 @@ type MetricsOptions struct {
 	ListenAddress string `koanf:"listen-address,omitempty"`
 	// MetricsPath is the path to serve metrics on.
 	Path string `koanf:"path,omitempty"`
+	// AllowedOrigins is a list of origins allowed to make cross-origin requests
+	// to the metrics server. Only same-origin requests are allowed by default.
+	AllowedOrigins []string `koanf:"allowed-origins,omitempty"`
+	// AllowedMethods is a list of methods allowed for cross-origin requests.
+	AllowedMethods []string `koanf:"allowed-methods,omitempty"`
+	// AllowedHeaders is a list of request headers allowed for cross-origin requests.
+	AllowedHeaders []string `koanf:"allowed-headers,omitempty"`
+	// DiagnosticsPath is the path to serve the network diagnostics report on.
+	// The report exposes the mesh topology, so it is disabled when empty. It is
+	// only served to clients connecting from a loopback address, or presenting
+	// a verified client certificate when TLS and mTLS are enabled.
+	DiagnosticsPath string `koanf:"diagnostics-path,omitempty"`
+	// ClusterPath is the path to serve health metrics aggregated from every
+	// storage member on, giving small meshes a single scrape target. It is
+	// disabled when empty.
+	ClusterPath string `koanf:"cluster-path,omitempty"`
+	// ClusterScrapeTimeout is how long each member is given to report its status.
+	ClusterScrapeTimeout time.Duration `koanf:"cluster-scrape-timeout,omitempty"`
+	// ConfigPath is the path to serve the effective configuration of the node
+	// on, with secrets redacted. It is disabled when empty, and served to the
+	// same clients as the diagnostics report.
+	ConfigPath string `koanf:"config-path,omitempty"`
+	// TLS serves the metrics server over TLS with the certificate of the gRPC
+	// API. Client certificates are required when services.api.mtls is set.
+	TLS bool `koanf:"tls,omitempty"`
+	// TrustMesh also serves the diagnostics report and the effective configuration
+	// to any client connecting from an address inside the mesh networks.
+	TrustMesh bool `koanf:"trust-mesh,omitempty"`
 }
 
 // NewMetricsOptions returns a new MetricsOptions with the default values.
 func NewMetricsOptions() MetricsOptions {
 	return MetricsOptions{
-		Enabled:       false,
-		ListenAddress: metrics.DefaultListenAddress,
-		Path:          metrics.DefaultPath,
+		Enabled:              false,
+		ListenAddress:        metrics.DefaultListenAddress,
+		Path:                 metrics.DefaultPath,
+		AllowedMethods:       []string{"GET", "HEAD"},
+		ClusterScrapeTimeout: metrics.DefaultClusterScrapeTimeout,
 	}
 }
 
@@ -602,6 +885,15 @@ func (m *MetricsOptions) BindFlags(prefix string, fl *pflag.FlagSet) {
 	fl.BoolVar(&m.Enabled, prefix+"enabled", m.Enabled, "Enable gRPC metrics.")
 	fl.StringVar(&m.ListenAddress, prefix+"listen-address", m.ListenAddress, "gRPC metrics listen address.")
 	fl.StringVar(&m.Path, prefix+"path", m.Path, "gRPC metrics path.")
+	fl.StringSliceVar(&m.AllowedOrigins, prefix+"allowed-origins", m.AllowedOrigins, "Origins allowed to make cross-origin requests to the metrics server.")
+	fl.StringSliceVar(&m.AllowedMethods, prefix+"allowed-methods", m.AllowedMethods, "Methods allowed for cross-origin requests to the metrics server.")
+	fl.StringSliceVar(&m.AllowedHeaders, prefix+"allowed-headers", m.AllowedHeaders, "Request headers allowed for cross-origin requests to the metrics server.")
+	fl.StringVar(&m.DiagnosticsPath, prefix+"diagnostics-path", m.DiagnosticsPath, "Path to serve the network diagnostics report on. Disabled when empty. Only served to loopback addresses, or to clients with a verified certificate.")
+	fl.StringVar(&m.ClusterPath, prefix+"cluster-path", m.ClusterPath, "Path to serve health metrics aggregated from all storage members on. Disabled when empty.")
+	fl.DurationVar(&m.ClusterScrapeTimeout, prefix+"cluster-scrape-timeout", m.ClusterScrapeTimeout, "Time each storage member is given to report its status for the cluster metrics.")
+	fl.StringVar(&m.ConfigPath, prefix+"config-path", m.ConfigPath, "Path to serve the effective configuration of the node on with secrets redacted. Disabled when empty. Only served to loopback addresses, or to clients with a verified certificate.")
+	fl.BoolVar(&m.TLS, prefix+"tls", m.TLS, "Serve the metrics server over TLS with the gRPC API certificate, requiring client certificates when services.api.mtls is set.")
+	fl.BoolVar(&m.TrustMesh, prefix+"trust-mesh", m.TrustMesh, "Also serve the diagnostics report and the effective configuration to any client with a mesh address.")
 }
 
 // ListenPort returns the listen port for the Metrics server is enabled.
@@ -632,14 +924,90 @@ func (m MetricsOptions) Validate() error {
 	if err != nil {
 		return fmt.Errorf("services.metrics.listen-address is invalid: %w", err)
 	}
+	if m.DiagnosticsPath != "" {
+		if !strings.HasPrefix(m.DiagnosticsPath, "/") {
+			return fmt.Errorf("services.metrics.diagnostics-path must start with a /")
+		}
+		if m.DiagnosticsPath == m.Path {
+			return fmt.Errorf("services.metrics.diagnostics-path must differ from services.metrics.path")
+		}
+	}
+	if m.ClusterPath != "" {
+		if !strings.HasPrefix(m.ClusterPath, "/") {
+			return fmt.Errorf("services.metrics.cluster-path must start with a /")
+		}
+		if m.ClusterPath == m.Path || m.ClusterPath == m.DiagnosticsPath {
+			return fmt.Errorf("services.metrics.cluster-path must differ from the metrics and diagnostics paths")
+		}
+	}
+	if m.ConfigPath != "" {
+		if !strings.HasPrefix(m.ConfigPath, "/") {
+			return fmt.Errorf("services.metrics.config-path must start with a /")
+		}
+		if slices.Contains([]string{m.Path, m.DiagnosticsPath, m.ClusterPath}, m.ConfigPath) {
+			return fmt.Errorf("services.metrics.config-path must differ from the metrics, diagnostics, and cluster paths")
+		}
+	}
+	if m.ClusterScrapeTimeout < 0 {
+		return fmt.Errorf("services.metrics.cluster-scrape-timeout must be greater than or equal to 0")
+	}
 	return nil
 }
 
+// nodeClusterSource gathers the cluster metrics from the storage members
+// known to the node, calling each of them for their status.
+type nodeClusterSource struct {
+	node meshnode.Node
+}
+
+func (n nodeClusterSource) Members(ctx context.Context) ([]string, error) {
+	peers, err := n.node.Storage().Consensus().GetPeers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(peers))
+	for i, peer := range peers {
+		ids[i] = peer.GetId()
+	}
+	return ids, nil
+}
+
+func (n nodeClusterSource) Status(ctx context.Context, id string) (*v1.Status, error) {
+	conn, err := n.node.DialNode(ctx, types.NodeID(id))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return v1.NewNodeClient(conn).GetStatus(ctx, &v1.GetStatusRequest{Id: id})
+}
+
+// NewServiceOptions returns new options for the webmesh services. Unlike
+// ServiceOptions.NewServiceOptions, the metrics server can also serve the
+// redacted configuration of the node.
+func (o *Config) NewServiceOptions(ctx context.Context, conn meshnode.Node) (services.Options, error) {
+	opts := o.Services
+	opts.effectiveConfig = o.Redacted
+	return opts.NewServiceOptions(ctx, conn)
+}
+
 // NewServiceOptions returns new options for the webmesh services.
 func (o *ServiceOptions) NewServiceOptions(ctx context.Context, conn meshnode.Node) (conf services.Options, err error) {
 	conf.DisableGRPC = o.API.Disabled
 	if !conf.DisableGRPC {
 		conf.ListenAddress = o.API.ListenAddress
+		conf.ListenUnixSocket = o.API.ListenUnixSocket
+		conf.Keepalive = services.KeepaliveOptions{
+			MaxConnectionIdle:     o.API.MaxConnectionIdle,
+			MaxConnectionAge:      o.API.MaxConnectionAge,
+			MaxConnectionAgeGrace: o.API.MaxConnectionAgeGrace,
+			MinPingInterval:       o.API.KeepaliveMinPingInterval,
+		}
+		conf.MaxConcurrentStreams = o.API.MaxConcurrentStreams
+		conf.ShutdownGracePeriod = o.API.ShutdownGracePeriod
+		conf.UnixSocketPermissions, err = o.API.UnixSocketMode()
+		if err != nil {
+			return conf, err
+		}
 		// Build out the server options
 		srvopts, err := o.NewServerOptions(ctx)
 		if err != nil {
@@ -680,11 +1048,34 @@ func (o *ServiceOptions) NewServiceOptions(ctx context.Context, conn meshnode.No
 		}
 		if !o.API.DisableLeaderProxy {
 			leaderProxy := leaderproxy.New(conn.ID(), conn.Storage().Consensus(), conn, conn.Network())
+			if raft, ok := conn.Storage().(*raftstorage.Provider); ok {
+				// Drop the cached leader connection whenever leadership changes.
+				raft.OnObservation(func(_ context.Context, obs raftstorage.Observation) {
+					if _, ok := obs.Data.(raftstorage.LeaderObservation); ok {
+						leaderProxy.InvalidateLeader()
+					}
+				})
+			}
 			unarymiddlewares = append(unarymiddlewares, leaderProxy.UnaryInterceptor())
 			streammiddlewares = append(streammiddlewares, leaderProxy.StreamInterceptor())
+			conf.Closers = append(conf.Closers, leaderProxy)
+		}
+		if len(o.API.WriteQuorumMethods) > 0 {
+			barrier, ok := conn.Storage().(meshstorage.WriteBarrier)
+			if !ok {
+				return conf, fmt.Errorf("services.api.write-quorum-methods is not supported by the storage provider")
+			}
+			unarymiddlewares = append(unarymiddlewares, services.WriteQuorumUnaryInterceptor(barrier, o.API.WriteQuorumMethods))
 		}
 		conf.ServerOptions = append(conf.ServerOptions, grpc.ChainUnaryInterceptor(unarymiddlewares...))
 		conf.ServerOptions = append(conf.ServerOptions, grpc.ChainStreamInterceptor(streammiddlewares...))
+		if o.API.LoadHintInterval > 0 {
+			conf.LoadHints = &services.LoadHintOptions{
+				NodeID:   conn.ID(),
+				Storage:  conn.Storage().MeshStorage(),
+				Interval: o.API.LoadHintInterval,
+			}
+		}
 	}
 	// Append the enabled mesh services
 	if o.MeshDNS.Enabled {
@@ -722,9 +1113,40 @@ func (o *ServiceOptions) NewServiceOptions(ctx context.Context, conn meshnode.No
 		conf.Servers = append(conf.Servers, turnServer)
 	}
 	if o.Metrics.Enabled {
+		var metricsTLS *tls.Config
+		if o.Metrics.TLS {
+			metricsTLS, err = o.apiTLSConfig(ctx)
+			if err != nil {
+				return conf, fmt.Errorf("metrics tls config: %w", err)
+			}
+		}
+		var trusted func(netip.Addr) bool
+		if o.Metrics.TrustMesh {
+			trusted = meshSourceTrust(conn)
+		}
 		metricsServer := metrics.New(ctx, metrics.Options{
 			ListenAddress: o.Metrics.ListenAddress,
 			Path:          o.Metrics.Path,
+			CORS: metrics.CORSOptions{
+				AllowedOrigins: o.Metrics.AllowedOrigins,
+				AllowedMethods: o.Metrics.AllowedMethods,
+				AllowedHeaders: o.Metrics.AllowedHeaders,
+			},
+			DiagnosticsPath: o.Metrics.DiagnosticsPath,
+			Diagnostics: func(ctx context.Context) (meshnet.Report, error) {
+				nw := conn.Network()
+				if nw == nil {
+					return meshnet.Report{}, errors.New("network is not ready")
+				}
+				return nw.Diagnostics(ctx)
+			},
+			ClusterPath:          o.Metrics.ClusterPath,
+			Cluster:              nodeClusterSource{conn},
+			ClusterScrapeTimeout: o.Metrics.ClusterScrapeTimeout,
+			ConfigPath:           o.Metrics.ConfigPath,
+			Config:               o.effectiveConfig,
+			TrustedSource:        trusted,
+			TLSConfig:            metricsTLS,
 		})
 		conf.Servers = append(conf.Servers, metricsServer)
 	}
@@ -737,6 +1159,15 @@ func (o *ServiceOptions) NewServerOptions(ctx context.Context) (grpc.ServerOptio
 		// We shouldn't have gotten here. But as a fail safe, we return an insecure server.
 		return grpc.Creds(insecure.NewCredentials()), nil
 	}
+	tlsConfig, err := o.apiTLSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Creds(credentials.NewTLS(tlsConfig)), nil
+}
+
+// apiTLSConfig returns the server TLS configuration of the gRPC API.
+func (o *ServiceOptions) apiTLSConfig(ctx context.Context) (*tls.Config, error) {
 	tlsConfig := &tls.Config{}
 	if o.API.TLSCertFile != "" && o.API.TLSKeyFile != "" {
 		cert, err := tls.LoadX509KeyPair(o.API.TLSCertFile, o.API.TLSKeyFile)
@@ -788,7 +1219,26 @@ func (o *ServiceOptions) NewServerOptions(ctx context.Context) (grpc.ServerOptio
 			tlsConfig.ClientCAs = pool
 		}
 	}
-	return grpc.Creds(credentials.NewTLS(tlsConfig)), nil
+	return tlsConfig, nil
+}
+
+// meshSourceTrust returns a function trusting loopback addresses and
+// addresses inside the networks of the mesh.
+func meshSourceTrust(conn meshnode.Node) func(netip.Addr) bool {
+	return func(addr netip.Addr) bool {
+		if addr.IsLoopback() {
+			return true
+		}
+		storage := conn.Storage()
+		if storage == nil {
+			return false
+		}
+		state, err := storage.MeshDB().MeshState().GetMeshState(context.Background())
+		if err != nil {
+			return false
+		}
+		return state.NetworkV4().Contains(addr) || state.NetworkV6().Contains(addr)
+	}
 }
 
 // APIRegistrationOptions are options for registering the APIs to a given server.
@@ -837,24 +1287,40 @@ func (o *ServiceOptions) RegisterAPIs(ctx context.Context, opts APIRegistrationO
 	// Always register the node API
 	log.Debug("Registering node service")
 	v1.RegisterNodeServer(opts.Server, node.NewServer(ctx, node.Options{
-		NodeID:      opts.Node.ID(),
-		Description: opts.Description,
-		Version:     opts.BuildInfo,
-		NodeDialer:  opts.Node,
-		Storage:     opts.Node.Storage(),
-		Meshnet:     opts.Node.Network(),
-		Plugins:     opts.Node.Plugins(),
-		Features:    opts.Features,
+		NodeID:          opts.Node.ID(),
+		Description:     opts.Description,
+		Version:         opts.BuildInfo,
+		NodeDialer:      opts.Node,
+		Storage:         opts.Node.Storage(),
+		Meshnet:         opts.Node.Network(),
+		Plugins:         opts.Node.Plugins(),
+		Features:        opts.Features,
+		RBAC:            rbacEvaluator,
+		DrainTimeout:    o.API.DataChannelDrainTimeout,
+		CandidatePolicy: o.WebRTC.CandidatePolicy(),
 	}))
 	// Register membership and storage if we are a storage provider
 	if opts.Node.Storage().Consensus().IsMember() {
 		log.Debug("Registering membership service")
 		v1.RegisterMembershipServer(opts.Server, membership.NewServer(ctx, membership.Options{
-			NodeID:  opts.Node.ID(),
-			Storage: opts.Node.Storage(),
-			Plugins: opts.Node.Plugins(),
-			RBAC:    rbacEvaluator,
-			Meshnet: opts.Node.Network(),
+			NodeID:                opts.Node.ID(),
+			Storage:               opts.Node.Storage(),
+			Plugins:               opts.Node.Plugins(),
+			RBAC:                  rbacEvaluator,
+			Meshnet:               opts.Node.Network(),
+			IPv6OnlyOnExhaustion:  o.API.IPv6OnlyOnExhaustion,
+			ValidateFeatures:      o.API.ValidateFeatures,
+			EndpointProbe:         membership.EndpointProbeMode(o.API.EndpointProbe),
+			EndpointProbeTimeout:  o.API.EndpointProbeTimeout,
+			HeartbeatSyncInterval: o.API.HeartbeatSyncInterval,
+			JoinTokenSecret:       []byte(o.API.JoinTokenSecret),
+			RequireJoinToken:      o.API.RequireJoinToken,
+			SkipVersionCheck:      o.API.SkipVersionCheck,
+			MaxJoinApplyLag:       o.API.MaxJoinApplyLag,
+			MaxJoinGoroutines:     o.API.MaxJoinGoroutines,
+			JoinRetryAfter:        o.API.JoinRetryAfter,
+			DeadNodeThreshold:     o.API.deadNodeThreshold(),
+			DeadNodeGCInterval:    o.API.DeadNodeGCInterval,
 		}))
 		log.Debug("Registering storage service")
 		storageSrv := storage.NewServer(ctx, opts.Node.Storage(), rbacEvaluator, opts.Node.Network())
@@ -879,11 +1345,12 @@ func (o *ServiceOptions) RegisterAPIs(ctx context.Context, opts APIRegistrationO
 			o.WebRTC.STUNServers = append([]string{turnAddr}, o.WebRTC.STUNServers...)
 		}
 		v1.RegisterWebRTCServer(opts.Server, webrtc.NewServer(webrtc.Options{
-			ID:          opts.Node.ID(),
-			Wireguard:   opts.Node.Network().WireGuard(),
-			NodeDialer:  opts.Node,
-			RBAC:        rbacEvaluator,
-			STUNServers: o.WebRTC.STUNServers,
+			ID:              opts.Node.ID(),
+			Wireguard:       opts.Node.Network().WireGuard(),
+			NodeDialer:      opts.Node,
+			RBAC:            rbacEvaluator,
+			STUNServers:     o.WebRTC.STUNServers,
+			CandidatePolicy: o.WebRTC.CandidatePolicy(),
 		}))
 	}
 	if o.Registrar.Enabled {
@@ -17,6 +17,7 @@ limitations under the License.
 package config
 
 import (
+	"slices"
 	"testing"
 
 	"github.com/spf13/pflag"
@@ -111,6 +112,54 @@ func TestServiceOptionsValidate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "RequireJoinTokenWithoutSecret",
+			opts: &ServiceOptions{
+				API: APIOptions{
+					Disabled:         false,
+					ListenAddress:    services.DefaultGRPCListenAddress,
+					Insecure:         true,
+					RequireJoinToken: true,
+				},
+				WebRTC:  NewWebRTCOptions(),
+				MeshDNS: NewMeshDNSOptions(),
+				TURN:    NewTURNOptions(),
+				Metrics: NewMetricsOptions(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "ValidWriteQuorumMethods",
+			opts: &ServiceOptions{
+				API: APIOptions{
+					Disabled:           false,
+					ListenAddress:      services.DefaultGRPCListenAddress,
+					Insecure:           true,
+					WriteQuorumMethods: []string{"/v1.Admin/PutRole", "/v1.Admin/DeleteRoleBinding"},
+				},
+				WebRTC:  NewWebRTCOptions(),
+				MeshDNS: NewMeshDNSOptions(),
+				TURN:    NewTURNOptions(),
+				Metrics: NewMetricsOptions(),
+			},
+			wantErr: false,
+		},
+		{
+			name: "InvalidWriteQuorumMethod",
+			opts: &ServiceOptions{
+				API: APIOptions{
+					Disabled:           false,
+					ListenAddress:      services.DefaultGRPCListenAddress,
+					Insecure:           true,
+					WriteQuorumMethods: []string{"PutRole"},
+				},
+				WebRTC:  NewWebRTCOptions(),
+				MeshDNS: NewMeshDNSOptions(),
+				TURN:    NewTURNOptions(),
+				Metrics: NewMetricsOptions(),
+			},
+			wantErr: true,
+		},
 		{
 			name: "NoTLSCertFile",
 			opts: &ServiceOptions{
@@ -531,3 +580,26 @@ func TestServiceOptionsValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestServiceOptionsFirewallPorts(t *testing.T) {
+	t.Parallel()
+	opts := NewServiceOptions(false)
+	tcp, udp := opts.FirewallPorts()
+	if len(tcp) != 0 || len(udp) != 0 {
+		t.Fatalf("expected no ports with services disabled, got tcp=%v udp=%v", tcp, udp)
+	}
+	opts.MeshDNS.Enabled = true
+	opts.MeshDNS.ListenUDP = "[::]:5353"
+	opts.MeshDNS.ListenTCP = "[::]:5354"
+	opts.TURN.Enabled = true
+	opts.TURN.ListenAddress = "[::]:3478"
+	opts.Metrics.Enabled = true
+	opts.Metrics.ListenAddress = "[::]:8000"
+	tcp, udp = opts.FirewallPorts()
+	if !slices.Equal(tcp, []uint16{5354, 8000}) {
+		t.Errorf("expected tcp ports [5354 8000], got %v", tcp)
+	}
+	if !slices.Equal(udp, []uint16{5353, 3478}) {
+		t.Errorf("expected udp ports [5353 3478], got %v", udp)
+	}
+}
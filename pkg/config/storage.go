@@ -174,11 +174,16 @@ func (o StorageOptions) NewRaftOptions(ctx context.Context, node meshnode.Node,
 	opts := raftstorage.NewOptions(node.ID(), raftTransport)
 	opts.ClearDataDir = force
 	opts.DataDir = o.Path
+	opts.LogStoreDir = o.Raft.LogStorePath
+	opts.DataStoreDir = o.Raft.DataStorePath
 	opts.InMemory = o.InMemory
 	opts.ConnectionPoolCount = o.Raft.ConnectionPoolCount
 	opts.ConnectionTimeout = o.Raft.ConnectionTimeout
 	opts.HeartbeatTimeout = o.Raft.HeartbeatTimeout
 	opts.ElectionTimeout = o.Raft.ElectionTimeout
+	opts.ScaleTimeouts = o.Raft.ScaleTimeouts
+	opts.MaxElectionTimeout = o.Raft.MaxElectionTimeout
+	opts.LeaderStickiness = o.Raft.LeaderStickiness
 	opts.ApplyTimeout = o.Raft.ApplyTimeout
 	opts.CommitTimeout = o.Raft.CommitTimeout
 	opts.MaxAppendEntries = o.Raft.MaxAppendEntries
@@ -186,7 +191,11 @@ func (o StorageOptions) NewRaftOptions(ctx context.Context, node meshnode.Node,
 	opts.SnapshotInterval = o.Raft.SnapshotInterval
 	opts.SnapshotThreshold = o.Raft.SnapshotThreshold
 	opts.SnapshotRetention = o.Raft.SnapshotRetention
+	opts.SnapshotCompressionLevel = o.Raft.SnapshotCompressionLevel
+	opts.SnapshotOnShutdown = o.Raft.SnapshotOnShutdown
+	opts.ShutdownSnapshotTimeout = o.Raft.ShutdownSnapshotTimeout
 	opts.ObserverChanBuffer = o.Raft.ObserverChanBuffer
+	opts.QuorumLossReads = raftstorage.QuorumLossReadPolicy(o.Raft.QuorumLossReads)
 	opts.LogLevel = o.LogLevel
 	opts.LogFormat = o.LogFormat
 	return opts, nil
@@ -30,6 +30,10 @@ type TLSOptions struct {
 	InsecureSkipVerify bool `koanf:"insecure-skip-verify,omitempty"`
 	// Insecure is true if the gRPC connection should be insecure.
 	Insecure bool `koanf:"insecure,omitempty"`
+	// PeerServerName is the TLS server name to verify when dialing other nodes.
+	// Any "{id}" in the name is replaced with the ID of the node being dialed.
+	// If empty, the dialed address is verified.
+	PeerServerName string `koanf:"peer-server-name,omitempty"`
 }
 
 // NewTLSOptions returns a new empty TLSOptions.
@@ -40,6 +44,7 @@ func NewTLSOptions() TLSOptions {
 		VerifyChainOnly:    false,
 		InsecureSkipVerify: false,
 		Insecure:           false,
+		PeerServerName:     "",
 	}
 }
 
@@ -50,4 +55,5 @@ func (o *TLSOptions) BindFlags(prefix string, fl *pflag.FlagSet) {
 	fl.BoolVar(&o.VerifyChainOnly, prefix+"verify-chain-only", o.VerifyChainOnly, "Verify only the certificate chain.")
 	fl.BoolVar(&o.InsecureSkipVerify, prefix+"insecure-skip-verify", o.InsecureSkipVerify, "Skip verification of the server TLS cert.")
 	fl.BoolVar(&o.Insecure, prefix+"insecure", o.Insecure, "Disable TLS.")
+	fl.StringVar(&o.PeerServerName, prefix+"peer-server-name", o.PeerServerName, "The TLS server name to verify when dialing other nodes. {id} is replaced with the node ID. Defaults to verifying the dialed address.")
 }
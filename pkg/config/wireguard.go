@@ -19,16 +19,23 @@ package config
 import (
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/system"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system/firewall"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system/link"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
 // WireGuardOptions are options for configuring the WireGuard interface.
@@ -44,6 +51,8 @@ type WireGuardOptions struct {
 	ForceInterfaceName bool `koanf:"force-interface-name,omitempty"`
 	// ForceTUN forces the use of a TUN interface.
 	ForceTUN bool `koanf:"force-tun,omitempty"`
+	// UserspaceBackend is the userspace WireGuard implementation to use for TUN interfaces.
+	UserspaceBackend string `koanf:"userspace-backend,omitempty"`
 	// Masquerade enables masquerading of traffic from the wireguard interface.
 	Masquerade bool `koanf:"masquerade,omitempty"`
 	// PersistentKeepAlive is the interval at which to send keepalive packets
@@ -51,8 +60,26 @@ type WireGuardOptions struct {
 	// accessible peers when this instance is behind a NAT. Otherwise, no keep-alive
 	// packets are sent.
 	PersistentKeepAlive time.Duration `koanf:"persistent-keepalive,omitempty"`
+	// NATKeepAliveOnly only sends keepalive packets to peers that appear to be behind
+	// NAT, i.e. peers reached over ICE or libp2p or without a primary endpoint.
+	NATKeepAliveOnly bool `koanf:"nat-keepalive-only,omitempty"`
+	// KeepAlivePeers are peer IDs that are always sent keepalive packets.
+	KeepAlivePeers []string `koanf:"keepalive-peers,omitempty"`
+	// NoKeepAlivePeers are peer IDs that are never sent keepalive packets.
+	NoKeepAlivePeers []string `koanf:"no-keepalive-peers,omitempty"`
 	// MTU is the MTU to use for the interface.
 	MTU int `koanf:"mtu,omitempty"`
+	// AutoMTU sets the interface MTU from the path MTU to peer endpoints, falling
+	// back to MTU when it cannot be discovered.
+	AutoMTU bool `koanf:"auto-mtu,omitempty"`
+	// AutoMTUInterval is the interval at which the path MTU is probed again when
+	// AutoMTU is enabled. Set this to 0 to only probe at startup.
+	AutoMTUInterval time.Duration `koanf:"auto-mtu-interval,omitempty"`
+	// EndpointCacheFile is a file to cache the endpoints of directly connected peers
+	// in, so they can be configured right away on restart. Empty disables the cache.
+	EndpointCacheFile string `koanf:"endpoint-cache-file,omitempty"`
+	// EndpointCacheTTL is how long cached peer endpoints are used for.
+	EndpointCacheTTL time.Duration `koanf:"endpoint-cache-ttl,omitempty"`
 	// Endpoints are additional WireGuard endpoints to broadcast when joining.
 	Endpoints []string `koanf:"endpoints,omitempty"`
 	// KeyFile is the path to the WireGuard private key. If it does not exist it will be created.
@@ -67,6 +94,62 @@ type WireGuardOptions struct {
 	RecordMetricsInterval time.Duration `koanf:"record-metrics-interval,omitempty"`
 	// DisableFullTunnel will ignore routes for a default gateway.
 	DisableFullTunnel bool `koanf:"disable-full-tunnel,omitempty"`
+	// PresharedKey is an optional base64-encoded preshared key to use with every
+	// peer, as generated by `wg genpsk`. Every node in the mesh must use the same key.
+	PresharedKey string `koanf:"preshared-key,omitempty"`
+	// HandshakeTimeout removes peers from the interface that have not completed a
+	// handshake within the given window. Peers still present in the mesh are re-added
+	// on the next refresh. Set this to 0 to disable handshake-based peer removal. Only
+	// peers with a persistent keepalive are removed, since idle peers without one do
+	// not handshake.
+	HandshakeTimeout time.Duration `koanf:"handshake-timeout,omitempty"`
+	// PeerPingConcurrency is the number of liveness pings sent to new peers in parallel.
+	PeerPingConcurrency int `koanf:"peer-ping-concurrency,omitempty"`
+	// PeerPingTimeout is the timeout for the liveness ping sent to new peers.
+	PeerPingTimeout time.Duration `koanf:"peer-ping-timeout,omitempty"`
+	// DisablePeerPing disables the liveness ping sent to new peers.
+	DisablePeerPing bool `koanf:"disable-peer-ping,omitempty"`
+	// EndpointResolveInterval is the interval at which peer endpoints given as
+	// hostnames are resolved again. Set this to 0 to disable re-resolution.
+	EndpointResolveInterval time.Duration `koanf:"endpoint-resolve-interval,omitempty"`
+	// ReconcileInterval is the interval at which the interface peers are checked
+	// against the store and refreshed if they drifted. Set this to 0 to disable.
+	ReconcileInterval time.Duration `koanf:"reconcile-interval,omitempty"`
+	// AsymmetricCheckInterval is the interval at which peers are checked for
+	// whether they route this node's mesh addresses back to it. Set this to 0 to disable.
+	AsymmetricCheckInterval time.Duration `koanf:"asymmetric-check-interval,omitempty"`
+	// RouteAccountingInterval is the interval at which traffic forwarded to the routes
+	// advertised by this node is collected into metrics. Set this to 0 to disable.
+	RouteAccountingInterval time.Duration `koanf:"route-accounting-interval,omitempty"`
+	// DisableRouteManagement configures the interface and peers without installing
+	// any routes, equivalent to wg-quick's "Table = off".
+	DisableRouteManagement bool `koanf:"disable-route-management,omitempty"`
+	// DisableNetworkRoute installs routes only for the addresses of peers instead
+	// of routing the whole mesh network to the interface.
+	DisableNetworkRoute bool `koanf:"disable-network-route,omitempty"`
+	// AssignLinkLocal assigns a deterministic IPv6 link-local address derived from
+	// the WireGuard public key to the interface.
+	AssignLinkLocal bool `koanf:"assign-link-local,omitempty"`
+	// MasqueradeExclusions are destination prefixes that are forwarded without
+	// source NAT when masquerading is enabled.
+	MasqueradeExclusions []string `koanf:"masquerade-exclusions,omitempty"`
+	// FirewallDefaultPolicy is the default policy of the firewall for traffic
+	// that no rule matches. One of accept or drop.
+	FirewallDefaultPolicy string `koanf:"firewall-default-policy,omitempty"`
+	// NDPProxyInterface is a LAN interface to proxy IPv6 neighbor discovery on for
+	// this node's mesh address, so LAN hosts can reach it directly. Linux only.
+	NDPProxyInterface string `koanf:"ndp-proxy-interface,omitempty"`
+	// NDPProxyPeers also proxies the mesh IPv6 addresses of peers on the NDP proxy interface.
+	NDPProxyPeers bool `koanf:"ndp-proxy-peers,omitempty"`
+	// PortMapping requests a mapping of the listen port from a UPnP or NAT-PMP gateway
+	// and advertises the mapped external address as the primary endpoint.
+	PortMapping bool `koanf:"port-mapping,omitempty"`
+	// PortMappingLifetime is the lifetime requested for the port mapping. It is
+	// refreshed at half this interval.
+	PortMappingLifetime time.Duration `koanf:"port-mapping-lifetime,omitempty"`
+	// LinkLocalEndpointInterface is the physical interface used as the zone of
+	// link-local IPv6 peer endpoints. When unset, link-local endpoints are skipped.
+	LinkLocalEndpointInterface string `koanf:"link-local-endpoint-interface,omitempty"`
 
 	// loaded is an already loaded key from the configuration.
 	loaded crypto.PrivateKey `koanf:"-"`
@@ -75,20 +158,45 @@ type WireGuardOptions struct {
 // NewWireGuardOptions returns a new WireGuardOptions with sensible defaults.
 func NewWireGuardOptions() WireGuardOptions {
 	return WireGuardOptions{
-		ListenPort:            wireguard.DefaultListenPort,
-		Modprobe:              false,
-		InterfaceName:         wireguard.DefaultInterfaceName,
-		ForceInterfaceName:    false,
-		ForceTUN:              false,
-		Masquerade:            false,
-		PersistentKeepAlive:   0,
-		MTU:                   system.DefaultMTU,
-		Endpoints:             nil,
-		KeyFile:               "",
-		KeyRotationInterval:   time.Hour * 24 * 7,
-		RecordMetrics:         false,
-		RecordMetricsInterval: time.Second * 10,
-		DisableFullTunnel:     false,
+		ListenPort:              wireguard.DefaultListenPort,
+		Modprobe:                false,
+		InterfaceName:           wireguard.DefaultInterfaceName,
+		ForceInterfaceName:      false,
+		ForceTUN:                false,
+		UserspaceBackend:        "",
+		Masquerade:              false,
+		PersistentKeepAlive:     0,
+		NATKeepAliveOnly:        false,
+		KeepAlivePeers:          nil,
+		NoKeepAlivePeers:        nil,
+		MTU:                     system.DefaultMTU,
+		AutoMTU:                 false,
+		AutoMTUInterval:         meshnet.DefaultAutoMTUInterval,
+		EndpointCacheFile:       "",
+		EndpointCacheTTL:        meshnet.DefaultEndpointCacheTTL,
+		Endpoints:               nil,
+		KeyFile:                 "",
+		KeyRotationInterval:     time.Hour * 24 * 7,
+		RecordMetrics:           false,
+		RecordMetricsInterval:   time.Second * 10,
+		DisableFullTunnel:       false,
+		HandshakeTimeout:        0,
+		PeerPingConcurrency:     meshnet.DefaultPeerPingConcurrency,
+		PeerPingTimeout:         meshnet.DefaultPeerPingTimeout,
+		DisablePeerPing:         false,
+		EndpointResolveInterval: meshnet.DefaultEndpointResolveInterval,
+		ReconcileInterval:       meshnet.DefaultReconcileInterval,
+		RouteAccountingInterval: 0,
+		AsymmetricCheckInterval: 0,
+		DisableRouteManagement:  false,
+		DisableNetworkRoute:     false,
+		AssignLinkLocal:         false,
+		MasqueradeExclusions:    nil,
+		FirewallDefaultPolicy:   string(firewall.PolicyAccept),
+		NDPProxyInterface:       "",
+		NDPProxyPeers:           false,
+		PortMapping:             false,
+		PortMappingLifetime:     meshnet.DefaultPortMappingLifetime,
 	}
 }
 
@@ -105,15 +213,42 @@ func (o *WireGuardOptions) BindFlags(prefix string, fs *pflag.FlagSet) {
 	fs.StringVar(&o.InterfaceName, prefix+"interface-name", o.InterfaceName, "The name of the interface.")
 	fs.BoolVar(&o.ForceInterfaceName, prefix+"force-interface-name", o.ForceInterfaceName, "Force the use of the given name by deleting any pre-existing interface with the same name.")
 	fs.BoolVar(&o.ForceTUN, prefix+"force-tun", o.ForceTUN, "Force the use of a TUN interface.")
+	fs.StringVar(&o.UserspaceBackend, prefix+"userspace-backend", o.UserspaceBackend, fmt.Sprintf("The userspace WireGuard implementation to use for TUN interfaces (one of %s).", strings.Join(link.UserspaceBackends(), ", ")))
 	fs.BoolVar(&o.Masquerade, prefix+"masquerade", o.Masquerade, "Enable masquerading of traffic from the wireguard interface.")
 	fs.DurationVar(&o.PersistentKeepAlive, prefix+"persistent-keepalive", o.PersistentKeepAlive, "The interval at which to send keepalive packets to peers.")
+	fs.BoolVar(&o.NATKeepAliveOnly, prefix+"nat-keepalive-only", o.NATKeepAliveOnly, "Only send keepalive packets to peers that appear to be behind NAT.")
+	fs.StringSliceVar(&o.KeepAlivePeers, prefix+"keepalive-peers", o.KeepAlivePeers, "Peer IDs that are always sent keepalive packets.")
+	fs.StringSliceVar(&o.NoKeepAlivePeers, prefix+"no-keepalive-peers", o.NoKeepAlivePeers, "Peer IDs that are never sent keepalive packets.")
 	fs.IntVar(&o.MTU, prefix+"mtu", o.MTU, "The MTU to use for the interface.")
+	fs.BoolVar(&o.AutoMTU, prefix+"auto-mtu", o.AutoMTU, "Set the interface MTU from the path MTU to peer endpoints, falling back to the configured MTU.")
+	fs.DurationVar(&o.AutoMTUInterval, prefix+"auto-mtu-interval", o.AutoMTUInterval, "The interval at which to probe the path MTU again when auto-mtu is enabled. Set this to 0 to only probe at startup.")
+	fs.StringVar(&o.EndpointCacheFile, prefix+"endpoint-cache-file", o.EndpointCacheFile, "A file to cache direct peer endpoints in so they are configured right away on restart.")
+	fs.DurationVar(&o.EndpointCacheTTL, prefix+"endpoint-cache-ttl", o.EndpointCacheTTL, "How long cached peer endpoints are used for.")
 	fs.StringSliceVar(&o.Endpoints, prefix+"endpoints", o.Endpoints, "Additional WireGuard endpoints to broadcast when joining.")
 	fs.StringVar(&o.KeyFile, prefix+"key-file", o.KeyFile, "The path to the WireGuard private key. If it does not exist it will be created.")
 	fs.DurationVar(&o.KeyRotationInterval, prefix+"key-rotation-interval", o.KeyRotationInterval, "The interval to rotate wireguard keys. Set this to 0 to disable key rotation.")
 	fs.BoolVar(&o.RecordMetrics, prefix+"record-metrics", o.RecordMetrics, "Record WireGuard metrics. These are only exposed if the metrics server is enabled.")
 	fs.DurationVar(&o.RecordMetricsInterval, prefix+"record-metrics-interval", o.RecordMetricsInterval, "The interval at which to update WireGuard metrics.")
 	fs.BoolVar(&o.DisableFullTunnel, prefix+"disable-full-tunnel", o.DisableFullTunnel, "Ignore routes for a default gateway.")
+	fs.StringVar(&o.PresharedKey, prefix+"preshared-key", o.PresharedKey, "A base64-encoded preshared key to use with every peer. Every node in the mesh must use the same key.")
+	fs.DurationVar(&o.HandshakeTimeout, prefix+"handshake-timeout", o.HandshakeTimeout, "Remove peers with a persistent keepalive that have not completed a handshake within this window. Set this to 0 to disable.")
+	fs.IntVar(&o.PeerPingConcurrency, prefix+"peer-ping-concurrency", o.PeerPingConcurrency, "The number of liveness pings to send to new peers in parallel.")
+	fs.DurationVar(&o.PeerPingTimeout, prefix+"peer-ping-timeout", o.PeerPingTimeout, "The timeout for the liveness ping sent to new peers.")
+	fs.BoolVar(&o.DisablePeerPing, prefix+"disable-peer-ping", o.DisablePeerPing, "Disable the liveness ping sent to new peers.")
+	fs.DurationVar(&o.EndpointResolveInterval, prefix+"endpoint-resolve-interval", o.EndpointResolveInterval, "The interval at which to resolve peer endpoints given as hostnames again. Set this to 0 to disable.")
+	fs.DurationVar(&o.ReconcileInterval, prefix+"reconcile-interval", o.ReconcileInterval, "The interval at which to reconcile interface peers with the store as a safety net for missed updates. Set this to 0 to disable.")
+	fs.DurationVar(&o.AsymmetricCheckInterval, prefix+"asymmetric-check-interval", o.AsymmetricCheckInterval, "The interval at which to check for peers that do not route this node's mesh addresses back to it. The check is expensive in large meshes. Set this to 0 to disable.")
+	fs.DurationVar(&o.RouteAccountingInterval, prefix+"route-accounting-interval", o.RouteAccountingInterval, "The interval at which to collect traffic forwarded to advertised routes into metrics. Requires nftables. Set this to 0 to disable.")
+	fs.BoolVar(&o.DisableRouteManagement, prefix+"disable-route-management", o.DisableRouteManagement, "Do not install any routes for the mesh or peers, leaving routing to the operator.")
+	fs.BoolVar(&o.DisableNetworkRoute, prefix+"disable-network-route", o.DisableNetworkRoute, "Only install routes for the addresses of peers instead of the whole mesh network.")
+	fs.BoolVar(&o.AssignLinkLocal, prefix+"assign-link-local", o.AssignLinkLocal, "Assign a deterministic IPv6 link-local address derived from the WireGuard key.")
+	fs.StringSliceVar(&o.MasqueradeExclusions, prefix+"masquerade-exclusions", o.MasqueradeExclusions, "Destination prefixes to forward without source NAT when masquerading.")
+	fs.StringVar(&o.FirewallDefaultPolicy, prefix+"firewall-default-policy", o.FirewallDefaultPolicy, "The default firewall policy for traffic no rule matches (accept or drop). With drop, wireguard, gRPC, storage, MeshDNS, TURN and metrics listen ports are allowed; other ports, such as libp2p listeners and TURN relay ranges, must be allowed by the operator.")
+	fs.StringVar(&o.NDPProxyInterface, prefix+"ndp-proxy-interface", o.NDPProxyInterface, "A LAN interface to proxy IPv6 neighbor discovery on for this node's mesh address (Linux only).")
+	fs.BoolVar(&o.NDPProxyPeers, prefix+"ndp-proxy-peers", o.NDPProxyPeers, "Also proxy the mesh IPv6 addresses of peers on the NDP proxy interface.")
+	fs.BoolVar(&o.PortMapping, prefix+"port-mapping", o.PortMapping, "Map the listen port with UPnP or NAT-PMP and advertise the external address as the primary endpoint.")
+	fs.DurationVar(&o.PortMappingLifetime, prefix+"port-mapping-lifetime", o.PortMappingLifetime, "The lifetime to request for the port mapping. It is refreshed at half this interval.")
+	fs.StringVar(&o.LinkLocalEndpointInterface, prefix+"link-local-endpoint-interface", o.LinkLocalEndpointInterface, "The interface to use as the zone of link-local IPv6 peer endpoints. Link-local endpoints are skipped when unset.")
 }
 
 // Validate validates the options.
@@ -124,9 +259,34 @@ func (o *WireGuardOptions) Validate() error {
 	if o.InterfaceName == "" {
 		return fmt.Errorf("wireguard.interface-name must be set")
 	}
+	if err := wireguard.ValidateInterfaceName(o.InterfaceName); err != nil {
+		return fmt.Errorf("invalid wireguard.interface-name: %w", err)
+	}
 	if o.MTU < 1280 {
 		return fmt.Errorf("wireguard.mtu must be greater than 1280")
 	}
+	if o.NDPProxyPeers && o.NDPProxyInterface == "" {
+		return fmt.Errorf("wireguard.ndp-proxy-interface must be set when wireguard.ndp-proxy-peers is enabled")
+	}
+	for _, peer := range o.KeepAlivePeers {
+		if !types.IsValidNodeID(peer) {
+			return fmt.Errorf("wireguard.keepalive-peers contains an invalid peer ID %s", peer)
+		}
+		if slices.Contains(o.NoKeepAlivePeers, peer) {
+			return fmt.Errorf("peer %s cannot be in both wireguard.keepalive-peers and wireguard.no-keepalive-peers", peer)
+		}
+	}
+	for _, peer := range o.NoKeepAlivePeers {
+		if !types.IsValidNodeID(peer) {
+			return fmt.Errorf("wireguard.no-keepalive-peers contains an invalid peer ID %s", peer)
+		}
+	}
+	if o.AutoMTUInterval < 0 {
+		return fmt.Errorf("wireguard.auto-mtu-interval must be greater than or equal to 0")
+	}
+	if o.EndpointCacheTTL < 0 {
+		return fmt.Errorf("wireguard.endpoint-cache-ttl must be greater than or equal to 0")
+	}
 	if o.KeyRotationInterval < 0 {
 		return fmt.Errorf("wireguard.key-rotation-interval must be greater than or equal to 0")
 	}
@@ -135,9 +295,73 @@ func (o *WireGuardOptions) Validate() error {
 			return fmt.Errorf("wireguard.record-metrics-interval must be greater than 0")
 		}
 	}
+	if o.HandshakeTimeout < 0 {
+		return fmt.Errorf("wireguard.handshake-timeout must be greater than or equal to 0")
+	}
+	if o.EndpointResolveInterval < 0 {
+		return fmt.Errorf("wireguard.endpoint-resolve-interval must be greater than or equal to 0")
+	}
+	if o.UserspaceBackend != "" {
+		if _, err := link.LookupUserspaceBackend(o.UserspaceBackend); err != nil {
+			return fmt.Errorf("wireguard.userspace-backend: %w", err)
+		}
+	}
+	if o.ReconcileInterval < 0 {
+		return fmt.Errorf("wireguard.reconcile-interval must be greater than or equal to 0")
+	}
+	if o.AsymmetricCheckInterval < 0 {
+		return fmt.Errorf("wireguard.asymmetric-check-interval must be greater than or equal to 0")
+	}
+	if o.RouteAccountingInterval < 0 {
+		return fmt.Errorf("wireguard.route-accounting-interval must be greater than or equal to 0")
+	}
+	if o.PortMappingLifetime < 0 {
+		return fmt.Errorf("wireguard.port-mapping-lifetime must be greater than or equal to 0")
+	}
+	if o.PeerPingConcurrency < 0 {
+		return fmt.Errorf("wireguard.peer-ping-concurrency must be greater than or equal to 0")
+	}
+	if o.PeerPingTimeout < 0 {
+		return fmt.Errorf("wireguard.peer-ping-timeout must be greater than or equal to 0")
+	}
+	if !firewall.Policy(o.FirewallDefaultPolicy).IsValid() {
+		return fmt.Errorf("wireguard.firewall-default-policy must be one of %s or %s", firewall.PolicyAccept, firewall.PolicyDrop)
+	}
+	if _, err := o.LoadPresharedKey(); err != nil {
+		return err
+	}
+	if _, err := o.LoadMasqueradeExclusions(); err != nil {
+		return err
+	}
 	return nil
 }
 
+// LoadMasqueradeExclusions parses the configured masquerade exclusions.
+func (o *WireGuardOptions) LoadMasqueradeExclusions() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, exclusion := range o.MasqueradeExclusions {
+		prefix, err := netip.ParsePrefix(exclusion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wireguard.masquerade-exclusions %q: %w", exclusion, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// LoadPresharedKey parses the configured preshared key. It returns nil
+// if no preshared key is configured.
+func (o *WireGuardOptions) LoadPresharedKey() (*wgtypes.Key, error) {
+	if o.PresharedKey == "" {
+		return nil, nil
+	}
+	key, err := wgtypes.ParseKey(o.PresharedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wireguard.preshared-key: %w", err)
+	}
+	return &key, nil
+}
+
 // LoadKey loads the key from the given configuration.
 func (o *WireGuardOptions) LoadKey(ctx context.Context) (crypto.PrivateKey, error) {
 	log := context.LoggerFrom(ctx)
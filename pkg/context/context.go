@@ -64,6 +64,11 @@ func WithCancel(ctx Context) (Context, CancelFunc) {
 	return context.WithCancel(ctx)
 }
 
+// WithValue returns a copy of the context with the given key and value set.
+func WithValue(ctx Context, key, val any) Context {
+	return context.WithValue(ctx, key, val)
+}
+
 type logContextKey struct{}
 
 // WithLogger returns a context with the given logger set.
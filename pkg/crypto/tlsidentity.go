@@ -0,0 +1,109 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crypto
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// CertIdentityField is the field of a certificate that identifies its holder.
+type CertIdentityField string
+
+const (
+	// CertIdentityCN derives the identity from the subject common name.
+	CertIdentityCN CertIdentityField = "cn"
+	// CertIdentityDNSSAN derives the identity from the first DNS subject
+	// alternative name.
+	CertIdentityDNSSAN CertIdentityField = "dns-san"
+	// CertIdentityURISAN derives the identity from the final path segment of
+	// the first URI subject alternative name, e.g. "node-1" for
+	// "spiffe://example.com/nodes/node-1". URIs without a path use the host.
+	CertIdentityURISAN CertIdentityField = "uri-san"
+)
+
+// DefaultCertIdentityField is the default certificate identity field.
+const DefaultCertIdentityField = CertIdentityCN
+
+// ErrNoCertIdentity is returned when a certificate does not carry an
+// identity in the requested field.
+var ErrNoCertIdentity = errors.New("no identity in certificate")
+
+// CertIdentityFields returns the supported certificate identity fields.
+func CertIdentityFields() []CertIdentityField {
+	return []CertIdentityField{CertIdentityCN, CertIdentityDNSSAN, CertIdentityURISAN}
+}
+
+// ParseCertIdentityField parses a certificate identity field as given in
+// configuration. It is case-insensitive, and an empty string parses to
+// DefaultCertIdentityField.
+func ParseCertIdentityField(s string) (CertIdentityField, error) {
+	field := CertIdentityField(strings.ToLower(strings.TrimSpace(s)))
+	if field == "" {
+		return DefaultCertIdentityField, nil
+	}
+	if !field.IsValid() {
+		return "", fmt.Errorf("invalid certificate identity field %q, must be one of %v", s, CertIdentityFields())
+	}
+	return field, nil
+}
+
+// IsValid returns true if the field is a supported identity field.
+func (f CertIdentityField) IsValid() bool {
+	switch f {
+	case CertIdentityCN, CertIdentityDNSSAN, CertIdentityURISAN:
+		return true
+	}
+	return false
+}
+
+// String returns the string representation of the field.
+func (f CertIdentityField) String() string { return string(f) }
+
+// IdentityFromCert returns the identity held in the given field of the
+// certificate. An empty field uses DefaultCertIdentityField.
+func IdentityFromCert(cert *x509.Certificate, field CertIdentityField) (string, error) {
+	if field == "" {
+		field = DefaultCertIdentityField
+	}
+	var id string
+	switch field {
+	case CertIdentityCN:
+		id = cert.Subject.CommonName
+	case CertIdentityDNSSAN:
+		if len(cert.DNSNames) > 0 {
+			id = cert.DNSNames[0]
+		}
+	case CertIdentityURISAN:
+		if len(cert.URIs) > 0 {
+			uri := cert.URIs[0]
+			id = path.Base(strings.TrimSuffix(uri.Path, "/"))
+			if id == "." || id == "/" {
+				id = uri.Host
+			}
+		}
+	default:
+		return "", fmt.Errorf("unsupported certificate identity field %q", field)
+	}
+	if id == "" {
+		return "", fmt.Errorf("%w: %s is empty", ErrNoCertIdentity, field)
+	}
+	return id, nil
+}
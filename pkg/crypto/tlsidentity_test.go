@@ -0,0 +1,133 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseCertIdentityField(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		in      string
+		want    CertIdentityField
+		wantErr bool
+	}{
+		{in: "", want: CertIdentityCN},
+		{in: "cn", want: CertIdentityCN},
+		{in: "DNS-SAN", want: CertIdentityDNSSAN},
+		{in: " Uri-San ", want: CertIdentityURISAN},
+		{in: "email", wantErr: true},
+	}
+	for _, tt := range tc {
+		got, err := ParseCertIdentityField(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parse %q: unexpected error %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Fatalf("parse %q: expected %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestIdentityFromCert(t *testing.T) {
+	t.Parallel()
+
+	full := newIdentityCert(t, "cn-node", []string{"dns-node", "other-node"}, "spiffe://example.com/nodes/uri-node")
+	uriOnly := newIdentityCert(t, "", nil, "spiffe://example.com/nodes/uri-node/")
+	hostOnly := newIdentityCert(t, "", nil, "webmesh://host-node")
+	tc := []struct {
+		name   string
+		cert   *x509.Certificate
+		field  CertIdentityField
+		want   string
+		noneOK bool
+	}{
+		{name: "Default", cert: full, field: "", want: "cn-node"},
+		{name: "CN", cert: full, field: CertIdentityCN, want: "cn-node"},
+		{name: "DNSSAN", cert: full, field: CertIdentityDNSSAN, want: "dns-node"},
+		{name: "URISAN", cert: full, field: CertIdentityURISAN, want: "uri-node"},
+		{name: "URISANOnly", cert: uriOnly, field: CertIdentityURISAN, want: "uri-node"},
+		{name: "URISANHost", cert: hostOnly, field: CertIdentityURISAN, want: "host-node"},
+		{name: "MissingCN", cert: uriOnly, field: CertIdentityCN, noneOK: true},
+		{name: "MissingDNSSAN", cert: uriOnly, field: CertIdentityDNSSAN, noneOK: true},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			id, err := IdentityFromCert(tt.cert, tt.field)
+			if tt.noneOK {
+				if !errors.Is(err, ErrNoCertIdentity) {
+					t.Fatalf("expected ErrNoCertIdentity, got %q, %v", id, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("identity from cert: %v", err)
+			}
+			if id != tt.want {
+				t.Fatalf("expected identity %q, got %q", tt.want, id)
+			}
+		})
+	}
+
+	t.Run("UnsupportedField", func(t *testing.T) {
+		t.Parallel()
+		if _, err := IdentityFromCert(full, "serial"); err == nil {
+			t.Fatal("expected error for unsupported identity field")
+		}
+	})
+}
+
+func newIdentityCert(t *testing.T, cn string, dnsNames []string, uri string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		URIs:         []*url.URL{u},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
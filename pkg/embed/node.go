@@ -193,7 +193,7 @@ func (n *node) Start(ctx context.Context) error {
 	}
 	log.Info("Webmesh connection is ready")
 	// Start the mesh services
-	srvOpts, err := n.conf.Services.NewServiceOptions(ctx, n.MeshNode())
+	srvOpts, err := n.conf.NewServiceOptions(ctx, n.MeshNode())
 	if err != nil {
 		return handleErr(fmt.Errorf("failed to create service options: %w", err))
 	}
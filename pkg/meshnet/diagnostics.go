@@ -0,0 +1,214 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system/firewall"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// Report is a point-in-time snapshot of the network configuration of a node
+// meant to be attached to support requests. Sections that could not be
+// gathered are left empty and the reason is recorded in Errors.
+type Report struct {
+	// NodeID is the ID of the node the report is for.
+	NodeID types.NodeID `json:"nodeID"`
+	// GeneratedAt is when the report was gathered.
+	GeneratedAt time.Time `json:"generatedAt"`
+	// Interface is the configuration of the WireGuard interface.
+	Interface InterfaceReport `json:"interface"`
+	// Peers are the WireGuard peers sorted by ID.
+	Peers []PeerReport `json:"peers"`
+	// Routes are the destinations of the routes installed on the interface.
+	Routes []netip.Prefix `json:"routes"`
+	// DNS is the mesh DNS configuration.
+	DNS DNSReport `json:"dns"`
+	// Firewall is a summary of the firewall rules managed for the interface.
+	Firewall FirewallReport `json:"firewall"`
+	// Endpoints are the endpoints this node advertises to the mesh, starting
+	// with its primary endpoint, followed by any mapped with UPnP or NAT-PMP.
+	Endpoints []string `json:"endpoints"`
+	// Errors are the failures encountered while gathering the report.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// InterfaceReport is the configuration of the WireGuard interface.
+type InterfaceReport struct {
+	Name       string       `json:"name"`
+	PublicKey  string       `json:"publicKey"`
+	ListenPort int          `json:"listenPort"`
+	AddressV4  netip.Prefix `json:"addressV4"`
+	AddressV6  netip.Prefix `json:"addressV6"`
+	NetworkV4  netip.Prefix `json:"networkV4"`
+	NetworkV6  netip.Prefix `json:"networkV6"`
+}
+
+// PeerReport is the state of a single WireGuard peer.
+type PeerReport struct {
+	ID            string         `json:"id"`
+	PublicKey     string         `json:"publicKey"`
+	Endpoint      netip.AddrPort `json:"endpoint"`
+	AllowedIPs    []netip.Prefix `json:"allowedIPs"`
+	LastHandshake time.Time      `json:"lastHandshake"`
+	ReceiveBytes  uint64         `json:"receiveBytes"`
+	TransmitBytes uint64         `json:"transmitBytes"`
+}
+
+// DNSReport is the mesh DNS configuration of the node.
+type DNSReport struct {
+	// Servers are the configured mesh DNS servers and their health.
+	Servers []DNSServerStatus `json:"servers"`
+	// SearchDomains are the search domains added to the system.
+	SearchDomains []string `json:"searchDomains"`
+}
+
+// FirewallReport summarizes the firewall rules managed for the interface.
+type FirewallReport struct {
+	// Enabled is true if the firewall has been configured.
+	Enabled bool `json:"enabled"`
+	// DefaultPolicy is the default policy of the firewall.
+	DefaultPolicy firewall.Policy `json:"defaultPolicy"`
+	// Masquerading is true if outbound traffic is masqueraded.
+	Masquerading bool `json:"masquerading"`
+	// RouteCounters is the traffic counted for advertised routes, when supported.
+	RouteCounters []RouteTraffic `json:"routeCounters,omitempty"`
+}
+
+// Diagnostics gathers a report of the interface, peers, routes, DNS, firewall,
+// and endpoints of this node. Failures to gather individual sections do not
+// fail the report, they are recorded in its Errors.
+func (m *manager) Diagnostics(ctx context.Context) (Report, error) {
+	m.mu.Lock()
+	wg, fw, key, portmap, masquerading := m.wg, m.fw, m.key, m.portmap, m.masquerading
+	m.mu.Unlock()
+	if wg == nil {
+		return Report{}, errors.New("diagnostics called before wireguard interface is ready")
+	}
+	report := Report{
+		NodeID:      m.nodeID,
+		GeneratedAt: time.Now().UTC(),
+		Interface: InterfaceReport{
+			Name:      wg.Name(),
+			AddressV4: wg.AddressV4(),
+			AddressV6: wg.AddressV6(),
+			NetworkV4: m.NetworkV4(),
+			NetworkV6: m.NetworkV6(),
+		},
+	}
+	recordErr := func(section string, err error) {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", section, err))
+	}
+	if key != nil {
+		encoded, err := key.PublicKey().Encode()
+		if err != nil {
+			recordErr("public key", err)
+		}
+		report.Interface.PublicKey = encoded
+	}
+	port, err := wg.ListenPort()
+	if err != nil {
+		recordErr("listen port", err)
+	}
+	report.Interface.ListenPort = port
+
+	// Peers, with handshakes and transfer from the device when available.
+	stats := make(map[string]*v1.PeerMetrics)
+	metrics, err := wg.Metrics()
+	if err != nil {
+		recordErr("interface metrics", err)
+	} else {
+		for _, peer := range metrics.GetPeers() {
+			stats[peer.GetPublicKey()] = peer
+		}
+	}
+	for _, peer := range wg.Peers() {
+		pr := PeerReport{
+			ID:         peer.ID,
+			Endpoint:   peer.Endpoint,
+			AllowedIPs: peer.AllowedIPs,
+		}
+		if peer.PublicKey != nil {
+			pr.PublicKey, _ = peer.PublicKey.Encode()
+			if st, ok := stats[peer.PublicKey.WireGuardKey().String()]; ok {
+				pr.LastHandshake, _ = time.Parse(time.RFC3339, st.GetLastHandshakeTime())
+				pr.ReceiveBytes = st.GetReceiveBytes()
+				pr.TransmitBytes = st.GetTransmitBytes()
+			}
+		}
+		report.Peers = append(report.Peers, pr)
+	}
+	sort.Slice(report.Peers, func(i, j int) bool {
+		return report.Peers[i].ID < report.Peers[j].ID
+	})
+
+	report.Routes, err = m.Routes(ctx)
+	if err != nil {
+		recordErr("routes", err)
+	}
+
+	report.DNS.Servers = m.DNSServerStatus()
+	if m.dns != nil {
+		m.dns.mu.RLock()
+		report.DNS.SearchDomains = slices.Clone(m.dns.searchdomains)
+		m.dns.mu.RUnlock()
+	}
+
+	report.Firewall = FirewallReport{
+		Enabled:       fw != nil,
+		DefaultPolicy: m.opts.FirewallDefaultPolicy,
+		Masquerading:  masquerading,
+	}
+	if fw != nil {
+		report.Firewall.RouteCounters, err = m.RouteTraffic(ctx)
+		if err != nil && !errors.Is(err, ErrRouteAccountingUnsupported) {
+			recordErr("route counters", err)
+		}
+	}
+
+	addEndpoint := func(ep string) {
+		if ep != "" && !slices.Contains(report.Endpoints, ep) {
+			report.Endpoints = append(report.Endpoints, ep)
+		}
+	}
+	if m.storage != nil {
+		self, err := m.storage.Peers().Get(ctx, m.nodeID)
+		if err != nil {
+			recordErr("endpoints", err)
+		} else {
+			addEndpoint(self.GetPrimaryEndpoint())
+			for _, ep := range self.GetWireguardEndpoints() {
+				addEndpoint(ep)
+			}
+		}
+	}
+	if portmap != nil {
+		if ext := portmap.external(); ext.IsValid() {
+			addEndpoint(ext.String())
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"encoding/json"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestDiagnostics(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	m := &manager{nodeID: "node"}
+	if _, err := m.Diagnostics(ctx); err == nil {
+		t.Fatal("expected error gathering diagnostics before start")
+	}
+
+	db := meshdb.NewTestDB()
+	defer db.Close()
+	err := db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+		Id:                 "node",
+		PublicKey:          mustGeneratePublicKey(t),
+		PrimaryEndpoint:    "203.0.113.1",
+		WireguardEndpoints: []string{"203.0.113.1:51820"},
+	}})
+	if err != nil {
+		t.Fatalf("put node: %v", err)
+	}
+	peerKey := crypto.MustGenerateKey().PublicKey()
+	handshake := time.Now().UTC().Truncate(time.Second)
+	iface := &diagnosticsInterface{
+		routeInterface: routeInterface{routes: []netip.Prefix{netip.MustParsePrefix("172.16.0.0/12")}},
+		peers: map[string]wireguard.Peer{
+			"peer": {
+				ID:         "peer",
+				PublicKey:  peerKey,
+				Endpoint:   netip.MustParseAddrPort("203.0.113.2:51820"),
+				AllowedIPs: []netip.Prefix{netip.MustParsePrefix("172.16.0.2/32")},
+			},
+		},
+		metrics: &v1.InterfaceMetrics{Peers: []*v1.PeerMetrics{{
+			PublicKey:         peerKey.WireGuardKey().String(),
+			LastHandshakeTime: handshake.Format(time.RFC3339),
+			ReceiveBytes:      100,
+			TransmitBytes:     200,
+		}}},
+	}
+	m = &manager{
+		nodeID:       "node",
+		storage:      db,
+		key:          crypto.MustGenerateKey(),
+		wg:           iface,
+		fw:           &masqFirewall{rules: make(map[string]int)},
+		masquerading: true,
+		networkv4:    netip.MustParsePrefix("172.16.0.0/12"),
+		dns: &dnsManager{
+			dnsservers:    []netip.AddrPort{netip.MustParseAddrPort("172.16.0.1:53")},
+			searchdomains: []string{"webmesh.internal"},
+		},
+	}
+	report, err := m.Diagnostics(ctx)
+	if err != nil {
+		t.Fatalf("diagnostics: %v", err)
+	}
+	if len(report.Errors) != 0 {
+		t.Fatalf("expected no errors, got %v", report.Errors)
+	}
+	if report.NodeID != "node" || report.Interface.Name != "webmesh0" || report.Interface.ListenPort != 51820 {
+		t.Errorf("unexpected interface section: %+v", report.Interface)
+	}
+	if report.Interface.PublicKey == "" {
+		t.Error("expected the interface public key to be reported")
+	}
+	if report.Interface.NetworkV4 != m.networkv4 {
+		t.Errorf("expected network %s, got %s", m.networkv4, report.Interface.NetworkV4)
+	}
+	if len(report.Peers) != 1 {
+		t.Fatalf("expected a single peer, got %+v", report.Peers)
+	}
+	peer := report.Peers[0]
+	if peer.ID != "peer" || !peer.LastHandshake.Equal(handshake) || peer.ReceiveBytes != 100 || peer.TransmitBytes != 200 {
+		t.Errorf("unexpected peer section: %+v", peer)
+	}
+	if !slices.Equal(report.Routes, iface.routes) {
+		t.Errorf("expected routes %v, got %v", iface.routes, report.Routes)
+	}
+	if len(report.DNS.Servers) != 1 || !slices.Equal(report.DNS.SearchDomains, []string{"webmesh.internal"}) {
+		t.Errorf("unexpected DNS section: %+v", report.DNS)
+	}
+	if !report.Firewall.Enabled || !report.Firewall.Masquerading {
+		t.Errorf("unexpected firewall section: %+v", report.Firewall)
+	}
+	if want := []string{"203.0.113.1", "203.0.113.1:51820"}; !slices.Equal(report.Endpoints, want) {
+		t.Errorf("expected endpoints %v, got %v", want, report.Endpoints)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("marshal report: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal report: %v", err)
+	}
+	if decoded.Peers[0].Endpoint != peer.Endpoint || !slices.Equal(decoded.Routes, report.Routes) {
+		t.Errorf("report did not round trip through JSON: %s", data)
+	}
+}
+
+type diagnosticsInterface struct {
+	routeInterface
+	peers   map[string]wireguard.Peer
+	metrics *v1.InterfaceMetrics
+}
+
+func (d *diagnosticsInterface) Name() string { return "webmesh0" }
+
+func (d *diagnosticsInterface) AddressV4() netip.Prefix {
+	return netip.MustParsePrefix("172.16.0.1/32")
+}
+
+func (d *diagnosticsInterface) AddressV6() netip.Prefix { return netip.Prefix{} }
+
+func (d *diagnosticsInterface) ListenPort() (int, error) { return 51820, nil }
+
+func (d *diagnosticsInterface) Peers() map[string]wireguard.Peer { return d.peers }
+
+func (d *diagnosticsInterface) Metrics() (*v1.InterfaceMetrics, error) { return d.metrics, nil }
@@ -19,9 +19,12 @@ package meshnet
 import (
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
 	"net/netip"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	v1 "github.com/webmeshproj/api/go/v1"
 
@@ -51,32 +54,105 @@ type dnsManager struct {
 	dnsservers     []netip.AddrPort
 	searchdomains  []string
 	noIPv4, noIPv6 bool
-	mu             sync.RWMutex
+	health         map[netip.AddrPort]DNSServerStatus
+	probe          dnsProbeFunc
+	// forwarders are the configured conditional forwarders by domain.
+	forwarders map[string]string
+	// forwarding are the servers of the conditional forwarders currently
+	// applied to the system by domain.
+	forwarding          map[string]netip.AddrPort
+	setDomainServers    func(iface, domain string, servers []netip.AddrPort) error
+	removeDomainServers func(iface, domain string) error
+	// cache caches lookups made through Resolver when enabled.
+	cache *dnsCache
+	// rotation selects the server resolvers start with.
+	rotation atomic.Uint64
+	mu       sync.RWMutex
+}
+
+// ifaceName returns the name of the interface DNS is configured for.
+func (d *dnsManager) ifaceName() string {
+	if d.wg == nil {
+		return ""
+	}
+	return d.wg.Name()
 }
 
 // Resolver returns a net.Resolver that can be used to resolve DNS names.
+// Names in the domain of a conditional forwarder are resolved by its server.
+// Other names are resolved by the mesh DNS servers, which are tried in turn
+// starting from a different server on every call to spread the load.
 func (d *dnsManager) Resolver() *net.Resolver {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
+	var servers []string
 	if d.localdnsaddr.IsValid() {
-		return &net.Resolver{
-			PreferGo: true,
-			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-				return (&net.Dialer{}).DialContext(ctx, network, d.localdnsaddr.String())
-			},
+		servers = []string{d.localdnsaddr.String()}
+	} else if healthy := d.healthyServers(d.enabledServers()); len(healthy) > 0 {
+		start := int(d.rotation.Add(1) % uint64(len(healthy)))
+		for i := range healthy {
+			servers = append(servers, healthy[(start+i)%len(healthy)].String())
 		}
-	}
-	if len(d.dnsservers) == 0 {
+	} else if len(d.forwarding) == 0 {
 		return net.DefaultResolver
 	}
+	fallback := func(address string) []string {
+		if len(servers) > 0 {
+			return servers
+		}
+		return []string{address}
+	}
+	var dial dnsDialFunc
+	if len(d.forwarding) == 0 && len(servers) == 1 {
+		dial = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, servers[0])
+		}
+	} else {
+		var route func(string) (netip.AddrPort, bool)
+		if len(d.forwarding) > 0 {
+			forwarding := maps.Clone(d.forwarding)
+			route = func(name string) (netip.AddrPort, bool) {
+				return matchForwarder(forwarding, name)
+			}
+		}
+		dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			return newForwardingConn(ctx, network, fallback(address), route), nil
+		}
+	}
+	if d.cache != nil {
+		dial = d.cache.dial(dial)
+	}
 	return &net.Resolver{
 		PreferGo: true,
-		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-			return (&net.Dialer{}).DialContext(ctx, network, d.dnsservers[0].String())
-		},
+		Dial:     dial,
+	}
+}
+
+// invalidateCache drops cached lookups after the servers they were
+// resolved with changed.
+func (d *dnsManager) invalidateCache() {
+	if d.cache != nil {
+		d.cache.purge()
 	}
 }
 
+// enabledServers returns the configured DNS servers that belong to an
+// enabled address family. The caller must hold the lock.
+func (d *dnsManager) enabledServers() []netip.AddrPort {
+	servers := make([]netip.AddrPort, 0, len(d.dnsservers))
+	for _, server := range d.dnsservers {
+		addr := server.Addr().Unmap()
+		if addr.Is4() && d.noIPv4 {
+			continue
+		}
+		if addr.Is6() && d.noIPv6 {
+			continue
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
+
 // AddServers adds the given dns servers to the system configuration.
 func (m *dnsManager) AddServers(ctx context.Context, servers []netip.AddrPort) error {
 	m.mu.Lock()
@@ -87,6 +163,7 @@ func (m *dnsManager) AddServers(ctx context.Context, servers []netip.AddrPort) e
 		return fmt.Errorf("add dns servers: %w", err)
 	}
 	m.dnsservers = append(m.dnsservers, servers...)
+	m.invalidateCache()
 	return nil
 }
 
@@ -109,15 +186,13 @@ func (m *dnsManager) RefreshServers(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	context.LoggerFrom(ctx).Debug("Refreshing MeshDNS servers")
-	servers, err := m.storage.Peers().List(ctx, storage.FilterByFeature(v1.Feature_MESH_DNS))
+	servers, err := m.meshDNSServers(ctx)
 	if err != nil {
-		return fmt.Errorf("list peers with feature: %w", err)
+		return err
 	}
 	seen := make(map[netip.AddrPort]bool)
 	for _, server := range servers {
-		if server.PrivateDNSAddrV4().IsValid() && !m.noIPv4 {
-			seen[server.PrivateDNSAddrV4()] = true
-		}
+		seen[server] = true
 	}
 	// Find out which (if any) DNS servers we are removing
 	toRemove := make([]netip.AddrPort, 0)
@@ -149,6 +224,9 @@ func (m *dnsManager) RefreshServers(ctx context.Context) error {
 			return fmt.Errorf("add dns servers: %w", err)
 		}
 	}
+	if len(toAdd) > 0 || len(toRemove) > 0 {
+		m.invalidateCache()
+	}
 	// Remove the old servers
 	if len(toRemove) > 0 {
 		err := dns.RemoveServers(m.wg.Name(), toRemove)
@@ -156,5 +234,47 @@ func (m *dnsManager) RefreshServers(ctx context.Context) error {
 			return fmt.Errorf("remove dns servers: %w", err)
 		}
 	}
+	if err := m.syncForwarders(ctx); err != nil {
+		return fmt.Errorf("sync conditional forwarders: %w", err)
+	}
 	return nil
 }
+
+// meshDNSServers returns the addresses of the peers in the database that
+// are offering mesh DNS.
+func (m *dnsManager) meshDNSServers(ctx context.Context) ([]netip.AddrPort, error) {
+	peers, err := m.storage.Peers().List(ctx, storage.FilterByFeature(v1.Feature_MESH_DNS))
+	if err != nil {
+		return nil, fmt.Errorf("list peers with feature: %w", err)
+	}
+	servers := make([]netip.AddrPort, 0, len(peers))
+	for _, peer := range peers {
+		if peer.PrivateDNSAddrV4().IsValid() && !m.noIPv4 {
+			servers = append(servers, peer.PrivateDNSAddrV4())
+		}
+	}
+	return servers, nil
+}
+
+// serversInSync returns true if the configured DNS servers match the peers
+// currently offering mesh DNS.
+func (m *dnsManager) serversInSync(ctx context.Context) (bool, error) {
+	servers, err := m.meshDNSServers(ctx)
+	if err != nil {
+		return false, err
+	}
+	slices.SortFunc(servers, compareAddrPorts)
+	servers = slices.Compact(servers)
+	m.mu.RLock()
+	current := slices.Clone(m.dnsservers)
+	m.mu.RUnlock()
+	slices.SortFunc(current, compareAddrPorts)
+	return slices.Equal(servers, current), nil
+}
+
+func compareAddrPorts(a, b netip.AddrPort) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return int(a.Port()) - int(b.Port())
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	mdns "github.com/miekg/dns"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// dnsDialFunc dials a DNS server for a net.Resolver.
+type dnsDialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+type dnsCacheKey struct {
+	qname  string
+	qtype  uint16
+	qclass uint16
+}
+
+type dnsCacheValue struct {
+	msg     *mdns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// dnsCache caches responses to lookups made through the resolver returned
+// by the DNS manager. Answers are kept for their TTL, and NXDOMAIN and empty
+// answers for the negative TTL from the SOA in the authority section.
+type dnsCache struct {
+	cache *lru.Cache[dnsCacheKey, dnsCacheValue]
+	now   func() time.Time
+}
+
+func newDNSCache(size int) (*dnsCache, error) {
+	cache, err := lru.New[dnsCacheKey, dnsCacheValue](size)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsCache{cache: cache, now: time.Now}, nil
+}
+
+func newDNSCacheKey(q mdns.Question) dnsCacheKey {
+	return dnsCacheKey{qname: strings.ToLower(q.Name), qtype: q.Qtype, qclass: q.Qclass}
+}
+
+// get returns a cached response to the question of the given query. The
+// response has the ID of the query and TTLs reduced by the time it was cached.
+func (c *dnsCache) get(query *mdns.Msg) (*mdns.Msg, bool) {
+	if len(query.Question) != 1 {
+		return nil, false
+	}
+	key := newDNSCacheKey(query.Question[0])
+	val, ok := c.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	now := c.now()
+	if !now.Before(val.expires) {
+		c.cache.Remove(key)
+		return nil, false
+	}
+	elapsed := uint32(now.Sub(val.stored) / time.Second)
+	resp := val.msg.Copy()
+	resp.Id = query.Id
+	for _, section := range [][]mdns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == mdns.TypeOPT {
+				continue
+			}
+			if rr.Header().Ttl > elapsed {
+				rr.Header().Ttl -= elapsed
+			} else {
+				rr.Header().Ttl = 0
+			}
+		}
+	}
+	return resp, true
+}
+
+// put caches the response if it is cacheable.
+func (c *dnsCache) put(resp *mdns.Msg) {
+	if !resp.Response || resp.Truncated || len(resp.Question) != 1 {
+		return
+	}
+	ttl, ok := dnsCacheTTL(resp)
+	if !ok || ttl == 0 {
+		return
+	}
+	now := c.now()
+	c.cache.Add(newDNSCacheKey(resp.Question[0]), dnsCacheValue{
+		msg:     resp.Copy(),
+		stored:  now,
+		expires: now.Add(ttl),
+	})
+}
+
+// purge removes all cached responses.
+func (c *dnsCache) purge() {
+	c.cache.Purge()
+}
+
+// dnsCacheTTL returns how long a response may be cached for. Positive answers
+// use their lowest TTL. NXDOMAIN and empty answers use the lower of the TTL
+// and minimum field of the SOA in the authority section, as in RFC 2308, and
+// are not cached without one.
+func dnsCacheTTL(resp *mdns.Msg) (time.Duration, bool) {
+	switch {
+	case resp.Rcode == mdns.RcodeSuccess && len(resp.Answer) > 0:
+		ttl := resp.Answer[0].Header().Ttl
+		for _, rr := range resp.Answer[1:] {
+			ttl = min(ttl, rr.Header().Ttl)
+		}
+		return time.Duration(ttl) * time.Second, true
+	case resp.Rcode == mdns.RcodeSuccess, resp.Rcode == mdns.RcodeNameError:
+		for _, rr := range resp.Ns {
+			if soa, ok := rr.(*mdns.SOA); ok {
+				return time.Duration(min(soa.Hdr.Ttl, soa.Minttl)) * time.Second, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// dial wraps the given dial function to answer queries from the cache and
+// cache the responses of the server. Only packet connections are cached, the
+// resolver only falls back to streams for truncated responses.
+func (c *dnsCache) dial(dial dnsDialFunc) dnsDialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if !strings.HasPrefix(network, "udp") {
+			return dial(ctx, network, address)
+		}
+		return &cachingConn{ctx: ctx, network: network, address: address, dial: dial, cache: c}, nil
+	}
+}
+
+// cachingConn is a DNS packet connection that is only dialed when a query
+// cannot be answered from the cache.
+type cachingConn struct {
+	ctx       context.Context
+	network   string
+	address   string
+	dial      dnsDialFunc
+	cache     *dnsCache
+	conn      net.Conn
+	pending   []byte
+	rdeadline time.Time
+	wdeadline time.Time
+	mu        sync.Mutex
+}
+
+func (c *cachingConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var query mdns.Msg
+	if err := query.Unpack(b); err == nil {
+		if resp, ok := c.cache.get(&query); ok {
+			packed, err := resp.Pack()
+			if err == nil {
+				c.pending = packed
+				return len(b), nil
+			}
+		}
+	}
+	if c.conn == nil {
+		conn, err := c.dial(c.ctx, c.network, c.address)
+		if err != nil {
+			return 0, err
+		}
+		if err := conn.SetReadDeadline(c.rdeadline); err != nil {
+			conn.Close()
+			return 0, err
+		}
+		if err := conn.SetWriteDeadline(c.wdeadline); err != nil {
+			conn.Close()
+			return 0, err
+		}
+		c.conn = conn
+	}
+	return c.conn.Write(b)
+}
+
+func (c *cachingConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	if c.pending != nil {
+		n := copy(b, c.pending)
+		c.pending = nil
+		c.mu.Unlock()
+		return n, nil
+	}
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return 0, net.ErrClosed
+	}
+	n, err := conn.Read(b)
+	if err == nil {
+		var resp mdns.Msg
+		if resp.Unpack(b[:n]) == nil {
+			c.cache.put(&resp)
+		}
+	}
+	return n, err
+}
+
+func (c *cachingConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Read(b)
+	return n, c.RemoteAddr(), err
+}
+
+func (c *cachingConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	return c.Write(b)
+}
+
+func (c *cachingConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *cachingConn) LocalAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.LocalAddr()
+}
+
+func (c *cachingConn) RemoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.RemoteAddr()
+}
+
+func (c *cachingConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rdeadline, c.wdeadline = t, t
+	if c.conn != nil {
+		return c.conn.SetDeadline(t)
+	}
+	return nil
+}
+
+func (c *cachingConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rdeadline = t
+	if c.conn != nil {
+		return c.conn.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c *cachingConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.wdeadline = t
+	if c.conn != nil {
+		return c.conn.SetWriteDeadline(t)
+	}
+	return nil
+}
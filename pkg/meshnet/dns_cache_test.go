@@ -0,0 +1,150 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mdns "github.com/miekg/dns"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// countingDNSServer answers A queries for app.example.com and NXDOMAIN for
+// everything else, counting the queries it receives by name.
+type countingDNSServer struct {
+	queries map[string]int
+	mu      sync.Mutex
+}
+
+func (s *countingDNSServer) ServeDNS(w mdns.ResponseWriter, r *mdns.Msg) {
+	s.mu.Lock()
+	s.queries[strings.ToLower(r.Question[0].Name)]++
+	s.mu.Unlock()
+	m := new(mdns.Msg)
+	m.SetReply(r)
+	q := r.Question[0]
+	if q.Name == "app.example.com." && q.Qtype == mdns.TypeA {
+		m.Answer = append(m.Answer, &mdns.A{
+			Hdr: mdns.RR_Header{Name: q.Name, Rrtype: mdns.TypeA, Class: mdns.ClassINET, Ttl: 60},
+			A:   net.IPv4(10, 0, 0, 1),
+		})
+	} else {
+		m.Rcode = mdns.RcodeNameError
+		m.Ns = append(m.Ns, &mdns.SOA{
+			Hdr:    mdns.RR_Header{Name: "example.com.", Rrtype: mdns.TypeSOA, Class: mdns.ClassINET, Ttl: 300},
+			Ns:     "ns.example.com.",
+			Mbox:   "admin.example.com.",
+			Minttl: 30,
+		})
+	}
+	_ = w.WriteMsg(m)
+}
+
+func (s *countingDNSServer) count(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[name]
+}
+
+func TestDNSCache(t *testing.T) {
+	t.Parallel()
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	handler := &countingDNSServer{queries: map[string]int{}}
+	srv := &mdns.Server{PacketConn: pc, Handler: handler}
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	cache, err := newDNSCache(16)
+	if err != nil {
+		t.Fatalf("new dns cache: %v", err)
+	}
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	d := &dnsManager{
+		dnsservers: []netip.AddrPort{netip.MustParseAddrPort(pc.LocalAddr().String())},
+		cache:      cache,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lookup := func(name string) ([]net.IP, error) {
+		return d.Resolver().LookupIP(ctx, "ip4", name)
+	}
+
+	for i := 0; i < 3; i++ {
+		ips, err := lookup("app.example.com.")
+		if err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+		if len(ips) != 1 || !ips[0].Equal(net.IPv4(10, 0, 0, 1)) {
+			t.Fatalf("unexpected lookup result: %v", ips)
+		}
+	}
+	if got := handler.count("app.example.com."); got != 1 {
+		t.Fatalf("expected repeated lookups within the TTL to be cached, server got %d queries", got)
+	}
+
+	// NXDOMAIN is cached for the negative TTL of the zone.
+	for i := 0; i < 2; i++ {
+		if _, err := lookup("missing.example.com."); err == nil {
+			t.Fatal("expected lookup of a missing name to fail")
+		}
+	}
+	if got := handler.count("missing.example.com."); got != 1 {
+		t.Fatalf("expected NXDOMAIN to be cached, server got %d queries", got)
+	}
+	now = now.Add(31 * time.Second)
+	if _, err := lookup("missing.example.com."); err == nil {
+		t.Fatal("expected lookup of a missing name to fail")
+	}
+	if got := handler.count("missing.example.com."); got != 2 {
+		t.Fatalf("expected NXDOMAIN to expire after the negative TTL, server got %d queries", got)
+	}
+
+	// Cached answers are served with their remaining TTL and expire with it.
+	resp, ok := cache.get(&mdns.Msg{Question: []mdns.Question{{Name: "app.example.com.", Qtype: mdns.TypeA, Qclass: mdns.ClassINET}}})
+	if !ok {
+		t.Fatal("expected app.example.com to still be cached")
+	}
+	if ttl := resp.Answer[0].Header().Ttl; ttl != 29 {
+		t.Fatalf("expected remaining TTL of 29s, got %d", ttl)
+	}
+	now = now.Add(30 * time.Second)
+	if _, err := lookup("app.example.com."); err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if got := handler.count("app.example.com."); got != 2 {
+		t.Fatalf("expected the answer to expire after its TTL, server got %d queries", got)
+	}
+
+	// Changing the servers invalidates the cache.
+	d.invalidateCache()
+	if _, err := lookup("app.example.com."); err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if got := handler.count("app.example.com."); got != 3 {
+		t.Fatalf("expected a lookup after invalidation to reach the server, got %d queries", got)
+	}
+}
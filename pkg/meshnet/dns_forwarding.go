@@ -0,0 +1,322 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	mdns "github.com/miekg/dns"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system/dns"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// canonicalDomain returns the domain in lower case without a trailing dot.
+func canonicalDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(domain), ".")
+}
+
+// resolveForwarder resolves the target of a conditional forwarder. Targets
+// are either an address, with or without a port, or the ID of a node serving
+// mesh DNS.
+func (d *dnsManager) resolveForwarder(ctx context.Context, target string) (netip.AddrPort, error) {
+	if addr, err := netip.ParseAddrPort(target); err == nil {
+		return addr, nil
+	}
+	if addr, err := netip.ParseAddr(target); err == nil {
+		return netip.AddrPortFrom(addr, 53), nil
+	}
+	peer, err := d.storage.Peers().Get(ctx, types.NodeID(target))
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("get node %s: %w", target, err)
+	}
+	if addr := peer.PrivateDNSAddrV4(); addr.IsValid() && !d.noIPv4 {
+		return addr, nil
+	}
+	if addr := peer.PrivateDNSAddrV6(); addr.IsValid() && !d.noIPv6 {
+		return addr, nil
+	}
+	return netip.AddrPort{}, fmt.Errorf("node %s is not serving mesh DNS", target)
+}
+
+// syncForwarders resolves the conditional forwarders and configures the system
+// to send queries for their domains to the resolved servers. Only forwarders
+// whose server changed are applied. The caller must hold the lock.
+func (d *dnsManager) syncForwarders(ctx context.Context) error {
+	if len(d.forwarders) == 0 {
+		return nil
+	}
+	log := context.LoggerFrom(ctx)
+	setDomainServers := d.setDomainServers
+	if setDomainServers == nil {
+		setDomainServers = dns.SetDomainServers
+	}
+	if d.forwarding == nil {
+		d.forwarding = make(map[string]netip.AddrPort, len(d.forwarders))
+	}
+	var errs []error
+	for domain, target := range d.forwarders {
+		server, err := d.resolveForwarder(ctx, target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resolve forwarder for %s: %w", domain, err))
+			continue
+		}
+		if current, ok := d.forwarding[domain]; ok && current == server {
+			continue
+		}
+		log.Debug("Configuring conditional DNS forwarder", slog.String("domain", domain), slog.String("server", server.String()))
+		err = setDomainServers(d.ifaceName(), domain, []netip.AddrPort{server})
+		if err != nil {
+			if !errors.Is(err, dns.ErrDomainServersUnsupported) {
+				errs = append(errs, fmt.Errorf("set servers for %s: %w", domain, err))
+				continue
+			}
+			// Lookups made through our own resolver are still forwarded.
+			log.Warn("System DNS does not support conditional forwarding", slog.String("domain", domain))
+		}
+		d.forwarding[domain] = server
+		d.invalidateCache()
+	}
+	return errors.Join(errs...)
+}
+
+// removeForwarders removes the conditional forwarders from the system
+// configuration. The caller must hold the lock.
+func (d *dnsManager) removeForwarders() error {
+	removeDomainServers := d.removeDomainServers
+	if removeDomainServers == nil {
+		removeDomainServers = dns.RemoveDomainServers
+	}
+	var errs []error
+	for domain := range d.forwarding {
+		if err := removeDomainServers(d.ifaceName(), domain); err != nil {
+			errs = append(errs, fmt.Errorf("remove servers for %s: %w", domain, err))
+			continue
+		}
+		delete(d.forwarding, domain)
+		d.invalidateCache()
+	}
+	return errors.Join(errs...)
+}
+
+// matchForwarder returns the server of the conditional forwarder with the
+// longest domain matching the given name.
+func matchForwarder(forwarding map[string]netip.AddrPort, name string) (netip.AddrPort, bool) {
+	name = canonicalDomain(name)
+	var server netip.AddrPort
+	var match string
+	for domain, addr := range forwarding {
+		if name != domain && !strings.HasSuffix(name, "."+domain) {
+			continue
+		}
+		if len(domain) > len(match) {
+			match, server = domain, addr
+		}
+	}
+	return server, match != ""
+}
+
+// dnsFailoverTimeout is how long a DNS server is given to answer before the
+// query is sent to the next server.
+const dnsFailoverTimeout = time.Second
+
+// forwardingConn is a DNS connection that is only dialed on the first write,
+// once the question is known. Queries for the domain of a conditional
+// forwarder are sent to its server, all others to the fallback servers. The
+// fallback servers are tried in order, moving on to the next one when a server
+// cannot be dialed or does not answer within dnsFailoverTimeout.
+type forwardingConn struct {
+	ctx       context.Context
+	network   string
+	fallback  []string
+	route     func(name string) (netip.AddrPort, bool)
+	conn      net.Conn
+	servers   []string
+	query     []byte
+	rdeadline time.Time
+	wdeadline time.Time
+}
+
+// forwardingPacketConn is a forwardingConn for packet networks. The resolver
+// uses the type of the connection to decide how messages are framed.
+type forwardingPacketConn struct {
+	*forwardingConn
+}
+
+func newForwardingConn(ctx context.Context, network string, fallback []string, route func(string) (netip.AddrPort, bool)) net.Conn {
+	c := &forwardingConn{ctx: ctx, network: network, fallback: fallback, route: route}
+	if strings.HasPrefix(network, "udp") {
+		return &forwardingPacketConn{c}
+	}
+	return c
+}
+
+func (c *forwardingConn) Write(b []byte) (int, error) {
+	if c.conn == nil {
+		c.servers = c.serversFor(b)
+		if err := c.dial(); err != nil {
+			return 0, err
+		}
+	}
+	c.query = slices.Clone(b)
+	return c.conn.Write(b)
+}
+
+// serversFor returns the servers to send the question in the given message to.
+func (c *forwardingConn) serversFor(b []byte) []string {
+	if !strings.HasPrefix(c.network, "udp") && len(b) > 2 {
+		// Stream messages are prefixed with their length.
+		b = b[2:]
+	}
+	var msg mdns.Msg
+	if c.route != nil && msg.Unpack(b) == nil && len(msg.Question) > 0 {
+		if server, ok := c.route(msg.Question[0].Name); ok {
+			return []string{server.String()}
+		}
+	}
+	return slices.Clone(c.fallback)
+}
+
+// dial connects to the first of the remaining servers that can be dialed.
+func (c *forwardingConn) dial() error {
+	var errs []error
+	for len(c.servers) > 0 {
+		addr := c.servers[0]
+		c.servers = c.servers[1:]
+		conn, err := (&net.Dialer{}).DialContext(c.ctx, c.network, addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := conn.SetWriteDeadline(c.wdeadline); err != nil {
+			conn.Close()
+			return err
+		}
+		if err := conn.SetReadDeadline(c.readDeadline()); err != nil {
+			conn.Close()
+			return err
+		}
+		c.conn = conn
+		return nil
+	}
+	if len(errs) == 0 {
+		return errors.New("no dns servers available")
+	}
+	return errors.Join(errs...)
+}
+
+// readDeadline returns the read deadline for the current server. Servers are
+// only given dnsFailoverTimeout to answer while others remain to be tried.
+func (c *forwardingConn) readDeadline() time.Time {
+	if len(c.servers) == 0 {
+		return c.rdeadline
+	}
+	deadline := time.Now().Add(dnsFailoverTimeout)
+	if !c.rdeadline.IsZero() && c.rdeadline.Before(deadline) {
+		return c.rdeadline
+	}
+	return deadline
+}
+
+func (c *forwardingConn) Read(b []byte) (int, error) {
+	if c.conn == nil {
+		return 0, net.ErrClosed
+	}
+	for {
+		n, err := c.conn.Read(b)
+		if err == nil || len(c.servers) == 0 || c.query == nil {
+			return n, err
+		}
+		if !c.rdeadline.IsZero() && !time.Now().Before(c.rdeadline) {
+			return n, err
+		}
+		// Send the query to the next server.
+		c.conn.Close()
+		c.conn = nil
+		if err := c.dial(); err != nil {
+			return 0, err
+		}
+		if _, err := c.conn.Write(c.query); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (c *forwardingConn) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *forwardingConn) LocalAddr() net.Addr {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.LocalAddr()
+}
+
+func (c *forwardingConn) RemoteAddr() net.Addr {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.RemoteAddr()
+}
+
+func (c *forwardingConn) SetDeadline(t time.Time) error {
+	c.rdeadline, c.wdeadline = t, t
+	if c.conn != nil {
+		if err := c.conn.SetWriteDeadline(t); err != nil {
+			return err
+		}
+		return c.conn.SetReadDeadline(c.readDeadline())
+	}
+	return nil
+}
+
+func (c *forwardingConn) SetReadDeadline(t time.Time) error {
+	c.rdeadline = t
+	if c.conn != nil {
+		return c.conn.SetReadDeadline(c.readDeadline())
+	}
+	return nil
+}
+
+func (c *forwardingConn) SetWriteDeadline(t time.Time) error {
+	c.wdeadline = t
+	if c.conn != nil {
+		return c.conn.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+func (c *forwardingPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Read(b)
+	return n, c.RemoteAddr(), err
+}
+
+func (c *forwardingPacketConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	return c.Write(b)
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestConditionalForwarding(t *testing.T) {
+	t.Parallel()
+
+	t.Run("SystemConfig", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		db := meshdb.NewTestDB()
+		defer db.Close()
+		err := db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:          "corp-dns",
+			PublicKey:   mustGeneratePublicKey(t),
+			PrivateIPv4: "172.16.0.5/32",
+			Features:    []*v1.FeaturePort{{Feature: v1.Feature_MESH_DNS, Port: 5353}},
+		}})
+		if err != nil {
+			t.Fatalf("put peer: %v", err)
+		}
+		set := make(map[string][]netip.AddrPort)
+		var sets int
+		var removed []string
+		d := &dnsManager{
+			storage: db,
+			forwarders: map[string]string{
+				"corp.example.com": "corp-dns",
+				"lab.example.com":  "192.0.2.53",
+			},
+			setDomainServers: func(_ string, domain string, servers []netip.AddrPort) error {
+				set[domain] = servers
+				sets++
+				return nil
+			},
+			removeDomainServers: func(_ string, domain string) error {
+				removed = append(removed, domain)
+				return nil
+			},
+		}
+		if err := d.syncForwarders(ctx); err != nil {
+			t.Fatalf("sync forwarders: %v", err)
+		}
+		want := map[string]netip.AddrPort{
+			"corp.example.com": netip.MustParseAddrPort("172.16.0.5:5353"),
+			"lab.example.com":  netip.MustParseAddrPort("192.0.2.53:53"),
+		}
+		for domain, server := range want {
+			if !slices.Equal(set[domain], []netip.AddrPort{server}) {
+				t.Errorf("expected %s to be forwarded to %s, got %v", domain, server, set[domain])
+			}
+		}
+		// Unchanged forwarders are not applied again.
+		if err := d.syncForwarders(ctx); err != nil {
+			t.Fatalf("sync forwarders: %v", err)
+		}
+		if sets != 2 {
+			t.Errorf("expected forwarders to be applied once, got %d calls", sets)
+		}
+		// Unknown nodes are reported but do not block the other forwarders.
+		d.forwarders["missing.example.com"] = "missing-node"
+		if err := d.syncForwarders(ctx); err == nil {
+			t.Error("expected error resolving forwarder to unknown node")
+		}
+		if err := d.removeForwarders(); err != nil {
+			t.Fatalf("remove forwarders: %v", err)
+		}
+		slices.Sort(removed)
+		if !slices.Equal(removed, []string{"corp.example.com", "lab.example.com"}) {
+			t.Errorf("expected both forwarders to be removed, got %v", removed)
+		}
+	})
+
+	t.Run("Resolver", func(t *testing.T) {
+		t.Parallel()
+		resolve := func(d *dnsManager, name string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			// The lookup will fail since nothing answers, we only care about what was dialed.
+			_, _ = d.Resolver().LookupHost(ctx, name)
+		}
+		newManager := func() (d *dnsManager, general, designated *udpRecorder) {
+			general, generaladdr := listenUDPRecorder(t, "udp4", "127.0.0.1:0")
+			designated, designatedaddr := listenUDPRecorder(t, "udp4", "127.0.0.1:0")
+			d = &dnsManager{
+				dnsservers: []netip.AddrPort{generaladdr},
+				forwarding: map[string]netip.AddrPort{"corp.example.com": designatedaddr},
+			}
+			return
+		}
+
+		d, general, designated := newManager()
+		resolve(d, "host.corp.example.com")
+		if !designated.received() {
+			t.Error("expected query for the forwarded domain to go to the designated server")
+		}
+		if general.received() {
+			t.Error("expected query for the forwarded domain to skip the general server")
+		}
+
+		d, general, designated = newManager()
+		resolve(d, "host.example.org")
+		if designated.received() {
+			t.Error("expected other queries to skip the designated server")
+		}
+		if !general.received() {
+			t.Error("expected other queries to go to the general server")
+		}
+	})
+}
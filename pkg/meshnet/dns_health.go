@@ -0,0 +1,164 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+const (
+	// DefaultDNSHealthCheckInterval is the default interval at which
+	// configured mesh DNS servers are probed.
+	DefaultDNSHealthCheckInterval = 30 * time.Second
+	// dnsProbeTimeout is how long to wait for a DNS server to answer a probe.
+	dnsProbeTimeout = 2 * time.Second
+)
+
+// DNSServerHealthy tracks whether each configured mesh DNS server answered
+// its last health probe. Servers are labeled by the interface they were
+// configured for.
+var DNSServerHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "webmesh",
+	Name:      "dns_server_healthy",
+	Help:      "Whether a mesh DNS server answered its last health probe.",
+}, []string{"interface", "server"})
+
+// DNSServerStatus is the health of a configured DNS server.
+type DNSServerStatus struct {
+	// Server is the address of the DNS server.
+	Server netip.AddrPort
+	// Healthy is true if the server answered the last probe. Servers that
+	// have not been probed yet are considered healthy.
+	Healthy bool
+	// LastChecked is when the server was last probed.
+	LastChecked time.Time
+	// LastError is the error from the last probe, if any.
+	LastError string
+}
+
+// dnsProbeFunc checks whether a DNS server is answering queries.
+type dnsProbeFunc func(ctx context.Context, server netip.AddrPort) error
+
+// probeDNSServer sends a cheap query for the root name servers. Any answer,
+// including an error response, means the server is reachable.
+func probeDNSServer(ctx context.Context, server netip.AddrPort) error {
+	msg := new(dns.Msg)
+	msg.SetQuestion(".", dns.TypeNS)
+	client := &dns.Client{Net: "udp", Timeout: dnsProbeTimeout}
+	_, _, err := client.ExchangeContext(ctx, msg, server.String())
+	return err
+}
+
+// ServerStatus returns the health of the configured DNS servers.
+func (d *dnsManager) ServerStatus() []DNSServerStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	statuses := make([]DNSServerStatus, 0, len(d.dnsservers))
+	for _, server := range d.dnsservers {
+		status, ok := d.health[server]
+		if !ok {
+			status = DNSServerStatus{Server: server, Healthy: true}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// healthyServers returns the given servers that are not known to be unhealthy.
+// If every server is unhealthy they are all returned, so that lookups are still
+// attempted. The caller must hold the lock.
+func (d *dnsManager) healthyServers(servers []netip.AddrPort) []netip.AddrPort {
+	healthy := make([]netip.AddrPort, 0, len(servers))
+	for _, server := range servers {
+		if status, ok := d.health[server]; !ok || status.Healthy {
+			healthy = append(healthy, server)
+		}
+	}
+	if len(healthy) == 0 {
+		return servers
+	}
+	return healthy
+}
+
+// runHealthChecks periodically probes the configured DNS servers until the
+// context is canceled.
+func (d *dnsManager) runHealthChecks(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			d.checkServers(ctx)
+		}
+	}
+}
+
+// checkServers probes every configured DNS server and records the results.
+func (d *dnsManager) checkServers(ctx context.Context) {
+	log := context.LoggerFrom(ctx)
+	d.mu.RLock()
+	servers := append([]netip.AddrPort(nil), d.dnsservers...)
+	probe := d.probe
+	d.mu.RUnlock()
+	if probe == nil {
+		probe = probeDNSServer
+	}
+	results := make(map[netip.AddrPort]DNSServerStatus, len(servers))
+	for _, server := range servers {
+		status := DNSServerStatus{Server: server, Healthy: true, LastChecked: time.Now()}
+		if err := probe(ctx, server); err != nil {
+			status.Healthy = false
+			status.LastError = err.Error()
+		}
+		results[server] = status
+	}
+	iface := d.ifaceName()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for server := range d.health {
+		if _, ok := results[server]; !ok {
+			DNSServerHealthy.DeleteLabelValues(iface, server.String())
+		}
+	}
+	for server, status := range results {
+		prev, ok := d.health[server]
+		if status.Healthy {
+			DNSServerHealthy.WithLabelValues(iface, server.String()).Set(1)
+			if ok && !prev.Healthy {
+				log.Info("DNS server is healthy again", slog.String("server", server.String()))
+			}
+		} else {
+			DNSServerHealthy.WithLabelValues(iface, server.String()).Set(0)
+			if !ok || prev.Healthy {
+				log.Warn("DNS server failed health check",
+					slog.String("server", server.String()),
+					slog.String("error", status.LastError))
+			}
+		}
+	}
+	d.health = results
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	mdns "github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+func TestResolverAddressFamilies(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name           string
+		noIPv4, noIPv6 bool
+		wantV4, wantV6 bool
+	}{
+		{
+			name:   "DisableIPv4",
+			noIPv4: true,
+			wantV6: true,
+		},
+		{
+			name:   "DisableIPv6",
+			noIPv6: true,
+			wantV4: true,
+		},
+	}
+
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			v4, v4addr := listenUDPRecorder(t, "udp4", "127.0.0.1:0")
+			v6, v6addr := listenUDPRecorder(t, "udp6", "[::1]:0")
+			d := &dnsManager{
+				noIPv4: tt.noIPv4,
+				noIPv6: tt.noIPv6,
+				// Order both ways to make sure we don't just pick the first server.
+				dnsservers: func() []netip.AddrPort {
+					if tt.noIPv4 {
+						return []netip.AddrPort{v4addr, v6addr}
+					}
+					return []netip.AddrPort{v6addr, v4addr}
+				}(),
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			// The lookup will fail since nothing answers, we only care about what was dialed.
+			_, _ = d.Resolver().LookupHost(ctx, "example.com")
+			if got := v4.received(); got != tt.wantV4 {
+				t.Errorf("expected IPv4 server dialed = %v, got %v", tt.wantV4, got)
+			}
+			if got := v6.received(); got != tt.wantV6 {
+				t.Errorf("expected IPv6 server dialed = %v, got %v", tt.wantV6, got)
+			}
+		})
+	}
+
+	t.Run("NoCompatibleServers", func(t *testing.T) {
+		t.Parallel()
+		d := &dnsManager{
+			noIPv6:     true,
+			dnsservers: []netip.AddrPort{netip.MustParseAddrPort("[::1]:53")},
+		}
+		if d.Resolver() != net.DefaultResolver {
+			t.Error("expected default resolver when no servers match the enabled families")
+		}
+	})
+}
+
+func TestDNSServerHealth(t *testing.T) {
+	t.Parallel()
+	down, downaddr := listenUDPRecorder(t, "udp4", "127.0.0.1:0")
+	up, upaddr := listenUDPRecorder(t, "udp4", "127.0.0.1:0")
+	d := &dnsManager{
+		dnsservers: []netip.AddrPort{downaddr, upaddr},
+		probe: func(_ context.Context, server netip.AddrPort) error {
+			if server == downaddr {
+				return errors.New("i/o timeout")
+			}
+			return nil
+		},
+	}
+	// Unprobed servers are assumed healthy.
+	for _, status := range d.ServerStatus() {
+		if !status.Healthy {
+			t.Fatalf("expected %s to be healthy before probing", status.Server)
+		}
+	}
+	d.checkServers(context.Background())
+	for _, status := range d.ServerStatus() {
+		wantHealthy := status.Server == upaddr
+		if status.Healthy != wantHealthy {
+			t.Errorf("expected %s healthy = %v, got %v", status.Server, wantHealthy, status.Healthy)
+		}
+		if status.LastChecked.IsZero() {
+			t.Errorf("expected %s to record when it was checked", status.Server)
+		}
+		if !wantHealthy && status.LastError == "" {
+			t.Errorf("expected %s to record the probe error", status.Server)
+		}
+	}
+	if got := testutil.ToFloat64(DNSServerHealthy.WithLabelValues("", downaddr.String())); got != 0 {
+		t.Errorf("expected unhealthy metric for %s, got %v", downaddr, got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, _ = d.Resolver().LookupHost(ctx, "example.com")
+	if down.received() {
+		t.Error("expected resolver to skip the unhealthy server")
+	}
+	if !up.received() {
+		t.Error("expected resolver to use the healthy server")
+	}
+}
+
+func TestResolverFailover(t *testing.T) {
+	t.Parallel()
+	// A server that was shut down refuses queries outright.
+	dead, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	deadaddr := netip.MustParseAddrPort(dead.LocalAddr().String())
+	dead.Close()
+	// A server that never answers has to time out.
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = silent.Close() })
+	silentaddr := netip.MustParseAddrPort(silent.LocalAddr().String())
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	handler := &countingDNSServer{queries: map[string]int{}}
+	srv := &mdns.Server{PacketConn: pc, Handler: handler}
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	d := &dnsManager{
+		dnsservers: []netip.AddrPort{deadaddr, silentaddr, netip.MustParseAddrPort(pc.LocalAddr().String())},
+	}
+	// Every starting server must fail over to the one that answers.
+	for i := 0; i < len(d.dnsservers); i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ips, err := d.Resolver().LookupIP(ctx, "ip4", "app.example.com.")
+		cancel()
+		if err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+		if len(ips) != 1 || !ips[0].Equal(net.IPv4(10, 0, 0, 1)) {
+			t.Fatalf("lookup %d: unexpected answer %v", i, ips)
+		}
+	}
+	if got := handler.count("app.example.com."); got != len(d.dnsservers) {
+		t.Errorf("expected %d queries to reach the live server, got %d", len(d.dnsservers), got)
+	}
+}
+
+type udpRecorder struct {
+	got chan struct{}
+}
+
+func (u *udpRecorder) received() bool {
+	select {
+	case <-u.got:
+		return true
+	default:
+		return false
+	}
+}
+
+func listenUDPRecorder(t *testing.T, network, addr string) (*udpRecorder, netip.AddrPort) {
+	t.Helper()
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", addr, err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	rec := &udpRecorder{got: make(chan struct{})}
+	go func() {
+		buf := make([]byte, 1500)
+		if _, _, err := conn.ReadFrom(buf); err == nil {
+			close(rec.got)
+		}
+	}()
+	return rec, conn.LocalAddr().(*net.UDPAddr).AddrPort()
+}
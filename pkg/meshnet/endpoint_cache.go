@@ -0,0 +1,220 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+)
+
+// DefaultEndpointCacheTTL is the default time cached peer endpoints are trusted for.
+const DefaultEndpointCacheTTL = 24 * time.Hour
+
+// cachedPeer is the last known good configuration of a directly connected peer.
+type cachedPeer struct {
+	PublicKey       string         `json:"publicKey"`
+	Endpoint        netip.AddrPort `json:"endpoint"`
+	GRPCPort        int            `json:"grpcPort,omitempty"`
+	StorageProvider bool           `json:"storageProvider,omitempty"`
+	PrivateIPv4     netip.Prefix   `json:"privateIPv4"`
+	PrivateIPv6     netip.Prefix   `json:"privateIPv6"`
+	AllowedIPs      []netip.Prefix `json:"allowedIPs,omitempty"`
+	AllowedRoutes   []netip.Prefix `json:"allowedRoutes,omitempty"`
+	UpdatedAt       time.Time      `json:"updatedAt"`
+}
+
+// endpointCache persists the endpoints of directly connected peers so they
+// can be configured immediately on restart, before the store has caught up.
+// Endpoints of relayed peers are local proxies and are never cached.
+type endpointCache struct {
+	path  string
+	ttl   time.Duration
+	now   func() time.Time
+	peers map[string]cachedPeer
+	mu    sync.Mutex
+}
+
+func newEndpointCache(path string, ttl time.Duration) *endpointCache {
+	if ttl <= 0 {
+		ttl = DefaultEndpointCacheTTL
+	}
+	return &endpointCache{
+		path:  path,
+		ttl:   ttl,
+		now:   time.Now,
+		peers: make(map[string]cachedPeer),
+	}
+}
+
+// load reads the cache from disk, dropping any expired entries. A missing
+// file is not an error.
+func (c *endpointCache) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read endpoint cache: %w", err)
+	}
+	peers := make(map[string]cachedPeer)
+	if err := json.Unmarshal(data, &peers); err != nil {
+		return fmt.Errorf("decode endpoint cache: %w", err)
+	}
+	now := c.now()
+	for id, peer := range peers {
+		if now.Sub(peer.UpdatedAt) > c.ttl || !peer.Endpoint.IsValid() {
+			delete(peers, id)
+		}
+	}
+	c.peers = peers
+	return nil
+}
+
+// put records the configuration of a peer.
+func (c *endpointCache) put(peer *wireguard.Peer) error {
+	encoded, err := peer.PublicKey.Encode()
+	if err != nil {
+		return fmt.Errorf("encode peer key: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peers[peer.ID] = cachedPeer{
+		PublicKey:       encoded,
+		Endpoint:        peer.Endpoint,
+		GRPCPort:        peer.GRPCPort,
+		StorageProvider: peer.StorageProvider,
+		PrivateIPv4:     peer.PrivateIPv4,
+		PrivateIPv6:     peer.PrivateIPv6,
+		AllowedIPs:      peer.AllowedIPs,
+		AllowedRoutes:   peer.AllowedRoutes,
+		UpdatedAt:       c.now(),
+	}
+	return nil
+}
+
+// retain drops every peer not in the given set.
+func (c *endpointCache) retain(ids map[string]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id := range c.peers {
+		if _, ok := ids[id]; !ok {
+			delete(c.peers, id)
+		}
+	}
+}
+
+// save writes the cache to disk, replacing the previous file atomically.
+func (c *endpointCache) save() error {
+	c.mu.Lock()
+	data, err := json.Marshal(c.peers)
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode endpoint cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0750); err != nil {
+		return fmt.Errorf("create endpoint cache directory: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write endpoint cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("replace endpoint cache: %w", err)
+	}
+	return nil
+}
+
+// wireguardPeers returns the cached peers as wireguard peers.
+func (c *endpointCache) wireguardPeers() ([]*wireguard.Peer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	peers := make([]*wireguard.Peer, 0, len(c.peers))
+	var errs []error
+	for id, cached := range c.peers {
+		key, err := crypto.DecodePublicKey(cached.PublicKey)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("decode cached key for peer %s: %w", id, err))
+			continue
+		}
+		peers = append(peers, &wireguard.Peer{
+			ID:              id,
+			GRPCPort:        cached.GRPCPort,
+			StorageProvider: cached.StorageProvider,
+			PublicKey:       key,
+			Endpoint:        cached.Endpoint,
+			PrivateIPv4:     cached.PrivateIPv4,
+			PrivateIPv6:     cached.PrivateIPv6,
+			AllowedIPs:      cached.AllowedIPs,
+			AllowedRoutes:   cached.AllowedRoutes,
+		})
+	}
+	return peers, errors.Join(errs...)
+}
+
+// restoreCachedPeers configures the peers in the endpoint cache on the
+// interface. Later refreshes from the store replace them.
+func (m *peerManager) restoreCachedPeers(ctx context.Context) error {
+	if m.endpoints == nil {
+		return nil
+	}
+	m.peermu.Lock()
+	defer m.peermu.Unlock()
+	log := context.LoggerFrom(ctx)
+	if err := m.endpoints.load(); err != nil {
+		return err
+	}
+	peers, err := m.endpoints.wireguardPeers()
+	errs := []error{err}
+	for _, peer := range peers {
+		peer.PresharedKey = m.net.opts.PresharedKey
+		log.Debug("Restoring peer from endpoint cache", slog.String("peer", peer.ID), slog.String("endpoint", peer.Endpoint.String()))
+		if err := m.net.WireGuard().PutPeer(ctx, peer); err != nil {
+			errs = append(errs, fmt.Errorf("put cached peer %s: %w", peer.ID, err))
+			continue
+		}
+		if _, ok := m.added[peer.ID]; !ok {
+			m.added[peer.ID] = time.Now()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cacheEndpoint records the endpoint of a peer that was just configured if
+// it is connected to directly.
+func (m *peerManager) cacheEndpoint(ctx context.Context, peer *v1.WireGuardPeer, wgpeer *wireguard.Peer) {
+	if m.endpoints == nil || !wgpeer.Endpoint.IsValid() || peer.GetProto() != v1.ConnectProtocol_CONNECT_NATIVE {
+		return
+	}
+	if err := m.endpoints.put(wgpeer); err != nil {
+		context.LoggerFrom(ctx).Warn("Failed to cache peer endpoint", slog.String("peer", wgpeer.ID), slog.String("error", err.Error()))
+	}
+}
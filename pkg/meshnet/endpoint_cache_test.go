@@ -0,0 +1,141 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestEndpointCache(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	defer db.Close()
+	err := db.MeshState().SetMeshState(ctx, types.NetworkState{
+		NetworkState: &v1.NetworkState{
+			NetworkV4: "172.16.0.0/12",
+			NetworkV6: "2001:db8::/64",
+			Domain:    "example.com",
+		},
+	})
+	if err != nil {
+		t.Fatalf("set network state: %v", err)
+	}
+	err = db.Networking().PutNetworkACL(ctx, types.NetworkACL{NetworkACL: &v1.NetworkACL{
+		Name:             "allow-all",
+		Action:           v1.ACLAction_ACTION_ACCEPT,
+		SourceNodes:      []string{"*"},
+		DestinationNodes: []string{"*"},
+		SourceCIDRs:      []string{"*"},
+		DestinationCIDRs: []string{"*"},
+	}})
+	if err != nil {
+		t.Fatalf("create network ACL: %v", err)
+	}
+	peerKey := mustGeneratePublicKey(t)
+	putPeer := func(id, key, host string, i int) {
+		t.Helper()
+		err := db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:                 id,
+			PublicKey:          key,
+			PrimaryEndpoint:    host,
+			WireguardEndpoints: []string{host + ":51820"},
+			PrivateIPv4:        fmt.Sprintf("172.16.0.%d/32", i+1),
+			PrivateIPv6:        fmt.Sprintf("2001:db8::%d/128", i+1),
+		}})
+		if err != nil {
+			t.Fatalf("put peer: %v", err)
+		}
+	}
+	putPeer("node", mustGeneratePublicKey(t), "10.0.0.1", 0)
+	putPeer("a", peerKey, "10.0.0.2", 1)
+	err = db.Peers().PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{Source: "node", Target: "a"}})
+	if err != nil {
+		t.Fatalf("put edge: %v", err)
+	}
+
+	cacheFile := filepath.Join(t.TempDir(), "endpoints.json")
+	newManager := func() (*manager, *peerRecorder) {
+		wg := &peerRecorder{peers: make(map[string]wireguard.Peer)}
+		m := &manager{nodeID: "node", storage: db, wg: wg, opts: Options{
+			DisablePeerPing:   true,
+			EndpointCacheFile: cacheFile,
+		}}
+		m.peers = newPeerManager(m)
+		return m, wg
+	}
+
+	// The first run learns the endpoint from the store and caches it.
+	m, wg := newManager()
+	if err := m.peers.Sync(ctx); err != nil {
+		t.Fatalf("sync peers: %v", err)
+	}
+	if got := wg.peers["a"].Endpoint.String(); got != "10.0.0.2:51820" {
+		t.Fatalf("expected store-derived endpoint 10.0.0.2:51820, got %s", got)
+	}
+	if _, err := os.Stat(cacheFile); err != nil {
+		t.Fatalf("expected endpoint cache to be written: %v", err)
+	}
+
+	// The peer moves while we are down.
+	putPeer("a", peerKey, "10.0.0.3", 1)
+
+	// On restart the cached endpoint is configured before the store is consulted.
+	m, wg = newManager()
+	if err := m.peers.restoreCachedPeers(ctx); err != nil {
+		t.Fatalf("restore cached peers: %v", err)
+	}
+	peer, ok := wg.peers["a"]
+	if !ok {
+		t.Fatal("expected cached peer to be configured on restart")
+	}
+	if got := peer.Endpoint.String(); got != "10.0.0.2:51820" {
+		t.Fatalf("expected cached endpoint 10.0.0.2:51820, got %s", got)
+	}
+	if peer.PrivateIPv4.String() != "172.16.0.2/32" {
+		t.Fatalf("expected cached private address 172.16.0.2/32, got %s", peer.PrivateIPv4)
+	}
+
+	// Once the store has caught up the peer is reconciled.
+	if err := m.peers.Sync(ctx); err != nil {
+		t.Fatalf("sync peers: %v", err)
+	}
+	if got := wg.peers["a"].Endpoint.String(); got != "10.0.0.3:51820" {
+		t.Fatalf("expected reconciled endpoint 10.0.0.3:51820, got %s", got)
+	}
+
+	// Expired entries are ignored.
+	m, wg = newManager()
+	m.peers.endpoints.now = func() time.Time { return time.Now().Add(DefaultEndpointCacheTTL + time.Minute) }
+	if err := m.peers.restoreCachedPeers(ctx); err != nil {
+		t.Fatalf("restore cached peers: %v", err)
+	}
+	if len(wg.peers) != 0 {
+		t.Fatalf("expected expired cache entries to be ignored, got %v", wg.peers)
+	}
+}
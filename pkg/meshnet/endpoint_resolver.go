@@ -0,0 +1,176 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// DefaultEndpointResolveInterval is the default interval at which peer
+// endpoints given as hostnames are resolved again.
+const DefaultEndpointResolveInterval = 5 * time.Minute
+
+// ErrLinkLocalEndpoint is returned when a peer endpoint is a link-local IPv6
+// address without a zone and no interface is configured to use as its zone.
+var ErrLinkLocalEndpoint = errors.New("link-local endpoint without a zone")
+
+// hostnamePeer is a peer whose wireguard endpoint was resolved from a hostname.
+type hostnamePeer struct {
+	peer *v1.WireGuardPeer
+	// resolved is the address the hostname resolved to when the peer was
+	// last configured.
+	resolved netip.AddrPort
+}
+
+// isHostnameEndpoint returns true if the given endpoint names its host
+// by DNS name rather than by IP address.
+func isHostnameEndpoint(endpoint string) bool {
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil || host == "" {
+		return false
+	}
+	_, err = netip.ParseAddr(host)
+	return err != nil
+}
+
+// resolveEndpoint resolves the given UDP endpoint to an address and port.
+// Addresses of the preferred family are chosen when the endpoint has both.
+// Endpoints are underlay addresses, so the mesh address families that are
+// disabled on the interface do not restrict them. Link-local IPv6
+// endpoints without a zone are given the configured link-local endpoint
+// interface as their zone, or rejected with ErrLinkLocalEndpoint.
+func (m *peerManager) resolveEndpoint(endpoint string) (netip.AddrPort, error) {
+	var addr *net.UDPAddr
+	var errs []error
+	for _, network := range m.endpointNetworks() {
+		var err error
+		addr, err = m.resolveUDPAddr(network, endpoint)
+		if err == nil {
+			break
+		}
+		errs = append(errs, err)
+	}
+	if addr == nil {
+		return netip.AddrPort{}, errors.Join(errs...)
+	}
+	if ip := addr.AddrPort().Addr(); ip.Is6() && ip.IsLinkLocalUnicast() && ip.Zone() == "" {
+		zone := m.net.opts.LinkLocalEndpointInterface
+		if zone == "" {
+			return netip.AddrPort{}, fmt.Errorf("%w: %s", ErrLinkLocalEndpoint, endpoint)
+		}
+		addr.Zone = zone
+	}
+	if addr.AddrPort().Addr().Is4In6() {
+		// This is an IPv4 address masquerading as an IPv6 address.
+		// We need to convert it to a real IPv4 address.
+		// This is a workaround for a bug in Go's net package.
+		addr = &net.UDPAddr{
+			IP:   addr.IP.To4(),
+			Port: addr.Port,
+		}
+	}
+	return addr.AddrPort(), nil
+}
+
+// endpointNetworks returns the networks to resolve peer endpoints in, in
+// order of preference.
+func (m *peerManager) endpointNetworks() []string {
+	if m.net.opts.PreferIPv6 {
+		return []string{"udp6", "udp4"}
+	}
+	return []string{"udp4", "udp6"}
+}
+
+// trackHostnamePeer records the peer for re-resolution if its endpoint was resolved
+// from a hostname, and forgets it otherwise. Must be called with peermu held.
+func (m *peerManager) trackHostnamePeer(peer *v1.WireGuardPeer) {
+	id := peer.GetNode().GetId()
+	endpoint := peer.GetNode().GetPrimaryEndpoint()
+	direct := peer.GetProto() == v1.ConnectProtocol_CONNECT_NATIVE || m.isDirectOnly(id)
+	if !direct || !isHostnameEndpoint(endpoint) {
+		delete(m.hostnames, id)
+		return
+	}
+	resolved, err := m.resolveEndpoint(endpoint)
+	if err != nil {
+		delete(m.hostnames, id)
+		return
+	}
+	m.hostnames[id] = hostnamePeer{peer: peer, resolved: resolved}
+}
+
+// runEndpointResolver periodically resolves hostname endpoints of peers until
+// the context is canceled.
+func (m *peerManager) runEndpointResolver(ctx context.Context, interval time.Duration) {
+	log := context.LoggerFrom(ctx)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := m.resolveHostnameEndpoints(ctx); err != nil {
+				log.Warn("Error resolving peer endpoints", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// resolveHostnameEndpoints resolves the hostname endpoint of every tracked peer
+// and updates the peers whose address has changed.
+func (m *peerManager) resolveHostnameEndpoints(ctx context.Context) error {
+	m.peermu.Lock()
+	defer m.peermu.Unlock()
+	if m.net.WireGuard() == nil {
+		return errors.New("resolve endpoints called before wireguard interface is ready")
+	}
+	log := context.LoggerFrom(ctx)
+	errs := make([]error, 0)
+	for id, hp := range m.hostnames {
+		endpoint := hp.peer.GetNode().GetPrimaryEndpoint()
+		resolved, err := m.resolveEndpoint(endpoint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resolve endpoint for %s: %w", id, err))
+			continue
+		}
+		if resolved == hp.resolved {
+			continue
+		}
+		log.Info("Peer endpoint resolved to a new address, updating peer",
+			slog.String("peer_id", id),
+			slog.String("endpoint", endpoint),
+			slog.String("previous", hp.resolved.String()),
+			slog.String("current", resolved.String()))
+		if err := m.addPeer(ctx, hp.peer, nil); err != nil {
+			errs = append(errs, fmt.Errorf("update peer %s: %w", id, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+)
+
+func TestEndpointReResolution(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	records := map[string]string{"peer.example.com": "10.0.0.1"}
+	lookups := 0
+	resolve := func(network, address string) (*net.UDPAddr, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if ip, ok := records[host]; ok {
+			host = ip
+			lookups++
+		}
+		return net.ResolveUDPAddr(network, net.JoinHostPort(host, port))
+	}
+	setRecord := func(host, ip string) {
+		mu.Lock()
+		defer mu.Unlock()
+		records[host] = ip
+	}
+
+	wg := &peerRecorder{peers: make(map[string]wireguard.Peer)}
+	m := newPeerManager(&manager{opts: Options{DisablePeerPing: true}, wg: wg})
+	m.resolveUDPAddr = resolve
+	peers := []*v1.WireGuardPeer{
+		{
+			Node: &v1.MeshNode{
+				Id:              "hostname",
+				PublicKey:       mustGeneratePublicKey(t),
+				PrimaryEndpoint: "peer.example.com:51820",
+			},
+			Proto: v1.ConnectProtocol_CONNECT_NATIVE,
+		},
+		{
+			Node: &v1.MeshNode{
+				Id:              "address",
+				PublicKey:       mustGeneratePublicKey(t),
+				PrimaryEndpoint: "127.0.0.1:51820",
+			},
+			Proto: v1.ConnectProtocol_CONNECT_NATIVE,
+		},
+	}
+	if err := m.Refresh(ctx, peers); err != nil {
+		t.Fatalf("refresh peers: %v", err)
+	}
+	if got, want := wg.peers["hostname"].Endpoint, netip.MustParseAddrPort("10.0.0.1:51820"); got != want {
+		t.Fatalf("expected endpoint %s, got %s", want, got)
+	}
+	if _, ok := m.hostnames["address"]; ok {
+		t.Fatal("expected IP endpoints to not be tracked for re-resolution")
+	}
+
+	// Nothing changed, so the peer is left alone.
+	before := lookups
+	if err := m.resolveHostnameEndpoints(ctx); err != nil {
+		t.Fatalf("resolve endpoints: %v", err)
+	}
+	if lookups != before+1 {
+		t.Fatalf("expected a single lookup for an unchanged record, got %d", lookups-before)
+	}
+
+	// The record changes and the peer should follow it.
+	setRecord("peer.example.com", "10.0.0.2")
+	if err := m.resolveHostnameEndpoints(ctx); err != nil {
+		t.Fatalf("resolve endpoints: %v", err)
+	}
+	if got, want := wg.peers["hostname"].Endpoint, netip.MustParseAddrPort("10.0.0.2:51820"); got != want {
+		t.Fatalf("expected endpoint to be updated to %s, got %s", want, got)
+	}
+	if got, want := wg.peers["address"].Endpoint, netip.MustParseAddrPort("127.0.0.1:51820"); got != want {
+		t.Fatalf("expected endpoint %s to be unchanged, got %s", want, got)
+	}
+
+	// Removed peers are no longer resolved.
+	if err := m.Refresh(ctx, peers[1:]); err != nil {
+		t.Fatalf("refresh peers: %v", err)
+	}
+	if len(m.hostnames) != 0 {
+		t.Fatalf("expected no tracked hostname peers, got %d", len(m.hostnames))
+	}
+}
+
+func TestLinkLocalEndpoints(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name     string
+		iface    string
+		endpoint string
+		want     netip.AddrPort
+	}{
+		{
+			name:     "SkippedWithoutInterface",
+			endpoint: "[fe80::1]:51820",
+		},
+		{
+			name:     "ZoneFromInterface",
+			iface:    "eth0",
+			endpoint: "[fe80::1]:51820",
+			want:     netip.MustParseAddrPort("[fe80::1%eth0]:51820"),
+		},
+		{
+			name:     "ExplicitZoneKept",
+			iface:    "eth0",
+			endpoint: "[fe80::1%eth1]:51820",
+			want:     netip.MustParseAddrPort("[fe80::1%eth1]:51820"),
+		},
+		{
+			name:     "GlobalAddressUnchanged",
+			iface:    "eth0",
+			endpoint: "[2001:db8::1]:51820",
+			want:     netip.MustParseAddrPort("[2001:db8::1]:51820"),
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := newPeerManager(&manager{opts: Options{LinkLocalEndpointInterface: tt.iface}})
+			got, err := m.determinePeerEndpoint(context.Background(), &v1.WireGuardPeer{
+				Node: &v1.MeshNode{
+					Id:              "peer",
+					PrimaryEndpoint: tt.endpoint,
+				},
+				Proto: v1.ConnectProtocol_CONNECT_NATIVE,
+			}, nil)
+			if err != nil {
+				t.Fatalf("determine peer endpoint: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected endpoint %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEndpointAddressFamilies(t *testing.T) {
+	t.Parallel()
+	records := map[string][]string{
+		"dual.example.com": {"192.0.2.1", "2001:db8::1"},
+		"v4.example.com":   {"192.0.2.2"},
+		"v6.example.com":   {"2001:db8::2"},
+	}
+	resolve := func(network, address string) (*net.UDPAddr, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		ips, ok := records[host]
+		if !ok {
+			return net.ResolveUDPAddr(network, address)
+		}
+		for _, ip := range ips {
+			addr := netip.MustParseAddr(ip)
+			if network == "udp" || (network == "udp4") == addr.Is4() {
+				return net.ResolveUDPAddr(network, net.JoinHostPort(ip, port))
+			}
+		}
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+
+	tc := []struct {
+		name     string
+		opts     Options
+		endpoint string
+		want     netip.AddrPort
+		wantErr  bool
+	}{
+		{
+			name:     "PreferIPv4ByDefault",
+			endpoint: "dual.example.com:51820",
+			want:     netip.MustParseAddrPort("192.0.2.1:51820"),
+		},
+		{
+			name:     "PreferIPv6",
+			opts:     Options{PreferIPv6: true},
+			endpoint: "dual.example.com:51820",
+			want:     netip.MustParseAddrPort("[2001:db8::1]:51820"),
+		},
+		{
+			name:     "PreferIPv6FallsBackToIPv4",
+			opts:     Options{PreferIPv6: true},
+			endpoint: "v4.example.com:51820",
+			want:     netip.MustParseAddrPort("192.0.2.2:51820"),
+		},
+		{
+			name:     "IPv4FallsBackToIPv6",
+			endpoint: "v6.example.com:51820",
+			want:     netip.MustParseAddrPort("[2001:db8::2]:51820"),
+		},
+		{
+			name:     "DisableIPv4KeepsIPv4Endpoints",
+			opts:     Options{DisableIPv4: true},
+			endpoint: "dual.example.com:51820",
+			want:     netip.MustParseAddrPort("192.0.2.1:51820"),
+		},
+		{
+			name:     "DisableIPv6KeepsIPv6Endpoints",
+			opts:     Options{DisableIPv6: true, PreferIPv6: true},
+			endpoint: "dual.example.com:51820",
+			want:     netip.MustParseAddrPort("[2001:db8::1]:51820"),
+		},
+		{
+			name:     "OnlyDisabledMeshFamily",
+			opts:     Options{DisableIPv6: true},
+			endpoint: "v6.example.com:51820",
+			want:     netip.MustParseAddrPort("[2001:db8::2]:51820"),
+		},
+		{
+			name:     "AddressOfDisabledMeshFamily",
+			opts:     Options{DisableIPv4: true},
+			endpoint: "192.0.2.3:51820",
+			want:     netip.MustParseAddrPort("192.0.2.3:51820"),
+		},
+		{
+			name:     "Unresolvable",
+			endpoint: "missing.invalid:51820",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := newPeerManager(&manager{opts: tt.opts})
+			m.resolveUDPAddr = resolve
+			got, err := m.resolveEndpoint(tt.endpoint)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got endpoint %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolve endpoint: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected endpoint %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -33,31 +33,38 @@ import (
 // allowed. Currently if a single route provided by a destination node is not allowed, the entire node
 // is filtered out.
 func FilterGraph(ctx context.Context, db storage.MeshDB, thisNodeID types.NodeID) (types.AdjacencyMap, error) {
+	filtered, _, err := filterGraph(ctx, db, thisNodeID)
+	return filtered, err
+}
+
+// filterGraph is FilterGraph but also returns the expanded and sorted network ACLs
+// the graph was filtered with.
+func filterGraph(ctx context.Context, db storage.MeshDB, thisNodeID types.NodeID) (types.AdjacencyMap, types.NetworkACLs, error) {
 	log := context.LoggerFrom(ctx)
 	graph := db.Peers().Graph()
 
 	// Resolve the current node ID
 	thisNode, err := graph.Vertex(thisNodeID)
 	if err != nil {
-		return nil, fmt.Errorf("get node: %w", err)
+		return nil, nil, fmt.Errorf("get node: %w", err)
 	}
 
 	// Gather all the ACLs and the current adjacency map
 	acls, err := db.Networking().ListNetworkACLs(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("list network acls: %w", err)
+		return nil, nil, fmt.Errorf("list network acls: %w", err)
 	}
 	if len(acls) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 	err = storage.ExpandACLs(ctx, db.RBAC(), acls)
 	if err != nil {
-		return nil, fmt.Errorf("expand network acls: %w", err)
+		return nil, nil, fmt.Errorf("expand network acls: %w", err)
 	}
 	acls.Sort(types.SortDescending)
 	fullMap, err := types.NewAdjacencyMap(graph)
 	if err != nil {
-		return nil, fmt.Errorf("build adjacency map: %w", err)
+		return nil, nil, fmt.Errorf("build adjacency map: %w", err)
 	}
 	log.Debug("Full adjacency map", "from", thisNode.Id, "map", fullMap)
 
@@ -73,7 +80,7 @@ Nodes:
 		}
 		node, err := graph.Vertex(nodeID)
 		if err != nil {
-			return nil, fmt.Errorf("get node: %w", err)
+			return nil, nil, fmt.Errorf("get node: %w", err)
 		}
 		if !acls.AllowNodesToCommunicate(ctx, thisNode, node) {
 			log.Debug("Nodes not allowed to communicate", "nodeA", thisNode, "nodeB", node)
@@ -81,10 +88,15 @@ Nodes:
 			continue Nodes
 		}
 		// If the destination node exposes additional routes, check if the nodes can communicate
-		// via any of those routes.
+		// via any of those routes. Routes are never used through a node that is only allowed
+		// control-plane traffic, so they don't need checking.
+		if !acls.AllowDataPlane(ctx, thisNode, node) {
+			filtered[node.NodeID()] = make(types.EdgeMap)
+			continue Nodes
+		}
 		routes, err := db.Networking().GetRoutesByNode(ctx, node.NodeID())
 		if err != nil {
-			return nil, fmt.Errorf("get routes by node: %w", err)
+			return nil, nil, fmt.Errorf("get routes by node: %w", err)
 		}
 		for _, route := range routes {
 			for _, cidr := range route.DestinationPrefixes() {
@@ -131,7 +143,7 @@ Nodes:
 			}
 			peer, err := graph.Vertex(peerID)
 			if err != nil {
-				return nil, fmt.Errorf("get peer: %w", err)
+				return nil, nil, fmt.Errorf("get peer: %w", err)
 			}
 			if !acls.AllowNodesToCommunicate(ctx, thisNode, peer) {
 				log.Debug("Nodes not allowed to communicate", "nodeA", thisNode, "nodeB", peer)
@@ -139,9 +151,13 @@ Nodes:
 			}
 			// If the peer exposes additional routes, check if the nodes can communicate
 			// via any of those routes.
+			if !acls.AllowDataPlane(ctx, thisNode, peer) {
+				filtered[node][peerID] = e
+				continue Peers
+			}
 			routes, err := db.Networking().GetRoutesByNode(ctx, peerID)
 			if err != nil {
-				return nil, fmt.Errorf("get routes by node: %w", err)
+				return nil, nil, fmt.Errorf("get routes by node: %w", err)
 			}
 			for _, route := range routes {
 				for _, cidr := range route.DestinationPrefixes() {
@@ -172,5 +188,5 @@ Nodes:
 	}
 
 	log.Debug("Filtered adjacency map", "from", thisNode.Id, "map", filtered)
-	return filtered, nil
+	return filtered, acls, nil
 }
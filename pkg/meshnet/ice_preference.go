@@ -0,0 +1,191 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// ICEPreference decides how peers that are offered over ICE are connected to
+// when they also have a direct endpoint.
+type ICEPreference string
+
+const (
+	// PreferICE always negotiates ICE connections for ICE peers. This is the default.
+	PreferICE ICEPreference = "prefer-ice"
+	// PreferDirect connects to ICE peers directly when their primary endpoint is
+	// reachable, and only negotiates ICE when it is not.
+	PreferDirect ICEPreference = "prefer-direct"
+)
+
+// DefaultDirectProbeTimeout is the default time allowed for the direct
+// reachability probe of an ICE peer under PreferDirect.
+const DefaultDirectProbeTimeout = time.Second
+
+// directProbeTTL is how long the result of a direct reachability probe is
+// used before the peer is probed again.
+const directProbeTTL = 5 * time.Minute
+
+// directProbe is the cached result of a direct reachability probe.
+type directProbe struct {
+	reachable bool
+	at        time.Time
+	running   bool
+}
+
+// IsValid returns true if the preference is known. The empty preference is
+// the same as PreferICE.
+func (p ICEPreference) IsValid() bool {
+	switch p {
+	case "", PreferICE, PreferDirect:
+		return true
+	}
+	return false
+}
+
+// directReachable returns true if the manager prefers direct connections and
+// the last probe of the ICE peer's primary endpoint succeeded. Probes run in the
+// background and their results are cached, so this never blocks. Until the
+// first probe completes the peer is connected over ICE, and it is re-added once
+// the probe finds it reachable.
+func (m *peerManager) directReachable(ctx context.Context, peer *v1.WireGuardPeer) bool {
+	if m.net.opts.ICEPreference != PreferDirect || peer.GetNode().GetPrimaryEndpoint() == "" {
+		return false
+	}
+	id := peer.GetNode().GetId()
+	m.probemu.Lock()
+	defer m.probemu.Unlock()
+	probe, ok := m.probes[id]
+	if !ok || (!probe.running && time.Since(probe.at) > directProbeTTL) {
+		probe.running = true
+		m.probes[id] = probe
+		go m.probeDirectReachable(context.WithLogger(context.Background(), context.LoggerFrom(ctx)), peer)
+	}
+	return probe.reachable
+}
+
+// probeDirectReachable probes the ICE peer's primary endpoint and caches the result.
+// WireGuard does not answer unauthenticated traffic, so the probe is a TCP dial to
+// the primary endpoint on the peer's node API port, or the first port it advertises
+// a feature on. An open TCP port does not prove the WireGuard UDP port is open, so
+// peers that then fail to complete a handshake are marked unreachable by the
+// handshake sweep. If the peer became reachable it is re-added to switch it over.
+func (m *peerManager) probeDirectReachable(ctx context.Context, peer *v1.WireGuardPeer) {
+	id := peer.GetNode().GetId()
+	reachable := m.probeDirect(ctx, peer)
+	m.probemu.Lock()
+	previous := m.probes[id].reachable
+	m.probes[id] = directProbe{reachable: reachable, at: time.Now()}
+	m.probemu.Unlock()
+	if !reachable || previous {
+		return
+	}
+	m.peermu.Lock()
+	defer m.peermu.Unlock()
+	if _, ok := m.added[id]; !ok || m.net.WireGuard() == nil {
+		return
+	}
+	context.LoggerFrom(ctx).Info("ICE peer is directly reachable, switching to its primary endpoint", slog.String("peer", id))
+	if err := m.addPeer(ctx, peer, nil); err != nil {
+		context.LoggerFrom(ctx).Warn("Failed to switch ICE peer to its primary endpoint", slog.String("peer", id), slog.String("error", err.Error()))
+	}
+}
+
+func (m *peerManager) probeDirect(ctx context.Context, peer *v1.WireGuardPeer) bool {
+	log := context.LoggerFrom(ctx)
+	endpoint, err := m.resolveEndpoint(peer.GetNode().GetPrimaryEndpoint())
+	if err != nil {
+		log.Debug("Could not resolve ICE peer endpoint for direct probe", slog.String("error", err.Error()))
+		return false
+	}
+	port, ok := directProbePort(peer.GetNode())
+	if !ok {
+		log.Debug("ICE peer advertises no ports to probe, negotiating ICE", slog.String("peer", peer.GetNode().GetId()))
+		return false
+	}
+	timeout := m.net.opts.DirectProbeTimeout
+	if timeout <= 0 {
+		timeout = DefaultDirectProbeTimeout
+	}
+	target := netip.AddrPortFrom(endpoint.Addr(), port)
+	if err := probeDirect(ctx, target, timeout); err != nil {
+		log.Debug("ICE peer is not directly reachable, negotiating ICE",
+			slog.String("peer", peer.GetNode().GetId()),
+			slog.String("error", err.Error()))
+		return false
+	}
+	return true
+}
+
+// markDirectUnreachable records that the peer could not be reached on its
+// primary endpoint so it is connected over ICE until it is probed again.
+func (m *peerManager) markDirectUnreachable(id string) {
+	if m.net.opts.ICEPreference != PreferDirect {
+		return
+	}
+	m.probemu.Lock()
+	defer m.probemu.Unlock()
+	m.probes[id] = directProbe{reachable: false, at: time.Now()}
+}
+
+// closeICEConn closes the ICE connection to the peer, if any.
+func (m *peerManager) closeICEConn(ctx context.Context, id string) {
+	m.p2pmu.Lock()
+	defer m.p2pmu.Unlock()
+	if conn, ok := m.p2pConns[id]; ok {
+		context.LoggerFrom(ctx).Debug("Closing ICE connection to directly reachable peer", slog.String("peer", id))
+		conn.peerConn.Close()
+		delete(m.p2pConns, id)
+	}
+}
+
+// directProbePort returns the port to probe a node's direct reachability on.
+func directProbePort(node *v1.MeshNode) (uint16, bool) {
+	var first uint16
+	for _, feat := range node.GetFeatures() {
+		if feat.GetPort() <= 0 || feat.GetPort() > 65535 {
+			continue
+		}
+		if feat.GetFeature() == v1.Feature_NODES {
+			return uint16(feat.GetPort()), true
+		}
+		if first == 0 {
+			first = uint16(feat.GetPort())
+		}
+	}
+	return first, first != 0
+}
+
+// probeDirect attempts a TCP connection to the given address.
+func probeDirect(ctx context.Context, addr netip.AddrPort, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr.String())
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", addr, err)
+	}
+	return conn.Close()
+}
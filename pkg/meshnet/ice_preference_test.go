@@ -0,0 +1,117 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+)
+
+func TestPreferDirectOverICE(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	icePeer := func(rpcPort int) *v1.WireGuardPeer {
+		return &v1.WireGuardPeer{
+			Node: &v1.MeshNode{
+				Id:              "ice-peer",
+				PrimaryEndpoint: "127.0.0.1:51820",
+				Features: []*v1.FeaturePort{
+					{Feature: v1.Feature_NODES, Port: int32(rpcPort)},
+				},
+			},
+			Proto: v1.ConnectProtocol_CONNECT_ICE,
+		}
+	}
+	reachable := icePeer(l.Addr().(*net.TCPAddr).Port)
+
+	m := newPeerManager(&manager{opts: Options{ICEPreference: PreferDirect}})
+	// Probes run in the background, the first lookup never blocks on one.
+	if m.directReachable(ctx, reachable) {
+		t.Fatal("expected ICE to be used until the first probe completes")
+	}
+	waitDirectProbe(t, m, "ice-peer")
+	endpoint, err := m.determinePeerEndpoint(ctx, reachable, nil)
+	if err != nil {
+		t.Fatalf("determine peer endpoint: %v", err)
+	}
+	if want := netip.MustParseAddrPort("127.0.0.1:51820"); endpoint != want {
+		t.Fatalf("expected direct endpoint %s, got %s", want, endpoint)
+	}
+	// The result is cached, a closed port is not noticed until the probe expires.
+	if !m.directReachable(ctx, icePeer(closedPort)) {
+		t.Fatal("expected the cached probe result to be used")
+	}
+	// Peers that fail to complete a handshake fall back to ICE.
+	m.markDirectUnreachable("ice-peer")
+	if m.directReachable(ctx, reachable) {
+		t.Fatal("expected peer without a handshake to fall back to ICE")
+	}
+
+	m = newPeerManager(&manager{opts: Options{ICEPreference: PreferDirect}})
+	m.directReachable(ctx, icePeer(closedPort))
+	waitDirectProbe(t, m, "ice-peer")
+	if m.directReachable(ctx, icePeer(closedPort)) {
+		t.Fatal("expected peer with unreachable endpoint to fall back to ICE")
+	}
+
+	// ICE is always negotiated by default.
+	m = newPeerManager(&manager{opts: Options{}})
+	if m.directReachable(ctx, reachable) {
+		t.Fatal("expected ICE to be preferred by default")
+	}
+}
+
+func waitDirectProbe(t *testing.T, m *peerManager, id string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		m.probemu.Lock()
+		probe, ok := m.probes[id]
+		m.probemu.Unlock()
+		if ok && !probe.running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for direct probe of %s", id)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrInterfaceInUse is returned when starting a manager for an interface
+// that is already managed by another manager in the same process.
+var ErrInterfaceInUse = errors.New("interface is already managed in this process")
+
+// claimedInterfaces are the interfaces currently managed in this process,
+// keyed by network namespace and interface name.
+var claimedInterfaces = struct {
+	names map[string]struct{}
+	mu    sync.Mutex
+}{names: make(map[string]struct{})}
+
+// interfaceKey returns the key used to claim the interface for the given options.
+func interfaceKey(opts Options) string {
+	return opts.NetNs + "/" + opts.InterfaceName
+}
+
+// claimInterface claims the interface for the given options. An interface
+// without a name is left for the system to name and is never claimed.
+func claimInterface(opts Options) error {
+	if opts.InterfaceName == "" {
+		return nil
+	}
+	claimedInterfaces.mu.Lock()
+	defer claimedInterfaces.mu.Unlock()
+	key := interfaceKey(opts)
+	if _, ok := claimedInterfaces.names[key]; ok {
+		return fmt.Errorf("%w: %s", ErrInterfaceInUse, opts.InterfaceName)
+	}
+	claimedInterfaces.names[key] = struct{}{}
+	return nil
+}
+
+// releaseInterface releases a claim made with claimInterface.
+func releaseInterface(opts Options) {
+	claimedInterfaces.mu.Lock()
+	defer claimedInterfaces.mu.Unlock()
+	delete(claimedInterfaces.names, interfaceKey(opts))
+}
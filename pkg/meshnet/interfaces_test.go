@@ -0,0 +1,159 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestConcurrentManagers(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	newDB := func(network string, peers ...string) storage.MeshDB {
+		t.Helper()
+		db := meshdb.NewTestDB()
+		t.Cleanup(func() { db.Close() })
+		err := db.MeshState().SetMeshState(ctx, types.NetworkState{
+			NetworkState: &v1.NetworkState{
+				NetworkV4: network + ".0/24",
+				NetworkV6: "2001:db8::/64",
+				Domain:    "example.com",
+			},
+		})
+		if err != nil {
+			t.Fatalf("set network state: %v", err)
+		}
+		err = db.Networking().PutNetworkACL(ctx, types.NetworkACL{NetworkACL: &v1.NetworkACL{
+			Name:             "allow-all",
+			Action:           v1.ACLAction_ACTION_ACCEPT,
+			SourceNodes:      []string{"*"},
+			DestinationNodes: []string{"*"},
+			SourceCIDRs:      []string{"*"},
+			DestinationCIDRs: []string{"*"},
+		}})
+		if err != nil {
+			t.Fatalf("create network ACL: %v", err)
+		}
+		for i, id := range append([]string{"node"}, peers...) {
+			err := db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+				Id:                 id,
+				PublicKey:          mustGeneratePublicKey(t),
+				PrimaryEndpoint:    "127.0.0.1",
+				WireguardEndpoints: []string{fmt.Sprintf("127.0.0.1:%d", 51820+i)},
+				PrivateIPv4:        fmt.Sprintf("%s.%d/32", network, i+1),
+			}})
+			if err != nil {
+				t.Fatalf("create peer: %v", err)
+			}
+			if id == "node" {
+				continue
+			}
+			err = db.Peers().PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{Source: "node", Target: id}})
+			if err != nil {
+				t.Fatalf("put edge to %q: %v", id, err)
+			}
+		}
+		return db
+	}
+	// Both meshes use the same node ID, as they would with hostname-based IDs.
+	newManager := func(iface string, db storage.MeshDB) (*manager, *peerRecorder) {
+		wg := &peerRecorder{peers: make(map[string]wireguard.Peer)}
+		m := &manager{
+			nodeID:  "node",
+			storage: db,
+			opts:    Options{InterfaceName: iface, DisablePeerPing: true},
+			wg:      &namedRecorder{peerRecorder: wg, name: iface},
+		}
+		m.peers = newPeerManager(m)
+		return m, wg
+	}
+	tenantA, wgA := newManager("webmesh-a", newDB("10.1.0", "a1", "a2"))
+	tenantB, wgB := newManager("webmesh-b", newDB("10.2.0", "b1"))
+
+	for _, m := range []*manager{tenantA, tenantB} {
+		if err := claimInterface(m.opts); err != nil {
+			t.Fatalf("claim %s: %v", m.opts.InterfaceName, err)
+		}
+		defer releaseInterface(m.opts)
+	}
+	// A third manager may not take over an interface that is already managed.
+	if err := claimInterface(Options{InterfaceName: "webmesh-a"}); !errors.Is(err, ErrInterfaceInUse) {
+		t.Fatalf("expected ErrInterfaceInUse, got %v", err)
+	}
+	// The same name in another network namespace is a different interface.
+	other := Options{InterfaceName: "webmesh-a", NetNs: "/var/run/netns/tenant"}
+	if err := claimInterface(other); err != nil {
+		t.Fatalf("claim interface in other namespace: %v", err)
+	}
+	releaseInterface(other)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		for _, m := range []*manager{tenantA, tenantB} {
+			wg.Add(1)
+			go func(m *manager) {
+				defer wg.Done()
+				if err := m.peers.Sync(ctx); err != nil {
+					errs <- fmt.Errorf("sync %s: %w", m.opts.InterfaceName, err)
+				}
+			}(m)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		iface string
+		wg    *peerRecorder
+		want  []string
+	}{
+		{iface: "webmesh-a", wg: wgA, want: []string{"a1", "a2"}},
+		{iface: "webmesh-b", wg: wgB, want: []string{"b1"}},
+	} {
+		if len(tc.wg.Peers()) != len(tc.want) {
+			t.Errorf("expected %d peers on %s, got %v", len(tc.want), tc.iface, tc.wg.Peers())
+		}
+		for _, id := range tc.want {
+			if _, ok := tc.wg.Peers()[id]; !ok {
+				t.Errorf("expected peer %s on %s", id, tc.iface)
+			}
+		}
+	}
+}
+
+type namedRecorder struct {
+	*peerRecorder
+	name string
+}
+
+func (n *namedRecorder) Name() string {
+	return n.name
+}
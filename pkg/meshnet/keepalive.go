@@ -0,0 +1,49 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"slices"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+)
+
+// keepAliveFor returns the persistent keepalive override for the given peer.
+// A nil duration leaves the interface default in place, while a zero duration
+// disables keepalive for the peer. When NATKeepAliveOnly is set, only peers that
+// do not appear to be publicly reachable are sent keepalives. A peer is assumed
+// to be behind NAT when it is connected over ICE or libp2p, or when it does not
+// advertise a primary endpoint. KeepAlivePeers and NoKeepAlivePeers override
+// the heuristic.
+func (m *peerManager) keepAliveFor(peer *v1.WireGuardPeer) *time.Duration {
+	id := peer.GetNode().GetId()
+	var disabled time.Duration
+	switch {
+	case slices.Contains(m.net.opts.NoKeepAlivePeers, id):
+		return &disabled
+	case slices.Contains(m.net.opts.KeepAlivePeers, id):
+		return nil
+	case !m.net.opts.NATKeepAliveOnly:
+		return nil
+	case peer.GetProto() != v1.ConnectProtocol_CONNECT_NATIVE && !m.isDirectOnly(id):
+		return nil
+	case peer.GetNode().GetPrimaryEndpoint() == "":
+		return nil
+	}
+	return &disabled
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"io"
+	"net/netip"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+)
+
+func TestPeerKeepAlive(t *testing.T) {
+	t.Parallel()
+	natPeer := func(id string) *v1.WireGuardPeer {
+		return &v1.WireGuardPeer{
+			Node: &v1.MeshNode{
+				Id:              id,
+				PublicKey:       mustGeneratePublicKey(t),
+				PrimaryEndpoint: "203.0.113.10:51820",
+				PrivateIPv4:     "172.16.0.2/32",
+			},
+			Proto: v1.ConnectProtocol_CONNECT_ICE,
+		}
+	}
+	publicPeer := func(id string) *v1.WireGuardPeer {
+		return &v1.WireGuardPeer{
+			Node: &v1.MeshNode{
+				Id:              id,
+				PublicKey:       mustGeneratePublicKey(t),
+				PrimaryEndpoint: "203.0.113.20:51820",
+				PrivateIPv4:     "172.16.0.3/32",
+			},
+			Proto: v1.ConnectProtocol_CONNECT_NATIVE,
+		}
+	}
+	hiddenPeer := func(id string) *v1.WireGuardPeer {
+		return &v1.WireGuardPeer{
+			Node: &v1.MeshNode{
+				Id:          id,
+				PublicKey:   mustGeneratePublicKey(t),
+				PrivateIPv4: "172.16.0.4/32",
+			},
+			Proto: v1.ConnectProtocol_CONNECT_NATIVE,
+		}
+	}
+	tc := []struct {
+		name     string
+		opts     Options
+		peer     *v1.WireGuardPeer
+		disabled bool
+	}{
+		{
+			name: "ICE peer",
+			opts: Options{NATKeepAliveOnly: true},
+			peer: natPeer("ice"),
+		},
+		{
+			name: "peer without primary endpoint",
+			opts: Options{NATKeepAliveOnly: true},
+			peer: hiddenPeer("hidden"),
+		},
+		{
+			name:     "public peer",
+			opts:     Options{NATKeepAliveOnly: true},
+			peer:     publicPeer("public"),
+			disabled: true,
+		},
+		{
+			name: "public peer without NAT-only keepalive",
+			opts: Options{},
+			peer: publicPeer("public"),
+		},
+		{
+			name: "public peer forced to keepalive",
+			opts: Options{NATKeepAliveOnly: true, KeepAlivePeers: []string{"public"}},
+			peer: publicPeer("public"),
+		},
+		{
+			name:     "ICE peer with keepalive disabled",
+			opts:     Options{NATKeepAliveOnly: true, NoKeepAlivePeers: []string{"ice"}},
+			peer:     natPeer("ice"),
+			disabled: true,
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			opts := tt.opts
+			opts.DisablePeerPing = true
+			wg := &peerRecorder{peers: make(map[string]wireguard.Peer)}
+			m := &manager{nodeID: "node", wg: wg, opts: opts}
+			m.peers = newPeerManager(m)
+			// Pretend the ICE connection was already negotiated.
+			m.peers.p2pConns["ice"] = clientPeerConn{
+				peerConn:  io.NopCloser(nil),
+				localAddr: netip.MustParseAddrPort("127.0.0.1:51821"),
+			}
+			if err := m.peers.addPeer(ctx, tt.peer, nil); err != nil {
+				t.Fatalf("add peer: %v", err)
+			}
+			got, ok := wg.peers[tt.peer.GetNode().GetId()]
+			if !ok {
+				t.Fatal("expected peer to be added to the interface")
+			}
+			if tt.disabled {
+				if got.PersistentKeepAlive == nil || *got.PersistentKeepAlive != 0 {
+					t.Errorf("expected keepalive to be disabled, got %v", got.PersistentKeepAlive)
+				}
+			} else if got.PersistentKeepAlive != nil {
+				t.Errorf("expected the interface keepalive, got %s", *got.PersistentKeepAlive)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ package meshnet
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -27,15 +28,19 @@ import (
 	"sync"
 	"time"
 
+	v1 "github.com/webmeshproj/api/go/v1"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"google.golang.org/grpc"
 
 	"github.com/webmeshproj/webmesh/pkg/common"
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/netutil"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/system"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/system/dns"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/system/firewall"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/datachannels"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/libp2p"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
 	"github.com/webmeshproj/webmesh/pkg/storage"
@@ -59,8 +64,18 @@ type Options struct {
 	PersistentKeepAlive time.Duration
 	// ForceTUN is whether to force the use of TUN.
 	ForceTUN bool
+	// UserspaceBackend is the userspace WireGuard implementation to use for
+	// TUN interfaces. Empty selects the default.
+	UserspaceBackend string
 	// MTU is the MTU to use for the wireguard interface.
 	MTU int
+	// AutoMTU sets the interface MTU from the path MTU to the direct
+	// endpoints of peers, less the WireGuard overhead. MTU is used when
+	// no path MTU could be discovered.
+	AutoMTU bool
+	// AutoMTUInterval is how often the path MTU is probed again when AutoMTU
+	// is enabled. Zero only probes when the manager is started.
+	AutoMTUInterval time.Duration
 	// RecordMetrics is whether to enable metrics recording.
 	RecordMetrics bool
 	// RecordMetricsInterval is the interval to use for recording metrics.
@@ -75,10 +90,19 @@ type Options struct {
 	Credentials []grpc.DialOption
 	// LocalDNSAddr is a local network address service MeshDNS.
 	LocalDNSAddr netip.AddrPort
+	// ConditionalForwarders maps DNS domains to the server that resolves
+	// them, given as the ID of a node serving mesh DNS or as an address.
+	// Queries for each domain and its subdomains are sent to its server
+	// instead of the general DNS servers.
+	ConditionalForwarders map[string]string
 	// DisableIPv4 disables IPv4 on the interface.
 	DisableIPv4 bool
 	// DisableIPv6 disables IPv6 on the interface.
 	DisableIPv6 bool
+	// PreferIPv6 prefers IPv6 addresses over IPv4 addresses when a peer
+	// endpoint resolves to both. It only orders the families, DisableIPv4
+	// and DisableIPv6 do not apply to peer endpoints.
+	PreferIPv6 bool
 	// DisableFullTunnel will ignore routes for a default gateway.
 	DisableFullTunnel bool
 	// IgnoreRoutes are additional routes to ignore.
@@ -86,29 +110,184 @@ type Options struct {
 	// Relays are options for when presented with the need to negotiate
 	// p2p data channels.
 	Relays RelayOptions
+	// DirectOnlyPeers are peer IDs that must only ever be connected to
+	// directly. ICE and libp2p negotiation is never attempted for these
+	// peers and they are left disconnected if no direct endpoint is available.
+	DirectOnlyPeers []string
+	// ICEPreference decides whether peers offered over ICE are connected to
+	// directly when their primary endpoint is reachable. Defaults to PreferICE.
+	ICEPreference ICEPreference
+	// DirectProbeTimeout is the time allowed for the direct reachability probe
+	// under PreferDirect. Defaults to DefaultDirectProbeTimeout.
+	DirectProbeTimeout time.Duration
+	// PeerRateLimits caps the rate, in bits per second, of traffic sent to
+	// the given peer IDs. This is only supported on Linux, where it is
+	// enforced with tc on the WireGuard interface.
+	PeerRateLimits map[string]uint64
+	// NDPProxyInterface is a LAN interface to answer IPv6 neighbor solicitations
+	// on for this node's mesh address, so hosts on the LAN can reach it directly.
+	// This is only supported on Linux.
+	NDPProxyInterface string
+	// NDPProxyPeers also proxies the mesh IPv6 addresses of peers on the
+	// NDPProxyInterface, making the whole mesh reachable from the LAN through
+	// this node.
+	NDPProxyPeers bool
+	// NATKeepAliveOnly only sends persistent keepalives to peers that appear to
+	// be behind NAT, i.e. peers connected over ICE or libp2p and peers without a
+	// primary endpoint. Peers with a direct public endpoint are sent none.
+	NATKeepAliveOnly bool
+	// KeepAlivePeers are peer IDs that are always sent keepalives, regardless
+	// of NATKeepAliveOnly.
+	KeepAlivePeers []string
+	// NoKeepAlivePeers are peer IDs that are never sent keepalives.
+	NoKeepAlivePeers []string
+	// PresharedKey is a mesh-wide WireGuard preshared key to apply to every
+	// peer. All nodes in the mesh must be configured with the same key.
+	PresharedKey *wgtypes.Key
+	// HandshakeTimeout is the window in which a peer must complete a handshake
+	// before it is removed from the wireguard interface. Peers are re-added on
+	// the next refresh if they are still in the store. Zero disables the sweep.
+	// Only peers with a persistent keepalive are swept, since idle peers without
+	// one do not handshake.
+	HandshakeTimeout time.Duration
+	// PeerPingConcurrency is the number of liveness pings sent to newly added
+	// peers in parallel. Defaults to DefaultPeerPingConcurrency.
+	PeerPingConcurrency int
+	// PeerPingTimeout is how long a liveness ping to a newly added peer is
+	// attempted. Defaults to DefaultPeerPingTimeout.
+	PeerPingTimeout time.Duration
+	// DisablePeerPing disables the liveness ping sent to newly added peers.
+	DisablePeerPing bool
+	// EndpointResolveInterval is how often peer endpoints given as hostnames
+	// are resolved again. Peers are updated when the address changes. Zero
+	// disables re-resolution.
+	EndpointResolveInterval time.Duration
+	// DNSHealthCheckInterval is how often the configured mesh DNS servers are
+	// probed. Unhealthy servers are skipped by the resolver. Zero disables
+	// health checks.
+	DNSHealthCheckInterval time.Duration
+	// DNSCacheSize is the maximum number of responses cached by the resolver
+	// returned from the DNS manager. Responses are cached for their TTL, and
+	// NXDOMAIN for the negative TTL of the zone. Zero disables the cache.
+	DNSCacheSize int
+	// DisableRouteManagement configures the interface and peers without
+	// installing any routes, like wg-quick's "Table = off". Routing to the
+	// mesh and peer networks is then left to the operator.
+	DisableRouteManagement bool
+	// DisableNetworkRoute installs routes only for the addresses and routes
+	// of individual peers instead of routing the whole mesh networks to the
+	// interface. Nodes then only reach the peers they are connected to.
+	DisableNetworkRoute bool
+	// AssignLinkLocal assigns a deterministic IPv6 link-local address derived
+	// from the WireGuard public key to the interface, in addition to the ULA.
+	AssignLinkLocal bool
+	// MasqueradeExclusions are destination prefixes that are forwarded
+	// without source NAT while masquerading is enabled, for services that
+	// need to see the real mesh source address.
+	MasqueradeExclusions []netip.Prefix
+	// FirewallDefaultPolicy is the default policy of the firewall for traffic
+	// that no rule matches. Defaults to firewall.PolicyAccept.
+	FirewallDefaultPolicy firewall.Policy
+	// FirewallTCPPorts are additional TCP ports the firewall accepts, so
+	// enabled services stay reachable when the default policy drops traffic.
+	FirewallTCPPorts []uint16
+	// FirewallUDPPorts are additional UDP ports the firewall accepts.
+	FirewallUDPPorts []uint16
+	// ReconcileInterval is how often the peers on the interface are compared
+	// against the store and refreshed if they have drifted. This is a safety
+	// net for missed peer updates. Zero disables reconciliation.
+	ReconcileInterval time.Duration
+	// ReconcileDNSServers also reconciles the mesh DNS servers in the system
+	// configuration. It should only be set when mesh DNS servers are in use.
+	ReconcileDNSServers bool
+	// AsymmetricCheckInterval is how often the peers of this node are
+	// checked for whether they route our mesh addresses back to us. The check
+	// computes the peers of every direct peer, so it is disabled by default.
+	// Zero disables the check.
+	AsymmetricCheckInterval time.Duration
+	// RouteAccountingInterval is how often traffic forwarded to the routes
+	// advertised by this node is collected into metrics. Counting requires
+	// the nftables firewall. Zero disables route accounting.
+	RouteAccountingInterval time.Duration
+	// EndpointCacheFile is a file to persist the endpoints of directly connected
+	// peers to. On start, cached peers are configured right away and replaced
+	// once peers are refreshed from the store. Empty disables the cache.
+	EndpointCacheFile string
+	// EndpointCacheTTL is how long cached endpoints are used for after they were
+	// last seen. Defaults to DefaultEndpointCacheTTL.
+	EndpointCacheTTL time.Duration
+	// PortMapping requests a mapping of the listen port from a UPnP or NAT-PMP
+	// gateway when connecting and advertises the mapped external address as
+	// the primary endpoint.
+	PortMapping bool
+	// PortMappingLifetime is the lifetime requested for the port mapping.
+	// Defaults to DefaultPortMappingLifetime.
+	PortMappingLifetime time.Duration
+	// LinkLocalEndpointInterface is the interface used as the zone of link-local
+	// IPv6 peer endpoints that do not specify one. When empty, such endpoints
+	// are skipped since they cannot be reached without a zone.
+	LinkLocalEndpointInterface string
 }
 
 func (o *Options) MarshalJSON() ([]byte, error) {
 	return json.Marshal(map[string]any{
-		"netNs":                 o.NetNs,
-		"interfaceName":         o.InterfaceName,
-		"forceReplace":          o.ForceReplace,
-		"listenPort":            o.ListenPort,
-		"modprobe":              o.Modprobe,
-		"persistentKeepAlive":   o.PersistentKeepAlive,
-		"forceTUN":              o.ForceTUN,
-		"mtu":                   o.MTU,
-		"recordMetrics":         o.RecordMetrics,
-		"recordMetricsInterval": o.RecordMetricsInterval,
-		"storagePort":           o.StoragePort,
-		"grpcPort":              o.GRPCPort,
-		"zoneAwarenessID":       o.ZoneAwarenessID,
-		"localDNSAddr":          o.LocalDNSAddr,
-		"disableIPv4":           o.DisableIPv4,
-		"disableIPv6":           o.DisableIPv6,
-		"disableFullTunnel":     o.DisableFullTunnel,
-		"ignoreRoutes":          o.IgnoreRoutes,
-		"relays":                o.Relays,
+		"netNs":                   o.NetNs,
+		"interfaceName":           o.InterfaceName,
+		"forceReplace":            o.ForceReplace,
+		"listenPort":              o.ListenPort,
+		"modprobe":                o.Modprobe,
+		"persistentKeepAlive":     o.PersistentKeepAlive,
+		"forceTUN":                o.ForceTUN,
+		"userspaceBackend":        o.UserspaceBackend,
+		"mtu":                     o.MTU,
+		"autoMTU":                 o.AutoMTU,
+		"autoMTUInterval":         o.AutoMTUInterval,
+		"recordMetrics":           o.RecordMetrics,
+		"recordMetricsInterval":   o.RecordMetricsInterval,
+		"storagePort":             o.StoragePort,
+		"grpcPort":                o.GRPCPort,
+		"zoneAwarenessID":         o.ZoneAwarenessID,
+		"localDNSAddr":            o.LocalDNSAddr,
+		"conditionalForwarders":   o.ConditionalForwarders,
+		"disableIPv4":             o.DisableIPv4,
+		"disableIPv6":             o.DisableIPv6,
+		"preferIPv6":              o.PreferIPv6,
+		"disableFullTunnel":       o.DisableFullTunnel,
+		"ignoreRoutes":            o.IgnoreRoutes,
+		"relays":                  o.Relays,
+		"directOnlyPeers":         o.DirectOnlyPeers,
+		"icePreference":           o.ICEPreference,
+		"directProbeTimeout":      o.DirectProbeTimeout,
+		"peerRateLimits":          o.PeerRateLimits,
+		"ndpProxyInterface":       o.NDPProxyInterface,
+		"ndpProxyPeers":           o.NDPProxyPeers,
+		"natKeepAliveOnly":        o.NATKeepAliveOnly,
+		"keepAlivePeers":          o.KeepAlivePeers,
+		"noKeepAlivePeers":        o.NoKeepAlivePeers,
+		"presharedKey":            o.PresharedKey != nil,
+		"handshakeTimeout":        o.HandshakeTimeout,
+		"peerPingConcurrency":     o.PeerPingConcurrency,
+		"peerPingTimeout":         o.PeerPingTimeout,
+		"disablePeerPing":         o.DisablePeerPing,
+		"endpointResolveInterval": o.EndpointResolveInterval,
+		"dnsHealthCheckInterval":  o.DNSHealthCheckInterval,
+		"dnsCacheSize":            o.DNSCacheSize,
+		"disableRouteManagement":  o.DisableRouteManagement,
+		"disableNetworkRoute":     o.DisableNetworkRoute,
+		"assignLinkLocal":         o.AssignLinkLocal,
+		"masqueradeExclusions":    o.MasqueradeExclusions,
+		"firewallDefaultPolicy":   o.FirewallDefaultPolicy,
+		"firewallTCPPorts":        o.FirewallTCPPorts,
+		"firewallUDPPorts":        o.FirewallUDPPorts,
+		"reconcileInterval":       o.ReconcileInterval,
+		"reconcileDNSServers":     o.ReconcileDNSServers,
+		"routeAccountingInterval": o.RouteAccountingInterval,
+		"asymmetricCheckInterval": o.AsymmetricCheckInterval,
+		"endpointCacheFile":       o.EndpointCacheFile,
+		"endpointCacheTTL":        o.EndpointCacheTTL,
+		"portMapping":             o.PortMapping,
+		"portMappingLifetime":     o.PortMappingLifetime,
+		"linkLocalEndpointIface":  o.LinkLocalEndpointInterface,
 	})
 }
 
@@ -117,6 +296,9 @@ func (o *Options) MarshalJSON() ([]byte, error) {
 type RelayOptions struct {
 	// Host are the options for a libp2p host.
 	Host libp2p.HostOptions
+	// CandidatePolicy restricts the ICE candidate types signaled to peers
+	// when negotiating WireGuard proxies.
+	CandidatePolicy datachannels.CandidatePolicy
 }
 
 // StartOptions are the options for starting the network manager and configuring
@@ -148,27 +330,84 @@ type Manager interface {
 	NetworkV6() netip.Prefix
 	// StartMasquerade ensures that masquerading is enabled.
 	StartMasquerade(ctx context.Context) error
+	// StopMasquerade removes the masquerade rule if masquerading is enabled.
+	StopMasquerade(ctx context.Context) error
+	// IsMasquerading returns true if masquerading is currently enabled.
+	IsMasquerading() bool
 	// DNS returns the DNS server manager. The DNS server manager is only
 	// available after Start has been called.
 	DNS() DNSManager
+	// DNSServerStatus returns the health of the configured mesh DNS servers.
+	DNSServerStatus() []DNSServerStatus
 	// Peers return the peer manager.
 	Peers() PeerManager
+	// AsymmetricPeers returns the IDs of peers that were found to not route our
+	// mesh addresses back to us during the last peer refresh.
+	AsymmetricPeers() []types.NodeID
 	// Firewall returns the firewall.
 	// The firewall is only available after Start has been called.
 	Firewall() firewall.Firewall
 	// WireGuard returns the wireguard interface.
 	// The wireguard interface is only available after Start has been called.
 	WireGuard() wireguard.Interface
+	// Routes returns the destinations of the routes currently installed on the
+	// wireguard interface, as reported by the system.
+	Routes(ctx context.Context) ([]netip.Prefix, error)
+	// RouteTraffic returns the traffic forwarded to each destination prefix of
+	// the routes advertised by this node. ErrRouteAccountingUnsupported is
+	// returned if the firewall cannot count traffic per route.
+	RouteTraffic(ctx context.Context) ([]RouteTraffic, error)
+	// MapListenPort requests a mapping of the wireguard listen port from a
+	// UPnP or NAT-PMP gateway and returns the external address and port.
+	// The mapping is kept alive until the manager is closed. If a refresh
+	// sees a different external address, onChange is called with it.
+	MapListenPort(ctx context.Context, onChange func(context.Context, netip.AddrPort)) (netip.AddrPort, error)
+	// Diagnostics gathers a report of the interface, peers, routes, DNS servers,
+	// firewall, and endpoints of this node for troubleshooting.
+	Diagnostics(ctx context.Context) (Report, error)
+	// Reprovision removes all peers, routes, and DNS configuration from the
+	// interface and rebuilds them from the current state of the store. It is
+	// much heavier than a peer refresh and meant for recovering from drift.
+	Reprovision(ctx context.Context) error
+	// ReplacePeer replaces oldPeer on the wireguard interface with newPeer,
+	// such as after a scheduled key rotation. When both have the same ID the
+	// peer is updated in place and any relayed connection to it is kept.
+	ReplacePeer(ctx context.Context, oldPeer, newPeer *v1.WireGuardPeer, iceServers []string) error
 	// Close closes the network manager and cleans up any resources.
 	Close(ctx context.Context) error
 }
 
 // New creates a new network manager.
+//
+// Multiple managers may run in the same process, for example to join a node
+// to several isolated meshes, subject to the following constraints:
+//
+//   - Each manager must be given its own storage and a distinct InterfaceName
+//     within its network namespace. Start returns ErrInterfaceInUse otherwise.
+//   - ListenPort must be distinct or zero, and the mesh networks and routes of
+//     each manager should not overlap, since routing is shared by the host.
+//   - Firewall tables are named after the interface. The iptables fallback
+//     flushes the whole ruleset on close and is not safe to share.
+//   - System DNS configuration is shared. Servers and search domains are
+//     reference counted so one manager does not remove those still in use
+//     by another, but each platform only has one system resolver.
 func New(store storage.MeshDB, opts Options, nodeID types.NodeID) Manager {
 	m := &manager{
-		nodeID:  nodeID,
-		storage: store,
-		opts:    opts,
+		nodeID:         nodeID,
+		storage:        store,
+		opts:           opts,
+		pmtuProbe:      probePathMTU,
+		newFirewall:    firewall.New,
+		peersRefreshed: make(chan struct{}),
+	}
+	if m.opts.FirewallDefaultPolicy == "" {
+		m.opts.FirewallDefaultPolicy = firewall.PolicyAccept
+	}
+	if len(opts.PeerRateLimits) > 0 {
+		m.shaper = newPeerShaper()
+	}
+	if opts.NDPProxyInterface != "" {
+		m.ndproxy = newNDPProxies(newNDPProxy(), opts.NDPProxyInterface)
 	}
 	m.peers = newPeerManager(m)
 	return m
@@ -178,6 +417,7 @@ type manager struct {
 	opts                 Options
 	nodeID               types.NodeID
 	key                  crypto.PrivateKey
+	started              StartOptions
 	peers                *peerManager
 	dns                  *dnsManager
 	storage              storage.MeshDB
@@ -185,6 +425,24 @@ type manager struct {
 	wg                   wireguard.Interface
 	networkv4, networkv6 netip.Prefix
 	masquerading         bool
+	stopSweep            context.CancelFunc
+	stopResolve          context.CancelFunc
+	stopDNSHealth        context.CancelFunc
+	stopReconcile        context.CancelFunc
+	stopRouteAccounting  context.CancelFunc
+	stopMTUProbe         context.CancelFunc
+	peersRefreshed       chan struct{}
+	refreshedOnce        sync.Once
+	stopAsymmetricCheck  context.CancelFunc
+	pmtuProbe            pmtuProbeFunc
+	newFirewall          func(context.Context, *firewall.Options) (firewall.Firewall, error)
+	shaper               peerShaper
+	ndproxy              *ndpProxies
+	portmap              *portMapping
+	portMapper           portMapperFunc
+	accounting           routeAccounting
+	acctmu               sync.Mutex
+	claimed              bool
 	mu                   sync.Mutex
 }
 
@@ -192,10 +450,25 @@ func (m *manager) DNS() DNSManager {
 	return m.dns
 }
 
+func (m *manager) DNSServerStatus() []DNSServerStatus {
+	if m.dns == nil {
+		return nil
+	}
+	return m.dns.ServerStatus()
+}
+
+func (m *manager) ReplacePeer(ctx context.Context, oldPeer, newPeer *v1.WireGuardPeer, iceServers []string) error {
+	return m.peers.replace(ctx, oldPeer, newPeer, iceServers)
+}
+
 func (m *manager) Peers() PeerManager {
 	return m.peers
 }
 
+func (m *manager) AsymmetricPeers() []types.NodeID {
+	return m.peers.asymmetricPeers()
+}
+
 func (m *manager) NetworkV4() netip.Prefix {
 	return m.networkv4
 }
@@ -217,11 +490,31 @@ func (m *manager) WireGuard() wireguard.Interface {
 	return m.wg
 }
 
+func (m *manager) Routes(ctx context.Context) ([]netip.Prefix, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.wg == nil {
+		return nil, errors.New("routes called before wireguard interface is ready")
+	}
+	return m.wg.Routes(ctx)
+}
+
 func (m *manager) Start(ctx context.Context, opts StartOptions) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.key = opts.Key
 	log := context.LoggerFrom(ctx).With("component", "net-manager")
+	if m.claimed {
+		return errors.New("network manager already started")
+	}
+	if !m.opts.FirewallDefaultPolicy.IsValid() {
+		return fmt.Errorf("invalid firewall default policy %q", m.opts.FirewallDefaultPolicy)
+	}
+	if err := claimInterface(m.opts); err != nil {
+		return err
+	}
+	m.claimed = true
+	m.key = opts.Key
+	m.started = opts
 	log.Info("Starting mesh network manager")
 	if m.opts.Modprobe && runtime.GOOS == "linux" {
 		log.Debug("Attempting to load wireguard kernel module")
@@ -232,6 +525,10 @@ func (m *manager) Start(ctx context.Context, opts StartOptions) error {
 	}
 	log.Debug("Network manager start options", slog.Any("start-opts", opts))
 	handleErr := func(err error) error {
+		defer func() {
+			releaseInterface(m.opts)
+			m.claimed = false
+		}()
 		if m.wg != nil {
 			if closeErr := m.wg.Close(ctx); closeErr != nil {
 				err = fmt.Errorf("%w: %v", err, closeErr)
@@ -248,24 +545,27 @@ func (m *manager) Start(ctx context.Context, opts StartOptions) error {
 	// TODO: Getting close (if not already there) to just needing to embed
 	// the wireguard options in the manager options.
 	wgopts := &wireguard.Options{
-		NetNs:               m.opts.NetNs,
-		NodeID:              m.nodeID,
-		ListenPort:          m.opts.ListenPort,
-		Name:                m.opts.InterfaceName,
-		ForceName:           m.opts.ForceReplace,
-		ForceTUN:            m.opts.ForceTUN,
-		PersistentKeepAlive: m.opts.PersistentKeepAlive,
-		MTU:                 m.opts.MTU,
-		Metrics:             m.opts.RecordMetrics,
-		MetricsInterval:     m.opts.RecordMetricsInterval,
-		AddressV4:           opts.AddressV4,
-		AddressV6:           opts.AddressV6,
-		NetworkV4:           opts.NetworkV4,
-		NetworkV6:           opts.NetworkV6,
-		IgnoreRoutes:        m.opts.IgnoreRoutes,
-		DisableIPv4:         m.opts.DisableIPv4,
-		DisableIPv6:         m.opts.DisableIPv6,
-		DisableFullTunnel:   m.opts.DisableFullTunnel,
+		NetNs:                  m.opts.NetNs,
+		NodeID:                 m.nodeID,
+		ListenPort:             m.opts.ListenPort,
+		Name:                   m.opts.InterfaceName,
+		ForceName:              m.opts.ForceReplace,
+		ForceTUN:               m.opts.ForceTUN,
+		UserspaceBackend:       m.opts.UserspaceBackend,
+		PersistentKeepAlive:    m.opts.PersistentKeepAlive,
+		MTU:                    m.opts.MTU,
+		Metrics:                m.opts.RecordMetrics,
+		MetricsInterval:        m.opts.RecordMetricsInterval,
+		AddressV4:              opts.AddressV4,
+		AddressV6:              opts.AddressV6,
+		NetworkV4:              opts.NetworkV4,
+		NetworkV6:              opts.NetworkV6,
+		IgnoreRoutes:           m.opts.IgnoreRoutes,
+		DisableIPv4:            m.opts.DisableIPv4,
+		DisableIPv6:            m.opts.DisableIPv6,
+		DisableFullTunnel:      m.opts.DisableFullTunnel,
+		DisableRouteManagement: m.opts.DisableRouteManagement,
+		DisableNetworkRoute:    m.opts.DisableNetworkRoute,
 	}
 	log.Debug("Configuring wireguard", slog.Any("opts", wgopts))
 	m.wg, err = wireguard.New(ctx, wgopts)
@@ -280,54 +580,181 @@ func (m *manager) Start(ctx context.Context, opts StartOptions) error {
 		noIPv4:       m.opts.DisableIPv4,
 		noIPv6:       m.opts.DisableIPv6,
 	}
+	if m.opts.DNSCacheSize > 0 {
+		m.dns.cache, err = newDNSCache(m.opts.DNSCacheSize)
+		if err != nil {
+			return handleErr(fmt.Errorf("new dns cache: %w", err))
+		}
+	}
+	if len(m.opts.ConditionalForwarders) > 0 {
+		m.dns.forwarders = make(map[string]string, len(m.opts.ConditionalForwarders))
+		for domain, target := range m.opts.ConditionalForwarders {
+			m.dns.forwarders[canonicalDomain(domain)] = target
+		}
+		// Nodes named as forwarders may not be known until we have joined,
+		// they are resolved again whenever the DNS servers are refreshed.
+		m.dns.mu.Lock()
+		if err := m.dns.syncForwarders(context.WithLogger(ctx, log)); err != nil {
+			log.Debug("Not all conditional forwarders could be configured yet", slog.String("error", err.Error()))
+		}
+		m.dns.mu.Unlock()
+	}
 	err = m.wg.Configure(ctx, opts.Key)
 	if err != nil {
 		return handleErr(fmt.Errorf("configure wireguard: %w", err))
 	}
-	if opts.NetworkV6.IsValid() && !m.opts.DisableIPv6 {
-		m.networkv6 = opts.NetworkV6
-		log.Debug("Adding IPv6 network route", slog.String("network", opts.NetworkV6.String()))
-		err = m.wg.AddRoute(ctx, opts.NetworkV6)
-		if err != nil && !system.IsRouteExists(err) {
-			return handleErr(fmt.Errorf("wireguard add mesh network route: %w", err))
+	if m.opts.AssignLinkLocal && !m.opts.DisableIPv6 {
+		if err := m.assignLinkLocal(context.WithLogger(ctx, log), opts.Key.PublicKey()); err != nil {
+			return handleErr(err)
 		}
 	}
-	if opts.AddressV6.IsValid() && !m.opts.DisableIPv6 {
-		log.Debug("Adding IPv6 address route", slog.String("address", opts.AddressV6.String()))
-		err = m.wg.AddRoute(ctx, opts.AddressV6)
-		if err != nil && !system.IsRouteExists(err) {
-			return handleErr(fmt.Errorf("wireguard add ipv6 route: %w", err))
+	if err := m.addMeshRoutes(context.WithLogger(ctx, log), opts); err != nil {
+		return handleErr(err)
+	}
+	if m.ndproxy != nil && opts.AddressV6.IsValid() && !m.opts.DisableIPv6 {
+		log.Debug("Proxying NDP for IPv6 address",
+			slog.String("address", opts.AddressV6.Addr().String()),
+			slog.String("interface", m.opts.NDPProxyInterface))
+		err := m.peers.inNetNS(func() error {
+			return m.ndproxy.add(ctx, m.nodeID.String(), opts.AddressV6.Addr())
+		})
+		if err != nil {
+			return handleErr(err)
 		}
 	}
-	if opts.NetworkV4.IsValid() && !m.opts.DisableIPv4 {
-		m.networkv4 = opts.NetworkV4
-		log.Debug("Adding IPv4 network route", slog.String("network", opts.NetworkV4.String()))
-		err = m.wg.AddRoute(ctx, opts.NetworkV4)
-		if err != nil && !system.IsRouteExists(err) {
-			return handleErr(fmt.Errorf("wireguard add mesh network route: %w", err))
+	if err := m.startFirewall(context.WithLogger(ctx, log)); err != nil {
+		return handleErr(err)
+	}
+	if err := m.peers.restoreCachedPeers(context.WithLogger(ctx, log)); err != nil {
+		log.Warn("Failed to restore peers from endpoint cache", slog.String("error", err.Error()))
+	}
+	if m.opts.HandshakeTimeout > 0 {
+		log.Debug("Starting handshake-based peer sweep", slog.Duration("timeout", m.opts.HandshakeTimeout))
+		var sweepCtx context.Context
+		sweepCtx, m.stopSweep = context.WithCancel(context.WithLogger(context.Background(), log))
+		go m.peers.runHandshakeSweep(sweepCtx, m.opts.HandshakeTimeout)
+	}
+	if m.opts.EndpointResolveInterval > 0 {
+		log.Debug("Starting peer endpoint re-resolution", slog.Duration("interval", m.opts.EndpointResolveInterval))
+		var resolveCtx context.Context
+		resolveCtx, m.stopResolve = context.WithCancel(context.WithLogger(context.Background(), log))
+		go m.peers.runEndpointResolver(resolveCtx, m.opts.EndpointResolveInterval)
+	}
+	if m.opts.DNSHealthCheckInterval > 0 {
+		log.Debug("Starting DNS server health checks", slog.Duration("interval", m.opts.DNSHealthCheckInterval))
+		var healthCtx context.Context
+		healthCtx, m.stopDNSHealth = context.WithCancel(context.WithLogger(context.Background(), log))
+		go m.dns.runHealthChecks(healthCtx, m.opts.DNSHealthCheckInterval)
+	}
+	if m.opts.ReconcileInterval > 0 {
+		log.Debug("Starting periodic reconciliation", slog.Duration("interval", m.opts.ReconcileInterval))
+		var reconcileCtx context.Context
+		reconcileCtx, m.stopReconcile = context.WithCancel(context.WithLogger(context.Background(), log))
+		go m.runReconcile(reconcileCtx, m.opts.ReconcileInterval)
+	}
+	if m.opts.RouteAccountingInterval > 0 {
+		if _, err := m.routeCounter(); err != nil {
+			log.Warn("Route accounting is not supported by the firewall, skipping")
+		} else {
+			log.Debug("Starting route accounting", slog.Duration("interval", m.opts.RouteAccountingInterval))
+			var acctCtx context.Context
+			acctCtx, m.stopRouteAccounting = context.WithCancel(context.WithLogger(context.Background(), log))
+			go m.runRouteAccounting(acctCtx, m.opts.RouteAccountingInterval)
 		}
 	}
+	if m.opts.AsymmetricCheckInterval > 0 {
+		log.Debug("Starting asymmetric peer checks", slog.Duration("interval", m.opts.AsymmetricCheckInterval))
+		var checkCtx context.Context
+		checkCtx, m.stopAsymmetricCheck = context.WithCancel(context.WithLogger(context.Background(), log))
+		go m.peers.runAsymmetricCheck(checkCtx, m.opts.AsymmetricCheckInterval)
+	}
+	if m.opts.AutoMTU {
+		log.Debug("Starting path MTU discovery", slog.Duration("interval", m.opts.AutoMTUInterval))
+		var mtuCtx context.Context
+		mtuCtx, m.stopMTUProbe = context.WithCancel(context.WithLogger(context.Background(), log))
+		go m.runMTUProbe(mtuCtx, m.opts.AutoMTUInterval)
+	}
+	return nil
+}
+
+// startFirewall creates the firewall for the wireguard interface and allows
+// forwarding traffic on it.
+func (m *manager) startFirewall(ctx context.Context) error {
+	log := context.LoggerFrom(ctx)
 	realPort, err := m.wg.ListenPort()
 	if err != nil {
-		return handleErr(fmt.Errorf("lookup wireguard listen port: %w", err))
+		return fmt.Errorf("lookup wireguard listen port: %w", err)
 	}
 	fwopts := &firewall.Options{
-		ID:            m.nodeID.String(),
-		NetNs:         m.opts.NetNs,
-		DefaultPolicy: firewall.PolicyAccept, // TODO: Make this configurable
-		WireguardPort: uint16(realPort),
-		StoragePort:   uint16(m.opts.StoragePort),
-		GRPCPort:      uint16(m.opts.GRPCPort),
+		ID:                   m.wg.Name(),
+		NetNs:                m.opts.NetNs,
+		DefaultPolicy:        m.opts.FirewallDefaultPolicy,
+		WireguardPort:        uint16(realPort),
+		StoragePort:          uint16(m.opts.StoragePort),
+		GRPCPort:             uint16(m.opts.GRPCPort),
+		TCPPorts:             m.opts.FirewallTCPPorts,
+		UDPPorts:             m.opts.FirewallUDPPorts,
+		MasqueradeExclusions: m.opts.MasqueradeExclusions,
 	}
 	log.Debug("Configuring firewall", slog.Any("opts", fwopts))
-	m.fw, err = firewall.New(ctx, fwopts)
+	m.fw, err = m.newFirewall(ctx, fwopts)
 	if err != nil {
-		return handleErr(fmt.Errorf("new firewall manager: %w", err))
+		return fmt.Errorf("new firewall manager: %w", err)
 	}
 	log.Debug("Configuring forwarding on wireguard interface", slog.String("interface", m.wg.Name()))
 	err = m.fw.AddWireguardForwarding(ctx, m.wg.Name())
 	if err != nil {
-		return handleErr(fmt.Errorf("add wireguard forwarding rule: %w", err))
+		return fmt.Errorf("add wireguard forwarding rule: %w", err)
+	}
+	return nil
+}
+
+// addMeshRoutes adds routes for the mesh networks and our IPv6 address to the
+// wireguard interface. The networks are recorded even when route management
+// or the network routes are disabled.
+func (m *manager) addMeshRoutes(ctx context.Context, opts StartOptions) error {
+	log := context.LoggerFrom(ctx)
+	if opts.NetworkV6.IsValid() && !m.opts.DisableIPv6 {
+		m.networkv6 = opts.NetworkV6
+	}
+	if opts.NetworkV4.IsValid() && !m.opts.DisableIPv4 {
+		m.networkv4 = opts.NetworkV4
+	}
+	if m.opts.DisableRouteManagement {
+		log.Debug("Route management is disabled, skipping mesh routes")
+		return nil
+	}
+	if opts.NetworkV6.IsValid() && !m.opts.DisableIPv6 && !m.opts.DisableNetworkRoute {
+		log.Debug("Adding IPv6 network route", slog.String("network", opts.NetworkV6.String()))
+		err := m.wg.AddRoute(ctx, opts.NetworkV6)
+		if err != nil && !system.IsRouteExists(err) {
+			return fmt.Errorf("wireguard add mesh network route: %w", err)
+		}
+	}
+	if opts.AddressV6.IsValid() && !m.opts.DisableIPv6 {
+		log.Debug("Adding IPv6 address route", slog.String("address", opts.AddressV6.String()))
+		err := m.wg.AddRoute(ctx, opts.AddressV6)
+		if err != nil && !system.IsRouteExists(err) {
+			return fmt.Errorf("wireguard add ipv6 route: %w", err)
+		}
+	}
+	if opts.NetworkV4.IsValid() && !m.opts.DisableIPv4 && !m.opts.DisableNetworkRoute {
+		log.Debug("Adding IPv4 network route", slog.String("network", opts.NetworkV4.String()))
+		err := m.wg.AddRoute(ctx, opts.NetworkV4)
+		if err != nil && !system.IsRouteExists(err) {
+			return fmt.Errorf("wireguard add mesh network route: %w", err)
+		}
+	}
+	return nil
+}
+
+// assignLinkLocal adds the link-local address derived from the given key to
+// the wireguard interface.
+func (m *manager) assignLinkLocal(ctx context.Context, key crypto.PublicKey) error {
+	addr := netutil.GenerateLinkLocal(key)
+	context.LoggerFrom(ctx).Debug("Adding IPv6 link-local address", slog.String("address", addr.String()))
+	if err := m.wg.AddAddress(ctx, addr); err != nil {
+		return fmt.Errorf("wireguard add link-local address: %w", err)
 	}
 	return nil
 }
@@ -398,10 +825,51 @@ func (m *manager) StartMasquerade(ctx context.Context) error {
 	return nil
 }
 
+func (m *manager) StopMasquerade(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.masquerading {
+		return nil
+	}
+	err := m.fw.RemoveMasquerade(ctx, m.wg.Name())
+	if err != nil {
+		return fmt.Errorf("remove masquerade rule: %w", err)
+	}
+	m.masquerading = false
+	return nil
+}
+
+func (m *manager) IsMasquerading() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.masquerading
+}
+
 func (m *manager) Close(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	log := context.LoggerFrom(ctx).With("component", "net-manager")
+	if m.stopSweep != nil {
+		m.stopSweep()
+	}
+	if m.stopResolve != nil {
+		m.stopResolve()
+	}
+	if m.stopDNSHealth != nil {
+		m.stopDNSHealth()
+	}
+	if m.stopReconcile != nil {
+		m.stopReconcile()
+	}
+	if m.stopRouteAccounting != nil {
+		m.stopRouteAccounting()
+	}
+	if m.stopMTUProbe != nil {
+		m.stopMTUProbe()
+	}
+	if m.stopAsymmetricCheck != nil {
+		m.stopAsymmetricCheck()
+	}
 	defer m.peers.Close(context.WithLogger(ctx, log))
 	if m.fw != nil {
 		// Clear the firewall rules after wireguard is shutdown
@@ -427,6 +895,33 @@ func (m *manager) Close(ctx context.Context) error {
 				log.Error("error removing DNS search domains", slog.String("error", err.Error()))
 			}
 		}
+		m.dns.mu.Lock()
+		if err := m.dns.removeForwarders(); err != nil {
+			log.Error("error removing conditional DNS forwarders", slog.String("error", err.Error()))
+		}
+		m.dns.mu.Unlock()
+	}
+	if m.ndproxy != nil {
+		log.Debug("Removing NDP proxy entries")
+		err := m.peers.inNetNS(func() error {
+			return m.ndproxy.clear(ctx)
+		})
+		if err != nil {
+			log.Error("error removing NDP proxy entries", slog.String("error", err.Error()))
+		}
+	}
+	if m.portmap != nil {
+		log.Debug("Removing port mapping")
+		if err := m.portmap.close(ctx); err != nil {
+			log.Error("error removing port mapping", slog.String("error", err.Error()))
+		}
+		m.portmap = nil
+	}
+	if m.claimed {
+		defer func() {
+			releaseInterface(m.opts)
+			m.claimed = false
+		}()
 	}
 	if m.wg != nil {
 		log.Debug("Closing wireguard interface")
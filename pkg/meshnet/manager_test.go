@@ -0,0 +1,314 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/netutil"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system/firewall"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+)
+
+func TestMasquerade(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fw := &masqFirewall{rules: make(map[string]int)}
+	m := &manager{fw: fw, wg: &namedInterface{name: "webmesh0"}}
+
+	if m.IsMasquerading() {
+		t.Fatal("expected masquerading to be disabled before start")
+	}
+	// Stopping before starting should be a no-op.
+	if err := m.StopMasquerade(ctx); err != nil {
+		t.Fatalf("stop masquerade: %v", err)
+	}
+	if fw.removed != 0 {
+		t.Fatalf("expected no rules to be removed, got %d", fw.removed)
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.StartMasquerade(ctx); err != nil {
+			t.Fatalf("start masquerade: %v", err)
+		}
+		if !m.IsMasquerading() {
+			t.Fatal("expected masquerading to be enabled after start")
+		}
+	}
+	if fw.rules["webmesh0"] != 1 {
+		t.Fatalf("expected a single masquerade rule, got %d", fw.rules["webmesh0"])
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.StopMasquerade(ctx); err != nil {
+			t.Fatalf("stop masquerade: %v", err)
+		}
+		if m.IsMasquerading() {
+			t.Fatal("expected masquerading to be disabled after stop")
+		}
+	}
+	if fw.rules["webmesh0"] != 0 {
+		t.Fatalf("expected masquerade rule to be removed, got %d", fw.rules["webmesh0"])
+	}
+	if fw.removed != 1 {
+		t.Fatalf("expected a single removal, got %d", fw.removed)
+	}
+	// Masquerading should be able to be toggled back on.
+	if err := m.StartMasquerade(ctx); err != nil {
+		t.Fatalf("start masquerade: %v", err)
+	}
+	if !m.IsMasquerading() || fw.rules["webmesh0"] != 1 {
+		t.Fatal("expected masquerading to be re-enabled")
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := &manager{}
+	if _, err := m.Routes(ctx); err == nil {
+		t.Fatal("expected error listing routes before start")
+	}
+	m.wg = &routeInterface{}
+	opts := StartOptions{
+		AddressV4: netip.MustParsePrefix("172.16.0.1/32"),
+		AddressV6: netip.MustParsePrefix("fd00:dead:beef:1::/64"),
+		NetworkV4: netip.MustParsePrefix("172.16.0.0/12"),
+		NetworkV6: netip.MustParsePrefix("fd00:dead:beef::/48"),
+	}
+	if err := m.addMeshRoutes(ctx, opts); err != nil {
+		t.Fatalf("add mesh routes: %v", err)
+	}
+	got, err := m.Routes(ctx)
+	if err != nil {
+		t.Fatalf("list routes: %v", err)
+	}
+	for _, want := range []netip.Prefix{opts.NetworkV4, opts.NetworkV6, opts.AddressV6} {
+		if !slices.Contains(got, want) {
+			t.Errorf("expected route %s to be listed, got %v", want, got)
+		}
+	}
+	if len(got) != 3 {
+		t.Errorf("expected 3 routes, got %v", got)
+	}
+}
+
+func TestDisableRouteManagement(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	iface := &routeInterface{}
+	m := &manager{
+		opts: Options{DisableRouteManagement: true},
+		wg:   iface,
+	}
+	opts := StartOptions{
+		AddressV4: netip.MustParsePrefix("172.16.0.1/32"),
+		AddressV6: netip.MustParsePrefix("fd00:dead:beef:1::/64"),
+		NetworkV4: netip.MustParsePrefix("172.16.0.0/12"),
+		NetworkV6: netip.MustParsePrefix("fd00:dead:beef::/48"),
+	}
+	if err := m.addMeshRoutes(ctx, opts); err != nil {
+		t.Fatalf("add mesh routes: %v", err)
+	}
+	if len(iface.routes) != 0 {
+		t.Fatalf("expected no routes to be installed, got %v", iface.routes)
+	}
+	// The mesh networks are still known to the manager.
+	if m.networkv4 != opts.NetworkV4 || m.networkv6 != opts.NetworkV6 {
+		t.Fatalf("expected mesh networks to be recorded, got %s and %s", m.networkv4, m.networkv6)
+	}
+}
+
+func TestDisableNetworkRoute(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	iface := &routeInterface{}
+	m := &manager{
+		opts: Options{DisableNetworkRoute: true},
+		wg:   iface,
+	}
+	opts := StartOptions{
+		AddressV4: netip.MustParsePrefix("172.16.0.1/32"),
+		AddressV6: netip.MustParsePrefix("fd00:dead:beef:1::/64"),
+		NetworkV4: netip.MustParsePrefix("172.16.0.0/12"),
+		NetworkV6: netip.MustParsePrefix("fd00:dead:beef::/48"),
+	}
+	if err := m.addMeshRoutes(ctx, opts); err != nil {
+		t.Fatalf("add mesh routes: %v", err)
+	}
+	// Only the route to our own IPv6 prefix is installed, peers are routed individually.
+	if len(iface.routes) != 1 || iface.routes[0] != opts.AddressV6 {
+		t.Fatalf("expected only the route to %s, got %v", opts.AddressV6, iface.routes)
+	}
+	if m.networkv4 != opts.NetworkV4 || m.networkv6 != opts.NetworkV6 {
+		t.Fatalf("expected mesh networks to be recorded, got %s and %s", m.networkv4, m.networkv6)
+	}
+}
+
+func TestAssignLinkLocal(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	key := crypto.MustGenerateKey().PublicKey()
+	iface := &addressInterface{}
+	m := &manager{wg: iface}
+	if err := m.assignLinkLocal(ctx, key); err != nil {
+		t.Fatalf("assign link-local: %v", err)
+	}
+	if len(iface.addrs) != 1 {
+		t.Fatalf("expected one address to be assigned, got %v", iface.addrs)
+	}
+	addr := iface.addrs[0]
+	if !addr.Addr().IsLinkLocalUnicast() {
+		t.Fatalf("expected a link-local address, got %s", addr)
+	}
+	if addr != netutil.GenerateLinkLocal(key) {
+		t.Fatalf("expected address derived from key, got %s", addr)
+	}
+}
+
+func TestFirewallDefaultPolicy(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("Default", func(t *testing.T) {
+		t.Parallel()
+		m := New(nil, Options{}, "node").(*manager)
+		if m.opts.FirewallDefaultPolicy != firewall.PolicyAccept {
+			t.Fatalf("expected default policy %q, got %q", firewall.PolicyAccept, m.opts.FirewallDefaultPolicy)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+		m := New(nil, Options{FirewallDefaultPolicy: "reject"}, "node")
+		if err := m.Start(ctx, StartOptions{}); err == nil {
+			t.Fatal("expected invalid policy to be rejected")
+		}
+	})
+
+	t.Run("Drop", func(t *testing.T) {
+		t.Parallel()
+		var got *firewall.Options
+		fw := &forwardingFirewall{}
+		m := &manager{
+			opts: Options{
+				FirewallDefaultPolicy: firewall.PolicyDrop,
+				FirewallTCPPorts:      []uint16{8000},
+				FirewallUDPPorts:      []uint16{53},
+			},
+			wg: &portInterface{name: "webmesh0", port: 51820},
+			newFirewall: func(_ context.Context, opts *firewall.Options) (firewall.Firewall, error) {
+				got = opts
+				return fw, nil
+			},
+		}
+		if err := m.startFirewall(ctx); err != nil {
+			t.Fatalf("start firewall: %v", err)
+		}
+		if got == nil {
+			t.Fatal("expected firewall to be created")
+		}
+		if got.DefaultPolicy != firewall.PolicyDrop {
+			t.Fatalf("expected policy %q, got %q", firewall.PolicyDrop, got.DefaultPolicy)
+		}
+		if got.WireguardPort != 51820 {
+			t.Fatalf("expected wireguard port 51820, got %d", got.WireguardPort)
+		}
+		if !slices.Equal(got.TCPPorts, []uint16{8000}) || !slices.Equal(got.UDPPorts, []uint16{53}) {
+			t.Fatalf("expected service ports to be allowed, got tcp=%v udp=%v", got.TCPPorts, got.UDPPorts)
+		}
+		if !slices.Equal(fw.forwarded, []string{"webmesh0"}) {
+			t.Fatalf("expected forwarding on webmesh0, got %v", fw.forwarded)
+		}
+	})
+}
+
+type forwardingFirewall struct {
+	firewall.Firewall
+	forwarded []string
+}
+
+func (fw *forwardingFirewall) AddWireguardForwarding(_ context.Context, ifaceName string) error {
+	fw.forwarded = append(fw.forwarded, ifaceName)
+	return nil
+}
+
+type portInterface struct {
+	wireguard.Interface
+	name string
+	port int
+}
+
+func (p *portInterface) Name() string {
+	return p.name
+}
+
+func (p *portInterface) ListenPort() (int, error) {
+	return p.port, nil
+}
+
+type masqFirewall struct {
+	firewall.Firewall
+	rules   map[string]int
+	removed int
+}
+
+func (fw *masqFirewall) AddMasquerade(ctx context.Context, ifaceName string) error {
+	fw.rules[ifaceName]++
+	return nil
+}
+
+func (fw *masqFirewall) RemoveMasquerade(ctx context.Context, ifaceName string) error {
+	fw.rules[ifaceName]--
+	fw.removed++
+	return nil
+}
+
+type namedInterface struct {
+	wireguard.Interface
+	name string
+}
+
+func (n *namedInterface) Name() string {
+	return n.name
+}
+
+type addressInterface struct {
+	wireguard.Interface
+	addrs []netip.Prefix
+}
+
+func (a *addressInterface) AddAddress(_ context.Context, addr netip.Prefix) error {
+	a.addrs = append(a.addrs, addr)
+	return nil
+}
+
+type routeInterface struct {
+	wireguard.Interface
+	routes []netip.Prefix
+}
+
+func (r *routeInterface) AddRoute(_ context.Context, route netip.Prefix) error {
+	r.routes = append(r.routes, route)
+	return nil
+}
+
+func (r *routeInterface) Routes(context.Context) ([]netip.Prefix, error) {
+	return slices.Clone(r.routes), nil
+}
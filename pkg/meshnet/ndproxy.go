@@ -0,0 +1,144 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sync"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+)
+
+// ErrNDPProxyUnsupported is returned when NDP proxying is not supported on
+// the current platform.
+var ErrNDPProxyUnsupported = errors.New("NDP proxying is not supported on this platform")
+
+// ndpProxy answers IPv6 neighbor solicitations on a physical interface on
+// behalf of addresses that live behind the mesh.
+type ndpProxy interface {
+	// AddProxy adds a proxy entry for the address on the given interface,
+	// enabling NDP proxying on the interface if necessary.
+	AddProxy(ctx context.Context, iface string, addr netip.Addr) error
+	// RemoveProxy removes the proxy entry for the address, if any.
+	RemoveProxy(ctx context.Context, iface string, addr netip.Addr) error
+}
+
+// ndpProxies tracks the NDP proxy entries installed for mesh nodes, keyed
+// by node ID.
+type ndpProxies struct {
+	backend ndpProxy
+	iface   string
+	entries map[string]netip.Addr
+	mu      sync.Mutex
+}
+
+func newNDPProxies(backend ndpProxy, iface string) *ndpProxies {
+	return &ndpProxies{
+		backend: backend,
+		iface:   iface,
+		entries: make(map[string]netip.Addr),
+	}
+}
+
+// add proxies the given address for a node, replacing any previous entry
+// for the node.
+func (p *ndpProxies) add(ctx context.Context, id string, addr netip.Addr) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if current, ok := p.entries[id]; ok {
+		if current == addr {
+			return nil
+		}
+		if err := p.backend.RemoveProxy(ctx, p.iface, current); err != nil {
+			return fmt.Errorf("remove ndp proxy for %s: %w", current, err)
+		}
+		delete(p.entries, id)
+	}
+	if err := p.backend.AddProxy(ctx, p.iface, addr); err != nil {
+		return fmt.Errorf("add ndp proxy for %s: %w", addr, err)
+	}
+	p.entries[id] = addr
+	return nil
+}
+
+// remove removes the proxy entry for a node, if any.
+func (p *ndpProxies) remove(ctx context.Context, id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	addr, ok := p.entries[id]
+	if !ok {
+		return nil
+	}
+	delete(p.entries, id)
+	if err := p.backend.RemoveProxy(ctx, p.iface, addr); err != nil {
+		return fmt.Errorf("remove ndp proxy for %s: %w", addr, err)
+	}
+	return nil
+}
+
+// clear removes all proxy entries.
+func (p *ndpProxies) clear(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for id, addr := range p.entries {
+		if err := p.backend.RemoveProxy(ctx, p.iface, addr); err != nil {
+			errs = append(errs, fmt.Errorf("remove ndp proxy for %s: %w", addr, err))
+		}
+		delete(p.entries, id)
+	}
+	return errors.Join(errs...)
+}
+
+// proxyPeerNDP proxies the mesh IPv6 address of the given peer on the LAN
+// interface if peer proxying is enabled. Failures are logged since the peer
+// is still reachable over the mesh.
+func (m *peerManager) proxyPeerNDP(ctx context.Context, peer *wireguard.Peer) {
+	if m.net.ndproxy == nil || !m.net.opts.NDPProxyPeers || m.net.opts.DisableIPv6 || !peer.PrivateIPv6.IsValid() {
+		return
+	}
+	err := m.inNetNS(func() error {
+		return m.net.ndproxy.add(ctx, peer.ID, peer.PrivateIPv6.Addr())
+	})
+	if err != nil {
+		context.LoggerFrom(ctx).Warn("Failed to proxy NDP for peer",
+			slog.String("peer", peer.ID),
+			slog.String("interface", m.net.opts.NDPProxyInterface),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// unproxyPeerNDP removes the NDP proxy entry, if any, for the given peer.
+func (m *peerManager) unproxyPeerNDP(ctx context.Context, id string) {
+	if m.net.ndproxy == nil {
+		return
+	}
+	err := m.inNetNS(func() error {
+		return m.net.ndproxy.remove(ctx, id)
+	})
+	if err != nil {
+		context.LoggerFrom(ctx).Debug("Failed to remove NDP proxy for peer",
+			slog.String("peer", id),
+			slog.String("error", err.Error()),
+		)
+	}
+}
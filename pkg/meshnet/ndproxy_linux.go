@@ -0,0 +1,71 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/containernetworking/plugins/pkg/utils/sysctl"
+	"github.com/vishvananda/netlink"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// newNDPProxy returns the NDP proxy backend for the current platform.
+func newNDPProxy() ndpProxy {
+	return netlinkNDPProxy{}
+}
+
+// netlinkNDPProxy installs proxy neighbor entries with netlink, the
+// equivalent of "ip -6 neigh add proxy <addr> dev <iface>".
+type netlinkNDPProxy struct{}
+
+func (netlinkNDPProxy) AddProxy(ctx context.Context, iface string, addr netip.Addr) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return fmt.Errorf("get link: %w", err)
+	}
+	if _, err := sysctl.Sysctl(fmt.Sprintf("net/ipv6/conf/%s/proxy_ndp", iface), "1"); err != nil {
+		return fmt.Errorf("enable proxy_ndp: %w", err)
+	}
+	if err := netlink.NeighSet(proxyNeigh(link, addr)); err != nil {
+		return fmt.Errorf("set proxy neighbor: %w", err)
+	}
+	return nil
+}
+
+func (netlinkNDPProxy) RemoveProxy(ctx context.Context, iface string, addr netip.Addr) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return fmt.Errorf("get link: %w", err)
+	}
+	if err := netlink.NeighDel(proxyNeigh(link, addr)); err != nil {
+		return fmt.Errorf("delete proxy neighbor: %w", err)
+	}
+	return nil
+}
+
+func proxyNeigh(link netlink.Link, addr netip.Addr) *netlink.Neigh {
+	return &netlink.Neigh{
+		LinkIndex: link.Attrs().Index,
+		Family:    netlink.FAMILY_V6,
+		Flags:     netlink.NTF_PROXY,
+		IP:        net.IP(addr.AsSlice()),
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestNDPProxyPeers(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	defer db.Close()
+	err := db.MeshState().SetMeshState(ctx, types.NetworkState{
+		NetworkState: &v1.NetworkState{
+			NetworkV4: "172.16.0.0/12",
+			NetworkV6: "2001:db8::/64",
+			Domain:    "example.com",
+		},
+	})
+	if err != nil {
+		t.Fatalf("set network state: %v", err)
+	}
+	err = db.Networking().PutNetworkACL(ctx, types.NetworkACL{NetworkACL: &v1.NetworkACL{
+		Name:             "allow-all",
+		Action:           v1.ACLAction_ACTION_ACCEPT,
+		SourceNodes:      []string{"*"},
+		DestinationNodes: []string{"*"},
+		SourceCIDRs:      []string{"*"},
+		DestinationCIDRs: []string{"*"},
+	}})
+	if err != nil {
+		t.Fatalf("create network ACL: %v", err)
+	}
+	for i, id := range []string{"node", "peer-a", "peer-b"} {
+		err := db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:                 id,
+			PublicKey:          mustGeneratePublicKey(t),
+			PrimaryEndpoint:    "127.0.0.1",
+			WireguardEndpoints: []string{fmt.Sprintf("127.0.0.1:%d", 51820+i)},
+			PrivateIPv4:        fmt.Sprintf("172.16.0.%d/32", i+1),
+			PrivateIPv6:        fmt.Sprintf("2001:db8::%d/128", i+1),
+		}})
+		if err != nil {
+			t.Fatalf("create peer: %v", err)
+		}
+		if id == "node" {
+			continue
+		}
+		err = db.Peers().PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{
+			Source: "node",
+			Target: id,
+		}})
+		if err != nil {
+			t.Fatalf("put edge to %q: %v", id, err)
+		}
+	}
+
+	backend := &recordingNDPProxy{proxied: make(map[netip.Addr]string)}
+	wg := &peerRecorder{peers: make(map[string]wireguard.Peer)}
+	m := &manager{
+		nodeID:  "node",
+		storage: db,
+		wg:      wg,
+		ndproxy: newNDPProxies(backend, "eth0"),
+		opts: Options{
+			DisablePeerPing:   true,
+			NDPProxyInterface: "eth0",
+			NDPProxyPeers:     true,
+		},
+	}
+	m.peers = newPeerManager(m)
+	// Our own address is proxied when the manager starts.
+	if err := m.ndproxy.add(ctx, "node", netip.MustParseAddr("2001:db8::1")); err != nil {
+		t.Fatalf("proxy own address: %v", err)
+	}
+	if err := m.peers.Sync(ctx); err != nil {
+		t.Fatalf("sync peers: %v", err)
+	}
+	for _, addr := range []string{"2001:db8::1", "2001:db8::2", "2001:db8::3"} {
+		iface, ok := backend.get(netip.MustParseAddr(addr))
+		if !ok {
+			t.Errorf("expected an NDP proxy entry for %s", addr)
+			continue
+		}
+		if iface != "eth0" {
+			t.Errorf("expected NDP proxy entry for %s on eth0, got %q", addr, iface)
+		}
+	}
+
+	// Removing a peer removes its entry.
+	if err := db.Peers().Delete(ctx, "peer-b"); err != nil {
+		t.Fatalf("delete peer: %v", err)
+	}
+	if err := m.peers.Sync(ctx); err != nil {
+		t.Fatalf("sync peers: %v", err)
+	}
+	if _, ok := backend.get(netip.MustParseAddr("2001:db8::3")); ok {
+		t.Error("expected NDP proxy entry to be removed with the peer")
+	}
+
+	// Closing the manager clears the remaining entries.
+	if err := m.ndproxy.clear(ctx); err != nil {
+		t.Fatalf("clear NDP proxies: %v", err)
+	}
+	if n := backend.len(); n != 0 {
+		t.Errorf("expected no NDP proxy entries after clear, got %d", n)
+	}
+}
+
+type recordingNDPProxy struct {
+	proxied map[netip.Addr]string
+	mu      sync.Mutex
+}
+
+func (r *recordingNDPProxy) AddProxy(_ context.Context, iface string, addr netip.Addr) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.proxied[addr] = iface
+	return nil
+}
+
+func (r *recordingNDPProxy) RemoveProxy(_ context.Context, _ string, addr netip.Addr) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.proxied, addr)
+	return nil
+}
+
+func (r *recordingNDPProxy) get(addr netip.Addr) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	iface, ok := r.proxied[addr]
+	return iface, ok
+}
+
+func (r *recordingNDPProxy) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.proxied)
+}
@@ -92,6 +92,39 @@ func AssignToPrefix(prefix netip.Prefix, publicKey crypto.PublicKey) netip.Prefi
 	return netip.PrefixFrom(addr, DefaultNodeBits)
 }
 
+// LinkLocalPrefix is the IPv6 link-local network.
+var LinkLocalPrefix = netip.MustParsePrefix("fe80::/64")
+
+// GenerateLinkLocal derives a stable IPv6 link-local address within fe80::/64
+// from the given public key. The interface identifier is taken from a hash of
+// the key with the universal/local bit cleared, as for locally assigned
+// identifiers, and never falls in the subnet-router anycast or reserved
+// anycast ranges of RFC 5453 so that it cannot be mistaken for an anycast
+// address during neighbor discovery.
+func GenerateLinkLocal(key crypto.PublicKey) netip.Prefix {
+	wgkey := key.WireGuardKey()
+	sum := sha256.Sum256(append([]byte("webmesh-link-local"), wgkey[:]...))
+	var ip [16]byte
+	copy(ip[:8], LinkLocalPrefix.Addr().AsSlice()[:8])
+	copy(ip[8:], sum[:8])
+	// Clear the universal/local bit of the modified EUI-64 identifier.
+	ip[8] &^= 0x02
+	if isReservedInterfaceID(ip[8:]) {
+		// Flip a low order bit to move out of the reserved ranges.
+		ip[15] ^= 0x01
+		ip[8] = 0x00
+	}
+	return netip.PrefixFrom(netip.AddrFrom16(ip), 64)
+}
+
+// isReservedInterfaceID returns true if the given 64-bit interface identifier
+// is the subnet-router anycast identifier or in the reserved anycast range
+// fdff:ffff:ffff:ff80 - fdff:ffff:ffff:ffff.
+func isReservedInterfaceID(iid []byte) bool {
+	id := binary.BigEndian.Uint64(iid)
+	return id == 0 || id >= 0xfdffffffffffff80 && id <= 0xfdffffffffffffff
+}
+
 func generateLocalSecret() ([]byte, error) {
 	b := make([]byte, 8)
 	binary.BigEndian.PutUint64(b, timeToNTP(time.Now().UTC()))
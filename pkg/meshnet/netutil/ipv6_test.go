@@ -171,3 +171,24 @@ func mustGenerateSeedKey(t *testing.F) []byte {
 	pubkey := key.PublicKey().Bytes()
 	return pubkey[:]
 }
+
+func TestGenerateLinkLocal(t *testing.T) {
+	t.Parallel()
+	key := crypto.MustGenerateKey().PublicKey()
+	addr := GenerateLinkLocal(key)
+	if !addr.Addr().IsLinkLocalUnicast() || !LinkLocalPrefix.Contains(addr.Addr()) {
+		t.Fatalf("expected address in %s, got %s", LinkLocalPrefix, addr)
+	}
+	if addr.Bits() != 64 {
+		t.Fatalf("expected a /64 prefix, got %s", addr)
+	}
+	if again := GenerateLinkLocal(key); again != addr {
+		t.Fatalf("expected stable address for key, got %s and %s", addr, again)
+	}
+	if other := GenerateLinkLocal(crypto.MustGenerateKey().PublicKey()); other == addr {
+		t.Fatalf("expected different keys to derive different addresses, got %s", other)
+	}
+	if isReservedInterfaceID(addr.Addr().AsSlice()[8:]) {
+		t.Fatalf("derived address %s uses a reserved interface identifier", addr)
+	}
+}
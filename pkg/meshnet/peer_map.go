@@ -43,6 +43,7 @@ type GraphWalk struct {
 	LocalRoutes  []netip.Prefix
 	Routes       []Route
 	Visited      map[types.NodeID]struct{}
+	Restricted   map[types.NodeID]struct{}
 	Depth        int
 }
 
@@ -56,6 +57,11 @@ func (g *GraphWalk) SkipNode(id types.NodeID) bool {
 	if _, ok := g.Visited[id]; ok {
 		return true
 	}
+	// Skip nodes we are only allowed control-plane traffic with,
+	// they are never routed through.
+	if _, ok := g.Restricted[id]; ok {
+		return true
+	}
 	// Skip direct edges to the source
 	directAdjacents := g.AdjacencyMap[g.SourceNode]
 	if _, ok := directAdjacents[id]; ok {
@@ -80,7 +86,9 @@ type Route struct {
 }
 
 // WireGuardPeersFor returns the WireGuard peers for the given peer ID.
-// Peers are filtered by network ACLs.
+// Peers are filtered by network ACLs. Peers that are only allowed
+// control-plane traffic are given their own mesh addresses as allowed
+// IPs and are never routed through.
 func WireGuardPeersFor(ctx context.Context, st storage.MeshDB, peerID types.NodeID) ([]*v1.WireGuardPeer, error) {
 	log := context.LoggerFrom(ctx).With("source-peer", peerID)
 	graph := st.Peers().Graph()
@@ -89,10 +97,27 @@ func WireGuardPeersFor(ctx context.Context, st storage.MeshDB, peerID types.Node
 	if err != nil {
 		return nil, fmt.Errorf("get mesh state: %w", err)
 	}
-	adjacencyMap, err := FilterGraph(ctx, st, peerID)
+	adjacencyMap, acls, err := filterGraph(ctx, st, peerID)
 	if err != nil {
 		return nil, fmt.Errorf("filter adjacency map: %w", err)
 	}
+	self, err := graph.Vertex(peerID)
+	if err != nil {
+		return nil, fmt.Errorf("get vertex: %w", err)
+	}
+	restricted := make(map[types.NodeID]struct{})
+	for nodeID := range adjacencyMap {
+		if nodeID == peerID {
+			continue
+		}
+		node, err := graph.Vertex(nodeID)
+		if err != nil {
+			return nil, fmt.Errorf("get vertex: %w", err)
+		}
+		if !acls.AllowDataPlane(ctx, self, node) {
+			restricted[nodeID] = struct{}{}
+		}
+	}
 	routes, err := nw.GetRoutesByNode(ctx, peerID)
 	if err != nil {
 		return nil, fmt.Errorf("get routes by node: %w", err)
@@ -140,6 +165,15 @@ func WireGuardPeersFor(ctx context.Context, st storage.MeshDB, peerID types.Node
 				AllowedRoutes: []string{},
 			},
 		}
+		if _, ok := restricted[adjacent]; ok {
+			for _, addr := range []netip.Prefix{directPeer.PrivateAddrV4(), directPeer.PrivateAddrV6()} {
+				if addr.IsValid() {
+					peer.AllowedIPs = append(peer.AllowedIPs, addr.String())
+				}
+			}
+			peers = append(peers, peer)
+			continue
+		}
 		var target types.MeshNode
 		directPeer.DeepCopyInto(&target)
 		walk := GraphWalk{
@@ -152,6 +186,7 @@ func WireGuardPeersFor(ctx context.Context, st storage.MeshDB, peerID types.Node
 			AllowedIPs:   []string{},
 			Routes:       []Route{},
 			Visited:      map[types.NodeID]struct{}{},
+			Restricted:   restricted,
 			Depth:        0,
 		}
 		err = recursePeers(ctx, &walk)
@@ -176,7 +211,7 @@ func WireGuardPeersFor(ctx context.Context, st storage.MeshDB, peerID types.Node
 		}
 		out = append(out, peer.WireGuardPeer)
 	}
-	if len(out) == 1 {
+	if len(out) == 1 && !isRestricted(restricted, out[0]) {
 		// If there is only one peer, we can flatten the internal network routes
 		// to a single route.
 		// TODO: Smarter IPv4 assignments could make this possible for multiple peers.
@@ -193,10 +228,243 @@ func WireGuardPeersFor(ctx context.Context, st storage.MeshDB, peerID types.Node
 			}
 		}
 		peer.AllowedIPs = newAllowedIPs
+		return out, nil
+	}
+	if len(out) > 1 && nwState.NetworkV6().IsValid() {
+		reserved, err := meshAddresses(ctx, st)
+		if err != nil {
+			return nil, err
+		}
+		aggregateAllowedIPv6(out, nwState.NetworkV6(), self.PrivateAddrV6(), reserved)
+	}
+	return out, nil
+}
+
+// meshAddresses returns the mesh and secondary addresses of every node in the
+// store, including nodes that network ACLs hide from the caller.
+func meshAddresses(ctx context.Context, st storage.MeshDB) ([]netip.Prefix, error) {
+	nodes, err := st.Peers().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list peers: %w", err)
+	}
+	var out []netip.Prefix
+	for _, node := range nodes {
+		for _, addr := range []netip.Prefix{node.PrivateAddrV4(), node.PrivateAddrV6()} {
+			if addr.IsValid() {
+				out = append(out, addr)
+			}
+		}
+	}
+	leases, err := st.Networking().ListSecondaryIPs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list secondary ips: %w", err)
+	}
+	for _, lease := range leases {
+		out = append(out, lease.Addresses...)
 	}
 	return out, nil
 }
 
+// isRestricted reports if the given peer is only allowed control-plane traffic.
+func isRestricted(restricted map[types.NodeID]struct{}, peer *v1.WireGuardPeer) bool {
+	_, ok := restricted[types.NodeID(peer.GetNode().GetId())]
+	return ok
+}
+
+// AsymmetricPeersFor returns the IDs of the given direct peers of peerID that do not
+// have peerID configured as a peer with its mesh addresses in the allowed IPs. This
+// usually happens when network ACLs only allow traffic in one direction. Traffic we
+// send to these peers will be dropped, since their WireGuard configuration won't
+// accept it from us.
+func AsymmetricPeersFor(ctx context.Context, st storage.MeshDB, peerID types.NodeID, peers []*v1.WireGuardPeer) ([]types.NodeID, error) {
+	self, err := st.Peers().Graph().Vertex(peerID)
+	if err != nil {
+		return nil, fmt.Errorf("get vertex: %w", err)
+	}
+	var ourAddrs []netip.Addr
+	for _, addr := range []netip.Prefix{self.PrivateAddrV4(), self.PrivateAddrV6()} {
+		if addr.IsValid() {
+			ourAddrs = append(ourAddrs, addr.Addr())
+		}
+	}
+	var out []types.NodeID
+Peers:
+	for _, peer := range peers {
+		id := types.NodeID(peer.GetNode().GetId())
+		theirPeers, err := WireGuardPeersFor(ctx, st, id)
+		if err != nil {
+			return nil, fmt.Errorf("get wireguard peers for %s: %w", id, err)
+		}
+		for _, theirs := range theirPeers {
+			if theirs.GetNode().GetId() == peerID.String() && allowsAnyAddr(theirs, ourAddrs) {
+				continue Peers
+			}
+		}
+		out = append(out, id)
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// allowsAnyAddr returns true if the allowed IPs of the given peer contain one
+// of the given addresses, or if there are no addresses to check.
+func allowsAnyAddr(peer *v1.WireGuardPeer, addrs []netip.Addr) bool {
+	if len(addrs) == 0 {
+		return true
+	}
+	for _, allowed := range peer.GetAllowedIPs() {
+		prefix, err := netip.ParsePrefix(allowed)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// aggregateAllowedIPv6 summarizes the mesh IPv6 addresses reachable through each
+// peer into covering prefixes. A covering prefix is only used when it stays inside
+// the mesh network, consists only of addresses reachable through that peer, and
+// does not overlap the local address, any address or route reachable through
+// another peer, or any reserved address the peer does not route. Reserved should
+// hold the addresses of every node in the mesh, so nodes hidden by network ACLs
+// are never covered and the resulting routing decisions are unchanged.
+func aggregateAllowedIPv6(peers []*v1.WireGuardPeer, network netip.Prefix, local netip.Prefix, reserved []netip.Prefix) {
+	owned := make([][]netip.Prefix, len(peers))
+	for i, peer := range peers {
+		for _, allowedIP := range peer.AllowedIPs {
+			prefix, err := netip.ParsePrefix(allowedIP)
+			if err != nil {
+				continue
+			}
+			owned[i] = append(owned[i], prefix)
+		}
+	}
+	for i, peer := range peers {
+		foreign := make([]netip.Prefix, 0)
+		if local.IsValid() {
+			foreign = append(foreign, local)
+		}
+		for j := range peers {
+			if j != i {
+				foreign = append(foreign, owned[j]...)
+			}
+		}
+		for _, addr := range reserved {
+			if !slices.ContainsFunc(owned[i], func(p netip.Prefix) bool {
+				return p.Bits() <= addr.Bits() && p.Contains(addr.Addr())
+			}) {
+				foreign = append(foreign, addr)
+			}
+		}
+		var candidates []netip.Prefix
+		allowedIPs := make([]string, 0, len(peer.AllowedIPs))
+		for _, prefix := range owned[i] {
+			if prefix.Addr().Is6() && network.Contains(prefix.Addr()) && prefix.Bits() >= network.Bits() {
+				candidates = append(candidates, prefix)
+				continue
+			}
+			allowedIPs = append(allowedIPs, prefix.String())
+		}
+		if len(candidates) < 2 {
+			continue
+		}
+		slices.SortFunc(candidates, func(a, b netip.Prefix) int {
+			return a.Addr().Compare(b.Addr())
+		})
+		for _, prefix := range summarizePrefixes(candidates, network, foreign) {
+			allowedIPs = append(allowedIPs, prefix.String())
+		}
+		peer.AllowedIPs = allowedIPs
+	}
+}
+
+// summarizePrefixes returns the smallest set of prefixes covering the given sorted
+// prefixes without leaving the network, overlapping any of the foreign prefixes,
+// or containing any address outside the given prefixes.
+func summarizePrefixes(prefixes []netip.Prefix, network netip.Prefix, foreign []netip.Prefix) []netip.Prefix {
+	if len(prefixes) == 1 {
+		return prefixes
+	}
+	cover := coveringPrefix(prefixes)
+	if cover.Bits() < network.Bits() {
+		cover = netip.PrefixFrom(cover.Addr(), network.Bits()).Masked()
+	}
+	if !slices.ContainsFunc(foreign, cover.Overlaps) && coversExactly(cover, prefixes) {
+		return []netip.Prefix{cover}
+	}
+	// Split on the first bit after the covering prefix and try each half.
+	var left, right []netip.Prefix
+	for _, prefix := range prefixes {
+		if prefix.Bits() <= cover.Bits() {
+			// The prefix cannot be split any further.
+			return prefixes
+		}
+		if addrBit(prefix.Addr(), cover.Bits()) {
+			right = append(right, prefix)
+		} else {
+			left = append(left, prefix)
+		}
+	}
+	if len(left) == 0 || len(right) == 0 {
+		return prefixes
+	}
+	return append(summarizePrefixes(left, network, foreign), summarizePrefixes(right, network, foreign)...)
+}
+
+// coveringPrefix returns the longest prefix containing all of the given prefixes.
+func coveringPrefix(prefixes []netip.Prefix) netip.Prefix {
+	bits := prefixes[0].Bits()
+	for _, prefix := range prefixes[1:] {
+		bits = min(bits, prefix.Bits())
+	}
+	for ; bits > 0; bits-- {
+		cover := netip.PrefixFrom(prefixes[0].Addr(), bits).Masked()
+		if !slices.ContainsFunc(prefixes, func(p netip.Prefix) bool { return !cover.Contains(p.Addr()) }) {
+			return cover
+		}
+	}
+	return netip.PrefixFrom(prefixes[0].Addr(), 0).Masked()
+}
+
+// coversExactly reports whether every address in cover is contained in one of
+// the given prefixes.
+func coversExactly(cover netip.Prefix, prefixes []netip.Prefix) bool {
+	var inside []netip.Prefix
+	for _, prefix := range prefixes {
+		if prefix.Bits() <= cover.Bits() && prefix.Contains(cover.Addr()) {
+			return true
+		}
+		if prefix.Bits() > cover.Bits() && cover.Contains(prefix.Addr()) {
+			inside = append(inside, prefix)
+		}
+	}
+	if len(inside) == 0 || cover.Bits() >= cover.Addr().BitLen() {
+		return false
+	}
+	left := netip.PrefixFrom(cover.Addr(), cover.Bits()+1)
+	right := netip.PrefixFrom(setAddrBit(cover.Addr(), cover.Bits()), cover.Bits()+1)
+	return coversExactly(left, inside) && coversExactly(right, inside)
+}
+
+// setAddrBit returns the address with the bit at the given position set.
+func setAddrBit(addr netip.Addr, pos int) netip.Addr {
+	b := addr.AsSlice()
+	b[pos/8] |= 0x80 >> (pos % 8)
+	out, _ := netip.AddrFromSlice(b)
+	return out
+}
+
+// addrBit reports whether the bit at the given position of the address is set.
+func addrBit(addr netip.Addr, pos int) bool {
+	b := addr.AsSlice()
+	return b[pos/8]&(0x80>>(pos%8)) != 0
+}
+
 func recursePeers(ctx context.Context, walk *GraphWalk) error {
 	if walk.TargetNode.PrivateAddrV4().IsValid() {
 		walk.AllowedIPs = append(walk.AllowedIPs, walk.TargetNode.PrivateAddrV4().String())
@@ -204,6 +472,10 @@ func recursePeers(ctx context.Context, walk *GraphWalk) error {
 	if walk.TargetNode.PrivateAddrV6().IsValid() {
 		walk.AllowedIPs = append(walk.AllowedIPs, walk.TargetNode.PrivateAddrV6().String())
 	}
+	err := appendSecondaryIPs(ctx, walk, walk.TargetNode.NodeID())
+	if err != nil {
+		return err
+	}
 	// Does this peer expose routes?
 	routes, err := walk.Networking.GetRoutesByNode(ctx, walk.TargetNode.NodeID())
 	if err != nil {
@@ -229,6 +501,19 @@ func recursePeers(ctx context.Context, walk *GraphWalk) error {
 	return nil
 }
 
+// appendSecondaryIPs adds the secondary IP leases held by the given node to
+// the allowed IPs of the walk.
+func appendSecondaryIPs(ctx context.Context, walk *GraphWalk, nodeID types.NodeID) error {
+	ips, err := walk.Networking.GetSecondaryIPs(ctx, nodeID)
+	if err != nil {
+		return fmt.Errorf("get secondary ips: %w", err)
+	}
+	for _, addr := range ips.Addresses {
+		walk.AllowedIPs = append(walk.AllowedIPs, addr.String())
+	}
+	return nil
+}
+
 func recursePeerEdges(ctx context.Context, walk *GraphWalk) error {
 	if walk.Visited == nil {
 		walk.Visited = make(map[types.NodeID]struct{})
@@ -253,6 +538,10 @@ func recursePeerEdges(ctx context.Context, walk *GraphWalk) error {
 		if targetNode.PrivateAddrV6().IsValid() {
 			walk.AllowedIPs = append(walk.AllowedIPs, targetNode.PrivateAddrV6().String())
 		}
+		err = appendSecondaryIPs(ctx, walk, targetNode.NodeID())
+		if err != nil {
+			return err
+		}
 		routes, err := walk.Networking.GetRoutesByNode(ctx, targetNode.NodeID())
 		if err != nil {
 			return fmt.Errorf("get routes by node: %w", err)
@@ -17,6 +17,7 @@ limitations under the License.
 package meshnet
 
 import (
+	"fmt"
 	"slices"
 	"sort"
 	"testing"
@@ -317,3 +318,187 @@ func TestWireGuardPeersWithACLs(t *testing.T) {
 		})
 	}
 }
+
+func TestAsymmetricPeers(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	defer db.Close()
+	err := db.MeshState().SetMeshState(ctx, types.NetworkState{
+		NetworkState: &v1.NetworkState{
+			NetworkV4: "172.16.0.0/12",
+			NetworkV6: "2001:db8::/64",
+			Domain:    "example.com",
+		},
+	})
+	if err != nil {
+		t.Fatalf("set network state: %v", err)
+	}
+	for i, id := range []string{"a", "b", "c"} {
+		err := db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:          id,
+			PublicKey:   mustGeneratePublicKey(t),
+			PrivateIPv4: fmt.Sprintf("172.16.0.%d/32", i+1),
+			PrivateIPv6: fmt.Sprintf("2001:db8::%d/128", i+1),
+		}})
+		if err != nil {
+			t.Fatalf("create peer: %v", err)
+		}
+	}
+	for _, edge := range [][2]string{{"a", "b"}, {"a", "c"}, {"b", "c"}} {
+		err := db.Peers().PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{
+			Source: edge[0],
+			Target: edge[1],
+		}})
+		if err != nil {
+			t.Fatalf("put edge from %q to %q: %v", edge[0], edge[1], err)
+		}
+	}
+	// a and c may talk to anyone, but b may only talk to c. This leaves
+	// the edge between a and b one-directional.
+	acls := []types.NetworkACL{
+		{NetworkACL: &v1.NetworkACL{
+			Name:             "from-a",
+			Action:           v1.ACLAction_ACTION_ACCEPT,
+			SourceNodes:      []string{"a"},
+			DestinationNodes: []string{"*"},
+			SourceCIDRs:      []string{"*"},
+			DestinationCIDRs: []string{"*"},
+		}},
+		{NetworkACL: &v1.NetworkACL{
+			Name:             "from-c",
+			Action:           v1.ACLAction_ACTION_ACCEPT,
+			SourceNodes:      []string{"c"},
+			DestinationNodes: []string{"*"},
+			SourceCIDRs:      []string{"*"},
+			DestinationCIDRs: []string{"*"},
+		}},
+		{NetworkACL: &v1.NetworkACL{
+			Name:             "b-to-c",
+			Action:           v1.ACLAction_ACTION_ACCEPT,
+			SourceNodes:      []string{"b"},
+			DestinationNodes: []string{"c"},
+			SourceCIDRs:      []string{"*"},
+			DestinationCIDRs: []string{"*"},
+		}},
+	}
+	for _, acl := range acls {
+		if err := db.Networking().PutNetworkACL(ctx, acl); err != nil {
+			t.Fatalf("create network ACL: %v", err)
+		}
+	}
+
+	tc := map[string][]types.NodeID{
+		"a": {"b"},
+		"b": nil,
+		"c": nil,
+	}
+	for id, want := range tc {
+		peers, err := WireGuardPeersFor(ctx, db, types.NodeID(id))
+		if err != nil {
+			t.Fatalf("get WireGuard peers for %q: %v", id, err)
+		}
+		got, err := AsymmetricPeersFor(ctx, db, types.NodeID(id), peers)
+		if err != nil {
+			t.Fatalf("get asymmetric peers for %q: %v", id, err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("AsymmetricPeersFor(%q) = %v, want %v", id, got, want)
+		}
+	}
+
+	// The periodic check computes the peers itself and records the result.
+	pm := newPeerManager(&manager{storage: db, nodeID: "a"})
+	pm.checkAsymmetricPeers(ctx)
+	if got := pm.asymmetricPeers(); !slices.Equal(got, tc["a"]) {
+		t.Errorf("asymmetricPeers() = %v, want %v", got, tc["a"])
+	}
+}
+
+func TestWireGuardPeersControlPlaneOnly(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	defer db.Close()
+	err := db.MeshState().SetMeshState(ctx, types.NetworkState{
+		NetworkState: &v1.NetworkState{
+			NetworkV4: "172.16.0.0/12",
+			NetworkV6: "2001:db8::/64",
+			Domain:    "example.com",
+		},
+	})
+	if err != nil {
+		t.Fatalf("set network state: %v", err)
+	}
+	for i, id := range []string{"a", "b", "c"} {
+		err := db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:          id,
+			PublicKey:   mustGeneratePublicKey(t),
+			PrivateIPv4: fmt.Sprintf("172.16.0.%d/32", i+1),
+			PrivateIPv6: fmt.Sprintf("2001:db8::%d/128", i+1),
+		}})
+		if err != nil {
+			t.Fatalf("create peer: %v", err)
+		}
+	}
+	// a only peers with b, which is the only way to reach c.
+	for _, edge := range [][2]string{{"a", "b"}, {"b", "c"}} {
+		err := db.Peers().PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{
+			Source: edge[0],
+			Target: edge[1],
+		}})
+		if err != nil {
+			t.Fatalf("put edge from %q to %q: %v", edge[0], edge[1], err)
+		}
+	}
+	err = db.Networking().PutRoute(ctx, types.Route{Route: &v1.Route{
+		Name:             "b-route",
+		Node:             "b",
+		DestinationCIDRs: []string{"10.10.0.0/16"},
+	}})
+	if err != nil {
+		t.Fatalf("put route: %v", err)
+	}
+	acls := []types.NetworkACL{
+		{NetworkACL: &v1.NetworkACL{
+			Name:             "a-and-b",
+			Action:           v1.ACLAction_ACTION_ACCEPT,
+			SourceNodes:      []string{"a", "b"},
+			DestinationNodes: []string{"a", "b"},
+			SourceCIDRs:      []string{"*"},
+			DestinationCIDRs: []string{"*"},
+		}, InternalOnly: true},
+		{NetworkACL: &v1.NetworkACL{
+			Name:             "a-to-c",
+			Action:           v1.ACLAction_ACTION_ACCEPT,
+			SourceNodes:      []string{"a", "c"},
+			DestinationNodes: []string{"a", "c"},
+			SourceCIDRs:      []string{"*"},
+			DestinationCIDRs: []string{"*"},
+		}},
+	}
+	for _, acl := range acls {
+		if err := db.Networking().PutNetworkACL(ctx, acl); err != nil {
+			t.Fatalf("create network ACL: %v", err)
+		}
+	}
+
+	peers, err := WireGuardPeersFor(ctx, db, "a")
+	if err != nil {
+		t.Fatalf("get WireGuard peers: %v", err)
+	}
+	if len(peers) != 1 || peers[0].GetNode().GetId() != "b" {
+		t.Fatalf("expected b to be the only peer of a, got %v", peers)
+	}
+	// b is only reachable at its own addresses, and is neither used to
+	// reach c nor its own route.
+	want := []string{"172.16.0.2/32", "2001:db8::2/128"}
+	got := slices.Clone(peers[0].GetAllowedIPs())
+	sort.Strings(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("expected allowed IPs %v for control-plane only peer, got %v", want, got)
+	}
+	if len(peers[0].GetAllowedRoutes()) != 0 {
+		t.Errorf("expected no allowed routes for control-plane only peer, got %v", peers[0].GetAllowedRoutes())
+	}
+}
@@ -19,6 +19,7 @@ package meshnet
 import (
 	"net/netip"
 	"reflect"
+	"slices"
 	"sort"
 	"testing"
 
@@ -201,18 +202,17 @@ func TestWireGuardPeersAllowedIPs(t *testing.T) {
 			wantIPs: map[string]map[string][]string{
 				"site1-router": {
 					"site2-router": {
-						// Site 2 is reachable via site 2 router
+						// Site 2 is reachable via site 2 router,
+						// with adjacent IPv6 addresses aggregated.
 						"172.16.0.2/32", "2001:db8::2/128",
 						"172.16.0.7/32", "2001:db8::7/128",
-						"172.16.0.8/32", "2001:db8::8/128",
-						"172.16.0.9/32", "2001:db8::9/128",
+						"172.16.0.8/32", "172.16.0.9/32", "2001:db8::8/127",
 					},
 					"site3-router": {
-						// Site 3 is reachable via site 3 router
+						// Site 3 is reachable via site 3 router,
+						// with adjacent IPv6 addresses aggregated.
 						"172.16.0.3/32", "2001:db8::3/128",
-						"172.16.0.10/32", "2001:db8::10/128",
-						"172.16.0.11/32", "2001:db8::11/128",
-						"172.16.0.12/32", "2001:db8::12/128",
+						"172.16.0.10/32", "172.16.0.11/32", "172.16.0.12/32", "2001:db8::10/127", "2001:db8::12/128",
 					},
 					"site1-follower-1": {"172.16.0.4/32", "2001:db8::4/128"},
 					"site1-follower-2": {"172.16.0.5/32", "2001:db8::5/128"},
@@ -220,18 +220,17 @@ func TestWireGuardPeersAllowedIPs(t *testing.T) {
 				},
 				"site2-router": {
 					"site1-router": {
-						// Site 1 is reachable via site 1 router
+						// Site 1 is reachable via site 1 router,
+						// with adjacent IPv6 addresses aggregated.
 						"172.16.0.1/32", "2001:db8::1/128",
-						"172.16.0.4/32", "2001:db8::4/128",
-						"172.16.0.5/32", "2001:db8::5/128",
+						"172.16.0.4/32", "172.16.0.5/32", "2001:db8::4/127",
 						"172.16.0.6/32", "2001:db8::6/128",
 					},
 					"site3-router": {
-						// Site 3 is reachable via site 3 router
+						// Site 3 is reachable via site 3 router,
+						// with adjacent IPv6 addresses aggregated.
 						"172.16.0.3/32", "2001:db8::3/128",
-						"172.16.0.10/32", "2001:db8::10/128",
-						"172.16.0.11/32", "2001:db8::11/128",
-						"172.16.0.12/32", "2001:db8::12/128",
+						"172.16.0.10/32", "172.16.0.11/32", "172.16.0.12/32", "2001:db8::10/127", "2001:db8::12/128",
 					},
 					"site2-follower-1": {"172.16.0.7/32", "2001:db8::7/128"},
 					"site2-follower-2": {"172.16.0.8/32", "2001:db8::8/128"},
@@ -239,18 +238,18 @@ func TestWireGuardPeersAllowedIPs(t *testing.T) {
 				},
 				"site3-router": {
 					"site1-router": {
-						// Site 1 is reachable via site 1 router
+						// Site 1 is reachable via site 1 router,
+						// with adjacent IPv6 addresses aggregated.
 						"172.16.0.1/32", "2001:db8::1/128",
-						"172.16.0.4/32", "2001:db8::4/128",
-						"172.16.0.5/32", "2001:db8::5/128",
+						"172.16.0.4/32", "172.16.0.5/32", "2001:db8::4/127",
 						"172.16.0.6/32", "2001:db8::6/128",
 					},
 					"site2-router": {
-						// Site 2 is reachable via site 2 router
+						// Site 2 is reachable via site 2 router,
+						// with adjacent IPv6 addresses aggregated.
 						"172.16.0.2/32", "2001:db8::2/128",
 						"172.16.0.7/32", "2001:db8::7/128",
-						"172.16.0.8/32", "2001:db8::8/128",
-						"172.16.0.9/32", "2001:db8::9/128",
+						"172.16.0.8/32", "172.16.0.9/32", "2001:db8::8/127",
 					},
 					"site3-follower-1": {"172.16.0.10/32", "2001:db8::10/128"},
 					"site3-follower-2": {"172.16.0.11/32", "2001:db8::11/128"},
@@ -398,3 +397,195 @@ func mustGeneratePublicKey(t *testing.T) string {
 	}
 	return encoded
 }
+
+func TestWireGuardPeersIPv6Aggregation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	defer db.Close()
+	err := db.MeshState().SetMeshState(ctx, types.NetworkState{NetworkState: &v1.NetworkState{
+		NetworkV4: "172.16.0.0/12",
+		NetworkV6: "2001:db8::/64",
+		Domain:    "webmesh.internal",
+	}})
+	if err != nil {
+		t.Fatalf("set network state: %v", err)
+	}
+	err = db.Networking().PutNetworkACL(ctx, types.NetworkACL{NetworkACL: &v1.NetworkACL{
+		Name:             "allow-all",
+		Action:           v1.ACLAction_ACTION_ACCEPT,
+		SourceNodes:      []string{"*"},
+		DestinationNodes: []string{"*"},
+		SourceCIDRs:      []string{"*"},
+		DestinationCIDRs: []string{"*"},
+	}})
+	if err != nil {
+		t.Fatalf("put network acl: %v", err)
+	}
+	// Each site is allocated a contiguous block of IPv6 addresses.
+	peers := map[string]string{
+		"site1-router":     "2001:db8::1:1/128",
+		"site1-follower-1": "2001:db8::1:2/128",
+		"site1-follower-2": "2001:db8::1:3/128",
+		"site2-router":     "2001:db8::2:1/128",
+		"site2-follower-1": "2001:db8::2:2/128",
+		"site2-follower-2": "2001:db8::2:3/128",
+		"site2-follower-3": "2001:db8::2:4/128",
+		"site3-router":     "2001:db8::3:1/128",
+		"site3-follower-1": "2001:db8::3:2/128",
+		"site3-follower-2": "2001:db8::3:3/128",
+	}
+	edges := map[string][]string{
+		"site1-router": {"site2-router", "site3-router", "site1-follower-1", "site1-follower-2"},
+		"site2-router": {"site3-router", "site2-follower-1", "site2-follower-2", "site2-follower-3"},
+		"site3-router": {"site3-follower-1", "site3-follower-2"},
+	}
+	// The peer each address should be routed through from site1-router.
+	wantNextHop := map[string]string{
+		"site1-follower-1": "site1-follower-1",
+		"site1-follower-2": "site1-follower-2",
+		"site2-router":     "site2-router",
+		"site2-follower-1": "site2-router",
+		"site2-follower-2": "site2-router",
+		"site2-follower-3": "site2-router",
+		"site3-router":     "site3-router",
+		"site3-follower-1": "site3-router",
+		"site3-follower-2": "site3-router",
+	}
+	for peerID, addr := range peers {
+		err = db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:          peerID,
+			PublicKey:   mustGeneratePublicKey(t),
+			PrivateIPv6: addr,
+		}})
+		if err != nil {
+			t.Fatalf("put peer %q: %v", peerID, err)
+		}
+	}
+	for source, targets := range edges {
+		for _, target := range targets {
+			err = db.Peers().PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{Source: source, Target: target}})
+			if err != nil {
+				t.Fatalf("put edge from %q to %q: %v", source, target, err)
+			}
+		}
+	}
+
+	wgpeers, err := WireGuardPeersFor(ctx, db, "site1-router")
+	if err != nil {
+		t.Fatalf("get peers: %v", err)
+	}
+	var entries int
+	for _, peer := range wgpeers {
+		entries += len(peer.AllowedIPs)
+	}
+	if entries >= len(wantNextHop) {
+		t.Errorf("expected aggregation to produce fewer than %d entries, got %d", len(wantNextHop), entries)
+	}
+	// Every address must still be routed through the same peer by longest prefix match.
+	for node, want := range wantNextHop {
+		addr := netip.MustParsePrefix(peers[node]).Addr()
+		got, best := "", -1
+		for _, peer := range wgpeers {
+			for _, allowedIP := range peer.AllowedIPs {
+				prefix := netip.MustParsePrefix(allowedIP)
+				if prefix.Contains(addr) && prefix.Bits() > best {
+					got, best = peer.GetNode().GetId(), prefix.Bits()
+				}
+			}
+		}
+		if got != want {
+			t.Errorf("expected %s to be routed via %s, got %q", node, want, got)
+		}
+	}
+	// Our own address must not be covered by any aggregated prefix.
+	local := netip.MustParsePrefix(peers["site1-router"]).Addr()
+	for _, peer := range wgpeers {
+		for _, allowedIP := range peer.AllowedIPs {
+			if netip.MustParsePrefix(allowedIP).Contains(local) {
+				t.Errorf("local address is covered by %s via %s", allowedIP, peer.GetNode().GetId())
+			}
+		}
+	}
+}
+
+func TestWireGuardPeersIPv6AggregationSkipsDeniedNodes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	defer db.Close()
+	err := db.MeshState().SetMeshState(ctx, types.NetworkState{NetworkState: &v1.NetworkState{
+		NetworkV4: "172.16.0.0/12",
+		NetworkV6: "2001:db8::/64",
+		Domain:    "webmesh.internal",
+	}})
+	if err != nil {
+		t.Fatalf("set network state: %v", err)
+	}
+	// Node x sits between the addresses routed through b, but the ACL
+	// does not allow a to reach it.
+	peers := map[string]string{
+		"a": "2001:db8::1/128",
+		"z": "2001:db8::2/128",
+		"b": "2001:db8::3/128",
+		"c": "2001:db8::4/128",
+		"x": "2001:db8::5/128",
+		"d": "2001:db8::6/128",
+		"e": "2001:db8::7/128",
+	}
+	allowed := []string{"a", "z", "b", "c", "d", "e"}
+	err = db.Networking().PutNetworkACL(ctx, types.NetworkACL{NetworkACL: &v1.NetworkACL{
+		Name:             "allow-some",
+		Action:           v1.ACLAction_ACTION_ACCEPT,
+		SourceNodes:      allowed,
+		DestinationNodes: allowed,
+		SourceCIDRs:      []string{"*"},
+		DestinationCIDRs: []string{"*"},
+	}})
+	if err != nil {
+		t.Fatalf("put network acl: %v", err)
+	}
+	for peerID, addr := range peers {
+		err = db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:          peerID,
+			PublicKey:   mustGeneratePublicKey(t),
+			PrivateIPv6: addr,
+		}})
+		if err != nil {
+			t.Fatalf("put peer %q: %v", peerID, err)
+		}
+	}
+	edges := map[string][]string{
+		"a": {"z", "b"},
+		"b": {"c", "x", "d", "e"},
+	}
+	for source, targets := range edges {
+		for _, target := range targets {
+			err = db.Peers().PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{Source: source, Target: target}})
+			if err != nil {
+				t.Fatalf("put edge from %q to %q: %v", source, target, err)
+			}
+		}
+	}
+
+	wgpeers, err := WireGuardPeersFor(ctx, db, "a")
+	if err != nil {
+		t.Fatalf("get peers: %v", err)
+	}
+	denied := netip.MustParsePrefix(peers["x"]).Addr()
+	for _, peer := range wgpeers {
+		for _, allowedIP := range peer.AllowedIPs {
+			if netip.MustParsePrefix(allowedIP).Contains(denied) {
+				t.Errorf("denied node x is covered by %s via %s", allowedIP, peer.GetNode().GetId())
+			}
+		}
+		if peer.GetNode().GetId() == "b" {
+			got := slices.Clone(peer.AllowedIPs)
+			slices.Sort(got)
+			want := []string{"2001:db8::3/128", "2001:db8::4/128", "2001:db8::6/127"}
+			if !slices.Equal(got, want) {
+				t.Errorf("expected allowed IPs %v via b, got %v", want, got)
+			}
+		}
+	}
+}
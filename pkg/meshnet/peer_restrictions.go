@@ -0,0 +1,102 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system/firewall"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// restrictControlPlanePeers limits the traffic accepted from peers that network
+// ACLs only allow control-plane traffic from to the control-plane ports they may
+// reach, and lifts the restriction from peers that no longer need it. It is a
+// no-op when the firewall cannot restrict sources. Must be called with peermu held.
+func (m *peerManager) restrictControlPlanePeers(ctx context.Context, wgpeers []*v1.WireGuardPeer) error {
+	restricter, ok := m.net.fw.(firewall.SourceRestricter)
+	if !ok || m.storage == nil {
+		return nil
+	}
+	want, err := m.controlPlaneRestrictions(ctx, wgpeers)
+	if err != nil {
+		return err
+	}
+	for prefix := range m.restricted {
+		if _, ok := want[prefix]; ok {
+			continue
+		}
+		if err := restricter.UnrestrictSource(ctx, prefix); err != nil {
+			return fmt.Errorf("unrestrict %s: %w", prefix, err)
+		}
+		delete(m.restricted, prefix)
+	}
+	for prefix, ports := range want {
+		context.LoggerFrom(ctx).Debug("Restricting control-plane only peer", slog.String("prefix", prefix.String()), slog.Any("ports", ports))
+		if err := restricter.RestrictSource(ctx, prefix, ports); err != nil {
+			return fmt.Errorf("restrict %s: %w", prefix, err)
+		}
+		m.restricted[prefix] = struct{}{}
+	}
+	return nil
+}
+
+// controlPlaneRestrictions returns the mesh addresses of the given peers that are
+// only allowed control-plane traffic to us, along with the ports they may reach.
+func (m *peerManager) controlPlaneRestrictions(ctx context.Context, wgpeers []*v1.WireGuardPeer) (map[netip.Prefix][]uint16, error) {
+	want := make(map[netip.Prefix][]uint16)
+	acls, err := m.storage.Networking().ListNetworkACLs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list network acls: %w", err)
+	}
+	if len(acls) == 0 {
+		return want, nil
+	}
+	err = storage.ExpandACLs(ctx, m.storage.RBAC(), acls)
+	if err != nil {
+		return nil, fmt.Errorf("expand network acls: %w", err)
+	}
+	acls.Sort(types.SortDescending)
+	self, err := m.storage.Peers().Get(ctx, m.net.nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("get self: %w", err)
+	}
+	for _, wgpeer := range wgpeers {
+		peer := types.MeshNode{MeshNode: wgpeer.GetNode()}
+		if acls.AllowDataPlane(ctx, peer, self) {
+			continue
+		}
+		ports := make([]uint16, 0)
+		for _, port := range self.ControlPlanePorts() {
+			if acls.AllowTraffic(ctx, peer, self, port) {
+				ports = append(ports, port)
+			}
+		}
+		for _, addr := range []netip.Prefix{peer.PrivateAddrV4(), peer.PrivateAddrV6()} {
+			if addr.IsValid() {
+				want[addr] = ports
+			}
+		}
+	}
+	return want, nil
+}
@@ -24,6 +24,7 @@ import (
 	"log/slog"
 	"net"
 	"net/netip"
+	"slices"
 	"sync"
 	"time"
 
@@ -33,7 +34,6 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/crypto"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/endpoints"
-	"github.com/webmeshproj/webmesh/pkg/meshnet/netutil"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/relay"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/datachannels"
@@ -59,6 +59,12 @@ type PeerManager interface {
 	// Resolver returns a resolver backed by the storage
 	// of this instance.
 	Resolver() PeerResolver
+	// Sessions returns the active ICE and libp2p relay sessions to peers.
+	Sessions() []Session
+	// KillSession closes the relay session to the given peer. The session is
+	// negotiated again on the next refresh if the peer is still in the mesh.
+	// ErrSessionNotFound is returned if there is no session to the peer.
+	KillSession(ctx context.Context, peerID types.NodeID) error
 }
 
 // PeerFilterFunc is a function that can be used to filter responses returned by a resolver.
@@ -73,27 +79,61 @@ type PeerResolver interface {
 }
 
 type peerManager struct {
-	net      *manager
-	storage  storage.MeshDB
-	p2pConns map[string]clientPeerConn
-	peermu   sync.Mutex
-	p2pmu    sync.Mutex
+	net        *manager
+	storage    storage.MeshDB
+	p2pConns   map[string]clientPeerConn
+	asymmetric []types.NodeID
+	// added tracks when each peer was first configured on the interface
+	// so that new peers are given the full handshake window.
+	added map[string]time.Time
+	// pings runs liveness probes for added peers on a bounded pool.
+	pings *pingPool
+	// hostnames tracks peers whose endpoint is a hostname so that it can
+	// be resolved again if the address behind it changes.
+	hostnames map[string]hostnamePeer
+	// applied is the last list of peers that was fully applied by Refresh.
+	applied []*v1.WireGuardPeer
+	// endpoints persists direct peer endpoints across restarts when enabled.
+	endpoints      *endpointCache
+	resolveUDPAddr func(network, address string) (*net.UDPAddr, error)
+	// probes caches direct reachability probes of ICE peers under PreferDirect.
+	probes map[string]directProbe
+	// restricted are the peer addresses the firewall only accepts control-plane
+	// traffic from.
+	restricted map[netip.Prefix]struct{}
+	peermu     sync.Mutex
+	p2pmu      sync.Mutex
+	probemu    sync.Mutex
 }
 
 func newPeerManager(m *manager) *peerManager {
+	var endpoints *endpointCache
+	if m.opts.EndpointCacheFile != "" {
+		endpoints = newEndpointCache(m.opts.EndpointCacheFile, m.opts.EndpointCacheTTL)
+	}
 	return &peerManager{
 		net:      m,
 		storage:  m.storage,
 		p2pConns: make(map[string]clientPeerConn),
+		added:    make(map[string]time.Time),
+		pings:    newPingPool(m.opts.PeerPingConcurrency, m.opts.PeerPingTimeout, nil),
+
+		hostnames:      make(map[string]hostnamePeer),
+		endpoints:      endpoints,
+		resolveUDPAddr: net.ResolveUDPAddr,
+		probes:         make(map[string]directProbe),
+		restricted:     make(map[netip.Prefix]struct{}),
 	}
 }
 
 type clientPeerConn struct {
 	peerConn  io.Closer
 	localAddr netip.AddrPort
+	started   time.Time
 }
 
 func (m *peerManager) Close(ctx context.Context) {
+	m.pings.Close()
 	m.peermu.Lock()
 	defer m.peermu.Unlock()
 	for _, conn := range m.p2pConns {
@@ -117,7 +157,42 @@ func (m *peerManager) Add(ctx context.Context, peer *v1.WireGuardPeer, iceServer
 	}
 	log := context.LoggerFrom(ctx).With("component", "net-manager")
 	ctx = context.WithLogger(ctx, log)
-	return m.addPeer(ctx, peer, iceServers)
+	if err := m.addPeer(ctx, peer, iceServers); err != nil {
+		return err
+	}
+	m.saveEndpoints(ctx)
+	return nil
+}
+
+// replace swaps oldPeer for newPeer on the wireguard interface. A peer that
+// keeps its ID is put again without being removed first, so its relayed
+// connection is reused rather than negotiated again.
+func (m *peerManager) replace(ctx context.Context, oldPeer, newPeer *v1.WireGuardPeer, iceServers []string) error {
+	m.peermu.Lock()
+	defer m.peermu.Unlock()
+	if m.net.WireGuard() == nil {
+		return errors.New("replace peer called before wireguard interface is ready")
+	}
+	log := context.LoggerFrom(ctx).With("component", "net-manager")
+	ctx = context.WithLogger(ctx, log)
+	oldID, newID := oldPeer.GetNode().GetId(), newPeer.GetNode().GetId()
+	if oldID != newID {
+		log.Debug("Replacing peer with a different ID", slog.String("old_id", oldID), slog.String("new_id", newID))
+		if err := m.removePeer(ctx, oldID); err != nil {
+			return fmt.Errorf("delete peer: %w", err)
+		}
+	}
+	if err := m.addPeer(ctx, newPeer, iceServers); err != nil {
+		return err
+	}
+	for i, peer := range m.applied {
+		if peer.GetNode().GetId() == oldID {
+			m.applied[i] = newPeer
+			break
+		}
+	}
+	m.saveEndpoints(ctx)
+	return nil
 }
 
 func (m *peerManager) Sync(ctx context.Context) error {
@@ -131,6 +206,7 @@ func (m *peerManager) Sync(ctx context.Context) error {
 func (m *peerManager) Refresh(ctx context.Context, wgpeers []*v1.WireGuardPeer) error {
 	m.peermu.Lock()
 	defer m.peermu.Unlock()
+	defer m.net.markPeersRefreshed()
 	if m.net.WireGuard() == nil {
 		return errors.New("refresh peers called before wireguard interface is ready")
 	}
@@ -153,23 +229,188 @@ func (m *peerManager) Refresh(ctx context.Context, wgpeers []*v1.WireGuardPeer)
 	for peer := range currentPeers {
 		if _, ok := seenPeers[peer]; !ok {
 			log.Debug("Removing peer", slog.String("peer_id", peer))
-			m.p2pmu.Lock()
-			if conn, ok := m.p2pConns[peer]; ok {
-				conn.peerConn.Close()
-				delete(m.p2pConns, peer)
-			}
-			m.p2pmu.Unlock()
-			if err := m.net.WireGuard().DeletePeer(ctx, peer); err != nil {
+			if err := m.removePeer(ctx, peer); err != nil {
 				errs = append(errs, fmt.Errorf("delete peer: %w", err))
 			}
 		}
 	}
+	if err := m.restrictControlPlanePeers(ctx, wgpeers); err != nil {
+		log.Error("Error restricting control-plane only peers", slog.String("error", err.Error()))
+		errs = append(errs, fmt.Errorf("restrict control-plane peers: %w", err))
+	}
 	if len(errs) > 0 {
+		m.applied = nil
 		return errors.Join(errs...)
 	}
+	m.applied = append([]*v1.WireGuardPeer{}, wgpeers...)
+	if m.endpoints != nil {
+		m.endpoints.retain(seenPeers)
+		m.saveEndpoints(ctx)
+	}
 	return nil
 }
 
+// saveEndpoints writes the endpoint cache to disk if it is enabled.
+func (m *peerManager) saveEndpoints(ctx context.Context) {
+	if m.endpoints == nil {
+		return
+	}
+	if err := m.endpoints.save(); err != nil {
+		context.LoggerFrom(ctx).Warn("Failed to save peer endpoint cache", slog.String("error", err.Error()))
+	}
+}
+
+// removePeer closes any relayed connection to the peer and removes it from
+// the wireguard interface. Must be called with peermu held.
+func (m *peerManager) removePeer(ctx context.Context, id string) error {
+	m.p2pmu.Lock()
+	if conn, ok := m.p2pConns[id]; ok {
+		conn.peerConn.Close()
+		delete(m.p2pConns, id)
+	}
+	m.p2pmu.Unlock()
+	m.probemu.Lock()
+	delete(m.probes, id)
+	m.probemu.Unlock()
+	delete(m.added, id)
+	delete(m.hostnames, id)
+	m.unshapePeer(ctx, id)
+	m.unproxyPeerNDP(ctx, id)
+	return m.net.WireGuard().DeletePeer(ctx, id)
+}
+
+// runHandshakeSweep periodically removes peers that have not completed a
+// handshake within the given timeout until the context is canceled.
+func (m *peerManager) runHandshakeSweep(ctx context.Context, timeout time.Duration) {
+	log := context.LoggerFrom(ctx)
+	t := time.NewTicker(timeout / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			if err := m.sweepStalePeers(ctx, timeout, now); err != nil {
+				log.Warn("Error sweeping stale wireguard peers", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// sweepStalePeers removes peers from the wireguard interface whose last handshake,
+// or the time they were added if they never completed one, is older than the timeout.
+// Removed peers that are still in the store are put back on the next refresh. Peers
+// without a persistent keepalive only handshake when there is traffic to them, so
+// they are left alone rather than swept for being idle.
+func (m *peerManager) sweepStalePeers(ctx context.Context, timeout time.Duration, now time.Time) error {
+	m.peermu.Lock()
+	defer m.peermu.Unlock()
+	if m.net.WireGuard() == nil {
+		return errors.New("sweep peers called before wireguard interface is ready")
+	}
+	log := context.LoggerFrom(ctx)
+	metrics, err := m.net.WireGuard().Metrics()
+	if err != nil {
+		return fmt.Errorf("get wireguard metrics: %w", err)
+	}
+	handshakes := make(map[string]time.Time, len(metrics.GetPeers()))
+	for _, peer := range metrics.GetPeers() {
+		last, err := time.Parse(time.RFC3339, peer.GetLastHandshakeTime())
+		if err != nil {
+			continue
+		}
+		handshakes[peer.GetPublicKey()] = last
+	}
+	errs := make([]error, 0)
+	for id, peer := range m.net.WireGuard().Peers() {
+		if peer.PublicKey == nil {
+			continue
+		}
+		keepAlive := m.net.opts.PersistentKeepAlive
+		if peer.PersistentKeepAlive != nil {
+			keepAlive = *peer.PersistentKeepAlive
+		}
+		if keepAlive <= 0 {
+			continue
+		}
+		lastSeen, ok := m.added[id]
+		if !ok {
+			// We didn't configure this peer, start its window now.
+			m.added[id] = now
+			continue
+		}
+		if last := handshakes[peer.PublicKey.WireGuardKey().String()]; last.After(lastSeen) {
+			lastSeen = last
+		}
+		if now.Sub(lastSeen) <= timeout {
+			continue
+		}
+		log.Info("Removing peer that has not completed a handshake",
+			slog.String("peer_id", id),
+			slog.Time("last_seen", lastSeen))
+		if err := m.removePeer(ctx, id); err != nil {
+			errs = append(errs, fmt.Errorf("delete peer: %w", err))
+		}
+		// A peer reachable over TCP may still have its WireGuard port blocked.
+		m.markDirectUnreachable(id)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// runAsymmetricCheck checks for asymmetric peers every interval until the
+// context is canceled.
+func (m *peerManager) runAsymmetricCheck(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.checkAsymmetricPeers(ctx)
+		}
+	}
+}
+
+// checkAsymmetricPeers records the peers that won't route traffic back to us,
+// and warns about any that weren't already known. The peers are computed from
+// the store without holding peermu, since it walks the graph once per peer.
+func (m *peerManager) checkAsymmetricPeers(ctx context.Context) {
+	if m.storage == nil {
+		return
+	}
+	log := context.LoggerFrom(ctx)
+	wgpeers, err := WireGuardPeersFor(ctx, m.storage, m.net.nodeID)
+	if err != nil {
+		log.Debug("Could not check for asymmetric peers", slog.String("error", err.Error()))
+		return
+	}
+	asymmetric, err := AsymmetricPeersFor(ctx, m.storage, m.net.nodeID, wgpeers)
+	if err != nil {
+		log.Debug("Could not check for asymmetric peers", slog.String("error", err.Error()))
+		return
+	}
+	m.peermu.Lock()
+	defer m.peermu.Unlock()
+	for _, peer := range asymmetric {
+		if !slices.Contains(m.asymmetric, peer) {
+			log.Warn("Peer does not route our mesh addresses back to us, traffic to it will be one-way",
+				slog.String("peer_id", peer.String()))
+		}
+	}
+	m.asymmetric = asymmetric
+}
+
+// asymmetricPeers returns the peers found to be asymmetric during the last check.
+func (m *peerManager) asymmetricPeers() []types.NodeID {
+	m.peermu.Lock()
+	defer m.peermu.Unlock()
+	return slices.Clone(m.asymmetric)
+}
+
 func (m *peerManager) addPeer(ctx context.Context, peer *v1.WireGuardPeer, iceServers []string) error {
 	log := context.LoggerFrom(ctx)
 	key, err := crypto.DecodePublicKey(peer.GetNode().GetPublicKey())
@@ -191,7 +432,7 @@ func (m *peerManager) addPeer(ctx context.Context, peer *v1.WireGuardPeer, iceSe
 	}
 	endpoint, err := m.determinePeerEndpoint(ctx, peer, iceServers)
 	if err != nil {
-		if peer.GetProto() == v1.ConnectProtocol_CONNECT_NATIVE {
+		if peer.GetProto() == v1.ConnectProtocol_CONNECT_NATIVE || m.isDirectOnly(peer.GetNode().GetId()) {
 			return fmt.Errorf("determine peer endpoint: %w", err)
 		}
 		// If this is a p2p peer, we'll entertain that they might be able
@@ -248,7 +489,9 @@ func (m *peerManager) addPeer(ctx context.Context, peer *v1.WireGuardPeer, iceSe
 		PrivateIPv6:     priv6,
 		AllowedIPs:      allowedIPs,
 		AllowedRoutes:   allowedRoutes,
+		PresharedKey:    m.net.opts.PresharedKey,
 	}
+	wgpeer.PersistentKeepAlive = m.keepAliveFor(peer)
 	for _, addr := range peer.GetNode().GetMultiaddrs() {
 		ma, err := multiaddr.NewMultiaddr(addr)
 		if err == nil {
@@ -260,57 +503,58 @@ func (m *peerManager) addPeer(ctx context.Context, peer *v1.WireGuardPeer, iceSe
 	if err != nil {
 		return fmt.Errorf("put wireguard peer: %w", err)
 	}
+	if _, ok := m.added[wgpeer.ID]; !ok {
+		m.added[wgpeer.ID] = time.Now()
+	}
+	m.cacheEndpoint(ctx, peer, &wgpeer)
+	m.shapePeer(ctx, &wgpeer)
+	m.proxyPeerNDP(ctx, &wgpeer)
+	m.trackHostnamePeer(peer)
+	if m.net.opts.DisablePeerPing {
+		return nil
+	}
 	// Try to ping the peer to establish a connection
-	go func() {
-		// TODO: make this configurable
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		var addr netip.Prefix
-		var err error
-		if !m.net.opts.DisableIPv4 && peer.GetNode().GetPrivateIPv4() != "" {
-			addr, err = netip.ParsePrefix(peer.GetNode().GetPrivateIPv4())
-		} else {
-			addr, err = netip.ParsePrefix(peer.GetNode().GetPrivateIPv6())
-		}
-		if err != nil {
-			log.Warn("Could not parse peer address", slog.String("error", err.Error()))
-			return
-		}
-		err = netutil.Ping(ctx, addr.Addr())
-		if err != nil {
-			log.Debug("Could not ping descendant", slog.String("descendant", peer.GetNode().GetId()), slog.String("error", err.Error()))
-			return
-		}
-		log.Debug("Successfully pinged descendant", slog.String("descendant", peer.GetNode().GetId()))
-	}()
+	var addr netip.Prefix
+	if !m.net.opts.DisableIPv4 && peer.GetNode().GetPrivateIPv4() != "" {
+		addr, err = netip.ParsePrefix(peer.GetNode().GetPrivateIPv4())
+	} else {
+		addr, err = netip.ParsePrefix(peer.GetNode().GetPrivateIPv6())
+	}
+	if err != nil {
+		log.Warn("Could not parse peer address", slog.String("error", err.Error()))
+		return nil
+	}
+	m.pings.Enqueue(ctx, peer.GetNode().GetId(), addr.Addr())
 	return nil
 }
 
 func (m *peerManager) determinePeerEndpoint(ctx context.Context, peer *v1.WireGuardPeer, iceServers []string) (netip.AddrPort, error) {
 	log := context.LoggerFrom(ctx)
 	var endpoint netip.AddrPort
-	if peer.GetProto() == v1.ConnectProtocol_CONNECT_ICE {
-		return m.negotiateICEConn(ctx, peer, iceServers)
-	}
-	if peer.GetProto() == v1.ConnectProtocol_CONNECT_LIBP2P {
+	directOnly := m.isDirectOnly(peer.GetNode().GetId())
+	if directOnly && peer.GetProto() != v1.ConnectProtocol_CONNECT_NATIVE {
+		log.Debug("Peer is configured as direct-only, skipping relay negotiation",
+			slog.String("peer", peer.GetNode().GetId()),
+			slog.String("proto", peer.GetProto().String()))
+	} else if peer.GetProto() == v1.ConnectProtocol_CONNECT_ICE {
+		if !m.directReachable(ctx, peer) {
+			return m.negotiateICEConn(ctx, peer, iceServers)
+		}
+		log.Debug("ICE peer is directly reachable, skipping ICE negotiation", slog.String("peer", peer.GetNode().GetId()))
+		m.closeICEConn(ctx, peer.GetNode().GetId())
+	} else if peer.GetProto() == v1.ConnectProtocol_CONNECT_LIBP2P {
 		return m.negotiateP2PRelay(ctx, peer)
 	}
-	// TODO: We don't honor ipv4/ipv6 preferences currently in this function
 	if peer.GetNode().GetPrimaryEndpoint() != "" {
-		addr, err := net.ResolveUDPAddr("udp", peer.GetNode().GetPrimaryEndpoint())
-		if err != nil {
+		var err error
+		endpoint, err = m.resolveEndpoint(peer.GetNode().GetPrimaryEndpoint())
+		if errors.Is(err, ErrLinkLocalEndpoint) {
+			log.Warn("Skipping link-local peer endpoint, set a link-local endpoint interface to use it",
+				slog.String("peer", peer.GetNode().GetId()),
+				slog.String("endpoint", peer.GetNode().GetPrimaryEndpoint()))
+		} else if err != nil {
 			return endpoint, fmt.Errorf("resolve primary endpoint: %w", err)
 		}
-		if addr.AddrPort().Addr().Is4In6() {
-			// This is an IPv4 address masquerading as an IPv6 address.
-			// We need to convert it to a real IPv4 address.
-			// This is a workaround for a bug in Go's net package.
-			addr = &net.UDPAddr{
-				IP:   addr.IP.To4(),
-				Port: addr.Port,
-			}
-		}
-		endpoint = addr.AddrPort()
 	}
 	// Check if we are using zone awareness and the peer is in the same zone
 	if m.net.opts.ZoneAwarenessID != "" && peer.GetNode().GetZoneAwarenessID() == m.net.opts.ZoneAwarenessID {
@@ -328,22 +572,14 @@ func (m *peerManager) determinePeerEndpoint(ctx context.Context, peer *v1.WireGu
 		// check if any of the additional endpoints are in our zone
 		if !localCIDRs.Contains(endpoint.Addr()) && len(peer.GetNode().GetWireguardEndpoints()) > 0 {
 			for _, additionalEndpoint := range peer.GetNode().GetWireguardEndpoints() {
-				addr, err := net.ResolveUDPAddr("udp", additionalEndpoint)
+				ep, err := m.resolveEndpoint(additionalEndpoint)
 				if err != nil {
 					log.Error("could not resolve peer primary endpoint", slog.String("error", err.Error()))
 					continue
 				}
-				if addr.AddrPort().Addr().Is4In6() {
-					// Same as above, this is an IPv4 address masquerading as an IPv6 address.
-					addr = &net.UDPAddr{
-						IP:   addr.IP.To4(),
-						Port: addr.Port,
-					}
-				}
 				log.Debug("Evalauting zone awareness endpoint",
-					slog.String("endpoint", addr.String()),
+					slog.String("endpoint", ep.String()),
 					slog.String("zone", peer.GetNode().GetZoneAwarenessID()))
-				ep := addr.AddrPort()
 				if localCIDRs.Contains(ep.Addr()) {
 					// We found an additional endpoint that is in one of our local
 					// CIDRs. We'll use this one instead.
@@ -354,9 +590,22 @@ func (m *peerManager) determinePeerEndpoint(ctx context.Context, peer *v1.WireGu
 			}
 		}
 	}
+	if directOnly && !endpoint.IsValid() {
+		return endpoint, fmt.Errorf("no direct endpoint available for direct-only peer %s", peer.GetNode().GetId())
+	}
 	return endpoint, nil
 }
 
+// isDirectOnly returns true if the given peer must only be connected to directly.
+func (m *peerManager) isDirectOnly(peerID string) bool {
+	for _, id := range m.net.opts.DirectOnlyPeers {
+		if id == peerID {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *peerManager) negotiateP2PRelay(ctx context.Context, peer *v1.WireGuardPeer) (netip.AddrPort, error) {
 	log := context.LoggerFrom(ctx)
 	m.p2pmu.Lock()
@@ -414,6 +663,7 @@ func (m *peerManager) negotiateP2PRelay(ctx context.Context, peer *v1.WireGuardP
 	peerconn := clientPeerConn{
 		peerConn:  relay,
 		localAddr: relay.LocalAddr().AddrPort(),
+		started:   time.Now(),
 	}
 	m.p2pConns[peer.GetNode().GetId()] = peerconn
 	return peerconn.localAddr, nil
@@ -439,22 +689,27 @@ func (m *peerManager) negotiateICEConn(ctx context.Context, peer *v1.WireGuardPe
 	var maxTries = 5
 	var pc *datachannels.WireGuardProxyClient
 	for tries < maxTries {
-		rt, err := m.getSignalingTransport(ctx, peer, iceServers)
-		if err != nil {
-			return endpoint, fmt.Errorf("get signaling transport: %w", err)
-		}
-		pc, err = datachannels.NewWireGuardProxyClient(ctx, rt, uint16(wgPort))
+		err = tryICEServers(iceServers, func(servers []string) error {
+			rt, err := m.getSignalingTransport(ctx, peer, servers)
+			if err != nil {
+				return fmt.Errorf("get signaling transport: %w", err)
+			}
+			pc, err = datachannels.NewWireGuardProxyClient(datachannels.WithCandidatePolicy(ctx, m.net.opts.Relays.CandidatePolicy), rt, uint16(wgPort))
+			if err != nil {
+				log.Debug("Could not negotiate wireguard ICE proxy", slog.Any("servers", servers), slog.String("error", err.Error()))
+				return fmt.Errorf("create wireguard proxy client: %w", err)
+			}
+			return nil
+		})
 		if err == nil {
 			break
 		}
-		if err != nil {
-			tries++
-			if tries >= maxTries {
-				return endpoint, fmt.Errorf("create wireguard proxy client: %w", err)
-			}
-			log.Error("Error creating wireguard proxy client, retrying", slog.String("error", err.Error()))
-			time.Sleep(time.Second * 2)
+		tries++
+		if tries >= maxTries {
+			return endpoint, err
 		}
+		log.Error("Error creating wireguard proxy client, retrying", slog.String("error", err.Error()))
+		time.Sleep(time.Second * 2)
 	}
 	go func() {
 		<-pc.Closed()
@@ -479,11 +734,30 @@ func (m *peerManager) negotiateICEConn(ctx context.Context, peer *v1.WireGuardPe
 	peerconn := clientPeerConn{
 		peerConn:  pc,
 		localAddr: pc.LocalAddr().AddrPort(),
+		started:   time.Now(),
 	}
 	m.p2pConns[peer.GetNode().GetId()] = peerconn
 	return peerconn.localAddr, nil
 }
 
+// tryICEServers calls try with each of the given ICE servers in turn until
+// one succeeds. Without any servers try is called once with none, leaving
+// the lookup to local storage. The errors are joined if every server fails.
+func tryICEServers(iceServers []string, try func(servers []string) error) error {
+	if len(iceServers) == 0 {
+		return try(nil)
+	}
+	var errs []error
+	for _, server := range iceServers {
+		err := try([]string{server})
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", server, err))
+	}
+	return errors.Join(errs...)
+}
+
 func (m *peerManager) getSignalingTransport(ctx context.Context, peer *v1.WireGuardPeer, iceServers []string) (transport.WebRTCSignalTransport, error) {
 	log := context.LoggerFrom(ctx)
 	var resolver transport.FeatureResolver
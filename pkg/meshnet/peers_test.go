@@ -0,0 +1,495 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+)
+
+func TestDirectOnlyPeers(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name    string
+		opts    Options
+		peer    *v1.WireGuardPeer
+		want    netip.AddrPort
+		wantErr bool
+	}{
+		{
+			name: "DirectOnlyICEPeerWithoutEndpoint",
+			opts: Options{DirectOnlyPeers: []string{"peer"}},
+			peer: &v1.WireGuardPeer{
+				Node:  &v1.MeshNode{Id: "peer"},
+				Proto: v1.ConnectProtocol_CONNECT_ICE,
+			},
+			wantErr: true,
+		},
+		{
+			name: "DirectOnlyLibP2PPeerWithoutEndpoint",
+			opts: Options{DirectOnlyPeers: []string{"peer"}},
+			peer: &v1.WireGuardPeer{
+				Node:  &v1.MeshNode{Id: "peer"},
+				Proto: v1.ConnectProtocol_CONNECT_LIBP2P,
+			},
+			wantErr: true,
+		},
+		{
+			name: "DirectOnlyNativePeerWithoutEndpoint",
+			opts: Options{DirectOnlyPeers: []string{"peer"}},
+			peer: &v1.WireGuardPeer{
+				Node:  &v1.MeshNode{Id: "peer"},
+				Proto: v1.ConnectProtocol_CONNECT_NATIVE,
+			},
+			wantErr: true,
+		},
+		{
+			name: "DirectOnlyICEPeerWithEndpoint",
+			opts: Options{DirectOnlyPeers: []string{"peer"}},
+			peer: &v1.WireGuardPeer{
+				Node: &v1.MeshNode{
+					Id:              "peer",
+					PrimaryEndpoint: "127.0.0.1:51820",
+				},
+				Proto: v1.ConnectProtocol_CONNECT_ICE,
+			},
+			want: netip.MustParseAddrPort("127.0.0.1:51820"),
+		},
+		{
+			name: "NativePeerWithoutEndpoint",
+			opts: Options{DirectOnlyPeers: []string{"another-peer"}},
+			peer: &v1.WireGuardPeer{
+				Node:  &v1.MeshNode{Id: "peer"},
+				Proto: v1.ConnectProtocol_CONNECT_NATIVE,
+			},
+			want: netip.AddrPort{},
+		},
+	}
+
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := newPeerManager(&manager{opts: tt.opts})
+			got, err := m.determinePeerEndpoint(context.Background(), tt.peer, nil)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got endpoint %s", got)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected endpoint %s, got %s", tt.want, got)
+			}
+			if len(m.p2pConns) != 0 {
+				t.Errorf("expected no relayed connections, got %d", len(m.p2pConns))
+			}
+		})
+	}
+}
+
+func TestPresharedKey(t *testing.T) {
+	t.Parallel()
+	psk, err := wgtypes.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := &v1.WireGuardPeer{
+		Node: &v1.MeshNode{
+			Id:              "peer",
+			PublicKey:       mustGeneratePublicKey(t),
+			PrimaryEndpoint: "127.0.0.1:51820",
+		},
+		Proto: v1.ConnectProtocol_CONNECT_NATIVE,
+	}
+
+	tc := []struct {
+		name string
+		psk  *wgtypes.Key
+	}{
+		{name: "Disabled"},
+		{name: "Enabled", psk: &psk},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			wg := &peerRecorder{peers: make(map[string]wireguard.Peer)}
+			m := newPeerManager(&manager{opts: Options{PresharedKey: tt.psk}, wg: wg})
+			if err := m.addPeer(context.Background(), peer, nil); err != nil {
+				t.Fatalf("add peer: %v", err)
+			}
+			got, ok := wg.peers["peer"]
+			if !ok {
+				t.Fatal("expected peer to be put to the wireguard interface")
+			}
+			if tt.psk == nil {
+				if got.PresharedKey != nil {
+					t.Fatalf("expected no preshared key, got one")
+				}
+				return
+			}
+			if got.PresharedKey == nil || *got.PresharedKey != *tt.psk {
+				t.Fatalf("expected preshared key to be applied to the peer")
+			}
+		})
+	}
+}
+
+func TestReplacePeer(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	localAddr := netip.MustParseAddrPort("127.0.0.1:40000")
+	newICEPeer := func(id string) *v1.WireGuardPeer {
+		return &v1.WireGuardPeer{
+			Node:  &v1.MeshNode{Id: id, PublicKey: mustGeneratePublicKey(t)},
+			Proto: v1.ConnectProtocol_CONNECT_ICE,
+		}
+	}
+
+	t.Run("KeyRotation", func(t *testing.T) {
+		t.Parallel()
+		wg := &peerRecorder{peers: make(map[string]wireguard.Peer)}
+		m := newPeerManager(&manager{opts: Options{DisablePeerPing: true}, wg: wg})
+		conn := &recordingSession{}
+		m.p2pConns["peer"] = clientPeerConn{peerConn: conn, localAddr: localAddr}
+		oldPeer, newPeer := newICEPeer("peer"), newICEPeer("peer")
+		if err := m.addPeer(ctx, oldPeer, nil); err != nil {
+			t.Fatalf("add peer: %v", err)
+		}
+		if err := m.replace(ctx, oldPeer, newPeer, nil); err != nil {
+			t.Fatalf("replace peer: %v", err)
+		}
+		if conn.closed {
+			t.Fatal("expected the ICE connection to stay open")
+		}
+		if got, ok := m.p2pConns["peer"]; !ok || got.peerConn != conn {
+			t.Fatal("expected the ICE connection to be preserved")
+		}
+		got, ok := wg.peers["peer"]
+		if !ok {
+			t.Fatal("expected peer to remain on the wireguard interface")
+		}
+		want, err := crypto.DecodePublicKey(newPeer.GetNode().GetPublicKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.PublicKey.WireGuardKey() != want.WireGuardKey() {
+			t.Fatal("expected peer to use the rotated key")
+		}
+		if got.Endpoint != localAddr {
+			t.Fatalf("expected endpoint %s, got %s", localAddr, got.Endpoint)
+		}
+	})
+
+	t.Run("DifferentID", func(t *testing.T) {
+		t.Parallel()
+		wg := &peerRecorder{peers: make(map[string]wireguard.Peer)}
+		m := newPeerManager(&manager{opts: Options{DisablePeerPing: true}, wg: wg})
+		conn := &recordingSession{}
+		m.p2pConns["old"] = clientPeerConn{peerConn: conn, localAddr: localAddr}
+		m.p2pConns["new"] = clientPeerConn{peerConn: &recordingSession{}, localAddr: localAddr}
+		oldPeer, newPeer := newICEPeer("old"), newICEPeer("new")
+		if err := m.addPeer(ctx, oldPeer, nil); err != nil {
+			t.Fatalf("add peer: %v", err)
+		}
+		if err := m.replace(ctx, oldPeer, newPeer, nil); err != nil {
+			t.Fatalf("replace peer: %v", err)
+		}
+		if !conn.closed {
+			t.Fatal("expected the ICE connection to the old peer to be closed")
+		}
+		if _, ok := wg.peers["old"]; ok {
+			t.Fatal("expected the old peer to be removed")
+		}
+		if _, ok := wg.peers["new"]; !ok {
+			t.Fatal("expected the new peer to be added")
+		}
+	})
+}
+
+func TestHandshakeSweep(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const timeout = time.Minute
+	newPeer := func(id string) *v1.WireGuardPeer {
+		return &v1.WireGuardPeer{
+			Node: &v1.MeshNode{
+				Id:              id,
+				PublicKey:       mustGeneratePublicKey(t),
+				PrimaryEndpoint: "127.0.0.1:51820",
+			},
+			Proto: v1.ConnectProtocol_CONNECT_NATIVE,
+		}
+	}
+	peers := []*v1.WireGuardPeer{newPeer("stale"), newPeer("live"), newPeer("idle")}
+	wg := &peerRecorder{
+		peers:      make(map[string]wireguard.Peer),
+		handshakes: make(map[string]time.Time),
+	}
+	m := newPeerManager(&manager{opts: Options{
+		HandshakeTimeout:    timeout,
+		PersistentKeepAlive: 25 * time.Second,
+		NoKeepAlivePeers:    []string{"idle"},
+	}, wg: wg})
+	if err := m.Refresh(ctx, peers); err != nil {
+		t.Fatalf("refresh peers: %v", err)
+	}
+	// Neither peer has handshaked, but both are still within the window.
+	if err := m.sweepStalePeers(ctx, timeout, time.Now()); err != nil {
+		t.Fatalf("sweep peers: %v", err)
+	}
+	if len(wg.peers) != 3 {
+		t.Fatalf("expected all peers to survive the first sweep, got %d", len(wg.peers))
+	}
+	// Once the window has passed only the peer that handshaked is kept.
+	later := time.Now().Add(2 * timeout)
+	wg.handshakes["live"] = later
+	if err := m.sweepStalePeers(ctx, timeout, later); err != nil {
+		t.Fatalf("sweep peers: %v", err)
+	}
+	if _, ok := wg.peers["stale"]; ok {
+		t.Fatal("expected never-handshaking peer to be swept")
+	}
+	if _, ok := wg.peers["live"]; !ok {
+		t.Fatal("expected handshaking peer to be kept")
+	}
+	// Without a keepalive an idle peer never handshakes, so it is not swept.
+	if _, ok := wg.peers["idle"]; !ok {
+		t.Fatal("expected peer without keepalive to be kept")
+	}
+	// The stale peer is still in the store, so the next refresh puts it back.
+	if err := m.Refresh(ctx, peers); err != nil {
+		t.Fatalf("refresh peers: %v", err)
+	}
+	if _, ok := wg.peers["stale"]; !ok {
+		t.Fatal("expected swept peer to be re-added on refresh")
+	}
+	if err := m.sweepStalePeers(ctx, timeout, time.Now()); err != nil {
+		t.Fatalf("sweep peers: %v", err)
+	}
+	if _, ok := wg.peers["stale"]; !ok {
+		t.Fatal("expected re-added peer to be given a fresh handshake window")
+	}
+}
+
+func TestPeerPingConcurrency(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const concurrency = 3
+	const numPeers = 100
+
+	var mu sync.Mutex
+	var active, maxActive, pinged int
+	ping := func(ctx context.Context, addr netip.Addr) error {
+		mu.Lock()
+		active++
+		maxActive = max(maxActive, active)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		active--
+		pinged++
+		mu.Unlock()
+		return nil
+	}
+	peers := make([]*v1.WireGuardPeer, numPeers)
+	for i := range peers {
+		peers[i] = &v1.WireGuardPeer{
+			Node: &v1.MeshNode{
+				Id:              fmt.Sprintf("peer-%d", i),
+				PublicKey:       mustGeneratePublicKey(t),
+				PrimaryEndpoint: "127.0.0.1:51820",
+				PrivateIPv4:     fmt.Sprintf("172.16.%d.%d/32", i/250, i%250+1),
+			},
+			Proto: v1.ConnectProtocol_CONNECT_NATIVE,
+		}
+	}
+
+	t.Run("Bounded", func(t *testing.T) {
+		t.Parallel()
+		wg := &peerRecorder{peers: make(map[string]wireguard.Peer)}
+		m := newPeerManager(&manager{opts: Options{PeerPingConcurrency: concurrency}, wg: wg})
+		m.pings = newPingPool(concurrency, 0, ping)
+		defer m.Close(ctx)
+		if err := m.Refresh(ctx, peers); err != nil {
+			t.Fatalf("refresh peers: %v", err)
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			mu.Lock()
+			done := pinged
+			mu.Unlock()
+			if done == numPeers {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for pings, got %d of %d", done, numPeers)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if maxActive > concurrency {
+			t.Fatalf("expected at most %d concurrent pings, got %d", concurrency, maxActive)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+		wg := &peerRecorder{peers: make(map[string]wireguard.Peer)}
+		m := newPeerManager(&manager{opts: Options{DisablePeerPing: true}, wg: wg})
+		var called bool
+		m.pings = newPingPool(concurrency, 0, func(context.Context, netip.Addr) error {
+			called = true
+			return nil
+		})
+		if err := m.Refresh(ctx, peers[:1]); err != nil {
+			t.Fatalf("refresh peers: %v", err)
+		}
+		// Close waits for any probe that was started.
+		m.Close(ctx)
+		if called {
+			t.Fatal("expected no pings when peer pings are disabled")
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+		const timeout = 250 * time.Millisecond
+		wg := &peerRecorder{peers: make(map[string]wireguard.Peer)}
+		m := newPeerManager(&manager{opts: Options{PeerPingTimeout: timeout}, wg: wg})
+		deadlines := make(chan time.Duration, 1)
+		m.pings = newPingPool(concurrency, m.net.opts.PeerPingTimeout, func(ctx context.Context, _ netip.Addr) error {
+			deadline, _ := ctx.Deadline()
+			deadlines <- time.Until(deadline)
+			return nil
+		})
+		defer m.Close(ctx)
+		if err := m.Refresh(ctx, peers[:1]); err != nil {
+			t.Fatalf("refresh peers: %v", err)
+		}
+		select {
+		case remaining := <-deadlines:
+			if remaining <= 0 || remaining > timeout {
+				t.Fatalf("expected ping deadline within %s, got %s", timeout, remaining)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for ping")
+		}
+	})
+}
+
+type peerRecorder struct {
+	wireguard.Interface
+	peers      map[string]wireguard.Peer
+	handshakes map[string]time.Time
+}
+
+func (p *peerRecorder) PutPeer(ctx context.Context, peer *wireguard.Peer) error {
+	p.peers[peer.ID] = *peer
+	return nil
+}
+
+func (p *peerRecorder) DeletePeer(ctx context.Context, id string) error {
+	delete(p.peers, id)
+	return nil
+}
+
+func (p *peerRecorder) Peers() map[string]wireguard.Peer {
+	out := make(map[string]wireguard.Peer, len(p.peers))
+	for id, peer := range p.peers {
+		out[id] = peer
+	}
+	return out
+}
+
+func (p *peerRecorder) Metrics() (*v1.InterfaceMetrics, error) {
+	metrics := &v1.InterfaceMetrics{}
+	for id, peer := range p.peers {
+		metrics.Peers = append(metrics.Peers, &v1.PeerMetrics{
+			PublicKey:         peer.PublicKey.WireGuardKey().String(),
+			LastHandshakeTime: p.handshakes[id].UTC().Format(time.RFC3339),
+		})
+	}
+	return metrics, nil
+}
+
+func TestTryICEServers(t *testing.T) {
+	t.Parallel()
+
+	t.Run("FirstServerFails", func(t *testing.T) {
+		t.Parallel()
+		var tried []string
+		err := tryICEServers([]string{"10.0.0.1:8443", "10.0.0.2:8443", "10.0.0.3:8443"}, func(servers []string) error {
+			tried = append(tried, servers...)
+			if servers[0] == "10.0.0.1:8443" {
+				return errors.New("connection refused")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected the second server to be used, got %v", err)
+		}
+		if !slices.Equal(tried, []string{"10.0.0.1:8443", "10.0.0.2:8443"}) {
+			t.Fatalf("expected servers to be tried in order until one succeeds, got %v", tried)
+		}
+	})
+
+	t.Run("AllServersFail", func(t *testing.T) {
+		t.Parallel()
+		errA, errB := errors.New("refused"), errors.New("timed out")
+		err := tryICEServers([]string{"10.0.0.1:8443", "10.0.0.2:8443"}, func(servers []string) error {
+			if servers[0] == "10.0.0.1:8443" {
+				return errA
+			}
+			return errB
+		})
+		if !errors.Is(err, errA) || !errors.Is(err, errB) {
+			t.Fatalf("expected the errors of all servers, got %v", err)
+		}
+	})
+
+	t.Run("NoServers", func(t *testing.T) {
+		t.Parallel()
+		var calls int
+		err := tryICEServers(nil, func(servers []string) error {
+			calls++
+			if servers != nil {
+				t.Errorf("expected no servers, got %v", servers)
+			}
+			return nil
+		})
+		if err != nil || calls != 1 {
+			t.Fatalf("expected a single lookup through local storage, got %d calls and %v", calls, err)
+		}
+	})
+}
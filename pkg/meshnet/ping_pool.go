@@ -0,0 +1,128 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"log/slog"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/netutil"
+)
+
+const (
+	// DefaultPeerPingConcurrency is the default number of peer ping
+	// probes run in parallel.
+	DefaultPeerPingConcurrency = 8
+	// pingQueueSize is the number of probes that may wait for a worker.
+	// Probes beyond this are dropped, they are best-effort anyway.
+	pingQueueSize = 1024
+	// DefaultPeerPingTimeout is the default timeout for a single peer
+	// ping probe.
+	DefaultPeerPingTimeout = 5 * time.Second
+)
+
+// pingFunc pings the given address until the context is done.
+type pingFunc func(ctx context.Context, addr netip.Addr) error
+
+type pingProbe struct {
+	log  *slog.Logger
+	id   string
+	addr netip.Addr
+}
+
+// pingPool runs peer ping probes on a fixed number of workers. Workers
+// are started with the first probe and stopped when the pool is closed.
+type pingPool struct {
+	ping    pingFunc
+	workers int
+	timeout time.Duration
+	queue   chan pingProbe
+	ctx     context.Context
+	cancel  context.CancelFunc
+	start   sync.Once
+	wg      sync.WaitGroup
+}
+
+func newPingPool(workers int, timeout time.Duration, ping pingFunc) *pingPool {
+	if workers <= 0 {
+		workers = DefaultPeerPingConcurrency
+	}
+	if timeout <= 0 {
+		timeout = DefaultPeerPingTimeout
+	}
+	if ping == nil {
+		ping = netutil.Ping
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &pingPool{
+		ping:    ping,
+		workers: workers,
+		timeout: timeout,
+		queue:   make(chan pingProbe, pingQueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Enqueue schedules a ping probe for the given peer. It never blocks.
+func (p *pingPool) Enqueue(ctx context.Context, id string, addr netip.Addr) {
+	p.start.Do(func() {
+		for i := 0; i < p.workers; i++ {
+			p.wg.Add(1)
+			go p.run()
+		}
+	})
+	probe := pingProbe{log: context.LoggerFrom(ctx), id: id, addr: addr}
+	select {
+	case <-p.ctx.Done():
+	case p.queue <- probe:
+	default:
+		probe.log.Debug("Ping queue is full, dropping probe", slog.String("descendant", id))
+	}
+}
+
+// Close stops the workers and waits for in-flight probes to finish.
+func (p *pingPool) Close() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+func (p *pingPool) run() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case probe := <-p.queue:
+			p.probe(probe)
+		}
+	}
+}
+
+func (p *pingPool) probe(probe pingProbe) {
+	ctx, cancel := context.WithTimeout(p.ctx, p.timeout)
+	defer cancel()
+	err := p.ping(ctx, probe.addr)
+	if err != nil {
+		probe.log.Debug("Could not ping descendant", slog.String("descendant", probe.id), slog.String("error", err.Error()))
+		return
+	}
+	probe.log.Debug("Successfully pinged descendant", slog.String("descendant", probe.id))
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system"
+)
+
+// DefaultAutoMTUInterval is the default interval at which the path MTU to
+// peer endpoints is probed again when MTU auto-detection is enabled.
+const DefaultAutoMTUInterval = 10 * time.Minute
+
+const (
+	// wireguardOverheadV4 is the encapsulation overhead of WireGuard over IPv4:
+	// a 20 byte IP header, an 8 byte UDP header, and 32 bytes of WireGuard
+	// header and authentication tag.
+	wireguardOverheadV4 = 60
+	// wireguardOverheadV6 is the encapsulation overhead of WireGuard over IPv6.
+	wireguardOverheadV6 = 80
+	// minAutoMTU is the smallest MTU that will be set on the interface. It is
+	// the minimum MTU required to carry IPv6 through the tunnel.
+	minAutoMTU = 1280
+)
+
+// ErrPMTUUnsupported is returned when path MTU probing is not supported
+// on the current platform.
+var ErrPMTUUnsupported = errors.New("path MTU discovery is not supported on this platform")
+
+// pmtuProbeFunc returns the path MTU to the given endpoint.
+type pmtuProbeFunc func(ctx context.Context, endpoint netip.AddrPort) (int, error)
+
+// runMTUProbe sets the interface MTU from the path MTU to the current peer
+// endpoints and repeats on the given interval until the context is canceled.
+// The first probe waits for the first peer refresh, since there are no peer
+// endpoints to probe before then. A zero interval only probes once.
+func (m *manager) runMTUProbe(ctx context.Context, interval time.Duration) {
+	log := context.LoggerFrom(ctx)
+	select {
+	case <-ctx.Done():
+		return
+	case <-m.peersRefreshed:
+	}
+	if err := m.probeMTU(ctx); err != nil {
+		log.Warn("Failed to set interface MTU from path MTU", slog.String("error", err.Error()))
+	}
+	if interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := m.probeMTU(ctx); err != nil {
+				log.Warn("Failed to set interface MTU from path MTU", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// markPeersRefreshed records that the peers have been refreshed at least once.
+func (m *manager) markPeersRefreshed() {
+	if m.peersRefreshed == nil {
+		return
+	}
+	m.refreshedOnce.Do(func() { close(m.peersRefreshed) })
+}
+
+// probeMTU probes the path MTU to the direct endpoints of the peers on the
+// interface and sets the interface MTU to the smallest one minus the WireGuard
+// overhead. The configured MTU is used when no path MTU could be discovered.
+func (m *manager) probeMTU(ctx context.Context) error {
+	log := context.LoggerFrom(ctx)
+	mtu := m.opts.MTU
+	if mtu <= 0 {
+		mtu = system.DefaultMTU
+	}
+	discovered := 0
+	seen := make(map[netip.AddrPort]struct{})
+	for id, peer := range m.wg.Peers() {
+		endpoint := peer.Endpoint
+		// Peers reached over a relay or proxy have a loopback endpoint that
+		// says nothing about the path through the network.
+		if !endpoint.IsValid() || endpoint.Addr().IsLoopback() {
+			continue
+		}
+		if _, ok := seen[endpoint]; ok {
+			continue
+		}
+		seen[endpoint] = struct{}{}
+		pmtu, err := m.probePMTU(ctx, endpoint)
+		if err != nil {
+			if errors.Is(err, ErrPMTUUnsupported) {
+				return err
+			}
+			log.Debug("Failed to probe path MTU to peer",
+				slog.String("peer", id),
+				slog.String("endpoint", endpoint.String()),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		overhead := wireguardOverheadV4
+		if endpoint.Addr().Is6() && !endpoint.Addr().Is4In6() {
+			overhead = wireguardOverheadV6
+		}
+		log.Debug("Discovered path MTU to peer",
+			slog.String("peer", id),
+			slog.String("endpoint", endpoint.String()),
+			slog.Int("pmtu", pmtu),
+		)
+		if discovered == 0 || pmtu-overhead < discovered {
+			discovered = pmtu - overhead
+		}
+	}
+	if discovered > 0 {
+		if discovered < minAutoMTU {
+			log.Warn("Discovered path MTU is below the minimum, clamping",
+				slog.Int("discovered", discovered),
+				slog.Int("minimum", minAutoMTU),
+			)
+			discovered = minAutoMTU
+		}
+		mtu = discovered
+	}
+	log.Debug("Setting interface MTU", slog.Int("mtu", mtu), slog.Bool("discovered", discovered > 0))
+	if err := m.wg.SetMTU(ctx, mtu); err != nil {
+		return fmt.Errorf("set interface mtu: %w", err)
+	}
+	return nil
+}
+
+// probePMTU probes the path MTU to the given endpoint from within the
+// configured network namespace.
+func (m *manager) probePMTU(ctx context.Context, endpoint netip.AddrPort) (int, error) {
+	if m.opts.NetNs == "" {
+		return m.pmtuProbe(ctx, endpoint)
+	}
+	var mtu int
+	err := system.DoInNetNS(m.opts.NetNs, func() error {
+		var err error
+		mtu, err = m.pmtuProbe(ctx, endpoint)
+		return err
+	})
+	return mtu, err
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+const (
+	// pmtuProbeAttempts is the number of probes sent to an endpoint while
+	// the path MTU is still shrinking.
+	pmtuProbeAttempts = 3
+	// pmtuProbeWait is how long to wait for ICMP errors after each probe.
+	pmtuProbeWait = 200 * time.Millisecond
+)
+
+// probePathMTU discovers the path MTU to the given endpoint. Datagrams that
+// fill the current path MTU are sent with fragmentation disabled, so that
+// any hop with a smaller MTU reports it back and lowers the path MTU cached
+// by the kernel. WireGuard silently drops the probes.
+func probePathMTU(ctx context.Context, endpoint netip.AddrPort) (int, error) {
+	endpoint = netip.AddrPortFrom(endpoint.Addr().Unmap(), endpoint.Port())
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "udp", endpoint.String())
+	if err != nil {
+		return 0, fmt.Errorf("dial endpoint: %w", err)
+	}
+	defer c.Close()
+	conn := c.(*net.UDPConn)
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("get raw connection: %w", err)
+	}
+	level, discoverOpt, discoverDo, mtuOpt, headers := unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_DO, unix.IP_MTU, 28
+	if endpoint.Addr().Is6() {
+		level, discoverOpt, discoverDo, mtuOpt, headers = unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_DO, unix.IPV6_MTU, 48
+	}
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), level, discoverOpt, discoverDo)
+	})
+	if err == nil {
+		err = sockErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("disable fragmentation: %w", err)
+	}
+	getMTU := func() (int, error) {
+		var mtu int
+		err := raw.Control(func(fd uintptr) {
+			mtu, sockErr = unix.GetsockoptInt(int(fd), level, mtuOpt)
+		})
+		if err == nil {
+			err = sockErr
+		}
+		if err != nil {
+			return 0, fmt.Errorf("get path mtu: %w", err)
+		}
+		return mtu, nil
+	}
+	mtu, err := getMTU()
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < pmtuProbeAttempts; i++ {
+		_, err := conn.Write(make([]byte, mtu-headers))
+		if err != nil && !errors.Is(err, unix.EMSGSIZE) {
+			return 0, fmt.Errorf("send probe: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(pmtuProbeWait):
+		}
+		next, err := getMTU()
+		if err != nil {
+			return 0, err
+		}
+		if next >= mtu {
+			break
+		}
+		mtu = next
+	}
+	return mtu, nil
+}
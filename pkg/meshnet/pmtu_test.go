@@ -0,0 +1,135 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+)
+
+func TestProbeMTU(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pmtus := map[netip.AddrPort]int{
+		netip.MustParseAddrPort("192.0.2.10:51820"):    1400,
+		netip.MustParseAddrPort("[2001:db8::1]:51820"): 1500,
+	}
+	var probed []netip.AddrPort
+	wg := &mtuInterface{peers: map[string]wireguard.Peer{
+		"node-a": {Endpoint: netip.MustParseAddrPort("192.0.2.10:51820")},
+		"node-b": {Endpoint: netip.MustParseAddrPort("[2001:db8::1]:51820")},
+		"node-c": {Endpoint: netip.MustParseAddrPort("127.0.0.1:40000")},
+		"node-d": {},
+	}}
+	m := &manager{
+		opts: Options{MTU: 1420},
+		wg:   wg,
+		pmtuProbe: func(_ context.Context, endpoint netip.AddrPort) (int, error) {
+			probed = append(probed, endpoint)
+			pmtu, ok := pmtus[endpoint]
+			if !ok {
+				return 0, errors.New("no route to host")
+			}
+			return pmtu, nil
+		},
+	}
+	if err := m.probeMTU(ctx); err != nil {
+		t.Fatalf("probe mtu: %v", err)
+	}
+	if len(probed) != 2 {
+		t.Fatalf("expected only direct endpoints to be probed, got %v", probed)
+	}
+	// The smallest path MTU less the overhead for its address family wins.
+	if want := 1400 - wireguardOverheadV4; wg.mtu != want {
+		t.Fatalf("expected interface MTU %d, got %d", want, wg.mtu)
+	}
+
+	// Path MTUs too small to carry IPv6 are clamped.
+	pmtus[netip.MustParseAddrPort("192.0.2.10:51820")] = 1280
+	if err := m.probeMTU(ctx); err != nil {
+		t.Fatalf("probe mtu: %v", err)
+	}
+	if wg.mtu != minAutoMTU {
+		t.Fatalf("expected interface MTU to be clamped to %d, got %d", minAutoMTU, wg.mtu)
+	}
+
+	// The configured MTU is used when nothing could be discovered.
+	clear(pmtus)
+	if err := m.probeMTU(ctx); err != nil {
+		t.Fatalf("probe mtu: %v", err)
+	}
+	if wg.mtu != 1420 {
+		t.Fatalf("expected fallback to configured MTU 1420, got %d", wg.mtu)
+	}
+}
+
+func TestMTUProbeWaitsForPeers(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	probed := make(chan struct{}, 1)
+	m := &manager{
+		opts: Options{MTU: 1420},
+		wg: &mtuInterface{peers: map[string]wireguard.Peer{
+			"node-a": {Endpoint: netip.MustParseAddrPort("192.0.2.10:51820")},
+		}},
+		pmtuProbe: func(_ context.Context, _ netip.AddrPort) (int, error) {
+			probed <- struct{}{}
+			return 1400, nil
+		},
+		peersRefreshed: make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.runMTUProbe(ctx, 0)
+	}()
+	select {
+	case <-probed:
+		t.Fatal("expected no probe before the first peer refresh")
+	case <-time.After(100 * time.Millisecond):
+	}
+	m.markPeersRefreshed()
+	// Later refreshes must not close the channel again.
+	m.markPeersRefreshed()
+	select {
+	case <-probed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a probe after the first peer refresh")
+	}
+	<-done
+}
+
+type mtuInterface struct {
+	wireguard.Interface
+	peers map[string]wireguard.Peer
+	mtu   int
+}
+
+func (m *mtuInterface) Peers() map[string]wireguard.Peer {
+	return m.peers
+}
+
+func (m *mtuInterface) SetMTU(_ context.Context, mtu int) error {
+	m.mtu = mtu
+	return nil
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-nat"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// DefaultPortMappingLifetime is the lifetime requested for port mappings
+// when none is configured. Mappings are refreshed at half their lifetime.
+const DefaultPortMappingLifetime = time.Hour
+
+// PortMappingDiscoveryTimeout is how long to search the local network for
+// a UPnP or NAT-PMP gateway.
+const PortMappingDiscoveryTimeout = 10 * time.Second
+
+// ErrPortMappingUnsupported is returned when port mapping is not supported
+// by a network manager.
+var ErrPortMappingUnsupported = errors.New("port mapping is not supported")
+
+// PortMapper requests port mappings from a NAT gateway. It is implemented
+// by the UPnP and NAT-PMP clients discovered on the local network.
+type PortMapper interface {
+	// GetExternalAddress returns the external address of the gateway.
+	GetExternalAddress() (net.IP, error)
+	// AddPortMapping maps the internal port for the given protocol and
+	// returns the external port. The mapping expires after the timeout.
+	AddPortMapping(ctx context.Context, protocol string, internalPort int, description string, timeout time.Duration) (int, error)
+	// DeletePortMapping removes the mapping of the internal port.
+	DeletePortMapping(ctx context.Context, protocol string, internalPort int) error
+}
+
+// portMapperFunc returns a PortMapper for the local gateway.
+type portMapperFunc func(ctx context.Context) (PortMapper, error)
+
+// discoverPortMapper searches the local network for a UPnP or NAT-PMP gateway.
+func discoverPortMapper(ctx context.Context) (PortMapper, error) {
+	ctx, cancel := context.WithTimeout(ctx, PortMappingDiscoveryTimeout)
+	defer cancel()
+	gw, err := nat.DiscoverGateway(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("discover gateway: %w", err)
+	}
+	return gw, nil
+}
+
+// MapListenPort requests a mapping of the WireGuard listen port from a UPnP
+// or NAT-PMP gateway on the local network and returns the external address
+// and port. The mapping is refreshed until the manager is closed, after
+// which it is removed. If a refresh sees a different external address,
+// onChange is called with it so it can be advertised to the mesh.
+func (m *manager) MapListenPort(ctx context.Context, onChange func(context.Context, netip.AddrPort)) (netip.AddrPort, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.portmap != nil {
+		return m.portmap.external(), nil
+	}
+	if m.opts.ListenPort == 0 {
+		return netip.AddrPort{}, errors.New("no wireguard listen port to map")
+	}
+	discover := m.portMapper
+	if discover == nil {
+		discover = discoverPortMapper
+	}
+	mapper, err := discover(ctx)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	lifetime := m.opts.PortMappingLifetime
+	if lifetime <= 0 {
+		lifetime = DefaultPortMappingLifetime
+	}
+	log := context.LoggerFrom(ctx).With("component", "net-manager")
+	pm, err := newPortMapping(ctx, log, mapper, m.opts.ListenPort, lifetime, onChange)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	m.portmap = pm
+	return pm.external(), nil
+}
+
+// portMapping is a UDP port mapping that is refreshed until closed.
+type portMapping struct {
+	mapper   PortMapper
+	port     int
+	lifetime time.Duration
+	ext      netip.AddrPort
+	onChange func(context.Context, netip.AddrPort)
+	stop     context.CancelFunc
+	done     chan struct{}
+	log      *slog.Logger
+	mu       sync.Mutex
+}
+
+func newPortMapping(ctx context.Context, log *slog.Logger, mapper PortMapper, port int, lifetime time.Duration, onChange func(context.Context, netip.AddrPort)) (*portMapping, error) {
+	pm := &portMapping{
+		mapper:   mapper,
+		port:     port,
+		lifetime: lifetime,
+		onChange: onChange,
+		done:     make(chan struct{}),
+		log:      log.With(slog.Int("internal-port", port)),
+	}
+	ext, err := pm.request(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pm.ext = ext
+	pm.log.Info("Mapped wireguard port on gateway", slog.String("external", ext.String()))
+	refreshCtx, cancel := context.WithCancel(context.Background())
+	pm.stop = cancel
+	go pm.refresh(refreshCtx)
+	return pm, nil
+}
+
+// request asks the gateway for the mapping and returns the external address.
+func (p *portMapping) request(ctx context.Context) (netip.AddrPort, error) {
+	extPort, err := p.mapper.AddPortMapping(ctx, "udp", p.port, "webmesh wireguard", p.lifetime)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("add port mapping: %w", err)
+	}
+	ip, err := p.mapper.GetExternalAddress()
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("get external address: %w", err)
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("invalid external address %q", ip)
+	}
+	return netip.AddrPortFrom(addr.Unmap(), uint16(extPort)), nil
+}
+
+// refresh renews the mapping at half its lifetime until the context is canceled.
+func (p *portMapping) refresh(ctx context.Context) {
+	defer close(p.done)
+	t := time.NewTicker(p.lifetime / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		ext, err := p.request(ctx)
+		if err != nil {
+			p.log.Error("Failed to refresh port mapping", slog.String("error", err.Error()))
+			continue
+		}
+		p.mu.Lock()
+		prev := p.ext
+		p.ext = ext
+		p.mu.Unlock()
+		if ext == prev {
+			continue
+		}
+		// The endpoint advertised to the mesh is now stale.
+		p.log.Info("External address of port mapping changed",
+			slog.String("previous", prev.String()),
+			slog.String("current", ext.String()),
+		)
+		if p.onChange != nil {
+			p.onChange(ctx, ext)
+		}
+	}
+}
+
+func (p *portMapping) external() netip.AddrPort {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ext
+}
+
+// close stops refreshing the mapping and removes it from the gateway.
+func (p *portMapping) close(ctx context.Context) error {
+	p.stop()
+	<-p.done
+	if err := p.mapper.DeletePortMapping(ctx, "udp", p.port); err != nil {
+		return fmt.Errorf("delete port mapping: %w", err)
+	}
+	return nil
+}
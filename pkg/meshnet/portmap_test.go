@@ -0,0 +1,138 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// fakeGateway is a mock internet gateway device that records port mappings.
+type fakeGateway struct {
+	external net.IP
+	extPort  int
+	requests []portMappingRequest
+	mappings map[int]int
+	mu       sync.Mutex
+}
+
+type portMappingRequest struct {
+	protocol     string
+	internalPort int
+	lifetime     time.Duration
+}
+
+func (g *fakeGateway) GetExternalAddress() (net.IP, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.external, nil
+}
+
+func (g *fakeGateway) AddPortMapping(_ context.Context, protocol string, internalPort int, _ string, timeout time.Duration) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.requests = append(g.requests, portMappingRequest{protocol, internalPort, timeout})
+	g.mappings[internalPort] = g.extPort
+	return g.extPort, nil
+}
+
+func (g *fakeGateway) DeletePortMapping(_ context.Context, protocol string, internalPort int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.mappings, internalPort)
+	return nil
+}
+
+func (g *fakeGateway) requestCount() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.requests)
+}
+
+func TestMapListenPort(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	gw := &fakeGateway{
+		external: net.ParseIP("203.0.113.7"),
+		extPort:  41820,
+		mappings: map[int]int{},
+	}
+	m := &manager{
+		opts: Options{ListenPort: 51820, PortMappingLifetime: 100 * time.Millisecond},
+		portMapper: func(context.Context) (PortMapper, error) {
+			return gw, nil
+		},
+	}
+	m.peers = newPeerManager(m)
+
+	changed := make(chan netip.AddrPort, 1)
+	ext, err := m.MapListenPort(ctx, func(_ context.Context, ext netip.AddrPort) {
+		select {
+		case changed <- ext:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatalf("map listen port: %v", err)
+	}
+	if want := netip.MustParseAddrPort("203.0.113.7:41820"); ext != want {
+		t.Fatalf("expected external endpoint %s, got %s", want, ext)
+	}
+	gw.mu.Lock()
+	req := gw.requests[0]
+	gw.mu.Unlock()
+	if req.protocol != "udp" || req.internalPort != 51820 || req.lifetime != 100*time.Millisecond {
+		t.Fatalf("unexpected port mapping request: %+v", req)
+	}
+
+	// The mapping is refreshed before it expires.
+	deadline := time.Now().Add(5 * time.Second)
+	for gw.requestCount() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the port mapping to be refreshed, got %d requests", gw.requestCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A new external address is reported so it can be advertised.
+	gw.mu.Lock()
+	gw.external = net.ParseIP("203.0.113.8")
+	gw.mu.Unlock()
+	select {
+	case got := <-changed:
+		if want := netip.MustParseAddrPort("203.0.113.8:41820"); got != want {
+			t.Fatalf("expected changed endpoint %s, got %s", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the external address change to be reported")
+	}
+
+	// The mapping is removed on shutdown.
+	if err := m.Close(ctx); err != nil {
+		t.Fatalf("close manager: %v", err)
+	}
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	if _, ok := gw.mappings[51820]; ok {
+		t.Fatal("expected the port mapping to be removed on close")
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+)
+
+// ErrRateLimitUnsupported is returned when per-peer rate limiting is not
+// supported on the current platform.
+var ErrRateLimitUnsupported = errors.New("peer rate limiting is not supported on this platform")
+
+// rateUnits are the suffixes accepted by ParseRate and their multipliers.
+var rateUnits = []struct {
+	suffix string
+	mult   uint64
+}{
+	{"tbit", 1000 * 1000 * 1000 * 1000},
+	{"gbit", 1000 * 1000 * 1000},
+	{"mbit", 1000 * 1000},
+	{"kbit", 1000},
+	{"bit", 1},
+}
+
+// ParseRate parses a rate in bits per second. Rates may have a kbit, mbit,
+// gbit, or tbit suffix, e.g. "10mbit", and are otherwise in bits per second.
+func ParseRate(s string) (uint64, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+	mult := uint64(1)
+	for _, unit := range rateUnits {
+		if strings.HasSuffix(str, unit.suffix) {
+			str = strings.TrimSuffix(str, unit.suffix)
+			mult = unit.mult
+			break
+		}
+	}
+	rate, err := strconv.ParseUint(strings.TrimSpace(str), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	if rate == 0 {
+		return 0, fmt.Errorf("rate %q must be greater than zero", s)
+	}
+	return rate * mult, nil
+}
+
+// peerShaper shapes the traffic sent to peers over the WireGuard interface.
+type peerShaper interface {
+	// LimitPeer caps the rate, in bits per second, of traffic sent to the
+	// given destinations of a peer. Calling it again for the same peer
+	// replaces the previous limit.
+	LimitPeer(ctx context.Context, iface string, peerID string, dests []netip.Prefix, rate uint64) error
+	// UnlimitPeer removes the limit for a peer, if any.
+	UnlimitPeer(ctx context.Context, iface string, peerID string) error
+}
+
+// shapePeer applies the configured rate limit, if any, to the given peer.
+// Limits are only applied to traffic sent to the peer. Failures are logged
+// since shaping is best effort and must not prevent connectivity.
+func (m *peerManager) shapePeer(ctx context.Context, peer *wireguard.Peer) {
+	rate, ok := m.net.opts.PeerRateLimits[peer.ID]
+	if !ok || m.net.shaper == nil {
+		return
+	}
+	dests := make([]netip.Prefix, 0, 2+len(peer.AllowedIPs)+len(peer.AllowedRoutes))
+	for _, prefix := range []netip.Prefix{peer.PrivateIPv4, peer.PrivateIPv6} {
+		if prefix.IsValid() {
+			dests = append(dests, netip.PrefixFrom(prefix.Addr(), prefix.Addr().BitLen()))
+		}
+	}
+	dests = append(dests, peer.AllowedIPs...)
+	dests = append(dests, peer.AllowedRoutes...)
+	err := m.inNetNS(func() error {
+		return m.net.shaper.LimitPeer(ctx, m.net.wg.Name(), peer.ID, dests, rate)
+	})
+	if err != nil {
+		context.LoggerFrom(ctx).Warn("Failed to apply peer rate limit",
+			slog.String("peer", peer.ID),
+			slog.Uint64("rate", rate),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// unshapePeer removes the rate limit, if any, for the given peer.
+func (m *peerManager) unshapePeer(ctx context.Context, id string) {
+	if _, ok := m.net.opts.PeerRateLimits[id]; !ok || m.net.shaper == nil {
+		return
+	}
+	err := m.inNetNS(func() error {
+		return m.net.shaper.UnlimitPeer(ctx, m.net.wg.Name(), id)
+	})
+	if err != nil {
+		context.LoggerFrom(ctx).Debug("Failed to remove peer rate limit",
+			slog.String("peer", id),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// inNetNS runs fn in the configured network namespace, if any.
+func (m *peerManager) inNetNS(fn func() error) error {
+	if m.net.opts.NetNs == "" {
+		return fn()
+	}
+	return system.DoInNetNS(m.net.opts.NetNs, fn)
+}
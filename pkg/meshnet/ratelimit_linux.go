@@ -0,0 +1,227 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// newPeerShaper returns the shaping backend for the current platform.
+func newPeerShaper() peerShaper {
+	return &tcShaper{classes: make(map[string]uint16)}
+}
+
+// tcShaper limits peers with an HTB qdisc on the WireGuard interface. Each
+// limited peer gets its own class, and u32 filters steer traffic destined
+// to the peer into it. Unclassified traffic is not shaped.
+type tcShaper struct {
+	// classes maps peer IDs to the minor number of their class.
+	classes map[string]uint16
+	mu      sync.Mutex
+}
+
+// tcRootHandle is the handle of the root HTB qdisc.
+var tcRootHandle = netlink.MakeHandle(1, 0)
+
+func (s *tcShaper) LimitPeer(ctx context.Context, iface string, peerID string, dests []netip.Prefix, rate uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return fmt.Errorf("get link: %w", err)
+	}
+	if err := s.ensureRoot(link); err != nil {
+		return err
+	}
+	minor, ok := s.classes[peerID]
+	if !ok {
+		minor, err = s.nextMinor()
+		if err != nil {
+			return err
+		}
+	}
+	classID := netlink.MakeHandle(1, minor)
+	class := netlink.NewHtbClass(netlink.ClassAttrs{
+		LinkIndex: link.Attrs().Index,
+		Parent:    tcRootHandle,
+		Handle:    classID,
+	}, netlink.HtbClassAttrs{
+		Rate: rate,
+		Ceil: rate,
+	})
+	if err := netlink.ClassReplace(class); err != nil {
+		return fmt.Errorf("replace htb class: %w", err)
+	}
+	s.classes[peerID] = minor
+	// Replace the filters so changes to the peer's destinations apply.
+	if err := deleteClassFilters(link, classID); err != nil {
+		return err
+	}
+	for _, dest := range dests {
+		if err := netlink.FilterAdd(newDestFilter(link, classID, dest)); err != nil {
+			return fmt.Errorf("add u32 filter for %s: %w", dest, err)
+		}
+	}
+	return nil
+}
+
+func (s *tcShaper) UnlimitPeer(ctx context.Context, iface string, peerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	minor, ok := s.classes[peerID]
+	if !ok {
+		return nil
+	}
+	delete(s.classes, peerID)
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return fmt.Errorf("get link: %w", err)
+	}
+	classID := netlink.MakeHandle(1, minor)
+	if err := deleteClassFilters(link, classID); err != nil {
+		return err
+	}
+	err = netlink.ClassDel(&netlink.HtbClass{ClassAttrs: netlink.ClassAttrs{
+		LinkIndex: link.Attrs().Index,
+		Parent:    tcRootHandle,
+		Handle:    classID,
+	}})
+	if err != nil {
+		return fmt.Errorf("delete htb class: %w", err)
+	}
+	if len(s.classes) == 0 {
+		err = netlink.QdiscDel(netlink.NewHtb(netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Parent:    netlink.HANDLE_ROOT,
+			Handle:    tcRootHandle,
+		}))
+		if err != nil {
+			return fmt.Errorf("delete htb qdisc: %w", err)
+		}
+	}
+	return nil
+}
+
+// ensureRoot installs the root HTB qdisc on the link if it is not present.
+func (s *tcShaper) ensureRoot(link netlink.Link) error {
+	qdiscs, err := netlink.QdiscList(link)
+	if err != nil {
+		return fmt.Errorf("list qdiscs: %w", err)
+	}
+	for _, qdisc := range qdiscs {
+		if _, ok := qdisc.(*netlink.Htb); ok && qdisc.Attrs().Handle == tcRootHandle {
+			return nil
+		}
+	}
+	// The default class of zero leaves unclassified traffic unshaped.
+	err = netlink.QdiscReplace(netlink.NewHtb(netlink.QdiscAttrs{
+		LinkIndex: link.Attrs().Index,
+		Parent:    netlink.HANDLE_ROOT,
+		Handle:    tcRootHandle,
+	}))
+	if err != nil {
+		return fmt.Errorf("replace root qdisc: %w", err)
+	}
+	return nil
+}
+
+// nextMinor returns the lowest class minor number not in use.
+func (s *tcShaper) nextMinor() (uint16, error) {
+	used := make(map[uint16]struct{}, len(s.classes))
+	for _, minor := range s.classes {
+		used[minor] = struct{}{}
+	}
+	for minor := uint16(1); minor < 0xffff; minor++ {
+		if _, ok := used[minor]; !ok {
+			return minor, nil
+		}
+	}
+	return 0, fmt.Errorf("no htb classes available")
+}
+
+// deleteClassFilters removes the u32 filters steering traffic into the given class.
+func deleteClassFilters(link netlink.Link, classID uint32) error {
+	filters, err := netlink.FilterList(link, tcRootHandle)
+	if err != nil {
+		return fmt.Errorf("list filters: %w", err)
+	}
+	for _, filter := range filters {
+		u32, ok := filter.(*netlink.U32)
+		if !ok || u32.ClassId != classID {
+			continue
+		}
+		if err := netlink.FilterDel(u32); err != nil {
+			return fmt.Errorf("delete u32 filter: %w", err)
+		}
+	}
+	return nil
+}
+
+// newDestFilter returns a u32 filter classifying packets destined to the given
+// prefix into the given class. WireGuard interfaces carry bare IP packets, so
+// offsets are from the start of the IP header.
+func newDestFilter(link netlink.Link, classID uint32, dest netip.Prefix) *netlink.U32 {
+	dest = dest.Masked()
+	protocol, priority, offset := uint16(unix.ETH_P_IP), uint16(1), int32(16)
+	if dest.Addr().Is6() {
+		protocol, priority, offset = unix.ETH_P_IPV6, 2, 24
+	}
+	addr := dest.Addr().AsSlice()
+	bits := dest.Bits()
+	keys := make([]netlink.TcU32Key, 0, len(addr)/4)
+	for i := 0; i < len(addr); i += 4 {
+		var mask uint32
+		switch {
+		case bits >= 32:
+			mask = 0xffffffff
+		case bits > 0:
+			mask = ^uint32(0) << (32 - bits)
+		}
+		keys = append(keys, netlink.TcU32Key{
+			Mask: mask,
+			Val:  binary.BigEndian.Uint32(addr[i:i+4]) & mask,
+			Off:  offset + int32(i),
+		})
+		bits -= 32
+		if bits <= 0 {
+			break
+		}
+	}
+	return &netlink.U32{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: link.Attrs().Index,
+			Parent:    tcRootHandle,
+			Priority:  priority,
+			Protocol:  protocol,
+		},
+		ClassId: classID,
+		Sel: &netlink.TcU32Sel{
+			Flags: netlink.TC_U32_TERMINAL,
+			// Keys are serialized up to the capacity of the slice.
+			Keys: slices.Clip(keys),
+		},
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestParseRate(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		in      string
+		want    uint64
+		wantErr bool
+	}{
+		{in: "1000", want: 1000},
+		{in: "512bit", want: 512},
+		{in: "64kbit", want: 64_000},
+		{in: "10Mbit", want: 10_000_000},
+		{in: " 1gbit ", want: 1_000_000_000},
+		{in: "2tbit", want: 2_000_000_000_000},
+		{in: "", wantErr: true},
+		{in: "0mbit", wantErr: true},
+		{in: "-1mbit", wantErr: true},
+		{in: "fast", wantErr: true},
+		{in: "10mbps", wantErr: true},
+	}
+	for _, tt := range tc {
+		got, err := ParseRate(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseRate(%q): expected error, got %d", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRate(%q): unexpected error: %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPeerRateLimits(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	defer db.Close()
+	err := db.MeshState().SetMeshState(ctx, types.NetworkState{
+		NetworkState: &v1.NetworkState{
+			NetworkV4: "172.16.0.0/12",
+			NetworkV6: "2001:db8::/64",
+			Domain:    "example.com",
+		},
+	})
+	if err != nil {
+		t.Fatalf("set network state: %v", err)
+	}
+	err = db.Networking().PutNetworkACL(ctx, types.NetworkACL{NetworkACL: &v1.NetworkACL{
+		Name:             "allow-all",
+		Action:           v1.ACLAction_ACTION_ACCEPT,
+		SourceNodes:      []string{"*"},
+		DestinationNodes: []string{"*"},
+		SourceCIDRs:      []string{"*"},
+		DestinationCIDRs: []string{"*"},
+	}})
+	if err != nil {
+		t.Fatalf("create network ACL: %v", err)
+	}
+	for i, id := range []string{"node", "limited", "unlimited"} {
+		err := db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:                 id,
+			PublicKey:          mustGeneratePublicKey(t),
+			PrimaryEndpoint:    "127.0.0.1",
+			WireguardEndpoints: []string{fmt.Sprintf("127.0.0.1:%d", 51820+i)},
+			PrivateIPv4:        fmt.Sprintf("172.16.0.%d/32", i+1),
+		}})
+		if err != nil {
+			t.Fatalf("create peer: %v", err)
+		}
+		if id == "node" {
+			continue
+		}
+		err = db.Peers().PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{
+			Source: "node",
+			Target: id,
+		}})
+		if err != nil {
+			t.Fatalf("put edge to %q: %v", id, err)
+		}
+	}
+
+	shaper := &recordingShaper{limits: make(map[string]shapedPeer)}
+	wg := &namedRecorder{peerRecorder: &peerRecorder{peers: make(map[string]wireguard.Peer)}, name: "webmesh0"}
+	m := &manager{
+		nodeID:  "node",
+		storage: db,
+		wg:      wg,
+		shaper:  shaper,
+		opts: Options{
+			DisablePeerPing: true,
+			PeerRateLimits:  map[string]uint64{"limited": 10_000_000},
+		},
+	}
+	m.peers = newPeerManager(m)
+	if err := m.peers.Sync(ctx); err != nil {
+		t.Fatalf("sync peers: %v", err)
+	}
+	if len(wg.peers) != 2 {
+		t.Fatalf("expected 2 peers after sync, got %d", len(wg.peers))
+	}
+	limit, ok := shaper.get("limited")
+	if !ok {
+		t.Fatal("expected a rate limit to be applied to the limited peer")
+	}
+	if limit.iface != "webmesh0" {
+		t.Errorf("expected limit on interface webmesh0, got %q", limit.iface)
+	}
+	if limit.rate != 10_000_000 {
+		t.Errorf("expected rate of 10000000 bits/s, got %d", limit.rate)
+	}
+	if want := netip.MustParsePrefix("172.16.0.2/32"); !slices.Contains(limit.dests, want) {
+		t.Errorf("expected limit destinations to contain %s, got %v", want, limit.dests)
+	}
+	if _, ok := shaper.get("unlimited"); ok {
+		t.Error("expected no rate limit for a peer without a configured cap")
+	}
+
+	// Removing the peer removes its limit.
+	if err := db.Peers().Delete(ctx, "limited"); err != nil {
+		t.Fatalf("delete peer: %v", err)
+	}
+	if err := m.peers.Sync(ctx); err != nil {
+		t.Fatalf("sync peers: %v", err)
+	}
+	if _, ok := shaper.get("limited"); ok {
+		t.Fatal("expected rate limit to be removed with the peer")
+	}
+}
+
+type shapedPeer struct {
+	iface string
+	dests []netip.Prefix
+	rate  uint64
+}
+
+type recordingShaper struct {
+	limits map[string]shapedPeer
+	mu     sync.Mutex
+}
+
+func (r *recordingShaper) LimitPeer(_ context.Context, iface string, peerID string, dests []netip.Prefix, rate uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits[peerID] = shapedPeer{iface: iface, dests: dests, rate: rate}
+	return nil
+}
+
+func (r *recordingShaper) UnlimitPeer(_ context.Context, _ string, peerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.limits, peerID)
+	return nil
+}
+
+func (r *recordingShaper) get(peerID string) (shapedPeer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limit, ok := r.limits[peerID]
+	return limit, ok
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system/dns"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// DefaultReconcileInterval is the default interval at which the interface
+// is reconciled with the store.
+const DefaultReconcileInterval = 5 * time.Minute
+
+// runReconcile periodically reconciles the interface with the store until
+// the context is canceled.
+func (m *manager) runReconcile(ctx context.Context, interval time.Duration) {
+	log := context.LoggerFrom(ctx)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := m.reconcile(ctx); err != nil {
+				log.Warn("Error reconciling network state", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// reconcile refreshes the peers and, if enabled, the mesh DNS servers when
+// they no longer match the store, along with any conditional DNS forwarders
+// whose server changed. Nothing is touched when they are in sync.
+func (m *manager) reconcile(ctx context.Context) error {
+	log := context.LoggerFrom(ctx)
+	wgpeers, err := WireGuardPeersFor(ctx, m.storage, m.nodeID)
+	if err != nil {
+		return fmt.Errorf("get wireguard peers: %w", err)
+	}
+	if !m.peers.inSync(wgpeers) {
+		log.Info("WireGuard peers have drifted from the store, refreshing")
+		if err := m.peers.Refresh(ctx, wgpeers); err != nil {
+			return fmt.Errorf("refresh peers: %w", err)
+		}
+	}
+	if m.dns == nil {
+		return nil
+	}
+	if m.opts.ReconcileDNSServers {
+		ok, err := m.dns.serversInSync(ctx)
+		if err != nil {
+			return fmt.Errorf("check dns servers: %w", err)
+		}
+		if !ok {
+			log.Info("MeshDNS servers have drifted from the store, refreshing")
+			if err := m.dns.RefreshServers(ctx); err != nil {
+				return fmt.Errorf("refresh dns servers: %w", err)
+			}
+		}
+	}
+	m.dns.mu.Lock()
+	defer m.dns.mu.Unlock()
+	if err := m.dns.syncForwarders(ctx); err != nil {
+		return fmt.Errorf("sync conditional forwarders: %w", err)
+	}
+	return nil
+}
+
+// Reprovision removes all peers, routes, and DNS configuration from the
+// interface and rebuilds them from the current state of the store.
+func (m *manager) Reprovision(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.wg == nil {
+		return errors.New("reprovision called before wireguard interface is ready")
+	}
+	log := context.LoggerFrom(ctx).With("component", "net-manager")
+	ctx = context.WithLogger(ctx, log)
+	// Read the store first so that a failure leaves the interface untouched.
+	wgpeers, err := WireGuardPeersFor(ctx, m.storage, m.nodeID)
+	if err != nil {
+		return fmt.Errorf("get wireguard peers: %w", err)
+	}
+	log.Info("Reprovisioning network state from the store")
+	if err := m.peers.flush(ctx); err != nil {
+		return fmt.Errorf("flush peers: %w", err)
+	}
+	if !m.opts.DisableRouteManagement {
+		if err := m.flushRoutes(ctx); err != nil {
+			return fmt.Errorf("flush routes: %w", err)
+		}
+	}
+	if err := m.addMeshRoutes(ctx, m.started); err != nil {
+		return err
+	}
+	if err := m.peers.Refresh(ctx, wgpeers); err != nil {
+		return fmt.Errorf("refresh peers: %w", err)
+	}
+	if m.dns != nil {
+		if err := m.dns.reprovision(ctx); err != nil {
+			return fmt.Errorf("reprovision dns: %w", err)
+		}
+	}
+	return nil
+}
+
+// flushRoutes removes every route from the wireguard interface except those
+// to link-local addresses, which are managed by the system.
+func (m *manager) flushRoutes(ctx context.Context) error {
+	routes, err := m.wg.Routes(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, route := range routes {
+		if route.Addr().IsLinkLocalUnicast() {
+			continue
+		}
+		if err := m.wg.RemoveRoute(ctx, route); err != nil {
+			errs = append(errs, fmt.Errorf("remove route %s: %w", route, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flush removes every peer from the wireguard interface and forgets what was
+// last applied.
+func (m *peerManager) flush(ctx context.Context) error {
+	m.peermu.Lock()
+	defer m.peermu.Unlock()
+	var errs []error
+	for id := range m.net.WireGuard().Peers() {
+		if err := m.removePeer(ctx, id); err != nil {
+			errs = append(errs, fmt.Errorf("delete peer %s: %w", id, err))
+		}
+	}
+	m.applied = nil
+	m.asymmetric = nil
+	return errors.Join(errs...)
+}
+
+// reprovision removes the DNS servers, search domains, and conditional
+// forwarders from the system configuration, then configures them again.
+// Search domains are restored as they were, servers and forwarders are
+// looked up again in the store.
+func (d *dnsManager) reprovision(ctx context.Context) error {
+	d.mu.Lock()
+	var errs []error
+	if len(d.dnsservers) > 0 {
+		if err := dns.RemoveServers(d.ifaceName(), d.dnsservers); err != nil {
+			errs = append(errs, fmt.Errorf("remove dns servers: %w", err))
+		}
+		d.dnsservers = []netip.AddrPort{}
+		d.invalidateCache()
+	}
+	if err := d.removeForwarders(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(d.searchdomains) > 0 {
+		if err := dns.RemoveSearchDomains(d.ifaceName(), d.searchdomains); err != nil {
+			errs = append(errs, fmt.Errorf("remove dns search domains: %w", err))
+		} else if err := dns.AddSearchDomains(d.ifaceName(), d.searchdomains); err != nil {
+			errs = append(errs, fmt.Errorf("add dns search domains: %w", err))
+		}
+	}
+	d.mu.Unlock()
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return d.RefreshServers(ctx)
+}
+
+// inSync returns true if the given peers match those last applied by Refresh
+// and the interface still holds exactly those peers.
+func (m *peerManager) inSync(wgpeers []*v1.WireGuardPeer) bool {
+	m.peermu.Lock()
+	defer m.peermu.Unlock()
+	if m.applied == nil || !types.WireGuardPeersEqual(m.applied, wgpeers) {
+		return false
+	}
+	current := m.net.WireGuard().Peers()
+	if len(current) != len(wgpeers) {
+		return false
+	}
+	for _, peer := range wgpeers {
+		if _, ok := current[peer.GetNode().GetId()]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db, addPeer := newReconcileTestDB(t)
+	defer db.Close()
+	addPeer(0, "node")
+	addPeer(1, "a")
+	addPeer(2, "b")
+
+	wg := &countingRecorder{peerRecorder: &peerRecorder{peers: make(map[string]wireguard.Peer)}}
+	m := &manager{nodeID: "node", storage: db, opts: Options{DisablePeerPing: true}, wg: wg}
+	m.peers = newPeerManager(m)
+	if err := m.peers.Sync(ctx); err != nil {
+		t.Fatalf("sync peers: %v", err)
+	}
+	if len(wg.peers) != 2 {
+		t.Fatalf("expected 2 peers after sync, got %d", len(wg.peers))
+	}
+
+	// Nothing has drifted, so reconciliation leaves the interface alone.
+	puts := wg.puts
+	if err := m.reconcile(ctx); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if wg.puts != puts {
+		t.Fatalf("expected no peer updates while in sync, got %d", wg.puts-puts)
+	}
+
+	// A peer is lost from the interface and put back by reconciliation.
+	delete(wg.peers, "a")
+	if err := m.reconcile(ctx); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if _, ok := wg.peers["a"]; !ok {
+		t.Fatal("expected missing peer to be restored by reconciliation")
+	}
+
+	// A peer is added to the store without an update event.
+	addPeer(3, "c")
+	if err := m.reconcile(ctx); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if _, ok := wg.peers["c"]; !ok {
+		t.Fatal("expected peer missed by updates to be added by reconciliation")
+	}
+	if len(wg.peers) != 3 {
+		t.Fatalf("expected 3 peers after reconciliation, got %d", len(wg.peers))
+	}
+}
+
+func TestReprovision(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db, addPeer := newReconcileTestDB(t)
+	defer db.Close()
+	addPeer(0, "node")
+	addPeer(1, "a")
+	addPeer(2, "b")
+
+	wg := &reprovisionRecorder{peerRecorder: &peerRecorder{peers: make(map[string]wireguard.Peer)}}
+	m := &manager{nodeID: "node", storage: db, opts: Options{DisablePeerPing: true}, wg: wg}
+	m.peers = newPeerManager(m)
+	m.started = StartOptions{
+		NetworkV4: netip.MustParsePrefix("172.16.0.0/12"),
+		NetworkV6: netip.MustParsePrefix("2001:db8::/64"),
+		AddressV6: netip.MustParsePrefix("2001:db8::1/128"),
+	}
+	if err := m.addMeshRoutes(ctx, m.started); err != nil {
+		t.Fatalf("add mesh routes: %v", err)
+	}
+	if err := m.peers.Sync(ctx); err != nil {
+		t.Fatalf("sync peers: %v", err)
+	}
+	linkLocal := netip.MustParsePrefix("fe80::/64")
+	wg.routes = append(wg.routes, linkLocal)
+	wantPeers := make(map[string]wireguard.Peer, len(wg.peers))
+	for id, peer := range wg.peers {
+		wantPeers[id] = peer
+	}
+	wantRoutes := slices.Clone(wg.routes)
+
+	// Corrupt the live configuration in ways a peer refresh does not notice.
+	delete(wg.peers, "a")
+	b := wg.peers["b"]
+	b.Endpoint = netip.MustParseAddrPort("192.0.2.1:51820")
+	wg.peers["b"] = b
+	wg.peers["stale"] = wireguard.Peer{ID: "stale"}
+	wg.routes = append(wg.routes, netip.MustParsePrefix("10.99.0.0/16"))
+	wg.routes = slices.DeleteFunc(wg.routes, func(route netip.Prefix) bool {
+		return route == m.started.NetworkV4
+	})
+
+	if err := m.Reprovision(ctx); err != nil {
+		t.Fatalf("reprovision: %v", err)
+	}
+	if len(wg.peers) != len(wantPeers) {
+		t.Fatalf("expected %d peers after reprovision, got %d", len(wantPeers), len(wg.peers))
+	}
+	for id, want := range wantPeers {
+		got, ok := wg.peers[id]
+		if !ok {
+			t.Fatalf("expected peer %q to be restored", id)
+		}
+		if got.Endpoint != want.Endpoint {
+			t.Errorf("expected peer %q endpoint %s, got %s", id, want.Endpoint, got.Endpoint)
+		}
+	}
+	slices.SortFunc(wantRoutes, comparePrefixes)
+	gotRoutes := slices.Clone(wg.routes)
+	slices.SortFunc(gotRoutes, comparePrefixes)
+	if !slices.Equal(gotRoutes, wantRoutes) {
+		t.Fatalf("expected routes %v after reprovision, got %v", wantRoutes, gotRoutes)
+	}
+	if !m.peers.inSync(mustWireGuardPeers(t, db)) {
+		t.Fatal("expected peers to be in sync with the store after reprovision")
+	}
+}
+
+// newReconcileTestDB returns a database with a mesh network and an ACL that
+// allows all traffic, and a function to add peers connected to "node".
+func newReconcileTestDB(t *testing.T) (*meshdb.TestDB, func(i int, id string)) {
+	t.Helper()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	err := db.MeshState().SetMeshState(ctx, types.NetworkState{
+		NetworkState: &v1.NetworkState{
+			NetworkV4: "172.16.0.0/12",
+			NetworkV6: "2001:db8::/64",
+			Domain:    "example.com",
+		},
+	})
+	if err != nil {
+		t.Fatalf("set network state: %v", err)
+	}
+	err = db.Networking().PutNetworkACL(ctx, types.NetworkACL{NetworkACL: &v1.NetworkACL{
+		Name:             "allow-all",
+		Action:           v1.ACLAction_ACTION_ACCEPT,
+		SourceNodes:      []string{"*"},
+		DestinationNodes: []string{"*"},
+		SourceCIDRs:      []string{"*"},
+		DestinationCIDRs: []string{"*"},
+	}})
+	if err != nil {
+		t.Fatalf("create network ACL: %v", err)
+	}
+	addPeer := func(i int, id string) {
+		t.Helper()
+		err := db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:              id,
+			PublicKey:       mustGeneratePublicKey(t),
+			PrimaryEndpoint: "127.0.0.1",
+			WireguardEndpoints: []string{
+				fmt.Sprintf("127.0.0.1:%d", 51820+i),
+			},
+			PrivateIPv4: fmt.Sprintf("172.16.0.%d/32", i+1),
+			PrivateIPv6: fmt.Sprintf("2001:db8::%d/128", i+1),
+		}})
+		if err != nil {
+			t.Fatalf("create peer: %v", err)
+		}
+		if id == "node" {
+			return
+		}
+		err = db.Peers().PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{
+			Source: "node",
+			Target: id,
+		}})
+		if err != nil {
+			t.Fatalf("put edge to %q: %v", id, err)
+		}
+	}
+	return db, addPeer
+}
+
+func mustWireGuardPeers(t *testing.T, db *meshdb.TestDB) []*v1.WireGuardPeer {
+	t.Helper()
+	wgpeers, err := WireGuardPeersFor(context.Background(), db, "node")
+	if err != nil {
+		t.Fatalf("get wireguard peers: %v", err)
+	}
+	return wgpeers
+}
+
+func comparePrefixes(a, b netip.Prefix) int {
+	return strings.Compare(a.String(), b.String())
+}
+
+type countingRecorder struct {
+	*peerRecorder
+	puts int
+}
+
+func (c *countingRecorder) PutPeer(ctx context.Context, peer *wireguard.Peer) error {
+	c.puts++
+	return c.peerRecorder.PutPeer(ctx, peer)
+}
+
+type reprovisionRecorder struct {
+	*peerRecorder
+	routes []netip.Prefix
+}
+
+func (r *reprovisionRecorder) AddRoute(_ context.Context, route netip.Prefix) error {
+	r.routes = append(r.routes, route)
+	return nil
+}
+
+func (r *reprovisionRecorder) RemoveRoute(_ context.Context, route netip.Prefix) error {
+	r.routes = slices.DeleteFunc(r.routes, func(p netip.Prefix) bool { return p == route })
+	return nil
+}
+
+func (r *reprovisionRecorder) Routes(context.Context) ([]netip.Prefix, error) {
+	return slices.Clone(r.routes), nil
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system/firewall"
+)
+
+// ErrRouteAccountingUnsupported is returned when the firewall in use cannot
+// count traffic per route.
+var ErrRouteAccountingUnsupported = errors.New("route accounting is not supported by the firewall")
+
+// Route Metrics
+var (
+	// RouteBytesTotal tracks bytes forwarded to routes advertised by this node.
+	RouteBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "webmesh",
+		Name:      "route_forwarded_bytes_total",
+		Help:      "Total bytes forwarded to a route advertised by this node.",
+	}, []string{"interface", "route", "prefix"})
+
+	// RoutePacketsTotal tracks packets forwarded to routes advertised by this node.
+	RoutePacketsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "webmesh",
+		Name:      "route_forwarded_packets_total",
+		Help:      "Total packets forwarded to a route advertised by this node.",
+	}, []string{"interface", "route", "prefix"})
+)
+
+// RouteTraffic is the traffic forwarded to a destination prefix of a route
+// advertised by this node.
+type RouteTraffic struct {
+	// Route is the name of the route.
+	Route string
+	// Prefix is the destination prefix being counted.
+	Prefix netip.Prefix
+	// Counter is the traffic forwarded to the prefix.
+	firewall.Counter
+}
+
+// routeAccounting tracks the prefixes being counted and the counter values
+// last recorded to metrics.
+type routeAccounting struct {
+	// routes maps each counted prefix to the route it belongs to.
+	routes map[netip.Prefix]string
+	// recorded are the counter values last added to metrics.
+	recorded map[netip.Prefix]firewall.Counter
+}
+
+// routeCounter returns the firewall as a route counter if it supports it.
+func (m *manager) routeCounter() (firewall.RouteCounter, error) {
+	counter, ok := m.fw.(firewall.RouteCounter)
+	if !ok {
+		return nil, ErrRouteAccountingUnsupported
+	}
+	return counter, nil
+}
+
+// RouteTraffic returns the traffic forwarded to each destination prefix of
+// the routes advertised by this node, as of the last sync with the store.
+func (m *manager) RouteTraffic(ctx context.Context) ([]RouteTraffic, error) {
+	m.acctmu.Lock()
+	defer m.acctmu.Unlock()
+	counter, err := m.routeCounter()
+	if err != nil {
+		return nil, err
+	}
+	counters, err := counter.RouteCounters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get route counters: %w", err)
+	}
+	out := make([]RouteTraffic, 0, len(m.accounting.routes))
+	for prefix, route := range m.accounting.routes {
+		out = append(out, RouteTraffic{
+			Route:   route,
+			Prefix:  prefix,
+			Counter: counters[prefix],
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Route != out[j].Route {
+			return out[i].Route < out[j].Route
+		}
+		return out[i].Prefix.String() < out[j].Prefix.String()
+	})
+	return out, nil
+}
+
+// runRouteAccounting periodically syncs the route counters with the routes
+// advertised by this node and records them to metrics.
+func (m *manager) runRouteAccounting(ctx context.Context, interval time.Duration) {
+	log := context.LoggerFrom(ctx)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := m.syncRouteCounters(ctx); err != nil {
+				log.Warn("Failed to sync route counters", slog.String("error", err.Error()))
+				continue
+			}
+			if err := m.recordRouteMetrics(ctx); err != nil {
+				log.Warn("Failed to record route metrics", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// syncRouteCounters counts the destination prefixes of the routes advertised
+// by this node and stops counting those no longer advertised.
+func (m *manager) syncRouteCounters(ctx context.Context) error {
+	m.acctmu.Lock()
+	defer m.acctmu.Unlock()
+	counter, err := m.routeCounter()
+	if err != nil {
+		return err
+	}
+	routes, err := m.storage.Networking().GetRoutesByNode(ctx, m.nodeID)
+	if err != nil {
+		return fmt.Errorf("get routes for node: %w", err)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].GetName() < routes[j].GetName() })
+	want := make(map[netip.Prefix]string)
+	for _, route := range routes {
+		for _, prefix := range route.DestinationPrefixes() {
+			prefix = prefix.Masked()
+			if _, ok := want[prefix]; !ok {
+				want[prefix] = route.GetName()
+			}
+		}
+	}
+	if m.accounting.routes == nil {
+		m.accounting.routes = make(map[netip.Prefix]string)
+		m.accounting.recorded = make(map[netip.Prefix]firewall.Counter)
+	}
+	iface := m.wg.Name()
+	for prefix, route := range m.accounting.routes {
+		if want[prefix] == route {
+			continue
+		}
+		if _, ok := want[prefix]; !ok {
+			if err := counter.RemoveRouteCounter(ctx, prefix); err != nil {
+				return fmt.Errorf("remove route counter for %s: %w", prefix, err)
+			}
+		}
+		RouteBytesTotal.DeleteLabelValues(iface, route, prefix.String())
+		RoutePacketsTotal.DeleteLabelValues(iface, route, prefix.String())
+		delete(m.accounting.routes, prefix)
+		delete(m.accounting.recorded, prefix)
+	}
+	for prefix, route := range want {
+		if _, ok := m.accounting.routes[prefix]; ok {
+			continue
+		}
+		if err := counter.AddRouteCounter(ctx, prefix); err != nil {
+			return fmt.Errorf("add route counter for %s: %w", prefix, err)
+		}
+		m.accounting.routes[prefix] = route
+	}
+	return nil
+}
+
+// recordRouteMetrics adds the traffic counted since the last call to the
+// route metrics.
+func (m *manager) recordRouteMetrics(ctx context.Context) error {
+	m.acctmu.Lock()
+	defer m.acctmu.Unlock()
+	counter, err := m.routeCounter()
+	if err != nil {
+		return err
+	}
+	counters, err := counter.RouteCounters(ctx)
+	if err != nil {
+		return fmt.Errorf("get route counters: %w", err)
+	}
+	iface := m.wg.Name()
+	for prefix, route := range m.accounting.routes {
+		current := counters[prefix]
+		last := m.accounting.recorded[prefix]
+		// Counters restart from zero if the rule was recreated.
+		if current.Bytes < last.Bytes || current.Packets < last.Packets {
+			last = firewall.Counter{}
+		}
+		RouteBytesTotal.WithLabelValues(iface, route, prefix.String()).Add(float64(current.Bytes - last.Bytes))
+		RoutePacketsTotal.WithLabelValues(iface, route, prefix.String()).Add(float64(current.Packets - last.Packets))
+		m.accounting.recorded[prefix] = current
+	}
+	return nil
+}
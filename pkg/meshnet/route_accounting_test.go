@@ -0,0 +1,140 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system/firewall"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestRouteAccounting(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	defer db.Close()
+	putRoute := func(name, node string, cidrs ...string) {
+		t.Helper()
+		err := db.Networking().PutRoute(ctx, types.Route{Route: &v1.Route{
+			Name:             name,
+			Node:             node,
+			DestinationCIDRs: cidrs,
+		}})
+		if err != nil {
+			t.Fatalf("put route %s: %v", name, err)
+		}
+	}
+	putRoute("lan", "node", "192.168.1.0/24", "fd00:1::/64")
+	putRoute("transit", "node", "10.50.0.0/16")
+	putRoute("elsewhere", "other", "10.60.0.0/16")
+
+	fw := &countingFirewall{counters: make(map[netip.Prefix]firewall.Counter)}
+	m := &manager{nodeID: "node", storage: db, fw: fw, wg: &namedInterface{name: "webmesh-acct"}}
+	if err := m.syncRouteCounters(ctx); err != nil {
+		t.Fatalf("sync route counters: %v", err)
+	}
+	if len(fw.counters) != 3 {
+		t.Fatalf("expected 3 counted prefixes, got %v", fw.counters)
+	}
+	if _, ok := fw.counters[netip.MustParsePrefix("10.60.0.0/16")]; ok {
+		t.Fatal("expected routes of other nodes to not be counted")
+	}
+
+	fw.counters[netip.MustParsePrefix("192.168.1.0/24")] = firewall.Counter{Bytes: 1000, Packets: 10}
+	fw.counters[netip.MustParsePrefix("fd00:1::/64")] = firewall.Counter{Bytes: 200, Packets: 2}
+	fw.counters[netip.MustParsePrefix("10.50.0.0/16")] = firewall.Counter{Bytes: 5000, Packets: 50}
+	traffic, err := m.RouteTraffic(ctx)
+	if err != nil {
+		t.Fatalf("route traffic: %v", err)
+	}
+	want := []RouteTraffic{
+		{Route: "lan", Prefix: netip.MustParsePrefix("192.168.1.0/24"), Counter: firewall.Counter{Bytes: 1000, Packets: 10}},
+		{Route: "lan", Prefix: netip.MustParsePrefix("fd00:1::/64"), Counter: firewall.Counter{Bytes: 200, Packets: 2}},
+		{Route: "transit", Prefix: netip.MustParsePrefix("10.50.0.0/16"), Counter: firewall.Counter{Bytes: 5000, Packets: 50}},
+	}
+	if len(traffic) != len(want) {
+		t.Fatalf("expected %d route counters, got %v", len(want), traffic)
+	}
+	for i := range want {
+		if traffic[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], traffic[i])
+		}
+	}
+
+	// Metrics only grow by the traffic counted since the last collection.
+	if err := m.recordRouteMetrics(ctx); err != nil {
+		t.Fatalf("record route metrics: %v", err)
+	}
+	fw.counters[netip.MustParsePrefix("10.50.0.0/16")] = firewall.Counter{Bytes: 7000, Packets: 70}
+	if err := m.recordRouteMetrics(ctx); err != nil {
+		t.Fatalf("record route metrics: %v", err)
+	}
+	if got := testutil.ToFloat64(RouteBytesTotal.WithLabelValues("webmesh-acct", "transit", "10.50.0.0/16")); got != 7000 {
+		t.Errorf("expected 7000 bytes recorded for transit, got %v", got)
+	}
+	if got := testutil.ToFloat64(RoutePacketsTotal.WithLabelValues("webmesh-acct", "lan", "192.168.1.0/24")); got != 10 {
+		t.Errorf("expected 10 packets recorded for lan, got %v", got)
+	}
+
+	// Withdrawn routes stop being counted.
+	if err := db.Networking().DeleteRoute(ctx, "transit"); err != nil {
+		t.Fatalf("delete route: %v", err)
+	}
+	if err := m.syncRouteCounters(ctx); err != nil {
+		t.Fatalf("sync route counters: %v", err)
+	}
+	if _, ok := fw.counters[netip.MustParsePrefix("10.50.0.0/16")]; ok {
+		t.Fatal("expected counter for withdrawn route to be removed")
+	}
+
+	// Firewalls without counting support are reported as such.
+	m.fw = &masqFirewall{}
+	if _, err := m.RouteTraffic(ctx); !errors.Is(err, ErrRouteAccountingUnsupported) {
+		t.Fatalf("expected ErrRouteAccountingUnsupported, got %v", err)
+	}
+}
+
+type countingFirewall struct {
+	firewall.Firewall
+	counters map[netip.Prefix]firewall.Counter
+}
+
+func (fw *countingFirewall) AddRouteCounter(_ context.Context, prefix netip.Prefix) error {
+	fw.counters[prefix] = firewall.Counter{}
+	return nil
+}
+
+func (fw *countingFirewall) RemoveRouteCounter(_ context.Context, prefix netip.Prefix) error {
+	delete(fw.counters, prefix)
+	return nil
+}
+
+func (fw *countingFirewall) RouteCounters(_ context.Context) (map[netip.Prefix]firewall.Counter, error) {
+	out := make(map[netip.Prefix]firewall.Counter, len(fw.counters))
+	for prefix, counter := range fw.counters {
+		out[prefix] = counter
+	}
+	return out, nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// ErrSessionNotFound is returned when there is no relay session to a peer.
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is an active ICE or libp2p relay session to a peer.
+type Session struct {
+	// PeerID is the ID of the peer on the other end of the session.
+	PeerID types.NodeID `json:"peerID"`
+	// LocalAddr is the local proxy address used as the WireGuard endpoint
+	// for the peer.
+	LocalAddr netip.AddrPort `json:"localAddr"`
+	// Started is when the session was established.
+	Started time.Time `json:"started"`
+	// BytesSent is the number of bytes sent over the session, if known.
+	BytesSent uint64 `json:"bytesSent,omitempty"`
+	// BytesReceived is the number of bytes received over the session, if known.
+	BytesReceived uint64 `json:"bytesReceived,omitempty"`
+}
+
+// Age returns how long the session has been established.
+func (s Session) Age() time.Duration {
+	return time.Since(s.Started)
+}
+
+// trafficReporter is implemented by relay connections that count the
+// traffic passing through them.
+type trafficReporter interface {
+	BytesTransferred() (sent, received uint64)
+}
+
+func (m *peerManager) Sessions() []Session {
+	m.p2pmu.Lock()
+	defer m.p2pmu.Unlock()
+	sessions := make([]Session, 0, len(m.p2pConns))
+	for id, conn := range m.p2pConns {
+		session := Session{
+			PeerID:    types.NodeID(id),
+			LocalAddr: conn.localAddr,
+			Started:   conn.started,
+		}
+		if r, ok := conn.peerConn.(trafficReporter); ok {
+			session.BytesSent, session.BytesReceived = r.BytesTransferred()
+		}
+		sessions = append(sessions, session)
+	}
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return strings.Compare(a.PeerID.String(), b.PeerID.String())
+	})
+	return sessions
+}
+
+func (m *peerManager) KillSession(ctx context.Context, peerID types.NodeID) error {
+	m.p2pmu.Lock()
+	conn, ok := m.p2pConns[peerID.String()]
+	if !ok {
+		m.p2pmu.Unlock()
+		return ErrSessionNotFound
+	}
+	delete(m.p2pConns, peerID.String())
+	m.p2pmu.Unlock()
+	context.LoggerFrom(ctx).Info("Closing relay session to peer",
+		slog.String("peer", peerID.String()),
+		slog.String("local-proxy", conn.localAddr.String()),
+	)
+	return conn.peerConn.Close()
+}
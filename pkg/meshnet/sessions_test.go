@@ -0,0 +1,91 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnet
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// recordingSession is a relay connection that records when it is closed.
+type recordingSession struct {
+	sent, received uint64
+	closed         bool
+}
+
+func (r *recordingSession) BytesTransferred() (uint64, uint64) {
+	return r.sent, r.received
+}
+
+func (r *recordingSession) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestSessions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := newPeerManager(&manager{opts: Options{DisablePeerPing: true}})
+	ice := &recordingSession{sent: 1024, received: 2048}
+	relay := &recordingSession{}
+	started := time.Now().Add(-time.Minute)
+	m.p2pConns["node-b"] = clientPeerConn{
+		peerConn:  relay,
+		localAddr: netip.MustParseAddrPort("127.0.0.1:40001"),
+		started:   started,
+	}
+	m.p2pConns["node-a"] = clientPeerConn{
+		peerConn:  ice,
+		localAddr: netip.MustParseAddrPort("127.0.0.1:40000"),
+		started:   started,
+	}
+
+	sessions := m.Sessions()
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	got := sessions[0]
+	if got.PeerID != "node-a" || got.LocalAddr != netip.MustParseAddrPort("127.0.0.1:40000") {
+		t.Fatalf("unexpected first session: %+v", got)
+	}
+	if got.BytesSent != 1024 || got.BytesReceived != 2048 {
+		t.Fatalf("expected traffic counters to be reported, got sent=%d received=%d", got.BytesSent, got.BytesReceived)
+	}
+	if got.Age() < time.Minute {
+		t.Fatalf("expected session age of at least a minute, got %s", got.Age())
+	}
+
+	if err := m.KillSession(ctx, "node-a"); err != nil {
+		t.Fatalf("kill session: %v", err)
+	}
+	if !ice.closed {
+		t.Fatal("expected the killed session to be closed")
+	}
+	if relay.closed {
+		t.Fatal("expected other sessions to be left open")
+	}
+	if sessions := m.Sessions(); len(sessions) != 1 || sessions[0].PeerID != "node-b" {
+		t.Fatalf("expected only node-b to remain, got %+v", sessions)
+	}
+	if err := m.KillSession(ctx, "node-a"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+}
@@ -19,6 +19,7 @@ package dns
 
 import (
 	"net/netip"
+	"sync"
 	"time"
 )
 
@@ -62,26 +63,136 @@ func GetSystemConfig() DNSConfig {
 	return defaultConfig
 }
 
+// refs reference counts the servers and search domains added to the system
+// configuration, so that several network managers in one process can share it.
+var refs = struct {
+	servers map[string]int
+	domains map[string]int
+	mu      sync.Mutex
+}{
+	servers: make(map[string]int),
+	domains: make(map[string]int),
+}
+
+// refKey returns the reference count key for a value added for the given interface.
+func refKey(iface, value string) string {
+	if perInterfaceConfig {
+		return iface + "/" + value
+	}
+	return value
+}
+
+// acquire increments the reference counts of the given values and returns
+// the ones that were not referenced before.
+func acquire[T interface{ String() string }](counts map[string]int, iface string, values []T) []T {
+	var out []T
+	for _, v := range values {
+		key := refKey(iface, v.String())
+		if counts[key] == 0 {
+			out = append(out, v)
+		}
+		counts[key]++
+	}
+	return out
+}
+
+// release decrements the reference counts of the given values and returns
+// the ones that are no longer referenced. Values that were never acquired
+// are returned as is.
+func release[T interface{ String() string }](counts map[string]int, iface string, values []T) []T {
+	var out []T
+	for _, v := range values {
+		key := refKey(iface, v.String())
+		switch counts[key] {
+		case 0:
+			out = append(out, v)
+		case 1:
+			delete(counts, key)
+			out = append(out, v)
+		default:
+			counts[key]--
+		}
+	}
+	return out
+}
+
+// domain is a search domain that can be reference counted.
+type domain string
+
+func (d domain) String() string { return string(d) }
+
+func toDomains(domains []string) []domain {
+	out := make([]domain, len(domains))
+	for i, d := range domains {
+		out[i] = domain(d)
+	}
+	return out
+}
+
+func fromDomains(domains []domain) []string {
+	out := make([]string, len(domains))
+	for i, d := range domains {
+		out[i] = string(d)
+	}
+	return out
+}
+
 // AddServers adds DNS servers to the system configuration. On Windows
-// the interface name is required.
+// the interface name is required. Servers already added by another caller
+// are only reference counted.
 func AddServers(iface string, servers []netip.AddrPort) error {
-	return addServers(iface, servers)
+	refs.mu.Lock()
+	defer refs.mu.Unlock()
+	toAdd := acquire(refs.servers, iface, servers)
+	if len(toAdd) == 0 {
+		return nil
+	}
+	if err := addServers(iface, toAdd); err != nil {
+		release(refs.servers, iface, servers)
+		return err
+	}
+	return nil
 }
 
 // RemoveServers removes DNS servers from the system configuration. On Windows
-// the interface name is required.
+// the interface name is required. Servers still referenced by another caller
+// are left in place.
 func RemoveServers(iface string, servers []netip.AddrPort) error {
-	return removeServers(iface, servers)
+	refs.mu.Lock()
+	defer refs.mu.Unlock()
+	toRemove := release(refs.servers, iface, servers)
+	if len(toRemove) == 0 {
+		return nil
+	}
+	return removeServers(iface, toRemove)
 }
 
 // AddSearchDomains adds DNS search domains to the system configuration. On Windows
-// the interface name is required.
+// the interface name is required. Domains already added by another caller are
+// only reference counted.
 func AddSearchDomains(iface string, domains []string) error {
-	return addSearchDomains(iface, domains)
+	refs.mu.Lock()
+	defer refs.mu.Unlock()
+	toAdd := acquire(refs.domains, iface, toDomains(domains))
+	if len(toAdd) == 0 {
+		return nil
+	}
+	if err := addSearchDomains(iface, fromDomains(toAdd)); err != nil {
+		release(refs.domains, iface, toDomains(domains))
+		return err
+	}
+	return nil
 }
 
 // RemoveSearchDomains removes DNS search domains from the system configuration. On Windows
-// the interface name is required.
+// the interface name is required. Domains still referenced by another caller are
+// left in place.
 func RemoveSearchDomains(iface string, domains []string) error {
-	return removeSearchDomains(iface, domains)
+	refs.mu.Lock()
+	defer refs.mu.Unlock()
+	toRemove := release(refs.domains, iface, toDomains(domains))
+	if len(toRemove) == 0 {
+		return nil
+	}
+	return removeSearchDomains(iface, fromDomains(toRemove))
 }
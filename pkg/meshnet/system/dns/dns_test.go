@@ -0,0 +1,58 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dns
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestReferenceCounting(t *testing.T) {
+	t.Parallel()
+	counts := make(map[string]int)
+	shared := netip.MustParseAddrPort("10.0.0.1:53")
+	only := netip.MustParseAddrPort("10.0.0.2:53")
+
+	if got := acquire(counts, "webmesh-a", []netip.AddrPort{shared}); !slices.Equal(got, []netip.AddrPort{shared}) {
+		t.Fatalf("expected first reference to be added, got %v", got)
+	}
+	got := acquire(counts, "webmesh-b", []netip.AddrPort{shared, only})
+	if perInterfaceConfig {
+		if !slices.Equal(got, []netip.AddrPort{shared, only}) {
+			t.Fatalf("expected both servers to be added to the second interface, got %v", got)
+		}
+		return
+	}
+	if !slices.Equal(got, []netip.AddrPort{only}) {
+		t.Fatalf("expected only the unreferenced server to be added, got %v", got)
+	}
+	// The shared server is still in use by the second caller.
+	if got := release(counts, "webmesh-a", []netip.AddrPort{shared}); len(got) != 0 {
+		t.Fatalf("expected shared server to be kept, got %v", got)
+	}
+	if got := release(counts, "webmesh-b", []netip.AddrPort{shared, only}); !slices.Equal(got, []netip.AddrPort{shared, only}) {
+		t.Fatalf("expected both servers to be removed, got %v", got)
+	}
+	if len(counts) != 0 {
+		t.Fatalf("expected no references left, got %v", counts)
+	}
+	// Servers that were never added are passed through.
+	if got := release(counts, "webmesh-a", []netip.AddrPort{only}); !slices.Equal(got, []netip.AddrPort{only}) {
+		t.Fatalf("expected untracked server to be removed, got %v", got)
+	}
+}
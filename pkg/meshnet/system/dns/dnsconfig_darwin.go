@@ -30,6 +30,10 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/meshnet/system/routes"
 )
 
+// perInterfaceConfig is true when the system DNS configuration is per interface.
+// DNS servers are configured on the primary service, which every interface shares.
+const perInterfaceConfig = false
+
 func addServers(iface string, servers []netip.AddrPort) error {
 	primaryIface, err := getPrimaryIface()
 	if err != nil {
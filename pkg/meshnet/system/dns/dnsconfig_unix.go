@@ -29,6 +29,10 @@ import (
 	"time"
 )
 
+// perInterfaceConfig is true when the system DNS configuration is per interface.
+// DNS servers are configured in a single resolv.conf shared by every interface.
+const perInterfaceConfig = false
+
 var (
 	isManagedResolvConf = false
 	resolvConf          = "/etc/resolv.conf"
@@ -21,6 +21,10 @@ import (
 	"net/netip"
 )
 
+// perInterfaceConfig is true when the system DNS configuration is per interface.
+// There is no system DNS configuration to share.
+const perInterfaceConfig = false
+
 func loadSystemConfig() (*DNSConfig, error) {
 	return nil, errors.New("not implemented")
 }
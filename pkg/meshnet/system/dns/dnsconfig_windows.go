@@ -27,6 +27,10 @@ import (
 	"golang.org/x/sys/windows"
 )
 
+// perInterfaceConfig is true when the system DNS configuration is per interface.
+// DNS servers are configured on each interface.
+const perInterfaceConfig = true
+
 func addServers(iface string, servers []netip.AddrPort) error {
 	// Just use netsh
 	for i, server := range servers {
@@ -0,0 +1,45 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dns
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+)
+
+// ErrDomainServersUnsupported is returned when the system DNS configuration
+// cannot send queries for a domain to specific servers.
+var ErrDomainServersUnsupported = errors.New("per-domain DNS servers are not supported on this system")
+
+// SetDomainServers configures the system to send queries for the given domain
+// and its subdomains to the given servers, replacing any servers previously set
+// for the domain. On Linux and Windows the interface name is required.
+func SetDomainServers(iface string, domain string, servers []netip.AddrPort) error {
+	return setDomainServers(iface, canonicalDomain(domain), servers)
+}
+
+// RemoveDomainServers removes the servers set for the given domain with
+// SetDomainServers.
+func RemoveDomainServers(iface string, domain string) error {
+	return removeDomainServers(iface, canonicalDomain(domain))
+}
+
+// canonicalDomain returns the domain in lower case without a trailing dot.
+func canonicalDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(domain), ".")
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolverDir is the directory macOS reads per-domain resolver
+// configurations from. Each file is named after the domain it serves.
+const resolverDir = "/etc/resolver"
+
+func setDomainServers(iface string, domain string, servers []netip.AddrPort) error {
+	if err := os.MkdirAll(resolverDir, 0755); err != nil {
+		return fmt.Errorf("create resolver directory: %w", err)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Generated by webmesh for %s\n", iface)
+	for _, server := range servers {
+		fmt.Fprintf(&sb, "nameserver %s\n", server.Addr())
+	}
+	// A resolver file only has a single port for all of its servers.
+	if len(servers) > 0 && servers[0].Port() != 53 {
+		fmt.Fprintf(&sb, "port %d\n", servers[0].Port())
+	}
+	return os.WriteFile(filepath.Join(resolverDir, domain), []byte(sb.String()), 0644)
+}
+
+func removeDomainServers(iface string, domain string) error {
+	err := os.Remove(filepath.Join(resolverDir, domain))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
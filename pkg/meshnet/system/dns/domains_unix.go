@@ -0,0 +1,126 @@
+//go:build !windows && !wasm && !darwin
+
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// linkDomains are the per-domain servers configured on each interface
+// through systemd-resolved.
+var linkDomains = struct {
+	ifaces map[string]map[string][]netip.AddrPort
+	mu     sync.Mutex
+}{
+	ifaces: make(map[string]map[string][]netip.AddrPort),
+}
+
+func setDomainServers(iface string, domain string, servers []netip.AddrPort) error {
+	if _, err := exec.LookPath("resolvectl"); err != nil {
+		return ErrDomainServersUnsupported
+	}
+	linkDomains.mu.Lock()
+	defer linkDomains.mu.Unlock()
+	domains := make(map[string][]netip.AddrPort, len(linkDomains.ifaces[iface])+1)
+	for d, s := range linkDomains.ifaces[iface] {
+		domains[d] = s
+	}
+	domains[domain] = servers
+	if err := applyLinkDomains(iface, domains); err != nil {
+		return err
+	}
+	linkDomains.ifaces[iface] = domains
+	return nil
+}
+
+func removeDomainServers(iface string, domain string) error {
+	linkDomains.mu.Lock()
+	defer linkDomains.mu.Unlock()
+	current, ok := linkDomains.ifaces[iface]
+	if !ok {
+		return nil
+	}
+	if _, ok := current[domain]; !ok {
+		return nil
+	}
+	domains := make(map[string][]netip.AddrPort, len(current))
+	for d, s := range current {
+		if d != domain {
+			domains[d] = s
+		}
+	}
+	if err := applyLinkDomains(iface, domains); err != nil {
+		return err
+	}
+	if len(domains) == 0 {
+		delete(linkDomains.ifaces, iface)
+	} else {
+		linkDomains.ifaces[iface] = domains
+	}
+	return nil
+}
+
+// applyLinkDomains configures the given domains as routing domains of the
+// interface. systemd-resolved keeps a single list of servers per interface,
+// so queries for any routing domain of the interface may be sent to any of
+// the servers configured on it.
+func applyLinkDomains(iface string, domains map[string][]netip.AddrPort) error {
+	if len(domains) == 0 {
+		return resolvectl("revert", iface)
+	}
+	names := make([]string, 0, len(domains))
+	for domain := range domains {
+		names = append(names, domain)
+	}
+	sort.Strings(names)
+	dnsArgs := []string{"dns", iface}
+	domainArgs := []string{"domain", iface}
+	seen := make(map[netip.AddrPort]struct{})
+	for _, domain := range names {
+		domainArgs = append(domainArgs, "~"+domain)
+		for _, server := range domains[domain] {
+			if _, ok := seen[server]; ok {
+				continue
+			}
+			seen[server] = struct{}{}
+			dnsArgs = append(dnsArgs, server.String())
+		}
+	}
+	if err := resolvectl(dnsArgs...); err != nil {
+		return err
+	}
+	if err := resolvectl(domainArgs...); err != nil {
+		return err
+	}
+	// Only send queries for the routing domains to the interface.
+	return resolvectl("default-route", iface, "false")
+}
+
+func resolvectl(args ...string) error {
+	out, err := exec.Command("resolvectl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("resolvectl %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
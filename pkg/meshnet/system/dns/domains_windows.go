@@ -0,0 +1,60 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"strings"
+)
+
+// Per-domain servers are configured as Name Resolution Policy Table rules.
+// NRPT rules always use port 53.
+
+func setDomainServers(iface string, domain string, servers []netip.AddrPort) error {
+	if err := removeDomainServers(iface, domain); err != nil {
+		return err
+	}
+	addrs := make([]string, len(servers))
+	for i, server := range servers {
+		addrs[i] = fmt.Sprintf("'%s'", server.Addr())
+	}
+	return powershell(fmt.Sprintf(
+		"Add-DnsClientNrptRule -Namespace '.%s','%s' -NameServers %s -Comment '%s'",
+		domain, domain, strings.Join(addrs, ","), nrptComment(iface),
+	))
+}
+
+func removeDomainServers(iface string, domain string) error {
+	return powershell(fmt.Sprintf(
+		"Get-DnsClientNrptRule | Where-Object { $_.Comment -eq '%s' -and $_.Namespace -contains '.%s' } | Remove-DnsClientNrptRule -Force",
+		nrptComment(iface), domain,
+	))
+}
+
+func nrptComment(iface string) string {
+	return "webmesh:" + iface
+}
+
+func powershell(command string) error {
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -28,12 +28,45 @@ type Firewall interface {
 	AddWireguardForwarding(ctx context.Context, ifaceName string) error
 	// AddMasquerade should configure the firewall to masquerade outbound traffic on the wireguard interface.
 	AddMasquerade(ctx context.Context, ifaceName string) error
+	// RemoveMasquerade should remove any masquerade rules previously added for the wireguard interface.
+	RemoveMasquerade(ctx context.Context, ifaceName string) error
 	// Clear should clear any changes made to the firewall.
 	Clear(ctx context.Context) error
 	// Close should close any resources used by the firewall. It should also perform a Clear.
 	Close(ctx context.Context) error
 }
 
+// RouteCounter is implemented by firewalls that can count the traffic forwarded
+// to destination prefixes. Only the nftables firewall implements it.
+type RouteCounter interface {
+	// AddRouteCounter starts counting traffic forwarded to the given prefix.
+	AddRouteCounter(ctx context.Context, prefix netip.Prefix) error
+	// RemoveRouteCounter stops counting traffic forwarded to the given prefix.
+	RemoveRouteCounter(ctx context.Context, prefix netip.Prefix) error
+	// RouteCounters returns the current counters of every counted prefix.
+	RouteCounters(ctx context.Context) (map[netip.Prefix]Counter, error)
+}
+
+// SourceRestricter is implemented by firewalls that can limit the traffic accepted
+// from a source prefix. Only the nftables firewall implements it.
+type SourceRestricter interface {
+	// RestrictSource only accepts TCP connections from the given prefix to the given
+	// local ports, along with replies to connections we opened, and drops anything
+	// else from it, including traffic that would be forwarded. Calling it again for
+	// the same prefix replaces the allowed ports.
+	RestrictSource(ctx context.Context, prefix netip.Prefix, ports []uint16) error
+	// UnrestrictSource removes any restriction previously added for the given prefix.
+	UnrestrictSource(ctx context.Context, prefix netip.Prefix) error
+}
+
+// Counter is the traffic matched by a firewall rule.
+type Counter struct {
+	// Bytes is the number of bytes matched.
+	Bytes uint64
+	// Packets is the number of packets matched.
+	Packets uint64
+}
+
 // Policy is a firewall policy.
 type Policy string
 
@@ -44,6 +77,11 @@ const (
 	PolicyDrop Policy = "drop"
 )
 
+// IsValid returns true if the policy is a known firewall policy.
+func (p Policy) IsValid() bool {
+	return p == PolicyAccept || p == PolicyDrop
+}
+
 // Options are options for configuring a firewall.
 type Options struct {
 	// ID is used to uniquely identify the firewall. It can be empty,
@@ -61,6 +99,16 @@ type Options struct {
 	StoragePort uint16
 	// GRPCPort is the port to allow for grpc traffic.
 	GRPCPort uint16
+	// TCPPorts are additional TCP ports to allow, such as those of enabled
+	// services.
+	TCPPorts []uint16
+	// UDPPorts are additional UDP ports to allow, such as those of enabled
+	// services.
+	UDPPorts []uint16
+	// MasqueradeExclusions are destination prefixes that masquerade rules
+	// should not apply to. Traffic to them is forwarded with the original
+	// source address.
+	MasqueradeExclusions []netip.Prefix
 }
 
 // New returns a new firewall manager for the given options.
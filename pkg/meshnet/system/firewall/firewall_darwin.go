@@ -19,7 +19,9 @@ package firewall
 import (
 	"context"
 	"fmt"
+	"net/netip"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/webmeshproj/webmesh/pkg/common"
@@ -44,6 +46,7 @@ func newFirewall(ctx context.Context, opts *Options) (Firewall, error) {
 			return &pfctlFirewall{
 				enabledAtStart: true,
 				anchorFile:     afile,
+				exclusions:     opts.MasqueradeExclusions,
 			}, nil
 		}
 		return nil, fmt.Errorf("enable pfctl: %w", err)
@@ -51,12 +54,14 @@ func newFirewall(ctx context.Context, opts *Options) (Firewall, error) {
 	return &pfctlFirewall{
 		enabledAtStart: false,
 		anchorFile:     afile,
+		exclusions:     opts.MasqueradeExclusions,
 	}, nil
 }
 
 type pfctlFirewall struct {
 	enabledAtStart bool
 	anchorFile     string
+	exclusions     []netip.Prefix
 }
 
 // AddWireguardForwarding should configure the firewall to allow forwarding traffic on the wireguard interface.
@@ -82,7 +87,30 @@ func (pf *pfctlFirewall) AddMasquerade(ctx context.Context, ifaceName string) er
 		return fmt.Errorf("open anchor file: %w", err)
 	}
 	defer f.Close()
-	_, err = f.WriteString(fmt.Sprintf("nat on %s from (%s:network) to any -> (%s:0)\n", ifaceName, ifaceName, ifaceName))
+	_, err = f.WriteString(strings.Join(masqueradeRules(ifaceName, pf.exclusions), "\n") + "\n")
+	if err != nil {
+		return fmt.Errorf("write anchor file: %w", err)
+	}
+	// Reload pfctl
+	err = common.Exec(ctx, "pfctl", "-f", anchorFile)
+	return err
+}
+
+// RemoveMasquerade should remove any masquerade rules previously added for the wireguard interface.
+func (pf *pfctlFirewall) RemoveMasquerade(ctx context.Context, ifaceName string) error {
+	data, err := os.ReadFile(pf.anchorFile)
+	if err != nil {
+		return fmt.Errorf("read anchor file: %w", err)
+	}
+	masqrules := masqueradeRules(ifaceName, pf.exclusions)
+	var rules []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || slices.Contains(masqrules, line) {
+			continue
+		}
+		rules = append(rules, line+"\n")
+	}
+	err = os.WriteFile(pf.anchorFile, []byte(strings.Join(rules, "")), 0644)
 	if err != nil {
 		return fmt.Errorf("write anchor file: %w", err)
 	}
@@ -120,3 +148,14 @@ func (pf *pfctlFirewall) Close(ctx context.Context) error {
 	// Reload the main pf.conf
 	return common.Exec(ctx, "pfctl", "-f", "/etc/pf.conf")
 }
+
+// masqueradeRules returns the translation rules for masquerading traffic on the given
+// interface. pf uses the first matching translation rule, so the "no nat" rules for
+// excluded destinations come first.
+func masqueradeRules(ifaceName string, exclusions []netip.Prefix) []string {
+	var rules []string
+	for _, prefix := range exclusions {
+		rules = append(rules, fmt.Sprintf("no nat on %s from (%s:network) to %s", ifaceName, ifaceName, prefix))
+	}
+	return append(rules, fmt.Sprintf("nat on %s from (%s:network) to any -> (%s:0)", ifaceName, ifaceName, ifaceName))
+}
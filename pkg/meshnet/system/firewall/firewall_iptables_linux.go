@@ -19,6 +19,7 @@ package firewall
 import (
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"os/exec"
 	"strings"
 
@@ -29,9 +30,10 @@ import (
 // is technically not safe for use with multiple interfaces. The Close method may restore
 // rules from another interface. But documentation should push people to use nftables instead.
 // This is just a fallback.
-func newIPTablesFirewall(ctx context.Context, _ *Options) (Firewall, error) {
+func newIPTablesFirewall(ctx context.Context, opts *Options) (Firewall, error) {
 	fw := &iptablesFirewall{
-		log: context.LoggerFrom(ctx).With(slog.String("component", "iptables-firewall")),
+		log:        context.LoggerFrom(ctx).With(slog.String("component", "iptables-firewall")),
+		exclusions: opts.MasqueradeExclusions,
 	}
 	var initialRules []string
 	rules, err := fw.execOutput(context.Background(), "-S")
@@ -46,6 +48,7 @@ func newIPTablesFirewall(ctx context.Context, _ *Options) (Firewall, error) {
 type iptablesFirewall struct {
 	log          *slog.Logger
 	initialRules []string
+	exclusions   []netip.Prefix
 }
 
 // AddWireguardForwarding should configure the firewall to allow forwarding traffic on the wireguard interface.
@@ -55,7 +58,38 @@ func (fw *iptablesFirewall) AddWireguardForwarding(ctx context.Context, ifaceNam
 
 // AddMasquerade should configure the firewall to masquerade outbound traffic on the wireguard interface.
 func (fw *iptablesFirewall) AddMasquerade(ctx context.Context, ifaceName string) error {
-	return fw.exec(ctx, "-t", "nat", "-A", "POSTROUTING", "-o", ifaceName, "-j", "MASQUERADE")
+	for _, rule := range masqueradeRules(ifaceName, fw.exclusions) {
+		err := fw.exec(ctx, append([]string{"-t", "nat", "-A"}, rule...)...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveMasquerade should remove any masquerade rules previously added for the wireguard interface.
+func (fw *iptablesFirewall) RemoveMasquerade(ctx context.Context, ifaceName string) error {
+	for _, rule := range masqueradeRules(ifaceName, fw.exclusions) {
+		err := fw.exec(ctx, append([]string{"-t", "nat", "-D"}, rule...)...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// masqueradeRules returns the POSTROUTING rules for masquerading traffic on the
+// given interface. Excluded destinations return early so they are never SNATed.
+// Only IPv4 exclusions apply, since masquerading is only configured with iptables.
+func masqueradeRules(ifaceName string, exclusions []netip.Prefix) [][]string {
+	var rules [][]string
+	for _, prefix := range exclusions {
+		if !prefix.Addr().Is4() {
+			continue
+		}
+		rules = append(rules, []string{"POSTROUTING", "-o", ifaceName, "-d", prefix.String(), "-j", "RETURN"})
+	}
+	return append(rules, []string{"POSTROUTING", "-o", ifaceName, "-j", "MASQUERADE"})
 }
 
 // Clear should clear any changes made to the firewall.
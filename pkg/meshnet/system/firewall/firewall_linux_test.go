@@ -0,0 +1,148 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewall
+
+import (
+	"bytes"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+func TestMasqueradeExclusions(t *testing.T) {
+	t.Parallel()
+	exclusions := []netip.Prefix{
+		netip.MustParsePrefix("10.20.0.0/16"),
+		netip.MustParsePrefix("fd00:20::/32"),
+	}
+	tc := []struct {
+		name       string
+		dst        netip.Addr
+		masquerade bool
+	}{
+		{name: "ExcludedIPv4", dst: netip.MustParseAddr("10.20.1.1"), masquerade: false},
+		{name: "OtherIPv4", dst: netip.MustParseAddr("10.21.1.1"), masquerade: true},
+		{name: "ExcludedIPv6", dst: netip.MustParseAddr("fd00:20::1"), masquerade: false},
+		{name: "OtherIPv6", dst: netip.MustParseAddr("fd00:21::1"), masquerade: true},
+	}
+
+	t.Run("IPTables", func(t *testing.T) {
+		t.Parallel()
+		for _, tt := range tc {
+			tt := tt
+			if !tt.dst.Is4() {
+				continue
+			}
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+				var target string
+				for _, rule := range masqueradeRules("wg0", exclusions) {
+					if i := slices.Index(rule, "-d"); i >= 0 && !netip.MustParsePrefix(rule[i+1]).Contains(tt.dst) {
+						continue
+					}
+					target = rule[len(rule)-1]
+					break
+				}
+				if got := target == "MASQUERADE"; got != tt.masquerade {
+					t.Fatalf("expected masquerade %v for %s, first matching target was %q", tt.masquerade, tt.dst, target)
+				}
+			})
+		}
+	})
+
+	t.Run("NFTables", func(t *testing.T) {
+		t.Parallel()
+		for _, tt := range tc {
+			tt := tt
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+				var excluded bool
+				for _, prefix := range exclusions {
+					if exclusionMatches(masqueradeExclusionExprs(prefix), tt.dst) {
+						excluded = true
+					}
+				}
+				if excluded == tt.masquerade {
+					t.Fatalf("expected masquerade %v for %s", tt.masquerade, tt.dst)
+				}
+			})
+		}
+	})
+}
+
+// exclusionMatches evaluates the address match of exclusion expressions
+// against a destination address.
+func exclusionMatches(exprs []expr.Any, dst netip.Addr) bool {
+	var payload *expr.Payload
+	var mask []byte
+	var cmps []*expr.Cmp
+	for _, e := range exprs {
+		switch v := e.(type) {
+		case *expr.Payload:
+			payload = v
+		case *expr.Bitwise:
+			mask = v.Mask
+		case *expr.Cmp:
+			cmps = append(cmps, v)
+		}
+	}
+	proto := byte(unix.NFPROTO_IPV4)
+	if dst.Is6() {
+		proto = unix.NFPROTO_IPV6
+	}
+	if len(cmps) != 2 || !bytes.Equal(cmps[0].Data, []byte{proto}) {
+		return false
+	}
+	addr := dst.AsSlice()
+	if payload == nil || int(payload.Len) != len(addr) {
+		return false
+	}
+	masked := make([]byte, len(addr))
+	for i := range addr {
+		masked[i] = addr[i] & mask[i]
+	}
+	return bytes.Equal(masked, cmps[1].Data)
+}
+
+func TestSourceExprs(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		prefix netip.Prefix
+		offset uint32
+	}{
+		{prefix: netip.MustParsePrefix("172.16.0.1/32"), offset: 12},
+		{prefix: netip.MustParsePrefix("2001:db8::1/128"), offset: 8},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.prefix.String(), func(t *testing.T) {
+			t.Parallel()
+			exprs := sourceExprs(tt.prefix)
+			for _, e := range exprs {
+				if payload, ok := e.(*expr.Payload); ok && payload.Offset != tt.offset {
+					t.Fatalf("expected source address offset %d, got %d", tt.offset, payload.Offset)
+				}
+			}
+			if !exclusionMatches(exprs, tt.prefix.Addr()) {
+				t.Fatalf("expected source expressions to match %s", tt.prefix.Addr())
+			}
+		})
+	}
+}
@@ -66,9 +66,11 @@ func (fw *firewall) initTables() error {
 		natTable = fmt.Sprintf("%s_%s", inetNatTable, opts.ID)
 		rawTable = fmt.Sprintf("%s_%s", inetRawTable, opts.ID)
 	}
-	tablesNames := []string{filterTable, natTable, rawTable}
+	fw.natTable = &nftables.Table{Name: natTable, Family: nftables.TableFamilyINet}
+	fw.filterTable = &nftables.Table{Name: filterTable, Family: nftables.TableFamilyINet}
+	fw.tables = []string{filterTable, natTable, rawTable}
 	fw.ti = nftableslib.InitNFTables(fw.conn).Tables()
-	for _, table := range tablesNames {
+	for _, table := range fw.tables {
 		_, err := fw.ti.Table(table, nftables.TableFamilyINet)
 		if err == nil {
 			// Table exists, flush it
@@ -326,6 +328,38 @@ func (fw *firewall) initInputChain() error {
 			},
 		})
 	}
+	for _, svc := range []struct {
+		comment string
+		proto   uint8
+		ports   []uint16
+	}{
+		{comment: "allow service tcp ports", proto: unix.IPPROTO_TCP, ports: fw.opts.TCPPorts},
+		{comment: "allow service udp ports", proto: unix.IPPROTO_UDP, ports: fw.opts.UDPPorts},
+	} {
+		if len(svc.ports) == 0 {
+			continue
+		}
+		ports := make([]int, len(svc.ports))
+		for i, port := range svc.ports {
+			ports[i] = int(port)
+		}
+		rules = append(rules, struct {
+			comment string
+			cmd     string
+			rule    *nftableslib.Rule
+		}{
+			comment: svc.comment,
+			rule: &nftableslib.Rule{
+				L4: &nftableslib.L4Rule{
+					L4Proto: svc.proto,
+					Dst: &nftableslib.Port{
+						List: nftableslib.SetPortList(ports),
+					},
+				},
+				Action: accept,
+			},
+		})
+	}
 	for _, rule := range rules {
 		rule.rule.UserData = nftableslib.MakeRuleComment(rule.comment)
 		_, err = fw.input.Rules().InsertImm(rule.rule)
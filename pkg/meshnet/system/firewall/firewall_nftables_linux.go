@@ -18,13 +18,19 @@ package firewall
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
+	"net"
+	"net/netip"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/google/nftables"
 	"github.com/google/nftables/expr"
 	"github.com/sbezverk/nftableslib"
+	"golang.org/x/sys/unix"
 )
 
 // firewall is a firewall manager that uses nftables.
@@ -46,11 +52,39 @@ type firewall struct {
 	forward nftableslib.RulesInterface
 	// raw chains
 	rawprerouting nftableslib.RulesInterface
+	// natTable is the nat table, used for rules that nftableslib cannot express
+	natTable *nftables.Table
+	// filterTable is the filter table, used for rules that nftableslib cannot express
+	filterTable *nftables.Table
+	// tables are the names of the tables owned by this firewall
+	tables []string
+	// masquerade rule handles by interface name
+	masqrules map[string][]uint64
+	// masquerade exclusion rule handles by interface name
+	masqexclusions map[string][]uint64
+	// route counter rule handles by destination prefix
+	routecounters map[netip.Prefix]uint64
+	// source restriction rules by source prefix
+	restrictions map[netip.Prefix]sourceRestriction
+	mu           sync.Mutex
+}
+
+// sourceRestriction are the rules restricting the traffic from a source prefix.
+type sourceRestriction struct {
+	ports   []uint16
+	input   []uint64
+	forward []uint64
 }
 
 // newFirewall returns a new nftables firewall manager.
 func newFirewall(ctx context.Context, opts *Options) (Firewall, error) {
-	fw := &firewall{opts: opts}
+	fw := &firewall{
+		opts:           opts,
+		masqrules:      make(map[string][]uint64),
+		masqexclusions: make(map[string][]uint64),
+		routecounters:  make(map[netip.Prefix]uint64),
+		restrictions:   make(map[netip.Prefix]sourceRestriction),
+	}
 	// Initialize a long lasting connection to the nftables library
 	var netns []int
 	if opts.NetNs != "" {
@@ -106,12 +140,14 @@ func (fw *firewall) AddMasquerade(ctx context.Context, ifaceName string) error {
 	if len(ifaceName) > 15 {
 		ifaceName = ifaceName[:15]
 	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
 	// Masquearade outbound traffic from the wireguard interface
 	masq, err := nftableslib.SetMasq(false, false, false)
 	if err != nil {
 		return fmt.Errorf("failed to create masquerade verdict: %w", err)
 	}
-	_, err = fw.postrouting.Rules().InsertImm(&nftableslib.Rule{
+	outbound, err := fw.postrouting.Rules().InsertImm(&nftableslib.Rule{
 		Meta: &nftableslib.Meta{
 			Expr: []nftableslib.MetaExpr{
 				{
@@ -126,8 +162,9 @@ func (fw *firewall) AddMasquerade(ctx context.Context, ifaceName string) error {
 	if err != nil {
 		return fmt.Errorf("failed to create outbound wireguard masquerade rule: %w", err)
 	}
+	fw.masqrules[ifaceName] = append(fw.masqrules[ifaceName], outbound)
 	// Masquearade inbound traffic from the wireguard interface
-	_, err = fw.postrouting.Rules().InsertImm(&nftableslib.Rule{
+	inbound, err := fw.postrouting.Rules().InsertImm(&nftableslib.Rule{
 		Meta: &nftableslib.Meta{
 			Expr: []nftableslib.MetaExpr{
 				{
@@ -142,12 +179,359 @@ func (fw *firewall) AddMasquerade(ctx context.Context, ifaceName string) error {
 	if err != nil {
 		return fmt.Errorf("failed to create inbound wireguard masquerade rule: %w", err)
 	}
+	fw.masqrules[ifaceName] = append(fw.masqrules[ifaceName], inbound)
+	if len(fw.opts.MasqueradeExclusions) > 0 {
+		// Inserted last so that they are evaluated before the masquerade rules.
+		err = fw.addMasqueradeExclusions(ifaceName)
+		if err != nil {
+			return fmt.Errorf("failed to create masquerade exclusion rules: %w", err)
+		}
+	}
+	return fw.conn.Flush()
+}
+
+// addMasqueradeExclusions inserts rules accepting traffic to the excluded destinations
+// before it reaches the masquerade rules. nftableslib cannot match addresses in inet
+// tables, so the rules are built directly and their handles looked up by comment.
+func (fw *firewall) addMasqueradeExclusions(ifaceName string) error {
+	chain := &nftables.Chain{Name: inetPostRoutingChain, Table: fw.natTable}
+	comments := make(map[string]struct{}, len(fw.opts.MasqueradeExclusions))
+	for _, prefix := range fw.opts.MasqueradeExclusions {
+		comment := nftableslib.MakeRuleComment(fmt.Sprintf("Exclude %s from masquerade on %s", prefix, ifaceName))
+		comments[string(comment)] = struct{}{}
+		fw.conn.InsertRule(&nftables.Rule{
+			Table:    fw.natTable,
+			Chain:    chain,
+			Exprs:    masqueradeExclusionExprs(prefix),
+			UserData: comment,
+		})
+	}
+	if err := fw.conn.Flush(); err != nil {
+		return err
+	}
+	rules, err := fw.conn.GetRules(fw.natTable, chain)
+	if err != nil {
+		return fmt.Errorf("failed to list postrouting rules: %w", err)
+	}
+	for _, rule := range rules {
+		if _, ok := comments[string(rule.UserData)]; ok {
+			fw.masqexclusions[ifaceName] = append(fw.masqexclusions[ifaceName], rule.Handle)
+		}
+	}
+	return nil
+}
+
+// masqueradeExclusionExprs returns the expressions for accepting traffic destined
+// to the given prefix in the inet postrouting chain.
+func masqueradeExclusionExprs(prefix netip.Prefix) []expr.Any {
+	return append(destinationExprs(prefix), &expr.Verdict{Kind: expr.VerdictAccept})
+}
+
+// destinationExprs returns the expressions for matching traffic destined to the
+// given prefix in an inet table.
+func destinationExprs(prefix netip.Prefix) []expr.Any {
+	if prefix.Addr().Is6() {
+		return addressExprs(prefix, 24)
+	}
+	return addressExprs(prefix, 16)
+}
+
+// sourceExprs returns the expressions for matching traffic originating from the
+// given prefix in an inet table.
+func sourceExprs(prefix netip.Prefix) []expr.Any {
+	if prefix.Addr().Is6() {
+		return addressExprs(prefix, 8)
+	}
+	return addressExprs(prefix, 12)
+}
+
+// addressExprs returns the expressions for matching the address at the given
+// offset of the network header against the given prefix.
+func addressExprs(prefix netip.Prefix, offset uint32) []expr.Any {
+	prefix = prefix.Masked()
+	proto := byte(unix.NFPROTO_IPV4)
+	if prefix.Addr().Is6() {
+		proto = byte(unix.NFPROTO_IPV6)
+	}
+	addr := prefix.Addr().AsSlice()
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       offset,
+			Len:          uint32(len(addr)),
+		},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            uint32(len(addr)),
+			Mask:           net.CIDRMask(prefix.Bits(), len(addr)*8),
+			Xor:            make([]byte, len(addr)),
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: addr},
+	}
+}
+
+// AddRouteCounter starts counting traffic forwarded to the given prefix. The
+// counting rule has no verdict and is inserted ahead of the forwarding rules.
+func (fw *firewall) AddRouteCounter(ctx context.Context, prefix netip.Prefix) error {
+	prefix = prefix.Masked()
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if _, ok := fw.routecounters[prefix]; ok {
+		return nil
+	}
+	chain := &nftables.Chain{Name: inetForwardChain, Table: fw.filterTable}
+	comment := nftableslib.MakeRuleComment(fmt.Sprintf("Count traffic forwarded to %s", prefix))
+	fw.conn.InsertRule(&nftables.Rule{
+		Table:    fw.filterTable,
+		Chain:    chain,
+		Exprs:    append(destinationExprs(prefix), &expr.Counter{}),
+		UserData: comment,
+	})
+	if err := fw.conn.Flush(); err != nil {
+		return fmt.Errorf("failed to create route counter rule: %w", err)
+	}
+	rules, err := fw.conn.GetRules(fw.filterTable, chain)
+	if err != nil {
+		return fmt.Errorf("failed to list forward rules: %w", err)
+	}
+	for _, rule := range rules {
+		if string(rule.UserData) == string(comment) {
+			fw.routecounters[prefix] = rule.Handle
+			return nil
+		}
+	}
+	return fmt.Errorf("route counter rule for %s not found after creation", prefix)
+}
+
+// RemoveRouteCounter stops counting traffic forwarded to the given prefix.
+func (fw *firewall) RemoveRouteCounter(ctx context.Context, prefix netip.Prefix) error {
+	prefix = prefix.Masked()
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	handle, ok := fw.routecounters[prefix]
+	if !ok {
+		return nil
+	}
+	chain := &nftables.Chain{Name: inetForwardChain, Table: fw.filterTable}
+	err := fw.conn.DelRule(&nftables.Rule{Table: fw.filterTable, Chain: chain, Handle: handle})
+	if err != nil {
+		return fmt.Errorf("failed to delete route counter rule: %w", err)
+	}
+	delete(fw.routecounters, prefix)
+	return fw.conn.Flush()
+}
+
+// RouteCounters returns the current counters of every counted prefix.
+func (fw *firewall) RouteCounters(ctx context.Context) (map[netip.Prefix]Counter, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	out := make(map[netip.Prefix]Counter, len(fw.routecounters))
+	if len(fw.routecounters) == 0 {
+		return out, nil
+	}
+	prefixes := make(map[uint64]netip.Prefix, len(fw.routecounters))
+	for prefix, handle := range fw.routecounters {
+		prefixes[handle] = prefix
+	}
+	rules, err := fw.conn.GetRules(fw.filterTable, &nftables.Chain{Name: inetForwardChain, Table: fw.filterTable})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list forward rules: %w", err)
+	}
+	for _, rule := range rules {
+		prefix, ok := prefixes[rule.Handle]
+		if !ok {
+			continue
+		}
+		for _, e := range rule.Exprs {
+			if counter, ok := e.(*expr.Counter); ok {
+				out[prefix] = Counter{Bytes: counter.Bytes, Packets: counter.Packets}
+			}
+		}
+	}
+	return out, nil
+}
+
+// RestrictSource only accepts TCP connections from the given prefix to the given
+// local ports, along with replies to connections we opened, and drops anything
+// else from it, including traffic that would be forwarded.
+func (fw *firewall) RestrictSource(ctx context.Context, prefix netip.Prefix, ports []uint16) error {
+	prefix = prefix.Masked()
+	ports = slices.Clone(ports)
+	slices.Sort(ports)
+	ports = slices.Compact(ports)
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if restriction, ok := fw.restrictions[prefix]; ok {
+		if slices.Equal(restriction.ports, ports) {
+			return nil
+		}
+		if err := fw.deleteRestriction(restriction); err != nil {
+			return fmt.Errorf("failed to delete source restriction rules: %w", err)
+		}
+		delete(fw.restrictions, prefix)
+	}
+	input := &nftables.Chain{Name: inetInputChain, Table: fw.filterTable}
+	forward := &nftables.Chain{Name: inetForwardChain, Table: fw.filterTable}
+	comment := nftableslib.MakeRuleComment(fmt.Sprintf("Restrict traffic from %s", prefix))
+	drop := &expr.Verdict{Kind: expr.VerdictDrop}
+	accept := &expr.Verdict{Kind: expr.VerdictAccept}
+	// Rules are inserted at the head of the chain, so the drop rule goes in
+	// first to be evaluated last.
+	fw.conn.InsertRule(&nftables.Rule{
+		Table:    fw.filterTable,
+		Chain:    input,
+		Exprs:    append(sourceExprs(prefix), drop),
+		UserData: comment,
+	})
+	for _, port := range ports {
+		exprs := append(sourceExprs(prefix), tcpPortExprs(port)...)
+		fw.conn.InsertRule(&nftables.Rule{
+			Table:    fw.filterTable,
+			Chain:    input,
+			Exprs:    append(exprs, accept),
+			UserData: comment,
+		})
+	}
+	exprs := append(sourceExprs(prefix), establishedExprs()...)
+	fw.conn.InsertRule(&nftables.Rule{
+		Table:    fw.filterTable,
+		Chain:    input,
+		Exprs:    append(exprs, accept),
+		UserData: comment,
+	})
+	fw.conn.InsertRule(&nftables.Rule{
+		Table:    fw.filterTable,
+		Chain:    forward,
+		Exprs:    append(sourceExprs(prefix), drop),
+		UserData: comment,
+	})
+	if err := fw.conn.Flush(); err != nil {
+		return fmt.Errorf("failed to create source restriction rules: %w", err)
+	}
+	restriction := sourceRestriction{ports: ports}
+	for _, chain := range []*nftables.Chain{input, forward} {
+		rules, err := fw.conn.GetRules(fw.filterTable, chain)
+		if err != nil {
+			return fmt.Errorf("failed to list %s rules: %w", chain.Name, err)
+		}
+		for _, rule := range rules {
+			if string(rule.UserData) != string(comment) {
+				continue
+			}
+			if chain == input {
+				restriction.input = append(restriction.input, rule.Handle)
+			} else {
+				restriction.forward = append(restriction.forward, rule.Handle)
+			}
+		}
+	}
+	fw.restrictions[prefix] = restriction
+	return nil
+}
+
+// UnrestrictSource removes any restriction previously added for the given prefix.
+func (fw *firewall) UnrestrictSource(ctx context.Context, prefix netip.Prefix) error {
+	prefix = prefix.Masked()
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	restriction, ok := fw.restrictions[prefix]
+	if !ok {
+		return nil
+	}
+	if err := fw.deleteRestriction(restriction); err != nil {
+		return fmt.Errorf("failed to delete source restriction rules: %w", err)
+	}
+	delete(fw.restrictions, prefix)
+	return nil
+}
+
+// deleteRestriction deletes the rules of a source restriction. Must be called
+// with the lock held.
+func (fw *firewall) deleteRestriction(restriction sourceRestriction) error {
+	for chainName, handles := range map[string][]uint64{
+		inetInputChain:   restriction.input,
+		inetForwardChain: restriction.forward,
+	} {
+		chain := &nftables.Chain{Name: chainName, Table: fw.filterTable}
+		for _, handle := range handles {
+			err := fw.conn.DelRule(&nftables.Rule{Table: fw.filterTable, Chain: chain, Handle: handle})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return fw.conn.Flush()
+}
+
+// tcpPortExprs returns the expressions for matching TCP traffic to the given port.
+func tcpPortExprs(port uint16) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.IPPROTO_TCP}},
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       2,
+			Len:          2,
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binary.BigEndian.AppendUint16(nil, port)},
+	}
+}
+
+// establishedExprs returns the expressions for matching traffic belonging to an
+// established or related connection.
+func establishedExprs() []expr.Any {
+	return []expr.Any{
+		&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           binary.NativeEndian.AppendUint32(nil, expr.CtStateBitESTABLISHED|expr.CtStateBitRELATED),
+			Xor:            make([]byte, 4),
+		},
+		&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: make([]byte, 4)},
+	}
+}
+
+// RemoveMasquerade should remove any masquerade rules previously added for the wireguard interface.
+func (fw *firewall) RemoveMasquerade(ctx context.Context, ifaceName string) error {
+	if len(ifaceName) > 15 {
+		ifaceName = ifaceName[:15]
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	for _, handle := range fw.masqrules[ifaceName] {
+		err := fw.postrouting.Rules().DeleteImm(handle)
+		if err != nil {
+			return fmt.Errorf("failed to delete wireguard masquerade rule: %w", err)
+		}
+	}
+	delete(fw.masqrules, ifaceName)
+	chain := &nftables.Chain{Name: inetPostRoutingChain, Table: fw.natTable}
+	for _, handle := range fw.masqexclusions[ifaceName] {
+		err := fw.conn.DelRule(&nftables.Rule{Table: fw.natTable, Chain: chain, Handle: handle})
+		if err != nil {
+			return fmt.Errorf("failed to delete masquerade exclusion rule: %w", err)
+		}
+	}
+	delete(fw.masqexclusions, ifaceName)
 	return fw.conn.Flush()
 }
 
 // Clear should clear any changes made to the firewall.
 func (fw *firewall) Clear(ctx context.Context) error {
-	for _, table := range []string{inetNatTable, inetFilterTable, inetRawTable} {
+	fw.mu.Lock()
+	fw.masqrules = make(map[string][]uint64)
+	fw.masqexclusions = make(map[string][]uint64)
+	fw.routecounters = make(map[netip.Prefix]uint64)
+	fw.restrictions = make(map[netip.Prefix]sourceRestriction)
+	fw.mu.Unlock()
+	for _, table := range fw.tables {
 		err := fw.ti.DeleteImm(table, nftables.TableFamilyINet)
 		if err != nil {
 			return fmt.Errorf("failed to delete inet %s table: %w", table, err)
@@ -83,6 +83,11 @@ func (wf *winFirewall) AddMasquerade(ctx context.Context, ifaceName string) erro
 	return nil
 }
 
+// RemoveMasquerade should remove any masquerade rules previously added for the wireguard interface.
+func (wf *winFirewall) RemoveMasquerade(ctx context.Context, ifaceName string) error {
+	return common.Exec(ctx, "netsh", "advfirewall", "firewall", "delete", "rule", `name="webmesh-forward-outbound"`)
+}
+
 // Clear should clear any changes made to the firewall.
 func (wf *winFirewall) Clear(ctx context.Context) error {
 	for _, name := range []string{"webmesh-forward-inbound", "webmesh-forward-outbound"} {
@@ -58,10 +58,14 @@ type Interface interface {
 	AddRoute(context.Context, netip.Prefix) error
 	// RemoveRoute removes the route for the given network.
 	RemoveRoute(context.Context, netip.Prefix) error
+	// Routes returns the destinations of the routes currently on the interface.
+	Routes(context.Context) ([]netip.Prefix, error)
 	// Link returns the underlying net.Interface.
 	Link() (*net.Interface, error)
 	// HardwareAddr returns the hardware address of the interface.
 	HardwareAddr() (net.HardwareAddr, error)
+	// SetMTU sets the MTU of the interface.
+	SetMTU(context.Context, int) error
 }
 
 // Options represents the options for creating a new interface.
@@ -77,6 +81,9 @@ type Options struct {
 	AddressV6 netip.Prefix
 	// ForceTUN forces the use of a TUN interface.
 	ForceTUN bool
+	// UserspaceBackend is the userspace WireGuard implementation to use
+	// for TUN interfaces. Defaults to link.DefaultUserspaceBackend.
+	UserspaceBackend string
 	// MTU is the MTU of the interface. If unset, it will be automatically
 	// detected from the host.
 	MTU uint32
@@ -110,11 +117,15 @@ func New(ctx context.Context, opts *Options) (Interface, error) {
 		addrv6: opts.AddressV6,
 		netns:  opts.NetNs,
 	}
+	newTUN, err := link.LookupUserspaceBackend(opts.UserspaceBackend)
+	if err != nil {
+		return nil, err
+	}
 	forceTUN := opts.ForceTUN || (runtime.GOOS != "linux" && runtime.GOOS != "freebsd")
 	mtu := opts.MTU
 	if forceTUN {
-		log.Debug("Creating wireguard tun interface")
-		name, closer, err := link.NewTUN(ctx, iface.ifname, mtu)
+		log.Debug("Creating wireguard tun interface", "backend", opts.UserspaceBackend)
+		name, closer, err := newTUN(ctx, iface.ifname, mtu)
 		if err != nil {
 			return nil, fmt.Errorf("new tun: %w", err)
 		}
@@ -129,7 +140,7 @@ func New(ctx context.Context, opts *Options) (Interface, error) {
 		if err != nil {
 			log.Error("Failed to create kernel interface failed, falling back to TUN driver", "error", err)
 			// Try the TUN device as a fallback
-			name, closer, err := link.NewTUN(ctx, iface.ifname, mtu)
+			name, closer, err := newTUN(ctx, iface.ifname, mtu)
 			if err != nil {
 				return nil, fmt.Errorf("new tun: %w", err)
 			}
@@ -231,6 +242,16 @@ func (l *sysInterface) Down(ctx context.Context) error {
 	return link.DeactivateInterface(ctx, l.Name())
 }
 
+// SetMTU sets the MTU of the interface.
+func (l *sysInterface) SetMTU(ctx context.Context, mtu int) error {
+	if runtime.GOOS == "linux" && l.netns != "" {
+		return DoInNetNS(l.netns, func() error {
+			return link.SetInterfaceMTU(ctx, l.Name(), mtu)
+		})
+	}
+	return link.SetInterfaceMTU(ctx, l.Name(), mtu)
+}
+
 // Destroy destroys the interface
 func (l *sysInterface) Destroy(ctx context.Context) error {
 	if runtime.GOOS == "linux" && l.netns != "" {
@@ -281,6 +302,20 @@ func (l *sysInterface) RemoveRoute(ctx context.Context, network netip.Prefix) er
 	return routes.Remove(ctx, l.Name(), network)
 }
 
+// Routes returns the destinations of the routes currently on the interface.
+func (l *sysInterface) Routes(ctx context.Context) ([]netip.Prefix, error) {
+	if runtime.GOOS == "linux" && l.netns != "" {
+		var out []netip.Prefix
+		err := DoInNetNS(l.netns, func() error {
+			var err error
+			out, err = routes.List(ctx, l.Name())
+			return err
+		})
+		return out, err
+	}
+	return routes.List(ctx, l.Name())
+}
+
 // Link attempts to return the underling net.Interface.
 func (l *sysInterface) Link() (*net.Interface, error) {
 	if runtime.GOOS == "linux" && l.netns != "" {
@@ -19,6 +19,7 @@ package link
 import (
 	"context"
 	"net/netip"
+	"strconv"
 	"strings"
 
 	"github.com/webmeshproj/webmesh/pkg/common"
@@ -60,6 +61,18 @@ func RemoveInterface(ctx context.Context, ifaceName string) error {
 	return nil
 }
 
+// SetInterfaceMTU sets the MTU of the interface with the given name.
+func SetInterfaceMTU(ctx context.Context, name string, mtu int) error {
+	out, err := common.ExecOutput(ctx, "ifconfig", name, "mtu", strconv.Itoa(mtu))
+	if err != nil {
+		if strings.Contains(string(out), "not exist") {
+			return ErrLinkNotExists
+		}
+		return err
+	}
+	return nil
+}
+
 // InterfaceNetwork returns the network for the given interface and address.
 func InterfaceNetwork(ifaceName string, forAddr netip.Addr, ipv6 bool) (netip.Prefix, error) {
 	// We just return back the final address in the zone with a /32 or /128 mask.
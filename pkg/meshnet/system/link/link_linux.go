@@ -76,6 +76,25 @@ func RemoveInterface(ctx context.Context, name string) error {
 	return nil
 }
 
+// SetInterfaceMTU sets the MTU of the interface with the given name.
+func SetInterfaceMTU(ctx context.Context, name string, mtu int) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		if isNoSuchInterfaceErr(err) {
+			return ErrLinkNotExists
+		}
+		return fmt.Errorf("get interface: %w", err)
+	}
+	if link.Attrs().MTU == mtu {
+		return nil
+	}
+	context.LoggerFrom(ctx).Debug("Set interface MTU", slog.String("interface", name), slog.Int("mtu", mtu))
+	if err := netlink.LinkSetMTU(link, mtu); err != nil {
+		return fmt.Errorf("set interface mtu: %w", err)
+	}
+	return nil
+}
+
 // InterfaceNetwork returns the network for the given interface and address.
 func InterfaceNetwork(ifaceName string, forAddr netip.Addr, ipv6 bool) (netip.Prefix, error) {
 	family := netlink.FAMILY_V4
@@ -37,6 +37,11 @@ func RemoveInterface(ctx context.Context, ifaceName string) error {
 	return errors.New("not implemented")
 }
 
+// SetInterfaceMTU sets the MTU of the interface with the given name.
+func SetInterfaceMTU(ctx context.Context, name string, mtu int) error {
+	return errors.New("not implemented")
+}
+
 // InterfaceNetwork returns the network for the given interface and address.
 func InterfaceNetwork(ifaceName string, forAddr netip.Addr, ipv6 bool) (netip.Prefix, error) {
 	return netip.Prefix{}, errors.New("not implemented")
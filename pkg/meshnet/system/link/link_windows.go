@@ -45,6 +45,11 @@ func RemoveInterface(ctx context.Context, ifaceName string) error {
 	return nil
 }
 
+// SetInterfaceMTU sets the MTU of the interface with the given name.
+func SetInterfaceMTU(ctx context.Context, name string, mtu int) error {
+	return nil
+}
+
 // InterfaceNetwork returns the network for the given interface and address.
 func InterfaceNetwork(ifaceName string, forAddr netip.Addr, ipv6 bool) (netip.Prefix, error) {
 	out, err := common.ExecOutput(context.Background(),
@@ -0,0 +1,82 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package link
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// DefaultUserspaceBackend is the userspace WireGuard implementation used for
+// TUN interfaces when none is requested.
+const DefaultUserspaceBackend = "wireguard-go"
+
+// ErrUnsupportedUserspaceBackend is returned when the requested userspace
+// WireGuard implementation is not compiled in.
+var ErrUnsupportedUserspaceBackend = errors.New("userspace wireguard backend not available")
+
+// TUNFunc creates a TUN interface driven by a userspace WireGuard implementation.
+// It returns the real name of the interface and a function to tear it down.
+type TUNFunc func(ctx context.Context, name string, mtu uint32) (realName string, closer func(), err error)
+
+var (
+	userspaceBackends = map[string]TUNFunc{
+		DefaultUserspaceBackend: NewTUN,
+	}
+	userspaceBackendsMu sync.RWMutex
+)
+
+// RegisterUserspaceBackend makes a userspace WireGuard implementation available
+// under the given name. It is intended to be called from the init functions of
+// files built for platforms where the implementation is available.
+func RegisterUserspaceBackend(name string, fn TUNFunc) {
+	userspaceBackendsMu.Lock()
+	defer userspaceBackendsMu.Unlock()
+	userspaceBackends[name] = fn
+}
+
+// UserspaceBackends returns the sorted names of the available userspace
+// WireGuard implementations.
+func UserspaceBackends() []string {
+	userspaceBackendsMu.RLock()
+	defer userspaceBackendsMu.RUnlock()
+	names := make([]string, 0, len(userspaceBackends))
+	for name := range userspaceBackends {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// LookupUserspaceBackend returns the TUN constructor for the named userspace
+// WireGuard implementation. An empty name selects the DefaultUserspaceBackend.
+func LookupUserspaceBackend(name string) (TUNFunc, error) {
+	if name == "" {
+		name = DefaultUserspaceBackend
+	}
+	userspaceBackendsMu.RLock()
+	defer userspaceBackendsMu.RUnlock()
+	fn, ok := userspaceBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedUserspaceBackend, name)
+	}
+	return fn, nil
+}
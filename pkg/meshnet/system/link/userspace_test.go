@@ -0,0 +1,87 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package link
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+func TestLookupUserspaceBackend(t *testing.T) {
+	t.Parallel()
+	RegisterUserspaceBackend("test-backend", func(context.Context, string, uint32) (string, func(), error) {
+		return "test0", func() {}, nil
+	})
+	tc := []struct {
+		name    string
+		backend string
+		wantErr bool
+	}{
+		{name: "Default", backend: "", wantErr: false},
+		{name: "WireGuardGo", backend: DefaultUserspaceBackend, wantErr: false},
+		{name: "Registered", backend: "test-backend", wantErr: false},
+		{name: "NotCompiledIn", backend: "boringtun", wantErr: true},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fn, err := LookupUserspaceBackend(tt.backend)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedUserspaceBackend) {
+					t.Fatalf("expected ErrUnsupportedUserspaceBackend, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lookup backend: %v", err)
+			}
+			if fn == nil {
+				t.Fatal("expected a TUN constructor")
+			}
+		})
+	}
+
+	t.Run("Selected", func(t *testing.T) {
+		t.Parallel()
+		fn, err := LookupUserspaceBackend("test-backend")
+		if err != nil {
+			t.Fatalf("lookup backend: %v", err)
+		}
+		name, _, err := fn(context.Background(), "wg0", 1420)
+		if err != nil {
+			t.Fatalf("create tun: %v", err)
+		}
+		if name != "test0" {
+			t.Fatalf("expected the registered backend to be used, got interface %q", name)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		t.Parallel()
+		backends := UserspaceBackends()
+		if !slices.Contains(backends, DefaultUserspaceBackend) {
+			t.Fatalf("expected %s in available backends, got %v", DefaultUserspaceBackend, backends)
+		}
+		if !slices.IsSorted(backends) {
+			t.Fatalf("expected sorted backends, got %v", backends)
+		}
+	})
+}
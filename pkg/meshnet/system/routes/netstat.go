@@ -0,0 +1,103 @@
+//go:build darwin || freebsd
+
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/webmeshproj/webmesh/pkg/common"
+)
+
+// List returns the destinations of the routes on the interface with the given name.
+func List(ctx context.Context, ifaceName string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, family := range []string{"inet", "inet6"} {
+		data, err := common.ExecOutput(ctx, "netstat", "-rn", "-f", family)
+		if err != nil {
+			return nil, fmt.Errorf("list %s routes: %w", family, err)
+		}
+		out = append(out, parseNetstatRoutes(string(data), ifaceName, family == "inet6")...)
+	}
+	return out, nil
+}
+
+// parseNetstatRoutes returns the destinations of the routes in the output of
+// netstat -rn that go out the given interface.
+func parseNetstatRoutes(data, ifaceName string, ipv6 bool) []netip.Prefix {
+	var out []netip.Prefix
+	netifCol := -1
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "Destination" {
+			netifCol = slices.Index(fields, "Netif")
+			continue
+		}
+		if netifCol < 0 || len(fields) <= netifCol || fields[netifCol] != ifaceName {
+			continue
+		}
+		if prefix, ok := parseNetstatDestination(fields[0], ipv6); ok {
+			out = append(out, prefix)
+		}
+	}
+	return out
+}
+
+// parseNetstatDestination parses a destination as printed by netstat. IPv4 networks
+// may be abbreviated (e.g. 172.16/12) and IPv6 link-local addresses carry a zone.
+func parseNetstatDestination(dst string, ipv6 bool) (netip.Prefix, bool) {
+	if dst == "default" {
+		if ipv6 {
+			return netip.PrefixFrom(netip.IPv6Unspecified(), 0), true
+		}
+		return netip.PrefixFrom(netip.IPv4Unspecified(), 0), true
+	}
+	addr, bits, hasBits := strings.Cut(dst, "/")
+	if i := strings.Index(addr, "%"); i >= 0 {
+		addr = addr[:i]
+	}
+	if !ipv6 {
+		octets := strings.Count(addr, ".") + 1
+		for i := octets; i < 4; i++ {
+			addr += ".0"
+		}
+		if !hasBits && octets < 4 {
+			bits, hasBits = strconv.Itoa(octets*8), true
+		}
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	if !hasBits {
+		return netip.PrefixFrom(ip, ip.BitLen()), true
+	}
+	ones, err := strconv.Atoi(bits)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(ip, ones), true
+}
@@ -137,6 +137,37 @@ func Remove(ctx context.Context, ifaceName string, addr netip.Prefix) error {
 	return nil
 }
 
+// List returns the destinations of the routes on the interface with the given name.
+func List(ctx context.Context, ifaceName string) ([]netip.Prefix, error) {
+	link, err := netlink.LinkByName(ifaceName)
+	if err != nil {
+		return nil, fmt.Errorf("get link by name: %w", err)
+	}
+	rts, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("list interface routes: %w", err)
+	}
+	out := make([]netip.Prefix, 0, len(rts))
+	for _, rt := range rts {
+		if rt.Dst == nil {
+			// A nil destination is the default route for the family.
+			if rt.Family == netlink.FAMILY_V6 {
+				out = append(out, netip.PrefixFrom(netip.IPv6Unspecified(), 0))
+			} else {
+				out = append(out, netip.PrefixFrom(netip.IPv4Unspecified(), 0))
+			}
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(rt.Dst.IP)
+		if !ok {
+			continue
+		}
+		ones, _ := rt.Dst.Mask.Size()
+		out = append(out, netip.PrefixFrom(addr.Unmap(), ones))
+	}
+	return out, nil
+}
+
 func decodeKernelHexIP(hexIP string) (netip.Addr, error) {
 	ip, err := hex.DecodeString(hexIP)
 	if err != nil {
@@ -41,3 +41,8 @@ func Add(ctx context.Context, ifaceName string, addr netip.Prefix) error {
 func Remove(ctx context.Context, ifaceName string, addr netip.Prefix) error {
 	return errors.New("not implemented")
 }
+
+// List returns the destinations of the routes on the interface with the given name.
+func List(ctx context.Context, ifaceName string) ([]netip.Prefix, error) {
+	return nil, errors.New("not implemented")
+}
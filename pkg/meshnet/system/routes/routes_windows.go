@@ -84,6 +84,29 @@ func Remove(ctx context.Context, name string, addr netip.Prefix) error {
 	return nil
 }
 
+// List returns the destinations of the routes on the interface with the given name.
+func List(ctx context.Context, name string) ([]netip.Prefix, error) {
+	link, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("net link by name: %w", err)
+	}
+	luid, err := winipcfg.LUIDFromIndex(uint32(link.Index))
+	if err != nil {
+		return nil, fmt.Errorf("winipcfg luid from index: %w", err)
+	}
+	rows, err := winipcfg.GetIPForwardTable2(windows.AF_UNSPEC)
+	if err != nil {
+		return nil, fmt.Errorf("winipcfg get forward table: %w", err)
+	}
+	var out []netip.Prefix
+	for _, row := range rows {
+		if row.InterfaceLUID == luid {
+			out = append(out, row.DestinationPrefix.Prefix())
+		}
+	}
+	return out, nil
+}
+
 func getNextHopForLink(luid winipcfg.LUID, route netip.Prefix) (netip.Addr, error) {
 	var family winipcfg.AddressFamily
 	if route.Addr().Is4() {
@@ -31,6 +31,11 @@ func (fw *Firewall) AddMasquerade(ctx context.Context, ifaceName string) error {
 	return nil
 }
 
+// RemoveMasquerade should remove any masquerade rules previously added for the wireguard interface.
+func (fw *Firewall) RemoveMasquerade(ctx context.Context, ifaceName string) error {
+	return nil
+}
+
 // Clear should clear any changes made to the firewall.
 func (fw *Firewall) Clear(ctx context.Context) error {
 	return nil
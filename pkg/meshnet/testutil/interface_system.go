@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"net"
 	"net/netip"
+	"slices"
 	"sync"
 
 	"github.com/webmeshproj/webmesh/pkg/meshnet/system"
@@ -38,6 +39,7 @@ type SystemInterface struct {
 	closed  bool
 	addrs   []netip.Prefix
 	routes  []netip.Prefix
+	mtu     int
 	mu      sync.Mutex
 }
 
@@ -51,6 +53,7 @@ func NewSystemInterface(ctx context.Context, opts *system.Options) (system.Inter
 	return &SystemInterface{
 		Options: opts,
 		hwaddr:  hwaddr,
+		mtu:     system.DefaultMTU,
 	}, nil
 }
 
@@ -174,11 +177,34 @@ func (t *SystemInterface) RemoveRoute(_ context.Context, route netip.Prefix) err
 	return nil
 }
 
+// Routes returns the routes added to the interface.
+func (t *SystemInterface) Routes(_ context.Context) ([]netip.Prefix, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, errors.New("interface closed")
+	}
+	return slices.Clone(t.routes), nil
+}
+
+// SetMTU sets the MTU of the interface.
+func (t *SystemInterface) SetMTU(_ context.Context, mtu int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return errors.New("interface closed")
+	}
+	t.mtu = mtu
+	return nil
+}
+
 // Link returns the underlying net.Interface.
 func (t *SystemInterface) Link() (*net.Interface, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return &net.Interface{
 		Index:        1,
-		MTU:          system.DefaultMTU,
+		MTU:          t.mtu,
 		Name:         t.Options.Name,
 		HardwareAddr: t.hwaddr,
 	}, nil
@@ -18,9 +18,14 @@ package testutil
 
 import (
 	"context"
+	"errors"
 	"net"
 	"net/netip"
+	"sort"
 	"sync"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
 
 	"github.com/webmeshproj/webmesh/pkg/meshnet"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/system/firewall"
@@ -124,12 +129,38 @@ func (c *Manager) StartMasquerade(ctx context.Context) error {
 	return nil
 }
 
+// StopMasquerade removes the masquerade rule if masquerading is enabled.
+func (c *Manager) StopMasquerade(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.masq = false
+	return nil
+}
+
+// IsMasquerading returns true if masquerading is currently enabled.
+func (c *Manager) IsMasquerading() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.masq
+}
+
+// AsymmetricPeers returns the IDs of peers that were found to not route our
+// mesh addresses back to us during the last peer refresh.
+func (c *Manager) AsymmetricPeers() []types.NodeID {
+	return nil
+}
+
 // DNS returns the DNS server manager. The DNS server manager is only
 // available after Start has been called.
 func (c *Manager) DNS() meshnet.DNSManager {
 	return c.dns
 }
 
+// DNSServerStatus returns the health of the configured mesh DNS servers.
+func (c *Manager) DNSServerStatus() []meshnet.DNSServerStatus {
+	return nil
+}
+
 // Peers return the peer manager.
 func (c *Manager) Peers() meshnet.PeerManager {
 	return c.peers
@@ -147,6 +178,108 @@ func (c *Manager) WireGuard() wireguard.Interface {
 	return c.wg
 }
 
+// Routes returns the routes currently installed on the wireguard interface.
+func (c *Manager) Routes(ctx context.Context) ([]netip.Prefix, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.wg == nil {
+		return nil, errors.New("routes called before wireguard interface is ready")
+	}
+	return c.wg.Routes(ctx)
+}
+
+// RouteTraffic returns the traffic forwarded to each destination prefix of
+// the routes advertised by this node.
+func (c *Manager) RouteTraffic(ctx context.Context) ([]meshnet.RouteTraffic, error) {
+	return nil, meshnet.ErrRouteAccountingUnsupported
+}
+
+// MapListenPort is not supported by the test manager.
+func (c *Manager) MapListenPort(ctx context.Context, onChange func(context.Context, netip.AddrPort)) (netip.AddrPort, error) {
+	return netip.AddrPort{}, meshnet.ErrPortMappingUnsupported
+}
+
+// Reprovision removes all peers from the in-memory interface and adds them
+// back from the store.
+func (c *Manager) Reprovision(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.wg == nil {
+		return errors.New("reprovision called before wireguard interface is ready")
+	}
+	wgpeers, err := meshnet.WireGuardPeersFor(ctx, c.db, c.nodeID)
+	if err != nil {
+		return err
+	}
+	for id := range c.wg.Peers() {
+		if err := c.wg.DeletePeer(ctx, id); err != nil {
+			return err
+		}
+	}
+	return c.peers.Refresh(ctx, wgpeers)
+}
+
+// ReplacePeer replaces oldPeer on the in-memory interface with newPeer.
+func (c *Manager) ReplacePeer(ctx context.Context, oldPeer, newPeer *v1.WireGuardPeer, iceServers []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.wg == nil {
+		return errors.New("replace peer called before wireguard interface is ready")
+	}
+	if oldPeer.GetNode().GetId() != newPeer.GetNode().GetId() {
+		if err := c.wg.DeletePeer(ctx, oldPeer.GetNode().GetId()); err != nil {
+			return err
+		}
+	}
+	return c.peers.Add(ctx, newPeer, iceServers)
+}
+
+// firewallPolicy returns the configured default firewall policy.
+func (c *Manager) firewallPolicy() firewall.Policy {
+	if c.opts.FirewallDefaultPolicy == "" {
+		return firewall.PolicyAccept
+	}
+	return c.opts.FirewallDefaultPolicy
+}
+
+// Diagnostics returns a report of the in-memory interface, peers, and routes.
+func (c *Manager) Diagnostics(ctx context.Context) (meshnet.Report, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.wg == nil {
+		return meshnet.Report{}, errors.New("diagnostics called before wireguard interface is ready")
+	}
+	report := meshnet.Report{
+		NodeID:      c.nodeID,
+		GeneratedAt: time.Now().UTC(),
+		Interface: meshnet.InterfaceReport{
+			Name:      c.wg.Name(),
+			AddressV4: c.wg.AddressV4(),
+			AddressV6: c.wg.AddressV6(),
+			NetworkV4: c.netv4,
+			NetworkV6: c.netv6,
+		},
+		Firewall: meshnet.FirewallReport{
+			Enabled:       true,
+			DefaultPolicy: c.firewallPolicy(),
+			Masquerading:  c.masq,
+		},
+	}
+	report.Interface.ListenPort, _ = c.wg.ListenPort()
+	for _, peer := range c.wg.Peers() {
+		report.Peers = append(report.Peers, meshnet.PeerReport{
+			ID:         peer.ID,
+			Endpoint:   peer.Endpoint,
+			AllowedIPs: peer.AllowedIPs,
+		})
+	}
+	sort.Slice(report.Peers, func(i, j int) bool {
+		return report.Peers[i].ID < report.Peers[j].ID
+	})
+	report.Routes, _ = c.wg.Routes(ctx)
+	return report, nil
+}
+
 func (c *Manager) Dial(ctx context.Context, network, address string) (net.Conn, error) {
 	return (&net.Dialer{}).DialContext(ctx, network, address)
 }
@@ -86,6 +86,17 @@ func (p *PeerManager) Resolver() meshnet.PeerResolver {
 	return &PeerResolver{}
 }
 
+// Sessions returns the active relay sessions to peers. The mock peer
+// manager never relays traffic, so there are none.
+func (p *PeerManager) Sessions() []meshnet.Session {
+	return nil
+}
+
+// KillSession closes the relay session to the given peer.
+func (p *PeerManager) KillSession(ctx context.Context, peerID types.NodeID) error {
+	return meshnet.ErrSessionNotFound
+}
+
 // PeerResolver is a mock peer resolver for wireguard.
 type PeerResolver struct{}
 
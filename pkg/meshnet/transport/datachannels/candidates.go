@@ -0,0 +1,106 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datachannels
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// CandidatePolicy is an allow-list of ICE candidate types that may be
+// signaled to the remote side of a peer connection. An empty policy
+// allows every candidate type.
+type CandidatePolicy []webrtc.ICECandidateType
+
+// ParseCandidatePolicy parses a candidate policy from a list of candidate
+// type names, e.g. "host", "srflx", "prflx", or "relay".
+func ParseCandidatePolicy(types []string) (CandidatePolicy, error) {
+	var policy CandidatePolicy
+	for _, t := range types {
+		typ, err := webrtc.NewICECandidateType(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid candidate type %q: %w", t, err)
+		}
+		if !slices.Contains(policy, typ) {
+			policy = append(policy, typ)
+		}
+	}
+	return policy, nil
+}
+
+// Allows returns true if the given candidate type is permitted by the policy.
+func (p CandidatePolicy) Allows(typ webrtc.ICECandidateType) bool {
+	return len(p) == 0 || slices.Contains(p, typ)
+}
+
+// RelayOnly returns true if the policy only permits relay candidates.
+func (p CandidatePolicy) RelayOnly() bool {
+	return len(p) > 0 && !slices.ContainsFunc(p, func(typ webrtc.ICECandidateType) bool {
+		return typ != webrtc.ICECandidateTypeRelay
+	})
+}
+
+type candidatePolicyKey struct{}
+
+// WithCandidatePolicy returns a context that applies the given candidate policy
+// to peer connections created with it.
+func WithCandidatePolicy(ctx context.Context, policy CandidatePolicy) context.Context {
+	return context.WithValue(ctx, candidatePolicyKey{}, policy)
+}
+
+// CandidatePolicyFrom returns the candidate policy from the given context.
+// If none is set, a policy allowing all candidate types is returned.
+func CandidatePolicyFrom(ctx context.Context) CandidatePolicy {
+	policy, _ := ctx.Value(candidatePolicyKey{}).(CandidatePolicy)
+	return policy
+}
+
+// newPeerConnection creates a new peer connection with detached data channels and
+// the candidate policy from the context applied. Relay-only policies restrict
+// gathering itself, otherwise forbidden candidates are filtered by onCandidate.
+func newPeerConnection(ctx context.Context, iceServers []webrtc.ICEServer) (*webrtc.PeerConnection, error) {
+	s := webrtc.SettingEngine{}
+	s.DetachDataChannels()
+	policy := CandidatePolicyFrom(ctx)
+	s.SetIncludeLoopbackCandidate(policy.Allows(webrtc.ICECandidateTypeHost))
+	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
+	cfg := webrtc.Configuration{
+		ICEServers: iceServers,
+	}
+	if policy.RelayOnly() {
+		cfg.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+	return api.NewPeerConnection(cfg)
+}
+
+// onCandidate wraps an ICE candidate handler so that it is only invoked for
+// candidates permitted by the policy in the given context.
+func onCandidate(ctx context.Context, fn func(*webrtc.ICECandidate)) func(*webrtc.ICECandidate) {
+	policy := CandidatePolicyFrom(ctx)
+	log := context.LoggerFrom(ctx)
+	return func(cand *webrtc.ICECandidate) {
+		if cand != nil && !policy.Allows(cand.Typ) {
+			log.Debug("Suppressing ICE candidate forbidden by policy", "type", cand.Typ.String())
+			return
+		}
+		fn(cand)
+	}
+}
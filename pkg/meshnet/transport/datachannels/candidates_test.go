@@ -0,0 +1,101 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datachannels
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+func TestCandidatePolicy(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name      string
+		types     []string
+		wantHosts bool
+	}{
+		{name: "AllowAll", types: nil, wantHosts: true},
+		{name: "AllowHost", types: []string{"host", "relay"}, wantHosts: true},
+		{name: "ForbidHost", types: []string{"srflx", "relay"}, wantHosts: false},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			policy, err := ParseCandidatePolicy(tt.types)
+			if err != nil {
+				t.Fatalf("parse candidate policy: %v", err)
+			}
+			ctx := WithCandidatePolicy(context.Background(), policy)
+			pc, err := newPeerConnection(ctx, nil)
+			if err != nil {
+				t.Fatalf("create peer connection: %v", err)
+			}
+			defer pc.Close()
+			var mu sync.Mutex
+			var hosts int
+			done := make(chan struct{})
+			pc.OnICECandidate(onCandidate(ctx, func(cand *webrtc.ICECandidate) {
+				if cand == nil {
+					close(done)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if cand.Typ == webrtc.ICECandidateTypeHost {
+					hosts++
+				}
+			}))
+			if _, err := pc.CreateDataChannel("test", nil); err != nil {
+				t.Fatalf("create data channel: %v", err)
+			}
+			offer, err := pc.CreateOffer(nil)
+			if err != nil {
+				t.Fatalf("create offer: %v", err)
+			}
+			if err := pc.SetLocalDescription(offer); err != nil {
+				t.Fatalf("set local description: %v", err)
+			}
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("timed out waiting for candidate gathering")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.wantHosts && hosts == 0 {
+				t.Fatal("expected host candidates to be signaled")
+			}
+			if !tt.wantHosts && hosts != 0 {
+				t.Fatalf("expected host candidates to be suppressed, got %d", hosts)
+			}
+		})
+	}
+
+	t.Run("InvalidType", func(t *testing.T) {
+		t.Parallel()
+		if _, err := ParseCandidatePolicy([]string{"bogus"}); err == nil {
+			t.Fatal("expected error parsing invalid candidate type")
+		}
+	})
+}
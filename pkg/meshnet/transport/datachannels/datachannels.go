@@ -80,13 +80,7 @@ func NewServerChannel(ctx context.Context, rt transport.WebRTCSignalTransport) (
 	if err != nil {
 		return nil, fmt.Errorf("failed to start signaling transport: %w", err)
 	}
-	s := webrtc.SettingEngine{}
-	s.DetachDataChannels()
-	s.SetIncludeLoopbackCandidate(true)
-	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
-	p, err := api.NewPeerConnection(webrtc.Configuration{
-		ICEServers: rt.TURNServers(),
-	})
+	p, err := newPeerConnection(ctx, rt.TURNServers())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create peer connection: %w", err)
 	}
@@ -97,7 +91,7 @@ func NewServerChannel(ctx context.Context, rt transport.WebRTCSignalTransport) (
 		closed:         make(chan struct{}),
 		acceptc:        make(chan clientConn, 5),
 	}
-	c.OnICECandidate(func(cand *webrtc.ICECandidate) {
+	c.OnICECandidate(onCandidate(ctx, func(cand *webrtc.ICECandidate) {
 		if cand == nil {
 			return
 		}
@@ -105,7 +99,7 @@ func NewServerChannel(ctx context.Context, rt transport.WebRTCSignalTransport) (
 		if err != nil && err != transport.ErrSignalTransportClosed {
 			c.errors <- fmt.Errorf("failed to send ICE candidate: %w", err)
 		}
-	})
+	}))
 	c.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		log.Debug("Peer connection state has changed", "state", state.String())
 		if state == webrtc.PeerConnectionStateConnected {
@@ -307,13 +301,7 @@ func NewClientChannel(ctx context.Context, rt transport.WebRTCSignalTransport) (
 	if err != nil {
 		return nil, fmt.Errorf("failed to start signaling transport: %w", err)
 	}
-	s := webrtc.SettingEngine{}
-	s.DetachDataChannels()
-	s.SetIncludeLoopbackCandidate(true)
-	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
-	p, err := api.NewPeerConnection(webrtc.Configuration{
-		ICEServers: rt.TURNServers(),
-	})
+	p, err := newPeerConnection(ctx, rt.TURNServers())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create peer connection: %w", err)
 	}
@@ -323,7 +311,7 @@ func NewClientChannel(ctx context.Context, rt transport.WebRTCSignalTransport) (
 		ready:          make(chan struct{}),
 		closed:         make(chan struct{}),
 	}
-	c.OnICECandidate(func(cand *webrtc.ICECandidate) {
+	c.OnICECandidate(onCandidate(ctx, func(cand *webrtc.ICECandidate) {
 		if cand == nil {
 			return
 		}
@@ -331,7 +319,7 @@ func NewClientChannel(ctx context.Context, rt transport.WebRTCSignalTransport) (
 		if err != nil && err != transport.ErrSignalTransportClosed {
 			c.errors <- fmt.Errorf("failed to send ICE candidate: %w", err)
 		}
-	})
+	}))
 	c.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		log.Debug("Peer connection state has changed", "state", state.String())
 		if state == webrtc.PeerConnectionStateConnected {
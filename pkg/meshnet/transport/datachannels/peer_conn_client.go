@@ -81,13 +81,7 @@ func NewPeerConnectionClient(ctx context.Context, protocol string, rt transport.
 	if err != nil {
 		return nil, fmt.Errorf("failed to start signaling transport: %w", err)
 	}
-	s := webrtc.SettingEngine{}
-	s.DetachDataChannels()
-	s.SetIncludeLoopbackCandidate(true)
-	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
-	p, err := api.NewPeerConnection(webrtc.Configuration{
-		ICEServers: rt.TURNServers(),
-	})
+	p, err := newPeerConnection(ctx, rt.TURNServers())
 	if err != nil {
 		defer rt.Close()
 		return nil, fmt.Errorf("failed to create peer connection: %w", err)
@@ -115,7 +109,7 @@ func NewPeerConnectionClient(ctx context.Context, protocol string, rt transport.
 		return nil, fmt.Errorf("failed to create negotiation data channel: %w", err)
 	}
 	// Register handlers
-	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+	pc.OnICECandidate(onCandidate(ctx, func(c *webrtc.ICECandidate) {
 		if c == nil {
 			return
 		}
@@ -123,7 +117,7 @@ func NewPeerConnectionClient(ctx context.Context, protocol string, rt transport.
 		if err != nil && !transport.IsSignalTransportClosed(err) {
 			pc.errors <- fmt.Errorf("failed to send ICE candidate: %w", err)
 		}
-	})
+	}))
 	var mu sync.Mutex
 	pc.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
 		mu.Lock()
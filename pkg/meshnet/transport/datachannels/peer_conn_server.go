@@ -79,19 +79,13 @@ func NewPeerConnectionServer(ctx context.Context, opts *OfferOptions) (*PeerConn
 	if opts.Proto == "" {
 		opts.Proto = "tcp"
 	}
-	s := webrtc.SettingEngine{}
-	s.DetachDataChannels()
-	s.SetIncludeLoopbackCandidate(true)
-	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
-	conn, err := api.NewPeerConnection(webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: opts.STUNServers,
-				// TODO: Authentication
-				Username:       "-",
-				Credential:     "-",
-				CredentialType: webrtc.ICECredentialTypePassword,
-			},
+	conn, err := newPeerConnection(ctx, []webrtc.ICEServer{
+		{
+			URLs: opts.STUNServers,
+			// TODO: Authentication
+			Username:       "-",
+			Credential:     "-",
+			CredentialType: webrtc.ICECredentialTypePassword,
 		},
 	})
 	if err != nil {
@@ -138,7 +132,7 @@ func NewPeerConnectionServer(ctx context.Context, opts *OfferOptions) (*PeerConn
 			}
 		}
 	})
-	pc.OnICECandidate(pc.onICECandidate)
+	pc.OnICECandidate(onCandidate(ctx, pc.onICECandidate))
 	dc, err := pc.CreateDataChannel(
 		v1.DataChannel_CHANNELS.String(), &webrtc.DataChannelInit{
 			Protocol:   common.Pointer("tcp"),
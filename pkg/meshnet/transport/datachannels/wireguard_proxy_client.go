@@ -53,13 +53,7 @@ func NewWireGuardProxyClient(ctx context.Context, rt transport.WebRTCSignalTrans
 		return nil, fmt.Errorf("failed to start signaling transport: %w", err)
 	}
 	defer rt.Close()
-	s := webrtc.SettingEngine{}
-	s.DetachDataChannels()
-	s.SetIncludeLoopbackCandidate(true)
-	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
-	c, err := api.NewPeerConnection(webrtc.Configuration{
-		ICEServers: rt.TURNServers(),
-	})
+	c, err := newPeerConnection(ctx, rt.TURNServers())
 	if err != nil {
 		defer rt.Close()
 		return nil, fmt.Errorf("failed to create peer connection: %w", err)
@@ -76,7 +70,7 @@ func NewWireGuardProxyClient(ctx context.Context, rt transport.WebRTCSignalTrans
 		return nil, fmt.Errorf("failed to set remote description: %w", err)
 	}
 	errs := make(chan error, 10)
-	pc.conn.OnICECandidate(func(c *webrtc.ICECandidate) {
+	pc.conn.OnICECandidate(onCandidate(ctx, func(c *webrtc.ICECandidate) {
 		if c == nil {
 			return
 		}
@@ -89,7 +83,7 @@ func NewWireGuardProxyClient(ctx context.Context, rt transport.WebRTCSignalTrans
 			defer rt.Close()
 			errs <- fmt.Errorf("failed to send ICE candidate: %w", err)
 		}
-	})
+	}))
 	var mu sync.Mutex
 	pc.conn.OnICEConnectionStateChange(func(s webrtc.ICEConnectionState) {
 		mu.Lock()
@@ -196,6 +190,18 @@ func (w *WireGuardProxyClient) LocalAddr() *net.UDPAddr {
 	}
 }
 
+// BytesTransferred returns the number of bytes sent and received over the
+// ICE transport of the proxy.
+func (w *WireGuardProxyClient) BytesTransferred() (sent, received uint64) {
+	for _, stats := range w.conn.GetStats() {
+		if ts, ok := stats.(webrtc.TransportStats); ok {
+			sent += ts.BytesSent
+			received += ts.BytesReceived
+		}
+	}
+	return sent, received
+}
+
 // Closed returns a channel that is closed when the proxy is closed.
 func (w *WireGuardProxyClient) Closed() <-chan struct{} {
 	return w.closec
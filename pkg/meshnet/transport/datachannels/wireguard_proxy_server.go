@@ -43,19 +43,13 @@ type WireGuardProxyServer struct {
 // NewWireGuardProxyServer creates a new WireGuardProxyServer using the given STUN servers
 // for ICE negotiation. Traffic will be proxied to the wireguard interface listening on targetPort.
 func NewWireGuardProxyServer(ctx context.Context, stunServers []string, targetPort uint16) (*WireGuardProxyServer, error) {
-	s := webrtc.SettingEngine{}
-	s.DetachDataChannels()
-	s.SetIncludeLoopbackCandidate(true)
-	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
-	c, err := api.NewPeerConnection(webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: stunServers,
-				// TODO: Authentication
-				Username:       "-",
-				Credential:     "-",
-				CredentialType: webrtc.ICECredentialTypePassword,
-			},
+	c, err := newPeerConnection(ctx, []webrtc.ICEServer{
+		{
+			URLs: stunServers,
+			// TODO: Authentication
+			Username:       "-",
+			Credential:     "-",
+			CredentialType: webrtc.ICECredentialTypePassword,
 		},
 	})
 	if err != nil {
@@ -71,7 +65,7 @@ func NewWireGuardProxyServer(ctx context.Context, stunServers []string, targetPo
 	log := context.LoggerFrom(ctx)
 	readyc := make(chan struct{})
 	var mu sync.Mutex
-	pc.conn.OnICECandidate(func(c *webrtc.ICECandidate) {
+	pc.conn.OnICECandidate(onCandidate(ctx, func(c *webrtc.ICECandidate) {
 		if c == nil {
 			return
 		}
@@ -88,7 +82,7 @@ func NewWireGuardProxyServer(ctx context.Context, stunServers []string, targetPo
 		default:
 		}
 		pc.candidatec <- c.ToJSON().Candidate
-	})
+	}))
 	pc.conn.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
 		mu.Lock()
 		defer mu.Unlock()
@@ -537,7 +537,7 @@ func (t *WebmeshTransport) startNode(ctx context.Context, laddr ma.Multiaddr) (m
 	})
 
 	// Start any mesh services
-	srvOpts, err := conf.Services.NewServiceOptions(ctx, node)
+	srvOpts, err := conf.NewServiceOptions(ctx, node)
 	if err != nil {
 		return nil, handleErr(fmt.Errorf("failed to create service options: %w", err))
 	}
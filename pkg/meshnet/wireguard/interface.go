@@ -18,6 +18,7 @@ limitations under the License.
 package wireguard
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -46,12 +47,34 @@ const DefaultListenPort = 51820
 // DefaultInterfaceName is the default name to use for the WireGuard interface.
 var DefaultInterfaceName = "webmesh0"
 
+// MaxInterfaceNameLength is the maximum length of an interface name on the
+// current platform. On unix-like systems this is IFNAMSIZ minus the trailing
+// null byte.
+var MaxInterfaceNameLength = 15
+
+// ErrInterfaceNameTooLong is returned when an interface name exceeds the
+// platform limit.
+var ErrInterfaceNameTooLong = errors.New("interface name too long")
+
 func init() {
 	switch runtime.GOOS {
 	case "darwin":
 		// macOS TUN interfaces have to be named "utun" followed by a number.
 		DefaultInterfaceName = "utun0"
+	case "windows":
+		// Windows interface aliases are limited by NDIS_IF_MAX_STRING_SIZE.
+		MaxInterfaceNameLength = 256
+	}
+}
+
+// ValidateInterfaceName checks that the given interface name can be used
+// on the current platform.
+func ValidateInterfaceName(name string) error {
+	if len(name) > MaxInterfaceNameLength {
+		return fmt.Errorf("%w: %q is %d characters, the limit on %s is %d",
+			ErrInterfaceNameTooLong, name, len(name), runtime.GOOS, MaxInterfaceNameLength)
 	}
+	return nil
 }
 
 // Interface is a high-level interface for managing wireguard connections.
@@ -91,6 +114,9 @@ type Options struct {
 	ForceName bool
 	// ForceTUN forces the use of a TUN interface.
 	ForceTUN bool
+	// UserspaceBackend is the userspace WireGuard implementation to use when
+	// a TUN interface is created. Empty selects the default.
+	UserspaceBackend string
 	// PersistentKeepAlive is the interval at which to send keepalive packets
 	// to peers. If unset, keepalive packets will automatically be sent to publicly
 	// accessible peers when this instance is behind a NAT. Otherwise, no keep-alive
@@ -119,6 +145,13 @@ type Options struct {
 	DisableFullTunnel bool
 	// IgnoreRoutes are additional routes to ignore.
 	IgnoreRoutes []netip.Prefix
+	// DisableRouteManagement skips installing routes for peer allowed IPs,
+	// including the default gateway, leaving routing to the operator.
+	DisableRouteManagement bool
+	// DisableNetworkRoute skips the assumption that the mesh networks are
+	// routed to the interface as a whole, and installs routes for the addresses
+	// of each peer instead.
+	DisableNetworkRoute bool
 }
 
 type wginterface struct {
@@ -138,6 +171,9 @@ func New(ctx context.Context, opts *Options) (Interface, error) {
 	if opts.Name == "" {
 		opts.Name = DefaultInterfaceName
 	}
+	if err := ValidateInterfaceName(opts.Name); err != nil {
+		return nil, err
+	}
 	if opts.MTU <= 0 {
 		opts.MTU = system.DefaultMTU
 	}
@@ -173,14 +209,15 @@ func New(ctx context.Context, opts *Options) (Interface, error) {
 	}
 	log.Info("Creating wireguard interface", "name", opts.Name)
 	ifaceopts := &system.Options{
-		Name:        opts.Name,
-		NetNs:       opts.NetNs,
-		AddressV4:   opts.AddressV4,
-		AddressV6:   opts.AddressV6,
-		ForceTUN:    opts.ForceTUN,
-		MTU:         uint32(opts.MTU),
-		DisableIPv4: opts.DisableIPv4,
-		DisableIPv6: opts.DisableIPv6,
+		Name:             opts.Name,
+		NetNs:            opts.NetNs,
+		AddressV4:        opts.AddressV4,
+		AddressV6:        opts.AddressV6,
+		ForceTUN:         opts.ForceTUN,
+		UserspaceBackend: opts.UserspaceBackend,
+		MTU:              uint32(opts.MTU),
+		DisableIPv4:      opts.DisableIPv4,
+		DisableIPv6:      opts.DisableIPv6,
 	}
 	log.Debug("Creating system interface", "options", ifaceopts)
 	iface, err := system.New(ctx, ifaceopts)
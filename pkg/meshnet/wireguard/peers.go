@@ -58,6 +58,12 @@ type Peer struct {
 	AllowedIPs []netip.Prefix `json:"allowedIPs"`
 	// AllowedRoutes is the list of allowed routes for this peer.
 	AllowedRoutes []netip.Prefix `json:"allowedRoutes"`
+	// PresharedKey is an optional symmetric key to mix into the handshake
+	// with this peer. It is never included in marshaled output.
+	PresharedKey *wgtypes.Key `json:"-"`
+	// PersistentKeepAlive overrides the keepalive interval of the interface for
+	// this peer when set. A zero duration disables keepalive for the peer.
+	PersistentKeepAlive *time.Duration `json:"-"`
 }
 
 func (p Peer) MarshalJSON() ([]byte, error) {
@@ -97,7 +103,9 @@ func (w *wginterface) PutPeer(ctx context.Context, peer *Peer) error {
 		}
 	}
 	var keepAlive *time.Duration
-	if w.opts.PersistentKeepAlive != 0 {
+	if peer.PersistentKeepAlive != nil {
+		keepAlive = peer.PersistentKeepAlive
+	} else if w.opts.PersistentKeepAlive != 0 {
 		keepAlive = &w.opts.PersistentKeepAlive
 	} else {
 		dur := time.Second * 30
@@ -161,6 +169,7 @@ func (w *wginterface) PutPeer(ctx context.Context, peer *Peer) error {
 		AllowedIPs:                  allIPs,
 		PersistentKeepaliveInterval: keepAlive,
 		ReplaceAllowedIPs:           true,
+		PresharedKey:                peer.PresharedKey,
 	}
 	var err error
 	if peer.Endpoint.IsValid() {
@@ -184,19 +193,27 @@ func (w *wginterface) PutPeer(ctx context.Context, peer *Peer) error {
 		}
 	}
 	w.registerPeer(peer)
-	// Add routes to the allowed IPs
+	if w.opts.DisableRouteManagement {
+		return nil
+	}
+	return w.addPeerRoutes(ctx, allIPs)
+}
+
+// addPeerRoutes adds routes for the allowed IPs of a peer. Routes within the
+// mesh networks are skipped unless the network routes are disabled.
+func (w *wginterface) addPeerRoutes(ctx context.Context, allIPs []net.IPNet) error {
 	for _, ip := range allIPs {
 		addr, _ := netip.AddrFromSlice(ip.IP)
 		ones, _ := ip.Mask.Size()
 		prefix := netip.PrefixFrom(addr, ones)
-		// Skip adding routes to our own network
-		if w.opts.NetworkV4.IsValid() && addr.Is4() && !w.opts.DisableIPv4 {
+		// Skip adding routes to our own network, it is routed as a whole
+		if w.opts.NetworkV4.IsValid() && addr.Is4() && !w.opts.DisableIPv4 && !w.opts.DisableNetworkRoute {
 			if w.opts.NetworkV4.Contains(addr) {
 				w.log.Debug("Skipping route to own network", slog.String("prefix", prefix.String()))
 				continue
 			}
 		}
-		if w.opts.NetworkV6.IsValid() && addr.Is6() && !w.opts.DisableIPv6 {
+		if w.opts.NetworkV6.IsValid() && addr.Is6() && !w.opts.DisableIPv6 && !w.opts.DisableNetworkRoute {
 			if w.opts.NetworkV6.Contains(addr) {
 				w.log.Debug("Skipping route to own network", slog.String("prefix", prefix.String()))
 				continue
@@ -235,7 +252,7 @@ func (w *wginterface) PutPeer(ctx context.Context, peer *Peer) error {
 		// Add any other routes
 		if prefix.Addr().Is4() && !w.opts.DisableIPv4 {
 			w.log.Debug("Adding IPv4 route to interface", slog.Any("prefix", prefix))
-			err = w.AddRoute(ctx, prefix)
+			err := w.AddRoute(ctx, prefix)
 			if err != nil && !system.IsRouteExists(err) {
 				return fmt.Errorf("failed to add route: %w", err)
 			}
@@ -246,7 +263,7 @@ func (w *wginterface) PutPeer(ctx context.Context, peer *Peer) error {
 				continue
 			}
 			w.log.Debug("Adding IPv6 route to interface", slog.Any("prefix", prefix))
-			err = w.AddRoute(ctx, prefix)
+			err := w.AddRoute(ctx, prefix)
 			if err != nil && !system.IsRouteExists(err) {
 				return fmt.Errorf("failed to add route: %w", err)
 			}
@@ -351,6 +368,7 @@ func (m peerConfigMarshaler) MarshalJSON() ([]byte, error) {
 		"public_key":         m.PublicKey.String(),
 		"endpoint":           m.Endpoint.String(),
 		"keepalive_interval": m.PersistentKeepaliveInterval,
+		"preshared_key":      m.PresharedKey != nil,
 		"allowed_ips": func() []string {
 			var ips []string
 			for _, ip := range m.AllowedIPs {
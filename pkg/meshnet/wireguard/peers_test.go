@@ -0,0 +1,100 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wireguard
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/webmeshproj/webmesh/pkg/meshnet/system"
+)
+
+func TestAddPeerRoutes(t *testing.T) {
+	t.Parallel()
+	allowedIPs := []net.IPNet{
+		ipNet("172.16.0.2/32"),
+		ipNet("fd00:dead:beef:2::/64"),
+		ipNet("10.1.0.0/16"),
+	}
+	tc := []struct {
+		name string
+		opts Options
+		want []netip.Prefix
+	}{
+		{
+			name: "NetworkRoute",
+			opts: Options{
+				NetworkV4: netip.MustParsePrefix("172.16.0.0/12"),
+				NetworkV6: netip.MustParsePrefix("fd00:dead:beef::/48"),
+			},
+			want: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")},
+		},
+		{
+			name: "PeerRoutesOnly",
+			opts: Options{
+				NetworkV4:           netip.MustParsePrefix("172.16.0.0/12"),
+				NetworkV6:           netip.MustParsePrefix("fd00:dead:beef::/48"),
+				DisableNetworkRoute: true,
+			},
+			want: []netip.Prefix{
+				netip.MustParsePrefix("172.16.0.2/32"),
+				netip.MustParsePrefix("fd00:dead:beef:2::/64"),
+				netip.MustParsePrefix("10.1.0.0/16"),
+			},
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			iface := &routeRecorder{}
+			w := &wginterface{
+				Interface: iface,
+				opts:      &tt.opts,
+				log:       slog.Default(),
+			}
+			if err := w.addPeerRoutes(context.Background(), allowedIPs); err != nil {
+				t.Fatalf("add peer routes: %v", err)
+			}
+			if !reflect.DeepEqual(iface.routes, tt.want) {
+				t.Fatalf("expected routes %v, got %v", tt.want, iface.routes)
+			}
+		})
+	}
+}
+
+type routeRecorder struct {
+	system.Interface
+	routes []netip.Prefix
+}
+
+func (r *routeRecorder) AddRoute(_ context.Context, route netip.Prefix) error {
+	r.routes = append(r.routes, route)
+	return nil
+}
+
+func ipNet(s string) net.IPNet {
+	prefix := netip.MustParsePrefix(s)
+	return net.IPNet{
+		IP:   prefix.Addr().AsSlice(),
+		Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+	}
+}
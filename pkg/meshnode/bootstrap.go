@@ -22,6 +22,7 @@ import (
 	"log/slog"
 	"net"
 	"net/netip"
+	"slices"
 	"strconv"
 	"time"
 
@@ -52,7 +53,7 @@ func (s *meshStore) bootstrap(ctx context.Context, opts ConnectOptions) error {
 		// We have data, so the cluster is already bootstrapped.
 		if opts.JoinRoundTripper == nil {
 			s.log.Info("Cluster already bootstrapped, but we have no join transport. Recovering from storage.")
-			return s.recoverWireguard(ctx)
+			return s.autoRecoverWireguard(ctx, opts.Recover)
 		}
 		s.log.Info("Cluster already bootstrapped, attempting to rejoin as voter")
 		return s.join(ctx, opts)
@@ -63,7 +64,7 @@ func (s *meshStore) bootstrap(ctx context.Context, opts ConnectOptions) error {
 		if errors.IsAlreadyBootstrapped(err) {
 			if joinRT == nil {
 				s.log.Info("Cluster already bootstrapped, but we are the only server in the configuration. Recovering from storage.")
-				return s.recoverWireguard(ctx)
+				return s.autoRecoverWireguard(ctx, opts.Recover)
 			}
 			s.log.Info("Cluster already bootstrapped, attempting to rejoin as voter")
 			opts.JoinRoundTripper = joinRT
@@ -84,26 +85,51 @@ func (s *meshStore) bootstrap(ctx context.Context, opts ConnectOptions) error {
 }
 
 func (s *meshStore) initialBootstrapLeader(ctx context.Context, opts ConnectOptions) error {
+	// Load any RBAC manifest up front so an invalid one fails the bootstrap
+	// before we write anything.
+	var rbacManifest *storage.RBACManifest
+	if opts.Bootstrap.RBACManifest != "" {
+		var err error
+		rbacManifest, err = storage.LoadRBACManifest(opts.Bootstrap.RBACManifest)
+		if err != nil {
+			return fmt.Errorf("load rbac manifest: %w", err)
+		}
+	}
 	// We'll bootstrap the cluster as just ourselves.
 	s.log.Info("Bootstrapping mesh storage")
 	err := s.storage.Bootstrap(ctx)
 	if err != nil {
 		return fmt.Errorf("bootstrap raft: %w", err)
 	}
+	restored := false
+	if opts.Bootstrap.RestoreSnapshot != "" {
+		err = s.restoreBootstrapSnapshot(ctx, opts.Bootstrap)
+		if err != nil {
+			return err
+		}
+		restored = true
+	}
+	// Order the bootstrap servers so the resulting database is reproducible.
+	servers := sortedBootstrapServers(s.ID().String(), opts.Bootstrap.Servers)
 	bootstrapOpts := storage.BootstrapOptions{
 		MeshDomain:           opts.Bootstrap.MeshDomain,
 		IPv4Network:          opts.Bootstrap.IPv4Network,
 		IPv6Network:          opts.Bootstrap.IPv6Network,
 		Admin:                opts.Bootstrap.Admin,
 		DefaultNetworkPolicy: opts.Bootstrap.DefaultNetworkPolicy,
-		BootstrapNodes:       append(opts.Bootstrap.Servers, s.ID().String()),
+		BootstrapNodes:       append(slices.Clone(servers), s.ID().String()),
 		Voters:               opts.Bootstrap.Voters,
 		DisableRBAC:          opts.Bootstrap.DisableRBAC,
+		RBACManifest:         rbacManifest,
 	}
 	s.log.Debug("Bootstrapping mesh database", slog.Any("params", bootstrapOpts))
 	results, err := storage.Bootstrap(ctx, s.Storage().MeshDB(), &bootstrapOpts)
 	if err != nil {
-		return fmt.Errorf("bootstrap database: %w", err)
+		// A restored snapshot already holds the mesh state, the results
+		// are populated from it.
+		if !restored || !errors.IsAlreadyBootstrapped(err) {
+			return fmt.Errorf("bootstrap database: %w", err)
+		}
 	}
 	s.meshDomain = results.MeshDomain
 	s.log.Info("Bootstrapped webmesh cluster database",
@@ -116,7 +142,7 @@ func (s *meshStore) initialBootstrapLeader(ctx context.Context, opts ConnectOpti
 	meshDB := s.Storage().MeshDB()
 	if len(opts.Routes) > 0 {
 		err = meshDB.Networking().PutRoute(ctx, types.Route{Route: &v1.Route{
-			Name: fmt.Sprintf("%s-auto", s.nodeID),
+			Name: storage.NodeAutoRouteName(types.NodeID(s.nodeID)),
 			Node: s.ID().String(),
 			DestinationCIDRs: func() []string {
 				out := make([]string, 0)
@@ -168,67 +194,9 @@ func (s *meshStore) initialBootstrapLeader(ctx context.Context, opts ConnectOpti
 	if err != nil {
 		return fmt.Errorf("create node: %w", err)
 	}
-	// Pre-create slots and edges for the other bootstrap servers.
-	for _, id := range opts.Bootstrap.Servers {
-		if id == s.nodeID {
-			continue
-		}
-		s.log.Info("Creating node in database for bootstrap server",
-			slog.String("server-id", id),
-		)
-		err = p.Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{Id: id}})
-		if err != nil {
-			return fmt.Errorf("create node: %w", err)
-		}
-	}
-	// Do the loop again for edges
-	for _, id := range append(opts.Bootstrap.Servers, s.ID().String()) {
-		for _, peer := range opts.Bootstrap.Servers {
-			if id == peer {
-				continue
-			}
-			s.log.Info("Creating edges in database for bootstrap server",
-				slog.String("server-id", id),
-				slog.String("peer-id", peer),
-			)
-			err = p.PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{
-				Source: id,
-				Target: peer,
-				Weight: 99,
-			}})
-			if err != nil {
-				return fmt.Errorf("create edge: %w", err)
-			}
-			err = p.PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{
-				Source: id,
-				Target: peer,
-				Weight: 99,
-			}})
-			if err != nil {
-				return fmt.Errorf("create edge: %w", err)
-			}
-		}
-	}
-	// If we have direct-peerings, add them to the db
-	if len(opts.DirectPeers) > 0 {
-		for peer, proto := range opts.DirectPeers {
-			if peer == s.ID() {
-				continue
-			}
-			err = p.Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{Id: peer.String()}})
-			if err != nil {
-				return fmt.Errorf("create direct peerings: %w", err)
-			}
-			err = p.PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{
-				Source:     s.ID().String(),
-				Target:     peer.String(),
-				Weight:     0,
-				Attributes: types.EdgeAttrsForConnectProto(proto),
-			}})
-			if err != nil {
-				return fmt.Errorf("create direct peerings: %w", err)
-			}
-		}
+	err = s.createBootstrapPeers(ctx, p, servers, opts.DirectPeers)
+	if err != nil {
+		return err
 	}
 	if s.testStore {
 		// We dont manage network connections on test stores
@@ -288,3 +256,96 @@ func (s *meshStore) initialBootstrapLeader(ctx context.Context, opts ConnectOpti
 	s.log.Info("Initial network bootstrap complete")
 	return nil
 }
+
+// createBootstrapPeers pre-creates slots and edges for the other bootstrap servers
+// and any direct peers. Servers must already be sorted, and direct peers are
+// visited in order of their IDs, so the same inputs always produce the same writes.
+func (s *meshStore) createBootstrapPeers(ctx context.Context, p storage.Peers, servers []string, directPeers map[types.NodeID]v1.ConnectProtocol) error {
+	for _, id := range servers {
+		s.log.Info("Creating node in database for bootstrap server",
+			slog.String("server-id", id),
+		)
+		err := p.Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{Id: id}})
+		if err != nil {
+			return fmt.Errorf("create node: %w", err)
+		}
+	}
+	// Do the loop again for edges
+	sources := append(slices.Clone(servers), s.ID().String())
+	slices.Sort(sources)
+	for _, id := range sources {
+		for _, peer := range servers {
+			if id == peer {
+				continue
+			}
+			s.log.Info("Creating edges in database for bootstrap server",
+				slog.String("server-id", id),
+				slog.String("peer-id", peer),
+			)
+			err := p.PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{
+				Source: id,
+				Target: peer,
+				Weight: 99,
+			}})
+			if err != nil {
+				return fmt.Errorf("create edge: %w", err)
+			}
+		}
+	}
+	// If we have direct-peerings, add them to the db
+	peers := make([]types.NodeID, 0, len(directPeers))
+	for peer := range directPeers {
+		if peer != s.ID() {
+			peers = append(peers, peer)
+		}
+	}
+	slices.Sort(peers)
+	for _, peer := range peers {
+		err := p.Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{Id: peer.String()}})
+		if err != nil {
+			return fmt.Errorf("create direct peerings: %w", err)
+		}
+		err = p.PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{
+			Source:     s.ID().String(),
+			Target:     peer.String(),
+			Weight:     0,
+			Attributes: types.EdgeAttrsForConnectProto(directPeers[peer]),
+		}})
+		if err != nil {
+			return fmt.Errorf("create direct peerings: %w", err)
+		}
+	}
+	return nil
+}
+
+// sortedBootstrapServers returns the other bootstrap servers in sorted order,
+// without duplicates or the local node.
+func sortedBootstrapServers(self string, servers []string) []string {
+	out := make([]string, 0, len(servers))
+	for _, id := range servers {
+		if id != self {
+			out = append(out, id)
+		}
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// restoreBootstrapSnapshot restores the mesh database from the snapshot
+// configured in the bootstrap options.
+func (s *meshStore) restoreBootstrapSnapshot(ctx context.Context, opts *BootstrapOptions) error {
+	restorer, ok := s.storage.(storage.SnapshotRestorer)
+	if !ok {
+		return fmt.Errorf("restore snapshot: storage provider does not support restoring snapshots")
+	}
+	s.log.Info("Restoring mesh database from snapshot", slog.String("source", opts.RestoreSnapshot))
+	rdr, err := storage.OpenSnapshot(ctx, opts.RestoreSnapshot, opts.RestoreSnapshotHeaders)
+	if err != nil {
+		return fmt.Errorf("open snapshot: %w", err)
+	}
+	defer rdr.Close()
+	if err := restorer.RestoreSnapshot(ctx, rdr, opts.Force); err != nil {
+		return fmt.Errorf("restore snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnode
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestCreateBootstrapPeersDeterministic(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	directPeers := map[types.NodeID]v1.ConnectProtocol{
+		"direct-b": v1.ConnectProtocol_CONNECT_ICE,
+		"direct-a": v1.ConnectProtocol_CONNECT_LIBP2P,
+		"direct-c": v1.ConnectProtocol_CONNECT_ICE,
+	}
+	bootstrap := func(servers []string) ([]string, [][2]string) {
+		t.Helper()
+		db := meshdb.NewTestDB()
+		t.Cleanup(func() { db.Close() })
+		s := &meshStore{nodeID: "server-b", log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+		p := &recordingPeers{Peers: db.Peers()}
+		err := s.createBootstrapPeers(ctx, p, sortedBootstrapServers(s.nodeID, servers), directPeers)
+		if err != nil {
+			t.Fatalf("create bootstrap peers: %v", err)
+		}
+		return p.nodes, p.edges
+	}
+
+	nodes1, edges1 := bootstrap([]string{"server-c", "server-a", "server-b", "server-d"})
+	nodes2, edges2 := bootstrap([]string{"server-d", "server-b", "server-a", "server-c", "server-a"})
+	if !slices.Equal(nodes1, nodes2) {
+		t.Fatalf("expected identical node writes, got %v and %v", nodes1, nodes2)
+	}
+	if !slices.Equal(edges1, edges2) {
+		t.Fatalf("expected identical edge writes, got %v and %v", edges1, edges2)
+	}
+
+	// Every server has an edge to every other server, and we have edges to our direct peers.
+	var want [][2]string
+	for _, src := range []string{"server-a", "server-b", "server-c", "server-d"} {
+		for _, dst := range []string{"server-a", "server-c", "server-d"} {
+			if src != dst {
+				want = append(want, [2]string{src, dst})
+			}
+		}
+	}
+	for _, dst := range []string{"direct-a", "direct-b", "direct-c"} {
+		want = append(want, [2]string{"server-b", dst})
+	}
+	if !slices.Equal(edges1, want) {
+		t.Fatalf("unexpected edges\nwant: %v\n got: %v", want, edges1)
+	}
+}
+
+// recordingPeers records the order of node and edge writes.
+type recordingPeers struct {
+	storage.Peers
+	nodes []string
+	edges [][2]string
+}
+
+func (r *recordingPeers) Put(ctx context.Context, n types.MeshNode) error {
+	r.nodes = append(r.nodes, n.GetId())
+	return r.Peers.Put(ctx, n)
+}
+
+func (r *recordingPeers) PutEdge(ctx context.Context, edge types.MeshEdge) error {
+	r.edges = append(r.edges, [2]string{edge.GetSource(), edge.GetTarget()})
+	return r.Peers.PutEdge(ctx, edge)
+}
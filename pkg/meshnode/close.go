@@ -36,6 +36,7 @@ func (s *meshStore) Close(ctx context.Context) error {
 	defer s.open.Store(false)
 	defer close(s.closec)
 	s.kvSubCancel()
+	s.aclSubCancel()
 	if s.nw != nil {
 		// Do this last so that we don't lose connectivity to the network
 		defer func() {
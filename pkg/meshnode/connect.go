@@ -79,6 +79,10 @@ type ConnectOptions struct {
 	PreferIPv6 bool
 	// Multiaddrs are the multiaddrs to advertise for this node.
 	Multiaddrs []multiaddr.Multiaddr
+	// Recover restores the previous wireguard configuration from storage
+	// even when automatic recovery is disabled. This is how an operator
+	// starts a node after reconfiguring it with DisableAutoRecovery set.
+	Recover bool
 }
 
 func (c ConnectOptions) MarshalJSON() ([]byte, error) {
@@ -104,6 +108,7 @@ func (c ConnectOptions) MarshalJSON() ([]byte, error) {
 		"bootstrap":          c.Bootstrap,
 		"preferIPv6":         c.PreferIPv6,
 		"multiaddrs":         c.Multiaddrs,
+		"recover":            c.Recover,
 	})
 }
 
@@ -133,7 +138,17 @@ type BootstrapOptions struct {
 	// DefaultNetworkPolicy is the default network policy for the mesh.
 	// If empty, DefaultNetworkPolicy will be used.
 	DefaultNetworkPolicy string
-	// Force is true if the node should force bootstrap.
+	// RBACManifest is the path to a YAML or JSON file of additional roles,
+	// groups, and role bindings to create when bootstrapping.
+	RBACManifest string
+	// RestoreSnapshot is a local path or file, http, or https URL of a
+	// snapshot to restore the mesh database from when bootstrapping.
+	RestoreSnapshot string
+	// RestoreSnapshotHeaders are headers to send when fetching
+	// RestoreSnapshot over http(s), e.g. for authorization.
+	RestoreSnapshotHeaders map[string]string
+	// Force is true if the node should force bootstrap. It also allows
+	// RestoreSnapshot to replace mesh state already in the database.
 	Force bool
 }
 
@@ -147,6 +162,8 @@ func (b BootstrapOptions) MarshalJSON() ([]byte, error) {
 		"voters":               b.Voters,
 		"disableRBAC":          b.DisableRBAC,
 		"defaultNetworkPolicy": b.DefaultNetworkPolicy,
+		"rbacManifest":         b.RBACManifest,
+		"restoreSnapshot":      b.RestoreSnapshot,
 		"force":                b.Force,
 	})
 }
@@ -174,6 +191,9 @@ func (s *meshStore) Connect(ctx context.Context, opts ConnectOptions) (err error
 	// Create the network manager
 	opts.NetworkOptions.StoragePort = int(s.storage.ListenPort())
 	s.nw = meshnet.New(s.Storage().MeshDB(), opts.NetworkOptions, s.ID())
+	if opts.NetworkOptions.PortMapping {
+		s.mapWireGuardPort(ctx, &opts)
+	}
 	if opts.Bootstrap != nil {
 		// Attempt bootstrap.
 		if err = s.bootstrap(ctx, opts); err != nil {
@@ -189,7 +209,7 @@ func (s *meshStore) Connect(ctx context.Context, opts ConnectOptions) (err error
 		// We neither had the bootstrap flag nor any join flags set.
 		// This means we are possibly a single node cluster.
 		// Recover our previous wireguard configuration and start up.
-		if err := s.recoverWireguard(ctx); err != nil {
+		if err := s.autoRecoverWireguard(ctx, opts.Recover); err != nil {
 			return fmt.Errorf("recover wireguard: %w", err)
 		}
 	} else {
@@ -219,10 +239,11 @@ func (s *meshStore) Connect(ctx context.Context, opts ConnectOptions) (err error
 	}
 	// Create the plugin manager
 	pluginopts := plugins.Options{
-		Storage:               s.Storage(),
-		Plugins:               opts.Plugins,
-		DisableDefaultIPAM:    s.opts.DisableDefaultIPAM,
-		DefaultIPAMStaticIPv4: s.opts.DefaultIPAMStaticIPv4,
+		Storage:                 s.Storage(),
+		Plugins:                 opts.Plugins,
+		DisableDefaultIPAM:      s.opts.DisableDefaultIPAM,
+		DefaultIPAMStaticIPv4:   s.opts.DefaultIPAMStaticIPv4,
+		DefaultIPAMReleaseGrace: s.opts.DefaultIPAMReleaseGrace,
 		Node: plugins.NodeConfig{
 			NodeID:      s.ID(),
 			NetworkIPv4: s.nw.NetworkV4(),
@@ -246,6 +267,17 @@ func (s *meshStore) Connect(ctx context.Context, opts ConnectOptions) (err error
 	if raft, ok := s.storage.(*raftstorage.Provider); ok {
 		raft.OnObservation(s.newObserver())
 	}
+	// Warn operators when the mesh is running with an open network policy.
+	policy := newOpenPolicyWatcher(s.log, s.storage.MeshDB().Networking())
+	if err := policy.Check(ctx); err != nil {
+		log.Warn("Failed to check for default-accept network ACL", slog.String("error", err.Error()))
+	}
+	if s.storage.Consensus().IsMember() {
+		s.aclSubCancel, err = s.storage.MeshStorage().Subscribe(context.Background(), storage.NetworkACLsPrefix, policy.OnACLUpdate)
+		if err != nil {
+			return handleErr(fmt.Errorf("subscribe to network acls: %w", err))
+		}
+	}
 	// Register an update hook to watch for network changes.
 	if s.storage.Consensus().IsMember() {
 		s.log.Debug("Subscribing to peer updates from local storage")
@@ -310,9 +342,29 @@ func (s *meshStore) Connect(ctx context.Context, opts ConnectOptions) (err error
 			}
 		}()
 	}
+	if s.opts.HeartbeatInterval > 0 {
+		go s.sendHeartbeats(s.opts.HeartbeatInterval)
+	}
+	if s.opts.SecondaryIPs > 0 && !s.opts.DisableIPv4 {
+		go s.requestSecondaryIPs(s.opts.SecondaryIPs)
+	}
 	return nil
 }
 
+// autoRecoverWireguard recovers the previous wireguard configuration when
+// restarting without a join transport, unless automatic recovery is disabled
+// and the operator did not explicitly request it.
+func (s *meshStore) autoRecoverWireguard(ctx context.Context, requested bool) error {
+	if s.opts.DisableAutoRecovery {
+		if !requested {
+			s.log.Warn("Automatic wireguard recovery is disabled, not starting the network until recovery is requested")
+			return ErrAutoRecoveryDisabled
+		}
+		s.log.Info("Recovering wireguard configuration at operator request")
+	}
+	return s.recoverWireguard(ctx)
+}
+
 func (s *meshStore) recoverWireguard(ctx context.Context) error {
 	if s.testStore {
 		return nil
@@ -0,0 +1,70 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnode
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestDisableAutoRecovery(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+
+	// Restarting as the only member of the bootstrapped cluster would
+	// normally recover the previous wireguard configuration.
+	restart := func(disable bool) *meshStore {
+		st := NewWithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)), Config{
+			NodeID:              node.ID().String(),
+			DisableAutoRecovery: disable,
+		}).(*meshStore)
+		st.testStore = true
+		return st
+	}
+	disabled := restart(true)
+	err = disabled.Connect(ctx, ConnectOptions{StorageProvider: node.Storage()})
+	if !errors.Is(err, ErrAutoRecoveryDisabled) {
+		t.Fatalf("expected ErrAutoRecoveryDisabled, got %v", err)
+	}
+	if disabled.Started() {
+		t.Fatal("expected node to not be started with recovery disabled")
+	}
+
+	requested := restart(true)
+	if err := requested.Connect(ctx, ConnectOptions{StorageProvider: node.Storage(), Recover: true}); err != nil {
+		t.Fatalf("connect with recovery requested: %v", err)
+	}
+	if !requested.Started() {
+		t.Fatal("expected node to be started after requested recovery")
+	}
+
+	enabled := restart(false)
+	if err := enabled.Connect(ctx, ConnectOptions{StorageProvider: node.Storage()}); err != nil {
+		t.Fatalf("connect with recovery enabled: %v", err)
+	}
+	if !enabled.Started() {
+		t.Fatal("expected node to be started after recovery")
+	}
+}
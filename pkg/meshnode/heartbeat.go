@@ -0,0 +1,61 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnode
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+)
+
+// DefaultHeartbeatInterval is the default interval at which nodes send
+// heartbeats to the leader.
+const DefaultHeartbeatInterval = time.Minute
+
+// sendHeartbeats sends a heartbeat to the leader every interval until the
+// node is closed. A heartbeat is an update request carrying only the node ID.
+func (s *meshStore) sendHeartbeats(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.closec:
+			return
+		case <-t.C:
+			if s.storage.Consensus().IsLeader() {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := s.sendHeartbeat(ctx); err != nil {
+				s.log.Debug("Failed to send heartbeat", slog.String("error", err.Error()))
+			}
+			cancel()
+		}
+	}
+}
+
+func (s *meshStore) sendHeartbeat(ctx context.Context) error {
+	c, err := s.DialLeader(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, err = v1.NewMembershipClient(c).Update(ctx, &v1.UpdateRequest{Id: s.ID().String()})
+	return err
+}
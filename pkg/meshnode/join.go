@@ -24,17 +24,28 @@ import (
 	"time"
 
 	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/meshnet"
 	"github.com/webmeshproj/webmesh/pkg/services"
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+	"github.com/webmeshproj/webmesh/pkg/version"
 )
 
+// defaultJoinRetryDelay is how long to wait before retrying a failed join
+// when the server did not say how long to back off.
+const defaultJoinRetryDelay = time.Second
+
 func (s *meshStore) join(ctx context.Context, opts ConnectOptions) error {
 	log := s.log
 	ctx = context.WithLogger(ctx, log)
 	log.Info("Joining webmesh cluster")
 	defer opts.JoinRoundTripper.Close()
+	// Let the leader check that we are compatible with the mesh.
+	ctx = metadata.AppendToOutgoingContext(ctx, leaderproxy.NodeVersionMeta, version.Version)
 	var tries int
 	encoded, err := s.key.PublicKey().Encode()
 	if err != nil {
@@ -57,7 +68,11 @@ func (s *meshStore) join(ctx context.Context, opts ConnectOptions) error {
 				return err
 			}
 			tries++
-			time.Sleep(time.Second)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(joinRetryDelay(err)):
+			}
 			continue
 		}
 		err = s.handleJoinResponse(ctx, opts, resp)
@@ -69,6 +84,22 @@ func (s *meshStore) join(ctx context.Context, opts ConnectOptions) error {
 	return nil
 }
 
+// joinRetryDelay returns how long to wait before retrying a failed join. A
+// server that rejects the join while overloaded says how long to back off
+// with a RetryInfo detail, otherwise the default delay is used.
+func joinRetryDelay(err error) time.Duration {
+	st, ok := status.FromError(err)
+	if !ok {
+		return defaultJoinRetryDelay
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay().AsDuration() > 0 {
+			return info.GetRetryDelay().AsDuration()
+		}
+	}
+	return defaultJoinRetryDelay
+}
+
 func (s *meshStore) handleJoinResponse(ctx context.Context, opts ConnectOptions, resp *v1.JoinResponse) error {
 	log := context.LoggerFrom(ctx)
 	log.Debug("Received join response", slog.Any("resp", resp))
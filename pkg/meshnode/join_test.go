@@ -0,0 +1,58 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestJoinRetryDelay(t *testing.T) {
+	t.Parallel()
+	overloaded, err := status.New(codes.Unavailable, "overloaded").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(5 * time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{name: "NotStatus", err: errors.New("connection refused"), want: defaultJoinRetryDelay},
+		{name: "NoRetryInfo", err: status.Error(codes.Unavailable, "unavailable"), want: defaultJoinRetryDelay},
+		{name: "RetryInfo", err: overloaded.Err(), want: 5 * time.Second},
+		{name: "WrappedRetryInfo", err: fmt.Errorf("join: %w", overloaded.Err()), want: 5 * time.Second},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := joinRetryDelay(tt.err); got != tt.want {
+				t.Fatalf("expected delay %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
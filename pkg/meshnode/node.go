@@ -22,6 +22,8 @@ import (
 	"log/slog"
 	"net"
 	"net/netip"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -40,6 +42,10 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
+// PeerServerNameID is replaced with the ID of the node being dialed in
+// Config.PeerServerName.
+const PeerServerNameID = "{id}"
+
 var (
 	// ErrNotOpen is returned when attempting to close a store that is not open.
 	ErrNotOpen = fmt.Errorf("not open")
@@ -47,6 +53,10 @@ var (
 	ErrOpen = fmt.Errorf("already open")
 	// ErrNoLeader is returned when there is no Raft leader.
 	ErrNoLeader = fmt.Errorf("no leader")
+	// ErrAutoRecoveryDisabled is returned when connecting would recover the
+	// previous wireguard configuration from storage, but automatic recovery
+	// is disabled and was not requested with ConnectOptions.Recover.
+	ErrAutoRecoveryDisabled = fmt.Errorf("automatic wireguard recovery is disabled")
 )
 
 // Node is the connection to the Webmesh. It controls raft consensus, plugins,
@@ -95,6 +105,10 @@ type Config struct {
 	// Credentials are gRPC credentials to use when dialing other nodes
 	// in the mesh.
 	Credentials []grpc.DialOption
+	// PeerServerName is the TLS server name to expect when dialing other
+	// nodes. Any occurrence of PeerServerNameID is replaced with the ID of
+	// the node being dialed. If empty, the dialed address is verified as before.
+	PeerServerName string
 	// Key is the private key to use for WireGuard and libp2p connections.
 	// This can be nil, in which case one will be generated when Connect
 	// is called.
@@ -103,6 +117,12 @@ type Config struct {
 	// assuming a peer is offline. This is only applicable when currently
 	// the leader of the raft group.
 	HeartbeatPurgeThreshold int
+	// HeartbeatInterval is how often to send heartbeats to the leader, which
+	// uses them to collect dead nodes. Zero disables heartbeats.
+	HeartbeatInterval time.Duration
+	// SecondaryIPs is the number of additional IPv4 addresses to lease from
+	// the mesh and assign to the wireguard interface.
+	SecondaryIPs int
 	// ZoneAwarenessID is an to use with zone-awareness to determine
 	// peers in the same LAN segment.
 	ZoneAwarenessID string
@@ -123,6 +143,15 @@ type Config struct {
 	DisableDefaultIPAM bool
 	// DefaultIPAMStaticIPv4 is a map of node names to IPv4 addresses.
 	DefaultIPAMStaticIPv4 map[string]string
+	// DefaultIPAMReleaseGrace is how long the default IPAM holds a released
+	// address for the node that released it.
+	DefaultIPAMReleaseGrace time.Duration
+	// DisableAutoRecovery stops a node that is the only member of an already
+	// bootstrapped cluster from automatically restoring its previous wireguard
+	// configuration on restart. Connect returns ErrAutoRecoveryDisabled instead,
+	// so operators can reconfigure the node before starting it explicitly with
+	// ConnectOptions.Recover.
+	DisableAutoRecovery bool
 }
 
 // New creates a new Mesh. You must call Open() on the returned mesh
@@ -148,6 +177,7 @@ func NewWithLogger(log *slog.Logger, opts Config) Node {
 		dnsUpdateGroup:   &dnsUpdateGroup,
 		log:              log.With(slog.String("node-id", string(opts.NodeID))),
 		kvSubCancel:      func() {},
+		aclSubCancel:     func() {},
 		closec:           make(chan struct{}),
 	}
 	return st
@@ -162,6 +192,7 @@ type meshStore struct {
 	storage          storage.Provider
 	plugins          plugins.Manager
 	kvSubCancel      context.CancelFunc
+	aclSubCancel     context.CancelFunc
 	nw               meshnet.Manager
 	peerUpdateGroup  *errgroup.Group
 	routeUpdateGroup *errgroup.Group
@@ -315,20 +346,20 @@ func (s *meshStore) dialWithLocalStorage(ctx context.Context, nodeID types.NodeI
 		if !addr.IsValid() {
 			return nil, fmt.Errorf("node %q has no private IPv6 address", nodeID)
 		}
-		return s.newGRPCConn(ctx, addr.String())
+		return s.newGRPCConn(ctx, node.NodeID(), addr.String())
 	}
 	if s.opts.DisableIPv6 {
 		addr := node.PrivateRPCAddrV4()
 		if !addr.IsValid() {
 			return nil, fmt.Errorf("node %q has no private IPv4 address", nodeID)
 		}
-		return s.newGRPCConn(ctx, addr.String())
+		return s.newGRPCConn(ctx, node.NodeID(), addr.String())
 	}
 	// Fallback to whichever is valid if both are present (preferring IPv6)
 	if node.PrivateRPCAddrV6().IsValid() {
-		return s.newGRPCConn(ctx, node.PrivateRPCAddrV6().String())
+		return s.newGRPCConn(ctx, node.NodeID(), node.PrivateRPCAddrV6().String())
 	}
-	return s.newGRPCConn(ctx, node.PrivateRPCAddrV4().String())
+	return s.newGRPCConn(ctx, node.NodeID(), node.PrivateRPCAddrV4().String())
 }
 
 func (s *meshStore) dialWithWireguardPeers(ctx context.Context, nodeID types.NodeID) (*grpc.ClientConn, error) {
@@ -355,21 +386,35 @@ func (s *meshStore) dialWithWireguardPeers(ctx context.Context, nodeID types.Nod
 	}
 	if s.opts.DisableIPv4 && toDial.PrivateIPv6.IsValid() {
 		addr := netip.AddrPortFrom(toDial.PrivateIPv6.Addr(), uint16(toDial.GRPCPort))
-		return s.newGRPCConn(ctx, addr.String())
+		return s.newGRPCConn(ctx, types.NodeID(toDial.ID), addr.String())
 	}
 	if s.opts.DisableIPv6 && toDial.PrivateIPv4.IsValid() {
 		addr := netip.AddrPortFrom(toDial.PrivateIPv4.Addr(), uint16(toDial.GRPCPort))
-		return s.newGRPCConn(ctx, addr.String())
+		return s.newGRPCConn(ctx, types.NodeID(toDial.ID), addr.String())
 	}
 	// Fallback to whichever is valid if both are present (preferring IPv6)
 	if toDial.PrivateIPv6.IsValid() {
 		addr := netip.AddrPortFrom(toDial.PrivateIPv6.Addr(), uint16(toDial.GRPCPort))
-		return s.newGRPCConn(ctx, addr.String())
+		return s.newGRPCConn(ctx, types.NodeID(toDial.ID), addr.String())
 	}
 	addr := netip.AddrPortFrom(toDial.PrivateIPv4.Addr(), uint16(toDial.GRPCPort))
-	return s.newGRPCConn(ctx, addr.String())
+	return s.newGRPCConn(ctx, types.NodeID(toDial.ID), addr.String())
+}
+
+// newGRPCConn dials the given node at addr. When a peer server name is
+// configured, the authority is set to it, which the TLS credentials use as
+// the ServerName when one is not configured. Otherwise the dialed address is
+// verified.
+func (s *meshStore) newGRPCConn(ctx context.Context, nodeID types.NodeID, addr string) (*grpc.ClientConn, error) {
+	opts := s.Credentials()
+	if name := s.peerServerName(nodeID); name != "" {
+		opts = append(slices.Clone(opts), grpc.WithAuthority(name))
+	}
+	return grpc.DialContext(ctx, addr, opts...)
 }
 
-func (s *meshStore) newGRPCConn(ctx context.Context, addr string) (*grpc.ClientConn, error) {
-	return grpc.DialContext(ctx, addr, s.Credentials()...)
+// peerServerName returns the TLS server name expected of the given node, or
+// an empty string if none is configured.
+func (s *meshStore) peerServerName(nodeID types.NodeID) string {
+	return strings.ReplaceAll(s.opts.PeerServerName, PeerServerNameID, nodeID.String())
 }
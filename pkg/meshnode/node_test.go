@@ -0,0 +1,93 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnode
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestDialServerName(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name       string
+		serverName string
+		want       string
+	}{
+		// No SNI is sent when dialing an IP address.
+		{name: "Address", serverName: "", want: ""},
+		{name: "Pattern", serverName: "{id}.nodes.webmesh.internal", want: "node-a.nodes.webmesh.internal"},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			serverNames := make(chan string, 1)
+			l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+				GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+					select {
+					case serverNames <- hello.ServerName:
+					default:
+					}
+					return nil, errors.New("no certificate")
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			go func() {
+				for {
+					c, err := l.Accept()
+					if err != nil {
+						return
+					}
+					_ = c.(*tls.Conn).Handshake()
+					c.Close()
+				}
+			}()
+			st := &meshStore{opts: Config{
+				Credentials: []grpc.DialOption{
+					grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})),
+				},
+				PeerServerName: tt.serverName,
+			}}
+			conn, err := st.newGRPCConn(context.Background(), types.NodeID("node-a"), l.Addr().String())
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+			conn.Connect()
+			select {
+			case got := <-serverNames:
+				if got != tt.want {
+					t.Fatalf("expected server name %q, got %q", tt.want, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for the TLS handshake")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnode
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+)
+
+// OpenNetworkPolicy is set to 1 while the mesh has a default-accept NetworkACL,
+// meaning every node may reach every other node unless a higher priority ACL
+// denies it.
+var OpenNetworkPolicy = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "webmesh",
+	Name:      "open_network_policy",
+	Help:      "Whether the mesh has a default-accept network ACL.",
+})
+
+// openPolicyEvent is the event attribute logged when the default-accept
+// NetworkACL is added or removed.
+const openPolicyEvent = "open-network-policy"
+
+// openPolicyWatcher tracks whether the default-accept NetworkACL exists. It keeps
+// the OpenNetworkPolicy gauge up to date and logs an event when the ACL is
+// found at startup and on every later transition.
+type openPolicyWatcher struct {
+	nw     storage.Networking
+	log    *slog.Logger
+	known  bool
+	active bool
+	mu     sync.Mutex
+}
+
+func newOpenPolicyWatcher(log *slog.Logger, nw storage.Networking) *openPolicyWatcher {
+	return &openPolicyWatcher{nw: nw, log: log}
+}
+
+// Check looks up the default-accept NetworkACL and reports any change since the
+// previous check.
+func (w *openPolicyWatcher) Check(ctx context.Context) error {
+	_, err := w.nw.GetNetworkACL(ctx, string(storage.DefaultAcceptNetworkACLName))
+	if err != nil && !errors.IsACLNotFound(err) {
+		return fmt.Errorf("get default accept network acl: %w", err)
+	}
+	active := err == nil
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.known && w.active == active {
+		return nil
+	}
+	first := !w.known
+	w.known, w.active = true, active
+	if active {
+		OpenNetworkPolicy.Set(1)
+		w.log.Warn("Mesh has a default-accept network ACL, all nodes are allowed to communicate with each other",
+			slog.String("event", openPolicyEvent),
+			slog.String("acl", string(storage.DefaultAcceptNetworkACLName)),
+		)
+		return nil
+	}
+	OpenNetworkPolicy.Set(0)
+	if first {
+		// Starting without a default-accept ACL is the normal case.
+		return nil
+	}
+	w.log.Info("Mesh no longer has a default-accept network ACL",
+		slog.String("event", openPolicyEvent),
+		slog.String("acl", string(storage.DefaultAcceptNetworkACLName)),
+	)
+	return nil
+}
+
+// OnACLUpdate can be used as a storage subscription callback for NetworkACL changes.
+func (w *openPolicyWatcher) OnACLUpdate(key, value []byte) {
+	if err := w.Check(context.Background()); err != nil {
+		w.log.Warn("Failed to check for default-accept network ACL", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnode
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+)
+
+func TestOpenPolicyWatcher(t *testing.T) {
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	t.Cleanup(func() { db.Close() })
+	_, err := storage.Bootstrap(ctx, db, &storage.BootstrapOptions{
+		MeshDomain:           "webmesh.internal",
+		IPv4Network:          "172.16.0.0/12",
+		IPv6Network:          "fd00:dead:beef::/48",
+		Admin:                "admin",
+		DefaultNetworkPolicy: "accept",
+	})
+	if err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+	var buf bytes.Buffer
+	w := newOpenPolicyWatcher(slog.New(slog.NewTextHandler(&buf, nil)), db.Networking())
+	events := func() int {
+		return strings.Count(buf.String(), "event="+openPolicyEvent)
+	}
+
+	// The default-accept ACL created by bootstrap should be reported.
+	if err := w.Check(ctx); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if v := testutil.ToFloat64(OpenNetworkPolicy); v != 1 {
+		t.Fatalf("expected gauge to be 1, got %v", v)
+	}
+	if n := events(); n != 1 {
+		t.Fatalf("expected 1 event, got %d", n)
+	}
+
+	// Removing it should clear the gauge and emit another event.
+	if err := db.Networking().DeleteNetworkACL(ctx, string(storage.DefaultAcceptNetworkACLName)); err != nil {
+		t.Fatalf("delete network acl: %v", err)
+	}
+	if err := w.Check(ctx); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if v := testutil.ToFloat64(OpenNetworkPolicy); v != 0 {
+		t.Fatalf("expected gauge to be 0, got %v", v)
+	}
+	if n := events(); n != 2 {
+		t.Fatalf("expected 2 events, got %d", n)
+	}
+
+	// Nothing changed, so no further events are expected.
+	if err := w.Check(ctx); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if n := events(); n != 2 {
+		t.Fatalf("expected no new events, got %d total", n)
+	}
+
+	// Starting without the ACL is not a transition and is not logged.
+	buf.Reset()
+	w = newOpenPolicyWatcher(slog.New(slog.NewTextHandler(&buf, nil)), db.Networking())
+	if err := w.Check(ctx); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if v := testutil.ToFloat64(OpenNetworkPolicy); v != 0 {
+		t.Fatalf("expected gauge to be 0, got %v", v)
+	}
+	if n := events(); n != 0 {
+		t.Fatalf("expected no events at startup without the acl, got %d", n)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnode
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+)
+
+// portMappingUpdateTimeout is how long to wait for the leader to accept a
+// changed port mapping endpoint.
+const portMappingUpdateTimeout = 30 * time.Second
+
+// mapWireGuardPort maps the wireguard listen port on the local gateway and
+// advertises the external address as the primary endpoint. Failures are logged
+// and the node continues behind the NAT. If the external address of the
+// mapping changes later, the new endpoint is advertised to the mesh.
+func (s *meshStore) mapWireGuardPort(ctx context.Context, opts *ConnectOptions) {
+	s.log.Debug("Requesting port mapping for wireguard listen port")
+	configured := *opts
+	ext, err := s.nw.MapListenPort(ctx, func(ctx context.Context, ext netip.AddrPort) {
+		ctx, cancel := context.WithTimeout(ctx, portMappingUpdateTimeout)
+		defer cancel()
+		if err := s.advertiseEndpoints(ctx, advertiseMappedEndpoint(configured, ext)); err != nil {
+			s.log.Warn("Failed to advertise changed port mapping endpoint", slog.String("error", err.Error()))
+			return
+		}
+		s.log.Info("Advertised changed port mapping endpoint", slog.String("endpoint", ext.String()))
+	})
+	if err != nil {
+		s.log.Warn("Failed to map wireguard port, continuing without a port mapping", slog.String("error", err.Error()))
+		return
+	}
+	*opts = advertiseMappedEndpoint(*opts, ext)
+}
+
+// advertiseEndpoints updates the primary and wireguard endpoints of this node
+// with the leader.
+func (s *meshStore) advertiseEndpoints(ctx context.Context, opts ConnectOptions) error {
+	c, err := s.DialLeader(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	endpoints := make([]string, len(opts.WireGuardEndpoints))
+	for i, ep := range opts.WireGuardEndpoints {
+		endpoints[i] = ep.String()
+	}
+	_, err = v1.NewMembershipClient(c).Update(ctx, &v1.UpdateRequest{
+		Id:                 s.ID().String(),
+		PrimaryEndpoint:    opts.PrimaryEndpoint.String(),
+		WireguardEndpoints: endpoints,
+	})
+	if err != nil {
+		return fmt.Errorf("update endpoints: %w", err)
+	}
+	return nil
+}
+
+// advertiseMappedEndpoint returns the options with the mapped external endpoint
+// as the primary endpoint and first wireguard endpoint.
+func advertiseMappedEndpoint(opts ConnectOptions, ext netip.AddrPort) ConnectOptions {
+	opts.PrimaryEndpoint = ext.Addr()
+	endpoints := make([]netip.AddrPort, 0, len(opts.WireGuardEndpoints)+1)
+	endpoints = append(endpoints, ext)
+	for _, ep := range opts.WireGuardEndpoints {
+		if !slices.Contains(endpoints, ep) {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	opts.WireGuardEndpoints = endpoints
+	return opts
+}
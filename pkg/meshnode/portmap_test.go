@@ -0,0 +1,41 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnode
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestAdvertiseMappedEndpoint(t *testing.T) {
+	t.Parallel()
+	ext := netip.MustParseAddrPort("203.0.113.7:41820")
+	opts := advertiseMappedEndpoint(ConnectOptions{
+		WireGuardEndpoints: []netip.AddrPort{
+			netip.MustParseAddrPort("192.168.1.10:51820"),
+			ext,
+		},
+	}, ext)
+	if opts.PrimaryEndpoint != ext.Addr() {
+		t.Fatalf("expected primary endpoint %s, got %s", ext.Addr(), opts.PrimaryEndpoint)
+	}
+	want := []netip.AddrPort{ext, netip.MustParseAddrPort("192.168.1.10:51820")}
+	if !slices.Equal(opts.WireGuardEndpoints, want) {
+		t.Fatalf("expected wireguard endpoints %v, got %v", want, opts.WireGuardEndpoints)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshnode
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strconv"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+)
+
+// secondaryIPsRetryInterval is how long to wait between attempts to lease
+// secondary IPs from the leader.
+const secondaryIPsRetryInterval = 5 * time.Second
+
+// requestSecondaryIPs leases the given number of secondary IPv4 addresses from
+// the leader and assigns them to the wireguard interface, retrying until it
+// succeeds or the node is closed.
+func (s *meshStore) requestSecondaryIPs(count int) {
+	assigned := make(map[netip.Prefix]struct{})
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), secondaryIPsRetryInterval)
+		err := s.assignSecondaryIPs(ctx, count, assigned)
+		cancel()
+		if err == nil {
+			return
+		}
+		s.log.Warn("Failed to lease secondary IPs, retrying", slog.String("error", err.Error()))
+		select {
+		case <-s.closec:
+			return
+		case <-time.After(secondaryIPsRetryInterval):
+		}
+	}
+}
+
+func (s *meshStore) assignSecondaryIPs(ctx context.Context, count int, assigned map[netip.Prefix]struct{}) error {
+	c, err := s.DialLeader(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	ctx = metadata.AppendToOutgoingContext(ctx, leaderproxy.SecondaryIPsMeta, strconv.Itoa(count))
+	_, err = v1.NewMembershipClient(c).Update(ctx, &v1.UpdateRequest{Id: s.ID().String()})
+	if err != nil {
+		return fmt.Errorf("request secondary ips: %w", err)
+	}
+	leases, err := s.Storage().MeshDB().Networking().GetSecondaryIPs(ctx, s.ID())
+	if err != nil {
+		return fmt.Errorf("get secondary ips: %w", err)
+	}
+	if len(leases.Addresses) < count {
+		// Our copy of the database has not caught up with the leader yet.
+		return fmt.Errorf("expected %d secondary ips, found %d", count, len(leases.Addresses))
+	}
+	for _, addr := range leases.Addresses {
+		if _, ok := assigned[addr]; ok {
+			continue
+		}
+		s.log.Info("Adding secondary IP to wireguard interface", slog.String("address", addr.String()))
+		if err := s.nw.WireGuard().AddAddress(ctx, addr); err != nil {
+			return fmt.Errorf("add secondary ip %s: %w", addr, err)
+		}
+		assigned[addr] = struct{}{}
+	}
+	return nil
+}
@@ -30,6 +30,8 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
 	"github.com/webmeshproj/webmesh/pkg/version"
 )
 
@@ -38,7 +40,8 @@ type Plugin struct {
 	v1.UnimplementedPluginServer
 	v1.UnimplementedAuthPluginServer
 
-	config *tls.Config
+	config        *tls.Config
+	identityField crypto.CertIdentityField
 }
 
 // Config is the configuration for the mTLS plugin.
@@ -51,18 +54,23 @@ type Config struct {
 	// If not provided, the system pool and any intermediate chains provided
 	// in the authentication request will be used.
 	CAData string `koanf:"ca-data" mapstructure:"ca-data"`
+	// IdentityField is the certificate field the node ID is read from.
+	// One of "cn", "dns-san", or "uri-san". Defaults to "cn".
+	IdentityField string `koanf:"identity-field" mapstructure:"identity-field"`
 }
 
 // BindFlags binds the plugin flags to the given flag set.
 func (c *Config) BindFlags(prefix string, fs *pflag.FlagSet) {
 	fs.StringVar(&c.CAFile, prefix+"ca-file", "", "Path to a CA file to use to verify client certificates.")
 	fs.StringVar(&c.CAData, prefix+"ca-data", "", "Base64 encoded PEM CA data to use to verify client certificates.")
+	fs.StringVar(&c.IdentityField, prefix+"identity-field", "", "The certificate field to read node IDs from (cn, dns-san, or uri-san). Defaults to cn.")
 }
 
 func (c *Config) AsMapStructure() map[string]any {
 	return map[string]any{
-		"ca-file": c.CAFile,
-		"ca-data": c.CAData,
+		"ca-file":        c.CAFile,
+		"ca-data":        c.CAData,
+		"identity-field": c.IdentityField,
 	}
 }
 
@@ -95,6 +103,11 @@ func (p *Plugin) Configure(ctx context.Context, req *v1.PluginConfiguration) (*e
 	if config.CAFile == "" && config.CAData == "" {
 		return nil, fmt.Errorf("ca-file is required")
 	}
+	field, err := crypto.ParseCertIdentityField(config.IdentityField)
+	if err != nil {
+		return nil, fmt.Errorf("identity-field: %w", err)
+	}
+	p.identityField = field
 	p.config = &tls.Config{}
 	roots, err := x509.SystemCertPool()
 	if err != nil {
@@ -155,11 +168,14 @@ func (p *Plugin) Authenticate(ctx context.Context, req *v1.AuthenticationRequest
 		context.LoggerFrom(ctx).Warn("mtls-auth failed to verify certificate", "error", err.Error())
 		return nil, fmt.Errorf("mtls-auth failed to verify certificate: %w", err)
 	}
-	commonName := cert.Subject.CommonName
-	if commonName == "" {
-		return nil, fmt.Errorf("no common name in certificate")
+	id, err := crypto.IdentityFromCert(cert, p.identityField)
+	if err != nil {
+		return nil, fmt.Errorf("mtls-auth failed to read node ID: %w", err)
+	}
+	if !types.IsValidNodeID(id) {
+		return nil, fmt.Errorf("mtls-auth certificate identity %q is not a valid node ID", id)
 	}
 	return &v1.AuthenticationResponse{
-		Id: commonName,
+		Id: id,
 	}, nil
 }
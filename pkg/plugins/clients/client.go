@@ -34,4 +34,7 @@ type PluginClient interface {
 	Events() v1.WatchPluginClient
 	// IPAM returns an IPAM client.
 	IPAM() v1.IPAMPluginClient
+	// JoinApprover returns a join approver, or nil if the plugin does not
+	// approve joins.
+	JoinApprover() JoinApprover
 }
@@ -96,6 +96,11 @@ func (p *externalProcessPlugin) IPAM() v1.IPAMPluginClient {
 	return v1.NewIPAMPluginClient(p.conn)
 }
 
+// JoinApprover returns nil, as there is no plugin API for approving joins.
+func (p *externalProcessPlugin) JoinApprover() JoinApprover {
+	return nil
+}
+
 // checkProcess checks if the process is running and restarts it if it is not.
 func (p *externalProcessPlugin) checkProcess(ctx context.Context) error {
 	p.mux.Lock()
@@ -115,3 +115,8 @@ func (p *externalServerPlugin) Events() v1.WatchPluginClient {
 func (p *externalServerPlugin) IPAM() v1.IPAMPluginClient {
 	return v1.NewIPAMPluginClient(p.conn)
 }
+
+// JoinApprover returns nil, as there is no plugin API for approving joins.
+func (p *externalServerPlugin) JoinApprover() JoinApprover {
+	return nil
+}
@@ -84,6 +84,14 @@ func (p *inProcessPlugin) IPAM() v1.IPAMPluginClient {
 	return &inProcessIPAMPlugin{cli}
 }
 
+func (p *inProcessPlugin) JoinApprover() JoinApprover {
+	approver, ok := p.server.(JoinApprover)
+	if !ok {
+		return nil
+	}
+	return approver
+}
+
 type inProcessStoragePlugin struct {
 	*inProcessPlugin
 }
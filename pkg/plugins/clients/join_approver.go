@@ -0,0 +1,40 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clients
+
+import (
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// JoinApproval is the decision of a plugin on a join request.
+type JoinApproval struct {
+	// Approved is true if the node may join.
+	Approved bool
+	// Reason is an optional explanation returned to the node when it is denied.
+	Reason string
+}
+
+// JoinApprover is implemented by plugins that can approve or deny nodes joining
+// the mesh based on custom policy. The plugin API does not yet define a service
+// for this, so only in-process plugins can currently implement it.
+type JoinApprover interface {
+	// ApproveJoin is called with each join request before any resources are
+	// allocated for the node.
+	ApproveJoin(ctx context.Context, req *v1.JoinRequest) (JoinApproval, error)
+}
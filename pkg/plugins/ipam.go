@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/netip"
 	"sync"
+	"time"
 
 	v1 "github.com/webmeshproj/api/go/v1"
 	"google.golang.org/grpc"
@@ -30,13 +31,18 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/storage"
 )
 
+// DefaultIPAMReleaseGrace is the default period for which the built-in IPAM
+// holds a released address for the node that released it.
+const DefaultIPAMReleaseGrace = 5 * time.Minute
+
 // BuiltinIPAM is the built-in IPAM plugin that uses the mesh database
 // to perform allocations.
 type BuiltinIPAM struct {
 	v1.UnimplementedIPAMPluginServer
 
 	IPAMConfig
-	mu sync.Mutex
+	released map[string]releasedLease
+	mu       sync.Mutex
 }
 
 // IPAMConfig contains static address assignments for nodes.
@@ -45,12 +51,24 @@ type IPAMConfig struct {
 	Storage storage.MeshDB
 	// StaticIPv4 is a map of node names to IPv4 addresses.
 	StaticIPv4 map[string]string
+	// ReleaseGrace is how long a released address is held for the node
+	// that released it. If the node is allocated an address again within
+	// the window it reclaims its previous one, and no other node is handed
+	// the address in the meantime. Zero disables sticky leases.
+	ReleaseGrace time.Duration
+}
+
+// releasedLease is an address recently released by a node.
+type releasedLease struct {
+	addr netip.Prefix
+	at   time.Time
 }
 
 // NewBuiltinIPAM returns a new ipam plugin with the given database.
 func NewBuiltinIPAM(opts IPAMConfig) *BuiltinIPAM {
 	return &BuiltinIPAM{
 		IPAMConfig: opts,
+		released:   make(map[string]releasedLease),
 	}
 }
 
@@ -65,10 +83,22 @@ func (p *BuiltinIPAM) Allocate(ctx context.Context, r *v1.AllocateIPRequest, opt
 	return p.allocateV4(ctx, r)
 }
 
+// Release records the released address so it can be reclaimed by the same
+// node within the configured grace period. Released leases are only tracked
+// in memory by the instance that handled the release, so they do not survive
+// a change of leader. ErrUnsupported is returned when sticky leases are disabled.
 func (p *BuiltinIPAM) Release(ctx context.Context, req *v1.ReleaseIPRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return nil, ErrUnsupported
+	if p.ReleaseGrace <= 0 {
+		return nil, ErrUnsupported
+	}
+	addr, err := netip.ParsePrefix(req.GetIp())
+	if err != nil {
+		return nil, fmt.Errorf("parse released address: %w", err)
+	}
+	p.released[req.GetNodeID()] = releasedLease{addr: addr, at: time.Now()}
+	return &emptypb.Empty{}, nil
 }
 
 func (p *BuiltinIPAM) allocateV4(ctx context.Context, r *v1.AllocateIPRequest) (*v1.AllocatedIP, error) {
@@ -87,6 +117,20 @@ func (p *BuiltinIPAM) allocateV4(ctx context.Context, r *v1.AllocateIPRequest) (
 			allocated[n.PrivateAddrV4()] = struct{}{}
 		}
 	}
+	secondary, err := p.Storage.Networking().ListSecondaryIPs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list secondary ips: %w", err)
+	}
+	for _, ips := range secondary {
+		for _, addr := range ips.Addresses {
+			allocated[addr] = struct{}{}
+		}
+	}
+	if lease, ok := p.reclaimable(r.GetNodeID(), globalPrefix, allocated); ok {
+		return &v1.AllocatedIP{
+			Ip: lease.String(),
+		}, nil
+	}
 	prefix, err := p.next32(globalPrefix, allocated)
 	if err != nil {
 		return nil, fmt.Errorf("find next available IPv4: %w", err)
@@ -96,6 +140,32 @@ func (p *BuiltinIPAM) allocateV4(ctx context.Context, r *v1.AllocateIPRequest) (
 	}, nil
 }
 
+// reclaimable returns the address recently released by the given node if it is
+// still within the grace period and unallocated. Leases released by other nodes
+// within the grace period are added to the allocated set. Expired leases are pruned.
+func (p *BuiltinIPAM) reclaimable(nodeID string, cidr netip.Prefix, allocated map[netip.Prefix]struct{}) (netip.Prefix, bool) {
+	var own netip.Prefix
+	for id, lease := range p.released {
+		if time.Since(lease.at) > p.ReleaseGrace {
+			delete(p.released, id)
+			continue
+		}
+		if id == nodeID {
+			own = lease.addr
+			continue
+		}
+		allocated[lease.addr] = struct{}{}
+	}
+	if !own.IsValid() {
+		return netip.Prefix{}, false
+	}
+	delete(p.released, nodeID)
+	if _, ok := allocated[own]; ok || !cidr.Contains(own.Addr()) || p.isStaticAllocation(own) {
+		return netip.Prefix{}, false
+	}
+	return own, true
+}
+
 func (p *BuiltinIPAM) next32(cidr netip.Prefix, set map[netip.Prefix]struct{}) (netip.Prefix, error) {
 	ip := cidr.Addr().Next()
 	for cidr.Contains(ip) {
@@ -105,7 +175,7 @@ func (p *BuiltinIPAM) next32(cidr netip.Prefix, set map[netip.Prefix]struct{}) (
 		}
 		ip = ip.Next()
 	}
-	return netip.Prefix{}, fmt.Errorf("no more addresses in %s", cidr)
+	return netip.Prefix{}, fmt.Errorf("%w: no more addresses in %s", ErrSubnetExhausted, cidr)
 }
 
 func (p *BuiltinIPAM) isStaticAllocation(ip netip.Prefix) bool {
@@ -0,0 +1,77 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestBuiltinIPAMExhaustion(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	defer db.Close()
+	ipam := NewBuiltinIPAM(IPAMConfig{Storage: db})
+
+	// A /30 leaves room for three allocations after the network address.
+	subnet := "10.0.0.0/30"
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("node-%d", i)
+		res, err := ipam.Allocate(ctx, &v1.AllocateIPRequest{NodeID: id, Subnet: subnet})
+		if err != nil {
+			t.Fatalf("allocate %s: %v", id, err)
+		}
+		addr, err := netip.ParsePrefix(res.GetIp())
+		if err != nil {
+			t.Fatalf("parse allocated address: %v", err)
+		}
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := key.PublicKey().Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:          id,
+			PublicKey:   encoded,
+			PrivateIPv4: addr.String(),
+		}})
+		if err != nil {
+			t.Fatalf("put peer %s: %v", id, err)
+		}
+	}
+	_, err := ipam.Allocate(ctx, &v1.AllocateIPRequest{NodeID: "node-3", Subnet: subnet})
+	if !errors.Is(err, ErrSubnetExhausted) {
+		t.Fatalf("expected ErrSubnetExhausted, got %v", err)
+	}
+	if !strings.Contains(err.Error(), subnet) {
+		t.Fatalf("expected error to contain subnet %s, got %v", subnet, err)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"log/slog"
 	"net/netip"
 	"strings"
+	"time"
 
 	v1 "github.com/webmeshproj/api/go/v1"
 	"google.golang.org/grpc"
@@ -44,8 +45,27 @@ var (
 	// ErrUnsupported is returned when a plugin capability is not supported
 	// by any of the registered plugins.
 	ErrUnsupported = status.Error(codes.Unimplemented, "unsupported plugin capability")
+	// ErrSubnetExhausted is returned by the built-in IPAM plugin when there are
+	// no more addresses available in the requested subnet.
+	ErrSubnetExhausted = errors.New("subnet exhausted")
 )
 
+// JoinDeniedError is returned when a plugin denies a node from joining.
+type JoinDeniedError struct {
+	// Plugin is the name of the plugin that denied the join.
+	Plugin string
+	// Reason is the reason given by the plugin.
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *JoinDeniedError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("join denied by plugin %s", e.Plugin)
+	}
+	return fmt.Sprintf("join denied by plugin %s: %s", e.Plugin, e.Reason)
+}
+
 // Options are the options for creating a new plugin manager.
 type Options struct {
 	// Storage is the storage backend to use for plugins.
@@ -58,6 +78,9 @@ type Options struct {
 	DisableDefaultIPAM bool
 	// DefaultIPAMStaticIPv4 is a map of node names to IPv4 addresses.
 	DefaultIPAMStaticIPv4 map[string]string
+	// DefaultIPAMReleaseGrace is how long the default IPAM holds a released
+	// address for the node that released it.
+	DefaultIPAMReleaseGrace time.Duration
 }
 
 // NodeConfig is the configuration of the node to pass to each plugin.
@@ -121,6 +144,9 @@ type Manager interface {
 	// ReleaseIP calls the configured IPAM plugin to release an IP address for the given request.
 	// If no IPAM plugin is configured, ErrUnsupported is returned.
 	ReleaseIP(ctx context.Context, req *v1.ReleaseIPRequest) error
+	// ApproveJoin asks every plugin that approves joins whether the given node may
+	// join. A JoinDeniedError is returned if any plugin denies the join.
+	ApproveJoin(ctx context.Context, req *v1.JoinRequest) error
 	// Emit emits an event to all watch plugins.
 	Emit(ctx context.Context, ev *v1.Event) error
 	// Close closes all plugins.
@@ -201,8 +227,9 @@ func NewManager(ctx context.Context, opts Options) (Manager, error) {
 	// If we didn't find any IPAM plugins, register the default one
 	if ipamv4 == nil && !opts.DisableDefaultIPAM {
 		ipamv4 = NewBuiltinIPAM(IPAMConfig{
-			Storage:    opts.Storage.MeshDB(),
-			StaticIPv4: opts.DefaultIPAMStaticIPv4,
+			Storage:      opts.Storage.MeshDB(),
+			StaticIPv4:   opts.DefaultIPAMStaticIPv4,
+			ReleaseGrace: opts.DefaultIPAMReleaseGrace,
 		})
 	}
 	m := &manager{
@@ -348,6 +375,25 @@ func (m *manager) ReleaseIP(ctx context.Context, req *v1.ReleaseIPRequest) error
 	return err
 }
 
+// ApproveJoin asks every plugin that approves joins whether the given node may
+// join. A JoinDeniedError is returned if any plugin denies the join.
+func (m *manager) ApproveJoin(ctx context.Context, req *v1.JoinRequest) error {
+	for name, plugin := range m.plugins {
+		approver := plugin.Client.JoinApprover()
+		if approver == nil {
+			continue
+		}
+		approval, err := approver.ApproveJoin(ctx, req)
+		if err != nil {
+			return fmt.Errorf("approve join with plugin %s: %w", name, err)
+		}
+		if !approval.Approved {
+			return &JoinDeniedError{Plugin: name, Reason: approval.Reason}
+		}
+	}
+	return nil
+}
+
 // Emit emits an event to all watch plugins.
 func (m *manager) Emit(ctx context.Context, ev *v1.Event) error {
 	errs := make([]error, 0)
@@ -24,7 +24,10 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
 	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb/networking"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
@@ -50,8 +53,16 @@ func (s *Server) PutRoute(ctx context.Context, route *v1.Route) (*emptypb.Empty,
 		}
 		return nil, status.Error(codes.PermissionDenied, "caller does not have permission to put network routes")
 	}
+	if leaderproxy.ForceRoute(ctx) {
+		// The caller knows the route overlaps the mesh networks, such as when
+		// migrating a node's old address range into the mesh.
+		ctx = networking.WithForceRoute(ctx)
+	}
 	err = s.db.Networking().PutRoute(ctx, rt)
 	if err != nil {
+		if errors.IsInvalidRoute(err) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	return &emptypb.Empty{}, nil
@@ -22,6 +22,10 @@ import (
 
 	v1 "github.com/webmeshproj/api/go/v1"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
 )
 
 func TestPutRoute(t *testing.T) {
@@ -133,3 +137,27 @@ func TestPutRoute(t *testing.T) {
 
 	runTestCases(t, tt, server.PutRoute)
 }
+
+func TestPutRouteForce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	server := newTestServer(t)
+	state, err := server.storage.MeshDB().MeshState().GetMeshState(ctx)
+	if err != nil {
+		t.Fatalf("get mesh state: %v", err)
+	}
+	route := &v1.Route{
+		Name:             "overlapping",
+		Node:             "test",
+		DestinationCIDRs: []string{state.NetworkV4().String()},
+	}
+	_, err = server.PutRoute(ctx, route)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected a route inside the mesh network to be rejected, got: %v", err)
+	}
+	forced := metadata.NewIncomingContext(ctx, metadata.Pairs(leaderproxy.ForceRouteMeta, "true"))
+	if _, err := server.PutRoute(forced, route); err != nil {
+		t.Fatalf("expected forced route to be accepted, got: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admin
+
+import (
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/providers/raftstorage"
+)
+
+// streamRaftLogAction requires unrestricted access, since the raft log
+// carries every value written to the mesh.
+var streamRaftLogAction = rbac.Actions{
+	{
+		Resource: v1.RuleResource_RESOURCE_ALL,
+		Verb:     v1.RuleVerb_VERB_ALL,
+	},
+}
+
+// raftLogStreamer is implemented by storage providers that can stream their raft log.
+type raftLogStreamer interface {
+	StreamRaftLog(ctx context.Context, fromIndex uint64, fn raftstorage.RaftLogFunc) error
+}
+
+// StreamRaftLog replays the raft log from the given index and then streams new entries
+// as they are applied, calling send for each one. The next entry is not read until send
+// returns, so a slow consumer applies backpressure to its own stream only. A fromIndex
+// of zero starts at the oldest entry still in the log. Subscribe requests carrying
+// the x-webmesh-raft-log-from metadata key are served by it.
+func (s *Server) StreamRaftLog(ctx context.Context, fromIndex uint64, send raftstorage.RaftLogFunc) error {
+	if ok, err := s.rbacEval.Evaluate(ctx, streamRaftLogAction); !ok {
+		if err != nil {
+			context.LoggerFrom(ctx).Error("failed to evaluate stream raft log action", "error", err)
+		}
+		return status.Error(codes.PermissionDenied, "caller does not have permission to stream the raft log")
+	}
+	streamer, ok := s.storage.(raftLogStreamer)
+	if !ok {
+		return status.Error(codes.Unimplemented, "storage provider does not support streaming the raft log")
+	}
+	err := streamer.StreamRaftLog(ctx, fromIndex, send)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, errors.ErrLogCompacted):
+		return status.Error(codes.OutOfRange, err.Error())
+	case errors.Is(err, errors.ErrClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	case ctx.Err() != nil:
+		return status.FromContextError(ctx.Err()).Err()
+	default:
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+}
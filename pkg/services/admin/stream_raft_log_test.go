@@ -0,0 +1,127 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestStreamRaftLog(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	type nodeEntry struct {
+		index uint64
+		id    string
+	}
+	tracked := map[string]bool{"foo": true, "bar": true, "baz": true}
+	// stream collects writes to tracked nodes from the given index until want have been seen.
+	stream := func(fromIndex uint64, want int) ([]nodeEntry, error) {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		var got []nodeEntry
+		var last uint64
+		var errs []error
+		errDone := status.Error(codes.Aborted, "done")
+		err := server.StreamRaftLog(ctx, fromIndex, func(index uint64, entry *v1.RaftLogEntry) error {
+			if index <= last {
+				errs = append(errs, fmt.Errorf("expected increasing indexes, got %d after %d", index, last))
+			}
+			last = index
+			if entry.GetType() != v1.RaftCommandType_PUT || !storage.NodesPrefix.Contains(entry.GetKey()) {
+				return nil
+			}
+			id := string(storage.NodesPrefix.TrimFrom(entry.GetKey()))
+			if !tracked[id] {
+				return nil
+			}
+			got = append(got, nodeEntry{index: index, id: id})
+			if len(got) == want {
+				return errDone
+			}
+			return nil
+		})
+		if err != errDone {
+			errs = append(errs, fmt.Errorf("stream raft log: %w", err))
+		}
+		return got, errors.Join(errs...)
+	}
+	putNode := func(id string) {
+		t.Helper()
+		err := server.db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:        id,
+			PublicKey: newEncodedPubKey(t),
+		}})
+		if err != nil {
+			t.Fatalf("put node: %v", err)
+		}
+	}
+
+	putNode("foo")
+	putNode("bar")
+	type result struct {
+		got []nodeEntry
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		got, err := stream(0, 3)
+		done <- result{got, err}
+	}()
+	// Give the stream a chance to catch up before writing live entries.
+	time.Sleep(100 * time.Millisecond)
+	putNode("baz")
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	got := res.got
+	if got[0].id != "foo" || got[1].id != "bar" || got[2].id != "baz" {
+		t.Fatalf("expected foo, bar, baz in order, got %v", got)
+	}
+
+	// Starting from bar's index skips everything before it.
+	from, err := stream(got[1].index, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from[0] != got[1] || from[1] != got[2] {
+		t.Fatalf("expected stream from index %d to start at bar, got %v", got[1].index, from)
+	}
+
+	t.Run("PermissionDenied", func(t *testing.T) {
+		srv := NewServer(server.storage, rbac.NewStoreEvaluator(server.db))
+		err := srv.StreamRaftLog(ctx, 0, func(uint64, *v1.RaftLogEntry) error { return nil })
+		if status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("expected PermissionDenied, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	// MinMaxConnectionIdle is the smallest accepted idle limit for connections.
+	MinMaxConnectionIdle = 10 * time.Second
+	// MinMaxConnectionAge is the smallest accepted age limit for connections.
+	MinMaxConnectionAge = 30 * time.Second
+	// MinKeepaliveMinPingInterval is the smallest accepted minimum interval
+	// between client keepalive pings.
+	MinKeepaliveMinPingInterval = time.Second
+)
+
+// KeepaliveOptions control how long client connections may live. Connections
+// past their idle or age limit are sent a GOAWAY and closed gracefully. Zero
+// values leave the gRPC defaults in place.
+type KeepaliveOptions struct {
+	// MaxConnectionIdle is how long a connection may go without any active
+	// streams before it is closed.
+	MaxConnectionIdle time.Duration
+	// MaxConnectionAge is the maximum lifetime of a connection.
+	MaxConnectionAge time.Duration
+	// MaxConnectionAgeGrace is how long in-flight streams are given to
+	// finish after a connection reaches its maximum age.
+	MaxConnectionAgeGrace time.Duration
+	// MinPingInterval is the minimum interval clients may send keepalive
+	// pings at. Clients pinging more often are disconnected. Pings are
+	// permitted on connections without active streams.
+	MinPingInterval time.Duration
+}
+
+// serverOptions returns the gRPC server options for the keepalive settings.
+func (o KeepaliveOptions) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if o.MaxConnectionIdle > 0 || o.MaxConnectionAge > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     o.MaxConnectionIdle,
+			MaxConnectionAge:      o.MaxConnectionAge,
+			MaxConnectionAgeGrace: o.MaxConnectionAgeGrace,
+		}))
+	}
+	if o.MinPingInterval > 0 {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             o.MinPingInterval,
+			PermitWithoutStream: true,
+		}))
+	}
+	return opts
+}
@@ -20,6 +20,8 @@ package leaderproxy
 import (
 	"io"
 	"log/slog"
+	"strconv"
+	"sync"
 
 	v1 "github.com/webmeshproj/api/go/v1"
 	"google.golang.org/grpc"
@@ -30,16 +32,28 @@ import (
 
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport"
+	"github.com/webmeshproj/webmesh/pkg/services/meshapi"
 	"github.com/webmeshproj/webmesh/pkg/storage"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
 // Interceptor is the leaderproxy interceptor.
 type Interceptor struct {
-	nodeID    types.NodeID
-	consensus storage.Consensus
-	dialer    Dialer
-	network   context.Network
+	nodeID     types.NodeID
+	consensus  storage.Consensus
+	dialer     Dialer
+	network    context.Network
+	leaderConn *leaderConn
+	closed     bool
+	leadermu   sync.Mutex
+}
+
+// leaderConn is a connection to the leader shared by proxied calls. It is
+// only closed once it has been replaced and the last call using it is done.
+type leaderConn struct {
+	transport.RPCClientConn
+	refs  int
+	stale bool
 }
 
 // Dialer is the interface required for the leader proxy interceptor.
@@ -128,12 +142,101 @@ func (i *Interceptor) StreamInterceptor() grpc.StreamServerInterceptor {
 	}
 }
 
+// InvalidateLeader drops the cached connection to the leader. The next proxied
+// request will look up and dial the current leader. Calls still using the old
+// connection are allowed to finish before it is closed. This should be called
+// whenever a leadership change is observed.
+func (i *Interceptor) InvalidateLeader() {
+	i.leadermu.Lock()
+	defer i.leadermu.Unlock()
+	i.dropLeaderConn()
+}
+
+// Close drops the cached connection to the leader and stops new requests from
+// being proxied. The connection is closed once any in-flight calls are done.
+func (i *Interceptor) Close() error {
+	i.leadermu.Lock()
+	defer i.leadermu.Unlock()
+	i.closed = true
+	i.dropLeaderConn()
+	return nil
+}
+
+// getLeaderConn returns the cached connection to the leader, dialing
+// the current leader if there isn't one. The connection must be released
+// with releaseLeaderConn when the call is done.
+func (i *Interceptor) getLeaderConn(ctx context.Context) (*leaderConn, error) {
+	i.leadermu.Lock()
+	defer i.leadermu.Unlock()
+	if i.closed {
+		return nil, status.Error(codes.Unavailable, "leader proxy is closed")
+	}
+	if i.leaderConn == nil {
+		conn, err := i.dialer.DialLeader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		i.leaderConn = &leaderConn{RPCClientConn: conn}
+	}
+	i.leaderConn.refs++
+	return i.leaderConn, nil
+}
+
+// releaseLeaderConn releases a connection returned by getLeaderConn, closing
+// it if it was replaced and this was the last call using it.
+func (i *Interceptor) releaseLeaderConn(conn *leaderConn) {
+	i.leadermu.Lock()
+	defer i.leadermu.Unlock()
+	conn.refs--
+	if conn.stale && conn.refs == 0 {
+		_ = conn.Close()
+	}
+}
+
+// checkLeaderErr drops the cached leader connection if the given error means
+// the connection failed or the remote node is no longer the leader.
+func (i *Interceptor) checkLeaderErr(ctx context.Context, conn *leaderConn, err error) {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.FailedPrecondition:
+	default:
+		return
+	}
+	i.leadermu.Lock()
+	defer i.leadermu.Unlock()
+	if i.leaderConn == conn {
+		context.LoggerFrom(ctx).Debug("Dropping cached leader connection", slog.String("error", err.Error()))
+		i.dropLeaderConn()
+	}
+}
+
+// dropLeaderConn marks the cached connection as stale so that it is not handed
+// out again, closing it right away if no calls are using it. Must be called
+// with leadermu held.
+func (i *Interceptor) dropLeaderConn() {
+	if i.leaderConn == nil {
+		return
+	}
+	i.leaderConn.stale = true
+	if i.leaderConn.refs == 0 {
+		_ = i.leaderConn.Close()
+	}
+	i.leaderConn = nil
+}
+
 func (i *Interceptor) proxyUnaryToLeader(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
-	conn, err := i.dialer.DialLeader(ctx)
+	conn, err := i.getLeaderConn(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
+	defer i.releaseLeaderConn(conn)
+	resp, err := i.callLeader(ctx, conn, req, info)
+	if err != nil {
+		i.checkLeaderErr(ctx, conn, err)
+	}
+	return resp, err
+}
+
+func (i *Interceptor) callLeader(ctx context.Context, conn transport.RPCClientConn, req any, info *grpc.UnaryServerInfo) (any, error) {
 	ctx = metadata.AppendToOutgoingContext(ctx, ProxiedFromMeta, i.nodeID.String())
 	if peer, ok := context.AuthenticatedCallerFrom(ctx); ok {
 		ctx = metadata.AppendToOutgoingContext(ctx, ProxiedForMeta, peer)
@@ -141,8 +244,20 @@ func (i *Interceptor) proxyUnaryToLeader(ctx context.Context, req any, info *grp
 	switch info.FullMethod {
 	// Membership API
 	case v1.Membership_Join_FullMethodName:
+		if token, ok := JoinToken(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, JoinTokenMeta, token)
+		}
+		if v, ok := NodeVersion(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, NodeVersionMeta, v)
+		}
 		return v1.NewMembershipClient(conn).Join(ctx, req.(*v1.JoinRequest))
 	case v1.Membership_Update_FullMethodName:
+		if count, ok, _ := SecondaryIPs(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, SecondaryIPsMeta, strconv.Itoa(count))
+		}
+		if Demote(ctx) {
+			ctx = metadata.AppendToOutgoingContext(ctx, DemoteMeta, "true")
+		}
 		return v1.NewMembershipClient(conn).Update(ctx, req.(*v1.UpdateRequest))
 	case v1.Membership_Leave_FullMethodName:
 		return v1.NewMembershipClient(conn).Leave(ctx, req.(*v1.LeaveRequest))
@@ -165,7 +280,16 @@ func (i *Interceptor) proxyUnaryToLeader(ctx context.Context, req any, info *grp
 	case v1.Mesh_GetNode_FullMethodName:
 		return v1.NewMeshClient(conn).GetNode(ctx, req.(*v1.GetNodeRequest))
 	case v1.Mesh_ListNodes_FullMethodName:
-		return v1.NewMeshClient(conn).ListNodes(ctx, req.(*emptypb.Empty))
+		opts, err := meshapi.ListNodesOptionsFromContext(ctx)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		var header metadata.MD
+		resp, err := v1.NewMeshClient(conn).ListNodes(opts.AppendToOutgoingContext(ctx), req.(*emptypb.Empty), grpc.Header(&header))
+		if err == nil && len(header.Get(meshapi.NextPageTokenMeta)) > 0 {
+			err = grpc.SetHeader(ctx, metadata.Pairs(meshapi.NextPageTokenMeta, header.Get(meshapi.NextPageTokenMeta)[0]))
+		}
+		return resp, err
 	case v1.Mesh_GetMeshGraph_FullMethodName:
 		return v1.NewMeshClient(conn).GetMeshGraph(ctx, req.(*emptypb.Empty))
 
@@ -207,6 +331,9 @@ func (i *Interceptor) proxyUnaryToLeader(ctx context.Context, req any, info *grp
 		return v1.NewAdminClient(conn).ListNetworkACLs(ctx, req.(*emptypb.Empty))
 
 	case v1.Admin_PutRoute_FullMethodName:
+		if ForceRoute(ctx) {
+			ctx = metadata.AppendToOutgoingContext(ctx, ForceRouteMeta, "true")
+		}
 		return v1.NewAdminClient(conn).PutRoute(ctx, req.(*v1.Route))
 	case v1.Admin_DeleteRoute_FullMethodName:
 		return v1.NewAdminClient(conn).DeleteRoute(ctx, req.(*v1.Route))
@@ -230,11 +357,19 @@ func (i *Interceptor) proxyUnaryToLeader(ctx context.Context, req any, info *grp
 }
 
 func (i *Interceptor) proxyStreamToLeader(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-	conn, err := i.dialer.DialLeader(ss.Context())
+	conn, err := i.getLeaderConn(ss.Context())
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer i.releaseLeaderConn(conn)
+	err = i.streamLeader(conn, ss, info)
+	if err != nil {
+		i.checkLeaderErr(ss.Context(), conn, err)
+	}
+	return err
+}
+
+func (i *Interceptor) streamLeader(conn transport.RPCClientConn, ss grpc.ServerStream, info *grpc.StreamServerInfo) error {
 	ctx := metadata.AppendToOutgoingContext(ss.Context(), ProxiedFromMeta, i.nodeID.String())
 	if peer, ok := context.AuthenticatedCallerFrom(ctx); ok {
 		ctx = metadata.AppendToOutgoingContext(ctx, ProxiedForMeta, peer)
@@ -0,0 +1,201 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderproxy
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/transport"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+)
+
+func TestLeaderConnectionCache(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	leader1 := newTestLeader(t)
+	leader2 := newTestLeader(t)
+	dialer := &testDialer{addr: leader1.addr}
+	proxy := New("follower", &testConsensus{}, dialer, nil)
+	interceptor := proxy.UnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: v1.Admin_PutRole_FullMethodName}
+	handler := func(ctx context.Context, req any) (any, error) {
+		t.Fatal("request should have been proxied to the leader")
+		return nil, nil
+	}
+	putRole := func() {
+		t.Helper()
+		_, err := interceptor(ctx, &v1.Role{Name: "test-role"}, info, handler)
+		if err != nil {
+			t.Fatalf("proxy request: %v", err)
+		}
+	}
+
+	// Repeated requests should reuse the same leader connection.
+	for i := 0; i < 3; i++ {
+		putRole()
+	}
+	if dials := dialer.dials.Load(); dials != 1 {
+		t.Fatalf("expected 1 leader dial, got %d", dials)
+	}
+	if calls := leader1.calls.Load(); calls != 3 {
+		t.Fatalf("expected 3 calls to leader, got %d", calls)
+	}
+
+	// A leadership change should cause the new leader to be dialed.
+	dialer.setAddr(leader2.addr)
+	proxy.InvalidateLeader()
+	putRole()
+	putRole()
+	if dials := dialer.dials.Load(); dials != 2 {
+		t.Fatalf("expected 2 leader dials after leader change, got %d", dials)
+	}
+	if calls := leader2.calls.Load(); calls != 2 {
+		t.Fatalf("expected 2 calls to new leader, got %d", calls)
+	}
+	if calls := leader1.calls.Load(); calls != 3 {
+		t.Fatalf("expected no more calls to old leader, got %d", calls)
+	}
+}
+
+func TestLeaderConnectionDrain(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	leader := newTestLeader(t)
+	leader.started = make(chan struct{})
+	leader.release = make(chan struct{})
+	dialer := &testDialer{addr: leader.addr}
+	proxy := New("follower", &testConsensus{}, dialer, nil)
+	interceptor := proxy.UnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: v1.Admin_PutRole_FullMethodName}
+	handler := func(ctx context.Context, req any) (any, error) {
+		t.Fatal("request should have been proxied to the leader")
+		return nil, nil
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := interceptor(ctx, &v1.Role{Name: "test-role"}, info, handler)
+		errs <- err
+	}()
+	<-leader.started
+
+	// Dropping the leader connection must not interrupt the in-flight call.
+	proxy.InvalidateLeader()
+	close(leader.release)
+	if err := <-errs; err != nil {
+		t.Fatalf("expected in-flight call to complete, got: %v", err)
+	}
+	conn := dialer.lastConn()
+	if state := conn.GetState(); state != connectivity.Shutdown {
+		t.Fatalf("expected stale leader connection to be closed after the call, got state %s", state)
+	}
+
+	// Closing the proxy closes the cached connection and refuses new calls.
+	if _, err := interceptor(ctx, &v1.Role{Name: "test-role"}, info, handler); err != nil {
+		t.Fatalf("proxy request: %v", err)
+	}
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("close proxy: %v", err)
+	}
+	if state := dialer.lastConn().GetState(); state != connectivity.Shutdown {
+		t.Fatalf("expected leader connection to be closed, got state %s", state)
+	}
+	if _, err := interceptor(ctx, &v1.Role{Name: "test-role"}, info, handler); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected closed proxy to refuse requests, got: %v", err)
+	}
+}
+
+type testLeader struct {
+	v1.UnimplementedAdminServer
+	addr    string
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func newTestLeader(t *testing.T) *testLeader {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader := &testLeader{addr: lis.Addr().String()}
+	srv := grpc.NewServer()
+	v1.RegisterAdminServer(srv, leader)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return leader
+}
+
+func (l *testLeader) PutRole(context.Context, *v1.Role) (*emptypb.Empty, error) {
+	if l.calls.Add(1) == 1 && l.started != nil {
+		close(l.started)
+		<-l.release
+	}
+	return &emptypb.Empty{}, nil
+}
+
+type testDialer struct {
+	transport.NodeDialer
+	addr  string
+	dials atomic.Int32
+	conn  *grpc.ClientConn
+	mu    sync.Mutex
+}
+
+func (d *testDialer) lastConn() *grpc.ClientConn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.conn
+}
+
+func (d *testDialer) setAddr(addr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addr = addr
+}
+
+func (d *testDialer) DialLeader(ctx context.Context) (transport.RPCClientConn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dials.Add(1)
+	conn, err := grpc.DialContext(ctx, d.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	d.conn = conn
+	return conn, nil
+}
+
+type testConsensus struct {
+	storage.Consensus
+}
+
+func (c *testConsensus) IsLeader() bool { return false }
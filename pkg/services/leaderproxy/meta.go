@@ -18,10 +18,20 @@ package leaderproxy
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 
 	"google.golang.org/grpc/metadata"
 )
 
+// Metadata keys extend the RPCs of the external webmesh API without changing
+// its protos. A key set on a request asks for an option the request messages
+// have no field for, and results are returned in response headers, with JSON
+// encoded values under keys ending in "-bin". The keys below are set or carried
+// along by the leader proxy. Keys only served by a single node are
+// declared next to the service that reads them, such as the node service's
+// connectivity test and relay session keys, the mesh API's ListNodes options
+// and the storage service's raft log subscription.
 const (
 	// PreferLeaderMeta is the metadata key for the Prefer-Leader header.
 	PreferLeaderMeta = "x-webmesh-prefer-leader"
@@ -29,6 +39,19 @@ const (
 	ProxiedFromMeta = "x-webmesh-proxied-from"
 	// ProxiedForMeta is the metadata key for the Proxied-For header.
 	ProxiedForMeta = "x-webmesh-proxied-for"
+	// JoinTokenMeta is the metadata key for a join token presented by a joining node.
+	JoinTokenMeta = "x-webmesh-join-token"
+	// NodeVersionMeta is the metadata key for the version of a joining node.
+	NodeVersionMeta = "x-webmesh-node-version"
+	// SecondaryIPsMeta is the metadata key for the number of secondary IPv4
+	// addresses a node is requesting in an update.
+	SecondaryIPsMeta = "x-webmesh-secondary-ips"
+	// ForceRouteMeta is the metadata key for skipping the check of a route's
+	// destinations against the mesh networks when putting a route.
+	ForceRouteMeta = "x-webmesh-force-route"
+	// DemoteMeta is the metadata key for an update asking to demote a voter
+	// in the storage consensus to an observer.
+	DemoteMeta = "x-webmesh-demote"
 )
 
 // HasPreferLeaderMeta returns true if the context has the Prefer-Leader header set to true.
@@ -66,3 +89,66 @@ func ProxiedFor(ctx context.Context) (string, bool) {
 	}
 	return "", false
 }
+
+// JoinToken returns the join token presented with the request, if any.
+func JoinToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		token := md.Get(JoinTokenMeta)
+		if len(token) > 0 && token[0] != "" {
+			return token[0], true
+		}
+	}
+	return "", false
+}
+
+// NodeVersion returns the version of the node sending the request, if it was provided.
+func NodeVersion(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		v := md.Get(NodeVersionMeta)
+		if len(v) > 0 && v[0] != "" {
+			return v[0], true
+		}
+	}
+	return "", false
+}
+
+// SecondaryIPs returns the number of secondary IPv4 addresses requested with the
+// update, if any.
+func SecondaryIPs(ctx context.Context) (int, bool, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0, false, nil
+	}
+	v := md.Get(SecondaryIPsMeta)
+	if len(v) == 0 || v[0] == "" {
+		return 0, false, nil
+	}
+	count, err := strconv.Atoi(v[0])
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s: %w", SecondaryIPsMeta, err)
+	}
+	return count, true, nil
+}
+
+// ForceRoute returns true if the request asks to skip checking route
+// destinations against the mesh networks.
+func ForceRoute(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	force := md.Get(ForceRouteMeta)
+	return len(force) > 0 && force[0] == "true"
+}
+
+// Demote returns true if the update asks to demote the node to an observer.
+func Demote(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	demote := md.Get(DemoteMeta)
+	return len(demote) > 0 && demote[0] == "true"
+}
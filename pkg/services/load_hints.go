@@ -0,0 +1,102 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/stats"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// DefaultLoadHintInterval is the default interval for publishing load hints.
+const DefaultLoadHintInterval = 30 * time.Second
+
+// LoadHintOptions are options for periodically publishing a load hint for
+// this node to the mesh storage.
+type LoadHintOptions struct {
+	// NodeID is the ID of this node.
+	NodeID types.NodeID
+	// Storage is the storage to publish hints to.
+	Storage storage.MeshStorage
+	// Interval is how often to publish the hint. Hints expire after three
+	// intervals without an update. Defaults to DefaultLoadHintInterval.
+	Interval time.Duration
+}
+
+// ActiveConnections returns the number of open connections to the gRPC server.
+func (s *Server) ActiveConnections() int {
+	return int(s.conns.active.Load())
+}
+
+// runLoadHints publishes a load hint every interval until the context is canceled.
+func (s *Server) runLoadHints(ctx context.Context, opts LoadHintOptions) {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultLoadHintInterval
+	}
+	publish := func() {
+		hint := storage.LoadHint{
+			NodeID:      opts.NodeID,
+			Connections: s.ActiveConnections(),
+			UpdatedAt:   time.Now().UTC(),
+		}
+		if err := storage.PutLoadHint(ctx, opts.Storage, hint, 3*interval); err != nil {
+			s.log.Warn("Failed to publish load hint", slog.String("error", err.Error()))
+		}
+	}
+	publish()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			publish()
+		}
+	}
+}
+
+// connCounter is a gRPC stats handler that tracks open connections.
+type connCounter struct {
+	active atomic.Int64
+}
+
+func (c *connCounter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (c *connCounter) HandleRPC(context.Context, stats.RPCStats) {}
+
+func (c *connCounter) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (c *connCounter) HandleConn(_ context.Context, st stats.ConnStats) {
+	switch st.(type) {
+	case *stats.ConnBegin:
+		c.active.Add(1)
+	case *stats.ConnEnd:
+		c.active.Add(-1)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"log/slog"
+	"runtime"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// DefaultJoinRetryAfter is the default retry hint given to nodes whose join
+// was rejected because this node is overloaded.
+const DefaultJoinRetryAfter = 5 * time.Second
+
+// loadSignals are the signals used to decide if this node has the capacity
+// to process a join.
+type loadSignals struct {
+	// applyLag is the number of committed log entries not yet applied.
+	applyLag uint64
+	// goroutines is the number of running goroutines.
+	goroutines int
+}
+
+// applyLagReporter is implemented by storage providers that can report
+// how far their applied index trails the commit index.
+type applyLagReporter interface {
+	ApplyLag() uint64
+}
+
+// currentLoad returns the current load signals for this node.
+func (s *Server) currentLoad() loadSignals {
+	signals := loadSignals{goroutines: runtime.NumGoroutine()}
+	if r, ok := s.storage.(applyLagReporter); ok {
+		signals.applyLag = r.ApplyLag()
+	}
+	return signals
+}
+
+// checkJoinCapacity returns an Unavailable error carrying a retry hint when
+// the load on this node exceeds any of the configured thresholds.
+func (s *Server) checkJoinCapacity() error {
+	if s.maxJoinApplyLag == 0 && s.maxJoinGoroutines == 0 {
+		return nil
+	}
+	load := s.loadFunc()
+	var reason string
+	switch {
+	case s.maxJoinApplyLag > 0 && load.applyLag > s.maxJoinApplyLag:
+		reason = "applied index is lagging"
+	case s.maxJoinGoroutines > 0 && load.goroutines > s.maxJoinGoroutines:
+		reason = "too many goroutines"
+	default:
+		return nil
+	}
+	s.log.Warn("Rejecting join, node is overloaded",
+		slog.String("reason", reason),
+		slog.Uint64("apply-lag", load.applyLag),
+		slog.Int("goroutines", load.goroutines),
+	)
+	st := status.Newf(codes.Unavailable, "node is overloaded (%s), retry after %s", reason, s.joinRetryAfter)
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(s.joinRetryAfter),
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
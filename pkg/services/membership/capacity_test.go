@@ -0,0 +1,100 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+)
+
+func TestJoinCapacity(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name     string
+		load     loadSignals
+		rejected bool
+	}{
+		{name: "UnderThresholds", load: loadSignals{applyLag: 10, goroutines: 100}},
+		{name: "ApplyLagExceeded", load: loadSignals{applyLag: 11, goroutines: 100}, rejected: true},
+		{name: "GoroutinesExceeded", load: loadSignals{applyLag: 0, goroutines: 101}, rejected: true},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			node, err := meshnode.NewSingleNodeTestMesh(ctx)
+			if err != nil {
+				t.Fatalf("create test mesh: %v", err)
+			}
+			t.Cleanup(func() { node.Close(ctx) })
+			plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+			if err != nil {
+				t.Fatalf("create plugin manager: %v", err)
+			}
+			srv := NewServer(ctx, Options{
+				NodeID:            node.ID(),
+				Storage:           node.Storage(),
+				Plugins:           plugs,
+				RBAC:              rbac.NewNoopEvaluator(),
+				Meshnet:           node.Network(),
+				MaxJoinApplyLag:   10,
+				MaxJoinGoroutines: 100,
+				JoinRetryAfter:    3 * time.Second,
+			})
+			srv.loadFunc = func() loadSignals { return tt.load }
+			_, err = srv.Join(ctx, &v1.JoinRequest{
+				Id:         "joining-node",
+				PublicKey:  newEncodedPubKey(t),
+				AssignIPv4: true,
+			})
+			if !tt.rejected {
+				if err != nil {
+					t.Fatalf("expected join to succeed, got %v", err)
+				}
+				return
+			}
+			st, _ := status.FromError(err)
+			if st.Code() != codes.Unavailable {
+				t.Fatalf("expected Unavailable, got %v", err)
+			}
+			var hint *errdetails.RetryInfo
+			for _, detail := range st.Details() {
+				if info, ok := detail.(*errdetails.RetryInfo); ok {
+					hint = info
+				}
+			}
+			if hint == nil {
+				t.Fatal("expected a retry hint in the error details")
+			}
+			if got := hint.GetRetryDelay().AsDuration(); got != 3*time.Second {
+				t.Fatalf("expected a retry delay of 3s, got %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// EndpointProbeMode controls how the membership server treats joining nodes
+// whose primary endpoint cannot be reached.
+type EndpointProbeMode string
+
+const (
+	// EndpointProbeDisabled disables reachability probes of joined nodes.
+	EndpointProbeDisabled EndpointProbeMode = ""
+	// EndpointProbeWarn logs a warning for nodes whose endpoint does not become
+	// reachable shortly after they join.
+	EndpointProbeWarn EndpointProbeMode = "warn"
+	// EndpointProbeStrict removes nodes whose endpoint does not become reachable
+	// shortly after they join from the mesh. Storage members are only logged.
+	EndpointProbeStrict EndpointProbeMode = "strict"
+)
+
+// DefaultEndpointProbeTimeout is the default timeout for a single reachability probe.
+const DefaultEndpointProbeTimeout = 3 * time.Second
+
+// DefaultEndpointProbeWindow is how long a joined node is given to start serving
+// on its advertised ports before it is reported as unreachable.
+const DefaultEndpointProbeWindow = 30 * time.Second
+
+// IsValid returns true if the mode is a known probe mode.
+func (m EndpointProbeMode) IsValid() bool {
+	switch m {
+	case EndpointProbeDisabled, EndpointProbeWarn, EndpointProbeStrict:
+		return true
+	}
+	return false
+}
+
+// endpointProbeTarget returns the address to probe for a join request. WireGuard
+// gives no response to unauthenticated traffic, so the probe targets the primary
+// endpoint on the gRPC port the node advertises the node API on. Other features
+// may be served over UDP only. Nodes only start serving on that port once the
+// join completes, so the probe is run in the background after the join. False
+// is returned if the node has no primary endpoint or does not advertise the
+// node API.
+func endpointProbeTarget(req *v1.JoinRequest) (netip.AddrPort, bool) {
+	if req.GetPrimaryEndpoint() == "" {
+		return netip.AddrPort{}, false
+	}
+	addr, err := netip.ParseAddr(req.GetPrimaryEndpoint())
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	for _, feat := range req.GetFeatures() {
+		if feat.GetFeature() == v1.Feature_NODES && feat.GetPort() > 0 && feat.GetPort() <= 65535 {
+			return netip.AddrPortFrom(addr, uint16(feat.GetPort())), true
+		}
+	}
+	return netip.AddrPort{}, false
+}
+
+// awaitEndpoint probes the given address until it accepts a connection or the
+// window has passed, returning the last error in the latter case.
+func awaitEndpoint(ctx context.Context, addr netip.AddrPort, timeout, window time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+	for {
+		err := probeEndpoint(ctx, addr, timeout)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// probeJoinedEndpoint warns if the primary endpoint of a joined node does not
+// become reachable within the probe window, and removes the node in strict mode.
+func (s *Server) probeJoinedEndpoint(req *v1.JoinRequest, addr netip.AddrPort) {
+	ctx := context.WithLogger(context.Background(), s.log)
+	err := awaitEndpoint(ctx, addr, s.probeTimeout, s.probeWindow)
+	if err == nil {
+		return
+	}
+	s.log.Warn("Primary endpoint of joined node is unreachable",
+		slog.String("node", req.GetId()),
+		slog.String("endpoint", addr.String()),
+		slog.String("error", err.Error()))
+	if s.probeMode != EndpointProbeStrict {
+		return
+	}
+	if err := s.evictUnreachable(ctx, req); err != nil {
+		s.log.Warn("Failed to remove unreachable node",
+			slog.String("node", req.GetId()),
+			slog.String("error", err.Error()))
+	}
+}
+
+// evictUnreachable removes a node that joined with the given request after its
+// endpoint was found unreachable. Nodes that have since rejoined with another
+// key and members of the storage consensus are left in place.
+func (s *Server) evictUnreachable(ctx context.Context, req *v1.JoinRequest) error {
+	if !s.storage.Consensus().IsLeader() {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node, err := s.storage.MeshDB().Peers().Get(ctx, types.NodeID(req.GetId()))
+	if err != nil {
+		if errors.IsNodeNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if node.GetPublicKey() != req.GetPublicKey() {
+		return nil
+	}
+	if s.storage.Consensus().IsMember() {
+		members, err := s.storage.Consensus().GetPeers(ctx)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			if member.GetId() == req.GetId() {
+				s.log.Warn("Not removing unreachable storage member", slog.String("node", req.GetId()))
+				return nil
+			}
+		}
+	}
+	s.log.Info("Removing node with unreachable endpoint", slog.String("node", req.GetId()))
+	return s.removeNode(ctx, node)
+}
+
+// probeEndpoint attempts a TCP connection to the given address.
+func probeEndpoint(ctx context.Context, addr netip.AddrPort, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr.String())
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", addr, err)
+	}
+	return conn.Close()
+}
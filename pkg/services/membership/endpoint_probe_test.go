@@ -0,0 +1,188 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+)
+
+func TestJoinEndpointProbe(t *testing.T) {
+	t.Parallel()
+
+	// Grab a free port and close it so nothing is listening there.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closedPort := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	// And keep one open for nodes that are reachable.
+	open, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { open.Close() })
+	openPort := open.Addr().(*net.TCPAddr).Port
+
+	tc := []struct {
+		name    string
+		mode    EndpointProbeMode
+		port    int
+		removed bool
+	}{
+		{name: "Disabled", mode: EndpointProbeDisabled, port: closedPort},
+		{name: "Warn", mode: EndpointProbeWarn, port: closedPort},
+		{name: "StrictUnreachable", mode: EndpointProbeStrict, port: closedPort, removed: true},
+		{name: "StrictReachable", mode: EndpointProbeStrict, port: openPort},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			node, err := meshnode.NewSingleNodeTestMesh(ctx)
+			if err != nil {
+				t.Fatalf("create test mesh: %v", err)
+			}
+			t.Cleanup(func() { node.Close(ctx) })
+			plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+			if err != nil {
+				t.Fatalf("create plugin manager: %v", err)
+			}
+			srv := NewServer(ctx, Options{
+				NodeID:               node.ID(),
+				Storage:              node.Storage(),
+				Plugins:              plugs,
+				RBAC:                 rbac.NewNoopEvaluator(),
+				Meshnet:              node.Network(),
+				EndpointProbe:        tt.mode,
+				EndpointProbeTimeout: time.Second,
+				EndpointProbeWindow:  time.Second,
+			})
+			_, err = srv.Join(ctx, &v1.JoinRequest{
+				Id:              "unreachable-node",
+				PublicKey:       newEncodedPubKey(t),
+				AssignIPv4:      true,
+				PrimaryEndpoint: "127.0.0.1",
+				Features: []*v1.FeaturePort{
+					{Feature: v1.Feature_NODES, Port: int32(tt.port)},
+				},
+			})
+			// Nodes only serve on their ports once joined, so an
+			// unreachable endpoint must never fail the join.
+			if err != nil {
+				t.Fatalf("expected join to succeed, got %v", err)
+			}
+			// Give the probe its window and then some to act.
+			time.Sleep(3 * time.Second)
+			_, err = node.Storage().MeshDB().Peers().Get(ctx, "unreachable-node")
+			if tt.removed && !errors.IsNodeNotFound(err) {
+				t.Fatalf("expected the unreachable node to be removed, got %v", err)
+			}
+			if !tt.removed && err != nil {
+				t.Fatalf("expected the node to remain, got %v", err)
+			}
+		})
+	}
+
+	t.Run("ProbeTarget", func(t *testing.T) {
+		t.Parallel()
+		req := &v1.JoinRequest{
+			PrimaryEndpoint: "127.0.0.1",
+			Features: []*v1.FeaturePort{
+				{Feature: v1.Feature_TURN_SERVER, Port: 3478},
+				{Feature: v1.Feature_NODES, Port: 8443},
+			},
+		}
+		target, ok := endpointProbeTarget(req)
+		if !ok || target != netip.MustParseAddrPort("127.0.0.1:8443") {
+			t.Fatalf("expected the node API port to be probed, got %v", target)
+		}
+	})
+
+	t.Run("NoProbeTarget", func(t *testing.T) {
+		t.Parallel()
+		req := &v1.JoinRequest{PrimaryEndpoint: "127.0.0.1"}
+		if _, ok := endpointProbeTarget(req); ok {
+			t.Fatal("expected no probe target without advertised ports")
+		}
+		req.Features = []*v1.FeaturePort{{Feature: v1.Feature_MESH_DNS, Port: 53}}
+		if _, ok := endpointProbeTarget(req); ok {
+			t.Fatal("expected no probe target without the node API")
+		}
+	})
+}
+
+func TestAwaitEndpoint(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("LateListener", func(t *testing.T) {
+		t.Parallel()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		addr := l.Addr().String()
+		l.Close()
+		// Start listening again after the first probe has failed, the way a
+		// joined node starts its servers after the join completes.
+		errs := make(chan error, 1)
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				errs <- err
+				return
+			}
+			t.Cleanup(func() { l.Close() })
+			errs <- nil
+		}()
+		err = awaitEndpoint(ctx, netip.MustParseAddrPort(addr), time.Second, 5*time.Second)
+		if lerr := <-errs; lerr != nil {
+			t.Skipf("could not re-listen on %s: %v", addr, lerr)
+		}
+		if err != nil {
+			t.Fatalf("expected endpoint to become reachable, got %v", err)
+		}
+	})
+
+	t.Run("NeverReachable", func(t *testing.T) {
+		t.Parallel()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		addr := l.Addr().String()
+		l.Close()
+		err = awaitEndpoint(ctx, netip.MustParseAddrPort(addr), time.Second, time.Second)
+		if err == nil {
+			t.Fatal("expected error for unreachable endpoint")
+		}
+	})
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// DefaultHeartbeatSyncInterval is the default interval at which heartbeats
+// recorded by the leader are written to storage.
+const DefaultHeartbeatSyncInterval = 30 * time.Second
+
+// isHeartbeat returns true if the update request only carries the ID of the
+// caller. Nodes send these periodically as heartbeats.
+func isHeartbeat(req *v1.UpdateRequest) bool {
+	return req.GetId() != "" && proto.Equal(req, &v1.UpdateRequest{Id: req.GetId()})
+}
+
+// heartbeatTracker holds heartbeats received by the leader until they are
+// written to storage in a single batch.
+type heartbeatTracker struct {
+	beats    map[types.NodeID]time.Time
+	dirty    bool
+	lastSync time.Time
+	mu       sync.Mutex
+}
+
+// Heartbeat records that the given node is alive. Heartbeats are kept in memory
+// on the leader and written to storage at most once per sync interval, so a
+// large mesh heartbeating continuously costs a single write per interval rather
+// than one per heartbeat. Nodes may only send heartbeats for themselves, see
+// callerIsNode.
+func (s *Server) Heartbeat(ctx context.Context, id types.NodeID) error {
+	if !s.storage.Consensus().IsLeader() {
+		return status.Errorf(codes.FailedPrecondition, "not leader")
+	}
+	if id == "" {
+		return status.Error(codes.InvalidArgument, "node id required")
+	} else if !types.IsValidNodeID(id.String()) {
+		return status.Error(codes.InvalidArgument, "node id is invalid")
+	}
+	node, err := s.storage.MeshDB().Peers().Get(ctx, id)
+	if err != nil {
+		if errors.IsNodeNotFound(err) {
+			return status.Errorf(codes.NotFound, "node %s not found", id)
+		}
+		return status.Errorf(codes.Internal, "failed to lookup peer: %v", err)
+	}
+	if !s.callerIsNode(ctx, node) {
+		return status.Errorf(codes.PermissionDenied, "heartbeat for node %s does not come from that node", id)
+	}
+	now := time.Now().UTC()
+	s.heartbeats.mu.Lock()
+	s.heartbeats.beats[id] = now
+	s.heartbeats.dirty = true
+	s.heartbeats.mu.Unlock()
+	if err := s.syncHeartbeats(ctx, now, false); err != nil {
+		// The heartbeat is still held in memory and retried on the next sync.
+		s.log.Warn("Failed to sync heartbeats", slog.String("error", err.Error()))
+	}
+	return nil
+}
+
+// callerIsNode returns true if the request in the context was made by the given
+// node. With authentication enabled the authenticated caller must be the node.
+// Otherwise the request must come directly from one of the node's mesh
+// addresses, which WireGuard only accepts from the node's key.
+func (s *Server) callerIsNode(ctx context.Context, node types.MeshNode) bool {
+	if nodeIDMatchesContext(ctx, node.GetId()) {
+		return true
+	}
+	if s.plugins.HasAuth() {
+		return false
+	}
+	if _, ok := leaderproxy.ProxiedFrom(ctx); ok {
+		return false
+	}
+	addr, ok := context.PeerAddrFrom(ctx)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	return (node.PrivateAddrV4().IsValid() && addr == node.PrivateAddrV4().Addr()) ||
+		(node.PrivateAddrV6().IsValid() && addr == node.PrivateAddrV6().Addr())
+}
+
+// SyncHeartbeats immediately writes any heartbeats recorded since the last sync
+// to storage. It is called when the server is drained.
+func (s *Server) SyncHeartbeats(ctx context.Context) error {
+	return s.syncHeartbeats(ctx, time.Now().UTC(), true)
+}
+
+// LastHeartbeat returns the time of the last heartbeat from the given node.
+// The zero time is returned if the node has never sent one.
+func (s *Server) LastHeartbeat(ctx context.Context, id types.NodeID) (time.Time, error) {
+	s.heartbeats.mu.Lock()
+	last, ok := s.heartbeats.beats[id]
+	s.heartbeats.mu.Unlock()
+	if ok {
+		return last, nil
+	}
+	beats, err := storage.GetHeartbeats(ctx, s.storage.MeshStorage())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return beats[id], nil
+}
+
+// runHeartbeatSync writes recorded heartbeats to storage every sync interval
+// until the context is canceled, so that heartbeats are persisted even after
+// nodes stop sending them.
+func (s *Server) runHeartbeatSync(ctx context.Context) {
+	t := time.NewTicker(s.heartbeatSyncInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			if !s.storage.Consensus().IsLeader() {
+				continue
+			}
+			if err := s.syncHeartbeats(ctx, now.UTC(), false); err != nil {
+				s.log.Warn("Failed to sync heartbeats", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+func (s *Server) syncHeartbeats(ctx context.Context, now time.Time, force bool) error {
+	s.heartbeats.mu.Lock()
+	defer s.heartbeats.mu.Unlock()
+	if !s.heartbeats.dirty || (!force && now.Sub(s.heartbeats.lastSync) < s.heartbeatSyncInterval) {
+		return nil
+	}
+	stored, err := storage.GetHeartbeats(ctx, s.storage.MeshStorage())
+	if err != nil {
+		return err
+	}
+	// Merge with the stored heartbeats so those recorded by previous leaders are kept.
+	for id, last := range s.heartbeats.beats {
+		if last.After(stored[id]) {
+			stored[id] = last
+		}
+	}
+	if err := storage.PutHeartbeats(ctx, s.storage.MeshStorage(), stored); err != nil {
+		return err
+	}
+	s.heartbeats.dirty = false
+	s.heartbeats.lastSync = now
+	return nil
+}
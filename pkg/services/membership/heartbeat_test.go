@@ -0,0 +1,264 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestHeartbeat(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	st := &heartbeatWriteCounter{Provider: node.Storage()}
+	newServer := func() *Server {
+		return NewServer(ctx, Options{
+			NodeID:                node.ID(),
+			Storage:               st,
+			Plugins:               plugs,
+			RBAC:                  rbac.NewNoopEvaluator(),
+			Meshnet:               node.Network(),
+			HeartbeatSyncInterval: time.Hour,
+		})
+	}
+	srv := newServer()
+	t.Cleanup(func() { _ = srv.Drain(ctx) })
+	callerCtx := nodeCallerContext(t, ctx, node)
+
+	var last time.Time
+	for i := 0; i < 20; i++ {
+		if err := srv.Heartbeat(callerCtx, node.ID()); err != nil {
+			t.Fatalf("heartbeat: %v", err)
+		}
+		got, err := srv.LastHeartbeat(ctx, node.ID())
+		if err != nil {
+			t.Fatalf("get last heartbeat: %v", err)
+		}
+		if got.IsZero() || got.Before(last) {
+			t.Fatalf("expected heartbeat %d to advance liveness past %s, got %s", i, last, got)
+		}
+		last = got
+	}
+	// Only the first heartbeat falls outside the sync interval.
+	if writes := st.writes.Load(); writes != 1 {
+		t.Fatalf("expected a single heartbeat write for 20 heartbeats, got %d", writes)
+	}
+
+	// Forcing a sync persists the latest heartbeat for the next leader.
+	if err := srv.SyncHeartbeats(ctx); err != nil {
+		t.Fatalf("sync heartbeats: %v", err)
+	}
+	if writes := st.writes.Load(); writes != 2 {
+		t.Fatalf("expected forced sync to write heartbeats, got %d writes", writes)
+	}
+	next := newServer()
+	t.Cleanup(func() { _ = next.Drain(ctx) })
+	got, err := next.LastHeartbeat(ctx, node.ID())
+	if err != nil {
+		t.Fatalf("get last heartbeat: %v", err)
+	}
+	if !got.Equal(last) {
+		t.Fatalf("expected stored heartbeat %s, got %s", last, got)
+	}
+	if !types.IsReservedPrefix(storage.HeartbeatsKey) {
+		t.Fatalf("expected heartbeats key %s to be reserved", storage.HeartbeatsKey)
+	}
+
+	err = srv.Heartbeat(callerCtx, types.NodeID("unknown-node"))
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for unknown node, got %v", err)
+	}
+
+	// Nodes send heartbeats as update requests carrying only their ID.
+	if !isHeartbeat(&v1.UpdateRequest{Id: node.ID().String()}) {
+		t.Fatal("expected update with only an ID to be a heartbeat")
+	}
+	if isHeartbeat(&v1.UpdateRequest{Id: node.ID().String(), Routes: []string{"10.0.0.0/24"}}) {
+		t.Fatal("expected update with routes not to be a heartbeat")
+	}
+}
+
+func TestHeartbeatCaller(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	srv := NewServer(ctx, Options{
+		NodeID:  node.ID(),
+		Storage: node.Storage(),
+		Plugins: plugs,
+		RBAC:    rbac.NewNoopEvaluator(),
+		Meshnet: node.Network(),
+	})
+	t.Cleanup(func() { _ = srv.Drain(ctx) })
+
+	tc := []struct {
+		name    string
+		ctx     context.Context
+		allowed bool
+	}{
+		{
+			name:    "MeshAddress",
+			ctx:     nodeCallerContext(t, ctx, node),
+			allowed: true,
+		},
+		{
+			name:    "AuthenticatedCaller",
+			ctx:     context.WithAuthenticatedCaller(ctx, node.ID().String()),
+			allowed: true,
+		},
+		{
+			name:    "OtherAuthenticatedCaller",
+			ctx:     context.WithAuthenticatedCaller(ctx, "other-node"),
+			allowed: false,
+		},
+		{
+			name:    "OtherAddress",
+			ctx:     peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 443}}),
+			allowed: false,
+		},
+		{
+			name:    "Proxied",
+			ctx:     metadata.NewIncomingContext(nodeCallerContext(t, ctx, node), metadata.Pairs(leaderproxy.ProxiedFromMeta, "other-node")),
+			allowed: false,
+		},
+		{
+			name:    "NoPeer",
+			ctx:     ctx,
+			allowed: false,
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := srv.Heartbeat(tt.ctx, node.ID())
+			if tt.allowed && err != nil {
+				t.Fatalf("expected heartbeat to be accepted, got %v", err)
+			}
+			if !tt.allowed && status.Code(err) != codes.PermissionDenied {
+				t.Fatalf("expected PermissionDenied, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHeartbeatPeriodicSync(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	st := &heartbeatWriteCounter{Provider: node.Storage()}
+	srv := NewServer(ctx, Options{
+		NodeID:                node.ID(),
+		Storage:               st,
+		Plugins:               plugs,
+		RBAC:                  rbac.NewNoopEvaluator(),
+		Meshnet:               node.Network(),
+		HeartbeatSyncInterval: 200 * time.Millisecond,
+	})
+	t.Cleanup(func() { _ = srv.Drain(ctx) })
+	callerCtx := nodeCallerContext(t, ctx, node)
+	// The first heartbeat is written immediately, the second is held until
+	// the next sync even though no further heartbeats arrive.
+	for i := 0; i < 2; i++ {
+		if err := srv.Heartbeat(callerCtx, node.ID()); err != nil {
+			t.Fatalf("heartbeat: %v", err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for st.writes.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected periodic sync to write heartbeats, got %d writes", st.writes.Load())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// nodeCallerContext returns a context for a request made by the given node
+// from its mesh address.
+func nodeCallerContext(t *testing.T, ctx context.Context, node meshnode.Node) context.Context {
+	t.Helper()
+	self, err := node.Storage().MeshDB().Peers().Get(ctx, node.ID())
+	if err != nil {
+		t.Fatalf("get self: %v", err)
+	}
+	addr := netip.AddrPortFrom(self.PrivateAddrV6().Addr(), 443)
+	return peer.NewContext(ctx, &peer.Peer{Addr: net.TCPAddrFromAddrPort(addr)})
+}
+
+// heartbeatWriteCounter counts writes of the heartbeats key.
+type heartbeatWriteCounter struct {
+	storage.Provider
+	writes atomic.Int64
+}
+
+func (c *heartbeatWriteCounter) MeshStorage() storage.MeshStorage {
+	return &heartbeatStorage{MeshStorage: c.Provider.MeshStorage(), writes: &c.writes}
+}
+
+type heartbeatStorage struct {
+	storage.MeshStorage
+	writes *atomic.Int64
+}
+
+func (s *heartbeatStorage) PutValue(ctx context.Context, key, value []byte, ttl time.Duration) error {
+	if bytes.Equal(key, storage.HeartbeatsKey) {
+		s.writes.Add(1)
+	}
+	return s.MeshStorage.PutValue(ctx, key, value, ttl)
+}
@@ -32,11 +32,13 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/crypto"
 	"github.com/webmeshproj/webmesh/pkg/meshnet"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/netutil"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
 	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
 	"github.com/webmeshproj/webmesh/pkg/services/rbac"
 	"github.com/webmeshproj/webmesh/pkg/storage"
 	"github.com/webmeshproj/webmesh/pkg/storage/errors"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
+	"github.com/webmeshproj/webmesh/pkg/version"
 )
 
 var canVoteAction = &rbac.Action{
@@ -63,6 +65,9 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 	if !s.storage.Consensus().IsLeader() {
 		return nil, status.Errorf(codes.FailedPrecondition, "not leader")
 	}
+	if err := s.checkJoinCapacity(); err != nil {
+		return nil, err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	log := s.log.With("op", "join", "id", req.GetId())
@@ -81,6 +86,16 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 	} else if !types.IsValidNodeID(req.GetId()) {
 		return nil, status.Error(codes.InvalidArgument, "node id is invalid")
 	}
+	// Nodes that predate the version exchange do not report one.
+	if nodeVersion, ok := leaderproxy.NodeVersion(ctx); ok {
+		if err := version.CheckCompatible(s.version, nodeVersion); err != nil {
+			if !s.skipVersionCheck {
+				log.Warn("Rejecting join from node with incompatible version", slog.String("node-version", nodeVersion))
+				return nil, status.Errorf(codes.FailedPrecondition, "node version %s is not compatible with mesh version %s: %v", nodeVersion, s.version, err)
+			}
+			log.Warn("Allowing join from node with incompatible version", slog.String("node-version", nodeVersion), slog.String("error", err.Error()))
+		}
+	}
 
 	if s.plugins.HasAuth() {
 		if !nodeIDMatchesContext(ctx, req.GetId()) {
@@ -104,6 +119,11 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid public key: %v", err)
 	}
+	if s.validateFeatures {
+		if err := types.ValidateFeatures(req.GetFeatures()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid feature advertisement: %v", err)
+		}
+	}
 	var storagePort int32
 	if req.GetAsVoter() || req.GetAsObserver() {
 		for _, feat := range req.GetFeatures() {
@@ -117,6 +137,28 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 		}
 	}
 
+	// A join token replaces RBAC for the join, but only grants what is in its claims.
+	token, haveToken := leaderproxy.JoinToken(ctx)
+	var tokenClaims JoinTokenClaims
+	switch {
+	case haveToken:
+		if len(s.joinTokenSecret) == 0 {
+			return nil, status.Error(codes.FailedPrecondition, "join tokens are not enabled")
+		}
+		claims, err := ParseJoinToken(s.joinTokenSecret, token, time.Now())
+		if err != nil {
+			log.Warn("Rejecting join with invalid token", slog.String("error", err.Error()))
+			return nil, status.Errorf(codes.Unauthenticated, "join token: %v", err)
+		}
+		if err := claims.Permits(req); err != nil {
+			log.Warn("Join request exceeds token scope", slog.String("error", err.Error()))
+			return nil, status.Errorf(codes.PermissionDenied, "join token: %v", err)
+		}
+		tokenClaims = claims
+	case s.requireJoinToken:
+		return nil, status.Error(codes.Unauthenticated, "join token required")
+	}
+
 	// We can go ahead and check here if the node is allowed to do what
 	// they want.
 	var actions rbac.Actions
@@ -136,7 +178,7 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 			actions = append(actions, canPutEdgeAction.For(peer))
 		}
 	}
-	if len(actions) > 0 {
+	if len(actions) > 0 && !haveToken {
 		allowed, err := s.rbac.Evaluate(ctx, actions)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "failed to evaluate permissions: %v", err)
@@ -149,6 +191,16 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 		}
 	}
 
+	// Give plugins a chance to veto the join before anything is allocated.
+	if err := s.plugins.ApproveJoin(ctx, req); err != nil {
+		var denied *plugins.JoinDeniedError
+		if errors.As(err, &denied) {
+			log.Warn("Join denied by plugin", slog.String("plugin", denied.Plugin), slog.String("reason", denied.Reason))
+			return nil, status.Error(codes.PermissionDenied, denied.Error())
+		}
+		return nil, status.Errorf(codes.Internal, "failed to approve join: %v", err)
+	}
+
 	// Start building a list of clean up functions to run if we fail
 	cleanFuncs := make([]func(), 0)
 	handleErr := func(cause error) error {
@@ -158,6 +210,19 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 		return cause
 	}
 
+	// Tokens are single use. Record this one before allocating anything and
+	// release it again if the join fails.
+	if haveToken {
+		release, err := s.consumeJoinToken(ctx, token, tokenClaims)
+		if errors.Is(err, ErrJoinTokenUsed) {
+			log.Warn("Rejecting join with a reused token")
+			return nil, status.Errorf(codes.Unauthenticated, "join token: %v", err)
+		} else if err != nil {
+			return nil, status.Errorf(codes.Internal, "join token: %v", err)
+		}
+		cleanFuncs = append(cleanFuncs, release)
+	}
+
 	// Handle any new routes
 	if len(req.GetRoutes()) > 0 {
 		created, err := s.ensurePeerRoutes(ctx, types.NodeID(req.GetId()), req.GetRoutes())
@@ -165,7 +230,7 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 			return nil, handleErr(status.Errorf(codes.Internal, "failed to ensure peer routes: %v", err))
 		} else if created {
 			cleanFuncs = append(cleanFuncs, func() {
-				err := s.storage.MeshDB().Networking().DeleteRoute(ctx, nodeAutoRoute(types.NodeID(req.GetId())))
+				err := s.storage.MeshDB().Networking().DeleteRoute(ctx, storage.NodeAutoRouteName(types.NodeID(req.GetId())))
 				if err != nil {
 					log.Warn("Failed to delete route", slog.String("error", err.Error()))
 				}
@@ -184,10 +249,22 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 			NodeID: req.GetId(),
 			Subnet: s.ipv4Prefix.String(),
 		})
-		if err != nil {
+		switch {
+		case errors.Is(err, plugins.ErrSubnetExhausted) && s.v6fallback:
+			log.Warn("IPv4 network exhausted, continuing with only an IPv6 address",
+				slog.String("subnet", s.ipv4Prefix.String()))
+			leasev4 = netip.Prefix{}
+		case errors.Is(err, plugins.ErrSubnetExhausted):
+			return nil, handleErr(status.Errorf(codes.ResourceExhausted, "failed to allocate IPv4 address: %v", err))
+		case err != nil:
 			return nil, handleErr(status.Errorf(codes.Internal, "failed to allocate IPv4 address: %v", err))
+		default:
+			log.Debug("Assigned IPv4 address to peer", slog.String("ipv4", leasev4.String()))
 		}
-		log.Debug("Assigned IPv4 address to peer", slog.String("ipv4", leasev4.String()))
+	}
+	var privateIPv4 string
+	if leasev4.IsValid() {
+		privateIPv4 = leasev4.String()
 	}
 	// Write the peer to the database
 	p := s.storage.MeshDB().Peers()
@@ -197,7 +274,7 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 		WireguardEndpoints: req.GetWireguardEndpoints(),
 		ZoneAwarenessID:    req.GetZoneAwarenessID(),
 		PublicKey:          req.GetPublicKey(),
-		PrivateIPv4:        leasev4.String(),
+		PrivateIPv4:        privateIPv4,
 		PrivateIPv6:        leasev6.String(),
 		Features:           req.GetFeatures(),
 		Multiaddrs:         req.GetMultiaddrs(),
@@ -318,13 +395,8 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 		NetworkIPv4: s.ipv4Prefix.String(),
 		NetworkIPv6: s.ipv6Prefix.String(),
 		AddressIPv6: leasev6.String(),
-		AddressIPv4: func() string {
-			if leasev4.IsValid() {
-				return leasev4.String()
-			}
-			return ""
-		}(),
-		Peers: peers,
+		AddressIPv4: privateIPv4,
+		Peers:       peers,
 	}
 
 	// Add the node to Raft if requested
@@ -338,7 +410,7 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 			// first heartbeat.
 			<-ctx.Done()
 			var storageAddress string
-			if req.GetAssignIPv4() && !req.GetPreferStorageIPv6() {
+			if leasev4.IsValid() && !req.GetPreferStorageIPv6() {
 				// Prefer IPv4 for raft
 				storageAddress = net.JoinHostPort(leasev4.Addr().String(), strconv.Itoa(int(storagePort)))
 			} else {
@@ -430,7 +502,7 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 						WireguardEndpoints: req.GetWireguardEndpoints(),
 						ZoneAwarenessID:    req.GetZoneAwarenessID(),
 						PublicKey:          req.GetPublicKey(),
-						PrivateIPv4:        leasev4.String(),
+						PrivateIPv4:        privateIPv4,
 						PrivateIPv6:        leasev6.String(),
 						Features:           req.GetFeatures(),
 						JoinedAt:           timestamppb.New(time.Now().UTC()),
@@ -443,6 +515,16 @@ func (s *Server) Join(ctx context.Context, req *v1.JoinRequest) (*v1.JoinRespons
 		}
 	}()
 
+	// Probe the primary endpoint only after the caller is authorized, so the
+	// leader can't be used to dial arbitrary addresses.
+	if s.probeMode != EndpointProbeDisabled {
+		if target, ok := endpointProbeTarget(req); ok {
+			go s.probeJoinedEndpoint(req, target)
+		} else {
+			log.Debug("No primary endpoint or node API port advertised, skipping reachability probe")
+		}
+	}
+
 	log.Debug("Sending join response", slog.Any("response", resp))
 	return resp, nil
 }
@@ -0,0 +1,333 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/plugins/clients"
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+)
+
+func TestJoinIPv4Exhaustion(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name       string
+		v6fallback bool
+	}{
+		{name: "RejectJoin", v6fallback: false},
+		{name: "IPv6OnlyFallback", v6fallback: true},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			node, err := meshnode.NewSingleNodeTestMesh(ctx)
+			if err != nil {
+				t.Fatalf("create test mesh: %v", err)
+			}
+			t.Cleanup(func() { node.Close(ctx) })
+			plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+			if err != nil {
+				t.Fatalf("create plugin manager: %v", err)
+			}
+			srv := NewServer(ctx, Options{
+				NodeID:               node.ID(),
+				Storage:              node.Storage(),
+				Plugins:              plugs,
+				RBAC:                 rbac.NewNoopEvaluator(),
+				Meshnet:              node.Network(),
+				IPv6OnlyOnExhaustion: tt.v6fallback,
+			})
+			// Pin a small IPv4 network with room for three nodes.
+			srv.ipv4Prefix = netip.MustParsePrefix("10.0.0.0/30")
+			join := func(id string) (*v1.JoinResponse, error) {
+				return srv.Join(ctx, &v1.JoinRequest{
+					Id:         id,
+					PublicKey:  newEncodedPubKey(t),
+					AssignIPv4: true,
+				})
+			}
+			for i := 0; i < 3; i++ {
+				resp, err := join(fmt.Sprintf("node-%d", i))
+				if err != nil {
+					t.Fatalf("join node-%d: %v", i, err)
+				}
+				if resp.GetAddressIPv4() == "" {
+					t.Fatalf("expected node-%d to be assigned an IPv4 address", i)
+				}
+			}
+			resp, err := join("node-3")
+			if !tt.v6fallback {
+				if status.Code(err) != codes.ResourceExhausted {
+					t.Fatalf("expected ResourceExhausted, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected IPv6-only join to succeed, got %v", err)
+			}
+			if resp.GetAddressIPv4() != "" {
+				t.Fatalf("expected no IPv4 address, got %s", resp.GetAddressIPv4())
+			}
+			if resp.GetAddressIPv6() == "" {
+				t.Fatal("expected an IPv6 address")
+			}
+		})
+	}
+}
+
+func newEncodedPubKey(t *testing.T) string {
+	t.Helper()
+	key := crypto.MustGenerateKey()
+	encoded, err := key.PublicKey().Encode()
+	if err != nil {
+		t.Fatalf("encode public key: %v", err)
+	}
+	return encoded
+}
+
+func TestJoinFeatureValidation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	srv := NewServer(ctx, Options{
+		NodeID:           node.ID(),
+		Storage:          node.Storage(),
+		Plugins:          plugs,
+		RBAC:             rbac.NewNoopEvaluator(),
+		Meshnet:          node.Network(),
+		ValidateFeatures: true,
+	})
+
+	tc := []struct {
+		name     string
+		features []*v1.FeaturePort
+		wantErr  bool
+	}{
+		{
+			name: "Valid",
+			features: []*v1.FeaturePort{
+				{Feature: v1.Feature_NODES, Port: 8443},
+				{Feature: v1.Feature_ICE_NEGOTIATION, Port: 8443},
+				{Feature: v1.Feature_MESH_DNS, Port: 53},
+			},
+		},
+		{
+			name: "MeshDNSWithoutPort",
+			features: []*v1.FeaturePort{
+				{Feature: v1.Feature_NODES, Port: 8443},
+				{Feature: v1.Feature_MESH_DNS},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ICEWithoutNodeAPI",
+			features: []*v1.FeaturePort{
+				{Feature: v1.Feature_ICE_NEGOTIATION, Port: 8443},
+			},
+			wantErr: true,
+		},
+		{
+			name: "MeshAPIOnDifferentPort",
+			features: []*v1.FeaturePort{
+				{Feature: v1.Feature_NODES, Port: 8443},
+				{Feature: v1.Feature_MESH_API, Port: 9443},
+			},
+			wantErr: true,
+		},
+	}
+	// Joins are serialized by the server, so these run sequentially.
+	for i, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := srv.Join(ctx, &v1.JoinRequest{
+				Id:         fmt.Sprintf("node-%d", i),
+				PublicKey:  newEncodedPubKey(t),
+				AssignIPv4: true,
+				Features:   tt.features,
+			})
+			if tt.wantErr {
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("expected InvalidArgument, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("join: %v", err)
+			}
+		})
+	}
+}
+
+func TestJoinPluginVeto(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{
+		Storage: node.Storage(),
+		Node:    plugins.NodeConfig{NodeID: node.ID(), Key: node.Key()},
+		Plugins: map[string]plugins.Plugin{
+			"posture": {Client: clients.NewInProcessClient(&denyingPlugin{deny: "bad-node"})},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	srv := NewServer(ctx, Options{
+		NodeID:  node.ID(),
+		Storage: node.Storage(),
+		Plugins: plugs,
+		RBAC:    rbac.NewNoopEvaluator(),
+		Meshnet: node.Network(),
+	})
+	_, err = srv.Join(ctx, &v1.JoinRequest{
+		Id:         "bad-node",
+		PublicKey:  newEncodedPubKey(t),
+		AssignIPv4: true,
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for denied node, got %v", err)
+	}
+	if !strings.Contains(status.Convert(err).Message(), "failed posture check") {
+		t.Fatalf("expected plugin reason in error, got %v", err)
+	}
+	if _, err := node.Storage().MeshDB().Peers().Get(ctx, "bad-node"); err == nil {
+		t.Fatal("expected denied node to not be stored")
+	}
+	_, err = srv.Join(ctx, &v1.JoinRequest{
+		Id:         "good-node",
+		PublicKey:  newEncodedPubKey(t),
+		AssignIPv4: true,
+	})
+	if err != nil {
+		t.Fatalf("expected approved node to join, got %v", err)
+	}
+}
+
+type denyingPlugin struct {
+	v1.UnimplementedPluginServer
+	deny string
+}
+
+func (p *denyingPlugin) GetInfo(context.Context, *emptypb.Empty) (*v1.PluginInfo, error) {
+	return &v1.PluginInfo{Name: "posture"}, nil
+}
+
+func (p *denyingPlugin) Configure(context.Context, *v1.PluginConfiguration) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+func (p *denyingPlugin) ApproveJoin(_ context.Context, req *v1.JoinRequest) (clients.JoinApproval, error) {
+	if req.GetId() == p.deny {
+		return clients.JoinApproval{Reason: "failed posture check"}, nil
+	}
+	return clients.JoinApproval{Approved: true}, nil
+}
+
+func TestJoinVersionCompatibility(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	srv := NewServer(ctx, Options{
+		NodeID:  node.ID(),
+		Storage: node.Storage(),
+		Plugins: plugs,
+		RBAC:    rbac.NewNoopEvaluator(),
+		Meshnet: node.Network(),
+		Version: "v0.12.0",
+	})
+	tc := []struct {
+		name    string
+		version string
+		wantErr bool
+	}{
+		{name: "SameVersion", version: "v0.12.0"},
+		{name: "PatchRelease", version: "v0.12.4"},
+		{name: "DevelopmentBuild", version: "unknown"},
+		{name: "NoVersion", version: ""},
+		{name: "OlderMinorRelease", version: "v0.11.2"},
+		{name: "NewerMinorRelease", version: "v0.13.0"},
+		{name: "TwoMinorReleasesBehind", version: "v0.10.5", wantErr: true},
+		{name: "NewerMajorRelease", version: "v1.0.0", wantErr: true},
+	}
+	for i, tt := range tc {
+		jctx := ctx
+		if tt.version != "" {
+			jctx = metadata.NewIncomingContext(ctx, metadata.Pairs(leaderproxy.NodeVersionMeta, tt.version))
+		}
+		_, err := srv.Join(jctx, &v1.JoinRequest{
+			Id:        fmt.Sprintf("node-%d", i),
+			PublicKey: newEncodedPubKey(t),
+		})
+		if tt.wantErr {
+			if status.Code(err) != codes.FailedPrecondition {
+				t.Errorf("%s: expected FailedPrecondition joining with version %s, got %v", tt.name, tt.version, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected join with version %q to succeed, got %v", tt.name, tt.version, err)
+		}
+	}
+
+	// The check can be skipped by the operator.
+	srv.skipVersionCheck = true
+	jctx := metadata.NewIncomingContext(ctx, metadata.Pairs(leaderproxy.NodeVersionMeta, "v1.0.0"))
+	_, err = srv.Join(jctx, &v1.JoinRequest{
+		Id:        "node-skipped-check",
+		PublicKey: newEncodedPubKey(t),
+	})
+	if err != nil {
+		t.Errorf("expected join with an incompatible version to succeed when the check is skipped, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+	storageerrors "github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+var (
+	// ErrInvalidJoinToken is returned when a join token is malformed or its
+	// signature does not match.
+	ErrInvalidJoinToken = errors.New("invalid join token")
+	// ErrJoinTokenExpired is returned when a join token is past its expiry.
+	ErrJoinTokenExpired = errors.New("join token expired")
+	// ErrJoinTokenUsed is returned when a join token has already been used.
+	ErrJoinTokenUsed = errors.New("join token already used")
+)
+
+// UsedJoinTokensPrefix is the registry prefix where used join tokens are recorded
+// until they expire. It is inside the registry so that nodes cannot clear it.
+var UsedJoinTokensPrefix = types.RegistryPrefix.ForString("used-join-tokens")
+
+// JoinTokenClaims are the permissions granted to a node joining with a join token.
+// A token grants nothing beyond what is listed here.
+type JoinTokenClaims struct {
+	// NodeID is the only node ID that may join with the token.
+	NodeID string `json:"node"`
+	// Routes are the prefixes the joining node may advertise routes within.
+	Routes []string `json:"routes,omitempty"`
+	// Voter allows the node to join as a voter.
+	Voter bool `json:"voter,omitempty"`
+	// Observer allows the node to join as an observer.
+	Observer bool `json:"observer,omitempty"`
+	// ExpiresAt is the unix time after which the token is no longer valid.
+	ExpiresAt int64 `json:"exp"`
+}
+
+// Validate checks that the claims are well formed.
+func (c JoinTokenClaims) Validate() error {
+	if c.NodeID == "" {
+		return errors.New("join token node ID is required")
+	}
+	if c.ExpiresAt <= 0 {
+		return errors.New("join token expiry is required")
+	}
+	for _, route := range c.Routes {
+		if _, err := netip.ParsePrefix(route); err != nil {
+			return fmt.Errorf("invalid join token route %q: %w", route, err)
+		}
+	}
+	return nil
+}
+
+// Permits returns an error if the join request asks for more than the claims allow.
+func (c JoinTokenClaims) Permits(req *v1.JoinRequest) error {
+	if c.NodeID != req.GetId() {
+		return fmt.Errorf("token is not valid for node %s", req.GetId())
+	}
+	if req.GetAsVoter() && !c.Voter {
+		return errors.New("token does not allow joining as a voter")
+	}
+	if req.GetAsObserver() && !c.Observer && !c.Voter {
+		return errors.New("token does not allow joining as an observer")
+	}
+	if len(req.GetDirectPeers()) > 0 {
+		return errors.New("token does not allow direct peers")
+	}
+Routes:
+	for _, route := range req.GetRoutes() {
+		prefix, err := netip.ParsePrefix(route)
+		if err != nil {
+			return fmt.Errorf("invalid route %q: %w", route, err)
+		}
+		for _, allowed := range c.Routes {
+			allowedPrefix, err := netip.ParsePrefix(allowed)
+			if err != nil {
+				continue
+			}
+			if allowedPrefix.Bits() <= prefix.Bits() && allowedPrefix.Contains(prefix.Addr()) {
+				continue Routes
+			}
+		}
+		return fmt.Errorf("token does not allow route %s", route)
+	}
+	return nil
+}
+
+// MintJoinToken signs the given claims with the secret and returns an encoded
+// join token. Servers must be configured with the same secret to accept it.
+func MintJoinToken(secret []byte, claims JoinTokenClaims) (string, error) {
+	if len(secret) == 0 {
+		return "", errors.New("join token secret is required")
+	}
+	if err := claims.Validate(); err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("marshal join token claims: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signJoinToken(secret, encoded)), nil
+}
+
+// ParseJoinToken verifies the signature and expiry of a join token and returns
+// its claims.
+func ParseJoinToken(secret []byte, token string, now time.Time) (JoinTokenClaims, error) {
+	var claims JoinTokenClaims
+	encoded, encodedSig, ok := strings.Cut(token, ".")
+	if !ok || len(secret) == 0 {
+		return claims, ErrInvalidJoinToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil || !hmac.Equal(sig, signJoinToken(secret, encoded)) {
+		return claims, ErrInvalidJoinToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return claims, ErrInvalidJoinToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrInvalidJoinToken
+	}
+	if err := claims.Validate(); err != nil {
+		return claims, fmt.Errorf("%w: %w", ErrInvalidJoinToken, err)
+	}
+	if !now.Before(time.Unix(claims.ExpiresAt, 0)) {
+		return claims, ErrJoinTokenExpired
+	}
+	return claims, nil
+}
+
+// consumeJoinToken records the token as used until it expires. It returns
+// ErrJoinTokenUsed if the token was already recorded, and a function that
+// releases the token again if the join fails.
+func (s *Server) consumeJoinToken(ctx context.Context, token string, claims JoinTokenClaims) (release func(), err error) {
+	// Half of the digest keeps the key within the storage ID length limit.
+	sum := sha256.Sum256([]byte(token))
+	key := UsedJoinTokensPrefix.ForString(hex.EncodeToString(sum[:16]))
+	st := s.storage.MeshStorage()
+	_, err = st.GetValue(ctx, key)
+	switch {
+	case err == nil:
+		return nil, ErrJoinTokenUsed
+	case !storageerrors.IsKeyNotFound(err):
+		return nil, fmt.Errorf("get used join token: %w", err)
+	}
+	ttl := time.Until(time.Unix(claims.ExpiresAt, 0))
+	if err := st.PutValue(ctx, key, []byte(claims.NodeID), ttl); err != nil {
+		return nil, fmt.Errorf("record used join token: %w", err)
+	}
+	return func() {
+		if err := st.Delete(ctx, key); err != nil {
+			context.LoggerFrom(ctx).Warn("Failed to release join token", "error", err.Error())
+		}
+	}, nil
+}
+
+func signJoinToken(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// NewJoinTokenCreds returns a DialOption that presents the given join token
+// on outgoing requests.
+func NewJoinTokenCreds(token string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(joinTokenCreds(token))
+}
+
+type joinTokenCreds string
+
+func (c joinTokenCreds) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{leaderproxy.JoinTokenMeta: string(c)}, nil
+}
+
+// RequireTransportSecurity returns true, join tokens are bearer credentials and
+// are never sent over an insecure connection.
+func (c joinTokenCreds) RequireTransportSecurity() bool {
+	return true
+}
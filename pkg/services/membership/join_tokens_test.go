@@ -0,0 +1,185 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+)
+
+func TestJoinTokens(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	secret := []byte("join-token-secret")
+	srv := NewServer(ctx, Options{
+		NodeID:           node.ID(),
+		Storage:          node.Storage(),
+		Plugins:          plugs,
+		RBAC:             rbac.NewNoopEvaluator(),
+		Meshnet:          node.Network(),
+		JoinTokenSecret:  secret,
+		RequireJoinToken: true,
+	})
+	mint := func(claims JoinTokenClaims) string {
+		t.Helper()
+		token, err := MintJoinToken(secret, claims)
+		if err != nil {
+			t.Fatalf("mint join token: %v", err)
+		}
+		return token
+	}
+	join := func(token string, req *v1.JoinRequest) error {
+		ctx := ctx
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(leaderproxy.JoinTokenMeta, token))
+		}
+		req.PublicKey = newEncodedPubKey(t)
+		_, err := srv.Join(ctx, req)
+		return err
+	}
+	expiry := time.Now().Add(time.Hour).Unix()
+
+	t.Run("ValidToken", func(t *testing.T) {
+		token := mint(JoinTokenClaims{
+			NodeID:    "ci-runner-1",
+			Routes:    []string{"10.100.0.0/16"},
+			ExpiresAt: expiry,
+		})
+		err := join(token, &v1.JoinRequest{
+			Id:     "ci-runner-1",
+			Routes: []string{"10.100.1.0/24"},
+		})
+		if err != nil {
+			t.Fatalf("join with valid token: %v", err)
+		}
+	})
+
+	t.Run("ReusedToken", func(t *testing.T) {
+		token := mint(JoinTokenClaims{NodeID: "ci-runner-7", ExpiresAt: expiry})
+		if err := join(token, &v1.JoinRequest{Id: "ci-runner-7"}); err != nil {
+			t.Fatalf("join with valid token: %v", err)
+		}
+		err := join(token, &v1.JoinRequest{Id: "ci-runner-7"})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("expected Unauthenticated for reused token, got %v", err)
+		}
+	})
+
+	t.Run("ReleasedOnFailure", func(t *testing.T) {
+		token := mint(JoinTokenClaims{NodeID: "ci-runner-8", ExpiresAt: expiry})
+		// An invalid route fails the join after the token is consumed.
+		err := join(token, &v1.JoinRequest{Id: "ci-runner-8", Routes: []string{"10.100.0.0/16"}})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("expected PermissionDenied, got %v", err)
+		}
+		if err := join(token, &v1.JoinRequest{Id: "ci-runner-8"}); err != nil {
+			t.Fatalf("expected token to be usable after a failed join, got %v", err)
+		}
+	})
+
+	t.Run("MissingNodeID", func(t *testing.T) {
+		_, err := MintJoinToken(secret, JoinTokenClaims{ExpiresAt: expiry})
+		if err == nil {
+			t.Fatal("expected error minting a token without a node ID")
+		}
+	})
+
+	t.Run("ExpiredToken", func(t *testing.T) {
+		token := mint(JoinTokenClaims{NodeID: "ci-runner-2", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+		err := join(token, &v1.JoinRequest{Id: "ci-runner-2"})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("expected Unauthenticated for expired token, got %v", err)
+		}
+	})
+
+	t.Run("TamperedToken", func(t *testing.T) {
+		token, err := MintJoinToken([]byte("other-secret"), JoinTokenClaims{NodeID: "ci-runner-3", ExpiresAt: expiry})
+		if err != nil {
+			t.Fatalf("mint join token: %v", err)
+		}
+		err = join(token, &v1.JoinRequest{Id: "ci-runner-3"})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("expected Unauthenticated for token with a bad signature, got %v", err)
+		}
+	})
+
+	t.Run("BeyondScope", func(t *testing.T) {
+		tc := []struct {
+			name string
+			req  *v1.JoinRequest
+		}{
+			{
+				name: "OtherNode",
+				req:  &v1.JoinRequest{Id: "ci-runner-5"},
+			},
+			{
+				name: "RouteOutsideScope",
+				req:  &v1.JoinRequest{Id: "ci-runner-4", Routes: []string{"10.200.0.0/24"}},
+			},
+			{
+				name: "WiderRoute",
+				req:  &v1.JoinRequest{Id: "ci-runner-4", Routes: []string{"10.0.0.0/8"}},
+			},
+			{
+				name: "DirectPeers",
+				req: &v1.JoinRequest{Id: "ci-runner-4", DirectPeers: map[string]v1.ConnectProtocol{
+					"other-node": v1.ConnectProtocol_CONNECT_ICE,
+				}},
+			},
+		}
+		token := mint(JoinTokenClaims{
+			NodeID:    "ci-runner-4",
+			Routes:    []string{"10.100.0.0/16"},
+			ExpiresAt: expiry,
+		})
+		for _, tt := range tc {
+			t.Run(tt.name, func(t *testing.T) {
+				err := join(token, tt.req)
+				if status.Code(err) != codes.PermissionDenied {
+					t.Fatalf("expected PermissionDenied, got %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("MissingToken", func(t *testing.T) {
+		err := join("", &v1.JoinRequest{Id: "ci-runner-6"})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("expected Unauthenticated without a token, got %v", err)
+		}
+	})
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package membership
 
 import (
+	"fmt"
 	"log/slog"
 
 	v1 "github.com/webmeshproj/api/go/v1"
@@ -24,6 +25,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
 	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
 	"github.com/webmeshproj/webmesh/pkg/storage/errors"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
@@ -83,17 +85,43 @@ func (s *Server) Leave(ctx context.Context, req *v1.LeaveRequest) (*v1.LeaveResp
 		}
 	}
 
-	s.log.Info("Removing mesh node from peers DB", "id", req.GetId())
-	err = s.storage.MeshDB().Peers().Delete(ctx, types.NodeID(req.GetId()))
+	if err := s.removeNode(ctx, leaving); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &v1.LeaveResponse{}, nil
+}
+
+// removeNode deletes a node from the peers DB, releases its addresses, and notifies
+// watching plugins that it left. The caller must hold the server lock and have
+// already removed the node from the storage consensus if it was a member.
+func (s *Server) removeNode(ctx context.Context, leaving types.MeshNode) error {
+	err := s.storage.MeshDB().Networking().DeleteSecondaryIPs(ctx, leaving.NodeID())
+	if err != nil {
+		return fmt.Errorf("failed to release secondary leases: %w", err)
+	}
+
+	s.log.Info("Removing mesh node from peers DB", "id", leaving.GetId())
+	err = s.storage.MeshDB().Peers().Delete(ctx, leaving.NodeID())
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to delete peer: %v", err)
+		return fmt.Errorf("failed to delete peer: %w", err)
+	}
+
+	// Release the primary lease so the IPAM can hold it for the node should it rejoin.
+	if s.plugins != nil && leaving.PrivateAddrV4().IsValid() {
+		err = s.plugins.ReleaseIP(ctx, &v1.ReleaseIPRequest{
+			NodeID: leaving.GetId(),
+			Ip:     leaving.PrivateAddrV4().String(),
+		})
+		if err != nil && !errors.Is(err, plugins.ErrUnsupported) {
+			s.log.Warn("Failed to release IPv4 lease", "error", err.Error())
+		}
 	}
 
 	go func() {
 		// Notify any watching plugins
 		if s.plugins != nil && s.plugins.HasWatchers() {
 			err := s.plugins.Emit(context.Background(), &v1.Event{
-				Type: v1.Event_NODE_JOIN,
+				Type: v1.Event_NODE_LEAVE,
 				Event: &v1.Event_Node{
 					Node: &v1.MeshNode{
 						Id:                 leaving.Id,
@@ -113,6 +141,5 @@ func (s *Server) Leave(ctx context.Context, req *v1.LeaveRequest) (*v1.LeaveResp
 			}
 		}
 	}()
-
-	return &v1.LeaveResponse{}, nil
+	return nil
 }
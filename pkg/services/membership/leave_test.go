@@ -0,0 +1,98 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/peer"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+)
+
+func TestLeaveRejoinReclaimsLease(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{
+		Storage:                 node.Storage(),
+		DefaultIPAMReleaseGrace: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	// The test node never starts its network, so report the mesh prefix
+	// ourselves for the in-network check on leave.
+	network := netip.MustParsePrefix("172.16.0.0/12")
+	srv := NewServer(ctx, Options{
+		NodeID:  node.ID(),
+		Storage: node.Storage(),
+		Plugins: plugs,
+		RBAC:    rbac.NewNoopEvaluator(),
+		Meshnet: &staticNetworkManager{Manager: node.Network(), networkv4: network},
+	})
+	join := func(id string) string {
+		t.Helper()
+		resp, err := srv.Join(ctx, &v1.JoinRequest{
+			Id:         id,
+			PublicKey:  newEncodedPubKey(t),
+			AssignIPv4: true,
+		})
+		if err != nil {
+			t.Fatalf("join %s: %v", id, err)
+		}
+		return resp.GetAddressIPv4()
+	}
+	leased := join("node-a")
+
+	// Leave requests must originate from inside the mesh.
+	inNetwork := peer.NewContext(ctx, &peer.Peer{
+		Addr: net.TCPAddrFromAddrPort(netip.AddrPortFrom(network.Addr().Next(), 8443)),
+	})
+	if _, err := srv.Leave(inNetwork, &v1.LeaveRequest{Id: "node-a"}); err != nil {
+		t.Fatalf("leave node-a: %v", err)
+	}
+
+	// Another node joining in the meantime must not be handed the held lease.
+	if addr := join("node-b"); addr == leased {
+		t.Fatalf("lease %s held for node-a was allocated to node-b", leased)
+	}
+	if addr := join("node-a"); addr != leased {
+		t.Fatalf("expected node-a to reclaim %s, got %s", leased, addr)
+	}
+}
+
+type staticNetworkManager struct {
+	meshnet.Manager
+	networkv4 netip.Prefix
+}
+
+func (m *staticNetworkManager) NetworkV4() netip.Prefix {
+	return m.networkv4
+}
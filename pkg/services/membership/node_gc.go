@@ -0,0 +1,161 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+const (
+	// DefaultDeadNodeThreshold is the default time since the last heartbeat
+	// after which a node that is not a storage member is considered dead.
+	DefaultDeadNodeThreshold = 24 * time.Hour
+	// DefaultDeadNodeGCInterval is the default interval at which the leader
+	// looks for dead nodes.
+	DefaultDeadNodeGCInterval = time.Minute
+)
+
+// CollectDeadNodes removes nodes whose last sign of life is older than the dead
+// node threshold and that are not members of the storage consensus. A sign of
+// life is either a heartbeat, which is only accepted from the node itself, or
+// a WireGuard handshake with this node, which is authenticated by the node's
+// key. Nodes that have never sent a heartbeat are left alone. It does nothing
+// unless this node is the leader and a threshold is configured. The IDs of
+// removed nodes are returned.
+func (s *Server) CollectDeadNodes(ctx context.Context) ([]types.NodeID, error) {
+	if s.deadNodeThreshold <= 0 || !s.storage.Consensus().IsLeader() {
+		return nil, nil
+	}
+	beats, err := storage.GetHeartbeats(ctx, s.storage.MeshStorage())
+	if err != nil {
+		return nil, err
+	}
+	s.heartbeats.mu.Lock()
+	for id, last := range s.heartbeats.beats {
+		if last.After(beats[id]) {
+			beats[id] = last
+		}
+	}
+	s.heartbeats.mu.Unlock()
+	members, err := s.storage.Consensus().GetPeers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	isMember := make(map[types.NodeID]bool, len(members))
+	for _, member := range members {
+		isMember[types.NodeID(member.GetId())] = true
+	}
+	nodes, err := s.storage.MeshDB().Peers().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	handshakes := s.lastHandshakes()
+	now := time.Now().UTC()
+	var removed []types.NodeID
+	for _, node := range nodes {
+		id := node.NodeID()
+		last, ok := beats[id]
+		if !ok || id == s.nodeID || isMember[id] {
+			continue
+		}
+		if key, err := crypto.DecodePublicKey(node.GetPublicKey()); err == nil {
+			if handshake := handshakes[key.WireGuardKey().String()]; handshake.After(last) {
+				last = handshake
+			}
+		}
+		if now.Sub(last) < s.deadNodeThreshold {
+			continue
+		}
+		s.log.Info("Removing dead node from peers DB",
+			slog.String("id", id.String()),
+			slog.Time("last-heartbeat", last),
+		)
+		s.mu.Lock()
+		err := s.removeNode(ctx, node)
+		s.mu.Unlock()
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, id)
+	}
+	if len(removed) > 0 {
+		if err := s.forgetHeartbeats(ctx, removed); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// lastHandshakes returns the time of the last WireGuard handshake with each
+// peer of this node, keyed by the peer's WireGuard public key.
+func (s *Server) lastHandshakes() map[string]time.Time {
+	handshakes := make(map[string]time.Time)
+	if s.meshnet == nil || s.meshnet.WireGuard() == nil {
+		return handshakes
+	}
+	metrics, err := s.meshnet.WireGuard().Metrics()
+	if err != nil {
+		s.log.Warn("Failed to get wireguard metrics", slog.String("error", err.Error()))
+		return handshakes
+	}
+	for _, peer := range metrics.GetPeers() {
+		last, err := time.Parse(time.RFC3339, peer.GetLastHandshakeTime())
+		if err != nil {
+			continue
+		}
+		handshakes[peer.GetPublicKey()] = last
+	}
+	return handshakes
+}
+
+// forgetHeartbeats drops the heartbeats of the given nodes so that a node
+// rejoining with the same ID is not immediately considered dead.
+func (s *Server) forgetHeartbeats(ctx context.Context, ids []types.NodeID) error {
+	s.heartbeats.mu.Lock()
+	defer s.heartbeats.mu.Unlock()
+	stored, err := storage.GetHeartbeats(ctx, s.storage.MeshStorage())
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(s.heartbeats.beats, id)
+		delete(stored, id)
+	}
+	return storage.PutHeartbeats(ctx, s.storage.MeshStorage(), stored)
+}
+
+// runDeadNodeGC collects dead nodes every interval until the context is canceled.
+func (s *Server) runDeadNodeGC(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := s.CollectDeadNodes(ctx); err != nil {
+				s.log.Warn("Failed to collect dead nodes", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestCollectDeadNodes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	// The handshake node is silent but has recently completed a WireGuard
+	// handshake with the leader.
+	handshakeKey := crypto.MustGenerateKey().PublicKey()
+	encodedHandshakeKey, err := handshakeKey.Encode()
+	if err != nil {
+		t.Fatalf("encode public key: %v", err)
+	}
+	nw := &handshakeNetwork{
+		Manager: node.Network(),
+		wg: &handshakeInterface{metrics: &v1.InterfaceMetrics{
+			Peers: []*v1.PeerMetrics{{
+				PublicKey:         handshakeKey.WireGuardKey().String(),
+				LastHandshakeTime: time.Now().UTC().Add(-time.Minute).Format(time.RFC3339),
+			}},
+		}},
+	}
+	srv := NewServer(ctx, Options{
+		NodeID:             node.ID(),
+		Storage:            node.Storage(),
+		Plugins:            plugs,
+		RBAC:               rbac.NewNoopEvaluator(),
+		Meshnet:            nw,
+		DeadNodeThreshold:  time.Hour,
+		DeadNodeGCInterval: time.Hour,
+	})
+	t.Cleanup(func() { _ = srv.Drain(ctx) })
+	for _, id := range []string{"dead-node", "live-node", "quiet-node", "handshake-node"} {
+		key := newEncodedPubKey(t)
+		if id == "handshake-node" {
+			key = encodedHandshakeKey
+		}
+		_, err := srv.Join(ctx, &v1.JoinRequest{
+			Id:         id,
+			PublicKey:  key,
+			AssignIPv4: true,
+		})
+		if err != nil {
+			t.Fatalf("join %s: %v", id, err)
+		}
+	}
+	// The local node is a storage member and must survive regardless of its heartbeat.
+	// The quiet node has never sent a heartbeat and is left alone.
+	now := time.Now().UTC()
+	err = storage.PutHeartbeats(ctx, node.Storage().MeshStorage(), map[types.NodeID]time.Time{
+		"dead-node":      now.Add(-2 * time.Hour),
+		"live-node":      now.Add(-time.Minute),
+		"handshake-node": now.Add(-2 * time.Hour),
+		node.ID():        now.Add(-2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("put heartbeats: %v", err)
+	}
+
+	removed, err := srv.CollectDeadNodes(ctx)
+	if err != nil {
+		t.Fatalf("collect dead nodes: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != "dead-node" {
+		t.Fatalf("expected only dead-node to be collected, got %v", removed)
+	}
+	if _, err := node.Storage().MeshDB().Peers().Get(ctx, "dead-node"); !errors.IsNodeNotFound(err) {
+		t.Fatalf("expected dead-node to be removed from the peers DB, got %v", err)
+	}
+	for _, id := range []types.NodeID{"live-node", "quiet-node", "handshake-node", node.ID()} {
+		if _, err := node.Storage().MeshDB().Peers().Get(ctx, id); err != nil {
+			t.Fatalf("expected %s to remain in the peers DB: %v", id, err)
+		}
+	}
+	// The collected node's heartbeat is forgotten so it can rejoin.
+	last, err := srv.LastHeartbeat(ctx, "dead-node")
+	if err != nil {
+		t.Fatalf("get last heartbeat: %v", err)
+	}
+	if !last.IsZero() {
+		t.Fatalf("expected dead-node heartbeat to be forgotten, got %s", last)
+	}
+}
+
+// handshakeNetwork is a network manager whose wireguard interface reports
+// fixed peer metrics.
+type handshakeNetwork struct {
+	meshnet.Manager
+	wg wireguard.Interface
+}
+
+func (n *handshakeNetwork) WireGuard() wireguard.Interface {
+	return n.wg
+}
+
+type handshakeInterface struct {
+	wireguard.Interface
+	metrics *v1.InterfaceMetrics
+}
+
+func (i *handshakeInterface) Metrics() (*v1.InterfaceMetrics, error) {
+	return i.metrics, nil
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"log/slog"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// Promote promotes an existing observer in the storage consensus to a voter
+// without the node having to rejoin. The caller must be allowed to put votes
+// for the node by name, which the built-in roles only grant to admins. It
+// serves updates from other callers that only ask for the node to be a voter.
+func (s *Server) Promote(ctx context.Context, id types.NodeID) error {
+	if !s.storage.Consensus().IsLeader() {
+		return status.Errorf(codes.FailedPrecondition, "not leader")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.promote(ctx, id)
+}
+
+// Demote demotes an existing voter in the storage consensus to an observer.
+// It serves updates carrying the leaderproxy.DemoteMeta key. The same
+// permissions as Promote are required. The leader cannot demote itself,
+// and the remaining voters must still make up a quorum of the current configuration.
+// When the storage tracks contact with its peers, the remaining voters the leader
+// is in contact with must also make up a quorum of the new configuration.
+func (s *Server) Demote(ctx context.Context, id types.NodeID) error {
+	if !s.storage.Consensus().IsLeader() {
+		return status.Errorf(codes.FailedPrecondition, "not leader")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log := s.log.With("op", "demote", "id", id)
+	peer, err := s.lookupStoragePeer(ctx, id)
+	if err != nil {
+		return err
+	}
+	switch peer.GetClusterStatus() {
+	case v1.ClusterStatus_CLUSTER_LEADER:
+		return status.Errorf(codes.FailedPrecondition, "cannot demote the current leader %s", id)
+	case v1.ClusterStatus_CLUSTER_VOTER:
+	default:
+		log.Debug("Peer is not a voter, nothing to do")
+		return nil
+	}
+	contact, tracked := s.storage.Consensus().(storage.PeerContact)
+	var voters, reachable int
+	for _, p := range s.storage.Status().GetPeers() {
+		if !isVoter(p.GetClusterStatus()) {
+			continue
+		}
+		voters++
+		if p.GetId() != id.String() && (!tracked || contact.InContact(types.NodeID(p.GetId()))) {
+			reachable++
+		}
+	}
+	if quorum := voters/2 + 1; voters-1 < quorum {
+		return status.Errorf(codes.FailedPrecondition,
+			"demoting %s would leave %d voter(s), below the current quorum of %d", id, voters-1, quorum)
+	}
+	if quorum := (voters-1)/2 + 1; reachable < quorum {
+		return status.Errorf(codes.FailedPrecondition,
+			"demoting %s would leave %d reachable voter(s), below the new quorum of %d", id, reachable, quorum)
+	}
+	log.Info("Demoting peer to observer")
+	err = s.storage.Consensus().DemoteVoter(ctx, types.StoragePeer{StoragePeer: &v1.StoragePeer{
+		Id:      id.String(),
+		Address: peer.GetAddress(),
+	}})
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to demote voter: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) promote(ctx context.Context, id types.NodeID) error {
+	log := s.log.With("op", "promote", "id", id)
+	peer, err := s.lookupStoragePeer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if isVoter(peer.GetClusterStatus()) {
+		log.Debug("Peer is already a voter, nothing to do")
+		return nil
+	}
+	if peer.GetAddress() == "" {
+		return status.Errorf(codes.Internal, "failed to lookup peer address")
+	}
+	log.Info("Promoting peer to voter", slog.String("storage-address", peer.GetAddress()))
+	err = s.storage.Consensus().AddVoter(ctx, types.StoragePeer{StoragePeer: &v1.StoragePeer{
+		Id:      id.String(),
+		Address: peer.GetAddress(),
+	}})
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to promote to voter: %v", err)
+	}
+	return nil
+}
+
+// lookupStoragePeer validates the given ID, checks that the caller may change its
+// suffrage, and returns its current entry in the storage consensus.
+func (s *Server) lookupStoragePeer(ctx context.Context, id types.NodeID) (*v1.StoragePeer, error) {
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "node id required")
+	} else if !types.IsValidNodeID(id.String()) {
+		return nil, status.Error(codes.InvalidArgument, "node id is invalid")
+	}
+	allowed, err := s.rbac.Evaluate(ctx, rbac.Actions{canVoteAction.For(id.String())})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to evaluate permissions: %v", err)
+	}
+	if !allowed {
+		s.log.Warn("Caller not allowed to change suffrage", slog.String("id", id.String()))
+		return nil, status.Error(codes.PermissionDenied, "not allowed")
+	}
+	for _, peer := range s.storage.Status().GetPeers() {
+		if peer.GetId() == id.String() {
+			return peer, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "node %s is not a member of the storage consensus", id)
+}
+
+func isVoter(st v1.ClusterStatus) bool {
+	return st == v1.ClusterStatus_CLUSTER_VOTER || st == v1.ClusterStatus_CLUSTER_LEADER
+}
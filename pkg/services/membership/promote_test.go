@@ -0,0 +1,225 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/tcp"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/providers/raftstorage"
+	"github.com/webmeshproj/webmesh/pkg/storage/testutil"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestPromoteDemote(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	leader := newTestProvider(ctx, t)
+	testutil.MustBootstrapProvider(ctx, t, leader)
+	ok := testutil.Eventually[bool](func() bool {
+		return leader.Consensus().IsLeader()
+	}).ShouldEqual(time.Second*10, time.Millisecond*100, true)
+	if !ok {
+		t.Fatal("provider did not become leader")
+	}
+	leaderID := types.NodeID(leader.Status().GetPeers()[0].GetId())
+	srv := NewServer(ctx, Options{
+		NodeID:  leaderID,
+		Storage: leader,
+		RBAC:    rbac.NewNoopEvaluator(),
+	})
+
+	observer := newTestProvider(ctx, t)
+	voter := newTestProvider(ctx, t)
+	observerID := types.NodeID(observer.Status().GetPeers()[0].GetId())
+	voterID := types.NodeID(voter.Status().GetPeers()[0].GetId())
+	testutil.MustAddObserver(ctx, t, leader, observer)
+	testutil.MustAddVoter(ctx, t, leader, voter)
+
+	suffrageOf := func(id types.NodeID) v1.ClusterStatus {
+		for _, peer := range leader.Status().GetPeers() {
+			if peer.GetId() == id.String() {
+				return peer.GetClusterStatus()
+			}
+		}
+		return v1.ClusterStatus_CLUSTER_STATUS_UNKNOWN
+	}
+	waitFor := func(id types.NodeID, want v1.ClusterStatus) {
+		t.Helper()
+		ok := testutil.Eventually[v1.ClusterStatus](func() v1.ClusterStatus {
+			return suffrageOf(id)
+		}).ShouldEqual(time.Second*10, time.Millisecond*100, want)
+		if !ok {
+			t.Fatalf("expected %s to be %s, got %s", id, want, suffrageOf(id))
+		}
+	}
+
+	// Promote the observer and it should become a voter.
+	if err := srv.Promote(ctx, observerID); err != nil {
+		t.Fatalf("promote observer: %v", err)
+	}
+	waitFor(observerID, v1.ClusterStatus_CLUSTER_VOTER)
+	// Promoting again is a no-op.
+	if err := srv.Promote(ctx, observerID); err != nil {
+		t.Fatalf("promote existing voter: %v", err)
+	}
+
+	// With three voters we can safely demote one of them.
+	if err := srv.Demote(ctx, observerID); err != nil {
+		t.Fatalf("demote voter: %v", err)
+	}
+	waitFor(observerID, v1.ClusterStatus_CLUSTER_OBSERVER)
+
+	// Demoting another would leave a single voter out of two.
+	err := srv.Demote(ctx, voterID)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition demoting below quorum, got %v", err)
+	}
+	// The leader may never demote itself.
+	err = srv.Demote(ctx, leaderID)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition demoting the leader, got %v", err)
+	}
+	// Unknown nodes are not found.
+	err = srv.Promote(ctx, types.NodeID("unknown-node"))
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for unknown node, got %v", err)
+	}
+}
+
+func TestDemoteUnreachableVoter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	leader := newTestProvider(ctx, t)
+	testutil.MustBootstrapProvider(ctx, t, leader)
+	ok := testutil.Eventually[bool](func() bool {
+		return leader.Consensus().IsLeader()
+	}).ShouldEqual(time.Second*10, time.Millisecond*100, true)
+	if !ok {
+		t.Fatal("provider did not become leader")
+	}
+	srv := NewServer(ctx, Options{
+		NodeID:  types.NodeID(leader.Status().GetPeers()[0].GetId()),
+		Storage: leader,
+		RBAC:    rbac.NewNoopEvaluator(),
+	})
+	live := newTestProvider(ctx, t)
+	down := newTestProvider(ctx, t)
+	liveID := types.NodeID(live.Status().GetPeers()[0].GetId())
+	downID := types.NodeID(down.Status().GetPeers()[0].GetId())
+	testutil.MustAddVoter(ctx, t, leader, live)
+	testutil.MustAddVoter(ctx, t, leader, down)
+
+	// Stop one of the three voters and wait for the leader to lose contact.
+	if err := down.Close(); err != nil {
+		t.Fatalf("close voter: %v", err)
+	}
+	contact := leader.Consensus().(storage.PeerContact)
+	ok = testutil.Eventually[bool](func() bool {
+		return contact.InContact(downID)
+	}).ShouldEqual(time.Second*30, time.Millisecond*100, false)
+	if !ok {
+		t.Fatal("leader did not lose contact with the stopped voter")
+	}
+	if !contact.InContact(liveID) {
+		t.Fatal("expected the leader to be in contact with the live voter")
+	}
+
+	// Demoting the live voter would leave the leader alone with an
+	// unreachable voter, which is not a quorum of two.
+	err := srv.Demote(ctx, liveID)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition demoting with an unreachable voter, got %v", err)
+	}
+	// Demoting the unreachable voter leaves a reachable quorum.
+	if err := srv.Demote(ctx, downID); err != nil {
+		t.Fatalf("demote unreachable voter: %v", err)
+	}
+}
+
+func TestUpdateDemote(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	// The test node never starts its network, so report the mesh prefix
+	// ourselves for the in-network check on update.
+	network := netip.MustParsePrefix("172.16.0.0/12")
+	srv := NewServer(ctx, Options{
+		NodeID:  node.ID(),
+		Storage: node.Storage(),
+		Plugins: plugs,
+		RBAC:    rbac.NewNoopEvaluator(),
+		Meshnet: &staticNetworkManager{Manager: node.Network(), networkv4: network},
+	})
+	callerCtx := peer.NewContext(ctx, &peer.Peer{
+		Addr: net.TCPAddrFromAddrPort(netip.AddrPortFrom(network.Addr().Next(), 8443)),
+	})
+	callerCtx = metadata.NewIncomingContext(callerCtx, metadata.Pairs(leaderproxy.DemoteMeta, "true"))
+
+	// Demotions may not carry other updates.
+	_, err = srv.Update(callerCtx, &v1.UpdateRequest{Id: node.ID().String(), PrimaryEndpoint: "10.0.0.1"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument demoting with other updates, got %v", err)
+	}
+	// The only voter is the leader, which may never be demoted.
+	_, err = srv.Update(callerCtx, &v1.UpdateRequest{Id: node.ID().String()})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition demoting the leader, got %v", err)
+	}
+}
+
+func newTestProvider(ctx context.Context, t *testing.T) storage.Provider {
+	t.Helper()
+	transport, err := tcp.NewRaftTransport(nil, tcp.RaftTransportOptions{
+		Addr:    "[::]:0",
+		MaxPool: 10,
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("create raft transport: %v", err)
+	}
+	opts := raftstorage.NewOptions(types.NodeID(uuid.NewString()), transport)
+	opts.InMemory = true
+	provider := raftstorage.NewProvider(opts)
+	testutil.MustStartProvider(ctx, t, provider)
+	t.Cleanup(func() { provider.Close() })
+	return provider
+}
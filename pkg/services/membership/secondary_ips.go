@@ -0,0 +1,114 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"log/slog"
+	"slices"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// EnsureSecondaryIPs makes sure the given node holds exactly count secondary
+// IPv4 leases on top of its primary address, allocating new leases or dropping
+// the most recent ones as needed. Peers include secondary leases in the allowed
+// IPs for the node. Nodes may only request leases for themselves.
+func (s *Server) EnsureSecondaryIPs(ctx context.Context, id types.NodeID, count int) (types.SecondaryIPs, error) {
+	if !s.storage.Consensus().IsLeader() {
+		return types.SecondaryIPs{}, status.Errorf(codes.FailedPrecondition, "not leader")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	log := s.log.With("op", "ensure-secondary-ips", "id", id)
+	if err := s.loadMeshState(ctx); err != nil {
+		return types.SecondaryIPs{}, status.Errorf(codes.Internal, "failed to load mesh state: %v", err)
+	}
+	if id == "" {
+		return types.SecondaryIPs{}, status.Error(codes.InvalidArgument, "node id required")
+	} else if !types.IsValidNodeID(id.String()) {
+		return types.SecondaryIPs{}, status.Error(codes.InvalidArgument, "node id is invalid")
+	}
+	if count < 0 {
+		return types.SecondaryIPs{}, status.Error(codes.InvalidArgument, "secondary ip count must not be negative")
+	}
+	peer, err := s.storage.MeshDB().Peers().Get(ctx, id)
+	if err != nil {
+		if errors.IsNodeNotFound(err) {
+			return types.SecondaryIPs{}, status.Errorf(codes.FailedPrecondition, "node %s not found", id)
+		}
+		return types.SecondaryIPs{}, status.Errorf(codes.Internal, "failed to lookup peer: %v", err)
+	}
+	if !s.callerIsNode(ctx, peer) {
+		return types.SecondaryIPs{}, status.Errorf(codes.PermissionDenied, "caller is not node %s", id)
+	}
+	nw := s.storage.MeshDB().Networking()
+	leases, err := nw.GetSecondaryIPs(ctx, id)
+	if err != nil {
+		return types.SecondaryIPs{}, status.Errorf(codes.Internal, "failed to lookup secondary leases: %v", err)
+	}
+	leases.NodeID = id
+	if len(leases.Addresses) == count {
+		return leases, nil
+	}
+	if len(leases.Addresses) > count {
+		log.Info("Releasing secondary IPs from node", slog.Any("ipv4", leases.Addresses[count:]))
+		leases.Addresses = leases.Addresses[:count]
+		if err := nw.PutSecondaryIPs(ctx, leases); err != nil {
+			return types.SecondaryIPs{}, status.Errorf(codes.Internal, "failed to persist secondary leases: %v", err)
+		}
+		return leases, nil
+	}
+	allowed, err := s.rbac.Evaluate(ctx, rbac.Actions{canPutRouteAction})
+	if err != nil {
+		return types.SecondaryIPs{}, status.Errorf(codes.Internal, "failed to evaluate permissions: %v", err)
+	}
+	if !allowed {
+		log.Warn("Node not allowed to allocate secondary IPs")
+		return types.SecondaryIPs{}, status.Error(codes.PermissionDenied, "not allowed")
+	}
+	for len(leases.Addresses) < count {
+		// Leases are persisted one at a time so the IPAM sees the previous allocation.
+		lease, err := s.plugins.AllocateIP(ctx, &v1.AllocateIPRequest{
+			NodeID: id.String(),
+			Subnet: s.ipv4Prefix.String(),
+		})
+		switch {
+		case errors.Is(err, plugins.ErrSubnetExhausted):
+			return types.SecondaryIPs{}, status.Errorf(codes.ResourceExhausted, "failed to allocate IPv4 address: %v", err)
+		case err != nil:
+			return types.SecondaryIPs{}, status.Errorf(codes.Internal, "failed to allocate IPv4 address: %v", err)
+		}
+		// IPAM plugins with static assignments may hand back an address the node already holds.
+		if lease == peer.PrivateAddrV4() || slices.Contains(leases.Addresses, lease) {
+			return types.SecondaryIPs{}, status.Errorf(codes.FailedPrecondition, "address %s is already leased to node %s", lease, id)
+		}
+		leases.Addresses = append(leases.Addresses, lease)
+		if err := nw.PutSecondaryIPs(ctx, leases); err != nil {
+			return types.SecondaryIPs{}, status.Errorf(codes.Internal, "failed to persist secondary lease: %v", err)
+		}
+		log.Info("Allocated secondary IP to node", slog.String("ipv4", lease.String()))
+	}
+	return leases, nil
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestEnsureSecondaryIPs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	srv := NewServer(ctx, Options{
+		NodeID:  node.ID(),
+		Storage: node.Storage(),
+		Plugins: plugs,
+		RBAC:    rbac.NewNoopEvaluator(),
+		Meshnet: node.Network(),
+	})
+	var primary netip.Prefix
+	for _, id := range []string{"node-a", "node-b"} {
+		resp, err := srv.Join(ctx, &v1.JoinRequest{
+			Id:         id,
+			PublicKey:  newEncodedPubKey(t),
+			AssignIPv4: true,
+		})
+		if err != nil {
+			t.Fatalf("join %s: %v", id, err)
+		}
+		if id == "node-a" {
+			primary = netip.MustParsePrefix(resp.GetAddressIPv4())
+		}
+	}
+	callerCtx := peer.NewContext(ctx, &peer.Peer{Addr: net.TCPAddrFromAddrPort(netip.AddrPortFrom(primary.Addr(), 443))})
+
+	leases, err := srv.EnsureSecondaryIPs(callerCtx, types.NodeID("node-a"), 2)
+	if err != nil {
+		t.Fatalf("ensure secondary ips: %v", err)
+	}
+	if len(leases.Addresses) != 2 {
+		t.Fatalf("expected 2 secondary ips, got %v", leases.Addresses)
+	}
+	if slices.Contains(leases.Addresses, primary) || leases.Addresses[0] == leases.Addresses[1] {
+		t.Fatalf("expected distinct secondary ips apart from primary %s, got %v", primary, leases.Addresses)
+	}
+	// Leases are not routes.
+	routes, err := node.Storage().MeshDB().Networking().ListRoutes(ctx)
+	if err != nil {
+		t.Fatalf("list routes: %v", err)
+	}
+	if len(routes) != 0 {
+		t.Fatalf("expected secondary leases to not be stored as routes, got %v", routes)
+	}
+	// A subsequent join must not be handed a secondary lease.
+	resp, err := srv.Join(ctx, &v1.JoinRequest{
+		Id:         "node-c",
+		PublicKey:  newEncodedPubKey(t),
+		AssignIPv4: true,
+	})
+	if err != nil {
+		t.Fatalf("join node-c: %v", err)
+	}
+	if slices.Contains(leases.Addresses, netip.MustParsePrefix(resp.GetAddressIPv4())) {
+		t.Fatalf("secondary lease %s was allocated to another node", resp.GetAddressIPv4())
+	}
+
+	peers, err := meshnet.WireGuardPeersFor(ctx, node.Storage().MeshDB(), node.ID())
+	if err != nil {
+		t.Fatalf("compute wireguard peers: %v", err)
+	}
+	var found bool
+	for _, peer := range peers {
+		if peer.GetNode().GetId() != "node-a" {
+			continue
+		}
+		found = true
+		for _, addr := range append([]netip.Prefix{primary}, leases.Addresses...) {
+			if !slices.Contains(peer.GetAllowedIPs(), addr.String()) {
+				t.Errorf("expected allowed IPs for node-a to contain %s, got %v", addr, peer.GetAllowedIPs())
+			}
+			if slices.Contains(peer.GetAllowedRoutes(), addr.String()) {
+				t.Errorf("expected %s to not be treated as a route, got %v", addr, peer.GetAllowedRoutes())
+			}
+		}
+	}
+	if !found {
+		t.Fatal("expected node-a in computed peers")
+	}
+
+	// Requesting fewer leases drops the extra ones.
+	trimmed, err := srv.EnsureSecondaryIPs(callerCtx, types.NodeID("node-a"), 1)
+	if err != nil {
+		t.Fatalf("ensure secondary ips: %v", err)
+	}
+	if !slices.Equal(trimmed.Addresses, leases.Addresses[:1]) {
+		t.Fatalf("expected leases to be trimmed to %v, got %v", leases.Addresses[:1], trimmed.Addresses)
+	}
+
+	// Nodes may only request leases for themselves.
+	_, err = srv.EnsureSecondaryIPs(ctx, types.NodeID("node-a"), 2)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied for another caller, got %v", err)
+	}
+	// Unknown nodes cannot be allocated addresses.
+	_, err = srv.EnsureSecondaryIPs(callerCtx, types.NodeID("unknown-node"), 1)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for unknown node, got %v", err)
+	}
+
+	// Leases are released when the node is removed.
+	nodeA, err := node.Storage().MeshDB().Peers().Get(ctx, types.NodeID("node-a"))
+	if err != nil {
+		t.Fatalf("get node-a: %v", err)
+	}
+	if err := srv.removeNode(ctx, nodeA); err != nil {
+		t.Fatalf("remove node-a: %v", err)
+	}
+	released, err := node.Storage().MeshDB().Networking().GetSecondaryIPs(ctx, types.NodeID("node-a"))
+	if err != nil {
+		t.Fatalf("get secondary ips: %v", err)
+	}
+	if len(released.Addresses) != 0 {
+		t.Fatalf("expected leases to be released, got %v", released.Addresses)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"log/slog"
 	"net/netip"
 	"sync"
+	"time"
 
 	v1 "github.com/webmeshproj/api/go/v1"
 
@@ -32,22 +33,40 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/services/rbac"
 	"github.com/webmeshproj/webmesh/pkg/storage"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
+	"github.com/webmeshproj/webmesh/pkg/version"
 )
 
 // Server is the webmesh Membership service.
 type Server struct {
 	v1.UnimplementedMembershipServer
 
-	nodeID     types.NodeID
-	storage    storage.Provider
-	plugins    plugins.Manager
-	rbac       rbac.Evaluator
-	meshnet    meshnet.Manager
-	ipv4Prefix netip.Prefix
-	ipv6Prefix netip.Prefix
-	meshDomain string
-	log        *slog.Logger
-	mu         sync.Mutex
+	nodeID                types.NodeID
+	storage               storage.Provider
+	plugins               plugins.Manager
+	rbac                  rbac.Evaluator
+	meshnet               meshnet.Manager
+	ipv4Prefix            netip.Prefix
+	ipv6Prefix            netip.Prefix
+	meshDomain            string
+	v6fallback            bool
+	validateFeatures      bool
+	probeMode             EndpointProbeMode
+	probeTimeout          time.Duration
+	probeWindow           time.Duration
+	heartbeats            heartbeatTracker
+	heartbeatSyncInterval time.Duration
+	joinTokenSecret       []byte
+	requireJoinToken      bool
+	version               string
+	skipVersionCheck      bool
+	maxJoinApplyLag       uint64
+	maxJoinGoroutines     int
+	joinRetryAfter        time.Duration
+	loadFunc              func() loadSignals
+	deadNodeThreshold     time.Duration
+	stopBackground        context.CancelFunc
+	log                   *slog.Logger
+	mu                    sync.Mutex
 }
 
 // Options are the options for the Membership service.
@@ -57,18 +76,121 @@ type Options struct {
 	Plugins plugins.Manager
 	RBAC    rbac.Evaluator
 	Meshnet meshnet.Manager
+	// IPv6OnlyOnExhaustion allows nodes to join with only an IPv6 address
+	// when the IPv4 network has no more addresses available.
+	IPv6OnlyOnExhaustion bool
+	// ValidateFeatures rejects joins and updates from nodes whose advertised
+	// features are inconsistent, e.g. a feature without a port.
+	ValidateFeatures bool
+	// EndpointProbe enables a reachability probe against the primary endpoint
+	// of joined nodes. Nodes that are not reachable within the probe window
+	// are logged, and removed in strict mode.
+	EndpointProbe EndpointProbeMode
+	// EndpointProbeTimeout is the timeout for each reachability probe. Defaults
+	// to DefaultEndpointProbeTimeout.
+	EndpointProbeTimeout time.Duration
+	// EndpointProbeWindow is how long a joined node is given to become
+	// reachable. Defaults to DefaultEndpointProbeWindow.
+	EndpointProbeWindow time.Duration
+	// HeartbeatSyncInterval is how often heartbeats received by the leader
+	// are written to storage. Defaults to DefaultHeartbeatSyncInterval.
+	HeartbeatSyncInterval time.Duration
+	// JoinTokenSecret is the secret join tokens are signed with. When set, nodes
+	// may present a join token that grants them the permissions in its claims
+	// instead of those from RBAC.
+	JoinTokenSecret []byte
+	// RequireJoinToken rejects joins that do not present a valid join token.
+	RequireJoinToken bool
+	// Version is the version of this node. Joining nodes that report an
+	// incompatible version are rejected. Defaults to version.Version.
+	Version string
+	// SkipVersionCheck lets nodes reporting an incompatible version join,
+	// logging a warning instead of rejecting them.
+	SkipVersionCheck bool
+	// MaxJoinApplyLag rejects joins with Unavailable while more than this many
+	// committed log entries have not been applied locally. Zero disables the check.
+	MaxJoinApplyLag uint64
+	// MaxJoinGoroutines rejects joins with Unavailable while more than this many
+	// goroutines are running. Zero disables the check.
+	MaxJoinGoroutines int
+	// JoinRetryAfter is the retry hint returned with joins rejected for load.
+	// Defaults to DefaultJoinRetryAfter.
+	JoinRetryAfter time.Duration
+	// DeadNodeThreshold enables removing nodes from the peers DB once their
+	// last heartbeat is older than the threshold and they are not storage
+	// members. Zero disables the collector.
+	DeadNodeThreshold time.Duration
+	// DeadNodeGCInterval is how often the leader looks for dead nodes.
+	// Defaults to DefaultDeadNodeGCInterval.
+	DeadNodeGCInterval time.Duration
 }
 
 // NewServer returns a new Server.
 func NewServer(ctx context.Context, opts Options) *Server {
-	return &Server{
-		nodeID:  opts.NodeID,
-		storage: opts.Storage,
-		plugins: opts.Plugins,
-		rbac:    opts.RBAC,
-		meshnet: opts.Meshnet,
-		log:     context.LoggerFrom(ctx).With("component", "membership-server"),
+	if opts.EndpointProbeTimeout <= 0 {
+		opts.EndpointProbeTimeout = DefaultEndpointProbeTimeout
 	}
+	if opts.EndpointProbeWindow <= 0 {
+		opts.EndpointProbeWindow = DefaultEndpointProbeWindow
+	}
+	if opts.HeartbeatSyncInterval <= 0 {
+		opts.HeartbeatSyncInterval = DefaultHeartbeatSyncInterval
+	}
+	if opts.Version == "" {
+		opts.Version = version.Version
+	}
+	if opts.JoinRetryAfter <= 0 {
+		opts.JoinRetryAfter = DefaultJoinRetryAfter
+	}
+	if opts.DeadNodeGCInterval <= 0 {
+		opts.DeadNodeGCInterval = DefaultDeadNodeGCInterval
+	}
+	srv := &Server{
+		nodeID:           opts.NodeID,
+		storage:          opts.Storage,
+		plugins:          opts.Plugins,
+		rbac:             opts.RBAC,
+		meshnet:          opts.Meshnet,
+		v6fallback:       opts.IPv6OnlyOnExhaustion,
+		validateFeatures: opts.ValidateFeatures,
+		probeMode:        opts.EndpointProbe,
+		probeTimeout:     opts.EndpointProbeTimeout,
+		probeWindow:      opts.EndpointProbeWindow,
+		heartbeats: heartbeatTracker{
+			beats: make(map[types.NodeID]time.Time),
+		},
+		heartbeatSyncInterval: opts.HeartbeatSyncInterval,
+		joinTokenSecret:       opts.JoinTokenSecret,
+		requireJoinToken:      opts.RequireJoinToken,
+		version:               opts.Version,
+		skipVersionCheck:      opts.SkipVersionCheck,
+		maxJoinApplyLag:       opts.MaxJoinApplyLag,
+		maxJoinGoroutines:     opts.MaxJoinGoroutines,
+		joinRetryAfter:        opts.JoinRetryAfter,
+		deadNodeThreshold:     opts.DeadNodeThreshold,
+		log:                   context.LoggerFrom(ctx).With("component", "membership-server"),
+	}
+	srv.loadFunc = srv.currentLoad
+	bgCtx, cancel := context.WithCancel(context.WithLogger(context.Background(), srv.log))
+	srv.stopBackground = cancel
+	go srv.runHeartbeatSync(bgCtx)
+	if srv.deadNodeThreshold > 0 {
+		go srv.runDeadNodeGC(bgCtx, opts.DeadNodeGCInterval)
+	}
+	return srv
+}
+
+// Drain writes any pending heartbeats to storage and stops the background
+// heartbeat sync and dead node collector.
+func (s *Server) Drain(ctx context.Context) error {
+	defer s.stopBackground()
+	if !s.storage.Consensus().IsLeader() {
+		return nil
+	}
+	if err := s.SyncHeartbeats(ctx); err != nil {
+		return fmt.Errorf("sync heartbeats: %w", err)
+	}
+	return nil
 }
 
 func (s *Server) loadMeshState(ctx context.Context) error {
@@ -106,7 +228,7 @@ Routes:
 		}
 		// This is a new route, start managing an auto route for the node.
 		rt := types.Route{Route: &v1.Route{
-			Name:             nodeAutoRoute(nodeID),
+			Name:             storage.NodeAutoRouteName(nodeID),
 			Node:             nodeID.String(),
 			DestinationCIDRs: routes,
 		}}
@@ -120,10 +242,6 @@ Routes:
 	return false, nil
 }
 
-func nodeAutoRoute(nodeID types.NodeID) string {
-	return fmt.Sprintf("%s-auto", nodeID)
-}
-
 func nodeIDMatchesContext(ctx context.Context, nodeID string) bool {
 	if proxiedFor, ok := leaderproxy.ProxiedFor(ctx); ok {
 		return proxiedFor == nodeID
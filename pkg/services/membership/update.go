@@ -17,17 +17,22 @@ limitations under the License.
 package membership
 
 import (
+	"fmt"
 	"log/slog"
+	"net"
 	"net/netip"
 	"sort"
+	"strconv"
 
 	"github.com/google/go-cmp/cmp"
 	v1 "github.com/webmeshproj/api/go/v1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
 	"github.com/webmeshproj/webmesh/pkg/services/rbac"
 	"github.com/webmeshproj/webmesh/pkg/storage/errors"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
@@ -42,6 +47,43 @@ func (s *Server) Update(ctx context.Context, req *v1.UpdateRequest) (*v1.UpdateR
 	if !s.storage.Consensus().IsLeader() {
 		return nil, status.Errorf(codes.FailedPrecondition, "not leader")
 	}
+	count, ok, err := leaderproxy.SecondaryIPs(ctx)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if ok {
+		// Secondary IP requests carry only the node ID, like heartbeats.
+		if !isHeartbeat(req) {
+			return nil, status.Error(codes.InvalidArgument, "secondary ip requests cannot carry other updates")
+		}
+		if _, err := s.EnsureSecondaryIPs(ctx, types.NodeID(req.GetId()), count); err != nil {
+			return nil, err
+		}
+		return &v1.UpdateResponse{}, nil
+	}
+	if leaderproxy.Demote(ctx) {
+		// Demotions carry only the node ID, like heartbeats.
+		if !isHeartbeat(req) {
+			return nil, status.Error(codes.InvalidArgument, "demote requests cannot carry other updates")
+		}
+		if err := s.Demote(ctx, types.NodeID(req.GetId())); err != nil {
+			return nil, err
+		}
+		return &v1.UpdateResponse{}, nil
+	}
+	if isHeartbeat(req) {
+		if err := s.Heartbeat(ctx, types.NodeID(req.GetId())); err != nil {
+			return nil, err
+		}
+		return &v1.UpdateResponse{}, nil
+	}
+	if s.plugins.HasAuth() && isPromotionOnly(req) && !nodeIDMatchesContext(ctx, req.GetId()) {
+		// Admins may promote other nodes, but not change anything else about them.
+		if err := s.Promote(ctx, types.NodeID(req.GetId())); err != nil {
+			return nil, err
+		}
+		return &v1.UpdateResponse{}, nil
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	log := s.log.With("op", "update", "id", req.GetId())
@@ -49,7 +91,7 @@ func (s *Server) Update(ctx context.Context, req *v1.UpdateRequest) (*v1.UpdateR
 
 	log.Debug("Update request received", slog.Any("request", req))
 	// Check if we haven't loaded the mesh domain and prefixes into memory yet
-	err := s.loadMeshState(ctx)
+	err = s.loadMeshState(ctx)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to load mesh state: %v", err)
 	}
@@ -60,6 +102,16 @@ func (s *Server) Update(ctx context.Context, req *v1.UpdateRequest) (*v1.UpdateR
 	} else if !types.IsValidNodeID(req.GetId()) {
 		return nil, status.Error(codes.InvalidArgument, "node id is invalid")
 	}
+	if req.GetPrimaryEndpoint() != "" {
+		if _, err := netip.ParseAddr(req.GetPrimaryEndpoint()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid primary endpoint %q: %v", req.GetPrimaryEndpoint(), err)
+		}
+	}
+	for _, ep := range req.GetWireguardEndpoints() {
+		if err := validateWireGuardEndpoint(ep); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid wireguard endpoint %q: %v", ep, err)
+		}
+	}
 	if s.plugins.HasAuth() {
 		if !nodeIDMatchesContext(ctx, req.GetId()) {
 			return nil, status.Errorf(codes.PermissionDenied, "node id %s does not match authenticated caller", req.GetId())
@@ -85,6 +137,11 @@ func (s *Server) Update(ctx context.Context, req *v1.UpdateRequest) (*v1.UpdateR
 			return nil, status.Errorf(codes.InvalidArgument, "invalid public key: %v", err)
 		}
 	}
+	if s.validateFeatures && len(req.GetFeatures()) > 0 {
+		if err := types.ValidateFeatures(req.GetFeatures()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid feature advertisement: %v", err)
+		}
+	}
 
 	// We can go ahead and check here if the node is allowed to do what they want.
 	var actions rbac.Actions
@@ -115,10 +172,10 @@ func (s *Server) Update(ctx context.Context, req *v1.UpdateRequest) (*v1.UpdateR
 	peer, err := p.Get(ctx, types.NodeID(req.GetId()))
 	if err != nil {
 		if errors.IsNodeNotFound(err) {
-			return nil, status.Errorf(codes.Internal, "failed to lookup peer: %v", err)
+			// Peer doesn't exist, they need to call Join first
+			return nil, status.Errorf(codes.FailedPrecondition, "node %s not found", req.GetId())
 		}
-		// Peer doesn't exist, they need to call Join first
-		return nil, status.Errorf(codes.FailedPrecondition, "node %s not found", req.GetId())
+		return nil, status.Errorf(codes.Internal, "failed to lookup peer: %v", err)
 	}
 	// Determine the peer's current status
 	for _, server := range storageStatus.GetPeers() {
@@ -206,3 +263,25 @@ func (s *Server) Update(ctx context.Context, req *v1.UpdateRequest) (*v1.UpdateR
 	}
 	return &v1.UpdateResponse{}, nil
 }
+
+// validateWireGuardEndpoint checks that an endpoint is a host and port pair.
+// Hostnames are allowed since peers resolve them when configuring WireGuard.
+func validateWireGuardEndpoint(ep string) error {
+	host, port, err := net.SplitHostPort(ep)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid port")
+	}
+	return nil
+}
+
+// isPromotionOnly returns true if the request does nothing but ask
+// for the node to be made a voter.
+func isPromotionOnly(req *v1.UpdateRequest) bool {
+	return req.GetAsVoter() && proto.Equal(req, &v1.UpdateRequest{Id: req.GetId(), AsVoter: true})
+}
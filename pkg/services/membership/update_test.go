@@ -0,0 +1,148 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package membership
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage/testutil"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestUpdateEndpoints(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	plugs, err := plugins.NewManager(ctx, plugins.Options{Storage: node.Storage()})
+	if err != nil {
+		t.Fatalf("create plugin manager: %v", err)
+	}
+	srv := NewServer(ctx, Options{
+		NodeID:  node.ID(),
+		Storage: node.Storage(),
+		Plugins: plugs,
+		RBAC:    rbac.NewNoopEvaluator(),
+		Meshnet: inNetworkManager{node.Network(), netip.MustParsePrefix("172.16.0.0/12")},
+	})
+	_, err = srv.Join(ctx, &v1.JoinRequest{
+		Id:                 "roaming-node",
+		PublicKey:          newEncodedPubKey(t),
+		AssignIPv4:         true,
+		PrimaryEndpoint:    "192.0.2.10",
+		WireguardEndpoints: []string{"192.0.2.10:51820"},
+	})
+	if err != nil {
+		t.Fatalf("join: %v", err)
+	}
+
+	// Record endpoint changes as peers would see them.
+	var mu sync.Mutex
+	var seen string
+	cancel, err := node.Storage().MeshDB().Peers().Subscribe(ctx, func(nodes []types.MeshNode) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, n := range nodes {
+			if n.GetId() == "roaming-node" {
+				seen = n.GetPrimaryEndpoint()
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("subscribe to peers: %v", err)
+	}
+	t.Cleanup(cancel)
+
+	inNetwork := peer.NewContext(ctx, &peer.Peer{
+		Addr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort("172.16.0.2:8443")),
+	})
+	_, err = srv.Update(inNetwork, &v1.UpdateRequest{
+		Id:                 "roaming-node",
+		PrimaryEndpoint:    "198.51.100.20",
+		WireguardEndpoints: []string{"198.51.100.20:51820", "roaming.example.com:51820"},
+	})
+	if err != nil {
+		t.Fatalf("update endpoints: %v", err)
+	}
+	ok := testutil.Eventually[string](func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen
+	}).ShouldEqual(time.Second*5, time.Millisecond*100, "198.51.100.20")
+	if !ok {
+		t.Fatalf("expected subscribers to see the new primary endpoint, got %q", seen)
+	}
+	updated, err := node.Storage().MeshDB().Peers().Get(ctx, "roaming-node")
+	if err != nil {
+		t.Fatalf("get peer: %v", err)
+	}
+	if !slices.Equal(updated.GetWireguardEndpoints(), []string{"198.51.100.20:51820", "roaming.example.com:51820"}) {
+		t.Fatalf("unexpected wireguard endpoints: %v", updated.GetWireguardEndpoints())
+	}
+
+	t.Run("OutOfNetwork", func(t *testing.T) {
+		_, err := srv.Update(ctx, &v1.UpdateRequest{Id: "roaming-node", PrimaryEndpoint: "203.0.113.1"})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("expected PermissionDenied, got %v", err)
+		}
+	})
+	t.Run("InvalidEndpoint", func(t *testing.T) {
+		_, err := srv.Update(inNetwork, &v1.UpdateRequest{Id: "roaming-node", WireguardEndpoints: []string{"203.0.113.1"}})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("expected InvalidArgument, got %v", err)
+		}
+		_, err = srv.Update(inNetwork, &v1.UpdateRequest{Id: "roaming-node", PrimaryEndpoint: "roaming.example.com"})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("expected InvalidArgument, got %v", err)
+		}
+	})
+	t.Run("UnknownNode", func(t *testing.T) {
+		_, err := srv.Update(inNetwork, &v1.UpdateRequest{Id: "unknown-node", PrimaryEndpoint: "203.0.113.1"})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("expected FailedPrecondition, got %v", err)
+		}
+	})
+}
+
+// inNetworkManager reports a fixed mesh network, since the test mesh
+// does not configure one.
+type inNetworkManager struct {
+	meshnet.Manager
+	network netip.Prefix
+}
+
+func (m inNetworkManager) NetworkV4() netip.Prefix { return m.network }
+
+func (m inNetworkManager) NetworkV6() netip.Prefix { return netip.Prefix{} }
@@ -0,0 +1,170 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshapi
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+const (
+	// PageSizeMeta is the metadata key for the maximum number of nodes
+	// returned by a ListNodes call.
+	PageSizeMeta = "x-webmesh-page-size"
+	// PageTokenMeta is the metadata key for the token of the page to return.
+	PageTokenMeta = "x-webmesh-page-token"
+	// NextPageTokenMeta is the response header carrying the token of the next
+	// page. It is only set when more nodes remain.
+	NextPageTokenMeta = "x-webmesh-next-page-token"
+	// IDPrefixFilterMeta is the metadata key for filtering nodes by ID prefix.
+	IDPrefixFilterMeta = "x-webmesh-filter-id-prefix"
+	// FeatureFilterMeta is the metadata key for filtering nodes by feature.
+	// It may be given more than once, in which case nodes must have all features.
+	FeatureFilterMeta = "x-webmesh-filter-feature"
+	// ZoneFilterMeta is the metadata key for filtering nodes by zone awareness ID.
+	ZoneFilterMeta = "x-webmesh-filter-zone"
+)
+
+// ListNodesOptions are the pagination and filter options for ListNodes,
+// read from the metadata keys above. The zero value lists every node.
+type ListNodesOptions struct {
+	// PageSize is the maximum number of nodes to return. Zero means no limit.
+	PageSize int
+	// PageToken is the token returned with the previous page.
+	PageToken string
+	// IDPrefix only matches nodes whose ID starts with the prefix.
+	IDPrefix string
+	// Features only matches nodes that expose all of the given features.
+	Features []v1.Feature
+	// ZoneID only matches nodes in the given zone.
+	ZoneID string
+}
+
+// ListNodesOptionsFromContext parses the list options from the incoming metadata.
+func ListNodesOptionsFromContext(ctx context.Context) (ListNodesOptions, error) {
+	var opts ListNodesOptions
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return opts, nil
+	}
+	if v := md.Get(PageSizeMeta); len(v) > 0 && v[0] != "" {
+		size, err := strconv.Atoi(v[0])
+		if err != nil || size < 0 {
+			return opts, fmt.Errorf("invalid page size %q", v[0])
+		}
+		opts.PageSize = size
+	}
+	if v := md.Get(PageTokenMeta); len(v) > 0 {
+		opts.PageToken = v[0]
+	}
+	if v := md.Get(IDPrefixFilterMeta); len(v) > 0 {
+		opts.IDPrefix = v[0]
+	}
+	if v := md.Get(ZoneFilterMeta); len(v) > 0 {
+		opts.ZoneID = v[0]
+	}
+	for _, v := range md.Get(FeatureFilterMeta) {
+		feature, err := ParseFeature(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Features = append(opts.Features, feature)
+	}
+	return opts, nil
+}
+
+// AppendToOutgoingContext appends the list options to the outgoing metadata.
+func (o ListNodesOptions) AppendToOutgoingContext(ctx context.Context) context.Context {
+	var kv []string
+	if o.PageSize > 0 {
+		kv = append(kv, PageSizeMeta, strconv.Itoa(o.PageSize))
+	}
+	if o.PageToken != "" {
+		kv = append(kv, PageTokenMeta, o.PageToken)
+	}
+	if o.IDPrefix != "" {
+		kv = append(kv, IDPrefixFilterMeta, o.IDPrefix)
+	}
+	if o.ZoneID != "" {
+		kv = append(kv, ZoneFilterMeta, o.ZoneID)
+	}
+	for _, feature := range o.Features {
+		kv = append(kv, FeatureFilterMeta, feature.String())
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// ParseFeature parses a feature name. Names are case-insensitive and may
+// use dashes in place of underscores.
+func ParseFeature(name string) (v1.Feature, error) {
+	feature, ok := v1.Feature_value[strings.ReplaceAll(strings.ToUpper(name), "-", "_")]
+	if !ok {
+		return v1.Feature_FEATURE_NONE, fmt.Errorf("unknown feature %q", name)
+	}
+	return v1.Feature(feature), nil
+}
+
+// filters returns the storage filters for the options.
+func (o ListNodesOptions) filters() []storage.PeerFilter {
+	var filters []storage.PeerFilter
+	if o.IDPrefix != "" {
+		filters = append(filters, storage.FilterByIDPrefix(o.IDPrefix))
+	}
+	if o.ZoneID != "" {
+		filters = append(filters, storage.FilterByZoneID(o.ZoneID))
+	}
+	for _, feature := range o.Features {
+		filters = append(filters, storage.FilterByFeature(feature))
+	}
+	return filters
+}
+
+// paginate sorts the nodes by ID and returns the requested page along with
+// the token for the next one. The token is empty on the last page.
+func (o ListNodesOptions) paginate(nodes []types.MeshNode) ([]types.MeshNode, string, error) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].GetId() < nodes[j].GetId()
+	})
+	if o.PageToken != "" {
+		after, err := base64.RawURLEncoding.DecodeString(o.PageToken)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid page token %q", o.PageToken)
+		}
+		start := sort.Search(len(nodes), func(i int) bool {
+			return nodes[i].GetId() > string(after)
+		})
+		nodes = nodes[start:]
+	}
+	if o.PageSize == 0 || len(nodes) <= o.PageSize {
+		return nodes, "", nil
+	}
+	nodes = nodes[:o.PageSize]
+	return nodes, base64.RawURLEncoding.EncodeToString([]byte(nodes[len(nodes)-1].GetId())), nil
+}
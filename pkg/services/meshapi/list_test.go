@@ -0,0 +1,182 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshapi
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestListNodesFilters(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	defer db.Close()
+
+	nodes := []*v1.MeshNode{
+		{Id: "edge-1", ZoneAwarenessID: "us-east", Features: []*v1.FeaturePort{{Feature: v1.Feature_NODES}}},
+		{Id: "edge-2", ZoneAwarenessID: "us-west", Features: []*v1.FeaturePort{{Feature: v1.Feature_NODES}, {Feature: v1.Feature_MESH_DNS}}},
+		{Id: "core-1", ZoneAwarenessID: "us-east", Features: []*v1.FeaturePort{{Feature: v1.Feature_MESH_DNS}}},
+	}
+	for _, node := range nodes {
+		node.PublicKey = mustGeneratePublicKey(t)
+		if err := db.Peers().Put(ctx, types.MeshNode{MeshNode: node}); err != nil {
+			t.Fatalf("put peer %q: %v", node.Id, err)
+		}
+	}
+	srv := NewServer(db)
+
+	tc := []struct {
+		name string
+		opts ListNodesOptions
+		want []string
+	}{
+		{
+			name: "NoFilters",
+			want: []string{"core-1", "edge-1", "edge-2"},
+		},
+		{
+			name: "IDPrefix",
+			opts: ListNodesOptions{IDPrefix: "edge-"},
+			want: []string{"edge-1", "edge-2"},
+		},
+		{
+			name: "Zone",
+			opts: ListNodesOptions{ZoneID: "us-east"},
+			want: []string{"core-1", "edge-1"},
+		},
+		{
+			name: "Feature",
+			opts: ListNodesOptions{Features: []v1.Feature{v1.Feature_MESH_DNS}},
+			want: []string{"core-1", "edge-2"},
+		},
+		{
+			name: "Combined",
+			opts: ListNodesOptions{IDPrefix: "edge-", Features: []v1.Feature{v1.Feature_MESH_DNS}},
+			want: []string{"edge-2"},
+		},
+		{
+			name: "NoMatches",
+			opts: ListNodesOptions{ZoneID: "eu-central"},
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := srv.ListNodes(incomingContext(tt.opts), &emptypb.Empty{})
+			if err != nil {
+				t.Fatalf("list nodes: %v", err)
+			}
+			var got []string
+			for _, node := range resp.GetNodes() {
+				got = append(got, node.GetId())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected nodes %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		for _, md := range []metadata.MD{
+			metadata.Pairs(PageSizeMeta, "-1"),
+			metadata.Pairs(FeatureFilterMeta, "not-a-feature"),
+			metadata.Pairs(PageTokenMeta, "!"),
+		} {
+			_, err := srv.ListNodes(metadata.NewIncomingContext(ctx, md), &emptypb.Empty{})
+			if err == nil {
+				t.Errorf("expected error for metadata %v", md)
+			}
+		}
+	})
+}
+
+func TestListNodesPagination(t *testing.T) {
+	t.Parallel()
+	var nodes []types.MeshNode
+	for i := 9; i >= 0; i-- {
+		nodes = append(nodes, types.MeshNode{MeshNode: &v1.MeshNode{Id: fmt.Sprintf("node-%d", i)}})
+	}
+	for _, size := range []int{1, 3, 5, 10, 11} {
+		opts := ListNodesOptions{PageSize: size}
+		var got []string
+		var pages int
+		for {
+			page, next, err := opts.paginate(nodes)
+			if err != nil {
+				t.Fatalf("page size %d: paginate: %v", size, err)
+			}
+			if len(page) > size {
+				t.Fatalf("page size %d: got page of %d nodes", size, len(page))
+			}
+			for _, node := range page {
+				got = append(got, node.GetId())
+			}
+			pages++
+			if next == "" {
+				break
+			}
+			opts.PageToken = next
+		}
+		var want []string
+		for i := 0; i < 10; i++ {
+			want = append(want, fmt.Sprintf("node-%d", i))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("page size %d: expected nodes %v, got %v", size, want, got)
+		}
+		if wantPages := max(1, (10+size-1)/size); pages != wantPages {
+			t.Errorf("page size %d: expected %d pages, got %d", size, wantPages, pages)
+		}
+	}
+}
+
+func TestListNodesOptionsMetadata(t *testing.T) {
+	t.Parallel()
+	opts := ListNodesOptions{
+		PageSize:  25,
+		PageToken: "bm9kZS0x",
+		IDPrefix:  "edge-",
+		Features:  []v1.Feature{v1.Feature_NODES, v1.Feature_MESH_DNS},
+		ZoneID:    "us-east",
+	}
+	got, err := ListNodesOptionsFromContext(incomingContext(opts))
+	if err != nil {
+		t.Fatalf("parse options: %v", err)
+	}
+	if !reflect.DeepEqual(got, opts) {
+		t.Errorf("expected options %+v, got %+v", opts, got)
+	}
+	feature, err := ParseFeature("mesh-dns")
+	if err != nil || feature != v1.Feature_MESH_DNS {
+		t.Errorf("expected mesh-dns to parse as MESH_DNS, got %v, %v", feature, err)
+	}
+}
+
+// incomingContext returns a server context carrying the options as a client would send them.
+func incomingContext(opts ListNodesOptions) context.Context {
+	md, _ := metadata.FromOutgoingContext(opts.AppendToOutgoingContext(context.Background()))
+	return metadata.NewIncomingContext(context.Background(), md)
+}
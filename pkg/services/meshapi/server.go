@@ -20,9 +20,12 @@ package meshapi
 import (
 	"bytes"
 	"context"
+	"sort"
 
 	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 
@@ -54,11 +57,26 @@ func (s *Server) GetNode(ctx context.Context, req *v1.GetNodeRequest) (*v1.MeshN
 	return node.MeshNode, nil
 }
 
+// ListNodes lists nodes in the mesh. Pagination and filters are read from the
+// request metadata, see ListNodesOptions. Without them every node is returned.
 func (s *Server) ListNodes(ctx context.Context, req *emptypb.Empty) (*v1.NodeList, error) {
-	nodes, err := s.storage.Peers().List(ctx)
+	opts, err := ListNodesOptionsFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	nodes, err := s.storage.Peers().List(ctx, opts.filters()...)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to get node: %v", err)
 	}
+	nodes, next, err := opts.paginate(nodes)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if next != "" {
+		if err := grpc.SetHeader(ctx, metadata.Pairs(NextPageTokenMeta, next)); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to set next page token: %v", err)
+		}
+	}
 	out := make([]*v1.MeshNode, len(nodes))
 	for i, node := range nodes {
 		out[i] = node.MeshNode
@@ -81,16 +99,20 @@ func (s *Server) GetMeshGraph(ctx context.Context, _ *emptypb.Empty) (*v1.MeshGr
 	for _, id := range nodeIDs {
 		idStrs = append(idStrs, id.String())
 	}
+	// Sort the nodes and edges so exports of the same topology are comparable.
+	sort.Strings(idStrs)
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Source == edges[j].Source {
+			return edges[i].Target < edges[j].Target
+		}
+		return edges[i].Source < edges[j].Source
+	})
 	out := &v1.MeshGraph{
 		Nodes: idStrs,
 		Edges: make([]*v1.MeshEdge, len(edges)),
 	}
 	for i, edge := range edges {
-		out.Edges[i] = &v1.MeshEdge{
-			Source: edge.Source.String(),
-			Target: edge.Target.String(),
-			Weight: int32(edge.Properties.Weight),
-		}
+		out.Edges[i] = types.Edge(edge).ToMeshEdge(edge.Source, edge.Target).MeshEdge
 	}
 	var buf bytes.Buffer
 	err = types.DrawPeerGraph(ctx, s.storage.Peers().Graph(), &buf)
@@ -0,0 +1,100 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshapi
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestGetMeshGraph(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := meshdb.NewTestDB()
+	defer db.Close()
+
+	// A small site-to-site topology.
+	for _, id := range []string{"site2-router", "site1-follower", "site1-router", "site2-follower"} {
+		err := db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:        id,
+			PublicKey: mustGeneratePublicKey(t),
+		}})
+		if err != nil {
+			t.Fatalf("put peer %q: %v", id, err)
+		}
+	}
+	edges := []*v1.MeshEdge{
+		{Source: "site2-router", Target: "site2-follower", Weight: 1},
+		{Source: "site1-router", Target: "site2-router", Weight: 99},
+		{Source: "site1-router", Target: "site1-follower", Weight: 1},
+	}
+	for _, edge := range edges {
+		err := db.Peers().PutEdge(ctx, types.MeshEdge{MeshEdge: edge})
+		if err != nil {
+			t.Fatalf("put edge %s -> %s: %v", edge.Source, edge.Target, err)
+		}
+	}
+
+	srv := NewServer(db)
+	graph, err := srv.GetMeshGraph(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatalf("get mesh graph: %v", err)
+	}
+	wantNodes := []string{"site1-follower", "site1-router", "site2-follower", "site2-router"}
+	if !reflect.DeepEqual(graph.GetNodes(), wantNodes) {
+		t.Errorf("expected nodes %v, got %v", wantNodes, graph.GetNodes())
+	}
+	// Edges should be returned sorted by source then target.
+	wantEdges := [][3]any{
+		{"site1-follower", "site1-router", int32(1)},
+		{"site1-router", "site2-router", int32(99)},
+		{"site2-follower", "site2-router", int32(1)},
+	}
+	var gotEdges [][3]any
+	for _, edge := range graph.GetEdges() {
+		gotEdges = append(gotEdges, [3]any{edge.GetSource(), edge.GetTarget(), edge.GetWeight()})
+	}
+	if !reflect.DeepEqual(gotEdges, wantEdges) {
+		t.Errorf("expected edges %v, got %v", wantEdges, gotEdges)
+	}
+	for _, id := range wantNodes {
+		if !strings.Contains(graph.GetDot(), id) {
+			t.Errorf("expected DOT output to contain node %q", id)
+		}
+	}
+}
+
+func mustGeneratePublicKey(t *testing.T) string {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := key.PublicKey().Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
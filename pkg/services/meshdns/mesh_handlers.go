@@ -108,7 +108,20 @@ func (s *meshLookupMux) handleMeshLookup(ctx context.Context, w dns.ResponseWrit
 			return
 		}
 		nodeID := parts[0]
-		err := s.appendPeerToMessage(ctx, mesh, r, m, nodeID, s.ipv6Only)
+		// Static records shadow any node with the same name.
+		answered, err := s.appendStaticRecordsToMessage(ctx, mesh, r, m, strings.ToLower(nodeID))
+		if err != nil {
+			s.log.Error("Failed to lookup static records", slog.String("error", err.Error()))
+			s.writeMsg(w, r, m, dns.RcodeServerFailure)
+			s.mu.RUnlock()
+			return
+		}
+		if answered {
+			s.writeMsg(w, r, m, dns.RcodeSuccess)
+			s.mu.RUnlock()
+			return
+		}
+		err = s.appendPeerToMessage(ctx, mesh, r, m, nodeID, s.ipv6Only)
 		if err != nil {
 			if errors.IsNodeNotFound(err) {
 				// Try the next mesh
@@ -0,0 +1,85 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshdns
+
+import (
+	"log/slog"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// appendStaticRecordsToMessage answers the question with any static records stored
+// for the given name. Static records take precedence over node records, so when any
+// exist for the name it is considered answered even if none match the question type.
+func (s *Server) appendStaticRecordsToMessage(ctx context.Context, dom meshDomain, r, m *dns.Msg, name string) (bool, error) {
+	records, err := dom.storage.MeshDB().MeshState().GetDNSRecords(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	if len(records) == 0 {
+		return false, nil
+	}
+	s.log.Debug("Found static records for name", slog.String("name", name), slog.Int("records", len(records)))
+	fqdn := newFQDN(dom, name)
+	for _, q := range r.Question {
+		for _, record := range records {
+			hdr := dns.RR_Header{Name: fqdn, Class: dns.ClassINET, Ttl: record.TTL}
+			if hdr.Ttl == 0 {
+				hdr.Ttl = 1
+			}
+			switch {
+			case record.Type == types.DNSRecordTypeCNAME:
+				// A CNAME is the only record for its name and answers every question type.
+				hdr.Rrtype = dns.TypeCNAME
+				m.Answer = append(m.Answer, &dns.CNAME{Hdr: hdr, Target: cnameTarget(dom, record.Values[0])})
+			case record.Type == types.DNSRecordTypeA && q.Qtype == dns.TypeA:
+				hdr.Rrtype = dns.TypeA
+				for _, value := range record.Values {
+					addr, err := netip.ParseAddr(value)
+					if err != nil {
+						continue
+					}
+					m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: addr.AsSlice()})
+				}
+			case record.Type == types.DNSRecordTypeAAAA && q.Qtype == dns.TypeAAAA:
+				hdr.Rrtype = dns.TypeAAAA
+				for _, value := range record.Values {
+					addr, err := netip.ParseAddr(value)
+					if err != nil {
+						continue
+					}
+					m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: addr.AsSlice()})
+				}
+			}
+		}
+	}
+	return true, nil
+}
+
+// cnameTarget returns the fully qualified target for a CNAME record. Single
+// label targets are treated as names within the mesh domain.
+func cnameTarget(dom meshDomain, target string) string {
+	if !strings.Contains(strings.TrimSuffix(target, "."), ".") {
+		return newFQDN(dom, strings.TrimSuffix(target, "."))
+	}
+	return dns.CanonicalName(target)
+}
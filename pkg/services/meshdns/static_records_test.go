@@ -0,0 +1,136 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshdns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestStaticRecords(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	srv := NewServer(ctx, &Options{DisableForwarding: true})
+	err = srv.RegisterDomain(DomainOptions{
+		NodeID:      node.ID(),
+		MeshDomain:  node.Domain(),
+		MeshStorage: node.Storage(),
+	})
+	if err != nil {
+		t.Fatalf("register domain: %v", err)
+	}
+	state := node.Storage().MeshDB().MeshState()
+	lookup := func(t *testing.T, name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		req := new(dns.Msg)
+		req.SetQuestion(dns.Fqdn(name+"."+node.Domain()), qtype)
+		w := &recordingWriter{}
+		srv.meshmuxes[0].handleMeshLookup(ctx, w, req)
+		if w.msg == nil {
+			t.Fatal("expected a response to be written")
+		}
+		return w.msg
+	}
+	addrsOf := func(msg *dns.Msg) []string {
+		var out []string
+		for _, rr := range msg.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				out = append(out, a.A.String())
+			}
+		}
+		return out
+	}
+
+	t.Run("ServeStaticRecord", func(t *testing.T) {
+		err := state.PutDNSRecord(ctx, types.DNSRecord{
+			Name:   "vip",
+			Type:   types.DNSRecordTypeA,
+			Values: []string{"10.10.10.10"},
+		})
+		if err != nil {
+			t.Fatalf("put dns record: %v", err)
+		}
+		msg := lookup(t, "vip", dns.TypeA)
+		if msg.Rcode != dns.RcodeSuccess {
+			t.Fatalf("expected success, got %s", dns.RcodeToString[msg.Rcode])
+		}
+		if got := addrsOf(msg); len(got) != 1 || got[0] != "10.10.10.10" {
+			t.Fatalf("expected static address 10.10.10.10, got %v", got)
+		}
+		// The name exists, so other types are answered with no data.
+		msg = lookup(t, "vip", dns.TypeAAAA)
+		if msg.Rcode != dns.RcodeSuccess || len(msg.Answer) != 0 {
+			t.Fatalf("expected empty success for AAAA, got %s with %d answers", dns.RcodeToString[msg.Rcode], len(msg.Answer))
+		}
+		// CNAMEs cannot be mixed with other types.
+		err = state.PutDNSRecord(ctx, types.DNSRecord{
+			Name:   "vip",
+			Type:   types.DNSRecordTypeCNAME,
+			Values: []string{"example.com"},
+		})
+		if err == nil {
+			t.Fatal("expected error mixing CNAME with an A record")
+		}
+	})
+
+	t.Run("PrecedenceOverNode", func(t *testing.T) {
+		name := node.ID().String()
+		msg := lookup(t, name, dns.TypeA)
+		if got := addrsOf(msg); len(got) != 1 || got[0] == "192.0.2.1" {
+			t.Fatalf("expected the node's own address before a static record exists, got %v", got)
+		}
+		err := state.PutDNSRecord(ctx, types.DNSRecord{
+			Name:   name,
+			Type:   types.DNSRecordTypeA,
+			Values: []string{"192.0.2.1"},
+		})
+		if err != nil {
+			t.Fatalf("put dns record: %v", err)
+		}
+		msg = lookup(t, name, dns.TypeA)
+		if got := addrsOf(msg); len(got) != 1 || got[0] != "192.0.2.1" {
+			t.Fatalf("expected static record to take precedence over node, got %v", got)
+		}
+		if err := state.DeleteDNSRecord(ctx, name, types.DNSRecordTypeA); err != nil {
+			t.Fatalf("delete dns record: %v", err)
+		}
+		msg = lookup(t, name, dns.TypeA)
+		if got := addrsOf(msg); len(got) != 1 || got[0] == "192.0.2.1" {
+			t.Fatalf("expected node address after deleting static record, got %v", got)
+		}
+	})
+}
+
+type recordingWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *recordingWriter) WriteMsg(msg *dns.Msg) error {
+	w.msg = msg
+	return nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+// DefaultClusterScrapeTimeout is the default time allowed to gather the status
+// of each cluster member.
+const DefaultClusterScrapeTimeout = 5 * time.Second
+
+// ClusterSource provides the members of the storage consensus and their status
+// for the aggregated cluster metrics.
+type ClusterSource interface {
+	// Members returns the IDs of the members of the storage consensus.
+	Members(ctx context.Context) ([]string, error)
+	// Status returns the status of the member with the given ID.
+	Status(ctx context.Context, id string) (*v1.Status, error)
+}
+
+// clusterMetrics are the gauges exported for every cluster member.
+type clusterMetrics struct {
+	members      promapi.Gauge
+	scrapeFailed *promapi.GaugeVec
+	info         *promapi.GaugeVec
+	leader       *promapi.GaugeVec
+	uptime       *promapi.GaugeVec
+	peers        *promapi.GaugeVec
+	rxBytes      *promapi.GaugeVec
+	txBytes      *promapi.GaugeVec
+}
+
+func newClusterMetrics(reg *promapi.Registry) *clusterMetrics {
+	m := &clusterMetrics{
+		members: promapi.NewGauge(promapi.GaugeOpts{
+			Namespace: "webmesh",
+			Subsystem: "cluster",
+			Name:      "members",
+			Help:      "The number of members in the storage consensus.",
+		}),
+		scrapeFailed: promapi.NewGaugeVec(promapi.GaugeOpts{
+			Namespace: "webmesh",
+			Subsystem: "cluster",
+			Name:      "scrape_failed",
+			Help:      "Whether gathering the status of the member failed.",
+		}, []string{"node_id"}),
+		info: promapi.NewGaugeVec(promapi.GaugeOpts{
+			Namespace: "webmesh",
+			Subsystem: "cluster",
+			Name:      "member_info",
+			Help:      "Version and cluster status of the member.",
+		}, []string{"node_id", "version", "cluster_status"}),
+		leader: promapi.NewGaugeVec(promapi.GaugeOpts{
+			Namespace: "webmesh",
+			Subsystem: "cluster",
+			Name:      "member_is_leader",
+			Help:      "Whether the member is the current leader.",
+		}, []string{"node_id"}),
+		uptime: promapi.NewGaugeVec(promapi.GaugeOpts{
+			Namespace: "webmesh",
+			Subsystem: "cluster",
+			Name:      "member_uptime_seconds",
+			Help:      "Time since the member started.",
+		}, []string{"node_id"}),
+		peers: promapi.NewGaugeVec(promapi.GaugeOpts{
+			Namespace: "webmesh",
+			Subsystem: "cluster",
+			Name:      "member_wireguard_peers",
+			Help:      "The number of WireGuard peers of the member.",
+		}, []string{"node_id"}),
+		rxBytes: promapi.NewGaugeVec(promapi.GaugeOpts{
+			Namespace: "webmesh",
+			Subsystem: "cluster",
+			Name:      "member_receive_bytes",
+			Help:      "Total bytes received on the WireGuard interface of the member.",
+		}, []string{"node_id"}),
+		txBytes: promapi.NewGaugeVec(promapi.GaugeOpts{
+			Namespace: "webmesh",
+			Subsystem: "cluster",
+			Name:      "member_transmit_bytes",
+			Help:      "Total bytes transmitted on the WireGuard interface of the member.",
+		}, []string{"node_id"}),
+	}
+	reg.MustRegister(m.members, m.scrapeFailed, m.info, m.leader, m.uptime, m.peers, m.rxBytes, m.txBytes)
+	return m
+}
+
+func (m *clusterMetrics) observe(id string, status *v1.Status, now time.Time) {
+	m.scrapeFailed.WithLabelValues(id).Set(0)
+	m.info.WithLabelValues(id, status.GetVersion(), status.GetClusterStatus().String()).Set(1)
+	var leader float64
+	if status.GetClusterStatus() == v1.ClusterStatus_CLUSTER_LEADER {
+		leader = 1
+	}
+	m.leader.WithLabelValues(id).Set(leader)
+	if status.GetStartedAt() != nil {
+		m.uptime.WithLabelValues(id).Set(now.Sub(status.GetStartedAt().AsTime()).Seconds())
+	}
+	if iface := status.GetInterfaceMetrics(); iface != nil {
+		m.peers.WithLabelValues(id).Set(float64(iface.GetNumPeers()))
+		m.rxBytes.WithLabelValues(id).Set(float64(iface.GetTotalReceiveBytes()))
+		m.txBytes.WithLabelValues(id).Set(float64(iface.GetTotalTransmitBytes()))
+	}
+}
+
+// serveCluster gathers the status of every cluster member and serves it in the
+// Prometheus text format. Members that cannot be reached are reported with
+// scrape_failed set instead of failing the whole response.
+func (s *Server) serveCluster(w http.ResponseWriter, r *http.Request) {
+	members, err := s.Cluster.Members(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	timeout := s.ClusterScrapeTimeout
+	if timeout <= 0 {
+		timeout = DefaultClusterScrapeTimeout
+	}
+	reg := promapi.NewRegistry()
+	m := newClusterMetrics(reg)
+	m.members.Set(float64(len(members)))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, id := range members {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			status, err := s.Cluster.Status(ctx, id)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				s.log.Debug("Failed to gather cluster member status", slog.String("node-id", id), slog.String("error", err.Error()))
+				m.scrapeFailed.WithLabelValues(id).Set(1)
+				return
+			}
+			m.observe(id, status, time.Now())
+		}(id)
+	}
+	wg.Wait()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -20,8 +20,15 @@ limitations under the License.
 package metrics
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
 	promapi "github.com/prometheus/client_golang/prometheus"
@@ -29,6 +36,7 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
 )
 
 // DefaultListenAddress is the default listen address for the node Metrics.
@@ -43,13 +51,100 @@ type Options struct {
 	ListenAddress string
 	// Path is the path to expose metrics on.
 	Path string
+	// CORS are the CORS options for the metrics server.
+	CORS CORSOptions
+	// DiagnosticsPath is the path to serve the network diagnostics report on
+	// as JSON. The report is only served when Diagnostics is also set.
+	DiagnosticsPath string
+	// Diagnostics gathers the network diagnostics report.
+	Diagnostics func(context.Context) (meshnet.Report, error)
+	// ClusterPath is the path to serve metrics aggregated from every member of
+	// the storage consensus on. They are only served when Cluster is also set.
+	ClusterPath string
+	// Cluster provides the members whose status is aggregated.
+	Cluster ClusterSource
+	// ClusterScrapeTimeout is how long each member is given to report its
+	// status. Defaults to DefaultClusterScrapeTimeout.
+	ClusterScrapeTimeout time.Duration
+	// ConfigPath is the path to serve the effective configuration of the node
+	// on as JSON. It is only served when Config is also set.
+	ConfigPath string
+	// Config returns the effective configuration of the node. Secrets must
+	// already be redacted.
+	Config func() map[string]any
+	// TrustedSource reports whether the diagnostics report and the effective
+	// configuration may be served to a client at the given address. They
+	// reveal the mesh topology, so when nil they are only served to loopback
+	// addresses. Clients presenting a verified TLS certificate are always trusted.
+	TrustedSource func(netip.Addr) bool
+	// TLSConfig serves the metrics server over TLS when set.
+	TLSConfig *tls.Config
+}
+
+// CORSOptions contains the CORS configuration for an HTTP server. When no origins
+// are allowed, no CORS headers are sent and browsers enforce same-origin access.
+type CORSOptions struct {
+	// AllowedOrigins is a list of origins allowed to make cross-origin requests.
+	// A single "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedMethods is a list of methods allowed for cross-origin requests.
+	// Defaults to GET and HEAD.
+	AllowedMethods []string
+	// AllowedHeaders is a list of request headers allowed for cross-origin requests.
+	AllowedHeaders []string
+}
+
+// Enabled returns true if any cross-origin requests are allowed.
+func (c CORSOptions) Enabled() bool {
+	return len(c.AllowedOrigins) > 0
+}
+
+// AllowsOrigin returns true if the given origin is allowed.
+func (c CORSOptions) AllowsOrigin(origin string) bool {
+	return origin != "" && (slices.Contains(c.AllowedOrigins, "*") || slices.Contains(c.AllowedOrigins, origin))
+}
+
+// Handler wraps the given handler with CORS handling.
+func (c CORSOptions) Handler(next http.Handler) http.Handler {
+	if !c.Enabled() {
+		return next
+	}
+	methods := c.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !c.AllowsOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if len(c.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
 }
 
 // Server is the metrics server.
 type Server struct {
 	Options
-	srv *http.Server
-	log *slog.Logger
+	srv    *http.Server
+	closed bool
+	log    *slog.Logger
+	mu     sync.Mutex
 }
 
 // New returns a new metrics server.
@@ -62,27 +157,108 @@ func New(ctx context.Context, o Options) *Server {
 
 // ListenAndServe starts the server and blocks until the server exits.
 func (s *Server) ListenAndServe() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
 	s.log.Info("Starting Prometheus metrics server", slog.String("listen_address", s.ListenAddress), slog.String("path", s.Path))
 	srv := &http.Server{
-		Addr: s.ListenAddress,
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path == s.Path {
-				promhttp.Handler().ServeHTTP(w, r)
-			} else {
-				http.NotFound(w, r)
-			}
-		}),
+		Addr:      s.ListenAddress,
+		Handler:   s.Handler(),
+		TLSConfig: s.TLSConfig,
+	}
+	s.srv = srv
+	s.mu.Unlock()
+	var err error
+	if s.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
 	}
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err != nil && err != http.ErrServerClosed {
 		s.log.Error("metrics server failed", slog.String("error", err.Error()))
 	}
 	return nil
 }
 
+// Handler returns the HTTP handler for the metrics server.
+func (s *Server) Handler() http.Handler {
+	return s.CORS.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == s.Path:
+			promhttp.Handler().ServeHTTP(w, r)
+		case s.DiagnosticsPath != "" && s.Diagnostics != nil && r.URL.Path == s.DiagnosticsPath:
+			if !s.trusted(r) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			s.serveDiagnostics(w, r)
+		case s.ClusterPath != "" && s.Cluster != nil && r.URL.Path == s.ClusterPath:
+			s.serveCluster(w, r)
+		case s.ConfigPath != "" && s.Config != nil && r.URL.Path == s.ConfigPath:
+			if !s.trusted(r) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			s.serveConfig(w)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// trusted reports whether the request may be served the diagnostics report
+// and the effective configuration.
+func (s *Server) trusted(r *http.Request) bool {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	addrport, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrport.Addr().Unmap()
+	if s.TrustedSource != nil {
+		return s.TrustedSource(addr)
+	}
+	return addr.IsLoopback()
+}
+
+func (s *Server) serveDiagnostics(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Diagnostics(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		s.log.Error("Failed to encode diagnostics report", slog.String("error", err.Error()))
+	}
+}
+
+func (s *Server) serveConfig(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s.Config()); err != nil {
+		s.log.Error("Failed to encode effective configuration", slog.String("error", err.Error()))
+	}
+}
+
 // Shutdown attempts to stop the server gracefully.
 func (s *Server) Shutdown(ctx context.Context) error {
 	context.LoggerFrom(ctx).Info("Shutting down Prometheus metrics server")
-	return s.srv.Shutdown(ctx)
+	s.mu.Lock()
+	s.closed = true
+	srv := s.srv
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
 }
 
 // AppendMetricsMiddlewares appends the Prometheus metrics middlewares to the
@@ -0,0 +1,332 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name        string
+		cors        CORSOptions
+		origin      string
+		wantCode    int
+		wantOrigin  string
+		wantMethods string
+		wantHeaders string
+	}{
+		{
+			name:   "SameOriginOnlyByDefault",
+			cors:   CORSOptions{},
+			origin: "https://dashboard.example.com",
+			// The request is passed through without any CORS headers.
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "AllowedOrigin",
+			cors: CORSOptions{
+				AllowedOrigins: []string{"https://dashboard.example.com"},
+				AllowedHeaders: []string{"Authorization"},
+			},
+			origin:      "https://dashboard.example.com",
+			wantCode:    http.StatusNoContent,
+			wantOrigin:  "https://dashboard.example.com",
+			wantMethods: "GET, HEAD",
+			wantHeaders: "Authorization",
+		},
+		{
+			name: "DisallowedOrigin",
+			cors: CORSOptions{
+				AllowedOrigins: []string{"https://dashboard.example.com"},
+			},
+			origin:   "https://evil.example.com",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "WildcardOrigin",
+			cors: CORSOptions{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{http.MethodGet},
+			},
+			origin:      "https://any.example.com",
+			wantCode:    http.StatusNoContent,
+			wantOrigin:  "https://any.example.com",
+			wantMethods: "GET",
+		},
+	}
+
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv := New(context.Background(), Options{
+				ListenAddress: DefaultListenAddress,
+				Path:          DefaultPath,
+				CORS:          tt.cors,
+			})
+			req := httptest.NewRequest(http.MethodOptions, DefaultPath, nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d", tt.wantCode, rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("expected allowed origin %q, got %q", tt.wantOrigin, got)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("expected allowed methods %q, got %q", tt.wantMethods, got)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Headers"); got != tt.wantHeaders {
+				t.Errorf("expected allowed headers %q, got %q", tt.wantHeaders, got)
+			}
+		})
+	}
+
+	t.Run("SimpleRequest", func(t *testing.T) {
+		t.Parallel()
+		srv := New(context.Background(), Options{
+			Path: DefaultPath,
+			CORS: CORSOptions{AllowedOrigins: []string{"https://dashboard.example.com"}},
+		})
+		req := httptest.NewRequest(http.MethodGet, DefaultPath, nil)
+		req.Header.Set("Origin", "https://dashboard.example.com")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://dashboard.example.com" {
+			t.Errorf("expected allowed origin to be echoed, got %q", got)
+		}
+	})
+}
+
+func TestDiagnosticsPath(t *testing.T) {
+	t.Parallel()
+	srv := New(context.Background(), Options{
+		Path:            DefaultPath,
+		DiagnosticsPath: "/diagnostics",
+		Diagnostics: func(context.Context) (meshnet.Report, error) {
+			return meshnet.Report{NodeID: "node"}, nil
+		},
+	})
+	req := httptest.NewRequest(http.MethodGet, "/diagnostics", nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var report meshnet.Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if report.NodeID != "node" {
+		t.Errorf("expected report for node, got %q", report.NodeID)
+	}
+
+	// The report is not served to untrusted clients.
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/diagnostics", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d for a remote client, got %d", http.StatusForbidden, rec.Code)
+	}
+	srv.TrustedSource = func(addr netip.Addr) bool {
+		return netip.MustParsePrefix("192.0.2.0/24").Contains(addr)
+	}
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/diagnostics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d for a trusted client, got %d", http.StatusOK, rec.Code)
+	}
+
+	// Without a path the report is not served.
+	srv = New(context.Background(), Options{Path: DefaultPath, Diagnostics: srv.Diagnostics})
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/diagnostics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	t.Parallel()
+	srv := New(context.Background(), Options{
+		Path:       DefaultPath,
+		ConfigPath: "/config",
+		Config: func() map[string]any {
+			return map[string]any{"mesh": map[string]any{"node-id": "node"}}
+		},
+	})
+	req := httptest.NewRequest(http.MethodGet, "/config", nil)
+	req.RemoteAddr = "[::1]:40000"
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var conf map[string]map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&conf); err != nil {
+		t.Fatalf("decode config: %v", err)
+	}
+	if conf["mesh"]["node-id"] != "node" {
+		t.Errorf("expected config for node, got %v", conf)
+	}
+
+	// The config is not served to untrusted clients.
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d for a remote client, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	// Without a path the config is not served.
+	srv = New(context.Background(), Options{Path: DefaultPath, Config: srv.Config})
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestClusterPath(t *testing.T) {
+	t.Parallel()
+	startedAt := time.Now().Add(-time.Hour)
+	srv := New(context.Background(), Options{
+		Path:        DefaultPath,
+		ClusterPath: "/cluster",
+		Cluster: fakeCluster{
+			"leader": &v1.Status{
+				Id:            "leader",
+				Version:       "v1.0.0",
+				ClusterStatus: v1.ClusterStatus_CLUSTER_LEADER,
+				StartedAt:     timestamppb.New(startedAt),
+				InterfaceMetrics: &v1.InterfaceMetrics{
+					NumPeers:          2,
+					TotalReceiveBytes: 1024,
+				},
+			},
+			// The voter cannot be reached.
+			"voter": nil,
+		},
+	})
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cluster", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"webmesh_cluster_members 2",
+		`webmesh_cluster_scrape_failed{node_id="leader"} 0`,
+		`webmesh_cluster_scrape_failed{node_id="voter"} 1`,
+		`webmesh_cluster_member_info{cluster_status="CLUSTER_LEADER",node_id="leader",version="v1.0.0"} 1`,
+		`webmesh_cluster_member_is_leader{node_id="leader"} 1`,
+		`webmesh_cluster_member_wireguard_peers{node_id="leader"} 2`,
+		`webmesh_cluster_member_receive_bytes{node_id="leader"} 1024`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected cluster metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `webmesh_cluster_member_info{cluster_status="CLUSTER_STATUS_UNKNOWN",node_id="voter"`) {
+		t.Errorf("expected no status to be reported for the unreachable member")
+	}
+}
+
+// fakeCluster serves the given statuses, members with a nil status fail to report.
+type fakeCluster map[string]*v1.Status
+
+func (f fakeCluster) Members(context.Context) ([]string, error) {
+	ids := make([]string, 0, len(f))
+	for id := range f {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (f fakeCluster) Status(_ context.Context, id string) (*v1.Status, error) {
+	if f[id] == nil {
+		return nil, errors.New("connection refused")
+	}
+	return f[id], nil
+}
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("BeforeListen", func(t *testing.T) {
+		t.Parallel()
+		srv := New(ctx, Options{ListenAddress: "127.0.0.1:0", Path: "/metrics"})
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_ = srv.ListenAndServe()
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected server not to start after shutdown")
+		}
+	})
+
+	t.Run("WhileListening", func(t *testing.T) {
+		t.Parallel()
+		srv := New(ctx, Options{ListenAddress: "127.0.0.1:0", Path: "/metrics"})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_ = srv.ListenAndServe()
+		}()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if err := srv.Shutdown(ctx); err != nil {
+				t.Fatalf("shutdown: %v", err)
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("expected server to stop after shutdown")
+			}
+		}
+	})
+}
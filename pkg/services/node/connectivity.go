@@ -0,0 +1,198 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/netutil"
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// DefaultConnectivityTimeout is the default time to wait for replies
+// when testing connectivity to another node.
+const DefaultConnectivityTimeout = 5 * time.Second
+
+const (
+	// ConnectivityTestMeta is the metadata key on a GetStatus request naming
+	// a node to test connectivity to from the node the status is requested for.
+	ConnectivityTestMeta = "x-webmesh-connectivity-test"
+	// ConnectivityResultMeta is the GetStatus response header carrying the
+	// JSON encoded ConnectivityResult of a requested test.
+	ConnectivityResultMeta = "x-webmesh-connectivity-result-bin"
+)
+
+var testConnectivityAction = rbac.Actions{
+	{
+		Verb:     v1.RuleVerb_VERB_GET,
+		Resource: v1.RuleResource_RESOURCE_EDGES,
+	},
+}
+
+// ConnectivityResult is the outcome of a connectivity test between two nodes.
+type ConnectivityResult struct {
+	// Source is the node the test was run from.
+	Source types.NodeID `json:"source"`
+	// Destination is the node that was tested.
+	Destination types.NodeID `json:"destination"`
+	// Address is the private address of the destination that was pinged.
+	Address netip.Addr `json:"address,omitempty"`
+	// Via is the direct peer traffic to the destination is routed through.
+	Via types.NodeID `json:"via,omitempty"`
+	// Reachable is true if the destination replied.
+	Reachable bool `json:"reachable"`
+	// Latency is the round trip time of the test when reachable.
+	Latency time.Duration `json:"latency,omitempty"`
+	// Reason describes why the destination was unreachable.
+	Reason string `json:"reason,omitempty"`
+}
+
+// TestConnectivity pings dst over the WireGuard interface and reports whether
+// it replied and how long it took. An empty src is treated as this node. Tests
+// from other nodes are run on them through GetStatus. Before sending any
+// traffic the computed peers of src are checked, so destinations blocked by
+// network ACLs are reported as unreachable without waiting for a timeout.
+func (s *Server) TestConnectivity(ctx context.Context, src, dst types.NodeID) (ConnectivityResult, error) {
+	if src == "" {
+		src = s.NodeID
+	}
+	result := ConnectivityResult{Source: src, Destination: dst}
+	if dst == "" {
+		return result, status.Error(codes.InvalidArgument, "destination node id required")
+	}
+	if dst == src {
+		return result, status.Error(codes.InvalidArgument, "source and destination are the same node")
+	}
+	if src != s.NodeID {
+		return s.testRemoteConnectivity(ctx, src, dst)
+	}
+	db := s.Storage.MeshDB()
+	peer, err := db.Peers().Get(ctx, dst)
+	if err != nil {
+		if errors.IsNodeNotFound(err) {
+			return result, status.Errorf(codes.NotFound, "node %s not found", dst)
+		}
+		return result, status.Errorf(codes.Internal, "failed to lookup node: %v", err)
+	}
+	switch {
+	case peer.PrivateAddrV4().IsValid():
+		result.Address = peer.PrivateAddrV4().Addr()
+	case peer.PrivateAddrV6().IsValid():
+		result.Address = peer.PrivateAddrV6().Addr()
+	default:
+		result.Reason = "destination has no private address"
+		return result, nil
+	}
+	peers, err := meshnet.WireGuardPeersFor(ctx, db, src)
+	if err != nil {
+		return result, status.Errorf(codes.Internal, "failed to compute peers: %v", err)
+	}
+Peers:
+	for _, wgpeer := range peers {
+		for _, ip := range wgpeer.GetAllowedIPs() {
+			prefix, err := netip.ParsePrefix(ip)
+			if err != nil {
+				continue
+			}
+			if prefix.Contains(result.Address) {
+				result.Via = types.NodeID(wgpeer.GetNode().GetId())
+				break Peers
+			}
+		}
+	}
+	if result.Via == "" {
+		result.Reason = "no route to destination, it may be blocked by network ACLs"
+		return result, nil
+	}
+	ping := s.ping
+	if ping == nil {
+		ping = netutil.Ping
+	}
+	timeout := s.ConnectivityTimeout
+	if timeout <= 0 {
+		timeout = DefaultConnectivityTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	if err := ping(ctx, result.Address); err != nil {
+		result.Reason = fmt.Sprintf("ping %s: %v", result.Address, err)
+		return result, nil
+	}
+	result.Latency = time.Since(start)
+	result.Reachable = true
+	s.log.Debug("Tested connectivity to node", "destination", dst, "via", result.Via, "latency", result.Latency)
+	return result, nil
+}
+
+// testRemoteConnectivity runs a connectivity test on the src node.
+func (s *Server) testRemoteConnectivity(ctx context.Context, src, dst types.NodeID) (ConnectivityResult, error) {
+	result := ConnectivityResult{Source: src, Destination: dst}
+	if s.NodeDialer == nil {
+		return result, status.Errorf(codes.FailedPrecondition, "connectivity from %s must be tested on that node", src)
+	}
+	conn, err := s.NodeDialer.DialNode(ctx, src)
+	if err != nil {
+		return result, status.Errorf(codes.Unavailable, "failed to dial %s: %v", src, err)
+	}
+	defer conn.Close()
+	var header metadata.MD
+	ctx = metadata.AppendToOutgoingContext(ctx, ConnectivityTestMeta, dst.String())
+	if caller, ok := context.AuthenticatedCallerFrom(ctx); ok {
+		ctx = metadata.AppendToOutgoingContext(ctx, leaderproxy.ProxiedForMeta, caller)
+	}
+	_, err = v1.NewNodeClient(conn).GetStatus(ctx, &v1.GetStatusRequest{Id: src.String()}, grpc.Header(&header))
+	if err != nil {
+		return result, err
+	}
+	encoded := header.Get(ConnectivityResultMeta)
+	if len(encoded) == 0 {
+		return result, status.Errorf(codes.Unimplemented, "%s does not support connectivity tests", src)
+	}
+	if err := json.Unmarshal([]byte(encoded[0]), &result); err != nil {
+		return result, status.Errorf(codes.Internal, "failed to decode connectivity result: %v", err)
+	}
+	return result, nil
+}
+
+// connectivityTestFrom returns the destination of a connectivity test
+// requested with a GetStatus call, if any.
+func connectivityTestFrom(ctx context.Context) (types.NodeID, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	dst := md.Get(ConnectivityTestMeta)
+	if len(dst) == 0 || dst[0] == "" {
+		return "", false
+	}
+	return types.NodeID(dst[0]), true
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/crypto"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/transport"
+	"github.com/webmeshproj/webmesh/pkg/meshnode"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestTestConnectivity(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	node, err := meshnode.NewSingleNodeTestMesh(ctx)
+	if err != nil {
+		t.Fatalf("create test mesh: %v", err)
+	}
+	t.Cleanup(func() { node.Close(ctx) })
+	db := node.Storage().MeshDB()
+	key, err := crypto.MustGenerateKey().PublicKey().Encode()
+	if err != nil {
+		t.Fatalf("encode public key: %v", err)
+	}
+	err = db.Peers().Put(ctx, types.MeshNode{MeshNode: &v1.MeshNode{
+		Id:                 "peer",
+		PublicKey:          key,
+		PrimaryEndpoint:    "10.0.0.2",
+		WireguardEndpoints: []string{"10.0.0.2:51820"},
+		PrivateIPv4:        "172.16.0.100/32",
+	}})
+	if err != nil {
+		t.Fatalf("put peer: %v", err)
+	}
+	err = db.Peers().PutEdge(ctx, types.MeshEdge{MeshEdge: &v1.MeshEdge{
+		Source: node.ID().String(),
+		Target: "peer",
+	}})
+	if err != nil {
+		t.Fatalf("put edge: %v", err)
+	}
+	var pinged []netip.Addr
+	srv := NewServer(ctx, Options{
+		NodeID:  node.ID(),
+		Storage: node.Storage(),
+	})
+	srv.ping = func(_ context.Context, addr netip.Addr) error {
+		pinged = append(pinged, addr)
+		return nil
+	}
+
+	// Connected nodes are reachable.
+	result, err := srv.TestConnectivity(ctx, "", "peer")
+	if err != nil {
+		t.Fatalf("test connectivity: %v", err)
+	}
+	if !result.Reachable {
+		t.Fatalf("expected peer to be reachable, got reason %q", result.Reason)
+	}
+	if result.Via != "peer" {
+		t.Errorf("expected traffic via peer, got %q", result.Via)
+	}
+	if want := netip.MustParseAddr("172.16.0.100"); len(pinged) != 1 || pinged[0] != want {
+		t.Errorf("expected a single ping to %s, got %v", want, pinged)
+	}
+
+	// Failed pings are reported as unreachable.
+	srv.ping = func(context.Context, netip.Addr) error { return fmt.Errorf("no replies received") }
+	result, err = srv.TestConnectivity(ctx, node.ID(), "peer")
+	if err != nil {
+		t.Fatalf("test connectivity: %v", err)
+	}
+	if result.Reachable || result.Reason == "" {
+		t.Fatalf("expected failed ping to be unreachable with a reason, got %+v", result)
+	}
+
+	// An ACL denying traffic blocks the nodes without pinging.
+	pinged = nil
+	srv.ping = func(_ context.Context, addr netip.Addr) error {
+		pinged = append(pinged, addr)
+		return nil
+	}
+	err = db.Networking().PutNetworkACL(ctx, types.NetworkACL{NetworkACL: &v1.NetworkACL{
+		Name:             "deny-peer",
+		Priority:         100,
+		SourceNodes:      []string{node.ID().String()},
+		DestinationNodes: []string{"peer"},
+		Action:           v1.ACLAction_ACTION_DENY,
+	}})
+	if err != nil {
+		t.Fatalf("put network acl: %v", err)
+	}
+	result, err = srv.TestConnectivity(ctx, "", "peer")
+	if err != nil {
+		t.Fatalf("test connectivity: %v", err)
+	}
+	if result.Reachable {
+		t.Fatal("expected peer to be unreachable when denied by an ACL")
+	}
+	if len(pinged) != 0 {
+		t.Errorf("expected no pings to a blocked node, got %v", pinged)
+	}
+
+	// Tests from remote sources need a way to reach them.
+	_, err = srv.TestConnectivity(ctx, "peer", node.ID())
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for a remote source without a dialer, got %v", err)
+	}
+	// Otherwise they are run on the source and the result is relayed back.
+	remote := &connectivityTestConn{result: ConnectivityResult{
+		Source:      "peer",
+		Destination: node.ID(),
+		Reachable:   true,
+	}}
+	srv.NodeDialer = transport.NodeDialerFunc(func(_ context.Context, id types.NodeID) (transport.RPCClientConn, error) {
+		remote.dialed = id
+		return remote, nil
+	})
+	result, err = srv.TestConnectivity(ctx, "peer", node.ID())
+	if err != nil {
+		t.Fatalf("test remote connectivity: %v", err)
+	}
+	if remote.dialed != "peer" || remote.dst != node.ID().String() {
+		t.Fatalf("expected the test to run on peer against %s, got %q against %q", node.ID(), remote.dialed, remote.dst)
+	}
+	if result != remote.result {
+		t.Fatalf("expected the remote result %+v, got %+v", remote.result, result)
+	}
+	// Unknown destinations are not found.
+	_, err = srv.TestConnectivity(ctx, "", "unknown-node")
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for unknown node, got %v", err)
+	}
+}
+
+func TestGetStatusConnectivityDenied(t *testing.T) {
+	t.Parallel()
+	var pinged bool
+	var dialed bool
+	srv := &Server{Options: Options{
+		NodeID: "node-self",
+		RBAC:   &verbEvaluator{},
+		NodeDialer: transport.NodeDialerFunc(func(context.Context, types.NodeID) (transport.RPCClientConn, error) {
+			dialed = true
+			return nil, fmt.Errorf("unexpected dial")
+		}),
+	}}
+	srv.ping = func(context.Context, netip.Addr) error {
+		pinged = true
+		return nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ConnectivityTestMeta, "peer"))
+	for _, id := range []string{"", "node-other"} {
+		_, err := srv.GetStatus(ctx, &v1.GetStatusRequest{Id: id})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("expected PermissionDenied testing from %q, got %v", id, err)
+		}
+	}
+	if pinged || dialed {
+		t.Fatalf("expected denied tests not to run, pinged=%v dialed=%v", pinged, dialed)
+	}
+}
+
+// connectivityTestConn answers GetStatus calls with a connectivity result header.
+type connectivityTestConn struct {
+	grpc.ClientConnInterface
+	result ConnectivityResult
+	dialed types.NodeID
+	dst    string
+}
+
+func (c *connectivityTestConn) Invoke(ctx context.Context, _ string, _ any, _ any, opts ...grpc.CallOption) error {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if dst := md.Get(ConnectivityTestMeta); len(dst) > 0 {
+		c.dst = dst[0]
+	}
+	encoded, err := json.Marshal(c.result)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		if header, ok := opt.(grpc.HeaderCallOption); ok {
+			*header.HeaderAddr = metadata.Pairs(ConnectivityResultMeta, string(encoded))
+		}
+	}
+	return nil
+}
+
+func (c *connectivityTestConn) Close() error { return nil }
@@ -0,0 +1,113 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/datachannels"
+)
+
+// DefaultDrainTimeout is the default grace period given to active data
+// channels when the server is drained.
+const DefaultDrainTimeout = 10 * time.Second
+
+// Drain stops accepting new data channel negotiations and waits for existing
+// data channels to close. Channels that are still open after the configured
+// DrainTimeout, or when the context is canceled, are closed, which notifies
+// the remote peer.
+func (s *Server) Drain(ctx context.Context) error {
+	s.chmu.Lock()
+	s.draining = true
+	remaining := len(s.channels)
+	s.chmu.Unlock()
+	if remaining == 0 {
+		return nil
+	}
+	s.log.Info("Draining active data channels", slog.Int("channels", remaining))
+	timeout := s.DrainTimeout
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return s.closeChannels()
+		case <-timer.C:
+			return s.closeChannels()
+		case <-ticker.C:
+			s.chmu.Lock()
+			remaining = len(s.channels)
+			s.chmu.Unlock()
+			if remaining == 0 {
+				s.log.Info("All data channels drained")
+				return nil
+			}
+		}
+	}
+}
+
+// Draining returns true if the server is draining and no longer
+// accepting new data channel negotiations.
+func (s *Server) Draining() bool {
+	s.chmu.Lock()
+	defer s.chmu.Unlock()
+	return s.draining
+}
+
+// trackChannel registers an active data channel with the server. The channel
+// is untracked automatically once it is closed. False is returned if the
+// server is draining, in which case the caller should close the channel.
+func (s *Server) trackChannel(conn datachannels.ManagedServerChannel) bool {
+	s.chmu.Lock()
+	defer s.chmu.Unlock()
+	if s.draining {
+		return false
+	}
+	s.channels[conn] = struct{}{}
+	go func() {
+		<-conn.Closed()
+		s.chmu.Lock()
+		delete(s.channels, conn)
+		s.chmu.Unlock()
+	}()
+	return true
+}
+
+func (s *Server) closeChannels() error {
+	s.chmu.Lock()
+	channels := make([]datachannels.ManagedServerChannel, 0, len(s.channels))
+	for conn := range s.channels {
+		channels = append(channels, conn)
+	}
+	s.chmu.Unlock()
+	s.log.Warn("Drain grace period expired, closing remaining data channels", slog.Int("channels", len(channels)))
+	errs := make([]error, 0)
+	for _, conn := range channels {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
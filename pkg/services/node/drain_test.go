@@ -0,0 +1,133 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	t.Run("RejectsNewNegotiations", func(t *testing.T) {
+		t.Parallel()
+		srv := NewServer(context.Background(), Options{DrainTimeout: time.Second})
+		existing := newFakeChannel()
+		if !srv.trackChannel(existing) {
+			t.Fatal("expected channel to be tracked before draining")
+		}
+		drained := make(chan error, 1)
+		go func() {
+			drained <- srv.Drain(context.Background())
+		}()
+		// Wait for the server to enter draining.
+		for !srv.Draining() {
+			time.Sleep(10 * time.Millisecond)
+		}
+		err := srv.NegotiateDataChannel(&fakeNegotiateStream{ctx: context.Background()})
+		if status.Code(err) != codes.Unavailable {
+			t.Fatalf("expected unavailable error during drain, got %v", err)
+		}
+		if srv.trackChannel(newFakeChannel()) {
+			t.Fatal("expected new channels to be rejected during drain")
+		}
+		// The existing channel finishes on its own within the grace period.
+		existing.Close()
+		select {
+		case err := <-drained:
+			if err != nil {
+				t.Fatalf("unexpected drain error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for drain to complete")
+		}
+		if existing.closeCalls() != 1 {
+			t.Errorf("expected existing channel to be closed once, got %d", existing.closeCalls())
+		}
+	})
+
+	t.Run("ClosesChannelsAfterGracePeriod", func(t *testing.T) {
+		t.Parallel()
+		srv := NewServer(context.Background(), Options{DrainTimeout: 200 * time.Millisecond})
+		existing := newFakeChannel()
+		if !srv.trackChannel(existing) {
+			t.Fatal("expected channel to be tracked before draining")
+		}
+		if err := srv.Drain(context.Background()); err != nil {
+			t.Fatalf("unexpected drain error: %v", err)
+		}
+		select {
+		case <-existing.Closed():
+		default:
+			t.Fatal("expected lingering channel to be closed after grace period")
+		}
+	})
+}
+
+type fakeNegotiateStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (f *fakeNegotiateStream) Context() context.Context { return f.ctx }
+
+func (f *fakeNegotiateStream) Send(*v1.DataChannelNegotiation) error { return nil }
+
+func (f *fakeNegotiateStream) Recv() (*v1.DataChannelNegotiation, error) {
+	return &v1.DataChannelNegotiation{}, nil
+}
+
+type fakeChannel struct {
+	closec chan struct{}
+	calls  int
+	mu     sync.Mutex
+}
+
+func newFakeChannel() *fakeChannel {
+	return &fakeChannel{closec: make(chan struct{})}
+}
+
+func (f *fakeChannel) Offer() string             { return "" }
+func (f *fakeChannel) AnswerOffer(string) error  { return nil }
+func (f *fakeChannel) Candidates() <-chan string { return nil }
+func (f *fakeChannel) AddCandidate(string) error { return nil }
+func (f *fakeChannel) Closed() <-chan struct{}   { return f.closec }
+
+func (f *fakeChannel) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls == 1 {
+		close(f.closec)
+	}
+	return nil
+}
+
+func (f *fakeChannel) closeCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
@@ -18,18 +18,57 @@ package node
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
 func (s *Server) GetStatus(ctx context.Context, req *v1.GetStatusRequest) (*v1.Status, error) {
+	if dst, ok := connectivityTestFrom(ctx); ok {
+		src := s.NodeID
+		if req.GetId() != "" {
+			src = types.NodeID(req.GetId())
+		}
+		if err := s.authorize(ctx, testConnectivityAction.For(src.String())); err != nil {
+			return nil, err
+		}
+		result, err := s.TestConnectivity(ctx, types.NodeID(req.GetId()), dst)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to encode connectivity result: %v", err)
+		}
+		if err := grpc.SetHeader(ctx, metadata.Pairs(ConnectivityResultMeta, string(encoded))); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to set connectivity result header: %v", err)
+		}
+	}
+	if kill, ok := sessionsRequested(ctx); ok {
+		nodeID := s.NodeID
+		if req.GetId() != "" {
+			nodeID = types.NodeID(req.GetId())
+		}
+		if err := s.authorizeSessions(ctx, nodeID, kill); err != nil {
+			return nil, err
+		}
+	}
 	if req.GetId() != "" && req.GetId() != s.NodeID.String() {
 		return s.getRemoteNodeStatus(ctx, types.NodeID(req.GetId()))
 	}
+	if kill, ok := sessionsRequested(ctx); ok {
+		if err := s.serveSessions(ctx, kill); err != nil {
+			return nil, err
+		}
+	}
 	ifaceMetrics, err := s.Meshnet.WireGuard().Metrics()
 	if err != nil {
 		return nil, err
@@ -66,7 +105,18 @@ func (s *Server) getRemoteNodeStatus(ctx context.Context, nodeID types.NodeID) (
 		return nil, err
 	}
 	defer conn.Close()
-	return v1.NewNodeClient(conn).GetStatus(ctx, &v1.GetStatusRequest{
+	outCtx, forwarded := forwardSessionsRequest(ctx)
+	var header metadata.MD
+	resp, err := v1.NewNodeClient(conn).GetStatus(outCtx, &v1.GetStatusRequest{
 		Id: nodeID.String(),
-	})
+	}, grpc.Header(&header))
+	if err != nil {
+		return nil, err
+	}
+	if sessions := header.Get(SessionsResultMeta); forwarded && len(sessions) > 0 {
+		if err := grpc.SetHeader(ctx, metadata.Pairs(SessionsResultMeta, sessions[0])); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to set relay sessions header: %v", err)
+		}
+	}
+	return resp, nil
 }
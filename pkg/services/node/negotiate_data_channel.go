@@ -31,6 +31,9 @@ import (
 )
 
 func (s *Server) NegotiateDataChannel(stream v1.Node_NegotiateDataChannelServer) error {
+	if s.Draining() {
+		return status.Errorf(codes.Unavailable, "node is draining and not accepting new data channels")
+	}
 	// Make sure the request is coming from in-network
 	if !context.IsInNetwork(stream.Context(), s.Meshnet) {
 		addr, _ := context.PeerAddrFrom(stream.Context())
@@ -45,6 +48,7 @@ func (s *Server) NegotiateDataChannel(stream v1.Node_NegotiateDataChannelServer)
 	log := s.log.With(slog.Any("request", req))
 	// TODO: We trust what the other node is sending for now, but we could save
 	// some errors by doing some extra validation first.
+	ctx := datachannels.WithCandidatePolicy(stream.Context(), s.CandidatePolicy)
 	var conn datachannels.ManagedServerChannel
 	if req.GetPort() == 0 && req.GetProto() == "udp" {
 		log.Info("Creating WireGuard proxy connection")
@@ -53,13 +57,13 @@ func (s *Server) NegotiateDataChannel(stream v1.Node_NegotiateDataChannelServer)
 		if err != nil {
 			return status.Errorf(codes.Internal, "failed to get WireGuard listen port: %v", err)
 		}
-		conn, err = datachannels.NewWireGuardProxyServer(stream.Context(), req.GetStunServers(), uint16(port))
+		conn, err = datachannels.NewWireGuardProxyServer(ctx, req.GetStunServers(), uint16(port))
 		if err != nil {
 			return err
 		}
 	} else {
 		log.Info("Creating standard webrtc peer connection")
-		conn, err = datachannels.NewPeerConnectionServer(stream.Context(), &datachannels.OfferOptions{
+		conn, err = datachannels.NewPeerConnectionServer(ctx, &datachannels.OfferOptions{
 			Proto:       req.GetProto(),
 			SrcAddress:  req.GetSrc(),
 			DstAddress:  net.JoinHostPort(req.GetDst(), strconv.Itoa(int(req.GetPort()))),
@@ -69,6 +73,10 @@ func (s *Server) NegotiateDataChannel(stream v1.Node_NegotiateDataChannelServer)
 			return err
 		}
 	}
+	if !s.trackChannel(conn) {
+		defer conn.Close()
+		return status.Errorf(codes.Unavailable, "node is draining and not accepting new data channels")
+	}
 	go func() {
 		<-conn.Closed()
 		log.Debug("WebRTC connection closed")
@@ -20,15 +20,21 @@ package node
 import (
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"runtime"
+	"sync"
 	"time"
 
 	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/meshnet"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/datachannels"
 	"github.com/webmeshproj/webmesh/pkg/plugins"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
 	"github.com/webmeshproj/webmesh/pkg/storage"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 	"github.com/webmeshproj/webmesh/pkg/version"
@@ -40,6 +46,11 @@ type Server struct {
 	Options
 	startedAt time.Time
 	log       *slog.Logger
+	channels  map[datachannels.ManagedServerChannel]struct{}
+	draining  bool
+	chmu      sync.Mutex
+	// ping is used for connectivity tests, overridden in tests.
+	ping func(context.Context, netip.Addr) error
 }
 
 // Options are options for the Node service.
@@ -52,6 +63,18 @@ type Options struct {
 	NodeDialer  transport.NodeDialer
 	Plugins     plugins.Manager
 	Features    []*v1.FeaturePort
+	// RBAC authorizes requests for the relay sessions of the node and
+	// connectivity tests. Those requests are refused when it is nil.
+	RBAC rbac.Evaluator
+	// DrainTimeout is the grace period given to active data channels
+	// when the server is drained. Defaults to DefaultDrainTimeout.
+	DrainTimeout time.Duration
+	// CandidatePolicy restricts the ICE candidate types signaled to peers
+	// when negotiating data channels.
+	CandidatePolicy datachannels.CandidatePolicy
+	// ConnectivityTimeout is how long to wait for replies when testing
+	// connectivity to another node. Defaults to DefaultConnectivityTimeout.
+	ConnectivityTimeout time.Duration
 }
 
 // NewServer returns a new Server. Features are used for returning what features are enabled.
@@ -63,5 +86,22 @@ func NewServer(ctx context.Context, opts Options) *Server {
 		Options:   opts,
 		startedAt: time.Now(),
 		log:       context.LoggerFrom(ctx).With("component", "node-server"),
+		channels:  make(map[datachannels.ManagedServerChannel]struct{}),
 	}
 }
+
+// authorize returns a PermissionDenied error unless the caller is allowed the
+// given actions.
+func (s *Server) authorize(ctx context.Context, actions rbac.Actions) error {
+	if s.RBAC == nil {
+		return status.Error(codes.PermissionDenied, "not allowed")
+	}
+	allowed, err := s.RBAC.Evaluate(ctx, actions)
+	if err != nil {
+		s.log.Error("Failed to evaluate permissions", "error", err.Error())
+	}
+	if !allowed {
+		return status.Error(codes.PermissionDenied, "not allowed")
+	}
+	return nil
+}
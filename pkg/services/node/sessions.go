@@ -0,0 +1,125 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"encoding/json"
+	"errors"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
+	"github.com/webmeshproj/webmesh/pkg/services/leaderproxy"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+const (
+	// SessionsMeta is the metadata key on a GetStatus request asking for the
+	// ICE and libp2p relay sessions of the node. They are returned JSON encoded
+	// in the SessionsResultMeta response header.
+	SessionsMeta = "x-webmesh-sessions"
+	// KillSessionMeta is the metadata key on a GetStatus request naming a peer
+	// whose relay session is closed before the sessions are returned.
+	KillSessionMeta = "x-webmesh-kill-session"
+	// SessionsResultMeta is the GetStatus response header carrying the JSON
+	// encoded relay sessions of the node.
+	SessionsResultMeta = "x-webmesh-sessions-bin"
+)
+
+var (
+	listSessionsAction = rbac.Actions{
+		{
+			Verb:     v1.RuleVerb_VERB_GET,
+			Resource: v1.RuleResource_RESOURCE_DATA_CHANNELS,
+		},
+	}
+	killSessionAction = rbac.Actions{
+		{
+			Verb:     v1.RuleVerb_VERB_DELETE,
+			Resource: v1.RuleResource_RESOURCE_DATA_CHANNELS,
+		},
+	}
+)
+
+// authorizeSessions checks that the caller may list the relay sessions of
+// nodeID, and close the one to kill if given.
+func (s *Server) authorizeSessions(ctx context.Context, nodeID types.NodeID, kill types.NodeID) error {
+	if kill != "" {
+		return s.authorize(ctx, killSessionAction.For(nodeID.String()))
+	}
+	return s.authorize(ctx, listSessionsAction.For(nodeID.String()))
+}
+
+// sessionsRequested returns true if the GetStatus request asks for the relay
+// sessions of the node, and the peer whose session to close, if any.
+func sessionsRequested(ctx context.Context) (kill types.NodeID, ok bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	if v := md.Get(KillSessionMeta); len(v) > 0 && v[0] != "" {
+		return types.NodeID(v[0]), true
+	}
+	v := md.Get(SessionsMeta)
+	return "", len(v) > 0 && v[0] == "true"
+}
+
+// serveSessions closes the requested relay session, if any, and sets the
+// remaining sessions in the response header.
+func (s *Server) serveSessions(ctx context.Context, kill types.NodeID) error {
+	peers := s.Meshnet.Peers()
+	if kill != "" {
+		err := peers.KillSession(ctx, kill)
+		if err != nil {
+			if errors.Is(err, meshnet.ErrSessionNotFound) {
+				return status.Errorf(codes.NotFound, "no relay session to %s", kill)
+			}
+			return status.Errorf(codes.Internal, "failed to close relay session: %v", err)
+		}
+	}
+	encoded, err := json.Marshal(peers.Sessions())
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to encode relay sessions: %v", err)
+	}
+	if err := grpc.SetHeader(ctx, metadata.Pairs(SessionsResultMeta, string(encoded))); err != nil {
+		return status.Errorf(codes.Internal, "failed to set relay sessions header: %v", err)
+	}
+	return nil
+}
+
+// forwardSessionsRequest copies a relay sessions request, if any, to the
+// outgoing context of a GetStatus call to another node. The caller is passed
+// along so the other node authorizes the request against it instead of us.
+func forwardSessionsRequest(ctx context.Context) (context.Context, bool) {
+	kill, ok := sessionsRequested(ctx)
+	if !ok {
+		return ctx, false
+	}
+	if caller, ok := context.AuthenticatedCallerFrom(ctx); ok {
+		ctx = metadata.AppendToOutgoingContext(ctx, leaderproxy.ProxiedForMeta, caller)
+	}
+	if kill != "" {
+		return metadata.AppendToOutgoingContext(ctx, KillSessionMeta, kill.String()), true
+	}
+	return metadata.AppendToOutgoingContext(ctx, SessionsMeta, "true"), true
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/meshnet"
+	"github.com/webmeshproj/webmesh/pkg/services/rbac"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestServeSessions(t *testing.T) {
+	t.Parallel()
+	peers := &sessionPeers{sessions: []meshnet.Session{
+		{PeerID: "node-a", LocalAddr: netip.MustParseAddrPort("127.0.0.1:40000")},
+		{PeerID: "node-b", LocalAddr: netip.MustParseAddrPort("127.0.0.1:40001")},
+	}}
+	srv := &Server{Options: Options{Meshnet: &sessionManager{peers: peers}}}
+	serve := func(md metadata.MD) ([]meshnet.Session, error) {
+		t.Helper()
+		stream := &headerStream{}
+		ctx := grpc.NewContextWithServerTransportStream(metadata.NewIncomingContext(context.Background(), md), stream)
+		kill, ok := sessionsRequested(ctx)
+		if !ok {
+			t.Fatalf("expected %v to request sessions", md)
+		}
+		if err := srv.serveSessions(ctx, kill); err != nil {
+			return nil, err
+		}
+		var sessions []meshnet.Session
+		if err := json.Unmarshal([]byte(stream.header.Get(SessionsResultMeta)[0]), &sessions); err != nil {
+			t.Fatalf("decode sessions: %v", err)
+		}
+		return sessions, nil
+	}
+
+	sessions, err := serve(metadata.Pairs(SessionsMeta, "true"))
+	if err != nil {
+		t.Fatalf("serve sessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0] != peers.sessions[0] {
+		t.Fatalf("expected both sessions, got %+v", sessions)
+	}
+	sessions, err = serve(metadata.Pairs(KillSessionMeta, "node-a"))
+	if err != nil {
+		t.Fatalf("kill session: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].PeerID != "node-b" {
+		t.Fatalf("expected only the session to node-b to remain, got %+v", sessions)
+	}
+	_, err = serve(metadata.Pairs(KillSessionMeta, "node-a"))
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound killing a closed session, got %v", err)
+	}
+}
+
+func TestGetStatusSessionsDenied(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		name string
+		rbac rbac.Evaluator
+		md   metadata.MD
+		// id is the node the status is requested for, denied requests
+		// for other nodes must not be forwarded.
+		id string
+	}{
+		{
+			name: "NoEvaluator",
+			md:   metadata.Pairs(SessionsMeta, "true"),
+		},
+		{
+			name: "ListDenied",
+			rbac: &verbEvaluator{},
+			md:   metadata.Pairs(SessionsMeta, "true"),
+		},
+		{
+			name: "KillDenied",
+			rbac: &verbEvaluator{allowed: v1.RuleVerb_VERB_GET},
+			md:   metadata.Pairs(KillSessionMeta, "node-a"),
+		},
+		{
+			name: "RemoteKillDenied",
+			rbac: &verbEvaluator{allowed: v1.RuleVerb_VERB_GET},
+			md:   metadata.Pairs(KillSessionMeta, "node-a"),
+			id:   "node-other",
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			peers := &sessionPeers{sessions: []meshnet.Session{{PeerID: "node-a"}}}
+			srv := &Server{
+				Options: Options{NodeID: "node-self", Meshnet: &sessionManager{peers: peers}, RBAC: tt.rbac},
+			}
+			req := &v1.GetStatusRequest{Id: tt.id}
+			ctx := grpc.NewContextWithServerTransportStream(metadata.NewIncomingContext(context.Background(), tt.md), &headerStream{})
+			_, err := srv.GetStatus(ctx, req)
+			if status.Code(err) != codes.PermissionDenied {
+				t.Fatalf("expected PermissionDenied, got %v", err)
+			}
+			if len(peers.sessions) != 1 {
+				t.Fatalf("expected the session to be left open, got %+v", peers.sessions)
+			}
+		})
+	}
+}
+
+// verbEvaluator allows only actions with the given verb.
+type verbEvaluator struct {
+	allowed v1.RuleVerb
+}
+
+func (e *verbEvaluator) IsSecure() bool { return true }
+
+func (e *verbEvaluator) Evaluate(_ context.Context, actions rbac.Actions) (bool, error) {
+	for _, action := range actions {
+		if action.Verb != e.allowed {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+type sessionManager struct {
+	meshnet.Manager
+	peers meshnet.PeerManager
+}
+
+func (m *sessionManager) Peers() meshnet.PeerManager { return m.peers }
+
+type sessionPeers struct {
+	meshnet.PeerManager
+	sessions []meshnet.Session
+}
+
+func (p *sessionPeers) Sessions() []meshnet.Session { return p.sessions }
+
+func (p *sessionPeers) KillSession(_ context.Context, id types.NodeID) error {
+	for i, session := range p.sessions {
+		if session.PeerID == id {
+			p.sessions = append(p.sessions[:i], p.sessions[i+1:]...)
+			return nil
+		}
+	}
+	return meshnet.ErrSessionNotFound
+}
+
+// headerStream records the headers set by a handler.
+type headerStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
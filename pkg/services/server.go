@@ -18,13 +18,18 @@ limitations under the License.
 package services
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
 	"golang.org/x/net/http2"
@@ -43,6 +48,14 @@ const DefaultGRPCPort = 8443
 // DefaultGRPCListenAddress is the default listen address for the gRPC server.
 const DefaultGRPCListenAddress = "[::]:8443"
 
+// DefaultMaxConcurrentStreams is the default limit on concurrent streams
+// a single client connection may open.
+const DefaultMaxConcurrentStreams = 1000
+
+// DefaultUnixSocketPermissions are the default file permissions for the
+// gRPC unix socket listener.
+const DefaultUnixSocketPermissions os.FileMode = 0600
+
 // MeshServer is the generic interface for additional services that
 // can be managed by this server.
 type MeshServer interface {
@@ -52,6 +65,14 @@ type MeshServer interface {
 	Shutdown(ctx context.Context) error
 }
 
+// Drainer is implemented by registered services that hold long-lived
+// connections and want a chance to close them gracefully before the
+// gRPC server is stopped.
+type Drainer interface {
+	// Drain stops accepting new work and waits for existing work to finish.
+	Drain(ctx context.Context) error
+}
+
 // MeshServers is a list of MeshServers.
 type MeshServers []MeshServer
 
@@ -89,6 +110,13 @@ type Options struct {
 	AllowedOrigins []string
 	// ListenAddress is the address to start the gRPC server on.
 	ListenAddress string
+	// ListenUnixSocket is an optional path to a unix socket to additionally
+	// serve the gRPC server on. The same server options apply to connections
+	// over the socket.
+	ListenUnixSocket string
+	// UnixSocketPermissions are the file permissions to set on the unix socket.
+	// Defaults to DefaultUnixSocketPermissions.
+	UnixSocketPermissions os.FileMode
 	// ServerOptions are options for the server. This should include
 	// any registered authentication mechanisms.
 	ServerOptions []grpc.ServerOption
@@ -96,6 +124,22 @@ type Options struct {
 	LibP2POptions *LibP2POptions
 	// Servers are additional servers to manage alongside the gRPC server.
 	Servers MeshServers
+	// LoadHints are options for publishing load hints for this node. If nil,
+	// no hints are published.
+	LoadHints *LoadHintOptions
+	// Keepalive limits the idle time and lifetime of client connections.
+	Keepalive KeepaliveOptions
+	// MaxConcurrentStreams is the number of concurrent streams a single client
+	// connection may open. Further streams wait until one finishes. Defaults
+	// to DefaultMaxConcurrentStreams.
+	MaxConcurrentStreams uint32
+	// ShutdownGracePeriod bounds how long in-flight RPCs are given to complete
+	// on shutdown after clients are sent a GOAWAY. RPCs still running after the
+	// grace period are cancelled. Zero waits until the shutdown context is done.
+	ShutdownGracePeriod time.Duration
+	// Closers are closed on shutdown after the gRPC server has stopped, such
+	// as clients held by interceptors.
+	Closers []io.Closer
 }
 
 // LibP2POptions are options for serving the gRPC server over libp2p.
@@ -115,14 +159,19 @@ func (o *Options) GetServer(typ any) (MeshServer, bool) {
 
 // Server is the gRPC server.
 type Server struct {
-	opts    Options
-	hostlis net.Listener
-	lis     *net.TCPListener
-	srv     *grpc.Server
-	websrv  *http.Server
-	srvs    []MeshServer
-	log     *slog.Logger
-	mu      sync.Mutex
+	opts     Options
+	hostlis  net.Listener
+	lis      *net.TCPListener
+	unixlis  *net.UnixListener
+	unixPath string
+	srv      *grpc.Server
+	websrv   *http.Server
+	srvs     []MeshServer
+	drains   []Drainer
+	conns    connCounter
+	stop     context.CancelFunc
+	log      *slog.Logger
+	mu       sync.Mutex
 }
 
 // NewServer returns a new Server.
@@ -132,10 +181,20 @@ func NewServer(ctx context.Context, o Options) (*Server, error) {
 	server := &Server{
 		opts: o,
 		srvs: o.Servers,
+		stop: func() {},
 		log:  log,
 	}
 	if !o.DisableGRPC {
-		server.srv = grpc.NewServer(o.ServerOptions...)
+		streams := o.MaxConcurrentStreams
+		if streams == 0 {
+			streams = DefaultMaxConcurrentStreams
+		}
+		srvOpts := append([]grpc.ServerOption{
+			grpc.StatsHandler(&server.conns),
+			grpc.MaxConcurrentStreams(streams),
+		}, o.Keepalive.serverOptions()...)
+		srvOpts = append(srvOpts, o.ServerOptions...)
+		server.srv = grpc.NewServer(srvOpts...)
 		log.Debug("Registering reflection service")
 		reflection.Register(server)
 		// Go ahead and start the listener.
@@ -147,6 +206,18 @@ func NewServer(ctx context.Context, o Options) (*Server, error) {
 			}
 			server.lis = lis.(*net.TCPListener)
 		}
+		if o.ListenUnixSocket != "" {
+			log.Debug("Starting unix socket listener", "path", o.ListenUnixSocket)
+			lis, err := listenUnix(o.ListenUnixSocket, o.UnixSocketPermissions)
+			if err != nil {
+				if server.lis != nil {
+					server.lis.Close()
+				}
+				return nil, fmt.Errorf("start unix socket listener: %w", err)
+			}
+			server.unixlis = lis
+			server.unixPath = o.ListenUnixSocket
+		}
 		if o.LibP2POptions != nil {
 			log.Debug("Starting libp2p host listener")
 			hostOpts := o.LibP2POptions.HostOptions
@@ -225,6 +296,16 @@ func (s *Server) ListenAndServe() error {
 			return nil
 		})
 	}
+	if s.unixlis != nil {
+		g.Go(func() error {
+			defer s.unixlis.Close()
+			s.log.Info(fmt.Sprintf("Starting gRPC server on unix socket %s", s.unixlis.Addr().String()))
+			if err := s.srv.Serve(s.unixlis); err != nil {
+				return fmt.Errorf("grpc serve: %w", err)
+			}
+			return nil
+		})
+	}
 	if s.hostlis != nil {
 		g.Go(func() error {
 			defer s.hostlis.Close()
@@ -235,6 +316,11 @@ func (s *Server) ListenAndServe() error {
 			return nil
 		})
 	}
+	if s.opts.LoadHints != nil && s.srv != nil {
+		ctx, cancel := context.WithCancel(context.WithLogger(context.Background(), s.log))
+		s.stop = cancel
+		go s.runLoadHints(ctx, *s.opts.LoadHints)
+	}
 	s.mu.Unlock()
 	return g.Wait()
 }
@@ -244,6 +330,9 @@ func (s *Server) RegisterService(desc *grpc.ServiceDesc, impl any) {
 	if s.opts.DisableGRPC {
 		return
 	}
+	if drainer, ok := impl.(Drainer); ok {
+		s.drains = append(s.drains, drainer)
+	}
 	s.srv.RegisterService(desc, impl)
 }
 
@@ -263,11 +352,27 @@ func (s *Server) GRPCListenPort() int {
 	return s.lis.Addr().(*net.TCPAddr).Port
 }
 
-// Shutdown stops the gRPC server and all mesh services gracefully.
+// UnixSocketPath returns the path of the unix socket the gRPC server is
+// listening on, or an empty string if there is none.
+func (s *Server) UnixSocketPath() string {
+	return s.unixPath
+}
+
+// Shutdown stops the gRPC server and all mesh services gracefully. Clients
+// are sent a GOAWAY and new streams are refused, while in-flight RPCs are
+// given until the grace period or the context expires to complete.
 // You cannot use the server again after calling Stop.
 func (s *Server) Shutdown(ctx context.Context) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.stop()
+	for _, drainer := range s.drains {
+		s.log.Debug("Draining registered service")
+		err := drainer.Drain(ctx)
+		if err != nil {
+			s.log.Error("Service drain failed", slog.String("error", err.Error()))
+		}
+	}
 	for _, srv := range s.srvs {
 		s.log.Debug("Shutting down mesh server")
 		err := srv.Shutdown(ctx)
@@ -275,13 +380,94 @@ func (s *Server) Shutdown(ctx context.Context) {
 			s.log.Error("Mesh server shutdown failed", slog.String("error", err.Error()))
 		}
 	}
+	if s.opts.ShutdownGracePeriod > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.ShutdownGracePeriod)
+		defer cancel()
+	}
 	if s.websrv != nil {
 		s.log.Info("Shutting down gRPC-web server")
 		if err := s.websrv.Shutdown(ctx); err != nil {
 			s.log.Error("gRPC-web server shutdown failed", slog.String("error", err.Error()))
 		}
+		if s.unixlis != nil {
+			// The gRPC server can't be gracefully stopped while serving
+			// gRPC-web, so just stop accepting new connections on the socket.
+			s.unixlis.Close()
+		}
 	} else if s.srv != nil {
 		s.log.Info("Shutting down gRPC server")
+		s.gracefulStop(ctx)
+	}
+	if s.unixlis != nil {
+		// The socket was moved into place after binding, so the listener
+		// does not unlink it on close.
+		path := s.UnixSocketPath()
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			s.log.Error("Failed to remove unix socket", slog.String("path", path), slog.String("error", err.Error()))
+		}
+	}
+	for _, closer := range s.opts.Closers {
+		if err := closer.Close(); err != nil {
+			s.log.Error("Failed to close service resource", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// gracefulStop stops the gRPC server, waiting for in-flight RPCs to complete
+// until the context is done. Remaining RPCs are then cancelled.
+func (s *Server) gracefulStop(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
 		s.srv.GracefulStop()
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.log.Warn("Timed out waiting for in-flight RPCs to complete, forcing shutdown")
+		s.srv.Stop()
+		<-done
+	}
+}
+
+// listenUnix listens on the unix socket at the given path, replacing any stale
+// socket left behind by a previous run, and applies the given permissions. The
+// socket is created inside a private directory and only moved into place once
+// the permissions are set, so it is never reachable under the process umask.
+func listenUnix(path string, perms os.FileMode) (*net.UnixListener, error) {
+	if perms == 0 {
+		perms = DefaultUnixSocketPermissions
+	}
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a unix socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale unix socket: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("stat unix socket: %w", err)
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".webmesh-sock-")
+	if err != nil {
+		return nil, fmt.Errorf("create unix socket directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, filepath.Base(path))
+	lis, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// The socket is removed from its final path on shutdown.
+	lis.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, perms); err != nil {
+		lis.Close()
+		return nil, fmt.Errorf("set unix socket permissions: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		lis.Close()
+		return nil, fmt.Errorf("move unix socket into place: %w", err)
 	}
+	return lis, nil
 }
@@ -18,9 +18,27 @@ limitations under the License.
 package services
 
 import (
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/services/meshdns"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/providers/backends/badgerdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/testutil"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
 func TestGetServerByType(t *testing.T) {
@@ -47,3 +65,340 @@ func TestGetServerByType(t *testing.T) {
 		t.Fatal("expected server to not be nil")
 	}
 }
+
+func TestUnixSocketListener(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webmesh.sock")
+	srv, err := NewServer(ctx, Options{
+		ListenUnixSocket:      path,
+		UnixSocketPermissions: 0660,
+	})
+	if err != nil {
+		t.Fatalf("create server: %v", err)
+	}
+	srv.RegisterService(&healthpb.Health_ServiceDesc, health.NewServer())
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat unix socket: %v", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		t.Fatalf("expected %s to be a unix socket", path)
+	}
+	if perms := info.Mode().Perm(); perms != 0660 {
+		t.Fatalf("expected socket permissions 0660, got %#o", perms)
+	}
+	// The private directory the socket was created in is cleaned up.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("read socket directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the socket in %s, got %d entries", filepath.Dir(path), len(entries))
+	}
+
+	conn, err := grpc.DialContext(ctx, "unix://"+path, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial unix socket: %v", err)
+	}
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("health check over unix socket: %v", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected SERVING, got %s", resp.GetStatus())
+	}
+	conn.Close()
+
+	srv.Shutdown(ctx)
+	if err := <-errs; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected unix socket to be removed on shutdown, got %v", err)
+	}
+}
+
+func TestKeepaliveClosesIdleConnections(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webmesh.sock")
+	srv, err := NewServer(ctx, Options{
+		ListenUnixSocket: path,
+		Keepalive: KeepaliveOptions{
+			MaxConnectionIdle: 250 * time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatalf("create server: %v", err)
+	}
+	srv.RegisterService(&healthpb.Health_ServiceDesc, health.NewServer())
+	go func() { _ = srv.ListenAndServe() }()
+	defer srv.Shutdown(ctx)
+
+	conn, err := grpc.DialContext(ctx, "unix://"+path, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial unix socket: %v", err)
+	}
+	defer conn.Close()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+	if state := conn.GetState(); state != connectivity.Ready {
+		t.Fatalf("expected connection to be ready, got %s", state)
+	}
+	// The server should send a GOAWAY once the connection has been idle
+	// for the configured period, moving the client out of READY.
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if !conn.WaitForStateChange(waitCtx, connectivity.Ready) {
+		t.Fatal("expected idle connection to be closed by the server")
+	}
+}
+
+func TestLoadHints(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := badgerdb.NewTestStorage(false)
+	t.Cleanup(func() { db.Close() })
+	srv, err := NewServer(ctx, Options{
+		ListenAddress: "127.0.0.1:0",
+		LoadHints: &LoadHintOptions{
+			NodeID:   types.NodeID("node-a"),
+			Storage:  db,
+			Interval: 100 * time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatalf("create server: %v", err)
+	}
+	srv.RegisterService(&healthpb.Health_ServiceDesc, health.NewServer())
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+	t.Cleanup(func() {
+		srv.Shutdown(ctx)
+		<-errs
+	})
+
+	conn, err := grpc.DialContext(ctx, srv.lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial server: %v", err)
+	}
+	defer conn.Close()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+
+	// The hint should be advertised with the open connection.
+	ok := testutil.Eventually[int](func() int {
+		hints, err := storage.GetLoadHints(ctx, db)
+		if err != nil {
+			t.Logf("get load hints: %v", err)
+			return -1
+		}
+		return hints[types.NodeID("node-a")].Connections
+	}).ShouldEqual(time.Second*5, time.Millisecond*50, 1)
+	if !ok {
+		t.Fatal("expected load hint with one connection to be published")
+	}
+	hints, err := storage.GetLoadHints(ctx, db)
+	if err != nil {
+		t.Fatalf("get load hints: %v", err)
+	}
+	if w := hints[types.NodeID("node-a")].Weight(); w != 0.5 {
+		t.Fatalf("expected weight 0.5 for one connection, got %v", w)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("InFlightRPCsComplete", func(t *testing.T) {
+		t.Parallel()
+		srv, svc, conn := newBlockingTestServer(t, Options{ShutdownGracePeriod: 30 * time.Second})
+		inflight := make(chan error, 1)
+		go func() {
+			inflight <- conn.Invoke(ctx, blockingWaitMethod, &emptypb.Empty{}, &emptypb.Empty{})
+		}()
+		select {
+		case <-svc.started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for in-flight RPC to start")
+		}
+
+		shutdown := make(chan struct{})
+		go func() {
+			defer close(shutdown)
+			srv.Shutdown(ctx)
+		}()
+		// New RPCs are refused once the server has sent a GOAWAY.
+		ok := testutil.Eventually[codes.Code](func() codes.Code {
+			callCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			return status.Code(conn.Invoke(callCtx, blockingPingMethod, &emptypb.Empty{}, &emptypb.Empty{}))
+		}).ShouldEqual(5*time.Second, 50*time.Millisecond, codes.Unavailable)
+		if !ok {
+			t.Fatal("expected new RPCs to be rejected during graceful shutdown")
+		}
+		select {
+		case <-shutdown:
+			t.Fatal("expected shutdown to wait for the in-flight RPC")
+		default:
+		}
+
+		close(svc.release)
+		select {
+		case err := <-inflight:
+			if err != nil {
+				t.Fatalf("expected in-flight RPC to complete, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for in-flight RPC to complete")
+		}
+		select {
+		case <-shutdown:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for shutdown to complete")
+		}
+	})
+
+	t.Run("GracePeriodExpires", func(t *testing.T) {
+		t.Parallel()
+		srv, svc, conn := newBlockingTestServer(t, Options{ShutdownGracePeriod: 250 * time.Millisecond})
+		inflight := make(chan error, 1)
+		go func() {
+			inflight <- conn.Invoke(ctx, blockingWaitMethod, &emptypb.Empty{}, &emptypb.Empty{})
+		}()
+		select {
+		case <-svc.started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for in-flight RPC to start")
+		}
+		start := time.Now()
+		srv.Shutdown(ctx)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("expected shutdown to be bounded by the grace period, took %s", elapsed)
+		}
+		select {
+		case err := <-inflight:
+			if err == nil {
+				t.Fatal("expected in-flight RPC to be cancelled after the grace period")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for in-flight RPC to be cancelled")
+		}
+	})
+}
+
+func TestMaxConcurrentStreams(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	srv, svc, conn := newBlockingTestServer(t, Options{MaxConcurrentStreams: 1})
+	t.Cleanup(func() { srv.Shutdown(ctx) })
+	inflight := make(chan error, 1)
+	go func() {
+		inflight <- conn.Invoke(ctx, blockingWaitMethod, &emptypb.Empty{}, &emptypb.Empty{})
+	}()
+	select {
+	case <-svc.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for in-flight RPC to start")
+	}
+
+	// A second stream on the same connection waits for the first to finish.
+	callCtx, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+	defer cancel()
+	err := conn.Invoke(callCtx, blockingPingMethod, &emptypb.Empty{}, &emptypb.Empty{})
+	if code := status.Code(err); code != codes.DeadlineExceeded {
+		t.Fatalf("expected stream beyond the limit to be queued until its deadline, got %v", err)
+	}
+
+	close(svc.release)
+	select {
+	case err := <-inflight:
+		if err != nil {
+			t.Fatalf("expected in-flight RPC to complete, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for in-flight RPC to complete")
+	}
+	callCtx, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := conn.Invoke(callCtx, blockingPingMethod, &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+		t.Fatalf("expected stream to be accepted once the limit frees up, got %v", err)
+	}
+}
+
+const (
+	blockingWaitMethod = "/webmesh.test.Blocking/Wait"
+	blockingPingMethod = "/webmesh.test.Blocking/Ping"
+)
+
+// blockingService is a test service with a unary method that blocks until
+// released and one that returns right away.
+type blockingService struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (b *blockingService) desc() *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "webmesh.test.Blocking",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "Wait",
+				Handler: func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+					if err := dec(&emptypb.Empty{}); err != nil {
+						return nil, err
+					}
+					b.once.Do(func() { close(b.started) })
+					select {
+					case <-b.release:
+						return &emptypb.Empty{}, nil
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					}
+				},
+			},
+			{
+				MethodName: "Ping",
+				Handler: func(_ any, _ context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+					if err := dec(&emptypb.Empty{}); err != nil {
+						return nil, err
+					}
+					return &emptypb.Empty{}, nil
+				},
+			},
+		},
+	}
+}
+
+func newBlockingTestServer(t *testing.T, opts Options) (*Server, *blockingService, *grpc.ClientConn) {
+	t.Helper()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webmesh.sock")
+	opts.ListenUnixSocket = path
+	srv, err := NewServer(ctx, opts)
+	if err != nil {
+		t.Fatalf("create server: %v", err)
+	}
+	svc := &blockingService{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	srv.RegisterService(svc.desc(), svc)
+	go func() { _ = srv.ListenAndServe() }()
+	conn, err := grpc.DialContext(ctx, "unix://"+path, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial unix socket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return srv, svc, conn
+}
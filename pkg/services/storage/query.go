@@ -18,12 +18,14 @@ package storage
 
 import (
 	"log/slog"
+	"strings"
 
 	v1 "github.com/webmeshproj/api/go/v1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
 	"github.com/webmeshproj/webmesh/pkg/storage/rpcsrv"
 )
 
@@ -37,5 +39,9 @@ func (s *Server) Query(ctx context.Context, req *v1.QueryRequest) (*v1.QueryResp
 		// In theory - non-storage members shouldn't even expose the Node service.
 		return nil, status.Error(codes.Unavailable, "node not available to query")
 	}
-	return rpcsrv.ServeQuery(ctx, s.storage, req), nil
+	resp := rpcsrv.ServeQuery(ctx, s.storage, req)
+	if strings.Contains(resp.GetError(), errors.ErrQuorumLost.Error()) {
+		return nil, status.Error(codes.Unavailable, resp.GetError())
+	}
+	return resp, nil
 }
@@ -17,17 +17,29 @@ limitations under the License.
 package storage
 
 import (
+	"fmt"
 	"log/slog"
+	"strconv"
 
 	v1 "github.com/webmeshproj/api/go/v1"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/services/admin"
 	"github.com/webmeshproj/webmesh/pkg/services/rbac"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
+// RaftLogFromMeta is the metadata key on a Subscribe request asking for the
+// raft log of the node from the given index instead of key events. Each event
+// carries the decimal index of an entry as its key and the protobuf encoded
+// RaftLogEntry as its value. An index of zero starts at the oldest entry still
+// in the log.
+const RaftLogFromMeta = "x-webmesh-raft-log-from"
+
 var canSubscribeAction = rbac.Actions{
 	{
 		Verb:     v1.RuleVerb_VERB_GET,
@@ -45,6 +57,13 @@ func (s *Server) Subscribe(req *v1.SubscribeRequest, srv v1.StorageQueryService_
 		// In theory - non-raft members shouldn't even expose the Node service.
 		return status.Error(codes.Unavailable, "current node not available to subscribe")
 	}
+	fromIndex, ok, err := raftLogFrom(srv.Context())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if ok {
+		return s.streamRaftLog(srv, fromIndex)
+	}
 	if !types.IsReservedPrefix(req.GetPrefix()) {
 		// Don't allow subscriptions to generic prefixes without permissions
 		allowed, err := s.rbac.Evaluate(srv.Context(), canSubscribeAction.For(string(req.GetPrefix())))
@@ -72,3 +91,34 @@ func (s *Server) Subscribe(req *v1.SubscribeRequest, srv v1.StorageQueryService_
 	<-srv.Context().Done()
 	return nil
 }
+
+// streamRaftLog sends the raft log from the given index as subscription events.
+func (s *Server) streamRaftLog(srv v1.StorageQueryService_SubscribeServer, fromIndex uint64) error {
+	return admin.NewServer(s.storage, s.rbac).StreamRaftLog(srv.Context(), fromIndex, func(index uint64, entry *v1.RaftLogEntry) error {
+		data, err := proto.Marshal(entry)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to encode raft log entry %d: %v", index, err)
+		}
+		return srv.Send(&v1.SubscriptionEvent{
+			Key:   []byte(strconv.FormatUint(index, 10)),
+			Value: data,
+		})
+	})
+}
+
+// raftLogFrom returns the index to stream the raft log from, if requested.
+func raftLogFrom(ctx context.Context) (uint64, bool, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0, false, nil
+	}
+	v := md.Get(RaftLogFromMeta)
+	if len(v) == 0 || v[0] == "" {
+		return 0, false, nil
+	}
+	index, err := strconv.ParseUint(v[0], 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s: %w", RaftLogFromMeta, err)
+	}
+	return index, true, nil
+}
@@ -21,6 +21,7 @@ import (
 	v1 "github.com/webmeshproj/api/go/v1"
 
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport"
+	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/datachannels"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/wireguard"
 	"github.com/webmeshproj/webmesh/pkg/services/rbac"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
@@ -47,6 +48,8 @@ type Options struct {
 	NodeDialer  transport.NodeDialer
 	RBAC        rbac.Evaluator
 	STUNServers []string
+	// CandidatePolicy restricts the ICE candidate types signaled to peers.
+	CandidatePolicy datachannels.CandidatePolicy
 }
 
 // NewServer returns a new Server.
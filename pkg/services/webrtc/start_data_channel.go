@@ -112,6 +112,7 @@ func (s *Server) StartDataChannel(stream v1.WebRTC_StartDataChannelServer) error
 
 func (s *Server) handleLocalNegotiation(log *slog.Logger, stream v1.WebRTC_StartDataChannelServer, r *v1.StartDataChannelRequest, remoteAddr string) error {
 	log.Info("Handling negotiation locally")
+	ctx := datachannels.WithCandidatePolicy(stream.Context(), s.opts.CandidatePolicy)
 	var conn datachannels.ManagedServerChannel
 	var err error
 	if r.GetProto() == "udp" && r.GetPort() == 0 {
@@ -121,13 +122,13 @@ func (s *Server) handleLocalNegotiation(log *slog.Logger, stream v1.WebRTC_Start
 		if err != nil {
 			return status.Errorf(codes.Internal, "failed to get WireGuard listen port: %v", err)
 		}
-		conn, err = datachannels.NewWireGuardProxyServer(stream.Context(), s.opts.STUNServers, uint16(port))
+		conn, err = datachannels.NewWireGuardProxyServer(ctx, s.opts.STUNServers, uint16(port))
 		if err != nil {
 			return err
 		}
 	} else {
 		log.Info("Negotiating standard WebRTC connection")
-		conn, err = datachannels.NewPeerConnectionServer(stream.Context(), &datachannels.OfferOptions{
+		conn, err = datachannels.NewPeerConnectionServer(ctx, &datachannels.OfferOptions{
 			Proto:       r.GetProto(),
 			SrcAddress:  remoteAddr,
 			DstAddress:  net.JoinHostPort(r.GetDst(), strconv.Itoa(int(r.GetPort()))),
@@ -0,0 +1,56 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"log/slog"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/storage"
+)
+
+// WriteQuorumUnaryInterceptor returns a unary interceptor that issues a write
+// barrier after any of the given methods succeed, so the caller is only sent a
+// response once the mutation is confirmed to be replicated to a quorum. If the
+// barrier fails, the caller receives an Unavailable error even though the
+// mutation may have been applied, and should retry. This trades latency for
+// durability on sensitive operations, such as RBAC changes. It should be
+// chained after the leader proxy so that only requests handled locally by the
+// leader are checked.
+func WriteQuorumUnaryInterceptor(barrier storage.WriteBarrier, methods []string) grpc.UnaryServerInterceptor {
+	methods = slices.Clone(methods)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err != nil || !slices.Contains(methods, info.FullMethod) {
+			return resp, err
+		}
+		context.LoggerFrom(ctx).Debug("Waiting for write quorum", slog.String("method", info.FullMethod))
+		if err := barrier.Barrier(ctx); err != nil {
+			context.LoggerFrom(ctx).Error("Failed to confirm write quorum",
+				slog.String("method", info.FullMethod),
+				slog.String("error", err.Error()),
+			)
+			return nil, status.Errorf(codes.Unavailable, "failed to confirm write quorum: %v", err)
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+func TestWriteQuorumUnaryInterceptor(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ok := func(context.Context, any) (any, error) { return "ok", nil }
+	failed := func(context.Context, any) (any, error) {
+		return nil, status.Error(codes.InvalidArgument, "bad request")
+	}
+
+	tc := []struct {
+		name         string
+		method       string
+		handler      grpc.UnaryHandler
+		barrierErr   error
+		wantBarriers int32
+		wantCode     codes.Code
+	}{
+		{
+			name:         "SensitiveMethod",
+			method:       v1.Admin_PutRole_FullMethodName,
+			handler:      ok,
+			wantBarriers: 1,
+			wantCode:     codes.OK,
+		},
+		{
+			name:         "OtherMethod",
+			method:       v1.Admin_GetRole_FullMethodName,
+			handler:      ok,
+			wantBarriers: 0,
+			wantCode:     codes.OK,
+		},
+		{
+			name:         "FailedMutation",
+			method:       v1.Admin_PutRole_FullMethodName,
+			handler:      failed,
+			wantBarriers: 0,
+			wantCode:     codes.InvalidArgument,
+		},
+		{
+			name:         "BarrierFailed",
+			method:       v1.Admin_PutRole_FullMethodName,
+			handler:      ok,
+			barrierErr:   errors.New("leadership lost"),
+			wantBarriers: 1,
+			wantCode:     codes.Unavailable,
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			barrier := &countingBarrier{err: tt.barrierErr}
+			intercept := WriteQuorumUnaryInterceptor(barrier, []string{v1.Admin_PutRole_FullMethodName})
+			resp, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, tt.handler)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("expected code %s, got %s: %v", tt.wantCode, code, err)
+			}
+			if tt.wantCode == codes.OK && resp != "ok" {
+				t.Errorf("expected the handler response, got %v", resp)
+			}
+			if n := barrier.calls.Load(); n != tt.wantBarriers {
+				t.Errorf("expected %d barriers, got %d", tt.wantBarriers, n)
+			}
+		})
+	}
+}
+
+type countingBarrier struct {
+	calls atomic.Int32
+	err   error
+}
+
+func (c *countingBarrier) Barrier(context.Context) error {
+	c.calls.Add(1)
+	return c.err
+}
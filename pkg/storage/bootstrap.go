@@ -65,6 +65,12 @@ type BootstrapOptions struct {
 	Voters []string
 	// DisableRBAC disables RBAC.
 	DisableRBAC bool
+	// RBACManifest is an optional set of additional roles, groups, and
+	// role bindings to create after the built-in ones.
+	RBACManifest *RBACManifest
+	// DryRun validates the options and returns the results that would be
+	// written without writing anything to the database.
+	DryRun bool
 }
 
 func (b *BootstrapOptions) Default() {
@@ -92,29 +98,21 @@ type BootstrapResults struct {
 	MeshDomain string
 }
 
-// Bootstrap attempts to bootstrap the given database. If data already exists,
-// ErrAlreadyBootstrapped will be returned, but with results populated with the
-// existing data.
-func Bootstrap(ctx context.Context, db MeshDB, opts *BootstrapOptions) (results BootstrapResults, err error) {
+// ValidateBootstrap checks the given options without a database. The networks
+// are parsed, or generated for an unset IPv6 network, and returned in the
+// results along with the mesh domain.
+func ValidateBootstrap(opts *BootstrapOptions) (results BootstrapResults, err error) {
 	opts.Default()
 	results.MeshDomain = opts.MeshDomain
-	// Check if there is data already before we start.
-	state, err := db.MeshState().GetMeshState(ctx)
-	if err != nil && !errors.IsNotFound(err) {
-		err = fmt.Errorf("get mesh domain: %w", err)
-		return
-	} else if err == nil {
-		results.NetworkV4 = state.NetworkV4()
-		results.NetworkV6 = state.NetworkV6()
-		results.MeshDomain = state.Domain()
-		return results, errors.ErrAlreadyBootstrapped
-	}
-
 	results.NetworkV4, err = netip.ParsePrefix(opts.IPv4Network)
 	if err != nil {
 		err = fmt.Errorf("parse IPv4 network: %w", err)
 		return
 	}
+	if !results.NetworkV4.Addr().Is4() {
+		err = fmt.Errorf("IPv4 network must be an IPv4 prefix")
+		return
+	}
 	if opts.IPv6Network != "" {
 		results.NetworkV6, err = netip.ParsePrefix(opts.IPv6Network)
 		if err != nil {
@@ -132,6 +130,55 @@ func Bootstrap(ctx context.Context, db MeshDB, opts *BootstrapOptions) (results
 			return
 		}
 	}
+	if !meshtypes.IsValidNodeID(opts.Admin) {
+		err = fmt.Errorf("admin %q is not a valid node or user name", opts.Admin)
+		return
+	}
+	for _, id := range opts.BootstrapNodes {
+		if !meshtypes.IsValidNodeID(id) {
+			err = fmt.Errorf("bootstrap node %q is not a valid node ID", id)
+			return
+		}
+	}
+	for _, id := range opts.Voters {
+		if !meshtypes.IsValidNodeID(id) {
+			err = fmt.Errorf("voter %q is not a valid node ID", id)
+			return
+		}
+	}
+	if opts.RBACManifest != nil {
+		err = opts.RBACManifest.Validate()
+		if err != nil {
+			err = fmt.Errorf("invalid rbac manifest: %w", err)
+			return
+		}
+	}
+	return results, nil
+}
+
+// Bootstrap attempts to bootstrap the given database. If data already exists,
+// ErrAlreadyBootstrapped will be returned, but with results populated with the
+// existing data. With DryRun set the options are only validated and nothing
+// is written.
+func Bootstrap(ctx context.Context, db MeshDB, opts *BootstrapOptions) (results BootstrapResults, err error) {
+	opts.Default()
+	results.MeshDomain = opts.MeshDomain
+	// Check if there is data already before we start.
+	state, err := db.MeshState().GetMeshState(ctx)
+	if err != nil && !errors.IsNotFound(err) {
+		err = fmt.Errorf("get mesh domain: %w", err)
+		return
+	} else if err == nil {
+		results.NetworkV4 = state.NetworkV4()
+		results.NetworkV6 = state.NetworkV6()
+		results.MeshDomain = state.Domain()
+		return results, errors.ErrAlreadyBootstrapped
+	}
+
+	results, err = ValidateBootstrap(opts)
+	if err != nil || opts.DryRun {
+		return
+	}
 
 	// Initialize the network state
 	err = db.MeshState().SetMeshState(ctx, meshtypes.NetworkState{
@@ -237,6 +284,14 @@ func Bootstrap(ctx context.Context, db MeshDB, opts *BootstrapOptions) (results
 		err = fmt.Errorf("create voters role binding: %w", err)
 		return
 	}
+	// Seed any additional RBAC objects requested by the caller.
+	if opts.RBACManifest != nil {
+		err = opts.RBACManifest.Apply(ctx, rb)
+		if err != nil {
+			err = fmt.Errorf("apply rbac manifest: %w", err)
+			return
+		}
+	}
 	// We initialized rbac, but if the caller wants, we'll go ahead and disable it.
 	if opts.DisableRBAC {
 		err = rb.SetEnabled(ctx, false)
@@ -250,15 +305,17 @@ func Bootstrap(ctx context.Context, db MeshDB, opts *BootstrapOptions) (results
 	nw := db.Networking()
 
 	// Create a network ACL that ensures bootstrap servers and admins can continue to
-	// communicate with each other.
-	// TODO: This should be filtered to only apply to internal traffic.
-	err = nw.PutNetworkACL(ctx, meshtypes.NetworkACL{NetworkACL: &v1.NetworkACL{
-		Name:             string(BootstrapNodesNetworkACLName),
-		Priority:         math.MaxInt32,
-		SourceNodes:      []string{"group:" + string(VotersGroup)},
-		DestinationNodes: []string{"group:" + string(VotersGroup)},
-		Action:           v1.ACLAction_ACTION_ACCEPT,
-	}})
+	// communicate with each other. It only matches internal control-plane traffic.
+	err = nw.PutNetworkACL(ctx, meshtypes.NetworkACL{
+		NetworkACL: &v1.NetworkACL{
+			Name:             string(BootstrapNodesNetworkACLName),
+			Priority:         math.MaxInt32,
+			SourceNodes:      []string{"group:" + string(VotersGroup)},
+			DestinationNodes: []string{"group:" + string(VotersGroup)},
+			Action:           v1.ACLAction_ACTION_ACCEPT,
+		},
+		InternalOnly: true,
+	})
 	if err != nil {
 		err = fmt.Errorf("create bootstrap nodes network acl: %w", err)
 		return
@@ -266,7 +323,7 @@ func Bootstrap(ctx context.Context, db MeshDB, opts *BootstrapOptions) (results
 	// Apply a default accept policy if configured
 	if opts.DefaultNetworkPolicy == "accept" {
 		err = nw.PutNetworkACL(ctx, meshtypes.NetworkACL{NetworkACL: &v1.NetworkACL{
-			Name:             "default-accept",
+			Name:             string(DefaultAcceptNetworkACLName),
 			Priority:         math.MinInt32,
 			SourceNodes:      []string{"*"},
 			DestinationNodes: []string{"*"},
@@ -27,6 +27,9 @@ import (
 // Is is a shortcut for errors.Is.
 var Is = errors.Is
 
+// As is a shortcut for errors.As.
+var As = errors.As
+
 // Common errors for storage providers to use.
 var (
 	// ErrNodeNotFound is returned when a node is not found.
@@ -45,6 +48,12 @@ var (
 	ErrNotLeader = fmt.Errorf("not leader")
 	// ErrNotVoter is returned when the node is not a voter.
 	ErrNotVoter = fmt.Errorf("not voter")
+	// ErrLogCompacted is returned when a requested log index has been
+	// compacted into a snapshot.
+	ErrLogCompacted = errors.New("log index has been compacted")
+	// ErrQuorumLost is returned for reads when the storage consensus has lost quorum
+	// and the provider is configured not to serve stale data.
+	ErrQuorumLost = errors.New("storage quorum lost")
 	// ErrAlreadyBootstrapped is returned when the storage provider is already bootstrapped.
 	ErrAlreadyBootstrapped = fmt.Errorf("already bootstrapped")
 	// ErrKeyNotFound is the error returned when a key is not found.
@@ -0,0 +1,59 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// HeartbeatsKey is the key holding the last heartbeat of every node. All
+// heartbeats are stored under a single key so that recording them costs one
+// write regardless of the number of nodes. It is inside the registry so that
+// it is included in snapshots and cannot be written by nodes directly.
+var HeartbeatsKey = []byte(types.RegistryPrefix.ForString("heartbeats"))
+
+// PutHeartbeats stores the given heartbeats, replacing any stored before.
+func PutHeartbeats(ctx context.Context, st MeshStorage, beats map[types.NodeID]time.Time) error {
+	data, err := json.Marshal(beats)
+	if err != nil {
+		return fmt.Errorf("marshal heartbeats: %w", err)
+	}
+	return st.PutValue(ctx, HeartbeatsKey, data, 0)
+}
+
+// GetHeartbeats returns the stored heartbeats keyed by node ID. Nodes that
+// have never sent a heartbeat are absent from the returned map.
+func GetHeartbeats(ctx context.Context, st MeshStorage) (map[types.NodeID]time.Time, error) {
+	beats := make(map[types.NodeID]time.Time)
+	data, err := st.GetValue(ctx, HeartbeatsKey)
+	if err != nil {
+		if errors.IsKeyNotFound(err) {
+			return beats, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &beats); err != nil {
+		return nil, fmt.Errorf("unmarshal heartbeats: %w", err)
+	}
+	return beats, nil
+}
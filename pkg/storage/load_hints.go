@@ -0,0 +1,77 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// LoadHintsPrefix is the prefix for node load hints. It is intentionally outside
+// of the registry so that nodes without storage can publish their own hints.
+var LoadHintsPrefix = types.StoragePrefix("/load-hints")
+
+// LoadHint is an advisory hint of the current load on a node. Clients choosing
+// between RPC peers may use it to weight their selection. Hints are published
+// with a TTL so that those of nodes that stop reporting expire on their own.
+type LoadHint struct {
+	// NodeID is the ID of the node the hint is for.
+	NodeID types.NodeID `json:"nodeID"`
+	// Connections is the number of open connections to the node's gRPC server.
+	Connections int `json:"connections"`
+	// UpdatedAt is when the node last reported the hint.
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Weight returns a relative weight for choosing the node, where less loaded
+// nodes have a higher weight. The weight is always in the range (0, 1].
+func (h LoadHint) Weight() float64 {
+	return 1 / float64(1+max(h.Connections, 0))
+}
+
+// LoadHintKey returns the key for the load hint of the given node.
+func LoadHintKey(id types.NodeID) []byte {
+	return LoadHintsPrefix.ForString(id.String())
+}
+
+// PutLoadHint publishes the given load hint with the given TTL.
+func PutLoadHint(ctx context.Context, st MeshStorage, hint LoadHint, ttl time.Duration) error {
+	data, err := json.Marshal(hint)
+	if err != nil {
+		return fmt.Errorf("marshal load hint: %w", err)
+	}
+	return st.PutValue(ctx, LoadHintKey(hint.NodeID), data, ttl)
+}
+
+// GetLoadHints returns the currently published load hints keyed by node ID.
+// Nodes that do not report hints are absent from the returned map.
+func GetLoadHints(ctx context.Context, st MeshStorage) (map[types.NodeID]LoadHint, error) {
+	hints := make(map[types.NodeID]LoadHint)
+	err := st.IterPrefix(ctx, LoadHintsPrefix.ForString(""), func(_, value []byte) error {
+		var hint LoadHint
+		if err := json.Unmarshal(value, &hint); err != nil {
+			return fmt.Errorf("unmarshal load hint: %w", err)
+		}
+		hints[hint.NodeID] = hint
+		return nil
+	})
+	return hints, err
+}
@@ -0,0 +1,369 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshdb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+var testRBACManifest = `
+roles:
+  - name: readers
+    rules:
+      - resources: [RESOURCE_EDGES, RESOURCE_ROUTES]
+        verbs: [VERB_GET]
+groups:
+  - name: operators
+    subjects:
+      - name: alice
+        type: SUBJECT_USER
+      - name: bob
+        type: SUBJECT_USER
+roleBindings:
+  - name: operators-readers
+    role: readers
+    subjects:
+      - name: operators
+        type: SUBJECT_GROUP
+  - name: extra-admins
+    role: mesh-admin
+    subjects:
+      - name: carol
+        type: SUBJECT_USER
+`
+
+func TestBootstrapWithRBACManifest(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := NewTestDB()
+	defer db.Close()
+
+	path := filepath.Join(t.TempDir(), "rbac.yaml")
+	if err := os.WriteFile(path, []byte(testRBACManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := storage.LoadRBACManifest(path)
+	if err != nil {
+		t.Fatalf("load rbac manifest: %v", err)
+	}
+	_, err = storage.Bootstrap(ctx, db, &storage.BootstrapOptions{RBACManifest: manifest})
+	if err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+
+	rb := db.RBAC()
+	// The built-in objects should still exist.
+	if _, err := rb.GetRole(ctx, string(storage.MeshAdminRole)); err != nil {
+		t.Errorf("get built-in admin role: %v", err)
+	}
+	role, err := rb.GetRole(ctx, "readers")
+	if err != nil {
+		t.Fatalf("get seeded role: %v", err)
+	}
+	if len(role.GetRules()) != 1 || len(role.GetRules()[0].GetResources()) != 2 {
+		t.Errorf("unexpected rules for seeded role: %v", role.GetRules())
+	}
+	if role.GetRules()[0].GetVerbs()[0] != v1.RuleVerb_VERB_GET {
+		t.Errorf("expected seeded role to allow get, got %v", role.GetRules()[0].GetVerbs())
+	}
+	group, err := rb.GetGroup(ctx, "operators")
+	if err != nil {
+		t.Fatalf("get seeded group: %v", err)
+	}
+	if len(group.GetSubjects()) != 2 {
+		t.Errorf("expected 2 subjects in seeded group, got %d", len(group.GetSubjects()))
+	}
+	for _, name := range []string{"operators-readers", "extra-admins"} {
+		if _, err := rb.GetRoleBinding(ctx, name); err != nil {
+			t.Errorf("get seeded role binding %q: %v", name, err)
+		}
+	}
+	roles, err := rb.ListUserRoles(ctx, "carol")
+	if err != nil {
+		t.Fatalf("list user roles: %v", err)
+	}
+	if len(roles) != 1 || roles[0].GetName() != string(storage.MeshAdminRole) {
+		t.Errorf("expected carol to be bound to the admin role, got %v", roles)
+	}
+}
+
+func TestBootstrapNodesACLScope(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db := NewTestDB()
+	defer db.Close()
+
+	_, err := storage.Bootstrap(ctx, db, &storage.BootstrapOptions{
+		BootstrapNodes:       []string{"node-a", "node-b"},
+		DefaultNetworkPolicy: "deny",
+	})
+	if err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+	acls, err := db.Networking().ListNetworkACLs(ctx)
+	if err != nil {
+		t.Fatalf("list network acls: %v", err)
+	}
+	if err := storage.ExpandACLs(ctx, db.RBAC(), acls); err != nil {
+		t.Fatalf("expand network acls: %v", err)
+	}
+	newNode := func(id, addr string) types.MeshNode {
+		return types.MeshNode{MeshNode: &v1.MeshNode{
+			Id:          id,
+			PrivateIPv4: addr,
+			Features: []*v1.FeaturePort{
+				{Feature: v1.Feature_NODES, Port: 8443},
+				{Feature: v1.Feature_STORAGE_PROVIDER, Port: 9000},
+			},
+		}}
+	}
+	nodeA := newNode("node-a", "172.16.0.1/32")
+	nodeB := newNode("node-b", "172.16.0.2/32")
+	for _, port := range []uint16{8443, 9000} {
+		if !acls.AllowTraffic(ctx, nodeA, nodeB, port) {
+			t.Errorf("expected control-plane port %d to be allowed between bootstrap nodes", port)
+		}
+	}
+	for _, port := range []uint16{22, 8080} {
+		if acls.AllowTraffic(ctx, nodeA, nodeB, port) {
+			t.Errorf("expected data port %d to be denied between bootstrap nodes", port)
+		}
+	}
+	// The nodes still need to peer to reach each other's control-plane ports.
+	if !acls.AllowNodesToCommunicate(ctx, nodeA, nodeB) {
+		t.Error("expected bootstrap nodes to be allowed to peer")
+	}
+	// Nodes outside the voters group are not covered at all.
+	nodeC := newNode("node-c", "172.16.0.3/32")
+	if acls.AllowTraffic(ctx, nodeC, nodeB, 9000) {
+		t.Error("expected non-voter to be denied control-plane access")
+	}
+	// The scope is stored with the ACL rather than implied by its name, so
+	// replacing it through the API lifts the restriction.
+	acl, err := db.Networking().GetNetworkACL(ctx, string(storage.BootstrapNodesNetworkACLName))
+	if err != nil {
+		t.Fatalf("get network acl: %v", err)
+	}
+	if !acl.InternalOnly {
+		t.Error("expected bootstrap nodes ACL to be stored as internal only")
+	}
+	err = db.Networking().PutNetworkACL(ctx, types.NetworkACL{NetworkACL: acl.NetworkACL})
+	if err != nil {
+		t.Fatalf("put network acl: %v", err)
+	}
+	acl, err = db.Networking().GetNetworkACL(ctx, string(storage.BootstrapNodesNetworkACLName))
+	if err != nil {
+		t.Fatalf("get network acl: %v", err)
+	}
+	if acl.InternalOnly {
+		t.Error("expected replaced bootstrap nodes ACL to apply to all traffic")
+	}
+}
+
+func TestBootstrapDryRun(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	tc := []struct {
+		name        string
+		opts        storage.BootstrapOptions
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name: "Valid",
+			opts: storage.BootstrapOptions{
+				BootstrapNodes: []string{"node-a", "node-b"},
+				Voters:         []string{"node-c"},
+			},
+		},
+		{
+			name:    "InvalidIPv4Network",
+			opts:    storage.BootstrapOptions{IPv4Network: "172.16.0.0"},
+			wantErr: true,
+		},
+		{
+			name:    "IPv6AsIPv4Network",
+			opts:    storage.BootstrapOptions{IPv4Network: "fd00::/8"},
+			wantErr: true,
+		},
+		{
+			name:    "WrongIPv6PrefixLength",
+			opts:    storage.BootstrapOptions{IPv6Network: "fd00::/64"},
+			wantErr: true,
+		},
+		{
+			name:        "InvalidVoter",
+			opts:        storage.BootstrapOptions{Voters: []string{"not a node"}},
+			wantErr:     true,
+			errContains: "voter",
+		},
+		{
+			name:        "InvalidBootstrapNode",
+			opts:        storage.BootstrapOptions{BootstrapNodes: []string{"not a node"}},
+			wantErr:     true,
+			errContains: "bootstrap node",
+		},
+		{
+			name: "InvalidRBACManifest",
+			opts: storage.BootstrapOptions{
+				RBACManifest: &storage.RBACManifest{
+					Roles: []types.Role{{Role: &v1.Role{
+						Name: string(storage.MeshAdminRole),
+						Rules: []*v1.Rule{{
+							Resources: []v1.RuleResource{v1.RuleResource_RESOURCE_ALL},
+							Verbs:     []v1.RuleVerb{v1.RuleVerb_VERB_ALL},
+						}},
+					}}},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			db := NewTestDB()
+			defer db.Close()
+			opts := tt.opts
+			opts.DryRun = true
+			results, err := storage.Bootstrap(ctx, db, &opts)
+			if tt.wantErr && err == nil {
+				t.Fatal("expected dry run to fail")
+			}
+			if tt.errContains != "" && !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("expected error to mention %q, got %v", tt.errContains, err)
+			}
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("dry run: %v", err)
+				}
+				if !results.NetworkV4.IsValid() || !results.NetworkV6.IsValid() {
+					t.Errorf("expected dry run to report the mesh networks, got %+v", results)
+				}
+			}
+			if _, err := db.MeshState().GetMeshState(ctx); !errors.IsNotFound(err) {
+				t.Errorf("expected no mesh state after dry run, got %v", err)
+			}
+			if _, err := db.RBAC().GetRole(ctx, string(storage.MeshAdminRole)); !errors.IsNotFound(err) {
+				t.Errorf("expected no rbac state after dry run, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInvalidRBACManifest(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name     string
+		manifest string
+	}{
+		{
+			name:     "MalformedYAML",
+			manifest: "roles: [",
+		},
+		{
+			name:     "UnknownEnum",
+			manifest: "roles:\n  - name: readers\n    rules:\n      - resources: [RESOURCE_BOGUS]\n        verbs: [VERB_GET]\n",
+		},
+		{
+			name:     "RoleWithoutRules",
+			manifest: "roles:\n  - name: readers\n",
+		},
+		{
+			name:     "RedefineSystemRole",
+			manifest: "roles:\n  - name: mesh-admin\n    rules:\n      - resources: [RESOURCE_ALL]\n        verbs: [VERB_ALL]\n",
+		},
+		{
+			name:     "BindingToUndefinedRole",
+			manifest: "roleBindings:\n  - name: binding\n    role: missing\n    subjects:\n      - name: alice\n        type: SUBJECT_USER\n",
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := storage.ParseRBACManifest([]byte(tt.manifest)); err == nil {
+				t.Fatal("expected error parsing invalid manifest")
+			}
+		})
+	}
+}
+
+func TestGetMeshConfig(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name string
+		opts storage.BootstrapOptions
+	}{
+		{
+			name: "Defaults",
+			opts: storage.BootstrapOptions{},
+		},
+		{
+			name: "CustomDropPolicy",
+			opts: storage.BootstrapOptions{
+				MeshDomain:           "custom.internal",
+				IPv4Network:          "10.10.0.0/16",
+				IPv6Network:          "fd00:dead:beef::/48",
+				DefaultNetworkPolicy: "drop",
+			},
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			db := NewTestDB()
+			defer db.Close()
+			results, err := storage.Bootstrap(ctx, db, &tt.opts)
+			if err != nil {
+				t.Fatalf("bootstrap: %v", err)
+			}
+			config, err := storage.GetMeshConfig(ctx, db)
+			if err != nil {
+				t.Fatalf("get mesh config: %v", err)
+			}
+			if config.NetworkV4 != results.NetworkV4 {
+				t.Errorf("expected IPv4 network %s, got %s", results.NetworkV4, config.NetworkV4)
+			}
+			if config.NetworkV6 != results.NetworkV6 {
+				t.Errorf("expected IPv6 network %s, got %s", results.NetworkV6, config.NetworkV6)
+			}
+			if config.Domain != tt.opts.MeshDomain {
+				t.Errorf("expected domain %q, got %q", tt.opts.MeshDomain, config.Domain)
+			}
+			if config.DefaultNetworkPolicy != tt.opts.DefaultNetworkPolicy {
+				t.Errorf("expected default network policy %q, got %q", tt.opts.DefaultNetworkPolicy, config.DefaultNetworkPolicy)
+			}
+		})
+	}
+}
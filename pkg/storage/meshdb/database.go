@@ -168,6 +168,22 @@ func (v *ValidatingMeshStateStore) GetMeshState(ctx context.Context) (types.Netw
 	return v.MeshState.GetMeshState(ctx)
 }
 
+// PutDNSRecord validates the record and makes sure a CNAME is not mixed with
+// other records of the same name before saving it.
+func (v *ValidatingMeshStateStore) PutDNSRecord(ctx context.Context, record types.DNSRecord) error {
+	if err := types.ValidateDNSRecord(record); err != nil {
+		return fmt.Errorf("validate dns record: %w", err)
+	}
+	existing, err := v.MeshState.GetDNSRecords(ctx, record.Name)
+	if err != nil {
+		return fmt.Errorf("get dns records: %w", err)
+	}
+	if err := types.ValidateDNSRecordConflicts(existing, record); err != nil {
+		return err
+	}
+	return v.MeshState.PutDNSRecord(ctx, record)
+}
+
 // ValidatingPeerStore wraps graph store implementation with a simpler to use
 // peer store interface.
 type ValidatingPeerStore struct {
@@ -534,6 +550,35 @@ func (v *ValidatingNetworkingStore) DeleteRoute(ctx context.Context, name string
 	return v.Networking.DeleteRoute(ctx, name)
 }
 
+// PutSecondaryIPs creates or replaces the secondary IP leases for a node.
+func (v *ValidatingNetworkingStore) PutSecondaryIPs(ctx context.Context, ips types.SecondaryIPs) error {
+	if !ips.NodeID.IsValid() {
+		return fmt.Errorf("%w: %s", errors.ErrInvalidNodeID, ips.NodeID)
+	}
+	for _, addr := range ips.Addresses {
+		if !addr.IsValid() {
+			return fmt.Errorf("%w: %s", errors.ErrInvalidPrefix, addr)
+		}
+	}
+	return v.Networking.PutSecondaryIPs(ctx, ips)
+}
+
+// GetSecondaryIPs returns the secondary IP leases for a node.
+func (v *ValidatingNetworkingStore) GetSecondaryIPs(ctx context.Context, nodeID types.NodeID) (types.SecondaryIPs, error) {
+	if !nodeID.IsValid() {
+		return types.SecondaryIPs{}, fmt.Errorf("%w: %s", errors.ErrInvalidNodeID, nodeID)
+	}
+	return v.Networking.GetSecondaryIPs(ctx, nodeID)
+}
+
+// DeleteSecondaryIPs releases all secondary IP leases held by a node.
+func (v *ValidatingNetworkingStore) DeleteSecondaryIPs(ctx context.Context, nodeID types.NodeID) error {
+	if !nodeID.IsValid() {
+		return fmt.Errorf("%w: %s", errors.ErrInvalidNodeID, nodeID)
+	}
+	return v.Networking.DeleteSecondaryIPs(ctx, nodeID)
+}
+
 // ValidatingRBACStore wraps a storage.RBAC and automatically performs the
 // necessary validation on all operations.
 type ValidatingRBACStore struct {
@@ -19,17 +19,33 @@ package networking
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/netip"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/storage"
 	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb/state"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
 type Networking = storage.Networking
 
+type forceRouteKey struct{}
+
+// WithForceRoute returns a context that instructs PutRoute to skip checking
+// route destinations against the mesh networks.
+func WithForceRoute(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceRouteKey{}, true)
+}
+
+// ForceRouteFrom returns true if the given context was created with WithForceRoute.
+func ForceRouteFrom(ctx context.Context) bool {
+	force, ok := ctx.Value(forceRouteKey{}).(bool)
+	return ok && force
+}
+
 // New returns a new Networking interface.
 func New(st storage.MeshStorage) Networking {
 	return &networking{st}
@@ -54,6 +70,15 @@ func (n *networking) PutNetworkACL(ctx context.Context, acl types.NetworkACL) er
 	if err != nil {
 		return fmt.Errorf("put network acl: %w", err)
 	}
+	internalKey := storage.InternalNetworkACLsPrefix.For([]byte(acl.GetName()))
+	if acl.InternalOnly {
+		err = n.PutValue(ctx, internalKey, []byte(acl.GetName()), 0)
+	} else {
+		err = n.Delete(ctx, internalKey)
+	}
+	if err != nil && !errors.IsKeyNotFound(err) {
+		return fmt.Errorf("put network acl scope: %w", err)
+	}
 	return nil
 }
 
@@ -72,6 +97,11 @@ func (n *networking) GetNetworkACL(ctx context.Context, name string) (types.Netw
 	if err != nil {
 		return types.NetworkACL{}, fmt.Errorf("unmarshal network acl: %w", err)
 	}
+	_, err = n.GetValue(ctx, storage.InternalNetworkACLsPrefix.For([]byte(name)))
+	if err != nil && !errors.IsKeyNotFound(err) {
+		return types.NetworkACL{}, fmt.Errorf("get network acl scope: %w", err)
+	}
+	acl.InternalOnly = err == nil
 	return acl, nil
 }
 
@@ -82,13 +112,27 @@ func (n *networking) DeleteNetworkACL(ctx context.Context, name string) error {
 	if err != nil && !errors.IsKeyNotFound(err) {
 		return fmt.Errorf("delete network acl: %w", err)
 	}
+	err = n.Delete(ctx, storage.InternalNetworkACLsPrefix.For([]byte(name)))
+	if err != nil && !errors.IsKeyNotFound(err) {
+		return fmt.Errorf("delete network acl scope: %w", err)
+	}
 	return nil
 }
 
 // ListNetworkACLs returns a list of NetworkACLs.
 func (n *networking) ListNetworkACLs(ctx context.Context) (types.NetworkACLs, error) {
+	internal := make(map[string]struct{})
+	err := n.IterPrefix(ctx, storage.InternalNetworkACLsPrefix, func(key, value []byte) error {
+		if !bytes.Equal(key, storage.InternalNetworkACLsPrefix) {
+			internal[string(value)] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list network acl scopes: %w", err)
+	}
 	out := make(types.NetworkACLs, 0)
-	err := n.IterPrefix(ctx, storage.NetworkACLsPrefix, func(key, value []byte) error {
+	err = n.IterPrefix(ctx, storage.NetworkACLsPrefix, func(key, value []byte) error {
 		if bytes.Equal(key, storage.NetworkACLsPrefix) {
 			return nil
 		}
@@ -97,6 +141,7 @@ func (n *networking) ListNetworkACLs(ctx context.Context) (types.NetworkACLs, er
 		if err != nil {
 			return fmt.Errorf("unmarshal network acl: %w", err)
 		}
+		_, acl.InternalOnly = internal[acl.GetName()]
 		out = append(out, acl)
 		return nil
 	})
@@ -109,6 +154,12 @@ func (n *networking) PutRoute(ctx context.Context, route types.Route) error {
 	if err != nil {
 		return fmt.Errorf("%w: %w", errors.ErrInvalidRoute, err)
 	}
+	if !ForceRouteFrom(ctx) {
+		err = n.checkRouteAgainstMeshNetworks(ctx, route)
+		if err != nil {
+			return err
+		}
+	}
 	key := storage.RoutesPrefix.For([]byte(route.GetName()))
 	data, err := route.MarshalProtoJSON()
 	if err != nil {
@@ -121,6 +172,37 @@ func (n *networking) PutRoute(ctx context.Context, route types.Route) error {
 	return nil
 }
 
+// checkRouteAgainstMeshNetworks ensures none of the route's destinations fall within
+// the mesh IPv4 or IPv6 networks. Advertising the mesh's own prefix (or a subnet of it)
+// would cause a routing loop. Broader routes, such as default gateways, are allowed
+// since the more specific mesh routes will always take precedence.
+func (n *networking) checkRouteAgainstMeshNetworks(ctx context.Context, route types.Route) error {
+	var networks []netip.Prefix
+	for _, key := range [][]byte{state.IPv4PrefixKey, state.IPv6PrefixKey} {
+		data, err := n.GetValue(ctx, key)
+		if err != nil {
+			if errors.IsKeyNotFound(err) {
+				// The mesh has not been bootstrapped yet.
+				continue
+			}
+			return fmt.Errorf("get mesh network: %w", err)
+		}
+		network, err := netip.ParsePrefix(string(data))
+		if err != nil {
+			return fmt.Errorf("parse mesh network: %w", err)
+		}
+		networks = append(networks, network)
+	}
+	for _, dest := range route.DestinationPrefixes() {
+		for _, network := range networks {
+			if dest.Bits() >= network.Bits() && network.Contains(dest.Addr()) {
+				return fmt.Errorf("%w: destination %s overlaps mesh network %s", errors.ErrInvalidRoute, dest, network)
+			}
+		}
+	}
+	return nil
+}
+
 // GetRoute returns a Route by name.
 func (n *networking) GetRoute(ctx context.Context, name string) (types.Route, error) {
 	key := storage.RoutesPrefix.For([]byte(name))
@@ -204,3 +286,60 @@ func (n *networking) ListRoutes(ctx context.Context) (types.Routes, error) {
 	})
 	return out, err
 }
+
+// PutSecondaryIPs creates or replaces the secondary IP leases for a node.
+func (n *networking) PutSecondaryIPs(ctx context.Context, ips types.SecondaryIPs) error {
+	data, err := json.Marshal(ips)
+	if err != nil {
+		return fmt.Errorf("marshal secondary ips: %w", err)
+	}
+	err = n.PutValue(ctx, storage.SecondaryIPsPrefix.For([]byte(ips.NodeID)), data, 0)
+	if err != nil {
+		return fmt.Errorf("put secondary ips: %w", err)
+	}
+	return nil
+}
+
+// GetSecondaryIPs returns the secondary IP leases for a node.
+func (n *networking) GetSecondaryIPs(ctx context.Context, nodeID types.NodeID) (types.SecondaryIPs, error) {
+	data, err := n.GetValue(ctx, storage.SecondaryIPsPrefix.For([]byte(nodeID)))
+	if err != nil {
+		if errors.IsKeyNotFound(err) {
+			return types.SecondaryIPs{NodeID: nodeID}, nil
+		}
+		return types.SecondaryIPs{}, fmt.Errorf("get secondary ips: %w", err)
+	}
+	var ips types.SecondaryIPs
+	err = json.Unmarshal(data, &ips)
+	if err != nil {
+		return types.SecondaryIPs{}, fmt.Errorf("unmarshal secondary ips: %w", err)
+	}
+	return ips, nil
+}
+
+// DeleteSecondaryIPs releases all secondary IP leases held by a node.
+func (n *networking) DeleteSecondaryIPs(ctx context.Context, nodeID types.NodeID) error {
+	err := n.Delete(ctx, storage.SecondaryIPsPrefix.For([]byte(nodeID)))
+	if err != nil && !errors.IsKeyNotFound(err) {
+		return fmt.Errorf("delete secondary ips: %w", err)
+	}
+	return nil
+}
+
+// ListSecondaryIPs returns the secondary IP leases for all nodes.
+func (n *networking) ListSecondaryIPs(ctx context.Context) ([]types.SecondaryIPs, error) {
+	out := make([]types.SecondaryIPs, 0)
+	err := n.IterPrefix(ctx, storage.SecondaryIPsPrefix, func(key, value []byte) error {
+		if bytes.Equal(key, storage.SecondaryIPsPrefix) {
+			return nil
+		}
+		var ips types.SecondaryIPs
+		err := json.Unmarshal(value, &ips)
+		if err != nil {
+			return fmt.Errorf("unmarshal secondary ips: %w", err)
+		}
+		out = append(out, ips)
+		return nil
+	})
+	return out, err
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package networking
+
+import (
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb/state"
+	"github.com/webmeshproj/webmesh/pkg/storage/providers/backends/badgerdb"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestPutRouteMeshOverlap(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name    string
+		cidrs   []string
+		force   bool
+		wantErr bool
+	}{
+		{
+			name:  "ExternalRoute",
+			cidrs: []string{"192.168.1.0/24", "fd00:dead:beef::/48"},
+		},
+		{
+			name:  "DefaultRoute",
+			cidrs: []string{"0.0.0.0/0", "::/0"},
+		},
+		{
+			name:    "MeshIPv4Network",
+			cidrs:   []string{"172.16.0.0/12"},
+			wantErr: true,
+		},
+		{
+			name:    "MeshIPv4Subnet",
+			cidrs:   []string{"192.168.1.0/24", "172.16.10.0/24"},
+			wantErr: true,
+		},
+		{
+			name:    "MeshIPv6Subnet",
+			cidrs:   []string{"fdbc:1df9:b561::/64"},
+			wantErr: true,
+		},
+		{
+			name:  "ForcedMeshOverlap",
+			cidrs: []string{"172.16.10.0/24"},
+			force: true,
+		},
+	}
+
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			db := badgerdb.NewTestStorage(false)
+			defer db.Close()
+			err := state.New(db).SetMeshState(ctx, types.NetworkState{NetworkState: &v1.NetworkState{
+				NetworkV4: "172.16.0.0/12",
+				NetworkV6: "fdbc:1df9:b561::/48",
+				Domain:    "webmesh.internal.",
+			}})
+			if err != nil {
+				t.Fatalf("set mesh state: %v", err)
+			}
+			if tt.force {
+				ctx = WithForceRoute(ctx)
+			}
+			err = New(db).PutRoute(ctx, types.Route{Route: &v1.Route{
+				Name:             "test-route",
+				Node:             "test-node",
+				DestinationCIDRs: tt.cidrs,
+			}})
+			if tt.wantErr {
+				if !errors.IsInvalidRoute(err) {
+					t.Fatalf("expected invalid route error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meshdb
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestPolicyBundleRoundTrip(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	src := NewTestDB()
+	defer src.Close()
+	role := types.Role{Role: &v1.Role{
+		Name: "readers",
+		Rules: []*v1.Rule{{
+			Resources: []v1.RuleResource{v1.RuleResource_RESOURCE_ROUTES},
+			Verbs:     []v1.RuleVerb{v1.RuleVerb_VERB_GET},
+		}},
+	}}
+	group := types.Group{Group: &v1.Group{
+		Name:     "operators",
+		Subjects: []*v1.Subject{{Name: "alice", Type: v1.SubjectType_SUBJECT_USER}},
+	}}
+	binding := types.RoleBinding{RoleBinding: &v1.RoleBinding{
+		Name:     "operators-readers",
+		Role:     "readers",
+		Subjects: []*v1.Subject{{Name: "operators", Type: v1.SubjectType_SUBJECT_GROUP}},
+	}}
+	acl := types.NetworkACL{NetworkACL: &v1.NetworkACL{
+		Name:             "allow-all",
+		Action:           v1.ACLAction_ACTION_ACCEPT,
+		SourceNodes:      []string{"*"},
+		DestinationNodes: []string{"*"},
+		SourceCIDRs:      []string{"*"},
+		DestinationCIDRs: []string{"*"},
+	}}
+	route := types.Route{Route: &v1.Route{
+		Name:             "office",
+		Node:             "gateway",
+		DestinationCIDRs: []string{"10.10.0.0/16"},
+	}}
+	if err := src.RBAC().PutRole(ctx, role); err != nil {
+		t.Fatalf("put role: %v", err)
+	}
+	if err := src.RBAC().PutGroup(ctx, group); err != nil {
+		t.Fatalf("put group: %v", err)
+	}
+	if err := src.RBAC().PutRoleBinding(ctx, binding); err != nil {
+		t.Fatalf("put role binding: %v", err)
+	}
+	if err := src.Networking().PutNetworkACL(ctx, acl); err != nil {
+		t.Fatalf("put network acl: %v", err)
+	}
+	if err := src.Networking().PutRoute(ctx, route); err != nil {
+		t.Fatalf("put route: %v", err)
+	}
+	// System ACLs and routes managed for nodes are never exported.
+	if err := src.Networking().PutNetworkACL(ctx, types.NetworkACL{NetworkACL: &v1.NetworkACL{
+		Name:             string(storage.DefaultAcceptNetworkACLName),
+		Action:           v1.ACLAction_ACTION_ACCEPT,
+		SourceNodes:      []string{"*"},
+		DestinationNodes: []string{"*"},
+	}}); err != nil {
+		t.Fatalf("put network acl: %v", err)
+	}
+	if err := src.Networking().PutRoute(ctx, types.Route{Route: &v1.Route{
+		Name:             storage.NodeAutoRouteName("gateway"),
+		Node:             "gateway",
+		DestinationCIDRs: []string{"10.20.0.0/16"},
+	}}); err != nil {
+		t.Fatalf("put route: %v", err)
+	}
+	lease := netip.MustParsePrefix("fd00:dead:beef::10/128")
+	if err := src.Networking().PutSecondaryIPs(ctx, types.SecondaryIPs{
+		NodeID:    "gateway",
+		Addresses: []netip.Prefix{lease},
+	}); err != nil {
+		t.Fatalf("put secondary ips: %v", err)
+	}
+	if err := src.Networking().PutRoute(ctx, types.Route{Route: &v1.Route{
+		Name:             "gateway-lease",
+		Node:             "gateway",
+		DestinationCIDRs: []string{lease.String()},
+	}}); err != nil {
+		t.Fatalf("put route: %v", err)
+	}
+
+	exported, err := storage.ExportPolicyBundle(ctx, src)
+	if err != nil {
+		t.Fatalf("export bundle: %v", err)
+	}
+	if len(exported.Roles) != 1 || len(exported.Groups) != 1 || len(exported.RoleBindings) != 1 ||
+		len(exported.NetworkACLs) != 1 || len(exported.Routes) != 1 {
+		t.Fatalf("expected one of each object in the exported bundle, got %+v", exported)
+	}
+	for name, encode := range map[string]func() ([]byte, error){
+		"YAML": exported.EncodeYAML,
+		"JSON": exported.EncodeJSON,
+	} {
+		data, err := encode()
+		if err != nil {
+			t.Fatalf("encode %s bundle: %v", name, err)
+		}
+		bundle, err := storage.ParsePolicyBundle(data)
+		if err != nil {
+			t.Fatalf("parse %s bundle: %v", name, err)
+		}
+		dst := NewTestDB()
+		defer dst.Close()
+		skipped, err := bundle.Import(ctx, dst, storage.ConflictSkip)
+		if err != nil {
+			t.Fatalf("import %s bundle: %v", name, err)
+		}
+		if len(skipped) != 0 {
+			t.Fatalf("expected nothing skipped importing into an empty store, got %v", skipped)
+		}
+		imported, err := storage.ExportPolicyBundle(ctx, dst)
+		if err != nil {
+			t.Fatalf("export imported bundle: %v", err)
+		}
+		assertBundlesEqual(t, exported, imported)
+	}
+
+	// Conflicting objects are left alone when skipping and replaced when overwriting.
+	dst := NewTestDB()
+	defer dst.Close()
+	changed := types.Role{Role: proto.Clone(role.Role).(*v1.Role)}
+	changed.Rules[0].Verbs = []v1.RuleVerb{v1.RuleVerb_VERB_ALL}
+	if err := dst.RBAC().PutRole(ctx, changed); err != nil {
+		t.Fatalf("put role: %v", err)
+	}
+	skipped, err := exported.Import(ctx, dst, storage.ConflictSkip)
+	if err != nil {
+		t.Fatalf("import bundle: %v", err)
+	}
+	if !slices.Equal(skipped, []string{"role/readers"}) {
+		t.Fatalf("expected the existing role to be skipped, got %v", skipped)
+	}
+	got, err := dst.RBAC().GetRole(ctx, "readers")
+	if err != nil {
+		t.Fatalf("get role: %v", err)
+	}
+	if !proto.Equal(got.Role, changed.Role) {
+		t.Fatalf("expected skipped role to be unchanged, got %v", got.Role)
+	}
+	if _, err := exported.Import(ctx, dst, storage.ConflictOverwrite); err != nil {
+		t.Fatalf("import bundle: %v", err)
+	}
+	got, err = dst.RBAC().GetRole(ctx, "readers")
+	if err != nil {
+		t.Fatalf("get role: %v", err)
+	}
+	if !proto.Equal(got.Role, role.Role) {
+		t.Fatalf("expected role to be overwritten, got %v", got.Role)
+	}
+}
+
+func assertBundlesEqual(t *testing.T, want, got *storage.PolicyBundle) {
+	t.Helper()
+	check := func(kind string, want, got []proto.Message) {
+		t.Helper()
+		if len(want) != len(got) {
+			t.Fatalf("expected %d %s, got %d", len(want), kind, len(got))
+		}
+		for i := range want {
+			if !proto.Equal(want[i], got[i]) {
+				t.Fatalf("expected %s %v, got %v", kind, want[i], got[i])
+			}
+		}
+	}
+	check("roles", messages(want.Roles, func(r types.Role) proto.Message { return r.Role }), messages(got.Roles, func(r types.Role) proto.Message { return r.Role }))
+	check("groups", messages(want.Groups, func(g types.Group) proto.Message { return g.Group }), messages(got.Groups, func(g types.Group) proto.Message { return g.Group }))
+	check("role bindings", messages(want.RoleBindings, func(rb types.RoleBinding) proto.Message { return rb.RoleBinding }), messages(got.RoleBindings, func(rb types.RoleBinding) proto.Message { return rb.RoleBinding }))
+	check("network acls", messages(want.NetworkACLs, func(a types.NetworkACL) proto.Message { return a.NetworkACL }), messages(got.NetworkACLs, func(a types.NetworkACL) proto.Message { return a.NetworkACL }))
+	check("routes", messages(want.Routes, func(r types.Route) proto.Message { return r.Route }), messages(got.Routes, func(r types.Route) proto.Message { return r.Route }))
+}
+
+func messages[T any](items []T, fn func(T) proto.Message) []proto.Message {
+	out := make([]proto.Message, len(items))
+	for i, item := range items {
+		out[i] = fn(item)
+	}
+	return out
+}
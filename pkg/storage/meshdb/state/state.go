@@ -19,6 +19,8 @@ package state
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/netip"
 
 	v1 "github.com/webmeshproj/api/go/v1"
@@ -38,8 +40,15 @@ var (
 	IPv4PrefixKey = append(MeshStatePrefix, []byte("/ipv4prefix")...)
 	// MeshDomainKey is the key for the mesh domain.
 	MeshDomainKey = append(MeshStatePrefix, []byte("/meshdomain")...)
+	// DNSRecordsPrefix is the prefix for static DNS records.
+	DNSRecordsPrefix = append(MeshStatePrefix, []byte("/dnsrecords")...)
 )
 
+// DNSRecordKey returns the key for the static DNS record with the given name and type.
+func DNSRecordKey(name string, typ types.DNSRecordType) []byte {
+	return []byte(fmt.Sprintf("%s/%s/%s", DNSRecordsPrefix, name, typ))
+}
+
 type state struct {
 	storage.MeshStorage
 }
@@ -138,3 +147,36 @@ func (s *state) GetMeshState(ctx context.Context) (types.NetworkState, error) {
 	state.NetworkState.NetworkV6 = networkv6.String()
 	return state, nil
 }
+
+func (s *state) PutDNSRecord(ctx context.Context, record types.DNSRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal dns record: %w", err)
+	}
+	return s.PutValue(ctx, DNSRecordKey(record.Name, record.Type), data, 0)
+}
+
+func (s *state) GetDNSRecords(ctx context.Context, name string) (types.DNSRecords, error) {
+	return s.listDNSRecords(ctx, []byte(fmt.Sprintf("%s/%s/", DNSRecordsPrefix, name)))
+}
+
+func (s *state) DeleteDNSRecord(ctx context.Context, name string, typ types.DNSRecordType) error {
+	return s.Delete(ctx, DNSRecordKey(name, typ))
+}
+
+func (s *state) ListDNSRecords(ctx context.Context) (types.DNSRecords, error) {
+	return s.listDNSRecords(ctx, []byte(fmt.Sprintf("%s/", DNSRecordsPrefix)))
+}
+
+func (s *state) listDNSRecords(ctx context.Context, prefix []byte) (types.DNSRecords, error) {
+	out := make(types.DNSRecords, 0)
+	err := s.IterPrefix(ctx, prefix, func(_, value []byte) error {
+		var record types.DNSRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return fmt.Errorf("unmarshal dns record: %w", err)
+		}
+		out = append(out, record)
+		return nil
+	})
+	return out, err
+}
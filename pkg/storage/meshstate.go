@@ -18,7 +18,12 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
 
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
@@ -28,4 +33,73 @@ type MeshState interface {
 	SetMeshState(ctx context.Context, state types.NetworkState) error
 	// GetMeshState returns the full mesh state.
 	GetMeshState(ctx context.Context) (types.NetworkState, error)
+	// PutDNSRecord creates or replaces a static DNS record.
+	PutDNSRecord(ctx context.Context, record types.DNSRecord) error
+	// GetDNSRecords returns the static DNS records of any type with the given name.
+	// An empty list is returned if there are none.
+	GetDNSRecords(ctx context.Context, name string) (types.DNSRecords, error)
+	// DeleteDNSRecord deletes the static DNS record with the given name and type.
+	DeleteDNSRecord(ctx context.Context, name string, typ types.DNSRecordType) error
+	// ListDNSRecords returns all static DNS records.
+	ListDNSRecords(ctx context.Context) (types.DNSRecords, error)
+}
+
+// MeshConfig is the cluster-wide configuration of a mesh.
+type MeshConfig struct {
+	// NetworkV4 is the IPv4 network of the mesh.
+	NetworkV4 netip.Prefix `json:"networkV4"`
+	// NetworkV6 is the IPv6 network of the mesh.
+	NetworkV6 netip.Prefix `json:"networkV6"`
+	// Domain is the DNS domain of the mesh.
+	Domain string `json:"domain"`
+	// DefaultNetworkPolicy is the default network policy of the mesh,
+	// either accept or drop.
+	DefaultNetworkPolicy string `json:"defaultNetworkPolicy"`
+}
+
+// GetMeshConfig returns the cluster-wide configuration of the mesh from the given
+// database. The default network policy is accept if the ACL created for it at
+// bootstrap exists, otherwise drop.
+func GetMeshConfig(ctx context.Context, db MeshDB) (MeshConfig, error) {
+	var config MeshConfig
+	state, err := db.MeshState().GetMeshState(ctx)
+	if err != nil {
+		return config, fmt.Errorf("get mesh state: %w", err)
+	}
+	config.NetworkV4 = state.NetworkV4()
+	config.NetworkV6 = state.NetworkV6()
+	config.Domain = state.Domain()
+	config.DefaultNetworkPolicy = "accept"
+	_, err = db.Networking().GetNetworkACL(ctx, string(DefaultAcceptNetworkACLName))
+	if err != nil {
+		if !errors.IsACLNotFound(err) {
+			return config, fmt.Errorf("get default network acl: %w", err)
+		}
+		config.DefaultNetworkPolicy = "drop"
+	}
+	return config, nil
+}
+
+// ValidateDistinctDomains returns an error if any two of the given mesh databases,
+// keyed by mesh ID, share a mesh domain. Meshes with the same domain cannot be
+// bridged because names in one would be ambiguous with names in the other.
+func ValidateDistinctDomains(ctx context.Context, dbs map[string]MeshDB) error {
+	ids := make([]string, 0, len(dbs))
+	for id := range dbs {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	seen := make(map[string]string, len(ids))
+	for _, id := range ids {
+		state, err := dbs[id].MeshState().GetMeshState(ctx)
+		if err != nil {
+			return fmt.Errorf("get mesh state for mesh %q: %w", id, err)
+		}
+		domain := strings.ToLower(strings.TrimSuffix(state.Domain(), "."))
+		if other, ok := seen[domain]; ok {
+			return fmt.Errorf("meshes %q and %q have the same mesh domain %q", other, id, domain)
+		}
+		seen[domain] = id
+	}
+	return nil
 }
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+func TestValidateDistinctDomains(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("DistinctDomains", func(t *testing.T) {
+		t.Parallel()
+		err := ValidateDistinctDomains(ctx, map[string]MeshDB{
+			"mesh-a": newDomainDB("a.internal"),
+			"mesh-b": newDomainDB("b.internal"),
+		})
+		if err != nil {
+			t.Fatalf("expected no error for distinct domains, got %v", err)
+		}
+	})
+
+	t.Run("SameDomain", func(t *testing.T) {
+		t.Parallel()
+		err := ValidateDistinctDomains(ctx, map[string]MeshDB{
+			"mesh-a": newDomainDB("webmesh.internal"),
+			"mesh-b": newDomainDB("Webmesh.Internal."),
+		})
+		if err == nil {
+			t.Fatal("expected error bridging meshes with the same domain")
+		}
+		if !strings.Contains(err.Error(), "webmesh.internal") {
+			t.Fatalf("expected error to name the conflicting domain, got %v", err)
+		}
+	})
+}
+
+// domainDB is a mesh database that only knows its mesh domain.
+type domainDB struct {
+	MeshDB
+	state domainState
+}
+
+func newDomainDB(domain string) *domainDB {
+	return &domainDB{state: domainState{domain: domain}}
+}
+
+func (d *domainDB) MeshState() MeshState {
+	return &d.state
+}
+
+type domainState struct {
+	MeshState
+	domain string
+}
+
+func (d *domainState) GetMeshState(context.Context) (types.NetworkState, error) {
+	return types.NetworkState{NetworkState: &v1.NetworkState{Domain: d.domain}}, nil
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package storage
 
 import (
+	"fmt"
 	"net/netip"
 	"slices"
 	"strings"
@@ -28,13 +29,33 @@ import (
 
 var (
 	// BootstrapNodesNetworkACLName is the name of the bootstrap nodes NetworkACL.
-	BootstrapNodesNetworkACLName = []byte("bootstrap-nodes")
+	BootstrapNodesNetworkACLName = []byte(types.BootstrapNodesNetworkACL)
+	// DefaultAcceptNetworkACLName is the name of the NetworkACL created when
+	// bootstrapping a mesh with a default accept policy.
+	DefaultAcceptNetworkACLName = []byte("default-accept")
 	// NetworkACLsPrefix is where NetworkACLs are stored in the database.
 	NetworkACLsPrefix = types.RegistryPrefix.For([]byte("network-acls"))
+	// InternalNetworkACLsPrefix is where the names of NetworkACLs restricted to
+	// internal control-plane traffic are stored in the database.
+	InternalNetworkACLsPrefix = types.RegistryPrefix.For([]byte("internal-network-acls"))
 	// RoutesPrefix is where Routes are stored in the database.
 	RoutesPrefix = types.RegistryPrefix.For([]byte("routes"))
+	// SecondaryIPsPrefix is where secondary IP leases are stored in the database.
+	SecondaryIPsPrefix = types.RegistryPrefix.For([]byte("secondary-ips"))
 )
 
+// IsSystemNetworkACL returns true if the NetworkACL is managed by the mesh
+// itself, either for bootstrap nodes or for the default accept policy.
+func IsSystemNetworkACL(name string) bool {
+	return name == string(BootstrapNodesNetworkACLName) || name == string(DefaultAcceptNetworkACLName)
+}
+
+// NodeAutoRouteName returns the name of the Route managed for a node from the
+// routes it advertises when joining or bootstrapping.
+func NodeAutoRouteName(nodeID types.NodeID) string {
+	return fmt.Sprintf("%s-auto", nodeID)
+}
+
 // Networking is the interface to the database models for network resources.
 type Networking interface {
 	// PutNetworkACL creates or updates a NetworkACL.
@@ -57,6 +78,15 @@ type Networking interface {
 	DeleteRoute(ctx context.Context, name string) error
 	// ListRoutes returns a list of Routes.
 	ListRoutes(ctx context.Context) (types.Routes, error)
+	// PutSecondaryIPs creates or replaces the secondary IP leases for a node.
+	PutSecondaryIPs(ctx context.Context, ips types.SecondaryIPs) error
+	// GetSecondaryIPs returns the secondary IP leases for a node. A node without
+	// any leases returns an empty set.
+	GetSecondaryIPs(ctx context.Context, nodeID types.NodeID) (types.SecondaryIPs, error)
+	// DeleteSecondaryIPs releases all secondary IP leases held by a node.
+	DeleteSecondaryIPs(ctx context.Context, nodeID types.NodeID) error
+	// ListSecondaryIPs returns the secondary IP leases for all nodes.
+	ListSecondaryIPs(ctx context.Context) ([]types.SecondaryIPs, error)
 }
 
 // ExpandACLs will use the given RBAC interface to expand any group references
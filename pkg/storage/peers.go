@@ -19,6 +19,7 @@ package storage
 import (
 	"context"
 	"net/netip"
+	"strings"
 
 	v1 "github.com/webmeshproj/api/go/v1"
 
@@ -101,6 +102,14 @@ func FilterByFeature(feature v1.Feature) PeerFilter {
 	}
 }
 
+// FilterByIDPrefix returns a new filter that matches nodes whose ID starts with
+// a given prefix.
+func FilterByIDPrefix(prefix string) PeerFilter {
+	return func(node types.MeshNode) bool {
+		return strings.HasPrefix(node.GetId(), prefix)
+	}
+}
+
 // FilterByIsPublic returns a new filter that matches public nodes.
 func FilterByIsPublic() PeerFilter {
 	return func(node types.MeshNode) bool {
@@ -0,0 +1,394 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// ConflictPolicy determines how existing objects are handled when importing
+// a policy bundle.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip leaves existing objects untouched.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces existing objects with those in the bundle.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+)
+
+// IsValid returns true if the conflict policy is known.
+func (c ConflictPolicy) IsValid() bool {
+	return c == ConflictSkip || c == ConflictOverwrite
+}
+
+// PolicyBundle is the policy layer of a mesh: its roles, groups, role bindings,
+// network ACLs, and routes. It can be exported from one mesh and imported into
+// another independently of raft snapshots. System objects are never included,
+// nor are routes the mesh manages for its nodes, since they refer to nodes and
+// leases that only exist in the source mesh.
+type PolicyBundle struct {
+	// Roles are the roles in the bundle.
+	Roles []types.Role
+	// Groups are the groups in the bundle.
+	Groups []types.Group
+	// RoleBindings are the role bindings in the bundle.
+	RoleBindings []types.RoleBinding
+	// NetworkACLs are the network ACLs in the bundle.
+	NetworkACLs []types.NetworkACL
+	// Routes are the routes in the bundle.
+	Routes []types.Route
+}
+
+// policyBundleFile is the encoded representation of a PolicyBundle. Like
+// RBAC manifests, entries are handled as protobuf JSON.
+type policyBundleFile struct {
+	Roles        []map[string]any `yaml:"roles,omitempty" json:"roles,omitempty"`
+	Groups       []map[string]any `yaml:"groups,omitempty" json:"groups,omitempty"`
+	RoleBindings []map[string]any `yaml:"roleBindings,omitempty" json:"roleBindings,omitempty"`
+	NetworkACLs  []map[string]any `yaml:"networkACLs,omitempty" json:"networkACLs,omitempty"`
+	Routes       []map[string]any `yaml:"routes,omitempty" json:"routes,omitempty"`
+}
+
+// ExportPolicyBundle collects the policy layer of the given database into a bundle.
+func ExportPolicyBundle(ctx context.Context, db MeshDB) (*PolicyBundle, error) {
+	var bundle PolicyBundle
+	roles, err := db.RBAC().ListRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list roles: %w", err)
+	}
+	for _, role := range roles {
+		if !IsSystemRole(role.GetName()) {
+			bundle.Roles = append(bundle.Roles, role)
+		}
+	}
+	groups, err := db.RBAC().ListGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+	for _, group := range groups {
+		if !IsSystemGroup(group.GetName()) {
+			bundle.Groups = append(bundle.Groups, group)
+		}
+	}
+	rbs, err := db.RBAC().ListRoleBindings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list role bindings: %w", err)
+	}
+	for _, rb := range rbs {
+		if !IsSystemRoleBinding(rb.GetName()) {
+			bundle.RoleBindings = append(bundle.RoleBindings, rb)
+		}
+	}
+	acls, err := db.Networking().ListNetworkACLs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list network acls: %w", err)
+	}
+	for _, acl := range acls {
+		if !IsSystemNetworkACL(acl.GetName()) {
+			bundle.NetworkACLs = append(bundle.NetworkACLs, acl)
+		}
+	}
+	routes, err := db.Networking().ListRoutes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list routes: %w", err)
+	}
+	leases, err := db.Networking().ListSecondaryIPs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list secondary ips: %w", err)
+	}
+	leased := make(map[types.NodeID]map[netip.Prefix]struct{}, len(leases))
+	for _, lease := range leases {
+		leased[lease.NodeID] = make(map[netip.Prefix]struct{}, len(lease.Addresses))
+		for _, addr := range lease.Addresses {
+			leased[lease.NodeID][addr] = struct{}{}
+		}
+	}
+	for _, route := range routes {
+		if isManagedRoute(route, leased[types.NodeID(route.GetNode())]) {
+			continue
+		}
+		bundle.Routes = append(bundle.Routes, route)
+	}
+	return &bundle, nil
+}
+
+// isManagedRoute returns true if the route is managed by the mesh for its
+// node: the route of its advertised routes, or one covering only addresses
+// leased to the node.
+func isManagedRoute(route types.Route, leased map[netip.Prefix]struct{}) bool {
+	if route.GetName() == NodeAutoRouteName(types.NodeID(route.GetNode())) {
+		return true
+	}
+	if len(leased) == 0 || len(route.GetDestinationCIDRs()) == 0 {
+		return false
+	}
+	for _, cidr := range route.GetDestinationCIDRs() {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return false
+		}
+		if _, ok := leased[prefix]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ParsePolicyBundle parses and validates a policy bundle from YAML or JSON data.
+func ParsePolicyBundle(data []byte) (*PolicyBundle, error) {
+	var file policyBundleFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse policy bundle: %w", err)
+	}
+	var bundle PolicyBundle
+	for i, entry := range file.Roles {
+		var role types.Role
+		if err := unmarshalManifestEntry(entry, role.UnmarshalProtoJSON); err != nil {
+			return nil, fmt.Errorf("parse role %d: %w", i, err)
+		}
+		bundle.Roles = append(bundle.Roles, role)
+	}
+	for i, entry := range file.Groups {
+		var group types.Group
+		if err := unmarshalManifestEntry(entry, group.UnmarshalProtoJSON); err != nil {
+			return nil, fmt.Errorf("parse group %d: %w", i, err)
+		}
+		bundle.Groups = append(bundle.Groups, group)
+	}
+	for i, entry := range file.RoleBindings {
+		var rb types.RoleBinding
+		if err := unmarshalManifestEntry(entry, rb.UnmarshalProtoJSON); err != nil {
+			return nil, fmt.Errorf("parse role binding %d: %w", i, err)
+		}
+		bundle.RoleBindings = append(bundle.RoleBindings, rb)
+	}
+	for i, entry := range file.NetworkACLs {
+		var acl types.NetworkACL
+		if err := unmarshalManifestEntry(entry, acl.UnmarshalProtoJSON); err != nil {
+			return nil, fmt.Errorf("parse network acl %d: %w", i, err)
+		}
+		bundle.NetworkACLs = append(bundle.NetworkACLs, acl)
+	}
+	for i, entry := range file.Routes {
+		var route types.Route
+		if err := unmarshalManifestEntry(entry, route.UnmarshalProtoJSON); err != nil {
+			return nil, fmt.Errorf("parse route %d: %w", i, err)
+		}
+		bundle.Routes = append(bundle.Routes, route)
+	}
+	if err := bundle.Validate(); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+// EncodeYAML encodes the bundle as YAML.
+func (b *PolicyBundle) EncodeYAML() ([]byte, error) {
+	file, err := b.file()
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(file)
+}
+
+// EncodeJSON encodes the bundle as JSON.
+func (b *PolicyBundle) EncodeJSON() ([]byte, error) {
+	file, err := b.file()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(file, "", "  ")
+}
+
+func (b *PolicyBundle) file() (*policyBundleFile, error) {
+	var file policyBundleFile
+	for _, role := range b.Roles {
+		entry, err := marshalManifestEntry(role.MarshalProtoJSON)
+		if err != nil {
+			return nil, fmt.Errorf("encode role %q: %w", role.GetName(), err)
+		}
+		file.Roles = append(file.Roles, entry)
+	}
+	for _, group := range b.Groups {
+		entry, err := marshalManifestEntry(group.MarshalProtoJSON)
+		if err != nil {
+			return nil, fmt.Errorf("encode group %q: %w", group.GetName(), err)
+		}
+		file.Groups = append(file.Groups, entry)
+	}
+	for _, rb := range b.RoleBindings {
+		entry, err := marshalManifestEntry(rb.MarshalProtoJSON)
+		if err != nil {
+			return nil, fmt.Errorf("encode role binding %q: %w", rb.GetName(), err)
+		}
+		file.RoleBindings = append(file.RoleBindings, entry)
+	}
+	for _, acl := range b.NetworkACLs {
+		entry, err := marshalManifestEntry(acl.MarshalProtoJSON)
+		if err != nil {
+			return nil, fmt.Errorf("encode network acl %q: %w", acl.GetName(), err)
+		}
+		file.NetworkACLs = append(file.NetworkACLs, entry)
+	}
+	for _, route := range b.Routes {
+		entry, err := marshalManifestEntry(route.MarshalProtoJSON)
+		if err != nil {
+			return nil, fmt.Errorf("encode route %q: %w", route.GetName(), err)
+		}
+		file.Routes = append(file.Routes, entry)
+	}
+	return &file, nil
+}
+
+func marshalManifestEntry(marshal func() ([]byte, error)) (map[string]any, error) {
+	data, err := marshal()
+	if err != nil {
+		return nil, err
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Validate validates all entries in the bundle. The RBAC entries follow the
+// same rules as an RBACManifest.
+func (b *PolicyBundle) Validate() error {
+	manifest := RBACManifest{
+		Roles:        b.Roles,
+		Groups:       b.Groups,
+		RoleBindings: b.RoleBindings,
+	}
+	if err := manifest.Validate(); err != nil {
+		return err
+	}
+	for _, acl := range b.NetworkACLs {
+		if err := acl.Validate(); err != nil {
+			return fmt.Errorf("invalid network acl %q: %w", acl.GetName(), err)
+		}
+		if IsSystemNetworkACL(acl.GetName()) {
+			return fmt.Errorf("invalid network acl %q: cannot redefine a system network acl", acl.GetName())
+		}
+	}
+	for _, route := range b.Routes {
+		if err := route.Validate(); err != nil {
+			return fmt.Errorf("invalid route %q: %w", route.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// Import applies the bundle to the given database. Objects that already exist
+// are skipped or overwritten according to onConflict. The names of skipped
+// objects are returned, prefixed with their kind.
+func (b *PolicyBundle) Import(ctx context.Context, db MeshDB, onConflict ConflictPolicy) (skipped []string, err error) {
+	if !onConflict.IsValid() {
+		return nil, fmt.Errorf("invalid conflict policy %q", onConflict)
+	}
+	exists := func(get func() error) (bool, error) {
+		if onConflict == ConflictOverwrite {
+			return false, nil
+		}
+		err := get()
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.IsNotFound(err):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	rb := db.RBAC()
+	for _, role := range b.Roles {
+		ok, err := exists(func() error { _, err := rb.GetRole(ctx, role.GetName()); return err })
+		if err != nil {
+			return skipped, fmt.Errorf("get role %q: %w", role.GetName(), err)
+		}
+		if ok {
+			skipped = append(skipped, "role/"+role.GetName())
+			continue
+		}
+		if err := rb.PutRole(ctx, role); err != nil {
+			return skipped, fmt.Errorf("put role %q: %w", role.GetName(), err)
+		}
+	}
+	for _, group := range b.Groups {
+		ok, err := exists(func() error { _, err := rb.GetGroup(ctx, group.GetName()); return err })
+		if err != nil {
+			return skipped, fmt.Errorf("get group %q: %w", group.GetName(), err)
+		}
+		if ok {
+			skipped = append(skipped, "group/"+group.GetName())
+			continue
+		}
+		if err := rb.PutGroup(ctx, group); err != nil {
+			return skipped, fmt.Errorf("put group %q: %w", group.GetName(), err)
+		}
+	}
+	for _, binding := range b.RoleBindings {
+		ok, err := exists(func() error { _, err := rb.GetRoleBinding(ctx, binding.GetName()); return err })
+		if err != nil {
+			return skipped, fmt.Errorf("get role binding %q: %w", binding.GetName(), err)
+		}
+		if ok {
+			skipped = append(skipped, "rolebinding/"+binding.GetName())
+			continue
+		}
+		if err := rb.PutRoleBinding(ctx, binding); err != nil {
+			return skipped, fmt.Errorf("put role binding %q: %w", binding.GetName(), err)
+		}
+	}
+	nw := db.Networking()
+	for _, acl := range b.NetworkACLs {
+		ok, err := exists(func() error { _, err := nw.GetNetworkACL(ctx, acl.GetName()); return err })
+		if err != nil {
+			return skipped, fmt.Errorf("get network acl %q: %w", acl.GetName(), err)
+		}
+		if ok {
+			skipped = append(skipped, "networkacl/"+acl.GetName())
+			continue
+		}
+		if err := nw.PutNetworkACL(ctx, acl); err != nil {
+			return skipped, fmt.Errorf("put network acl %q: %w", acl.GetName(), err)
+		}
+	}
+	for _, route := range b.Routes {
+		ok, err := exists(func() error { _, err := nw.GetRoute(ctx, route.GetName()); return err })
+		if err != nil {
+			return skipped, fmt.Errorf("get route %q: %w", route.GetName(), err)
+		}
+		if ok {
+			skipped = append(skipped, "route/"+route.GetName())
+			continue
+		}
+		if err := nw.PutRoute(ctx, route); err != nil {
+			return skipped, fmt.Errorf("put route %q: %w", route.GetName(), err)
+		}
+	}
+	return skipped, nil
+}
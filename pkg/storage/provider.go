@@ -106,6 +106,22 @@ type Consensus interface {
 	RemovePeer(ctx context.Context, peer types.StoragePeer, wait bool) error
 }
 
+// PeerContact is implemented by consensus implementations whose leader tracks
+// which members of the storage group it is currently in contact with.
+type PeerContact interface {
+	// InContact returns true if the leader has recently heard from the peer
+	// with the given ID. It always returns false when called off the leader.
+	InContact(id types.NodeID) bool
+}
+
+// WriteBarrier is implemented by providers that can confirm preceding writes
+// are durably replicated to a quorum of the storage group.
+type WriteBarrier interface {
+	// Barrier blocks until all preceding writes are committed and applied,
+	// and the node has confirmed it is still the leader of a quorum.
+	Barrier(ctx context.Context) error
+}
+
 // KVSubscribeFunc is the function signature for subscribing to changes to a key.
 type KVSubscribeFunc func(key, value []byte)
 
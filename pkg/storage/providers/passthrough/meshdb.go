@@ -18,6 +18,7 @@ package passthrough
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/netip"
 	"strconv"
@@ -34,6 +35,7 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport"
 	"github.com/webmeshproj/webmesh/pkg/storage"
 	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb/state"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
@@ -518,6 +520,45 @@ func (st *StateStore) GetMeshState(ctx context.Context) (types.NetworkState, err
 	return state, state.UnmarshalProtoJSON(resp.GetItems()[0])
 }
 
+func (st *StateStore) PutDNSRecord(_ context.Context, _ types.DNSRecord) error {
+	return errors.ErrNotStorageNode
+}
+
+func (st *StateStore) GetDNSRecords(ctx context.Context, name string) (types.DNSRecords, error) {
+	return st.listDNSRecords(ctx, fmt.Sprintf("%s/%s/", state.DNSRecordsPrefix, name))
+}
+
+func (st *StateStore) DeleteDNSRecord(_ context.Context, _ string, _ types.DNSRecordType) error {
+	return errors.ErrNotStorageNode
+}
+
+func (st *StateStore) ListDNSRecords(ctx context.Context) (types.DNSRecords, error) {
+	return st.listDNSRecords(ctx, fmt.Sprintf("%s/", state.DNSRecordsPrefix))
+}
+
+func (st *StateStore) listDNSRecords(ctx context.Context, prefix string) (types.DNSRecords, error) {
+	err := st.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := &v1.QueryRequest{
+		Command: v1.QueryRequest_LIST,
+		Type:    v1.QueryRequest_VALUE,
+		Query:   types.NewQueryFilters().WithID(prefix).Encode(),
+	}
+	resp, err := st.cli.Query(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make(types.DNSRecords, len(resp.GetItems()))
+	for i, item := range resp.GetItems() {
+		if err := json.Unmarshal(item, &out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
 // NetworkingStore is a passthrough networking store that uses the storage API
 // to field read requests.
 type NetworkingStore struct {
@@ -550,7 +591,15 @@ func (nw *NetworkingStore) GetNetworkACL(ctx context.Context, name string) (type
 		return acl, errors.ErrACLNotFound
 	}
 	err = acl.UnmarshalProtoJSON(resp.GetItems()[0])
-	return acl, err
+	if err != nil {
+		return acl, err
+	}
+	internal, err := nw.internalNetworkACLs(ctx)
+	if err != nil {
+		return acl, err
+	}
+	_, acl.InternalOnly = internal[acl.GetName()]
+	return acl, nil
 }
 
 func (nw *NetworkingStore) DeleteNetworkACL(ctx context.Context, name string) error {
@@ -570,6 +619,10 @@ func (nw *NetworkingStore) ListNetworkACLs(ctx context.Context) (types.NetworkAC
 	if err != nil {
 		return nil, err
 	}
+	internal, err := nw.internalNetworkACLs(ctx)
+	if err != nil {
+		return nil, err
+	}
 	out := make(types.NetworkACLs, len(resp.GetItems()))
 	for i, item := range resp.GetItems() {
 		var acl types.NetworkACL
@@ -577,11 +630,30 @@ func (nw *NetworkingStore) ListNetworkACLs(ctx context.Context) (types.NetworkAC
 		if err != nil {
 			return nil, err
 		}
+		_, acl.InternalOnly = internal[acl.GetName()]
 		out[i] = acl
 	}
 	return out, nil
 }
 
+// internalNetworkACLs returns the names of the ACLs restricted to internal traffic.
+func (nw *NetworkingStore) internalNetworkACLs(ctx context.Context) (map[string]struct{}, error) {
+	req := &v1.QueryRequest{
+		Command: v1.QueryRequest_LIST,
+		Type:    v1.QueryRequest_VALUE,
+		Query:   types.NewQueryFilters().WithID(fmt.Sprintf("%s/", storage.InternalNetworkACLsPrefix)).Encode(),
+	}
+	resp, err := nw.cli.Query(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]struct{}, len(resp.GetItems()))
+	for _, item := range resp.GetItems() {
+		out[string(item)] = struct{}{}
+	}
+	return out, nil
+}
+
 func (nw *NetworkingStore) PutRoute(ctx context.Context, route types.Route) error {
 	return errors.ErrNotStorageNode
 }
@@ -691,3 +763,47 @@ func (nw *NetworkingStore) ListRoutes(ctx context.Context) (types.Routes, error)
 	}
 	return out, nil
 }
+
+func (nw *NetworkingStore) PutSecondaryIPs(ctx context.Context, ips types.SecondaryIPs) error {
+	return errors.ErrNotStorageNode
+}
+
+func (nw *NetworkingStore) GetSecondaryIPs(ctx context.Context, nodeID types.NodeID) (types.SecondaryIPs, error) {
+	all, err := nw.ListSecondaryIPs(ctx)
+	if err != nil {
+		return types.SecondaryIPs{}, err
+	}
+	for _, ips := range all {
+		if ips.NodeID == nodeID {
+			return ips, nil
+		}
+	}
+	return types.SecondaryIPs{NodeID: nodeID}, nil
+}
+
+func (nw *NetworkingStore) DeleteSecondaryIPs(ctx context.Context, nodeID types.NodeID) error {
+	return errors.ErrNotStorageNode
+}
+
+func (nw *NetworkingStore) ListSecondaryIPs(ctx context.Context) ([]types.SecondaryIPs, error) {
+	err := nw.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := &v1.QueryRequest{
+		Command: v1.QueryRequest_LIST,
+		Type:    v1.QueryRequest_VALUE,
+		Query:   types.NewQueryFilters().WithID(fmt.Sprintf("%s/", storage.SecondaryIPsPrefix)).Encode(),
+	}
+	resp, err := nw.cli.Query(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]types.SecondaryIPs, len(resp.GetItems()))
+	for i, item := range resp.GetItems() {
+		if err := json.Unmarshal(item, &out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
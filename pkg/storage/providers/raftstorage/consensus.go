@@ -28,8 +28,9 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
-// Ensure we satisfy the Consensus interface.
+// Ensure we satisfy the Consensus and PeerContact interfaces.
 var _ storage.Consensus = &Consensus{}
+var _ storage.PeerContact = &Consensus{}
 
 // RaftConsensus is the Raft consensus implementation.
 type Consensus struct {
@@ -47,6 +48,22 @@ func (r *Consensus) IsMember() bool {
 	return true
 }
 
+// InContact returns true if the leader has recently heard from the given peer.
+// Peers are out of contact from the first failed heartbeat until heartbeats to
+// them resume.
+func (r *Consensus) InContact(id types.NodeID) bool {
+	if r.raft.State() != raft.Leader {
+		return false
+	}
+	if raft.ServerID(id) == r.nodeID {
+		return true
+	}
+	r.contactMu.Lock()
+	defer r.contactMu.Unlock()
+	_, failing := r.failedHeartbeats[raft.ServerID(id)]
+	return !failing
+}
+
 // StepDown steps down from leadership.
 func (r *Consensus) StepDown(ctx context.Context) error {
 	r.mu.Lock()
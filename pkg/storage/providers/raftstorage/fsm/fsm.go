@@ -43,27 +43,36 @@ var _ raft.FSM = &RaftFSM{}
 type RaftFSM struct {
 	currentTerm      atomic.Uint64
 	lastAppliedIndex atomic.Uint64
+	configIndex      atomic.Uint64
 	opts             Options
 	store            storage.MeshStorage
 	snapshotter      snapshots.Snapshotter
 	log              *slog.Logger
 	mu               sync.Mutex
+	// applied is closed and replaced whenever logs are applied.
+	applied   chan struct{}
+	appliedMu sync.Mutex
 }
 
 // Options are options for the FSM.
 type Options struct {
 	// ApplyTimeout is the timeout for applying a log entry.
 	ApplyTimeout time.Duration
+	// SnapshotCompressionLevel is the gzip compression level for snapshots.
+	SnapshotCompressionLevel int
 }
 
 // New returns a new RaftFSM. The storage interface must be a direct
 // connection to the underlying database.
 func New(ctx context.Context, st storage.DualStorage, opts Options) *RaftFSM {
 	return &RaftFSM{
-		store:       st,
-		opts:        opts,
-		log:         context.LoggerFrom(ctx).With("component", "raft-fsm"),
-		snapshotter: snapshots.New(ctx, st),
+		store:   st,
+		opts:    opts,
+		applied: make(chan struct{}),
+		log:     context.LoggerFrom(ctx).With("component", "raft-fsm"),
+		snapshotter: snapshots.New(ctx, st, snapshots.Options{
+			CompressionLevel: opts.SnapshotCompressionLevel,
+		}),
 	}
 }
 
@@ -72,6 +81,27 @@ func (r *RaftFSM) LastAppliedIndex() uint64 {
 	return r.lastAppliedIndex.Load()
 }
 
+// ConfigurationIndex returns the index of the last configuration change
+// applied to the FSM.
+func (r *RaftFSM) ConfigurationIndex() uint64 {
+	return r.configIndex.Load()
+}
+
+// Applied returns a channel that is closed the next time logs are applied.
+func (r *RaftFSM) Applied() <-chan struct{} {
+	r.appliedMu.Lock()
+	defer r.appliedMu.Unlock()
+	return r.applied
+}
+
+// notifyApplied wakes anyone waiting on Applied.
+func (r *RaftFSM) notifyApplied() {
+	r.appliedMu.Lock()
+	defer r.appliedMu.Unlock()
+	close(r.applied)
+	r.applied = make(chan struct{})
+}
+
 // CurrentTerm returns the current term.
 func (r *RaftFSM) CurrentTerm() uint64 {
 	return r.currentTerm.Load()
@@ -89,8 +119,10 @@ func (r *RaftFSM) Snapshot() (raft.FSMSnapshot, error) {
 func (r *RaftFSM) Restore(rdr io.ReadCloser) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	// Snapshots handed to us by raft are authoritative and always replace
+	// local state. User restores are guarded before they reach raft.
 	// TODO: Set a timeout on this.
-	err := r.snapshotter.Restore(context.Background(), rdr)
+	err := r.snapshotter.Restore(context.Background(), rdr, snapshots.RestoreOptions{Force: true})
 	if err != nil {
 		return fmt.Errorf("restore snapshot: %w", err)
 	}
@@ -106,6 +138,7 @@ func (r *RaftFSM) ApplyBatch(logs []*raft.Log) []any {
 		_, res[i] = r.applyLog(l)
 	}
 	r.mu.Unlock()
+	r.notifyApplied()
 	return res
 }
 
@@ -114,6 +147,7 @@ func (r *RaftFSM) Apply(l *raft.Log) any {
 	r.mu.Lock()
 	_, res := r.applyLog(l)
 	r.mu.Unlock()
+	r.notifyApplied()
 	return res
 }
 
@@ -145,6 +179,9 @@ func (r *RaftFSM) applyLog(l *raft.Log) (cmd *v1.RaftLogEntry, res *v1.RaftApply
 	defer r.lastAppliedIndex.Store(l.Index)
 	defer r.currentTerm.Store(l.Term)
 
+	if l.Type == raft.LogConfiguration {
+		r.configIndex.Store(l.Index)
+	}
 	if l.Type != raft.LogCommand {
 		// We only care about command logs.
 		return nil, &v1.RaftApplyResponse{
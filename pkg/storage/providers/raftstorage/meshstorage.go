@@ -39,6 +39,7 @@ var _ storage.MeshStorage = &RaftStorage{}
 type RaftStorage struct {
 	storage    storage.MeshStorage
 	writecount atomic.Int32
+	staleReads atomic.Bool
 	raft       *Provider
 }
 
@@ -58,6 +59,9 @@ func (rs *RaftStorage) GetValue(ctx context.Context, key []byte) ([]byte, error)
 	if !types.IsValidPathID(string(key)) {
 		return nil, errors.ErrInvalidKey
 	}
+	if err := rs.checkRead(); err != nil {
+		return nil, err
+	}
 	return rs.storage.GetValue(ctx, key)
 }
 
@@ -66,6 +70,9 @@ func (rs *RaftStorage) ListKeys(ctx context.Context, prefix []byte) ([][]byte, e
 	if !rs.raft.started.Load() {
 		return nil, errors.ErrClosed
 	}
+	if err := rs.checkRead(); err != nil {
+		return nil, err
+	}
 	return rs.storage.ListKeys(ctx, prefix)
 }
 
@@ -74,9 +81,29 @@ func (rs *RaftStorage) IterPrefix(ctx context.Context, prefix []byte, fn storage
 	if !rs.raft.started.Load() {
 		return errors.ErrClosed
 	}
+	if err := rs.checkRead(); err != nil {
+		return err
+	}
 	return rs.storage.IterPrefix(ctx, prefix, fn)
 }
 
+// checkRead applies the configured quorum loss policy before serving a read.
+func (rs *RaftStorage) checkRead() error {
+	if rs.raft.hasQuorum() {
+		if rs.staleReads.CompareAndSwap(true, false) {
+			rs.raft.log.Info("Storage quorum restored, reads are no longer stale")
+		}
+		return nil
+	}
+	if rs.raft.Options.QuorumLossReads == QuorumLossReadError {
+		return errors.ErrQuorumLost
+	}
+	if rs.staleReads.CompareAndSwap(false, true) {
+		rs.raft.log.Warn("Storage quorum lost, serving reads from local data that may be stale")
+	}
+	return nil
+}
+
 // Subscribe subscribes to changes to a prefix.
 func (rs *RaftStorage) Subscribe(ctx context.Context, prefix []byte, fn storage.KVSubscribeFunc) (context.CancelFunc, error) {
 	if !rs.raft.started.Load() {
@@ -17,6 +17,8 @@ limitations under the License.
 package raftstorage
 
 import (
+	"compress/gzip"
+	"path/filepath"
 	"runtime"
 	"time"
 
@@ -45,8 +47,28 @@ const (
 	// DefaultBarrierThreshold is the threshold for sending a barrier after
 	// a write operation.
 	DefaultBarrierThreshold = 10
+	// DefaultShutdownSnapshotTimeout is the default time to wait for a
+	// snapshot to complete during shutdown.
+	DefaultShutdownSnapshotTimeout = time.Second * 10
 )
 
+// QuorumLossReadPolicy controls how reads are served while the consensus
+// group has lost quorum.
+type QuorumLossReadPolicy string
+
+const (
+	// QuorumLossReadStale serves reads from the local, possibly stale, copy
+	// of the data and logs a warning.
+	QuorumLossReadStale QuorumLossReadPolicy = "stale"
+	// QuorumLossReadError fails reads with ErrQuorumLost.
+	QuorumLossReadError QuorumLossReadPolicy = "error"
+)
+
+// IsValid returns true if the policy is a known value.
+func (p QuorumLossReadPolicy) IsValid() bool {
+	return p == QuorumLossReadStale || p == QuorumLossReadError
+}
+
 // Options are the raft options.
 type Options struct {
 	// NodeID is the node ID.
@@ -56,6 +78,14 @@ type Options struct {
 	Transport transport.RaftTransport
 	// DataDir is the directory to store data in.
 	DataDir string
+	// LogStoreDir is the directory for the raft log and stable store. Defaults
+	// to the node's directory under DataDir. The store is kept in a subdirectory
+	// named after the node, so that ClearDataDir only removes what we own.
+	LogStoreDir string
+	// DataStoreDir is the directory for the mesh data store. Defaults to the
+	// node's directory under DataDir. When it differs from LogStoreDir, each
+	// store is kept in its own database, in a subdirectory named after the node.
+	DataStoreDir string
 	// ClearDataDir is if the data directory should be cleared on startup.
 	ClearDataDir bool
 	// InMemory is if the store should be in memory. This should only be used for testing and ephemeral nodes.
@@ -68,6 +98,20 @@ type Options struct {
 	HeartbeatTimeout time.Duration
 	// ElectionTimeout is the timeout for elections.
 	ElectionTimeout time.Duration
+	// ScaleTimeouts grows the heartbeat and election timeouts with the number
+	// of voters, starting from HeartbeatTimeout and ElectionTimeout. Timeouts are
+	// recomputed on peer and leader changes. This reduces election churn in large
+	// or geographically dispersed clusters.
+	ScaleTimeouts bool
+	// MaxElectionTimeout is the upper bound for scaled timeouts. Defaults to
+	// DefaultMaxElectionTimeout.
+	MaxElectionTimeout time.Duration
+	// LeaderStickiness is extra time a follower waits without hearing from the
+	// leader before it starts an election, on top of HeartbeatTimeout. The
+	// leader lease is extended by the same amount so a leader that is briefly
+	// unreachable keeps its leadership. This reduces flapping over lossy links
+	// at the cost of slower failover.
+	LeaderStickiness time.Duration
 	// ApplyTimeout is the timeout for applying.
 	ApplyTimeout time.Duration
 	// CommitTimeout is the timeout for committing.
@@ -82,10 +126,22 @@ type Options struct {
 	SnapshotThreshold uint64
 	// SnapshotRetention is the number of snapshots to retain.
 	SnapshotRetention uint64
+	// SnapshotCompressionLevel is the gzip compression level to use for snapshots.
+	SnapshotCompressionLevel int
+	// SnapshotOnShutdown takes a final snapshot when the provider is closed, so
+	// that a restart does not need to replay the log since the last snapshot.
+	// It has no effect for in-memory storage.
+	SnapshotOnShutdown bool
+	// ShutdownSnapshotTimeout bounds how long Close waits for the final snapshot.
+	// Defaults to DefaultShutdownSnapshotTimeout.
+	ShutdownSnapshotTimeout time.Duration
 	// ObserverChanBuffer is the buffer size for the observer channel.
 	ObserverChanBuffer int
 	// BarrierThreshold is the threshold for sending a barrier after a write operation.
 	BarrierThreshold int32
+	// QuorumLossReads controls how reads are served when quorum is lost.
+	// Defaults to serving stale reads.
+	QuorumLossReads QuorumLossReadPolicy
 	// LogLevel is the log level for the raft backend.
 	LogLevel string
 	// LogFormat is the log format for the raft backend.
@@ -95,25 +151,49 @@ type Options struct {
 // NewOptions returns new raft options with sensible defaults.
 func NewOptions(nodeID types.NodeID, transport transport.RaftTransport) Options {
 	return Options{
-		NodeID:             nodeID,
-		Transport:          transport,
-		DataDir:            DefaultDataDir,
-		ConnectionTimeout:  time.Second * 3,
-		HeartbeatTimeout:   time.Second * 3,
-		ElectionTimeout:    time.Second * 3,
-		ApplyTimeout:       time.Second * 15,
-		CommitTimeout:      time.Second * 15,
-		LeaderLeaseTimeout: time.Second * 3,
-		SnapshotInterval:   time.Minute * 3,
-		SnapshotThreshold:  5,
-		MaxAppendEntries:   15,
-		SnapshotRetention:  3,
-		ObserverChanBuffer: 100,
-		BarrierThreshold:   DefaultBarrierThreshold,
-		LogLevel:           "info",
+		NodeID:                   nodeID,
+		Transport:                transport,
+		DataDir:                  DefaultDataDir,
+		ConnectionTimeout:        time.Second * 3,
+		HeartbeatTimeout:         time.Second * 3,
+		ElectionTimeout:          time.Second * 3,
+		ApplyTimeout:             time.Second * 15,
+		CommitTimeout:            time.Second * 15,
+		LeaderLeaseTimeout:       time.Second * 3,
+		SnapshotInterval:         time.Minute * 3,
+		SnapshotThreshold:        5,
+		MaxAppendEntries:         15,
+		SnapshotRetention:        3,
+		SnapshotCompressionLevel: gzip.DefaultCompression,
+		SnapshotOnShutdown:       true,
+		ShutdownSnapshotTimeout:  DefaultShutdownSnapshotTimeout,
+		ObserverChanBuffer:       100,
+		BarrierThreshold:         DefaultBarrierThreshold,
+		QuorumLossReads:          QuorumLossReadStale,
+		LogLevel:                 "info",
 	}
 }
 
+// logStoreDir returns the directory for the raft log and stable store.
+func (o *Options) logStoreDir() string {
+	if o.LogStoreDir != "" {
+		return filepath.Join(o.LogStoreDir, o.NodeID.String())
+	}
+	return o.defaultStoreDir()
+}
+
+// dataStoreDir returns the directory for the mesh data store.
+func (o *Options) dataStoreDir() string {
+	if o.DataStoreDir != "" {
+		return filepath.Join(o.DataStoreDir, o.NodeID.String())
+	}
+	return o.defaultStoreDir()
+}
+
+func (o *Options) defaultStoreDir() string {
+	return filepath.Join(o.DataDir, o.NodeID.String(), "data")
+}
+
 // RaftConfig builds a raft config.
 func (o *Options) RaftConfig(ctx context.Context, nodeID string) *raft.Config {
 	config := raft.DefaultConfig()
@@ -134,6 +214,10 @@ func (o *Options) RaftConfig(ctx context.Context, nodeID string) *raft.Config {
 	if o.LeaderLeaseTimeout != 0 {
 		config.LeaderLeaseTimeout = o.LeaderLeaseTimeout
 	}
+	if o.LeaderStickiness > 0 {
+		config.HeartbeatTimeout, config.ElectionTimeout = withLeaderStickiness(config.HeartbeatTimeout, config.ElectionTimeout, o.LeaderStickiness)
+		config.LeaderLeaseTimeout += o.LeaderStickiness
+	}
 	if o.SnapshotInterval != 0 {
 		config.SnapshotInterval = o.SnapshotInterval
 	}
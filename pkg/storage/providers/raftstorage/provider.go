@@ -18,8 +18,10 @@ limitations under the License.
 package raftstorage
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"os"
@@ -38,10 +40,12 @@ import (
 	"github.com/webmeshproj/webmesh/pkg/storage/meshdb"
 	"github.com/webmeshproj/webmesh/pkg/storage/providers/backends/badgerdb"
 	"github.com/webmeshproj/webmesh/pkg/storage/providers/raftstorage/fsm"
+	"github.com/webmeshproj/webmesh/pkg/storage/providers/raftstorage/snapshots"
 )
 
-// Ensure we satisfy the provider interface.
+// Ensure we satisfy the provider and write barrier interfaces.
 var _ storage.Provider = &Provider{}
+var _ storage.WriteBarrier = &Provider{}
 
 // Ensure that RaftStorage implements a MonothonicLogStore.
 var _ = raft.MonotonicLogStore(&MonotonicLogStore{})
@@ -93,12 +97,18 @@ type Provider struct {
 	started                     atomic.Bool
 	raft                        *raft.Raft
 	raftStorage                 *RaftStorage
+	fsm                         *fsm.RaftFSM
+	logs                        raft.LogStore
+	startConfigIndex            uint64
+	logDB                       storage.ConsensusStorage
 	meshDB                      storage.MeshDB
 	consensus                   *Consensus
 	observer                    *raft.Observer
 	observerChan                chan raft.Observation
 	observerClose, observerDone chan struct{}
 	observerCbs                 []ObservationCallback
+	failedHeartbeats            map[raft.ServerID]time.Time
+	contactMu                   sync.Mutex
 	log                         *slog.Logger
 	mu                          sync.RWMutex
 }
@@ -151,28 +161,40 @@ func (r *Provider) Start(ctx context.Context) error {
 		return errors.ErrStarted
 	}
 	r.log.Debug("Starting raft storage provider")
-	storage, err := r.createStorage()
+	data, logs, err := r.createStorage()
 	if err != nil {
 		return fmt.Errorf("create storage: %w", err)
 	}
+	closeStorage := func() {
+		data.Close()
+		if r.logDB != nil {
+			r.logDB.Close()
+			r.logDB = nil
+		}
+	}
 	// Set the raft storage instance.
-	r.raftStorage.storage = storage
+	r.raftStorage.storage = data
 	snapshots, err := r.createSnapshotStorage()
 	if err != nil {
+		closeStorage()
 		return fmt.Errorf("create snapshot storage: %w", err)
 	}
 	r.log.Debug("Starting raft instance", slog.String("listen-addr", string(r.Options.Transport.LocalAddr())))
+	r.fsm = fsm.New(ctx, data, fsm.Options{
+		ApplyTimeout:             r.Options.ApplyTimeout,
+		SnapshotCompressionLevel: r.Options.SnapshotCompressionLevel,
+	})
+	r.logs = &MonotonicLogStore{logs}
 	r.raft, err = raft.NewRaft(
 		r.Options.RaftConfig(ctx, string(r.nodeID)),
-		fsm.New(ctx, storage, fsm.Options{
-			ApplyTimeout: r.Options.ApplyTimeout,
-		}),
-		&MonotonicLogStore{storage},
-		storage,
+		r.fsm,
+		r.logs,
+		logs,
 		snapshots,
 		r.Options.Transport,
 	)
 	if err != nil {
+		closeStorage()
 		return fmt.Errorf("new raft: %w", err)
 	}
 	// Register observers.
@@ -182,6 +204,12 @@ func (r *Provider) Start(ctx context.Context) error {
 	})
 	r.raft.RegisterObserver(r.observer)
 	r.observerClose, r.observerDone = r.observe()
+	// Configurations recovered from a snapshot are not replayed through the FSM, so
+	// anchor the configuration index at the last log index we started with.
+	r.startConfigIndex = 0
+	if len(r.raft.GetConfiguration().Configuration().Servers) > 0 {
+		r.startConfigIndex = r.raft.LastIndex()
+	}
 	// We're done here.
 	r.started.Store(true)
 	return nil
@@ -308,6 +336,80 @@ func (r *Provider) Bootstrap(ctx context.Context) error {
 	}
 }
 
+// RestoreSnapshot restores the mesh database from a snapshot written by this
+// provider. The snapshot is restored through raft, so it is replicated to
+// followers and new joiners. This is intended for disaster recovery into a
+// freshly bootstrapped cluster and can only be run on the leader. Restoring
+// over existing mesh state returns snapshots.ErrStoreNotEmpty unless forced.
+func (r *Provider) RestoreSnapshot(ctx context.Context, rdr io.Reader, force bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started.Load() {
+		return errors.ErrClosed
+	}
+	if r.raft.State() != raft.Leader {
+		return errors.ErrNotLeader
+	}
+	if !force {
+		populated, err := snapshots.HasMeshState(ctx, r.raftStorage)
+		if err != nil {
+			return err
+		}
+		if populated {
+			return snapshots.ErrStoreNotEmpty
+		}
+	}
+	// Raft requires the size of the snapshot up front.
+	data, err := io.ReadAll(rdr)
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+	timeout := r.Options.ApplyTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	r.log.Info("Restoring mesh database from snapshot", slog.Int("size", len(data)))
+	meta := &raft.SnapshotMeta{
+		Version: raft.SnapshotVersionMax,
+		Size:    int64(len(data)),
+	}
+	if err := r.raft.Restore(meta, bytes.NewReader(data), timeout); err != nil {
+		return fmt.Errorf("restore snapshot: %w", err)
+	}
+	return nil
+}
+
+// Barrier verifies this node is still the leader with contact to a quorum of
+// voters and waits until all preceding logs are applied. It can only be run
+// on the leader.
+func (r *Provider) Barrier(ctx context.Context) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.started.Load() {
+		return errors.ErrClosed
+	}
+	if r.raft.State() != raft.Leader {
+		return errors.ErrNotLeader
+	}
+	timeout := r.Options.ApplyTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if err := r.raft.VerifyLeader().Error(); err != nil {
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return errors.ErrNotLeader
+		}
+		return fmt.Errorf("verify leader: %w", err)
+	}
+	if err := r.raft.Barrier(timeout).Error(); err != nil {
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return errors.ErrNotLeader
+		}
+		return fmt.Errorf("barrier: %w", err)
+	}
+	return nil
+}
+
 // Close closes the mesh storage and shuts down the raft instance.
 func (r *Provider) Close() error {
 	r.mu.Lock()
@@ -319,15 +421,15 @@ func (r *Provider) Close() error {
 	defer r.log.Debug("Raft storage provider stopped")
 	defer r.started.Store(false)
 	defer r.raftStorage.Close()
+	if r.logDB != nil {
+		defer func() {
+			r.logDB.Close()
+			r.logDB = nil
+		}()
+	}
 	defer r.Options.Transport.Close()
-	// If we were not running in memory, force a snapshot.
-	if !r.Options.InMemory {
-		r.log.Debug("Taking raft storage snapshot")
-		err := r.raft.Snapshot().Error()
-		if err != nil {
-			// Make this non-fatal for now
-			r.log.Error("Failed to take snapshot", slog.String("error", err.Error()))
-		}
+	if r.Options.SnapshotOnShutdown && !r.Options.InMemory {
+		r.snapshotOnShutdown()
 	}
 	r.log.Debug("Shutting down raft node")
 	err := r.raft.Shutdown().Error()
@@ -337,11 +439,53 @@ func (r *Provider) Close() error {
 	return nil
 }
 
+// snapshotOnShutdown takes a final snapshot, waiting at most for the configured
+// shutdown snapshot timeout. Failures are logged but do not prevent shutdown.
+func (r *Provider) snapshotOnShutdown() {
+	timeout := r.Options.ShutdownSnapshotTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownSnapshotTimeout
+	}
+	r.log.Debug("Taking raft storage snapshot", slog.Duration("timeout", timeout))
+	errs := make(chan error, 1)
+	go func() { errs <- r.raft.Snapshot().Error() }()
+	select {
+	case err := <-errs:
+		if err != nil && !errors.Is(err, raft.ErrNothingNewToSnapshot) {
+			r.log.Error("Failed to take snapshot", slog.String("error", err.Error()))
+		}
+	case <-time.After(timeout):
+		r.log.Warn("Timed out taking snapshot before shutdown", slog.Duration("timeout", timeout))
+	}
+}
+
 // GetRaftConfiguration returns the current raft configuration.
 func (r *Provider) GetRaftConfiguration() raft.Configuration {
 	return r.raft.GetConfiguration().Configuration()
 }
 
+// GetRaftConfigurationIndex returns the log index of the last raft configuration
+// change applied on this node. It only advances when servers are added, removed,
+// or change suffrage, so reconcilers can compare it against the last index they
+// saw to cheaply detect whether the configuration is stale. For configurations
+// recovered on startup, the index is the last log index at that time.
+func (r *Provider) GetRaftConfigurationIndex() uint64 {
+	return max(r.fsm.ConfigurationIndex(), r.startConfigIndex)
+}
+
+// ApplyLag returns how many committed log entries have not yet been applied
+// to the FSM on this node. It is zero when the provider is not started.
+func (r *Provider) ApplyLag() uint64 {
+	if !r.started.Load() {
+		return 0
+	}
+	commit, applied := r.raft.CommitIndex(), r.raft.AppliedIndex()
+	if applied >= commit {
+		return 0
+	}
+	return commit - applied
+}
+
 // ApplyRaftLog applies a raft log entry.
 func (r *Provider) ApplyRaftLog(ctx context.Context, log *v1.RaftLogEntry) (*v1.RaftApplyResponse, error) {
 	r.mu.Lock()
@@ -399,8 +543,27 @@ func (r *Provider) isObserver() bool {
 	return false
 }
 
-// createStorage creates the underlying storage.
-func (r *Provider) createStorage() (storage.DualStorage, error) {
+// hasQuorum returns true if this node is the leader or has recently heard from one.
+// Nodes that are not yet part of a configuration have no quorum to lose and are
+// always considered to have one.
+func (r *Provider) hasQuorum() bool {
+	if r.raft.State() == raft.Leader {
+		return true
+	}
+	timeout := r.Options.HeartbeatTimeout
+	if timeout <= 0 {
+		timeout = raft.DefaultConfig().HeartbeatTimeout
+	}
+	if addr, _ := r.raft.LeaderWithID(); addr != "" && time.Since(r.raft.LastContact()) <= timeout {
+		return true
+	}
+	return len(r.GetRaftConfiguration().Servers) == 0
+}
+
+// createStorage creates the underlying data and log storage. They are the same database
+// unless the options place them in different directories, in which case the separate log
+// store is also kept on r.logDB.
+func (r *Provider) createStorage() (data storage.DualStorage, logs storage.ConsensusStorage, err error) {
 	if r.Options.InMemory {
 		db, err := badgerdb.NewInMemory(badgerdb.Options{
 			Debug: func() bool {
@@ -408,23 +571,41 @@ func (r *Provider) createStorage() (storage.DualStorage, error) {
 			}(),
 		})
 		if err != nil {
-			return nil, fmt.Errorf("create in-memory storage: %w", err)
+			return nil, nil, fmt.Errorf("create in-memory storage: %w", err)
 		}
-		return db, nil
+		return db, db, nil
+	}
+	dataDir, logDir := r.Options.dataStoreDir(), r.Options.logStoreDir()
+	data, err = r.openDiskStorage(dataDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open data store: %w", err)
+	}
+	if filepath.Clean(logDir) == filepath.Clean(dataDir) {
+		return data, data, nil
 	}
-	// Make sure the data directory exists
-	dataDir := filepath.Join(r.Options.DataDir, r.Options.NodeID.String(), "data")
-	// If we are forcing bootstrap, delete the data directory
+	logDB, err := r.openDiskStorage(logDir)
+	if err != nil {
+		data.Close()
+		return nil, nil, fmt.Errorf("open log store: %w", err)
+	}
+	r.logDB = logDB
+	return data, logDB, nil
+}
+
+// openDiskStorage opens a badger database in the given directory, creating it if needed.
+func (r *Provider) openDiskStorage(dir string) (storage.DualStorage, error) {
+	// If we are forcing bootstrap, delete the directory. It is always
+	// a subdirectory we own, never one given to us by the operator.
 	if r.Options.ClearDataDir {
-		if err := os.RemoveAll(dataDir); err != nil && !os.IsNotExist(err) {
-			return nil, fmt.Errorf("remove data directory: %w", err)
+		if err := os.RemoveAll(dir); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("remove directory %q: %w", dir, err)
 		}
 	}
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		return nil, fmt.Errorf("ensure data directory: %w", err)
+	if err := ensureWritable(dir); err != nil {
+		return nil, err
 	}
 	db, err := badgerdb.New(badgerdb.Options{
-		DiskPath:   dataDir,
+		DiskPath:   dir,
 		SyncWrites: true,
 		Debug: func() bool {
 			return strings.ToLower(r.Options.LogLevel) == "debug"
@@ -436,6 +617,19 @@ func (r *Provider) createStorage() (storage.DualStorage, error) {
 	return db, nil
 }
 
+// ensureWritable makes sure the directory exists and that files can be created in it.
+func ensureWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("ensure directory %q: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("directory %q is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 // createSnapshotStorage creates the snapshot storage.
 func (r *Provider) createSnapshotStorage() (raft.SnapshotStore, error) {
 	if r.Options.InMemory {
@@ -468,14 +662,35 @@ func (r *Provider) observe() (closeCh, doneCh chan struct{}) {
 					r.log.Debug("RequestVoteRequest", slog.Any("data", data))
 				case raft.RaftState:
 					r.log.Debug("RaftState", slog.String("data", data.String()))
+					// Heartbeats are only sent by the leader, start over on
+					// any change of state.
+					r.contactMu.Lock()
+					r.failedHeartbeats = nil
+					r.contactMu.Unlock()
 				case raft.PeerObservation:
 					r.log.Debug("PeerObservation", slog.Any("data", data))
+					if data.Removed {
+						r.contactMu.Lock()
+						delete(r.failedHeartbeats, data.Peer.ID)
+						r.contactMu.Unlock()
+					}
+					r.rescaleTimeouts()
 				case raft.LeaderObservation:
 					r.log.Debug("LeaderObservation", slog.Any("data", data))
+					r.rescaleTimeouts()
 				case raft.ResumedHeartbeatObservation:
 					r.log.Debug("ResumedHeartbeatObservation", slog.Any("data", data))
+					r.contactMu.Lock()
+					delete(r.failedHeartbeats, data.PeerID)
+					r.contactMu.Unlock()
 				case raft.FailedHeartbeatObservation:
 					r.log.Debug("FailedHeartbeatObservation", slog.Any("data", data))
+					r.contactMu.Lock()
+					if r.failedHeartbeats == nil {
+						r.failedHeartbeats = make(map[raft.ServerID]time.Time)
+					}
+					r.failedHeartbeats[data.PeerID] = data.LastContact
+					r.contactMu.Unlock()
 				}
 				for _, obs := range r.observerCbs {
 					obs(context.Background(), ev)
@@ -17,15 +17,24 @@ limitations under the License.
 package raftstorage
 
 import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hashicorp/raft"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport"
 	"github.com/webmeshproj/webmesh/pkg/meshnet/transport/tcp"
 	"github.com/webmeshproj/webmesh/pkg/storage"
+	storageerrors "github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/providers/backends/badgerdb"
 	"github.com/webmeshproj/webmesh/pkg/storage/testutil"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
@@ -74,3 +83,380 @@ func newTestOptions(transport transport.RaftTransport) Options {
 		LogLevel:           "",
 	}
 }
+
+func TestQuorumLossReads(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name    string
+		policy  QuorumLossReadPolicy
+		wantErr bool
+	}{
+		{name: "ServeStale", policy: QuorumLossReadStale, wantErr: false},
+		{name: "Error", policy: QuorumLossReadError, wantErr: true},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			providers := (&builder{}).newProviders(t, 2)
+			leader, follower := providers[0], providers[1].(*Provider)
+			follower.Options.QuorumLossReads = tt.policy
+			for _, p := range providers {
+				testutil.MustStartProvider(ctx, t, p)
+			}
+			defer follower.Close()
+			testutil.MustBootstrapProvider(ctx, t, leader)
+			ok := testutil.Eventually[bool](func() bool {
+				return leader.Consensus().IsLeader()
+			}).ShouldEqual(time.Second*10, time.Millisecond*100, true)
+			if !ok {
+				t.Fatal("provider did not become leader")
+			}
+			testutil.MustAddVoter(ctx, t, leader, follower)
+			key := []byte("/registry/quorum-test")
+			if err := leader.MeshStorage().PutValue(ctx, key, []byte("value"), 0); err != nil {
+				t.Fatalf("put value: %v", err)
+			}
+			ok = testutil.Eventually[error](func() error {
+				_, err := follower.MeshStorage().GetValue(ctx, key)
+				return err
+			}).ShouldNotError(time.Second*10, time.Millisecond*100)
+			if !ok {
+				t.Fatal("value was not replicated to follower")
+			}
+
+			// Stopping the leader leaves the follower without a quorum.
+			if err := leader.Close(); err != nil {
+				t.Fatalf("close leader: %v", err)
+			}
+			ok = testutil.Eventually[bool](func() bool {
+				return follower.hasQuorum()
+			}).ShouldEqual(time.Second*10, time.Millisecond*100, false)
+			if !ok {
+				t.Fatal("follower did not detect quorum loss")
+			}
+			val, err := follower.MeshStorage().GetValue(ctx, key)
+			if tt.wantErr {
+				if !errors.Is(err, storageerrors.ErrQuorumLost) {
+					t.Fatalf("expected ErrQuorumLost, got %v", err)
+				}
+				if _, err := follower.MeshStorage().ListKeys(ctx, []byte("/registry")); !errors.Is(err, storageerrors.ErrQuorumLost) {
+					t.Fatalf("expected ErrQuorumLost listing keys, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected stale read to succeed, got %v", err)
+			}
+			if string(val) != "value" {
+				t.Fatalf("expected stale value %q, got %q", "value", val)
+			}
+		})
+	}
+}
+
+func TestSeparateStoreDirs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	transport, err := tcp.NewRaftTransport(nil, tcp.RaftTransportOptions{
+		Addr:    "[::]:0",
+		MaxPool: 10,
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to create raft transport: %v", err)
+	}
+	opts := newTestOptions(transport)
+	opts.InMemory = false
+	opts.DataDir = t.TempDir()
+	opts.LogStoreDir = filepath.Join(t.TempDir(), "logs")
+	opts.DataStoreDir = filepath.Join(t.TempDir(), "data")
+	provider := NewProvider(opts)
+	testutil.MustStartProvider(ctx, t, provider)
+	testutil.MustBootstrapProvider(ctx, t, provider)
+	ok := testutil.Eventually[bool](func() bool {
+		return provider.Consensus().IsLeader()
+	}).ShouldEqual(time.Second*10, time.Millisecond*100, true)
+	if !ok {
+		t.Fatal("provider did not become leader")
+	}
+	key := []byte("/registry/separate-dirs")
+	if err := provider.MeshStorage().PutValue(ctx, key, []byte("value"), 0); err != nil {
+		t.Fatalf("put value: %v", err)
+	}
+	if err := provider.Close(); err != nil {
+		t.Fatalf("close provider: %v", err)
+	}
+	if _, err := os.Stat(opts.defaultStoreDir()); !os.IsNotExist(err) {
+		t.Fatalf("expected default store directory to not be created, got %v", err)
+	}
+
+	// The log store holds the raft log but not the mesh data.
+	logs, err := badgerdb.New(badgerdb.Options{DiskPath: opts.logStoreDir()})
+	if err != nil {
+		t.Fatalf("open log store: %v", err)
+	}
+	defer logs.Close()
+	if last, err := logs.LastIndex(); err != nil || last == 0 {
+		t.Fatalf("expected raft log entries in the log store, got last index %d: %v", last, err)
+	}
+	if _, err := logs.GetValue(ctx, key); !storageerrors.IsKeyNotFound(err) {
+		t.Fatalf("expected mesh data to not be in the log store, got %v", err)
+	}
+
+	// The data store holds the mesh data but not the raft log.
+	data, err := badgerdb.New(badgerdb.Options{DiskPath: opts.dataStoreDir()})
+	if err != nil {
+		t.Fatalf("open data store: %v", err)
+	}
+	defer data.Close()
+	if _, err := data.GetValue(ctx, key); err != nil {
+		t.Fatalf("expected mesh data in the data store: %v", err)
+	}
+	if last, err := data.LastIndex(); err != nil || last != 0 {
+		t.Fatalf("expected no raft log entries in the data store, got last index %d: %v", last, err)
+	}
+
+	t.Run("ClearKeepsOperatorFiles", func(t *testing.T) {
+		opts := newTestOptions(nil)
+		opts.InMemory = false
+		opts.ClearDataDir = true
+		opts.LogStoreDir = t.TempDir()
+		keep := filepath.Join(opts.LogStoreDir, "keep")
+		if err := os.WriteFile(keep, []byte("operator data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		db, err := NewProvider(opts).openDiskStorage(opts.logStoreDir())
+		if err != nil {
+			t.Fatalf("open log store: %v", err)
+		}
+		db.Close()
+		if _, err := os.Stat(keep); err != nil {
+			t.Fatalf("expected files outside the node's store to be kept: %v", err)
+		}
+	})
+
+	t.Run("NotWritable", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		transport, err := tcp.NewRaftTransport(nil, tcp.RaftTransportOptions{
+			Addr:    "[::]:0",
+			MaxPool: 10,
+			Timeout: time.Second,
+		})
+		if err != nil {
+			t.Fatalf("failed to create raft transport: %v", err)
+		}
+		defer transport.Close()
+		opts := newTestOptions(transport)
+		opts.InMemory = false
+		opts.DataDir = t.TempDir()
+		opts.LogStoreDir = filepath.Join(file, "logs")
+		if err := NewProvider(opts).Start(ctx); err == nil {
+			t.Fatal("expected error starting with an unwritable log store directory")
+		}
+	})
+}
+
+func TestSnapshotOnShutdown(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name      string
+		enabled   bool
+		snapshots int
+	}{
+		{name: "Enabled", enabled: true, snapshots: 1},
+		{name: "Disabled", enabled: false, snapshots: 0},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			transport, err := tcp.NewRaftTransport(nil, tcp.RaftTransportOptions{
+				Addr:    "[::]:0",
+				MaxPool: 10,
+				Timeout: time.Second,
+			})
+			if err != nil {
+				t.Fatalf("failed to create raft transport: %v", err)
+			}
+			opts := newTestOptions(transport)
+			opts.InMemory = false
+			opts.DataDir = t.TempDir()
+			// Keep periodic snapshots out of the way.
+			opts.SnapshotThreshold = 1000
+			opts.SnapshotOnShutdown = tt.enabled
+			opts.ShutdownSnapshotTimeout = time.Second * 5
+			provider := NewProvider(opts)
+			testutil.MustStartProvider(ctx, t, provider)
+			testutil.MustBootstrapProvider(ctx, t, provider)
+			ok := testutil.Eventually[bool](func() bool {
+				return provider.Consensus().IsLeader()
+			}).ShouldEqual(time.Second*10, time.Millisecond*100, true)
+			if !ok {
+				t.Fatal("provider did not become leader")
+			}
+			if err := provider.MeshStorage().PutValue(ctx, []byte("/registry/snapshot-on-shutdown"), []byte("value"), 0); err != nil {
+				t.Fatalf("put value: %v", err)
+			}
+			if err := provider.Close(); err != nil {
+				t.Fatalf("close provider: %v", err)
+			}
+			snapshots, err := raft.NewFileSnapshotStore(opts.DataDir, int(opts.SnapshotRetention), io.Discard)
+			if err != nil {
+				t.Fatalf("open snapshot store: %v", err)
+			}
+			list, err := snapshots.List()
+			if err != nil {
+				t.Fatalf("list snapshots: %v", err)
+			}
+			if len(list) != tt.snapshots {
+				t.Fatalf("expected %d snapshots after shutdown, got %d", tt.snapshots, len(list))
+			}
+		})
+	}
+}
+
+func TestRestoreSnapshotFromURL(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	providers := (&builder{}).newProviders(t, 2)
+	source, target := providers[0].(*Provider), providers[1].(*Provider)
+	for _, p := range providers {
+		testutil.MustStartProvider(ctx, t, p)
+		defer p.Close()
+		testutil.MustBootstrapProvider(ctx, t, p)
+		ok := testutil.Eventually[bool](func() bool {
+			return p.Consensus().IsLeader()
+		}).ShouldEqual(time.Second*10, time.Millisecond*100, true)
+		if !ok {
+			t.Fatal("provider did not become leader")
+		}
+	}
+	key := []byte("/registry/restore-from-url")
+	if err := source.MeshStorage().PutValue(ctx, key, []byte("value"), 0); err != nil {
+		t.Fatalf("put value: %v", err)
+	}
+	future := source.raft.Snapshot()
+	if err := future.Error(); err != nil {
+		t.Fatalf("take snapshot: %v", err)
+	}
+	_, rdr, err := future.Open()
+	if err != nil {
+		t.Fatalf("open snapshot: %v", err)
+	}
+	blob, err := io.ReadAll(rdr)
+	rdr.Close()
+	if err != nil {
+		t.Fatalf("read snapshot: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(blob)
+	}))
+	defer srv.Close()
+
+	// Requests without the configured headers are rejected.
+	if _, err := storage.OpenSnapshot(ctx, srv.URL, nil); err == nil {
+		t.Fatal("expected error fetching snapshot without authorization")
+	}
+	snapshot, err := storage.OpenSnapshot(ctx, srv.URL, map[string]string{"Authorization": "Bearer secret"})
+	if err != nil {
+		t.Fatalf("fetch snapshot: %v", err)
+	}
+	defer snapshot.Close()
+	if err := target.RestoreSnapshot(ctx, snapshot, false); err != nil {
+		t.Fatalf("restore snapshot: %v", err)
+	}
+	val, err := target.MeshStorage().GetValue(ctx, key)
+	if err != nil {
+		t.Fatalf("get restored value: %v", err)
+	}
+	if string(val) != "value" {
+		t.Fatalf("expected restored value %q, got %q", "value", val)
+	}
+}
+
+func TestRaftConfigurationIndex(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	providers := (&builder{}).newProviders(t, 2)
+	leader, follower := providers[0].(*Provider), providers[1].(*Provider)
+	for _, p := range providers {
+		testutil.MustStartProvider(ctx, t, p)
+	}
+	defer follower.Close()
+	testutil.MustBootstrapProvider(ctx, t, leader)
+	ok := testutil.Eventually[bool](func() bool {
+		return leader.Consensus().IsLeader()
+	}).ShouldEqual(time.Second*10, time.Millisecond*100, true)
+	if !ok {
+		t.Fatal("provider did not become leader")
+	}
+	// The bootstrap configuration is applied asynchronously after the election.
+	ok = testutil.Eventually[bool](func() bool {
+		return leader.GetRaftConfigurationIndex() > 0
+	}).ShouldEqual(time.Second*10, time.Millisecond*100, true)
+	if !ok {
+		t.Fatal("expected a non-zero configuration index after bootstrap")
+	}
+	bootstrapped := leader.GetRaftConfigurationIndex()
+	// Writing data does not change the configuration.
+	if err := leader.MeshStorage().PutValue(ctx, []byte("/registry/config-index"), []byte("value"), 0); err != nil {
+		t.Fatalf("put value: %v", err)
+	}
+	if index := leader.GetRaftConfigurationIndex(); index != bootstrapped {
+		t.Fatalf("expected configuration index to stay at %d after a write, got %d", bootstrapped, index)
+	}
+
+	testutil.MustAddVoter(ctx, t, leader, follower)
+	added := leader.GetRaftConfigurationIndex()
+	if added <= bootstrapped {
+		t.Fatalf("expected configuration index to advance past %d after adding a voter, got %d", bootstrapped, added)
+	}
+
+	peer := types.StoragePeer{StoragePeer: follower.Status().GetPeers()[0]}
+	if err := leader.Consensus().RemovePeer(ctx, peer, true); err != nil {
+		t.Fatalf("remove peer: %v", err)
+	}
+	if removed := leader.GetRaftConfigurationIndex(); removed <= added {
+		t.Fatalf("expected configuration index to advance past %d after removing a peer, got %d", added, removed)
+	}
+}
+
+func TestBarrier(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	providers := (&builder{}).newProviders(t, 2)
+	leader, follower := providers[0].(*Provider), providers[1].(*Provider)
+	for _, p := range providers {
+		testutil.MustStartProvider(ctx, t, p)
+	}
+	defer follower.Close()
+	testutil.MustBootstrapProvider(ctx, t, leader)
+	ok := testutil.Eventually[bool](func() bool {
+		return leader.Consensus().IsLeader()
+	}).ShouldEqual(time.Second*10, time.Millisecond*100, true)
+	if !ok {
+		t.Fatal("provider did not become leader")
+	}
+	testutil.MustAddVoter(ctx, t, leader, follower)
+	if err := leader.MeshStorage().PutValue(ctx, []byte("/registry/barrier"), []byte("value"), 0); err != nil {
+		t.Fatalf("put value: %v", err)
+	}
+	if err := leader.Barrier(ctx); err != nil {
+		t.Fatalf("barrier on leader: %v", err)
+	}
+	if err := follower.Barrier(ctx); !errors.Is(err, storageerrors.ErrNotLeader) {
+		t.Fatalf("expected ErrNotLeader from barrier on follower, got %v", err)
+	}
+}
@@ -20,35 +20,85 @@ package snapshots
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/raft"
 
 	"github.com/webmeshproj/webmesh/pkg/context"
 	"github.com/webmeshproj/webmesh/pkg/storage"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb/state"
 )
 
+const (
+	// SchemaVersion is the schema version written to new snapshots.
+	SchemaVersion = 1
+	// MinSchemaVersion is the oldest snapshot schema version that can be restored.
+	// Snapshots taken before versioning was introduced are treated as version 0.
+	MinSchemaVersion = 0
+)
+
+// schemaVersionComment is the prefix of the gzip header comment used to
+// record the schema version of a snapshot.
+const schemaVersionComment = "webmesh-schema-version="
+
+// ErrIncompatibleSnapshot is returned when a snapshot was written with a
+// schema version that cannot be restored.
+var ErrIncompatibleSnapshot = errors.New("incompatible snapshot schema")
+
+// ErrStoreNotEmpty is returned when restoring a snapshot over a store that
+// already contains mesh state without forcing the restore.
+var ErrStoreNotEmpty = errors.New("store already contains mesh state")
+
 // Snapshotter is an interface for taking and restoring snapshots.
 type Snapshotter interface {
 	// Snapshot returns a new snapshot.
 	Snapshot(ctx context.Context) (raft.FSMSnapshot, error)
-	// Restore restores a snapshot.
-	Restore(ctx context.Context, r io.ReadCloser) error
+	// Restore restores a snapshot, replacing all data in the store. It returns
+	// ErrStoreNotEmpty if the store already contains mesh state, unless the
+	// restore is forced.
+	Restore(ctx context.Context, r io.ReadCloser, opts RestoreOptions) error
+}
+
+// RestoreOptions are options for restoring a snapshot.
+type RestoreOptions struct {
+	// Force restores the snapshot even if the store already contains mesh
+	// state, which is dropped.
+	Force bool
+}
+
+// Options are options for the Snapshotter.
+type Options struct {
+	// CompressionLevel is the gzip compression level to use for snapshots.
+	// See the compress/gzip package for valid values. Note that the zero
+	// value is gzip.NoCompression, use NewOptions for the default level.
+	CompressionLevel int
+}
+
+// NewOptions returns new options with the default compression level.
+func NewOptions() Options {
+	return Options{
+		CompressionLevel: gzip.DefaultCompression,
+	}
 }
 
 type snapshotter struct {
-	st  storage.ConsensusStorage
-	log *slog.Logger
+	st   storage.ConsensusStorage
+	opts Options
+	log  *slog.Logger
 }
 
 // New returns a new Snapshotter.
-func New(ctx context.Context, st storage.ConsensusStorage) Snapshotter {
+func New(ctx context.Context, st storage.ConsensusStorage, opts Options) Snapshotter {
 	return &snapshotter{
-		st:  st,
-		log: context.LoggerFrom(ctx).With("component", "snapshots"),
+		st:   st,
+		opts: opts,
+		log:  context.LoggerFrom(ctx).With("component", "snapshots"),
 	}
 }
 
@@ -60,7 +110,11 @@ func (s *snapshotter) Snapshot(ctx context.Context) (raft.FSMSnapshot, error) {
 		return nil, fmt.Errorf("get snapshot: %w", err)
 	}
 	var buf bytes.Buffer
-	gzw := gzip.NewWriter(&buf)
+	gzw, err := gzip.NewWriterLevel(&buf, s.opts.CompressionLevel)
+	if err != nil {
+		return nil, fmt.Errorf("create gzip writer: %w", err)
+	}
+	gzw.Comment = schemaVersionComment + strconv.Itoa(SchemaVersion)
 	if _, err := io.Copy(gzw, data); err != nil {
 		return nil, fmt.Errorf("compress snapshot data: %w", err)
 	}
@@ -75,15 +129,32 @@ func (s *snapshotter) Snapshot(ctx context.Context) (raft.FSMSnapshot, error) {
 	return snapshot, nil
 }
 
-func (s *snapshotter) Restore(ctx context.Context, r io.ReadCloser) error {
+func (s *snapshotter) Restore(ctx context.Context, r io.ReadCloser, opts RestoreOptions) error {
 	defer r.Close()
-	s.log.Info("restoring db snapshot")
+	if ms, ok := s.st.(storage.MeshStorage); ok && !opts.Force {
+		populated, err := HasMeshState(ctx, ms)
+		if err != nil {
+			return err
+		}
+		if populated {
+			return ErrStoreNotEmpty
+		}
+	}
+	s.log.Info("restoring db snapshot", slog.Bool("force", opts.Force))
 	start := time.Now()
 	gzr, err := gzip.NewReader(r)
 	if err != nil {
 		return fmt.Errorf("gzip reader: %w", err)
 	}
 	defer gzr.Close()
+	version, err := schemaVersion(gzr.Header)
+	if err != nil {
+		return err
+	}
+	if version < MinSchemaVersion || version > SchemaVersion {
+		return fmt.Errorf("%w: snapshot has schema version %d, supported versions are %d through %d",
+			ErrIncompatibleSnapshot, version, MinSchemaVersion, SchemaVersion)
+	}
 	data, err := io.ReadAll(gzr)
 	if err != nil {
 		return fmt.Errorf("read snapshot: %w", err)
@@ -95,6 +166,28 @@ func (s *snapshotter) Restore(ctx context.Context, r io.ReadCloser) error {
 	return nil
 }
 
+// HasMeshState returns true if the given storage contains any mesh state.
+func HasMeshState(ctx context.Context, st storage.MeshStorage) (bool, error) {
+	keys, err := st.ListKeys(ctx, state.MeshStatePrefix)
+	if err != nil {
+		return false, fmt.Errorf("list mesh state keys: %w", err)
+	}
+	return len(keys) > 0, nil
+}
+
+// schemaVersion returns the schema version recorded in the given gzip header.
+// Snapshots without a recorded version are treated as the oldest version.
+func schemaVersion(hdr gzip.Header) (int, error) {
+	if !strings.HasPrefix(hdr.Comment, schemaVersionComment) {
+		return MinSchemaVersion, nil
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(hdr.Comment, schemaVersionComment))
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid schema version %q", ErrIncompatibleSnapshot, hdr.Comment)
+	}
+	return version, nil
+}
+
 // snapshot is a Raft snapshot.
 type snapshot struct {
 	data *bytes.Buffer
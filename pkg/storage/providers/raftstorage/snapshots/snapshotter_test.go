@@ -18,10 +18,14 @@ package snapshots
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"testing"
 
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb/state"
 	"github.com/webmeshproj/webmesh/pkg/storage/providers/backends/badgerdb"
 )
 
@@ -45,7 +49,7 @@ func TestSnapshotter(t *testing.T) {
 			t.Fatal(err)
 		}
 	}
-	snaps := New(context.Background(), db)
+	snaps := New(context.Background(), db, NewOptions())
 
 	// Take a snapshot.
 	snap, err := snaps.Snapshot(context.Background())
@@ -68,7 +72,7 @@ func TestSnapshotter(t *testing.T) {
 	}
 
 	// Restore the snapshot.
-	if err := snaps.Restore(context.Background(), sink); err != nil {
+	if err := snaps.Restore(context.Background(), sink, RestoreOptions{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -86,6 +90,193 @@ func TestSnapshotter(t *testing.T) {
 	}
 }
 
+func TestSnapshotterCompressionLevels(t *testing.T) {
+	t.Parallel()
+
+	levels := map[string]int{
+		"Default":         gzip.DefaultCompression,
+		"NoCompression":   gzip.NoCompression,
+		"BestSpeed":       gzip.BestSpeed,
+		"BestCompression": gzip.BestCompression,
+		"HuffmanOnly":     gzip.HuffmanOnly,
+	}
+	for name, level := range levels {
+		name, level := name, level
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			db, err := badgerdb.NewInMemory(badgerdb.Options{})
+			if err != nil {
+				t.Fatalf("create test db: %v", err)
+			}
+			defer db.Close()
+			key, val := []byte("/registry/foo"), bytes.Repeat([]byte("bar"), 1024)
+			if err := db.PutValue(ctx, key, val, 0); err != nil {
+				t.Fatal(err)
+			}
+			snaps := New(ctx, db, Options{CompressionLevel: level})
+			snap, err := snaps.Snapshot(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer snap.Release()
+			if err := db.Delete(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+			sink := &testSnapshotSink{new(bytes.Buffer)}
+			if err := snap.Persist(sink); err != nil {
+				t.Fatal(err)
+			}
+			if err := snaps.Restore(ctx, sink, RestoreOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := db.GetValue(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, val) {
+				t.Errorf("restored value does not match original")
+			}
+		})
+	}
+
+	t.Run("InvalidLevel", func(t *testing.T) {
+		t.Parallel()
+		db, err := badgerdb.NewInMemory(badgerdb.Options{})
+		if err != nil {
+			t.Fatalf("create test db: %v", err)
+		}
+		defer db.Close()
+		snaps := New(context.Background(), db, Options{CompressionLevel: 42})
+		if _, err := snaps.Snapshot(context.Background()); err == nil {
+			t.Fatal("expected error for invalid compression level")
+		}
+	})
+}
+
+func TestSnapshotterSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	tc := []struct {
+		name    string
+		comment string
+		wantErr bool
+	}{
+		{name: "Unversioned", comment: ""},
+		{name: "Current", comment: fmt.Sprintf("%s%d", schemaVersionComment, SchemaVersion)},
+		{name: "Newer", comment: fmt.Sprintf("%s%d", schemaVersionComment, SchemaVersion+1), wantErr: true},
+		{name: "Older", comment: fmt.Sprintf("%s%d", schemaVersionComment, MinSchemaVersion-1), wantErr: true},
+		{name: "Malformed", comment: schemaVersionComment + "abc", wantErr: true},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			db, err := badgerdb.NewInMemory(badgerdb.Options{})
+			if err != nil {
+				t.Fatalf("create test db: %v", err)
+			}
+			defer db.Close()
+			key, val := []byte("/registry/foo"), []byte("bar")
+			if err := db.PutValue(ctx, key, val, 0); err != nil {
+				t.Fatal(err)
+			}
+			// Take a snapshot of the current data and rewrite it with the test header.
+			data, err := db.Snapshot(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			gzw := gzip.NewWriter(&buf)
+			gzw.Comment = tt.comment
+			if _, err := io.Copy(gzw, data); err != nil {
+				t.Fatal(err)
+			}
+			if err := gzw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// Change the value so we can tell whether the restore was applied.
+			if err := db.PutValue(ctx, key, []byte("changed"), 0); err != nil {
+				t.Fatal(err)
+			}
+			err = New(ctx, db, NewOptions()).Restore(ctx, io.NopCloser(&buf), RestoreOptions{})
+			got, getErr := db.GetValue(ctx, key)
+			if getErr != nil {
+				t.Fatalf("expected data to survive restore, got %v", getErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrIncompatibleSnapshot) {
+					t.Fatalf("expected ErrIncompatibleSnapshot, got %v", err)
+				}
+				if string(got) != "changed" {
+					t.Fatalf("expected refused restore to leave data untouched, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("restore: %v", err)
+			}
+			if !bytes.Equal(got, val) {
+				t.Fatalf("got %q, want %q", got, val)
+			}
+		})
+	}
+}
+
+func TestSnapshotterRestoreForce(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db, err := badgerdb.NewInMemory(badgerdb.Options{})
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	defer db.Close()
+	domainKey := state.MeshDomainKey
+	if err := db.PutValue(ctx, domainKey, []byte("snapshot.internal"), 0); err != nil {
+		t.Fatal(err)
+	}
+	snaps := New(ctx, db, NewOptions())
+	snap, err := snaps.Snapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+	sink := &testSnapshotSink{new(bytes.Buffer)}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	data := sink.ReadWriter.(*bytes.Buffer).Bytes()
+
+	// The store now holds live mesh state that differs from the snapshot.
+	if err := db.PutValue(ctx, domainKey, []byte("live.internal"), 0); err != nil {
+		t.Fatal(err)
+	}
+	err = snaps.Restore(ctx, io.NopCloser(bytes.NewReader(data)), RestoreOptions{})
+	if !errors.Is(err, ErrStoreNotEmpty) {
+		t.Fatalf("expected ErrStoreNotEmpty, got %v", err)
+	}
+	got, err := db.GetValue(ctx, domainKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "live.internal" {
+		t.Fatalf("expected refused restore to leave data untouched, got %q", got)
+	}
+
+	err = snaps.Restore(ctx, io.NopCloser(bytes.NewReader(data)), RestoreOptions{Force: true})
+	if err != nil {
+		t.Fatalf("forced restore: %v", err)
+	}
+	got, err = db.GetValue(ctx, domainKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "snapshot.internal" {
+		t.Fatalf("expected forced restore to replace data, got %q", got)
+	}
+}
+
 type testSnapshotSink struct {
 	io.ReadWriter
 }
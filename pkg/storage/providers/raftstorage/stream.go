@@ -0,0 +1,82 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raftstorage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+	v1 "github.com/webmeshproj/api/go/v1"
+
+	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/providers/raftstorage/fsm"
+)
+
+// RaftLogFunc is called for each entry streamed from the raft log.
+type RaftLogFunc func(index uint64, entry *v1.RaftLogEntry) error
+
+// StreamRaftLog calls fn for every command entry in the raft log starting at fromIndex,
+// and then for new entries as they are applied, until the context is canceled or fn
+// returns an error. Entries are read from the log store one at a time, so a slow
+// consumer only delays its own stream and never the FSM. ErrLogCompacted is returned
+// if fromIndex is no longer in the log.
+func (r *Provider) StreamRaftLog(ctx context.Context, fromIndex uint64, fn RaftLogFunc) error {
+	r.mu.RLock()
+	if !r.started.Load() {
+		r.mu.RUnlock()
+		return errors.ErrClosed
+	}
+	logs, raftFSM := r.logs, r.fsm
+	r.mu.RUnlock()
+	first, err := logs.FirstIndex()
+	if err != nil {
+		return fmt.Errorf("get first log index: %w", err)
+	}
+	next := max(fromIndex, first, 1)
+	if fromIndex != 0 && fromIndex < first {
+		return fmt.Errorf("%w: first available index is %d", errors.ErrLogCompacted, first)
+	}
+	for {
+		// Grab the channel before checking the index so an apply in between isn't missed.
+		applied := raftFSM.Applied()
+		for last := raftFSM.LastAppliedIndex(); next <= last; next++ {
+			var l raft.Log
+			if err := logs.GetLog(next, &l); err != nil {
+				if errors.Is(err, raft.ErrLogNotFound) {
+					return fmt.Errorf("%w: index %d", errors.ErrLogCompacted, next)
+				}
+				return fmt.Errorf("get log %d: %w", next, err)
+			}
+			if l.Type != raft.LogCommand {
+				continue
+			}
+			entry, err := fsm.UnmarshalLogEntry(l.Data)
+			if err != nil {
+				return fmt.Errorf("unmarshal log %d: %w", next, err)
+			}
+			if err := fn(next, entry); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-applied:
+		}
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raftstorage
+
+import (
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// DefaultMaxElectionTimeout is the default upper bound for scaled election timeouts.
+const DefaultMaxElectionTimeout = 15 * time.Second
+
+// scaledTimeout scales the base timeout by the number of voters. The timeout
+// grows logarithmically, reaching twice the base at sixteen voters, and never
+// drops below base or exceeds max.
+func scaledTimeout(base, max time.Duration, voters int) time.Duration {
+	if voters < 1 {
+		voters = 1
+	}
+	factor := 1 + math.Log2(float64(voters))/4
+	scaled := time.Duration(float64(base) * factor)
+	if max > 0 && scaled > max {
+		scaled = max
+	}
+	if scaled < base {
+		scaled = base
+	}
+	return scaled
+}
+
+// withLeaderStickiness extends the heartbeat timeout by the leader stickiness.
+// The election timeout is raised to match if needed, since raft requires it to
+// be at least the heartbeat timeout.
+func withLeaderStickiness(heartbeat, election, stickiness time.Duration) (time.Duration, time.Duration) {
+	heartbeat += stickiness
+	return heartbeat, max(election, heartbeat)
+}
+
+// rescaleTimeouts recomputes the heartbeat and election timeouts for the current
+// number of voters and reloads them into raft if they changed.
+func (r *Provider) rescaleTimeouts() {
+	if !r.ScaleTimeouts {
+		return
+	}
+	future := r.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		r.log.Debug("Failed to get raft configuration for timeout scaling", slog.String("error", err.Error()))
+		return
+	}
+	var voters int
+	for _, server := range future.Configuration().Servers {
+		if server.Suffrage == raft.Voter {
+			voters++
+		}
+	}
+	base := raft.DefaultConfig()
+	heartbeat, election := base.HeartbeatTimeout, base.ElectionTimeout
+	if r.HeartbeatTimeout != 0 {
+		heartbeat = r.HeartbeatTimeout
+	}
+	if r.ElectionTimeout != 0 {
+		election = r.ElectionTimeout
+	}
+	max := r.MaxElectionTimeout
+	if max <= 0 {
+		max = DefaultMaxElectionTimeout
+	}
+	current := r.raft.ReloadableConfig()
+	next := current
+	next.HeartbeatTimeout = scaledTimeout(heartbeat, max, voters)
+	next.ElectionTimeout = scaledTimeout(election, max, voters)
+	if r.LeaderStickiness > 0 {
+		next.HeartbeatTimeout, next.ElectionTimeout = withLeaderStickiness(next.HeartbeatTimeout, next.ElectionTimeout, r.LeaderStickiness)
+	}
+	if next == current {
+		return
+	}
+	r.log.Debug("Scaling raft timeouts by cluster size",
+		slog.Int("voters", voters),
+		slog.Duration("heartbeat-timeout", next.HeartbeatTimeout),
+		slog.Duration("election-timeout", next.ElectionTimeout),
+	)
+	if err := r.raft.ReloadConfig(next); err != nil {
+		r.log.Warn("Failed to reload scaled raft timeouts", slog.String("error", err.Error()))
+	}
+}
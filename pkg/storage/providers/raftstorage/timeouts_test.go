@@ -0,0 +1,159 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raftstorage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+
+	"github.com/webmeshproj/webmesh/pkg/context"
+)
+
+func TestScaledTimeout(t *testing.T) {
+	t.Parallel()
+	base := 2 * time.Second
+	max := 6 * time.Second
+	last := time.Duration(0)
+	for _, voters := range []int{0, 1, 3, 5, 9, 16, 64, 1024, 1 << 20} {
+		got := scaledTimeout(base, max, voters)
+		if got < base || got > max {
+			t.Fatalf("timeout for %d voters out of bounds [%s, %s]: %s", voters, base, max, got)
+		}
+		if got < last {
+			t.Fatalf("timeout for %d voters shrank from %s to %s", voters, last, got)
+		}
+		last = got
+	}
+	if got := scaledTimeout(base, max, 1); got != base {
+		t.Fatalf("expected base timeout for a single voter, got %s", got)
+	}
+	if got := scaledTimeout(base, max, 16); got != 2*base {
+		t.Fatalf("expected twice the base timeout for 16 voters, got %s", got)
+	}
+	if scaledTimeout(base, max, 5) <= scaledTimeout(base, max, 3) {
+		t.Fatal("expected timeout to grow with voter count")
+	}
+	if got := scaledTimeout(base, max, 1<<20); got != max {
+		t.Fatalf("expected timeout to be capped at %s, got %s", max, got)
+	}
+}
+
+func TestLeaderStickiness(t *testing.T) {
+	t.Parallel()
+	const (
+		timeout   = 100 * time.Millisecond
+		partition = 600 * time.Millisecond
+	)
+
+	// startCluster starts a three node raft cluster over in-memory transports
+	// and returns the nodes and transports with the leader first.
+	startCluster := func(t *testing.T, stickiness time.Duration) ([]*raft.Raft, []*raft.InmemTransport) {
+		t.Helper()
+		opts := &Options{
+			HeartbeatTimeout:   timeout,
+			ElectionTimeout:    timeout,
+			LeaderLeaseTimeout: timeout,
+			LeaderStickiness:   stickiness,
+			LogLevel:           "error",
+		}
+		var servers []raft.Server
+		var transports []*raft.InmemTransport
+		for i := 0; i < 3; i++ {
+			addr, trans := raft.NewInmemTransport("")
+			transports = append(transports, trans)
+			servers = append(servers, raft.Server{ID: raft.ServerID(fmt.Sprintf("node-%d", i)), Address: addr})
+		}
+		for _, a := range transports {
+			for _, b := range transports {
+				if a != b {
+					a.Connect(b.LocalAddr(), b)
+				}
+			}
+		}
+		var nodes []*raft.Raft
+		for i, trans := range transports {
+			conf := opts.RaftConfig(context.Background(), string(servers[i].ID))
+			store := raft.NewInmemStore()
+			snaps := raft.NewInmemSnapshotStore()
+			err := raft.BootstrapCluster(conf, store, store, snaps, trans, raft.Configuration{Servers: servers})
+			if err != nil {
+				t.Fatalf("bootstrap cluster: %v", err)
+			}
+			node, err := raft.NewRaft(conf, &raft.MockFSM{}, store, store, snaps, trans)
+			if err != nil {
+				t.Fatalf("new raft: %v", err)
+			}
+			t.Cleanup(func() { _ = node.Shutdown().Error() })
+			nodes = append(nodes, node)
+		}
+		// Wait for a leader and move it to the front.
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			for i, node := range nodes {
+				if node.State() == raft.Leader {
+					nodes[0], nodes[i] = nodes[i], nodes[0]
+					transports[0], transports[i] = transports[i], transports[0]
+					return nodes, transports
+				}
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for a leader")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// interrupt makes the leader unreachable for the duration of the partition
+	// and returns the term of a follower before and after.
+	interrupt := func(nodes []*raft.Raft, transports []*raft.InmemTransport) (before, after string) {
+		before = nodes[1].Stats()["term"]
+		transports[0].DisconnectAll()
+		for _, trans := range transports[1:] {
+			trans.Disconnect(transports[0].LocalAddr())
+		}
+		time.Sleep(partition)
+		for _, trans := range transports[1:] {
+			trans.Connect(transports[0].LocalAddr(), transports[0])
+			transports[0].Connect(trans.LocalAddr(), trans)
+		}
+		return before, nodes[1].Stats()["term"]
+	}
+
+	t.Run("WithoutStickiness", func(t *testing.T) {
+		t.Parallel()
+		nodes, transports := startCluster(t, 0)
+		before, after := interrupt(nodes, transports)
+		if before == after {
+			t.Fatalf("expected followers to start an election, term stayed at %s", before)
+		}
+	})
+
+	t.Run("WithStickiness", func(t *testing.T) {
+		t.Parallel()
+		nodes, transports := startCluster(t, 2*time.Second)
+		before, after := interrupt(nodes, transports)
+		if before != after {
+			t.Fatalf("expected no election within the stickiness window, term went from %s to %s", before, after)
+		}
+		if nodes[0].State() != raft.Leader {
+			t.Fatalf("expected the leader to keep its leadership, it is now %s", nodes[0].State())
+		}
+	})
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/webmeshproj/webmesh/pkg/storage/types"
+)
+
+// RBACManifest is a set of roles, groups, and role bindings to seed
+// into the database when bootstrapping a new mesh.
+type RBACManifest struct {
+	// Roles are the roles to create.
+	Roles []types.Role
+	// Groups are the groups to create.
+	Groups []types.Group
+	// RoleBindings are the role bindings to create.
+	RoleBindings []types.RoleBinding
+}
+
+// rbacManifestFile is the on-disk representation of an RBACManifest.
+// Entries are decoded generically and then unmarshaled with protojson
+// so that enums can be written by name.
+type rbacManifestFile struct {
+	Roles        []map[string]any `yaml:"roles"`
+	Groups       []map[string]any `yaml:"groups"`
+	RoleBindings []map[string]any `yaml:"roleBindings"`
+}
+
+// LoadRBACManifest reads and validates an RBAC manifest from the given
+// YAML or JSON file.
+func LoadRBACManifest(path string) (*RBACManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rbac manifest: %w", err)
+	}
+	return ParseRBACManifest(data)
+}
+
+// ParseRBACManifest parses and validates an RBAC manifest from YAML or JSON data.
+func ParseRBACManifest(data []byte) (*RBACManifest, error) {
+	var file rbacManifestFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse rbac manifest: %w", err)
+	}
+	var manifest RBACManifest
+	for i, entry := range file.Roles {
+		var role types.Role
+		if err := unmarshalManifestEntry(entry, role.UnmarshalProtoJSON); err != nil {
+			return nil, fmt.Errorf("parse role %d: %w", i, err)
+		}
+		manifest.Roles = append(manifest.Roles, role)
+	}
+	for i, entry := range file.Groups {
+		var group types.Group
+		if err := unmarshalManifestEntry(entry, group.UnmarshalProtoJSON); err != nil {
+			return nil, fmt.Errorf("parse group %d: %w", i, err)
+		}
+		manifest.Groups = append(manifest.Groups, group)
+	}
+	for i, entry := range file.RoleBindings {
+		var rb types.RoleBinding
+		if err := unmarshalManifestEntry(entry, rb.UnmarshalProtoJSON); err != nil {
+			return nil, fmt.Errorf("parse role binding %d: %w", i, err)
+		}
+		manifest.RoleBindings = append(manifest.RoleBindings, rb)
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func unmarshalManifestEntry(entry map[string]any, unmarshal func([]byte) error) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return unmarshal(data)
+}
+
+// Validate validates all entries in the manifest. System roles, groups, and role
+// bindings may not be redefined, and role bindings must reference a role that is
+// either defined in the manifest or a system role.
+func (m *RBACManifest) Validate() error {
+	roles := make(map[string]struct{}, len(m.Roles))
+	for _, role := range m.Roles {
+		if err := role.Validate(); err != nil {
+			return fmt.Errorf("invalid role %q: %w", role.GetName(), err)
+		}
+		if IsSystemRole(role.GetName()) {
+			return fmt.Errorf("invalid role %q: cannot redefine a system role", role.GetName())
+		}
+		if _, ok := roles[role.GetName()]; ok {
+			return fmt.Errorf("invalid role %q: defined more than once", role.GetName())
+		}
+		roles[role.GetName()] = struct{}{}
+	}
+	for _, group := range m.Groups {
+		if err := group.Validate(); err != nil {
+			return fmt.Errorf("invalid group %q: %w", group.GetName(), err)
+		}
+		if IsSystemGroup(group.GetName()) {
+			return fmt.Errorf("invalid group %q: cannot redefine a system group", group.GetName())
+		}
+	}
+	for _, rb := range m.RoleBindings {
+		if err := rb.Validate(); err != nil {
+			return fmt.Errorf("invalid role binding %q: %w", rb.GetName(), err)
+		}
+		if IsSystemRoleBinding(rb.GetName()) {
+			return fmt.Errorf("invalid role binding %q: cannot redefine a system role binding", rb.GetName())
+		}
+		if _, ok := roles[rb.GetRole()]; !ok && !IsSystemRole(rb.GetRole()) {
+			return fmt.Errorf("invalid role binding %q: role %q is not defined", rb.GetName(), rb.GetRole())
+		}
+	}
+	return nil
+}
+
+// Apply writes the contents of the manifest to the given RBAC storage.
+func (m *RBACManifest) Apply(ctx context.Context, rb RBAC) error {
+	for _, role := range m.Roles {
+		if err := rb.PutRole(ctx, role); err != nil {
+			return fmt.Errorf("put role %q: %w", role.GetName(), err)
+		}
+	}
+	for _, group := range m.Groups {
+		if err := rb.PutGroup(ctx, group); err != nil {
+			return fmt.Errorf("put group %q: %w", group.GetName(), err)
+		}
+	}
+	for _, binding := range m.RoleBindings {
+		if err := rb.PutRoleBinding(ctx, binding); err != nil {
+			return fmt.Errorf("put role binding %q: %w", binding.GetName(), err)
+		}
+	}
+	return nil
+}
@@ -19,6 +19,8 @@ package rpcdb
 
 import (
 	"context"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"net/netip"
 	"strconv"
@@ -30,6 +32,7 @@ import (
 
 	"github.com/webmeshproj/webmesh/pkg/storage"
 	"github.com/webmeshproj/webmesh/pkg/storage/errors"
+	"github.com/webmeshproj/webmesh/pkg/storage/meshdb/state"
 	"github.com/webmeshproj/webmesh/pkg/storage/types"
 )
 
@@ -77,7 +80,7 @@ func (p *KVStorage) GetValue(ctx context.Context, key []byte) ([]byte, error) {
 		return nil, err
 	}
 	if resp.GetError() != "" {
-		if strings.Contains(err.Error(), "not found") {
+		if strings.Contains(resp.GetError(), "not found") {
 			return nil, errors.ErrKeyNotFound
 		}
 		return nil, fmt.Errorf(resp.GetError())
@@ -191,7 +194,7 @@ func (g *GraphStore) Vertex(nodeID types.NodeID) (node types.MeshNode, props gra
 		return node, props, err
 	}
 	if resp.GetError() != "" {
-		if strings.Contains(err.Error(), "not found") {
+		if strings.Contains(resp.GetError(), "not found") {
 			return node, props, graph.ErrVertexNotFound
 		}
 		return node, props, fmt.Errorf(resp.GetError())
@@ -290,7 +293,7 @@ func (g *GraphStore) Edge(sourceNode, targetNode types.NodeID) (edge graph.Edge[
 	}
 	resp, err := g.Query(context.Background(), req)
 	if resp.GetError() != "" {
-		if strings.Contains(err.Error(), "not found") {
+		if strings.Contains(resp.GetError(), "not found") {
 			return edge, graph.ErrEdgeNotFound
 		}
 		return edge, fmt.Errorf(resp.GetError())
@@ -471,7 +474,7 @@ func (r *RBACStore) GetRole(ctx context.Context, name string) (types.Role, error
 		return meshrole, err
 	}
 	if resp.GetError() != "" {
-		if strings.Contains(err.Error(), "not found") {
+		if strings.Contains(resp.GetError(), "not found") {
 			return meshrole, errors.ErrRoleNotFound
 		}
 		return meshrole, fmt.Errorf(resp.GetError())
@@ -516,7 +519,7 @@ func (r *RBACStore) GetRoleBinding(ctx context.Context, name string) (types.Role
 		return rb, err
 	}
 	if resp.GetError() != "" {
-		if strings.Contains(err.Error(), "not found") {
+		if strings.Contains(resp.GetError(), "not found") {
 			return rb, errors.ErrRoleBindingNotFound
 		}
 		return rb, fmt.Errorf(resp.GetError())
@@ -561,7 +564,7 @@ func (r *RBACStore) GetGroup(ctx context.Context, name string) (types.Group, err
 		return group, err
 	}
 	if resp.GetError() != "" {
-		if strings.Contains(err.Error(), "not found") {
+		if strings.Contains(resp.GetError(), "not found") {
 			return group, errors.ErrGroupNotFound
 		}
 		return group, fmt.Errorf(resp.GetError())
@@ -648,6 +651,80 @@ func (st *MeshStateStore) GetMeshState(ctx context.Context) (types.NetworkState,
 	return state, state.UnmarshalProtoJSON(resp.GetItems()[0])
 }
 
+func (st *MeshStateStore) PutDNSRecord(ctx context.Context, record types.DNSRecord) error {
+	if err := types.ValidateDNSRecord(record); err != nil {
+		return fmt.Errorf("validate dns record: %w", err)
+	}
+	existing, err := st.GetDNSRecords(ctx, record.Name)
+	if err != nil {
+		return fmt.Errorf("get dns records: %w", err)
+	}
+	if err := types.ValidateDNSRecordConflicts(existing, record); err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	resp, err := st.Query(ctx, &v1.QueryRequest{
+		Command: v1.QueryRequest_PUT,
+		Type:    v1.QueryRequest_VALUE,
+		Query:   types.NewQueryFilters().WithID(string(state.DNSRecordKey(record.Name, record.Type))).Encode(),
+		Item:    data,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.GetError() != "" {
+		return stderrors.New(resp.GetError())
+	}
+	return nil
+}
+
+func (st *MeshStateStore) GetDNSRecords(ctx context.Context, name string) (types.DNSRecords, error) {
+	return st.listDNSRecords(ctx, fmt.Sprintf("%s/%s/", state.DNSRecordsPrefix, name))
+}
+
+func (st *MeshStateStore) DeleteDNSRecord(ctx context.Context, name string, typ types.DNSRecordType) error {
+	resp, err := st.Query(ctx, &v1.QueryRequest{
+		Command: v1.QueryRequest_DELETE,
+		Type:    v1.QueryRequest_VALUE,
+		Query:   types.NewQueryFilters().WithID(string(state.DNSRecordKey(name, typ))).Encode(),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.GetError() != "" {
+		return stderrors.New(resp.GetError())
+	}
+	return nil
+}
+
+func (st *MeshStateStore) ListDNSRecords(ctx context.Context) (types.DNSRecords, error) {
+	return st.listDNSRecords(ctx, fmt.Sprintf("%s/", state.DNSRecordsPrefix))
+}
+
+func (st *MeshStateStore) listDNSRecords(ctx context.Context, prefix string) (types.DNSRecords, error) {
+	resp, err := st.Query(ctx, &v1.QueryRequest{
+		Command: v1.QueryRequest_LIST,
+		Type:    v1.QueryRequest_VALUE,
+		Query:   types.NewQueryFilters().WithID(prefix).Encode(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.GetError() != "" {
+		return nil, stderrors.New(resp.GetError())
+	}
+	out := make(types.DNSRecords, len(resp.GetItems()))
+	for i, item := range resp.GetItems() {
+		if err := json.Unmarshal(item, &out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
 // NetworkingStore implements a mesh networking store over a plugin query stream.
 type NetworkingStore struct {
 	*RPCDataStore
@@ -669,6 +746,22 @@ func (nw *NetworkingStore) PutNetworkACL(ctx context.Context, acl types.NetworkA
 	if resp.GetError() != "" {
 		return fmt.Errorf(resp.GetError())
 	}
+	if !acl.InternalOnly {
+		// Storing the ACL cleared any previous scope.
+		return nil
+	}
+	resp, err = nw.Query(ctx, &v1.QueryRequest{
+		Command: v1.QueryRequest_PUT,
+		Type:    v1.QueryRequest_VALUE,
+		Query:   types.NewQueryFilters().WithID(storage.InternalNetworkACLsPrefix.For([]byte(acl.GetName())).String()).Encode(),
+		Item:    []byte(acl.GetName()),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.GetError() != "" {
+		return fmt.Errorf(resp.GetError())
+	}
 	return nil
 }
 
@@ -684,7 +777,7 @@ func (nw *NetworkingStore) GetNetworkACL(ctx context.Context, name string) (type
 		return acl, err
 	}
 	if resp.GetError() != "" {
-		if strings.Contains(err.Error(), "not found") {
+		if strings.Contains(resp.GetError(), "not found") {
 			return acl, errors.ErrACLNotFound
 		}
 		return acl, fmt.Errorf(resp.GetError())
@@ -693,7 +786,15 @@ func (nw *NetworkingStore) GetNetworkACL(ctx context.Context, name string) (type
 		return acl, errors.ErrACLNotFound
 	}
 	err = acl.UnmarshalProtoJSON(resp.GetItems()[0])
-	return acl, err
+	if err != nil {
+		return acl, err
+	}
+	internal, err := nw.internalNetworkACLs(ctx)
+	if err != nil {
+		return acl, err
+	}
+	_, acl.InternalOnly = internal[acl.GetName()]
+	return acl, nil
 }
 
 func (nw *NetworkingStore) DeleteNetworkACL(ctx context.Context, name string) error {
@@ -720,6 +821,10 @@ func (nw *NetworkingStore) ListNetworkACLs(ctx context.Context) (types.NetworkAC
 	if err != nil {
 		return nil, err
 	}
+	internal, err := nw.internalNetworkACLs(ctx)
+	if err != nil {
+		return nil, err
+	}
 	out := make(types.NetworkACLs, len(resp.GetItems()))
 	for i, item := range resp.GetItems() {
 		var acl types.NetworkACL
@@ -727,11 +832,32 @@ func (nw *NetworkingStore) ListNetworkACLs(ctx context.Context) (types.NetworkAC
 		if err != nil {
 			return nil, err
 		}
+		_, acl.InternalOnly = internal[acl.GetName()]
 		out[i] = acl
 	}
 	return out, nil
 }
 
+// internalNetworkACLs returns the names of the ACLs restricted to internal traffic.
+func (nw *NetworkingStore) internalNetworkACLs(ctx context.Context) (map[string]struct{}, error) {
+	resp, err := nw.Query(ctx, &v1.QueryRequest{
+		Command: v1.QueryRequest_LIST,
+		Type:    v1.QueryRequest_VALUE,
+		Query:   types.NewQueryFilters().WithID(fmt.Sprintf("%s/", storage.InternalNetworkACLsPrefix)).Encode(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.GetError() != "" {
+		return nil, fmt.Errorf(resp.GetError())
+	}
+	out := make(map[string]struct{}, len(resp.GetItems()))
+	for _, item := range resp.GetItems() {
+		out[string(item)] = struct{}{}
+	}
+	return out, nil
+}
+
 func (nw *NetworkingStore) PutRoute(ctx context.Context, route types.Route) error {
 	data, err := route.MarshalProtoJSON()
 	if err != nil {
@@ -763,7 +889,7 @@ func (nw *NetworkingStore) GetRoute(ctx context.Context, name string) (types.Rou
 		return route, err
 	}
 	if resp.GetError() != "" {
-		if strings.Contains(err.Error(), "not found") {
+		if strings.Contains(resp.GetError(), "not found") {
 			return route, errors.ErrRouteNotFound
 		}
 		return route, fmt.Errorf(resp.GetError())
@@ -854,3 +980,72 @@ func (nw *NetworkingStore) ListRoutes(ctx context.Context) (types.Routes, error)
 	}
 	return out, nil
 }
+
+func (nw *NetworkingStore) PutSecondaryIPs(ctx context.Context, ips types.SecondaryIPs) error {
+	data, err := json.Marshal(ips)
+	if err != nil {
+		return err
+	}
+	resp, err := nw.Query(ctx, &v1.QueryRequest{
+		Command: v1.QueryRequest_PUT,
+		Type:    v1.QueryRequest_VALUE,
+		Query:   types.NewQueryFilters().WithID(storage.SecondaryIPsPrefix.For([]byte(ips.NodeID)).String()).Encode(),
+		Item:    data,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.GetError() != "" {
+		return fmt.Errorf(resp.GetError())
+	}
+	return nil
+}
+
+func (nw *NetworkingStore) GetSecondaryIPs(ctx context.Context, nodeID types.NodeID) (types.SecondaryIPs, error) {
+	all, err := nw.ListSecondaryIPs(ctx)
+	if err != nil {
+		return types.SecondaryIPs{}, err
+	}
+	for _, ips := range all {
+		if ips.NodeID == nodeID {
+			return ips, nil
+		}
+	}
+	return types.SecondaryIPs{NodeID: nodeID}, nil
+}
+
+func (nw *NetworkingStore) DeleteSecondaryIPs(ctx context.Context, nodeID types.NodeID) error {
+	resp, err := nw.Query(ctx, &v1.QueryRequest{
+		Command: v1.QueryRequest_DELETE,
+		Type:    v1.QueryRequest_VALUE,
+		Query:   types.NewQueryFilters().WithID(storage.SecondaryIPsPrefix.For([]byte(nodeID)).String()).Encode(),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.GetError() != "" {
+		return fmt.Errorf(resp.GetError())
+	}
+	return nil
+}
+
+func (nw *NetworkingStore) ListSecondaryIPs(ctx context.Context) ([]types.SecondaryIPs, error) {
+	resp, err := nw.Query(ctx, &v1.QueryRequest{
+		Command: v1.QueryRequest_LIST,
+		Type:    v1.QueryRequest_VALUE,
+		Query:   types.NewQueryFilters().WithID(fmt.Sprintf("%s/", storage.SecondaryIPsPrefix)).Encode(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.GetError() != "" {
+		return nil, fmt.Errorf(resp.GetError())
+	}
+	out := make([]types.SecondaryIPs, len(resp.GetItems()))
+	for i, item := range resp.GetItems() {
+		if err := json.Unmarshal(item, &out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
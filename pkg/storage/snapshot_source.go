@@ -0,0 +1,101 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// SnapshotRestorer is implemented by providers that can restore the mesh
+// database from a snapshot taken by another cluster.
+type SnapshotRestorer interface {
+	// RestoreSnapshot replaces the contents of the database with the
+	// snapshot read from r. Unless force is true, it refuses to restore
+	// over a database that already contains mesh state.
+	RestoreSnapshot(ctx context.Context, r io.Reader, force bool) error
+}
+
+// ValidateSnapshotSource checks that the given snapshot source is a local
+// file path or a file, http, or https URL. Objects in S3 and other object
+// stores can be restored from with a pre-signed https URL.
+func ValidateSnapshotSource(source string) error {
+	if source == "" {
+		return fmt.Errorf("snapshot source is empty")
+	}
+	if !strings.Contains(source, "://") {
+		return nil
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return fmt.Errorf("parse snapshot url: %w", err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return fmt.Errorf("snapshot url %q has no path", source)
+		}
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Errorf("snapshot url %q has no host", source)
+		}
+	default:
+		return fmt.Errorf("unsupported snapshot url scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// OpenSnapshot opens the snapshot at the given source for reading. The source
+// may be a local file path or a file, http, or https URL. Headers are sent
+// with http(s) requests, e.g. for authorization. The caller must close the
+// returned reader.
+func OpenSnapshot(ctx context.Context, source string, headers map[string]string) (io.ReadCloser, error) {
+	if err := ValidateSnapshotSource(source); err != nil {
+		return nil, err
+	}
+	if !strings.Contains(source, "://") {
+		return os.Open(source)
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("parse snapshot url: %w", err)
+	}
+	if u.Scheme == "file" {
+		return os.Open(u.Path)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create snapshot request: %w", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch snapshot: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch snapshot: unexpected status %s", resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// DNSRecordType is the type of a static DNS record.
+type DNSRecordType string
+
+const (
+	// DNSRecordTypeA is an IPv4 address record.
+	DNSRecordTypeA DNSRecordType = "A"
+	// DNSRecordTypeAAAA is an IPv6 address record.
+	DNSRecordTypeAAAA DNSRecordType = "AAAA"
+	// DNSRecordTypeCNAME is a canonical name record.
+	DNSRecordTypeCNAME DNSRecordType = "CNAME"
+)
+
+// DNSRecord is a static DNS record served by mesh DNS servers alongside
+// the records for nodes.
+type DNSRecord struct {
+	// Name is the name of the record relative to the mesh domain.
+	Name string `json:"name"`
+	// Type is the type of the record.
+	Type DNSRecordType `json:"type"`
+	// Values are the addresses for A and AAAA records, or the single
+	// target for a CNAME record.
+	Values []string `json:"values"`
+	// TTL is the TTL in seconds to serve the record with.
+	TTL uint32 `json:"ttl,omitempty"`
+}
+
+// DNSRecords is a list of static DNS records.
+type DNSRecords []DNSRecord
+
+// Key returns the storage key suffix for the record.
+func (r DNSRecord) Key() string {
+	return r.Name + "/" + string(r.Type)
+}
+
+// ParseDNSRecordType parses a record type, case-insensitively.
+func ParseDNSRecordType(typ string) (DNSRecordType, error) {
+	switch t := DNSRecordType(strings.ToUpper(typ)); t {
+	case DNSRecordTypeA, DNSRecordTypeAAAA, DNSRecordTypeCNAME:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unsupported record type %q", typ)
+	}
+}
+
+// ValidateDNSRecord validates a static DNS record. Names must be a single
+// lowercase DNS label that is not reserved for mesh lookups.
+func ValidateDNSRecord(r DNSRecord) error {
+	if r.Name == "" {
+		return fmt.Errorf("record name must not be empty")
+	}
+	if r.Name != strings.ToLower(r.Name) {
+		return fmt.Errorf("record name %q must be lowercase", r.Name)
+	}
+	if strings.Contains(r.Name, ".") {
+		return fmt.Errorf("record name %q must be a single label", r.Name)
+	}
+	if _, ok := dns.IsDomainName(r.Name); !ok || !IsValidID(r.Name) {
+		return fmt.Errorf("record name %q is invalid", r.Name)
+	}
+	for _, reserved := range ReservedNodeIDs {
+		if r.Name == reserved {
+			return fmt.Errorf("record name %q is reserved", r.Name)
+		}
+	}
+	if len(r.Values) == 0 {
+		return fmt.Errorf("record %s must have at least one value", r.Name)
+	}
+	switch r.Type {
+	case DNSRecordTypeA, DNSRecordTypeAAAA:
+		for _, value := range r.Values {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s record value %q: %w", r.Type, value, err)
+			}
+			if r.Type == DNSRecordTypeA && !addr.Is4() {
+				return fmt.Errorf("A record value %q is not an IPv4 address", value)
+			}
+			if r.Type == DNSRecordTypeAAAA && (!addr.Is6() || addr.Is4In6()) {
+				return fmt.Errorf("AAAA record value %q is not an IPv6 address", value)
+			}
+		}
+	case DNSRecordTypeCNAME:
+		if len(r.Values) != 1 {
+			return fmt.Errorf("CNAME record %s must have exactly one target", r.Name)
+		}
+		if _, ok := dns.IsDomainName(r.Values[0]); !ok {
+			return fmt.Errorf("CNAME record target %q is invalid", r.Values[0])
+		}
+	default:
+		return fmt.Errorf("unsupported record type %q", r.Type)
+	}
+	return nil
+}
+
+// ValidateDNSRecordConflicts makes sure a CNAME is not mixed with other
+// records of the same name. Existing holds the records already stored for
+// the name of r.
+func ValidateDNSRecordConflicts(existing DNSRecords, r DNSRecord) error {
+	for _, rec := range existing {
+		if rec.Type == r.Type {
+			continue
+		}
+		if rec.Type == DNSRecordTypeCNAME || r.Type == DNSRecordTypeCNAME {
+			return fmt.Errorf("record %s already has a %s record, CNAME records cannot be mixed with other types", r.Name, rec.Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+)
+
+func TestValidateDNSRecordConflicts(t *testing.T) {
+	t.Parallel()
+	a := DNSRecord{Name: "web", Type: DNSRecordTypeA, Values: []string{"10.0.0.1"}}
+	aaaa := DNSRecord{Name: "web", Type: DNSRecordTypeAAAA, Values: []string{"fd00::1"}}
+	cname := DNSRecord{Name: "web", Type: DNSRecordTypeCNAME, Values: []string{"node-a"}}
+
+	tc := []struct {
+		name     string
+		existing DNSRecords
+		record   DNSRecord
+		wantErr  bool
+	}{
+		{name: "NoRecords", existing: nil, record: cname, wantErr: false},
+		{name: "ReplaceSameType", existing: DNSRecords{cname}, record: cname, wantErr: false},
+		{name: "AddressFamilies", existing: DNSRecords{a}, record: aaaa, wantErr: false},
+		{name: "CNAMEOverAddress", existing: DNSRecords{a}, record: cname, wantErr: true},
+		{name: "AddressOverCNAME", existing: DNSRecords{cname}, record: aaaa, wantErr: true},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateDNSRecordConflicts(tt.existing, tt.record)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -94,6 +94,51 @@ func ValidateMeshNode(node MeshNode) (validated MeshNode, err error) {
 	return
 }
 
+// grpcFeatures are the features that are served by a node's gRPC server
+// and are therefore only reachable when the node also advertises NODES.
+var grpcFeatures = []v1.Feature{
+	v1.Feature_LEADER_PROXY,
+	v1.Feature_MESH_API,
+	v1.Feature_ADMIN_API,
+	v1.Feature_MEMBERSHIP,
+	v1.Feature_ICE_NEGOTIATION,
+	v1.Feature_STORAGE_QUERIER,
+	v1.Feature_REGISTRAR,
+}
+
+// ValidateFeatures checks that a set of advertised features is consistent.
+// Every feature must be known, advertised once, and have a valid port. Features
+// served over gRPC require the NODES feature and must share its port.
+func ValidateFeatures(features []*v1.FeaturePort) error {
+	seen := make(map[v1.Feature]int32, len(features))
+	for _, feat := range features {
+		if _, ok := v1.Feature_name[int32(feat.GetFeature())]; !ok || feat.GetFeature() == v1.Feature_FEATURE_NONE {
+			return fmt.Errorf("unknown feature %d", feat.GetFeature())
+		}
+		if _, ok := seen[feat.GetFeature()]; ok {
+			return fmt.Errorf("feature %s advertised more than once", feat.GetFeature())
+		}
+		if feat.GetPort() <= 0 || feat.GetPort() > 65535 {
+			return fmt.Errorf("feature %s advertised with invalid port %d", feat.GetFeature(), feat.GetPort())
+		}
+		seen[feat.GetFeature()] = feat.GetPort()
+	}
+	for _, feat := range grpcFeatures {
+		port, ok := seen[feat]
+		if !ok {
+			continue
+		}
+		rpcPort, ok := seen[v1.Feature_NODES]
+		if !ok {
+			return fmt.Errorf("feature %s requires the %s feature", feat, v1.Feature_NODES)
+		}
+		if port != rpcPort {
+			return fmt.Errorf("feature %s must be advertised on the %s port %d, got %d", feat, v1.Feature_NODES, rpcPort, port)
+		}
+	}
+	return nil
+}
+
 // DeepCopy returns a deep copy of the node.
 func (n MeshNode) DeepCopy() MeshNode {
 	return MeshNode{MeshNode: n.MeshNode.DeepCopy()}
@@ -175,6 +220,17 @@ func (n MeshNode) StoragePort() uint16 {
 	return n.PortFor(v1.Feature_STORAGE_PROVIDER)
 }
 
+// ControlPlanePorts returns the gRPC and storage ports advertised by the node.
+func (n MeshNode) ControlPlanePorts() []uint16 {
+	var ports []uint16
+	for _, port := range []uint16{n.RPCPort(), n.StoragePort()} {
+		if port != 0 {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
 // PrivateAddrV4 returns the node's private IPv4 address.
 // Be sure to check if the returned Addr IsValid.
 func (n MeshNode) PrivateAddrV4() netip.Prefix {
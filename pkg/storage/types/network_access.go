@@ -25,6 +25,9 @@ import (
 // NetworkAction wraps a NetworkAction.
 type NetworkAction struct {
 	*v1.NetworkAction `json:",inline"`
+	// Internal marks the action as control-plane traffic destined to
+	// the gRPC or storage port of the destination node.
+	Internal bool `json:"internal,omitempty"`
 }
 
 // Proto returns the protobuf representation of the action.
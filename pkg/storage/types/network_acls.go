@@ -33,6 +33,9 @@ import (
 const (
 	// GroupReference is the prefix of a node name that indicates it is a group reference.
 	GroupReference = "group:"
+	// BootstrapNodesNetworkACL is the name of the built-in NetworkACL that allows
+	// bootstrap nodes to reach each other's control-plane ports.
+	BootstrapNodesNetworkACL = "bootstrap-nodes"
 )
 
 // ValidateACL validates a NetworkACL.
@@ -116,8 +119,28 @@ func (a NetworkACLs) Proto() []*v1.NetworkACL {
 	return proto
 }
 
-// AllowNodesToCommunicate checks if the given nodes are allowed to communicate.
+// AllowNodesToCommunicate checks if the given nodes are allowed to peer.
+// Nodes need to peer for any traffic to flow between them, so this is true when
+// either data-plane or control-plane traffic is allowed. Use AllowDataPlane to
+// check whether the peering may carry more than control-plane traffic.
 func (a NetworkACLs) AllowNodesToCommunicate(ctx context.Context, nodeA, nodeB MeshNode) bool {
+	return a.allowTraffic(ctx, nodeA, nodeB, false) || a.allowTraffic(ctx, nodeA, nodeB, true)
+}
+
+// AllowDataPlane checks if any traffic from nodeA to nodeB is allowed, as opposed
+// to only traffic to its control-plane ports.
+func (a NetworkACLs) AllowDataPlane(ctx context.Context, nodeA, nodeB MeshNode) bool {
+	return a.allowTraffic(ctx, nodeA, nodeB, false)
+}
+
+// AllowTraffic checks if traffic from nodeA to the given port on nodeB is allowed.
+// Traffic to one of the control-plane ports advertised by nodeB is evaluated as
+// internal traffic.
+func (a NetworkACLs) AllowTraffic(ctx context.Context, nodeA, nodeB MeshNode, port uint16) bool {
+	return a.allowTraffic(ctx, nodeA, nodeB, slices.Contains(nodeB.ControlPlanePorts(), port))
+}
+
+func (a NetworkACLs) allowTraffic(ctx context.Context, nodeA, nodeB MeshNode, internal bool) bool {
 	v4action := NetworkAction{
 		NetworkAction: &v1.NetworkAction{
 			SrcNode: nodeA.Id,
@@ -125,6 +148,7 @@ func (a NetworkACLs) AllowNodesToCommunicate(ctx context.Context, nodeA, nodeB M
 			DstNode: nodeB.Id,
 			DstCIDR: nodeB.PrivateIPv4,
 		},
+		Internal: internal,
 	}
 	v6action := NetworkAction{
 		NetworkAction: &v1.NetworkAction{
@@ -133,6 +157,7 @@ func (a NetworkACLs) AllowNodesToCommunicate(ctx context.Context, nodeA, nodeB M
 			DstNode: nodeB.Id,
 			DstCIDR: nodeB.PrivateIPv6,
 		},
+		Internal: internal,
 	}
 	return a.Accept(ctx, v4action) || a.Accept(ctx, v6action)
 }
@@ -154,11 +179,15 @@ func (a NetworkACLs) Accept(ctx context.Context, action NetworkAction) bool {
 // NetworkACL is a Network ACL.
 type NetworkACL struct {
 	*v1.NetworkACL `json:",inline"`
+	// InternalOnly restricts the ACL to internal control-plane traffic. The API
+	// has no notion of ports, so this is stored alongside the ACL by the storage
+	// layer and is never set for ACLs created through the API.
+	InternalOnly bool `json:"-"`
 }
 
 // DeepCopy returns a deep copy of the network ACL.
 func (n NetworkACL) DeepCopy() NetworkACL {
-	return NetworkACL{NetworkACL: n.NetworkACL.DeepCopy()}
+	return NetworkACL{NetworkACL: n.NetworkACL.DeepCopy(), InternalOnly: n.InternalOnly}
 }
 
 // DeepCopyInto copies the node into the given acl.
@@ -233,6 +262,9 @@ func (a NetworkACL) DestinationPrefixes() []netip.Prefix {
 
 // Matches checks if an action matches this ACL.
 func (acl NetworkACL) Matches(ctx context.Context, action NetworkAction) bool {
+	if acl.InternalOnly && !action.Internal {
+		return false
+	}
 	if action.GetSrcNode() != "" && len(acl.GetSourceNodes()) >= 0 {
 		if !containsOrWildcardMatch(acl.GetSourceNodes(), action.GetSrcNode()) {
 			return false
@@ -0,0 +1,74 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package version
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrIncompatibleVersion is returned when nodes running two versions cannot
+// be members of the same mesh.
+var ErrIncompatibleVersion = errors.New("incompatible version")
+
+// CheckCompatible returns an error wrapping ErrIncompatibleVersion if a node
+// running the remote version cannot join a mesh whose leader runs the local
+// version. Releases are compatible when they share a major version, or for
+// 0.x releases, when their minor versions are at most one release apart so
+// that a mesh can be upgraded one node at a time. Development builds that are
+// not tagged releases are assumed to be compatible with everything.
+func CheckCompatible(local, remote string) error {
+	localVer, ok := parseRelease(local)
+	if !ok {
+		return nil
+	}
+	remoteVer, ok := parseRelease(remote)
+	if !ok {
+		return nil
+	}
+	if localVer[0] != remoteVer[0] {
+		return fmt.Errorf("%w: major versions %d and %d differ", ErrIncompatibleVersion, localVer[0], remoteVer[0])
+	}
+	if localVer[0] == 0 && (localVer[1]-remoteVer[1] > 1 || remoteVer[1]-localVer[1] > 1) {
+		return fmt.Errorf("%w: pre-1.0 minor versions 0.%d and 0.%d are more than one release apart", ErrIncompatibleVersion, localVer[1], remoteVer[1])
+	}
+	return nil
+}
+
+// parseRelease parses the major, minor, and patch numbers of a release
+// version like v1.2.3 or 1.2.3-rc.1.
+func parseRelease(v string) ([3]int, bool) {
+	var out [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return out, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return out, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2023 Avi Zimmerman <avi.zimmerman@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package version
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckCompatible(t *testing.T) {
+	t.Parallel()
+	tc := []struct {
+		local, remote string
+		compatible    bool
+	}{
+		{local: "v1.2.3", remote: "v1.2.3", compatible: true},
+		{local: "v1.2.3", remote: "1.9.0", compatible: true},
+		{local: "v1.2.3", remote: "v1.0.0-rc.1", compatible: true},
+		{local: "v1.2.3", remote: "v2.0.0", compatible: false},
+		{local: "v0.12.0", remote: "v0.12.7+dirty", compatible: true},
+		{local: "v0.12.0", remote: "v0.13.0", compatible: true},
+		{local: "v0.12.0", remote: "v0.11.9", compatible: true},
+		{local: "v0.12.0", remote: "v0.14.0", compatible: false},
+		{local: "v0.12.0", remote: "v0.10.3", compatible: false},
+		{local: "unknown", remote: "v9.0.0", compatible: true},
+		{local: "v0.12.0", remote: "abcdef0", compatible: true},
+	}
+	for _, tt := range tc {
+		err := CheckCompatible(tt.local, tt.remote)
+		if tt.compatible && err != nil {
+			t.Errorf("CheckCompatible(%q, %q): unexpected error: %v", tt.local, tt.remote, err)
+		}
+		if !tt.compatible && !errors.Is(err, ErrIncompatibleVersion) {
+			t.Errorf("CheckCompatible(%q, %q): expected ErrIncompatibleVersion, got %v", tt.local, tt.remote, err)
+		}
+	}
+}